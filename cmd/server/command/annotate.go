@@ -0,0 +1,116 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kenlabs/pando/pkg/api/types"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	adminserver "pandoClient/pkg/server/admin/http"
+)
+
+var annotateReq = adminserver.AnnotateReq{}
+var annotationsFile string
+
+func AnnotateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "attach a local-only annotation to a pushed cid, empty value removes it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := annotateReq.Validate(); err != nil {
+				return err
+			}
+			bodyBytes, err := json.Marshal(annotateReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/annotate")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&annotateReq.Cid, "cid", "", "", "cid to annotate, required")
+	cmd.Flags().StringVarP(&annotateReq.Key, "key", "k", "", "annotation key, e.g. note, ticket or verified, required")
+	cmd.Flags().StringVarP(&annotateReq.Value, "value", "v", "", "annotation value")
+
+	return cmd
+}
+
+func AnnotationsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "annotations",
+		Short: "export or import local annotations",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "export all local annotations to a file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if annotationsFile == "" {
+				return fmt.Errorf("nil output file")
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/annotations")
+			if err != nil {
+				return err
+			}
+			resJson := types.ResponseJson{}
+			if err = json.Unmarshal(res.Body(), &resJson); err != nil {
+				return err
+			}
+			if resJson.Code != http.StatusOK {
+				return PrintResponseData(res)
+			}
+			b, err := json.MarshalIndent(resJson.Data, "", " ")
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(annotationsFile, b, 0o644)
+		},
+	}
+	exportCmd.Flags().StringVarP(&annotationsFile, "output", "o", "", "file to export to, required")
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "merge annotations exported by another instance into the local ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if annotationsFile == "" {
+				return fmt.Errorf("nil input file")
+			}
+			b, err := os.ReadFile(annotationsFile)
+			if err != nil {
+				return err
+			}
+			req := adminserver.ImportAnnotationsReq{}
+			if err = json.Unmarshal(b, &req.Annotations); err != nil {
+				return err
+			}
+			bodyBytes, err := json.Marshal(req)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/annotations")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+	importCmd.Flags().StringVarP(&annotationsFile, "input", "i", "", "file to import from, required")
+
+	cmd.AddCommand(exportCmd, importCmd)
+	return cmd
+}
@@ -1,17 +1,45 @@
 package command
 
 import (
+	"github.com/ipfs/go-cid"
 	"github.com/spf13/cobra"
+	"strconv"
 )
 
+var announceMessageLast bool
+
 func AnnounceCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "announce",
-		Short: "announce latest metadata to pubusb",
+		Use:   "announce [cid]",
+		Short: "announce latest metadata to pubusb, or re-announce a pushed cid and check its inclusion again",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/admin/announce"
+			if len(args) == 1 {
+				if _, err := cid.Decode(args[0]); err != nil {
+					return err
+				}
+				path += "/" + args[0]
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Post(path)
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	messageCmd := &cobra.Command{
+		Use:   "message",
+		Short: "show the announce message the next announce would gossip: head cid, addresses and extra data",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			res, err := Client.R().
 				SetHeader("Content-Type", "application/octet-stream").
-				Post("/admin/announce")
+				SetQueryParam("last", strconv.FormatBool(announceMessageLast)).
+				Get("/admin/announce/message")
 			if err != nil {
 				return err
 			}
@@ -19,6 +47,8 @@ func AnnounceCommand() *cobra.Command {
 			return PrintResponseData(res)
 		},
 	}
+	messageCmd.Flags().BoolVarP(&announceMessageLast, "last", "l", false, "show the last announce message gossiped instead")
+	cmd.AddCommand(messageCmd)
 
 	return cmd
 }
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var auditLogOutput string
+
+func AuditLogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auditlog",
+		Short: "verify, export or recover from the hash-chained audit log of the publishes and announcements",
+	}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "check that no entry of the audit log was altered, removed or reordered",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/auditlog/verify")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "write the entries of the audit log as json lines, oldest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportAuditLog(auditLogOutput)
+		},
+	}
+	exportCmd.Flags().StringVarP(&auditLogOutput, "output", "o", "", "file to write the audit log to, stdout if empty")
+	recoverCmd := &cobra.Command{
+		Use:   "recover",
+		Short: "rebuild the latest metadata, the pushed cid list and the check list by replaying the audit log",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/auditlog/recover")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+	cmd.AddCommand(verifyCmd, exportCmd, recoverCmd)
+
+	return cmd
+}
+
+// exportAuditLog copies the exported audit log to the file output, stdout if empty.
+func exportAuditLog(output string) error {
+	res, err := Client.R().
+		SetHeader("Content-Type", "application/octet-stream").
+		SetDoNotParseResponse(true).
+		Get("/admin/auditlog/export")
+	if err != nil {
+		return err
+	}
+	body := res.RawBody()
+	defer body.Close()
+	if !res.IsSuccess() {
+		return streamError(res, body)
+	}
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+)
+
+func BackupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup <cid>",
+		Short: "show whether a pushed cid is backed up to Filecoin and in which deal it is sealed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := cid.Decode(args[0]); err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/backup/" + args[0])
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
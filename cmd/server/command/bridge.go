@@ -0,0 +1,82 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+)
+
+var (
+	bridgeReq   = adminserver.BridgeReq{}
+	unbridgeReq = adminserver.UnbridgeReq{}
+	listBridges bool
+)
+
+func BridgeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bridge",
+		Short: "continuously notarize the advertisement chain of an index-provider in Pando",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listBridges {
+				res, err := Client.R().Get("/admin/bridges")
+				if err != nil {
+					return err
+				}
+				return PrintResponseData(res)
+			}
+			if bridgeReq.Provider == "" {
+				return fmt.Errorf("nil index-provider to bridge")
+			}
+			bodyBytes, err := json.Marshal(bridgeReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/bridge")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&bridgeReq.Provider, "provider", "p", "", "peer id the index-provider publishes its advertisements with")
+	cmd.Flags().StringVarP(&bridgeReq.Addr, "addr", "a", "", "multiaddr of the advertisement publisher, an http one for httpsync")
+	cmd.Flags().StringVarP(&bridgeReq.Topic, "topic", "t", "", "topic of the libp2p advertisement publisher, /indexer/ingest/mainnet if empty")
+	cmd.Flags().BoolVarP(&listBridges, "list", "l", false, "list the running bridges")
+
+	return cmd
+}
+
+func UnbridgeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unbridge",
+		Short: "stop notarizing the advertisements of an index-provider, the published metadatas are kept",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if unbridgeReq.Provider == "" {
+				return fmt.Errorf("nil index-provider to unbridge")
+			}
+			bodyBytes, err := json.Marshal(unbridgeReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/unbridge")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&unbridgeReq.Provider, "provider", "p", "", "peer id of the bridged index-provider")
+
+	return cmd
+}
@@ -1,11 +1,21 @@
 package command
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/ipfs/go-cid"
 	"github.com/spf13/cobra"
+	"io"
+	"net/url"
+	"os"
+	"pandoClient/pkg/engine"
 )
 
-var catCid string
+var (
+	catCid    string
+	catFormat string
+	catStream bool
+)
 
 func CatCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -15,18 +25,71 @@ func CatCommand() *cobra.Command {
 			if _, err := cid.Decode(catCid); err != nil {
 				return err
 			}
+			if catStream {
+				if catFormat != "" {
+					return fmt.Errorf("--stream can not be used with --format")
+				}
+				if JSONOutput {
+					return fmt.Errorf("--stream can not be used with --json")
+				}
+				return streamCat(catCid)
+			}
+			if JSONOutput && (engine.CatFormat(catFormat) == engine.CatRaw || catFormat == "content") {
+				return fmt.Errorf("--format %s can not be used with --json", catFormat)
+			}
+			path := "/admin/cat/" + catCid
+			if catFormat != "" {
+				path += "?format=" + url.QueryEscape(catFormat)
+			}
 			res, err := Client.R().
 				SetHeader("Content-Type", "application/octet-stream").
-				Get("/admin/cat?cid=" + catCid)
+				Get(path)
 			if err != nil {
 				return err
 			}
+			if catFormat == "" || !res.IsSuccess() || JSONOutput {
+				return PrintResponseData(res)
+			}
 
-			return PrintResponseData(res)
+			// print the payload alone, raw bytes are the body of the response.
+			if engine.CatFormat(catFormat) == engine.CatRaw || catFormat == "content" {
+				_, err = os.Stdout.Write(res.Body())
+				return err
+			}
+			var resJson struct {
+				Data string
+			}
+			if err = json.Unmarshal(res.Body(), &resJson); err != nil {
+				return err
+			}
+			fmt.Println(resJson.Data)
+			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&catCid, "cid", "", "", "cid to cat")
+	cmd.Flags().StringVarP(&catFormat, "format", "f", "",
+		"output format of the payload: raw, hex, base64, dag-json, json or content, decoded by its recorded content type; bytes or dag-json guessed if empty")
+	cmd.Flags().BoolVarP(&catStream, "stream", "s", false,
+		"stream the payload to stdout, the content of a linked file node in place of its link")
 
 	return cmd
 }
+
+// streamCat copies the streamed payload of c to stdout without buffering it.
+func streamCat(c string) error {
+	res, err := Client.R().
+		SetHeader("Content-Type", "application/octet-stream").
+		SetDoNotParseResponse(true).
+		Get("/admin/cat/" + c + "/stream")
+	if err != nil {
+		return err
+	}
+	body := res.RawBody()
+	defer body.Close()
+	if !res.IsSuccess() {
+		return streamError(res, body)
+	}
+	_, err = io.Copy(os.Stdout, body)
+	return err
+}
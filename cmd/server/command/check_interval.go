@@ -0,0 +1,45 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+	"time"
+)
+
+func CheckIntervalCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check-interval [interval]",
+		Short: "show the interval between the inclusion checks, or change it until restart, e.g. 30s",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				res, err := Client.R().Get("/admin/checkinterval")
+				if err != nil {
+					return err
+				}
+				return PrintResponseData(res)
+			}
+
+			if _, err := time.ParseDuration(args[0]); err != nil {
+				return fmt.Errorf("invalid check interval: %w", err)
+			}
+			bodyBytes, err := json.Marshal(adminserver.CheckIntervalReq{Interval: args[0]})
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/checkinterval")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func CheckerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checker",
+		Short: "pause, resume or run the inclusion checks, e.g. around a maintenance of Pando",
+	}
+
+	pauseCmd := &cobra.Command{
+		Use:   "pause",
+		Short: "stop the periodic inclusion checks until resume",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return postChecker("/admin/checker/pause")
+		},
+	}
+	resumeCmd := &cobra.Command{
+		Use:   "resume",
+		Short: "resume the periodic inclusion checks after pause",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return postChecker("/admin/checker/resume")
+		},
+	}
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "check the inclusion of all the pending cids now, even while paused",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return postChecker("/admin/checker/check")
+		},
+	}
+	cmd.AddCommand(pauseCmd, resumeCmd, checkCmd)
+
+	return cmd
+}
+
+func postChecker(path string) error {
+	res, err := Client.R().
+		SetHeader("Content-Type", "application/octet-stream").
+		Post(path)
+	if err != nil {
+		return err
+	}
+
+	return PrintResponseData(res)
+}
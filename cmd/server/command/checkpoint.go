@@ -0,0 +1,112 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/spf13/cobra"
+	"os"
+	"pandoClient/pkg/engine"
+	"time"
+)
+
+var (
+	checkpointOutput string
+	checkpointPeer   string
+)
+
+func CheckpointCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checkpoint",
+		Short: "export or verify signed checkpoints of the chain head",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "write a checkpoint of the chain head signed with the provider key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/head/checkpoint")
+			if err != nil {
+				return err
+			}
+			var resJson struct {
+				Code    int
+				Message string
+				Data    *engine.Checkpoint
+			}
+			if err = json.Unmarshal(res.Body(), &resJson); err != nil {
+				return err
+			}
+			if resJson.Data == nil {
+				return fmt.Errorf("unexpected response %d: %s", resJson.Code, resJson.Message)
+			}
+			if checkpointOutput == "" && JSONOutput {
+				return PrintJSON(resJson.Data)
+			}
+			b, err := json.MarshalIndent(resJson.Data, "", " ")
+			if err != nil {
+				return err
+			}
+			if checkpointOutput == "" {
+				fmt.Printf("%s\n", b)
+				return nil
+			}
+			return os.WriteFile(checkpointOutput, append(b, '\n'), 0644)
+		},
+	}
+	exportCmd.Flags().StringVarP(&checkpointOutput, "output", "o", "", "file to write the checkpoint to, stdout if empty")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify [file]",
+		Short: "verify the signature of an exported checkpoint, without connecting to the daemon",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			var cp engine.Checkpoint
+			if err = json.Unmarshal(b, &cp); err != nil {
+				return fmt.Errorf("failed to decode checkpoint: %w", err)
+			}
+			var provider peer.ID
+			if checkpointPeer != "" {
+				if provider, err = peer.Decode(checkpointPeer); err != nil {
+					return err
+				}
+			}
+			if err = engine.VerifyCheckpoint(&cp, provider); err != nil {
+				return err
+			}
+			if JSONOutput {
+				return PrintJSON(checkpointVerification{
+					Valid:    true,
+					PeerID:   cp.PeerID.String(),
+					Head:     cp.Head.String(),
+					Length:   cp.Length,
+					SignedAt: time.Unix(cp.Timestamp, 0).UTC(),
+				})
+			}
+			fmt.Printf("checkpoint of %s is valid: head %s, length %d, signed at %s\n",
+				cp.PeerID, cp.Head, cp.Length, time.Unix(cp.Timestamp, 0).UTC().Format(time.RFC3339))
+			return nil
+		},
+	}
+	verifyCmd.Flags().StringVarP(&checkpointPeer, "peer", "p", "", "peer id of the provider the checkpoint must be signed by, any if empty")
+
+	cmd.AddCommand(exportCmd, verifyCmd)
+
+	return cmd
+}
+
+// checkpointVerification is the output of checkpoint verify with --json, invalid checkpoints
+// fail the command.
+type checkpointVerification struct {
+	Valid    bool      `json:"valid"`
+	PeerID   string    `json:"peerId"`
+	Head     string    `json:"head"`
+	Length   int       `json:"length"`
+	SignedAt time.Time `json:"signedAt"`
+}
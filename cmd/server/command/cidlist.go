@@ -4,14 +4,41 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var cidListAnnotations bool
+
 func CidListCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cidlist",
 		Short: "display the cid list of you pushed",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := "/admin/cidlist"
+			if cidListAnnotations {
+				url += "?annotations=true"
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get(url)
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&cidListAnnotations, "annotations", "a", false, "show local annotations of each cid")
+
+	return cmd
+}
+
+func ReindexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "rebuild the cid list of you pushed by walking the local chain from the latest metadata",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			res, err := Client.R().
 				SetHeader("Content-Type", "application/octet-stream").
-				Get("/admin/cidlist")
+				Post("/admin/reindex")
 			if err != nil {
 				return err
 			}
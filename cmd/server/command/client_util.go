@@ -1,16 +1,21 @@
 package command
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/kenlabs/pando/pkg/api/types"
+	"io"
 	"time"
 )
 
 var Client *resty.Client
 var PClientBaseURL string
 
+// JSONOutput makes the commands print their output as single-line JSON documents, see --json.
+var JSONOutput bool
+
 func NewClient(apiBaseURL string) {
 	Client = resty.New().SetBaseURL(apiBaseURL).SetDebug(false).SetTimeout(10 * time.Second)
 }
@@ -21,6 +26,9 @@ func PrintResponseData(res *resty.Response) error {
 	if err != nil {
 		return err
 	}
+	if JSONOutput {
+		return PrintJSON(resJson)
+	}
 	prettyJson, err := json.MarshalIndent(resJson, "", " ")
 	if err != nil {
 		return err
@@ -28,3 +36,23 @@ func PrintResponseData(res *resty.Response) error {
 	fmt.Printf("%s\n", prettyJson)
 	return nil
 }
+
+// PrintJSON prints v as a single-line JSON document.
+func PrintJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", b)
+	return nil
+}
+
+// streamError returns the error of the streamed request answered by res, with the status code and
+// body, the error response of the daemon, so that the command fails.
+func streamError(res *resty.Response, body io.Reader) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("request failed with status %d: %s", res.StatusCode(), bytes.TrimSpace(b))
+}
@@ -18,6 +18,15 @@ type AdminServer struct {
 	ListenMultiaddr string
 	ReadTimeout     Duration
 	WriteTimeout    Duration
+	// DebugListenMultiaddr is the listen address of the debug server serving pprof and runtime
+	// stats. The debug server is disabled if empty, the default.
+	DebugListenMultiaddr string
+	// GatewayListenMultiaddr is the listen address of the read-only gateway serving the local
+	// metadatas and payloads. The gateway is disabled if empty, the default.
+	GatewayListenMultiaddr string
+	// GraphQLListenMultiaddr is the listen address of the read-only GraphQL server querying the
+	// local state. The GraphQL server is disabled if empty, the default.
+	GraphQLListenMultiaddr string
 }
 
 // NewAdminServer instantiates a new AdminServer config with default values.
@@ -30,7 +39,35 @@ func NewAdminServer() AdminServer {
 }
 
 func (as *AdminServer) ListenNetAddr() (string, error) {
-	maddr, err := multiaddr.NewMultiaddr(as.ListenMultiaddr)
+	return toNetAddr(as.ListenMultiaddr)
+}
+
+// DebugListenNetAddr returns the net address of the debug server, empty if it is disabled.
+func (as *AdminServer) DebugListenNetAddr() (string, error) {
+	if as.DebugListenMultiaddr == "" {
+		return "", nil
+	}
+	return toNetAddr(as.DebugListenMultiaddr)
+}
+
+// GatewayListenNetAddr returns the net address of the gateway, empty if it is disabled.
+func (as *AdminServer) GatewayListenNetAddr() (string, error) {
+	if as.GatewayListenMultiaddr == "" {
+		return "", nil
+	}
+	return toNetAddr(as.GatewayListenMultiaddr)
+}
+
+// GraphQLListenNetAddr returns the net address of the GraphQL server, empty if it is disabled.
+func (as *AdminServer) GraphQLListenNetAddr() (string, error) {
+	if as.GraphQLListenMultiaddr == "" {
+		return "", nil
+	}
+	return toNetAddr(as.GraphQLListenMultiaddr)
+}
+
+func toNetAddr(addr string) (string, error) {
+	maddr, err := multiaddr.NewMultiaddr(addr)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,12 @@
+package config
+
+// Alerting configures the alerts sent when pushed metadatas are moved to the dead-letter list or
+// the inclusion checks pile up.
+type Alerting struct {
+	// urls the alerts are posted to as json
+	WebhookURLs []string
+	// incoming webhook urls of the Slack channels the alerts are posted to
+	SlackWebhookURLs []string
+	// alert once more than this number of inclusion checks are pending, 0 to disable
+	BacklogThreshold int
+}
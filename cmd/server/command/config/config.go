@@ -17,7 +17,16 @@ type Config struct {
 	IngestCfg   IngestCfg
 	P2pServer   P2pServer
 	AdminServer AdminServer
+	Retry       Retry
+	Scheduler   Scheduler
+	Alerting    Alerting
+	HeadExport  HeadExport
+	Metrics     Metrics
+	Logging     Logging
 	LogLevel    string
+
+	DataTransfer DataTransfer
+	Gossip       Gossip
 }
 
 const (
@@ -151,6 +160,8 @@ func (c *Config) PopulateDefaults() {
 	c.P2pServer.PopulateDefaults()
 	c.Datastore.PopulateDefaults()
 	c.IngestCfg.PopulateDefaults()
+	c.Logging.PopulateDefaults()
+	c.Gossip.PopulateDefaults()
 }
 
 func (c *Config) Validate() error {
@@ -11,6 +11,11 @@ type Datastore struct {
 	Type string
 	// Dir is the directory within the config root where the datastore is kept
 	Dir string
+	// Namespace prefixes all the keys of the engine, to share the datastore with other engines
+	Namespace string
+	// BlockCacheSize is the number of recently used blocks kept in memory, zero for the default
+	// of 1024, negative to disable the cache
+	BlockCacheSize int
 }
 
 // NewDatastore instantiates a new Datastore config with default values.
@@ -0,0 +1,46 @@
+package config
+
+import "time"
+
+const (
+	defaultDataTransferMaxRestarts = 3
+	defaultDataTransferTimeout     = Duration(time.Minute)
+)
+
+// DataTransfer tunes the graphsync and data-transfer instances syncing the metadatas, the
+// library defaults are kept if the section is left empty.
+type DataTransfer struct {
+	// max graphsync requests in flight, both served and made, 0 for the graphsync default
+	MaxInProgressRequests uint64
+	// restarts in a row of a failed transfer before failing it, 0 for the default of 3
+	MaxRestarts uint32
+	// minimum wait between two restarts of a transfer, 0 for the default of 1m
+	RestartBackoff Duration
+	// restart the transfers not accepted by the other side within this duration, 0 for the
+	// default of 1m
+	AcceptTimeout Duration
+	// restart the transfers not completed within this duration once their data is sent, 0 for
+	// the default of 1m
+	CompleteTimeout Duration
+}
+
+// IsTuned tells whether any value of the section is set.
+func (c DataTransfer) IsTuned() bool {
+	return c != DataTransfer{}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *DataTransfer) PopulateDefaults() {
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = defaultDataTransferMaxRestarts
+	}
+	if c.RestartBackoff == 0 {
+		c.RestartBackoff = defaultDataTransferTimeout
+	}
+	if c.AcceptTimeout == 0 {
+		c.AcceptTimeout = defaultDataTransferTimeout
+	}
+	if c.CompleteTimeout == 0 {
+		c.CompleteTimeout = defaultDataTransferTimeout
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+const (
+	defaultGossipThreshold      = -500
+	defaultPublishThreshold     = -1000
+	defaultGraylistThreshold    = -2500
+	defaultTopicWeight          = 1
+	defaultInvalidMessageWeight = -100
+)
+
+// Gossip protects the mesh of the announcement topics, subscribed to and announced on, from spam
+// announcements.
+type Gossip struct {
+	// score the peers of the announcement topics, pruning and then ignoring the ones forwarding
+	// invalid announcements
+	PeerScoring bool
+	// score below which no gossip is exchanged with a peer, 0 for the default of -500
+	GossipThreshold float64
+	// score below which the announcements are not sent to a peer, 0 for the default of -1000
+	PublishThreshold float64
+	// score below which the messages of a peer are ignored, 0 for the default of -2500
+	GraylistThreshold float64
+	// weight of the announcement topics score, 0 for the default of 1
+	TopicWeight float64
+	// penalty of every invalid announcement forwarded by a peer, squared, 0 for the default
+	// of -100
+	InvalidMessageWeight float64
+	// reject the messages that are not announcements of a cid
+	ValidateAnnouncements bool
+	// peer IDs of the only announcers accepted on the topics, e.g. the mirrored providers, empty
+	// to accept any
+	AllowedAnnouncers []string
+}
+
+// NewGossip instantiates a new Gossip config with default values.
+func NewGossip() Gossip {
+	return Gossip{
+		GossipThreshold:      defaultGossipThreshold,
+		PublishThreshold:     defaultPublishThreshold,
+		GraylistThreshold:    defaultGraylistThreshold,
+		TopicWeight:          defaultTopicWeight,
+		InvalidMessageWeight: defaultInvalidMessageWeight,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *Gossip) PopulateDefaults() {
+	def := NewGossip()
+
+	if c.GossipThreshold == 0 {
+		c.GossipThreshold = def.GossipThreshold
+	}
+	if c.PublishThreshold == 0 {
+		c.PublishThreshold = def.PublishThreshold
+	}
+	if c.GraylistThreshold == 0 {
+		c.GraylistThreshold = def.GraylistThreshold
+	}
+	if c.TopicWeight == 0 {
+		c.TopicWeight = def.TopicWeight
+	}
+	if c.InvalidMessageWeight == 0 {
+		c.InvalidMessageWeight = def.InvalidMessageWeight
+	}
+}
@@ -0,0 +1,12 @@
+package config
+
+// HeadExport configures the hooks the latest head is exported to whenever it changes, e.g. to
+// update the DNSLink TXT record of the provider.
+type HeadExport struct {
+	// urls the head is put to as text, with {cid} replaced with the head
+	HTTPPutURLs []string
+	// shell commands run with the head in the HEAD_CID environment variable
+	Commands []string
+	// timeout of an export, 30s if zero
+	Timeout Duration
+}
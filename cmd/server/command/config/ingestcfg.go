@@ -5,9 +5,20 @@ import "time"
 type PublisherKind string
 
 const (
-	defaultPersistAfterSend               = true
-	DTSyncPublisherKind     PublisherKind = "dtsync"
-	defaultCheckInterval                  = Duration(time.Minute)
+	defaultPersistAfterSend                    = true
+	DTSyncPublisherKind          PublisherKind = "dtsync"
+	HttpPublisherKind            PublisherKind = "http"
+	DualPublisherKind            PublisherKind = "dtsync+http"
+	defaultCheckInterval                       = Duration(time.Minute)
+	defaultHttpListenAddr                      = "0.0.0.0:9023"
+	defaultAnnounceFlushInterval               = Duration(30 * time.Second)
+	defaultMirrorSyncInterval                  = Duration(time.Minute)
+	defaultBridgeSyncInterval                  = Duration(time.Minute)
+	defaultWatchScanInterval                   = Duration(time.Second)
+	defaultInclusionCheckWorkers               = 8
+	defaultInclusionCheckTimeout               = Duration(30 * time.Second)
+	defaultMaxCheckBackoff                     = Duration(time.Hour)
+	defaultInclusionCacheTTL                   = Duration(24 * time.Hour)
 )
 
 // MITR is short for MaxIntervalToRepublish
@@ -24,16 +35,135 @@ type IngestCfg struct {
 	// check whether pushed data is stored in Pando
 	CheckInterval Duration
 
-	// in fact, only datatransfer is used
+	// check up to this number of pushed cids per inclusion query if Pando serves batched queries,
+	// 0 to query them one by one
+	InclusionBatchSize int
+
+	// number of inclusion queries sent concurrently on every check
+	InclusionCheckWorkers int
+
+	// abort the inclusion queries taking longer, the cids are checked again on the next check
+	InclusionCheckTimeout Duration
+
+	// double the interval between the checks of a cid not included yet up to this, 0 to check
+	// every cid on every check
+	MaxCheckBackoff Duration
+
+	// move the cids not included after this number of checks to the dead-letter list, 0 to check
+	// them until they are included
+	MaxCheckAttempts int
+
+	// serve the inclusions confirmed in a snapshot from a local cache for this duration instead
+	// of querying Pando again, 0 to disable
+	InclusionCacheTTL Duration
+
+	// record every publish, announcement and republish in a hash-chained local audit log
+	AuditLog bool
+	// rebuild the latest metadata, the pushed cid list and the check list from the audit log on
+	// start, e.g. after they were lost or corrupted
+	RecoverFromAuditLog bool
+
+	// retry announcements that failed while the network was unreachable
+	AnnounceFlushInterval Duration
+
+	// dtsync, http or dtsync+http to serve both at the same time
 	PublisherKind PublisherKind
+
+	// listen address of the http publisher, used by http and dtsync+http kinds
+	HttpPublisherListenAddr string
+
+	// how to announce metadatas published while announcements were disabled: "" to only warn,
+	// head to announce the latest one or all to announce each of them
+	ReplayUnannounced string
+
+	// answer proof-of-possession challenges of Pando or consumers over libp2p
+	ChallengeHandler bool
+
+	// serve the metadata and payload blocks over bitswap, e.g. to IPFS nodes
+	BitswapServer bool
+
+	// follow the snapshot chain of Pando at this interval, 0 to disable
+	SnapshotFollowInterval Duration
+
+	// sync the chains mirrored with the mirror command at this interval, besides announcements
+	MirrorSyncInterval Duration
+
+	// sync the advertisement chains bridged with the bridge command at this interval
+	BridgeSyncInterval Duration
+
+	// scan the directories watched with the watch command at this interval
+	WatchScanInterval Duration
+
+	// re-announce the latest metadata at this interval, 0 to disable
+	RepublishLatestInterval Duration
+
+	// repair the local chain state on startup if it is inconsistent, instead of only logging it
+	RepairIntegrity bool
+
+	// return the metadata of an already published payload instead of publishing it again
+	Dedupe bool
+
+	// multihash function of the metadata links: sha2-256 (default), sha2-512 or blake3
+	LinkHash string
+
+	// codec of the metadatas: dag-json (default) or dag-cbor
+	LinkCodec string
+
+	// IPLD schemas the payloads pushed with a payload type must match
+	PayloadSchemas []PayloadSchema
+
+	// stop the syncs from Pando fetching more blocks or bytes, 0 for the defaults of 1000000
+	// blocks and 1GiB, -1 for no limit
+	SyncMaxBlocks int
+	SyncMaxBytes  int64
+
+	// reject the published payloads larger than MaxPayloadSize bytes, or chunk the bytes ones if
+	// PayloadSizeEnforcement is chunk, 0 for no limit
+	MaxPayloadSize         int64
+	PayloadSizeEnforcement string
+
+	// reject the publishes over QuotaMaxEntries metadatas or QuotaMaxBytes bytes in the last
+	// QuotaWindow, 24h by default, 0 to only count them
+	QuotaWindow     Duration
+	QuotaMaxEntries int
+	QuotaMaxBytes   int64
+
+	// hold the publishes back once BacklogLimit inclusion checks are pending, waiting up to
+	// BacklogWait for them to fall below it before failing, 0 for no limit
+	BacklogLimit int
+	BacklogWait  Duration
+
+	// compare the head with the one known by Pando every ForkCheckInterval, 0 to disable, and
+	// re-announce it if they diverged when HealForks is set
+	ForkCheckInterval Duration
+	HealForks         bool
+}
+
+// PayloadSchema is the IPLD schema of a payload type.
+type PayloadSchema struct {
+	// payload type, e.g. the --type of the push command
+	PayloadType string
+	// path of the IPLD schema file
+	SchemaFile string
+	// type of the schema payloads must match, PayloadType if empty
+	TypeName string
 }
 
 func NewIngestCfg() IngestCfg {
 	return IngestCfg{
-		PersistAfterSend:       defaultPersistAfterSend,
-		PublisherKind:          DTSyncPublisherKind,
-		CheckInterval:          defaultCheckInterval,
-		MaxIntervalToRepublish: defaultMaxIntervalToRepublish,
+		PersistAfterSend:        defaultPersistAfterSend,
+		PublisherKind:           DTSyncPublisherKind,
+		CheckInterval:           defaultCheckInterval,
+		AnnounceFlushInterval:   defaultAnnounceFlushInterval,
+		MirrorSyncInterval:      defaultMirrorSyncInterval,
+		BridgeSyncInterval:      defaultBridgeSyncInterval,
+		WatchScanInterval:       defaultWatchScanInterval,
+		InclusionCheckWorkers:   defaultInclusionCheckWorkers,
+		InclusionCheckTimeout:   defaultInclusionCheckTimeout,
+		MaxCheckBackoff:         defaultMaxCheckBackoff,
+		InclusionCacheTTL:       defaultInclusionCacheTTL,
+		MaxIntervalToRepublish:  defaultMaxIntervalToRepublish,
+		HttpPublisherListenAddr: defaultHttpListenAddr,
 	}
 }
 
@@ -45,7 +175,28 @@ func (ic *IngestCfg) PopulateDefaults() {
 	if ic.CheckInterval == 0 {
 		ic.CheckInterval = defaultCheckInterval
 	}
+	if ic.AnnounceFlushInterval == 0 {
+		ic.AnnounceFlushInterval = defaultAnnounceFlushInterval
+	}
+	if ic.MirrorSyncInterval == 0 {
+		ic.MirrorSyncInterval = defaultMirrorSyncInterval
+	}
+	if ic.BridgeSyncInterval == 0 {
+		ic.BridgeSyncInterval = defaultBridgeSyncInterval
+	}
+	if ic.WatchScanInterval == 0 {
+		ic.WatchScanInterval = defaultWatchScanInterval
+	}
+	if ic.InclusionCheckWorkers == 0 {
+		ic.InclusionCheckWorkers = defaultInclusionCheckWorkers
+	}
+	if ic.InclusionCheckTimeout == 0 {
+		ic.InclusionCheckTimeout = defaultInclusionCheckTimeout
+	}
 	if ic.PublisherKind == "" {
 		ic.PublisherKind = DTSyncPublisherKind
 	}
+	if ic.HttpPublisherListenAddr == "" {
+		ic.HttpPublisherListenAddr = defaultHttpListenAddr
+	}
 }
@@ -27,8 +27,11 @@ func InitWithIdentity(identity Identity) (*Config, error) {
 		IngestCfg:   NewIngestCfg(),
 		Datastore:   NewDatastore(),
 		AdminServer: NewAdminServer(),
+		Logging:     NewLogging(),
 
 		LogLevel: "info",
+
+		Gossip: NewGossip(),
 	}, nil
 }
 
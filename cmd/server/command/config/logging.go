@@ -0,0 +1,50 @@
+package config
+
+const (
+	defaultLogFormat     = "console"
+	defaultLogMaxSizeMB  = 100
+	defaultLogMaxBackups = 10
+)
+
+// LogRotation configures the rotation of the log file.
+type LogRotation struct {
+	// rotate the log file before it grows over this number of megabytes, 0 to disable
+	MaxSizeMB int
+	// rotate the log file at this interval, e.g. "24h", 0 to disable
+	Interval Duration
+	// number of rotated log files kept, 0 to keep all
+	MaxBackups int
+	// remove the rotated log files older than this, 0 to keep all
+	MaxAge Duration
+}
+
+// Logging configures the logs of the daemon.
+type Logging struct {
+	// default level of all the subsystems, LogLevel is used if empty
+	Level string
+	// console, colorized on terminals, or json for machine-parseable logs
+	Format string
+	// path of the file logs are appended to, stderr if empty
+	File string
+	// rotation of File
+	Rotation LogRotation
+	// levels of the subsystems whose name starts with a key, e.g. {"pandoClient/pkg/engine": "debug"}
+	Subsystems map[string]string
+}
+
+func NewLogging() Logging {
+	return Logging{
+		Format: defaultLogFormat,
+		Rotation: LogRotation{
+			MaxSizeMB:  defaultLogMaxSizeMB,
+			MaxBackups: defaultLogMaxBackups,
+		},
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *Logging) PopulateDefaults() {
+	if c.Format == "" {
+		c.Format = defaultLogFormat
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+// Metrics configures the pushing of the metrics to push-oriented monitoring stacks, in addition
+// to the prometheus endpoint of the admin server.
+type Metrics struct {
+	// host:port of the StatsD server the metrics are pushed to over UDP, disabled if empty
+	StatsDAddr string
+	// host:port of the Graphite server the metrics are pushed to over the plaintext protocol,
+	// disabled if empty
+	GraphiteAddr string
+	// prefix of the pushed metric names
+	Prefix string
+	// interval the metrics are pushed at, 15s if zero
+	PushInterval Duration
+}
@@ -46,6 +46,15 @@ type PandoInfo struct {
 	PandoPeerID    string
 	PandoAPIUrl    string
 	TopicName      string
+	// PandoAnnounceUrl is the HTTP announce endpoint of Pando new metadatas are also announced
+	// to, besides gossipsub. Empty to only announce over gossipsub.
+	PandoAnnounceUrl string
+	// KeepConnected protects the connection to Pando and re-dials it with backoff when it drops
+	KeepConnected bool
+	// RedialBackoff and MaxRedialBackoff bound the wait between failed dials of Pando, 0 for
+	// the defaults of 1s and 5m
+	RedialBackoff    Duration
+	MaxRedialBackoff Duration
 }
 
 func (pinfo *PandoInfo) AddrInfo() (*peer.AddrInfo, error) {
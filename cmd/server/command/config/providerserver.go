@@ -6,6 +6,30 @@ type P2pServer struct {
 	// RetrievalMultiaddrs are the addresses to advertise for data retrieval.
 	// Defaults to the provider's libp2p host listen addresses.
 	RetrievalMultiaddrs []string
+	// QUICListenMultiaddrs are the extra QUIC listen addresses, e.g. /ip4/0.0.0.0/udp/9020/quic
+	QUICListenMultiaddrs []string
+	// WebSocketListenMultiaddrs are the extra WebSocket listen addresses, e.g.
+	// /ip4/0.0.0.0/tcp/9021/ws
+	WebSocketListenMultiaddrs []string
+	// WebTransportListenMultiaddrs are the extra WebTransport listen addresses, not supported
+	// yet by the libp2p version of the daemon
+	WebTransportListenMultiaddrs []string
+	// NATPortMap maps the listen ports on the NAT router with UPnP or NAT-PMP
+	NATPortMap bool
+	// AutoNATService helps peers determine their reachability by dialing them back
+	AutoNATService bool
+	// Reachability overrides the reachability detected by AutoNAT: public or private, empty
+	// to detect it
+	Reachability string
+	// HolePunching upgrades the relayed connections to direct ones
+	HolePunching bool
+	// RelayService runs a circuit-relay-v2 service once the node is publicly reachable
+	RelayService bool
+	// StaticRelays are the circuit-relay-v2 relays used behind NAT, with their /p2p/ component
+	StaticRelays []string
+	// AddrBookTTL is how long the learned addresses of Pando, the relays and the mirrored
+	// providers are persisted across restarts, zero for the default of 24h
+	AddrBookTTL Duration
 }
 
 // NewP2pServer instantiates a new P2pServer config with default values.
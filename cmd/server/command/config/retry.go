@@ -0,0 +1,58 @@
+package config
+
+import (
+	"pandoClient/pkg/retry"
+	"time"
+)
+
+// RetryPolicy configures the retries of a component; zero fields keep the default of the
+// component.
+type RetryPolicy struct {
+	// number of calls including the first one
+	MaxAttempts int
+	// wait before the second attempt, multiplied by Multiplier after each attempt up to MaxBackoff
+	InitialBackoff Duration
+	MaxBackoff     Duration
+	Multiplier     float64
+	// randomize each wait by up to this fraction of it
+	Jitter float64
+	// consecutive failures that stop calling the component for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  Duration
+}
+
+// Retry configures the retry policies of the components calling remote peers.
+type Retry struct {
+	// requests to the Pando API
+	PandoAPI RetryPolicy
+	// announcements of published metadatas, including the flushes of the announce queue
+	Announce RetryPolicy
+	// syncs with Pando and followed providers
+	Sync RetryPolicy
+}
+
+// Apply returns defaults overridden by the non-zero fields of p.
+func (p RetryPolicy) Apply(defaults retry.Policy) retry.Policy {
+	if p.MaxAttempts != 0 {
+		defaults.MaxAttempts = p.MaxAttempts
+	}
+	if p.InitialBackoff != 0 {
+		defaults.InitialBackoff = time.Duration(p.InitialBackoff)
+	}
+	if p.MaxBackoff != 0 {
+		defaults.MaxBackoff = time.Duration(p.MaxBackoff)
+	}
+	if p.Multiplier != 0 {
+		defaults.Multiplier = p.Multiplier
+	}
+	if p.Jitter != 0 {
+		defaults.Jitter = p.Jitter
+	}
+	if p.BreakerThreshold != 0 {
+		defaults.BreakerThreshold = p.BreakerThreshold
+	}
+	if p.BreakerCooldown != 0 {
+		defaults.BreakerCooldown = time.Duration(p.BreakerCooldown)
+	}
+	return defaults
+}
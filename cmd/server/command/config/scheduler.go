@@ -0,0 +1,22 @@
+package config
+
+// PublishJob configures a job publishing the output of a command or the contents of a file on a
+// cron schedule.
+type PublishJob struct {
+	// unique name of the job, the metadatas it publishes are annotated with it
+	Name string
+	// cron expression such as "0 * * * *", or descriptor such as "@hourly" or "@every 30m"
+	Schedule string
+	// shell command whose standard output is published, exclusive with File
+	Command string
+	// path of the file whose contents are published
+	File string
+	// abort the command after this duration, 1m if unset
+	Timeout Duration
+}
+
+// Scheduler configures the publish jobs run by the daemon, in addition to the ones added with
+// the schedule command.
+type Scheduler struct {
+	Jobs []PublishJob
+}
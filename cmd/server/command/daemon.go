@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/filecoin-project/go-data-transfer/channelmonitor"
 	datatransfer "github.com/filecoin-project/go-data-transfer/impl"
 	dtnetwork "github.com/filecoin-project/go-data-transfer/network"
 	gstransport "github.com/filecoin-project/go-data-transfer/transport/graphsync"
@@ -11,14 +12,16 @@ import (
 	gsimpl "github.com/ipfs/go-graphsync/impl"
 	gsnet "github.com/ipfs/go-graphsync/network"
 	"github.com/ipfs/go-ipfs/core/bootstrap"
-	logging "github.com/ipfs/go-log/v2"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/spf13/cobra"
 	"os"
 	"pandoClient/cmd/server/command/config"
+	"pandoClient/pkg/alert"
 	"pandoClient/pkg/engine"
+	"pandoClient/pkg/headexport"
+	"pandoClient/pkg/metrics"
 	adminserver "pandoClient/pkg/server/admin/http"
 	"pandoClient/pkg/util/log"
 	"time"
@@ -49,7 +52,24 @@ func DaemonCmd() *cobra.Command {
 				return fmt.Errorf("cannot load config file: %w", err)
 			}
 
-			_ = logging.SetLogLevel("*", "debug")
+			logCfg := log.Config{
+				Level:  cfg.Logging.Level,
+				Format: cfg.Logging.Format,
+				File:   cfg.Logging.File,
+				Rotation: log.Rotation{
+					MaxSize:    int64(cfg.Logging.Rotation.MaxSizeMB) << 20,
+					Interval:   time.Duration(cfg.Logging.Rotation.Interval),
+					MaxBackups: cfg.Logging.Rotation.MaxBackups,
+					MaxAge:     time.Duration(cfg.Logging.Rotation.MaxAge),
+				},
+				Subsystems: cfg.Logging.Subsystems,
+			}
+			if logCfg.Level == "" {
+				logCfg.Level = cfg.LogLevel
+			}
+			if err = log.Setup(logCfg); err != nil {
+				return fmt.Errorf("cannot setup logging: %w", err)
+			}
 
 			ctx, cancelp2p := context.WithCancel(cmd.Context())
 			defer cancelp2p()
@@ -63,16 +83,42 @@ func DaemonCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("bad p2p address in config %s: %s", cfg.P2pServer.ListenMultiaddr, err)
 			}
-			h, err := libp2p.New(
+			listenAddrs := []multiaddr.Multiaddr{p2pmaddr}
+			for t, addrs := range map[engine.Transport][]string{
+				engine.TransportQUIC:         cfg.P2pServer.QUICListenMultiaddrs,
+				engine.TransportWebSocket:    cfg.P2pServer.WebSocketListenMultiaddrs,
+				engine.TransportWebTransport: cfg.P2pServer.WebTransportListenMultiaddrs,
+			} {
+				if len(addrs) == 0 {
+					continue
+				}
+				maddrs, err := engine.ParseListenAddrs(t, addrs...)
+				if err != nil {
+					return fmt.Errorf("bad p2p address in config: %w", err)
+				}
+				listenAddrs = append(listenAddrs, maddrs...)
+			}
+			natOpts, err := engine.HostOptions(
+				engine.WithNATPortMap(cfg.P2pServer.NATPortMap),
+				engine.WithAutoNATService(cfg.P2pServer.AutoNATService),
+				engine.WithReachability(engine.Reachability(cfg.P2pServer.Reachability)),
+				engine.WithHolePunching(cfg.P2pServer.HolePunching),
+				engine.WithRelayService(cfg.P2pServer.RelayService),
+				engine.WithStaticRelays(cfg.P2pServer.StaticRelays...),
+			)
+			if err != nil {
+				return fmt.Errorf("bad p2p nat traversal config: %w", err)
+			}
+			h, err := libp2p.New(append([]libp2p.Option{
 				// Use the keypair generated during init
 				libp2p.Identity(privKey),
-				//Listen to p2p addr specified in config
-				libp2p.ListenAddrs(p2pmaddr),
-			)
+				//Listen to p2p addrs specified in config
+				libp2p.ListenAddrs(listenAddrs...),
+			}, natOpts...)...)
 			if err != nil {
 				return err
 			}
-			logger.Infow("libp2p host initialized", "host_id", h.ID(), "multiaddr", p2pmaddr)
+			logger.Infow("libp2p host initialized", "host_id", h.ID(), "multiaddrs", listenAddrs)
 
 			// Initialize datastore
 			if cfg.Datastore.Type != "levelds" {
@@ -93,9 +139,26 @@ func DaemonCmd() *cobra.Command {
 
 			gsnet := gsnet.NewFromLibp2pHost(h)
 			dtNet := dtnetwork.NewFromLibp2pHost(h)
-			gs := gsimpl.New(context.Background(), gsnet, cidlink.DefaultLinkSystem())
+			// the section is left empty unless tuned, so that the library defaults are kept.
+			dtCfg := cfg.DataTransfer
+			var gsOpts []gsimpl.Option
+			var dtOpts []datatransfer.DataTransferOption
+			if dtCfg.IsTuned() {
+				dtCfg.PopulateDefaults()
+				if n := dtCfg.MaxInProgressRequests; n != 0 {
+					gsOpts = append(gsOpts, gsimpl.MaxInProgressIncomingRequests(n), gsimpl.MaxInProgressOutgoingRequests(n))
+				}
+				dtOpts = append(dtOpts, datatransfer.ChannelRestartConfig(channelmonitor.Config{
+					AcceptTimeout:          time.Duration(dtCfg.AcceptTimeout),
+					CompleteTimeout:        time.Duration(dtCfg.CompleteTimeout),
+					RestartDebounce:        10 * time.Second,
+					RestartBackoff:         time.Duration(dtCfg.RestartBackoff),
+					MaxConsecutiveRestarts: dtCfg.MaxRestarts,
+				}))
+			}
+			gs := gsimpl.New(context.Background(), gsnet, cidlink.DefaultLinkSystem(), gsOpts...)
 			tp := gstransport.NewTransport(h.ID(), gs)
-			dt, err := datatransfer.NewDataTransfer(ds, dtNet, tp)
+			dt, err := datatransfer.NewDataTransfer(ds, dtNet, tp, dtOpts...)
 			if err != nil {
 				return err
 			}
@@ -109,18 +172,103 @@ func DaemonCmd() *cobra.Command {
 				logger.Errorf("wrong pando addr, %s", pandoAddrInfo.String())
 			}
 
-			eng, err := engine.New(
+			engineOpts := []engine.Option{
 				engine.WithPersistAfterSend(cfg.IngestCfg.PersistAfterSend),
 				engine.WithMaxIntervalToRepublish(cfg.IngestCfg.MaxIntervalToRepublish),
 				engine.WithCheckInterval(cfg.IngestCfg.CheckInterval),
+				engine.WithInclusionBatchSize(cfg.IngestCfg.InclusionBatchSize),
+				engine.WithInclusionCheckWorkers(cfg.IngestCfg.InclusionCheckWorkers),
+				engine.WithInclusionCheckTimeout(cfg.IngestCfg.InclusionCheckTimeout),
+				engine.WithMaxCheckBackoff(cfg.IngestCfg.MaxCheckBackoff),
+				engine.WithMaxCheckAttempts(cfg.IngestCfg.MaxCheckAttempts),
+				engine.WithInclusionCacheTTL(cfg.IngestCfg.InclusionCacheTTL),
+				engine.WithAuditLog(cfg.IngestCfg.AuditLog),
+				engine.WithAuditLogRecovery(cfg.IngestCfg.RecoverFromAuditLog),
+				engine.WithAnnounceFlushInterval(cfg.IngestCfg.AnnounceFlushInterval),
 				engine.WithPandoAPIClient(cfg.PandoInfo.PandoAPIUrl, time.Second*10),
+				engine.WithHttpAnnounceURL(cfg.PandoInfo.PandoAnnounceUrl, time.Second*10),
 				engine.WithPandoAddrinfo(*pandoAddrInfo),
+				engine.WithPandoConnectivity(cfg.PandoInfo.KeepConnected),
+				engine.WithPandoRedialBackoff(cfg.PandoInfo.RedialBackoff, cfg.PandoInfo.MaxRedialBackoff),
 				engine.WithDatastore(ds),
+				engine.WithDatastoreNamespace(cfg.Datastore.Namespace),
+				engine.WithBlockCacheSize(cfg.Datastore.BlockCacheSize),
 				engine.WithDataTransfer(dt),
 				engine.WithHost(h),
+				engine.WithAddrBookTTL(cfg.P2pServer.AddrBookTTL),
 				engine.WithTopicName(cfg.PandoInfo.TopicName),
 				engine.WithPublisherKind(engine.PublisherKind(cfg.IngestCfg.PublisherKind)),
-			)
+				engine.WithHttpPublisherListenAddr(cfg.IngestCfg.HttpPublisherListenAddr),
+				engine.WithReplayUnannounced(engine.ReplayMode(cfg.IngestCfg.ReplayUnannounced)),
+				engine.WithChallengeHandler(cfg.IngestCfg.ChallengeHandler),
+				engine.WithBitswapServer(cfg.IngestCfg.BitswapServer),
+				engine.WithSnapshotFollowInterval(cfg.IngestCfg.SnapshotFollowInterval),
+				engine.WithMirrorSyncInterval(cfg.IngestCfg.MirrorSyncInterval),
+				engine.WithBridgeSyncInterval(cfg.IngestCfg.BridgeSyncInterval),
+				engine.WithWatchScanInterval(cfg.IngestCfg.WatchScanInterval),
+				engine.WithRepublishLatestInterval(cfg.IngestCfg.RepublishLatestInterval),
+				engine.WithIntegrityRepair(cfg.IngestCfg.RepairIntegrity),
+				engine.WithDedupe(cfg.IngestCfg.Dedupe),
+				engine.WithSyncLimits(cfg.IngestCfg.SyncMaxBlocks, cfg.IngestCfg.SyncMaxBytes),
+				engine.WithPublishQuota(cfg.IngestCfg.QuotaWindow, cfg.IngestCfg.QuotaMaxEntries, cfg.IngestCfg.QuotaMaxBytes),
+				engine.WithBacklogLimit(cfg.IngestCfg.BacklogLimit, cfg.IngestCfg.BacklogWait),
+				engine.WithForkDetection(cfg.IngestCfg.ForkCheckInterval, cfg.IngestCfg.HealForks),
+				engine.WithMaxPayloadSize(cfg.IngestCfg.MaxPayloadSize, engine.PayloadSizeEnforcement(cfg.IngestCfg.PayloadSizeEnforcement)),
+				engine.WithLinkHash(engine.LinkHash(cfg.IngestCfg.LinkHash)),
+				engine.WithLinkCodec(engine.LinkCodec(cfg.IngestCfg.LinkCodec)),
+				engine.WithRetryPolicy(engine.RetryPandoAPI, cfg.Retry.PandoAPI.Apply(engine.DefaultRetryPolicy(engine.RetryPandoAPI))),
+				engine.WithRetryPolicy(engine.RetryAnnounce, cfg.Retry.Announce.Apply(engine.DefaultRetryPolicy(engine.RetryAnnounce))),
+				engine.WithRetryPolicy(engine.RetrySync, cfg.Retry.Sync.Apply(engine.DefaultRetryPolicy(engine.RetrySync))),
+			}
+			if dtCfg.IsTuned() {
+				// the daemon data-transfer serves the publisher, the subscriber gets its own.
+				engineOpts = append(engineOpts,
+					engine.WithGraphsyncMaxInProgressRequests(dtCfg.MaxInProgressRequests),
+					engine.WithDataTransferRestartPolicy(dtCfg.MaxRestarts, dtCfg.RestartBackoff),
+					engine.WithDataTransferTimeouts(dtCfg.AcceptTimeout, dtCfg.CompleteTimeout))
+			}
+			if gossipCfg := cfg.Gossip; gossipCfg.PeerScoring {
+				engineOpts = append(engineOpts, engine.WithGossipScoring(engine.GossipScoring{
+					GossipThreshold:      gossipCfg.GossipThreshold,
+					PublishThreshold:     gossipCfg.PublishThreshold,
+					GraylistThreshold:    gossipCfg.GraylistThreshold,
+					TopicWeight:          gossipCfg.TopicWeight,
+					InvalidMessageWeight: gossipCfg.InvalidMessageWeight,
+				}))
+			}
+			engineOpts = append(engineOpts,
+				engine.WithAnnounceValidation(cfg.Gossip.ValidateAnnouncements),
+				engine.WithAllowedAnnouncers(cfg.Gossip.AllowedAnnouncers...))
+			engineOpts = append(engineOpts, engine.WithBacklogAlertThreshold(cfg.Alerting.BacklogThreshold))
+			for _, url := range cfg.Alerting.WebhookURLs {
+				engineOpts = append(engineOpts, engine.WithAlerter(alert.NewWebhook(url)))
+			}
+			for _, url := range cfg.Alerting.SlackWebhookURLs {
+				engineOpts = append(engineOpts, engine.WithAlerter(alert.NewSlack(url)))
+			}
+			for _, url := range cfg.HeadExport.HTTPPutURLs {
+				engineOpts = append(engineOpts, engine.WithHeadExporter(headexport.NewHTTPPut(url, time.Duration(cfg.HeadExport.Timeout))))
+			}
+			for _, command := range cfg.HeadExport.Commands {
+				engineOpts = append(engineOpts, engine.WithHeadExporter(headexport.NewCommand(command, time.Duration(cfg.HeadExport.Timeout))))
+			}
+			for _, job := range cfg.Scheduler.Jobs {
+				engineOpts = append(engineOpts, engine.WithPublishJob(engine.JobSpec{
+					Name:     job.Name,
+					Schedule: job.Schedule,
+					Command:  job.Command,
+					File:     job.File,
+					Timeout:  time.Duration(job.Timeout),
+				}))
+			}
+			for _, ps := range cfg.IngestCfg.PayloadSchemas {
+				dsl, err := os.ReadFile(ps.SchemaFile)
+				if err != nil {
+					return fmt.Errorf("failed to read schema of payload type %s: %w", ps.PayloadType, err)
+				}
+				engineOpts = append(engineOpts, engine.WithPayloadSchema(ps.PayloadType, dsl, ps.TypeName))
+			}
+			eng, err := engine.New(engineOpts...)
 			if err != nil {
 				return err
 			}
@@ -153,6 +301,86 @@ func DaemonCmd() *cobra.Command {
 				errChan <- adminServer.Start()
 			}()
 
+			debugAddr, err := cfg.AdminServer.DebugListenNetAddr()
+			if err != nil {
+				return err
+			}
+			var debugServer *adminserver.Server
+			if debugAddr != "" {
+				debugServer, err = adminserver.NewDebug(
+					adminserver.WithListenAddr(debugAddr),
+					adminserver.WithReadTimeout(time.Duration(cfg.AdminServer.ReadTimeout)),
+					// profiles and traces are written for the requested duration.
+					adminserver.WithWriteTimeout(0),
+				)
+				if err != nil {
+					return err
+				}
+				logger.Infow("debug server initialized", "address", cfg.AdminServer.DebugListenMultiaddr)
+				go func() {
+					errChan <- debugServer.Start()
+				}()
+			}
+
+			gatewayAddr, err := cfg.AdminServer.GatewayListenNetAddr()
+			if err != nil {
+				return err
+			}
+			var gatewayServer *adminserver.Server
+			if gatewayAddr != "" {
+				gatewayServer, err = adminserver.NewGateway(eng,
+					adminserver.WithListenAddr(gatewayAddr),
+					adminserver.WithReadTimeout(time.Duration(cfg.AdminServer.ReadTimeout)),
+					adminserver.WithWriteTimeout(time.Duration(cfg.AdminServer.WriteTimeout)),
+				)
+				if err != nil {
+					return err
+				}
+				logger.Infow("gateway initialized", "address", cfg.AdminServer.GatewayListenMultiaddr)
+				go func() {
+					errChan <- gatewayServer.Start()
+				}()
+			}
+
+			graphqlAddr, err := cfg.AdminServer.GraphQLListenNetAddr()
+			if err != nil {
+				return err
+			}
+			var graphqlServer *adminserver.Server
+			if graphqlAddr != "" {
+				graphqlServer, err = adminserver.NewGraphQL(eng,
+					adminserver.WithListenAddr(graphqlAddr),
+					adminserver.WithReadTimeout(time.Duration(cfg.AdminServer.ReadTimeout)),
+					adminserver.WithWriteTimeout(time.Duration(cfg.AdminServer.WriteTimeout)),
+				)
+				if err != nil {
+					return err
+				}
+				logger.Infow("graphql server initialized", "address", cfg.AdminServer.GraphQLListenMultiaddr)
+				go func() {
+					errChan <- graphqlServer.Start()
+				}()
+			}
+
+			var pushers []metrics.Pusher
+			if addr := cfg.Metrics.StatsDAddr; addr != "" {
+				pusher, err := metrics.NewStatsD(addr, cfg.Metrics.Prefix, time.Duration(cfg.Metrics.PushInterval))
+				if err != nil {
+					return err
+				}
+				pushers = append(pushers, pusher)
+			}
+			if addr := cfg.Metrics.GraphiteAddr; addr != "" {
+				pusher, err := metrics.NewGraphite(addr, cfg.Metrics.Prefix, time.Duration(cfg.Metrics.PushInterval))
+				if err != nil {
+					return err
+				}
+				pushers = append(pushers, pusher)
+			}
+			for _, pusher := range pushers {
+				go pusher.Run(ctx)
+			}
+
 			// If there are bootstrap peers and bootstrapping is enabled, then try to
 			// connect to the minimum set of peers.
 			if cfg.Bootstrap.MinimumPeers != 0 {
@@ -221,6 +449,24 @@ func DaemonCmd() *cobra.Command {
 				logger.Errorw("Error shutting down admin server: %s", err)
 				finalErr = ErrDaemonStop
 			}
+			if debugServer != nil {
+				if err = debugServer.Shutdown(shutdownCtx); err != nil {
+					logger.Errorw("Error shutting down debug server", "err", err)
+					finalErr = ErrDaemonStop
+				}
+			}
+			if gatewayServer != nil {
+				if err = gatewayServer.Shutdown(shutdownCtx); err != nil {
+					logger.Errorw("Error shutting down gateway", "err", err)
+					finalErr = ErrDaemonStop
+				}
+			}
+			if graphqlServer != nil {
+				if err = graphqlServer.Shutdown(shutdownCtx); err != nil {
+					logger.Errorw("Error shutting down graphql server", "err", err)
+					finalErr = ErrDaemonStop
+				}
+			}
 			logger.Infow("node stopped")
 			return finalErr
 		},
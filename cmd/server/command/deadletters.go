@@ -0,0 +1,64 @@
+package command
+
+import (
+	"encoding/json"
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+)
+
+func DeadLettersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deadletters",
+		Short: "list, retry or drop the pushed cids Pando did not include after the maximum check attempts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/deadletters")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	retryCmd := &cobra.Command{
+		Use:   "retry <cid>",
+		Short: "republish a dead-lettered cid and check its inclusion again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return postDeadLetter("/admin/deadletters/retry", args[0])
+		},
+	}
+	dropCmd := &cobra.Command{
+		Use:   "drop <cid>",
+		Short: "remove a cid from the dead-letter list without retrying it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return postDeadLetter("/admin/deadletters/drop", args[0])
+		},
+	}
+	cmd.AddCommand(retryCmd, dropCmd)
+
+	return cmd
+}
+
+func postDeadLetter(path string, c string) error {
+	if _, err := cid.Decode(c); err != nil {
+		return err
+	}
+	bodyBytes, err := json.Marshal(adminserver.DeadLetterReq{Cid: c})
+	if err != nil {
+		return err
+	}
+	res, err := Client.R().
+		SetBody(bodyBytes).
+		SetHeader("Content-Type", "application/octet-stream").
+		Post(path)
+	if err != nil {
+		return err
+	}
+
+	return PrintResponseData(res)
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+)
+
+var freezeReq = adminserver.FreezeReq{}
+
+func FreezeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "reject all new publishes until unfreeze, e.g. for incident response or legal holds",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if freezeReq.Reason == "" {
+				return fmt.Errorf("nil freeze reason")
+			}
+			bodyBytes, err := json.Marshal(freezeReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/freeze")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&freezeReq.Reason, "reason", "r", "", "reason of the freeze, required")
+
+	return cmd
+}
+
+func UnfreezeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unfreeze",
+		Short: "resume publishing after freeze",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/unfreeze")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/spf13/cobra"
+	"strconv"
+)
+
+var (
+	headPeer     string
+	headAncestor string
+	headDepth    int
+	headHttpSync string
+)
+
+func HeadCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "head",
+		Short: "show the local or a provider's latest metadata and optionally verify one of its ancestors",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := map[string]string{}
+			if headPeer != "" {
+				if _, err := peer.Decode(headPeer); err != nil {
+					return err
+				}
+				query["peer"] = headPeer
+			}
+			if headAncestor != "" {
+				if _, err := cid.Decode(headAncestor); err != nil {
+					return err
+				}
+				query["ancestor"] = headAncestor
+				query["depth"] = strconv.Itoa(headDepth)
+			}
+			path := "/admin/head"
+			if headHttpSync != "" {
+				if headAncestor != "" {
+					return fmt.Errorf("--httpsync can not be used with --verify-ancestor")
+				}
+				if _, err := multiaddr.NewMultiaddr(headHttpSync); err != nil {
+					return err
+				}
+				query["addr"] = headHttpSync
+				path = "/admin/head/signed"
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				SetQueryParams(query).
+				Get(path)
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&headPeer, "peer", "p", "", "peer id of the provider whose head is known by Pando, the local head if empty")
+	cmd.Flags().StringVarP(&headAncestor, "verify-ancestor", "a", "", "cid to verify as an ancestor of the head")
+	cmd.Flags().IntVarP(&headDepth, "depth", "d", 1000, "max number of metadatas walked back from the head to verify the ancestor")
+	cmd.Flags().StringVarP(&headHttpSync, "httpsync", "", "",
+		"multiaddr of an httpsync publisher to fetch and verify the signed head of, signed by --peer if set")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "fork",
+		Short: "compare the local head with the one known by Pando and tell whether they diverged",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/head/fork")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"net/url"
+	"time"
+)
+
+var (
+	historyFrom  string
+	historyTo    string
+	historySince time.Duration
+)
+
+func HistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "show the publishes with their payload size, announce status and inclusion time",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			if historySince != 0 {
+				if historyFrom != "" {
+					return fmt.Errorf("--since and --from are exclusive")
+				}
+				historyFrom = time.Now().Add(-historySince).Format(time.RFC3339)
+			}
+			for name, v := range map[string]string{"from": historyFrom, "to": historyTo} {
+				if v == "" {
+					continue
+				}
+				if _, err := time.Parse(time.RFC3339, v); err != nil {
+					return fmt.Errorf("invalid --%s time, expected RFC3339 such as 2006-01-02T15:04:05Z: %w", name, err)
+				}
+				query.Set(name, v)
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				SetQueryParamsFromValues(query).
+				Get("/admin/history")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&historyFrom, "from", "", "", "show the publishes from this RFC3339 time")
+	cmd.Flags().StringVarP(&historyTo, "to", "", "", "show the publishes before this RFC3339 time")
+	cmd.Flags().DurationVarP(&historySince, "since", "s", 0, "show the publishes of the last duration, e.g. 24h")
+
+	return cmd
+}
@@ -0,0 +1,39 @@
+package command
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+var importReplace bool
+
+func ImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <car>",
+		Short: "adopt the chain of another instance using the same key, from a CARv1 archive rooted at its head, as the local history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open archive: %w", err)
+			}
+			defer f.Close()
+			res, err := Client.R().
+				SetBody(f).
+				SetHeader("Content-Type", "application/octet-stream").
+				SetQueryParam("replace", strconv.FormatBool(importReplace)).
+				Post("/admin/import")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&importReplace, "replace", "", false, "drop the local metadatas the imported chain does not extend")
+
+	return cmd
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+)
+
+var inclusionVerify bool
+
+func InclusionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inclusion <cid>",
+		Short: "show the inclusion record of a cid in Pando: in-Pando status, snapshot and transaction",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := cid.Decode(args[0]); err != nil {
+				return err
+			}
+			path := "/admin/inclusion/" + args[0] + "/record"
+			if inclusionVerify {
+				path = "/admin/inclusion/" + args[0]
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get(path)
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&inclusionVerify, "verify", "", false, "verify the inclusion of a pushed cid against its metadata and snapshot, failing if it is not included")
+
+	return cmd
+}
@@ -0,0 +1,36 @@
+package command
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func LabelCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "label <key>[=<value>]",
+		Short: "list the cids published with a label, or with any value of the key if no value is given",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, value := args[0], ""
+			if i := strings.Index(args[0], "="); i >= 0 {
+				key, value = args[0][:i], args[0][i+1:]
+			}
+			if key == "" {
+				return fmt.Errorf("label key can not be empty")
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				SetQueryParam("key", key).
+				SetQueryParam("value", value).
+				Get("/admin/labels")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
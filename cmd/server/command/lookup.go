@@ -0,0 +1,39 @@
+package command
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+func LookupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lookup [file]",
+		Short: "print the cid of the latest metadata publishing the bytes of a file, or of stdin if no file or - is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if len(args) == 0 || args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read payload: %w", err)
+			}
+			res, err := Client.R().
+				SetBody(data).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/lookup")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+)
+
+var (
+	mirrorReq   = adminserver.MirrorReq{}
+	unmirrorReq = adminserver.UnmirrorReq{}
+	listMirrors bool
+)
+
+func MirrorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mirror",
+		Short: "continuously replicate the metadata chain of a provider and optionally re-serve it over http",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listMirrors {
+				res, err := Client.R().Get("/admin/mirrors")
+				if err != nil {
+					return err
+				}
+				return PrintResponseData(res)
+			}
+			if mirrorReq.Provider == "" {
+				return fmt.Errorf("nil provider to mirror")
+			}
+			bodyBytes, err := json.Marshal(mirrorReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/mirror")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&mirrorReq.Provider, "provider", "p", "", "peer id of the provider to mirror")
+	cmd.Flags().StringVarP(&mirrorReq.Addr, "addr", "a", "", "multiaddr to sync the chain of the provider from")
+	cmd.Flags().StringVarP(&mirrorReq.ServeAddr, "serve", "s", "", "listen address to re-serve the mirrored chain on over http, e.g. 0.0.0.0:9024")
+	cmd.Flags().BoolVarP(&listMirrors, "list", "l", false, "list the running mirrors")
+
+	return cmd
+}
+
+func UnmirrorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unmirror",
+		Short: "stop mirroring the chain of a provider, the mirrored metadatas are kept",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if unmirrorReq.Provider == "" {
+				return fmt.Errorf("nil provider to unmirror")
+			}
+			bodyBytes, err := json.Marshal(unmirrorReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/unmirror")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&unmirrorReq.Provider, "provider", "p", "", "peer id of the mirrored provider")
+
+	return cmd
+}
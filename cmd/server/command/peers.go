@@ -0,0 +1,69 @@
+package command
+
+import (
+	"encoding/json"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+)
+
+func PeersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peers",
+		Short: "list, add or remove the peer addresses persisted across restarts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/peers")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	var ttl string
+	addCmd := &cobra.Command{
+		Use:   "add <multiaddr>",
+		Short: "add the address of a peer, with its /p2p/ component",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := peer.AddrInfoFromString(args[0]); err != nil {
+				return err
+			}
+			return postPeers("/admin/peers/add", adminserver.AddPeerReq{Addr: args[0], TTL: ttl})
+		},
+	}
+	addCmd.Flags().StringVar(&ttl, "ttl", "", "how long the address is kept, e.g. 24h, empty to keep it permanently")
+	removeCmd := &cobra.Command{
+		Use:   "remove <peer>",
+		Short: "remove the persisted addresses of a peer",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := peer.Decode(args[0]); err != nil {
+				return err
+			}
+			return postPeers("/admin/peers/remove", adminserver.RemovePeerReq{Peer: args[0]})
+		},
+	}
+	cmd.AddCommand(addCmd, removeCmd)
+
+	return cmd
+}
+
+func postPeers(path string, req interface{}) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	res, err := Client.R().
+		SetBody(bodyBytes).
+		SetHeader("Content-Type", "application/octet-stream").
+		Post(path)
+	if err != nil {
+		return err
+	}
+
+	return PrintResponseData(res)
+}
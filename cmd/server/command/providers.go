@@ -0,0 +1,32 @@
+package command
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var providerPeerID string
+
+func ProvidersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "providers",
+		Short: "list the providers registered in Pando, or show one of them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/admin/providers"
+			if providerPeerID != "" {
+				path += "/" + providerPeerID
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get(path)
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&providerPeerID, "peerid", "p", "", "peer id of the provider to show")
+
+	return cmd
+}
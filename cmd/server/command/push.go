@@ -0,0 +1,149 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	pushContentType string
+	pushCodec       string
+	pushType        string
+	pushForce       bool
+	pushAsync       bool
+	pushWait        bool
+	pushTimeout     time.Duration
+	pushLabels      []string
+)
+
+// pushPollInterval is the interval between inclusion queries of push --wait.
+const pushPollInterval = 5 * time.Second
+
+func PushCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push [file]",
+		Short: "publish the bytes of a file, or of stdin if no file or - is given, and print the cid",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if len(args) == 0 || args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read payload: %w", err)
+			}
+
+			query := url.Values{}
+			if pushContentType != "" {
+				query.Set("content_type", pushContentType)
+			}
+			if pushCodec != "" {
+				query.Set("codec", pushCodec)
+			}
+			if pushType != "" {
+				query.Set("type", pushType)
+			}
+			if pushForce {
+				query.Set("force", "true")
+			}
+			if pushAsync {
+				query.Set("async", "true")
+			}
+			for _, l := range pushLabels {
+				query.Add("label", l)
+			}
+			res, err := Client.R().
+				SetBody(data).
+				SetHeader("Content-Type", "application/octet-stream").
+				SetQueryParamsFromValues(query).
+				Post("/admin/push")
+			if err != nil {
+				return err
+			}
+			if !res.IsSuccess() {
+				return PrintResponseData(res)
+			}
+			var resJson struct {
+				Data struct {
+					Cid cid.Cid `json:"cid"`
+				}
+			}
+			if err = json.Unmarshal(res.Body(), &resJson); err != nil {
+				return err
+			}
+			c := resJson.Data.Cid
+			if !JSONOutput {
+				fmt.Println(c.String())
+			}
+
+			out := pushOutput{Cid: c.String()}
+			if pushWait {
+				included, err := waitInclusion(c, pushTimeout)
+				if err != nil || !included {
+					return err
+				}
+				out.Included = true
+			}
+			if JSONOutput {
+				return PrintJSON(out)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&pushContentType, "content-type", "t", "", "content type of the payload, recorded in the metadata with the v2 payload schema")
+	cmd.Flags().StringVarP(&pushCodec, "codec", "", "", "codec of the metadata: dag-json or dag-cbor, the daemon one if empty")
+	cmd.Flags().StringVarP(&pushType, "type", "", "", "payload type whose schema the payload, a json document, must match")
+	cmd.Flags().BoolVarP(&pushForce, "force", "f", false, "publish the payload even if it is already published and dedupe is enabled")
+	cmd.Flags().BoolVarP(&pushAsync, "async", "", false, "return once the metadata is stored, announcing it in the background")
+	cmd.Flags().BoolVarP(&pushWait, "wait", "w", false, "wait until the metadata is included in Pando")
+	cmd.Flags().DurationVarP(&pushTimeout, "timeout", "", 10*time.Minute, "maximum wait of --wait")
+	cmd.Flags().StringArrayVarP(&pushLabels, "label", "l", nil, "label of the publish in the key=value form, can be repeated")
+
+	return cmd
+}
+
+// pushOutput is the output of push with --json.
+type pushOutput struct {
+	Cid string `json:"cid"`
+	// Included tells whether the metadata is included in Pando, only waited for with --wait.
+	Included bool `json:"included"`
+}
+
+// waitInclusion polls the daemon until c is included in Pando or timeout elapses. It returns false
+// once the unexpected response of the daemon is printed.
+func waitInclusion(c cid.Cid, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := Client.R().
+			SetHeader("Content-Type", "application/octet-stream").
+			Get("/admin/inclusion/" + c.String())
+		if err != nil {
+			return false, err
+		}
+		switch res.StatusCode() {
+		case http.StatusOK:
+			if !JSONOutput {
+				fmt.Println("included in Pando")
+			}
+			return true, nil
+		case http.StatusNotFound:
+		default:
+			return false, PrintResponseData(res)
+		}
+		if time.Now().Add(pushPollInterval).After(deadline) {
+			return false, fmt.Errorf("metadata %s is not included in Pando after %s", c, timeout)
+		}
+		time.Sleep(pushPollInterval)
+	}
+}
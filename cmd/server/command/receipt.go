@@ -0,0 +1,27 @@
+package command
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+)
+
+func ReceiptCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "receipt <cid>",
+		Short: "show the receipt of a publish: when it was stored, announced and included, and where it is now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := cid.Decode(args[0]); err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Get("/admin/receipt/" + args[0])
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+}
@@ -0,0 +1,27 @@
+package command
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+)
+
+func RollbackCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rollback <cid>",
+		Short: "reset the head to an earlier pushed cid, dropping the metadatas pushed after it, and announce it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := cid.Decode(args[0]); err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/rollback/" + args[0])
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+}
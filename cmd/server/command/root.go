@@ -10,6 +10,9 @@ pando-server init
 
 # StartHttpServer pando server.
 pando-server daemon
+
+# Print the daemon status as JSON.
+pando-server status --json
 `
 
 func NewRoot() *cobra.Command {
@@ -22,6 +25,8 @@ func NewRoot() *cobra.Command {
 
 	rootCmd.PersistentFlags().StringVarP(&PClientBaseURL, "pclient", "c", "http://127.0.0.1:9022",
 		"set pando client url")
+	rootCmd.PersistentFlags().BoolVarP(&JSONOutput, "json", "", false,
+		"print the output as single-line JSON documents, for scripting")
 	NewClient(PClientBaseURL)
 
 	childCommands := []*cobra.Command{
@@ -29,10 +34,37 @@ func NewRoot() *cobra.Command {
 		DaemonCmd(),
 		AnnounceCommand(),
 		AddFileCommand(),
+		PushCommand(),
 		SyncCommand(),
 		ProviderSyncCommand(),
+		ProvidersCommand(),
 		CidListCommand(),
+		ReindexCommand(),
 		CatCommand(),
+		HeadCommand(),
+		CheckpointCommand(),
+		AnnotateCommand(),
+		AnnotationsCommand(),
+		FreezeCommand(),
+		UnfreezeCommand(),
+		CheckIntervalCommand(),
+		CheckerCommand(),
+		StatusCommand(),
+		StatsCommand(),
+		AuditCommand(),
+		AuditLogCommand(),
+		MirrorCommand(),
+		UnmirrorCommand(),
+		BridgeCommand(),
+		UnbridgeCommand(),
+		WatchCommand(),
+		UnwatchCommand(),
+		ScheduleCommand(),
+		UnscheduleCommand(),
+		InclusionCommand(),
+		BackupCommand(),
+		DeadLettersCommand(),
+		HistoryCommand(), ReceiptCommand(), RollbackCommand(), ImportCommand(), LabelCommand(), LookupCommand(), PeersCommand(),
 	}
 	rootCmd.AddCommand(childCommands...)
 
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+	"path/filepath"
+	"time"
+)
+
+var (
+	scheduleReq     = adminserver.ScheduleReq{}
+	scheduleTimeout time.Duration
+	listJobs        bool
+	runJob          bool
+)
+
+func ScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule <name> <cron>",
+		Short: "publish the output of a command or the contents of a file on a cron schedule, e.g. \"0 * * * *\" or \"@every 30m\"",
+		Args:  cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listJobs {
+				res, err := Client.R().Get("/admin/jobs")
+				if err != nil {
+					return err
+				}
+				return PrintResponseData(res)
+			}
+			if runJob {
+				if len(args) != 1 {
+					return fmt.Errorf("expected the name of the job to run")
+				}
+				bodyBytes, err := json.Marshal(adminserver.JobReq{Name: args[0]})
+				if err != nil {
+					return err
+				}
+				res, err := Client.R().
+					SetBody(bodyBytes).
+					SetHeader("Content-Type", "application/octet-stream").
+					Post("/admin/jobs/run")
+				if err != nil {
+					return err
+				}
+				return PrintResponseData(res)
+			}
+			if len(args) != 2 {
+				return fmt.Errorf("expected the name and the cron schedule of the job")
+			}
+			scheduleReq.Name, scheduleReq.Schedule = args[0], args[1]
+			if scheduleReq.File != "" {
+				// the daemon resolves relative paths from its own working directory.
+				file, err := filepath.Abs(scheduleReq.File)
+				if err != nil {
+					return err
+				}
+				scheduleReq.File = file
+			}
+			if scheduleTimeout != 0 {
+				scheduleReq.Timeout = scheduleTimeout.String()
+			}
+			bodyBytes, err := json.Marshal(scheduleReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/schedule")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringVarP(&scheduleReq.Command, "command", "c", "", "shell command whose standard output is published")
+	cmd.Flags().StringVarP(&scheduleReq.File, "file", "f", "", "file whose contents are published")
+	cmd.Flags().DurationVar(&scheduleTimeout, "timeout", 0, "abort the command after this duration, 1m if unset")
+	cmd.Flags().BoolVarP(&listJobs, "list", "l", false, "list the scheduled jobs")
+	cmd.Flags().BoolVar(&runJob, "run", false, "run the named job right away")
+
+	return cmd
+}
+
+func UnscheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unschedule <name>",
+		Short: "remove a scheduled publish job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bodyBytes, err := json.Marshal(adminserver.JobReq{Name: args[0]})
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/unschedule")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,139 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+	"os"
+	"pandoClient/pkg/engine"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	statusWatch    bool
+	statusInterval time.Duration
+)
+
+func StatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "show the chain head, pending inclusions and connectivity of the daemon",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !statusWatch {
+				status, err := getStatus()
+				if err != nil {
+					return err
+				}
+				return printStatus(status)
+			}
+			if statusInterval <= 0 {
+				return fmt.Errorf("watch interval must be positive")
+			}
+
+			ticker := time.NewTicker(statusInterval)
+			defer ticker.Stop()
+			for {
+				status, err := getStatus()
+				// clear the screen before each refresh, the JSON documents are printed one per line.
+				if !JSONOutput {
+					fmt.Print("\033[H\033[2J")
+				}
+				if err != nil {
+					if JSONOutput {
+						_ = PrintJSON(struct {
+							Error string `json:"error"`
+						}{err.Error()})
+					} else {
+						fmt.Printf("failed to get status: %v\n", err)
+					}
+				} else if err = printStatus(status); err != nil {
+					return err
+				}
+				select {
+				case <-cmd.Context().Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "refresh the status until interrupted")
+	cmd.Flags().DurationVarP(&statusInterval, "interval", "i", 2*time.Second, "refresh interval of --watch")
+
+	return cmd
+}
+
+func getStatus() (*engine.Status, error) {
+	res, err := Client.R().
+		SetHeader("Content-Type", "application/octet-stream").
+		Get("/admin/status")
+	if err != nil {
+		return nil, err
+	}
+	var resJson struct {
+		Code    int
+		Message string
+		Data    *engine.Status
+	}
+	if err = json.Unmarshal(res.Body(), &resJson); err != nil {
+		return nil, err
+	}
+	if resJson.Data == nil {
+		return nil, fmt.Errorf("unexpected response %d: %s", resJson.Code, resJson.Message)
+	}
+	return resJson.Data, nil
+}
+
+func printStatus(s *engine.Status) error {
+	if JSONOutput {
+		return PrintJSON(s)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	row := func(name string, value interface{}) {
+		_, _ = fmt.Fprintf(w, "%s\t%v\n", name, value)
+	}
+	row("Chain head", cidOrNone(s.LatestMeta))
+	row("Chain length", s.ChainLength)
+	row("Publisher", publisherKind(s.PublisherKind))
+	row("Started", s.Started)
+	row("Frozen", s.Frozen)
+	if s.Freeze != nil {
+		row("Freeze reason", s.Freeze.Reason)
+		row("Frozen since", timeOrNever(s.Freeze.Since))
+	}
+	row("Pending inclusions", s.PendingChecks)
+	row("Last check", timeOrNever(s.LastCheck))
+	row("Last announced", cidOrNone(s.LastAnnounced))
+	row("Last announce", timeOrNever(s.LastAnnounceTime))
+	if s.Pando == nil {
+		row("Pando", "not configured")
+	} else {
+		row("Pando", s.Pando.ID)
+		row("Pando connectivity", s.Pando.Connectedness)
+	}
+	return w.Flush()
+}
+
+func cidOrNone(c cid.Cid) string {
+	if !c.Defined() {
+		return "none"
+	}
+	return c.String()
+}
+
+func timeOrNever(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Truncate(time.Second))
+}
+
+func publisherKind(k engine.PublisherKind) string {
+	if k == engine.NoPublisher {
+		return "disabled"
+	}
+	return string(k)
+}
@@ -42,6 +42,9 @@ func SyncCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&syncReq.Cid, "start-cid", "s", "", "head cid to sync")
 	cmd.Flags().StringVarP(&syncReq.StopCid, "end-cid", "e", "", "end cid")
 	cmd.Flags().IntVarP(&syncReq.Depth, "depth", "d", 0, "max depth to sync")
+	cmd.Flags().BoolVarP(&syncReq.All, "all", "a", false, "sync the whole chain, bounded by the sync limits of the daemon only")
+	cmd.Flags().IntVarP(&syncReq.MaxBlocks, "max-blocks", "", 0, "stop the sync after this number of blocks instead of the daemon limit, -1 for no limit")
+	cmd.Flags().Int64VarP(&syncReq.MaxBytes, "max-bytes", "", 0, "stop the sync after this number of bytes instead of the daemon limit, -1 for no limit")
 
 	return cmd
 }
@@ -42,6 +42,9 @@ func ProviderSyncCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&providerSyncReq.StopCid, "end-cid", "e", "", "end cid")
 	cmd.Flags().StringVarP(&providerSyncReq.Provider, "provider", "p", "", "provider")
 	cmd.Flags().IntVarP(&providerSyncReq.Depth, "depth", "d", 0, "max depth to sync")
+	cmd.Flags().BoolVarP(&providerSyncReq.All, "all", "a", false, "sync the whole chain, bounded by the sync limits of the daemon only")
+	cmd.Flags().IntVarP(&providerSyncReq.MaxBlocks, "max-blocks", "", 0, "stop the sync after this number of blocks instead of the daemon limit, -1 for no limit")
+	cmd.Flags().Int64VarP(&providerSyncReq.MaxBytes, "max-bytes", "", 0, "stop the sync after this number of bytes instead of the daemon limit, -1 for no limit")
 
 	return cmd
 }
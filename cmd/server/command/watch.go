@@ -0,0 +1,93 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	adminserver "pandoClient/pkg/server/admin/http"
+	"path/filepath"
+	"time"
+)
+
+var (
+	watchReq      = adminserver.WatchReq{}
+	watchDebounce time.Duration
+	listWatches   bool
+)
+
+func WatchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch <dir>",
+		Short: "publish the files added to or changed in a directory as they are written",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listWatches {
+				res, err := Client.R().Get("/admin/watches")
+				if err != nil {
+					return err
+				}
+				return PrintResponseData(res)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("nil directory to watch")
+			}
+			// the daemon resolves relative paths from its own working directory.
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			watchReq.Dir = dir
+			if watchDebounce != 0 {
+				watchReq.Debounce = watchDebounce.String()
+			}
+			bodyBytes, err := json.Marshal(watchReq)
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/watch")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&watchReq.Ignore, "ignore", "i", nil, "glob patterns of the files and directories not to publish, e.g. *.tmp,.git")
+	cmd.Flags().DurationVarP(&watchDebounce, "debounce", "d", 0, "how long a file must stay unchanged before it is published, 2s if unset")
+	cmd.Flags().BoolVarP(&listWatches, "list", "l", false, "list the watched directories")
+
+	return cmd
+}
+
+func UnwatchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unwatch <dir>",
+		Short: "stop publishing the files of a watched directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			bodyBytes, err := json.Marshal(adminserver.UnwatchReq{Dir: dir})
+			if err != nil {
+				return err
+			}
+			res, err := Client.R().
+				SetBody(bodyBytes).
+				SetHeader("Content-Type", "application/octet-stream").
+				Post("/admin/unwatch")
+			if err != nil {
+				return err
+			}
+
+			return PrintResponseData(res)
+		},
+	}
+
+	return cmd
+}
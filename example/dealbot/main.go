@@ -138,7 +138,7 @@ func main() {
 		panic(err)
 	}
 	// 5. sync data you want(with Pando). In the example, we sync with dealbot provider from Pando.
-	err = e.SyncWithProvider(context.Background(), dealbotIDStr, 1000000, "")
+	_, err = e.SyncWithProvider(context.Background(), dealbotIDStr, 1000000, "")
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,99 @@
+// Package alert notifies operators of failures that need their attention, such as metadatas
+// that Pando never includes, through pluggable alerters.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/ipfs/go-cid"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Kind is the kind of failure an alert reports.
+type Kind string
+
+const (
+	// DeadLetter reports a metadata moved to the dead-letter list.
+	DeadLetter Kind = "dead_letter"
+	// Backlog reports a check list backlog above the threshold.
+	Backlog Kind = "backlog"
+	// Fork reports a head known by Pando that is not on the local chain.
+	Fork Kind = "fork"
+)
+
+// Alert is a failure reported to the alerters.
+type Alert struct {
+	Kind    Kind      `json:"kind"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	// Provider is the peer id of the provider raising the alert.
+	Provider string `json:"provider"`
+	// Cid is the metadata of a DeadLetter alert, or the head known by Pando of a Fork alert,
+	// undefined otherwise.
+	Cid cid.Cid `json:"cid"`
+	// Backlog is the number of pending inclusion checks of a Backlog alert.
+	Backlog int `json:"backlog,omitempty"`
+}
+
+// Alerter sends alerts to operators.
+type Alerter interface {
+	Alert(ctx context.Context, a Alert) error
+}
+
+// Func turns a function into an Alerter.
+type Func func(ctx context.Context, a Alert) error
+
+func (f Func) Alert(ctx context.Context, a Alert) error {
+	return f(ctx, a)
+}
+
+// Webhook posts the alerts as json to a URL.
+type Webhook struct {
+	c   *resty.Client
+	url string
+}
+
+// NewWebhook instantiates an alerter posting the alerts as json to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{c: resty.New().SetTimeout(defaultTimeout), url: url}
+}
+
+func (w *Webhook) Alert(ctx context.Context, a Alert) error {
+	return post(ctx, w.c, w.url, a)
+}
+
+// Slack posts the alerts as messages to a Slack incoming webhook.
+type Slack struct {
+	c   *resty.Client
+	url string
+}
+
+// NewSlack instantiates an alerter posting the alerts to the Slack incoming webhook url.
+func NewSlack(url string) *Slack {
+	return &Slack{c: resty.New().SetTimeout(defaultTimeout), url: url}
+}
+
+func (s *Slack) Alert(ctx context.Context, a Alert) error {
+	msg := struct {
+		Text string `json:"text"`
+	}{Text: fmt.Sprintf(":rotating_light: *pando client %s*: %s", a.Provider, a.Message)}
+	return post(ctx, s.c, s.url, msg)
+}
+
+func post(ctx context.Context, c *resty.Client, url string, body interface{}) error {
+	res, err := c.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(url)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return fmt.Errorf("alert webhook returned %s", res.Status())
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var got Alert
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	c, err := cid.Decode("bafkqaaa")
+	require.NoError(t, err)
+	a := Alert{Kind: DeadLetter, Message: "not included", Time: time.Unix(1, 0).UTC(), Provider: "provider", Cid: c}
+	require.NoError(t, NewWebhook(srv.URL).Alert(context.Background(), a))
+	require.Equal(t, a, got)
+
+	status = http.StatusInternalServerError
+	require.Error(t, NewWebhook(srv.URL).Alert(context.Background(), a))
+}
+
+func TestSlack(t *testing.T) {
+	var got struct{ Text string }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	a := Alert{Kind: Backlog, Message: "120 inclusion checks are pending", Provider: "provider", Backlog: 120}
+	require.NoError(t, NewSlack(srv.URL).Alert(context.Background(), a))
+	require.True(t, strings.Contains(got.Text, "120 inclusion checks are pending"), got.Text)
+	require.True(t, strings.Contains(got.Text, "provider"), got.Text)
+}
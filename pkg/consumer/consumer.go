@@ -0,0 +1,240 @@
+// Package consumer is a lightweight SDK to read the metadatas a provider publishes with its http
+// publisher, without running an engine nor a libp2p host.
+//
+//	c, _ := consumer.New()
+//	f, _ := c.Follow(providerID, providerHttpAddr)
+//	it := f.Payloads(ctx)
+//	for it.Next() {
+//		fmt.Println(it.Cid(), string(it.Payload()))
+//	}
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/filecoin-project/go-legs"
+	"github.com/filecoin-project/go-legs/httpsync"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"io"
+	sc "pandoClient/pkg/schema"
+	"pandoClient/pkg/util/log"
+	"sync"
+)
+
+var logger = log.NewSubsystemLogger()
+
+// Consumer syncs and reads the metadata chains of the providers it follows.
+type Consumer struct {
+	*options
+	lsys ipld.LinkSystem
+	sync *httpsync.Sync
+}
+
+// Follower reads the metadata chain of a single provider.
+type Follower struct {
+	c        *Consumer
+	provider peer.ID
+	syncer   *httpsync.Syncer
+
+	mutex  sync.Mutex
+	latest cid.Cid
+}
+
+// New instantiates a consumer.
+func New(o ...Option) (*Consumer, error) {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+	c := &Consumer{options: opts}
+	c.lsys = c.mkLinkSystem()
+	c.sync = httpsync.NewSync(c.lsys, opts.httpClient, nil)
+	return c, nil
+}
+
+func (c *Consumer) mkLinkSystem() ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		val, err := c.ds.Get(lctx.Ctx, datastore.NewKey(lnk.(cidlink.Link).Cid.String()))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(val), nil
+	}
+	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			return c.ds.Put(lctx.Ctx, datastore.NewKey(lnk.(cidlink.Link).Cid.String()), buf.Bytes())
+		}, nil
+	}
+	return lsys
+}
+
+// Follow starts following the chain of provider served by its http publisher at addr, e.g.
+// /ip4/1.2.3.4/tcp/9022/http.
+func (c *Consumer) Follow(provider peer.ID, addr multiaddr.Multiaddr) (*Follower, error) {
+	syncer, err := c.sync.NewSyncer(provider, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow provider %s: %w", provider, err)
+	}
+	return &Follower{c: c, provider: provider, syncer: syncer}, nil
+}
+
+// Close releases the resources of the consumer.
+func (c *Consumer) Close() {
+	c.sync.Close()
+}
+
+// Provider returns the peer id of the followed provider.
+func (f *Follower) Provider() peer.ID {
+	return f.provider
+}
+
+// Latest syncs the chain of the provider up to its current head and returns the head.
+func (f *Follower) Latest(ctx context.Context) (cid.Cid, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	head, err := f.syncer.GetHead(ctx)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to get head of provider %s: %w", f.provider, err)
+	}
+	if !head.Defined() || head.Equals(f.latest) {
+		return head, nil
+	}
+	var stop ipld.Link
+	if f.latest.Defined() {
+		stop = cidlink.Link{Cid: f.latest}
+	}
+	if err = f.syncer.Sync(ctx, head, legs.LegSelector(selector.RecursionLimitNone(), stop)); err != nil {
+		return cid.Undef, fmt.Errorf("failed to sync provider %s: %w", f.provider, err)
+	}
+	logger.Debugw("Synced provider chain", "provider", f.provider, "head", head)
+	f.latest = head
+	return head, nil
+}
+
+// Get returns the metadata c, syncing it from the provider if it is not stored locally.
+func (f *Follower) Get(ctx context.Context, c cid.Cid) (*schema.Metadata, error) {
+	meta, err := f.c.load(ctx, c)
+	if err == nil {
+		return meta, nil
+	}
+	if err != datastore.ErrNotFound {
+		return nil, err
+	}
+	if err = f.syncer.Sync(ctx, c, legs.LegSelector(selector.RecursionLimitDepth(1), nil)); err != nil {
+		return nil, fmt.Errorf("failed to sync %s from provider %s: %w", c, f.provider, err)
+	}
+	return f.c.load(ctx, c)
+}
+
+func (c *Consumer) load(ctx context.Context, mc cid.Cid) (*schema.Metadata, error) {
+	n, err := c.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: mc}, schema.MetadataPrototype)
+	if err != nil {
+		return nil, err
+	}
+	return schema.UnwrapMetadata(n)
+}
+
+// Payloads returns an iterator over the decoded payloads of the chain of the provider, from
+// the latest metadata to the first one. The chain is synced up to the head on the first call
+// to Next.
+func (f *Follower) Payloads(ctx context.Context) *PayloadIterator {
+	return &PayloadIterator{f: f, ctx: ctx}
+}
+
+// PayloadIterator walks the metadatas of a provider chain from the head, decoding their payload.
+type PayloadIterator struct {
+	f       *Follower
+	ctx     context.Context
+	started bool
+	next    cid.Cid
+	cur     cid.Cid
+	meta    *schema.Metadata
+	payload []byte
+	err     error
+}
+
+// Next advances the iterator to the previous metadata of the chain. It returns false when the
+// first metadata was passed or an error occurred, see Err.
+func (it *PayloadIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.next, it.err = it.f.Latest(it.ctx)
+		if it.err != nil {
+			return false
+		}
+	}
+	if !it.next.Defined() {
+		return false
+	}
+
+	meta, err := it.f.Get(it.ctx, it.next)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	payload, err := decodePayload(meta)
+	if err != nil {
+		it.err = fmt.Errorf("failed to decode payload of %s: %w", it.next, err)
+		return false
+	}
+	it.cur, it.meta, it.payload = it.next, meta, payload
+
+	it.next = cid.Undef
+	if meta.PreviousID != nil {
+		if prev, ok := (*meta.PreviousID).(cidlink.Link); ok {
+			it.next = prev.Cid
+		}
+	}
+	return true
+}
+
+// Cid returns the cid of the current metadata.
+func (it *PayloadIterator) Cid() cid.Cid {
+	return it.cur
+}
+
+// Metadata returns the current metadata.
+func (it *PayloadIterator) Metadata() *schema.Metadata {
+	return it.meta
+}
+
+// Payload returns the payload data of the current metadata, unwrapped from its v2 envelope: the
+// raw bytes of bytes payloads, the dag-json encoding of the others.
+func (it *PayloadIterator) Payload() []byte {
+	return it.payload
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *PayloadIterator) Err() error {
+	return it.err
+}
+
+func decodePayload(meta *schema.Metadata) ([]byte, error) {
+	p, err := sc.DecodeMetaPayload(meta)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := p.Data.AsBytes(); err == nil {
+		return b, nil
+	}
+	buf := bytes.Buffer{}
+	if err := dagjson.Encode(p.Data, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
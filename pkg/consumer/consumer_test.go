@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+	"net"
+	"pandoClient/pkg/engine"
+	"testing"
+	"time"
+)
+
+func TestFollower_Payloads(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	e, err := engine.New(
+		engine.WithHost(h),
+		engine.WithPublisherKind(engine.HttpPublisher),
+		engine.WithHttpPublisherListenAddr(fmt.Sprintf("127.0.0.1:%d", port)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	var published []cid.Cid
+	for i := 0; i < 3; i++ {
+		c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("payload %d", i)))
+		require.NoError(t, err)
+		published = append([]cid.Cid{c}, published...)
+	}
+
+	c, err := New()
+	require.NoError(t, err)
+	defer c.Close()
+	addr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/http", port))
+	require.NoError(t, err)
+	f, err := c.Follow(h.ID(), addr)
+	require.NoError(t, err)
+
+	head, err := f.Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, published[0], head)
+
+	var walked []cid.Cid
+	it := f.Payloads(ctx)
+	for it.Next() {
+		require.Equal(t, fmt.Sprintf("payload %d", 2-len(walked)), string(it.Payload()))
+		walked = append(walked, it.Cid())
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, published, walked)
+
+	meta, err := f.Get(ctx, published[1])
+	require.NoError(t, err)
+	require.Equal(t, h.ID().String(), meta.Provider)
+}
@@ -0,0 +1,48 @@
+package consumer
+
+import (
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"net/http"
+)
+
+type (
+	// Option sets a configuration parameter for the consumer.
+	Option func(*options) error
+
+	options struct {
+		ds         datastore.Batching
+		httpClient *http.Client
+	}
+)
+
+func newOptions(o ...Option) (*options, error) {
+	opts := &options{}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ds == nil {
+		opts.ds = dssync.MutexWrap(datastore.NewMapDatastore())
+	}
+	return opts, nil
+}
+
+// WithDatastore sets the datastore in which synced metadatas are stored.
+// If unspecified, an ephemeral in-memory datastore is used.
+func WithDatastore(ds datastore.Batching) Option {
+	return func(o *options) error {
+		o.ds = ds
+		return nil
+	}
+}
+
+// WithHttpClient sets the http client used to sync from the http publishers of providers.
+// If unspecified, a client with a 10 seconds timeout is used.
+func WithHttpClient(c *http.Client) Option {
+	return func(o *options) error {
+		o.httpClient = c
+		return nil
+	}
+}
@@ -0,0 +1,241 @@
+// Package cron parses cron expressions and computes the times they fire at.
+//
+// An expression has the five standard fields, minute, hour, day of month, month and day of
+// week, each of them a comma-separated list of values, ranges such as 1-5 and steps such as */15
+// or 10-40/10. Months and days of week may also be named by their first three letters, e.g. JAN
+// or mon, and 7 is Sunday like 0. As in most cron implementations, when both the day of month
+// and the day of week are restricted, a day matches if either of them does.
+//
+// The descriptors @yearly (or @annually), @monthly, @weekly, @daily (or @midnight) and @hourly
+// are accepted, as well as @every <duration>, e.g. @every 90m, which fires at a fixed interval.
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	expr string
+	// bits of the matching values of each field.
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar tell whether the day fields were unrestricted.
+	domStar, dowStar bool
+	// every is the interval of @every schedules, 0 for the other ones.
+	every time.Duration
+}
+
+type bounds struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = bounds{name: "minute", min: 0, max: 59}
+	hourBounds   = bounds{name: "hour", min: 0, max: 23}
+	domBounds    = bounds{name: "day of month", min: 1, max: 31}
+	monthBounds  = bounds{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is folded into 0 once parsed.
+	dowBounds = bounds{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression or descriptor.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	s := &Schedule{expr: expr}
+	if strings.HasPrefix(expr, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval of %q: %w", expr, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("interval of %q must be at least 1s", expr)
+		}
+		s.every = every
+		return s, nil
+	}
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	} else if strings.HasPrefix(expr, "@") {
+		return nil, fmt.Errorf("unknown descriptor %q", expr)
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in %q, got %d", expr, len(fields))
+	}
+	var err error
+	if s.minute, _, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+	if s.hour, _, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+	if s.dom, s.domStar, err = parseField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+	if s.month, _, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+	if s.dow, s.dowStar, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parseField returns the bits of the values matched by field, and whether it is a wildcard.
+func parseField(field string, b bounds) (uint64, bool, error) {
+	var set uint64
+	star := false
+	for _, part := range strings.Split(field, ",") {
+		bitsOf, partStar, err := parsePart(part, b)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s %q: %w", b.name, field, err)
+		}
+		set |= bitsOf
+		star = star || partStar
+	}
+	return set, star, nil
+}
+
+func parsePart(part string, b bounds) (uint64, bool, error) {
+	rng, step := part, uint(1)
+	if i := strings.IndexByte(part, '/'); i >= 0 {
+		rng = part[:i]
+		n, err := strconv.ParseUint(part[i+1:], 10, 8)
+		if err != nil || n == 0 {
+			return 0, false, fmt.Errorf("invalid step %q", part[i+1:])
+		}
+		step = uint(n)
+	}
+
+	var lo, hi uint
+	star := false
+	switch {
+	case rng == "*" || rng == "?":
+		lo, hi = b.min, b.max
+		if b.max == 7 {
+			// Sunday is only matched once.
+			hi = 6
+		}
+		star = step == 1
+	case strings.IndexByte(rng, '-') > 0:
+		i := strings.IndexByte(rng, '-')
+		var err error
+		if lo, err = parseValue(rng[:i], b); err != nil {
+			return 0, false, err
+		}
+		if hi, err = parseValue(rng[i+1:], b); err != nil {
+			return 0, false, err
+		}
+		if lo > hi {
+			return 0, false, fmt.Errorf("range %q is reversed", rng)
+		}
+	default:
+		v, err := parseValue(rng, b)
+		if err != nil {
+			return 0, false, err
+		}
+		lo, hi = v, v
+		if step > 1 {
+			// a/n is a/n up to the maximum.
+			hi = b.max
+		}
+	}
+
+	var set uint64
+	for v := lo; v <= hi; v += step {
+		set |= 1 << v
+	}
+	return set, star, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	v := uint(n)
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time the schedule fires strictly after t, in the location of t. It
+// returns the zero time if the schedule never fires, e.g. for 0 0 30 2 *.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(time.Second).Add(s.every)
+	}
+
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// every matching date comes back within 5 years, leap days included.
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			// skip straight to the next matching minute of the hour, if any.
+			if next := s.minute >> uint(t.Minute()); next != 0 {
+				t = t.Add(time.Duration(bits.TrailingZeros64(next)) * time.Minute)
+			} else {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,65 @@
+package cron
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2022, time.March, 15, 10, 20, 30, 0, time.UTC)
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2022, time.March, 15, 10, 21, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2022, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"10-40/10 * * * *", time.Date(2022, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"5,50 9 * * *", time.Date(2022, time.March, 16, 9, 5, 0, 0, time.UTC)},
+		{"@daily", time.Date(2022, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		// 2022-03-15 is a Tuesday.
+		{"0 8 * * FRI", time.Date(2022, time.March, 18, 8, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2022, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week.
+		{"0 0 1 * 3", time.Date(2022, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@every 90m", time.Date(2022, time.March, 15, 11, 50, 30, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		require.NoError(t, err, c.expr)
+		require.Equal(t, c.next, s.Next(from), c.expr)
+	}
+
+	// the time found is strictly after the given one.
+	s, err := Parse("30 10 * * *")
+	require.NoError(t, err)
+	at := time.Date(2022, time.March, 15, 10, 30, 0, 0, time.UTC)
+	require.Equal(t, at.AddDate(0, 0, 1), s.Next(at))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@fortnightly",
+		"@every 1ms",
+		"@every soon",
+	} {
+		_, err := Parse(expr)
+		require.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	relayproto "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/multiformats/go-multiaddr"
+	"sort"
+	"time"
+)
+
+// defaultAddrBookTTL is how long the learned addresses of peers are kept in the address book.
+const defaultAddrBookTTL = 24 * time.Hour
+
+var dsAddrBookKey = datastore.NewKey("sync/addrbook")
+
+// AddrBookEntry is the persisted addresses of a peer.
+type AddrBookEntry struct {
+	ID    peer.ID
+	Addrs []string
+	// Expires is when the addresses are dropped, zero if they are permanent.
+	Expires time.Time
+	// Manual tells whether the entry was added with AddPeerAddrs. Manual entries are not
+	// replaced by the learned addresses.
+	Manual bool
+}
+
+func (a *AddrBookEntry) expired(now time.Time) bool {
+	return !a.Expires.IsZero() && !a.Expires.After(now)
+}
+
+// ttl returns the remaining time to live of the addresses in the peerstore.
+func (a *AddrBookEntry) ttl(now time.Time) time.Duration {
+	if a.Expires.IsZero() {
+		return peerstore.PermanentAddrTTL
+	}
+	return a.Expires.Sub(now)
+}
+
+func (a *AddrBookEntry) multiaddrs() []multiaddr.Multiaddr {
+	maddrs := make([]multiaddr.Multiaddr, 0, len(a.Addrs))
+	for _, addr := range a.Addrs {
+		m, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			logger.Warnw("Invalid address in address book", "peer", a.ID, "addr", addr, "err", err)
+			continue
+		}
+		maddrs = append(maddrs, m)
+	}
+	return maddrs
+}
+
+func (e *Engine) addrBookDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsAddrBookKey)
+}
+
+// AddrBook returns the persisted addresses of the peers, sorted by peer ID. Expired entries are
+// left out.
+func (e *Engine) AddrBook(ctx context.Context) ([]AddrBookEntry, error) {
+	entries, err := e.addrBookEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := make([]AddrBookEntry, 0, len(entries))
+	for _, a := range entries {
+		if !a.expired(now) {
+			res = append(res, a)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (e *Engine) addrBookEntries(ctx context.Context) ([]AddrBookEntry, error) {
+	res, err := e.addrBookDs().Query(ctx, query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var entries []AddrBookEntry
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var a AddrBookEntry
+		if err = json.Unmarshal(r.Value, &a); err != nil {
+			logger.Warnw("Invalid address book entry", "key", r.Key, "err", err)
+			continue
+		}
+		entries = append(entries, a)
+	}
+	return entries, nil
+}
+
+func (e *Engine) getAddrBookEntry(ctx context.Context, id peer.ID) (*AddrBookEntry, error) {
+	b, err := e.addrBookDs().Get(ctx, datastore.NewKey(id.String()))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNotInAddrBook, id)
+		}
+		return nil, err
+	}
+	var a AddrBookEntry
+	if err = json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (e *Engine) putAddrBookEntry(ctx context.Context, a *AddrBookEntry) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return e.addrBookDs().Put(ctx, datastore.NewKey(a.ID.String()), b)
+}
+
+// AddPeerAddrs adds the addresses of info to the peerstore of the host and persists them for
+// ttl, or permanently if ttl is zero, so that they are known again after restarts. The addresses
+// are merged with the ones already added.
+func (e *Engine) AddPeerAddrs(ctx context.Context, info peer.AddrInfo, ttl time.Duration) error {
+	if info.ID == "" {
+		return fmt.Errorf("peer ID can not be empty")
+	}
+	if len(info.Addrs) == 0 {
+		return fmt.Errorf("no address to add for peer %s", info.ID)
+	}
+	if ttl < 0 {
+		return fmt.Errorf("address ttl can not be negative")
+	}
+	e.addrBookMutex.Lock()
+	defer e.addrBookMutex.Unlock()
+
+	a := &AddrBookEntry{ID: info.ID, Manual: true}
+	if old, err := e.getAddrBookEntry(ctx, info.ID); err == nil && old.Manual && !old.expired(time.Now()) {
+		a.Addrs = old.Addrs
+	}
+	for _, m := range info.Addrs {
+		a.Addrs = appendAddr(a.Addrs, m.String())
+	}
+	if ttl == 0 {
+		ttl = peerstore.PermanentAddrTTL
+	} else {
+		a.Expires = time.Now().Add(ttl)
+	}
+	if err := e.putAddrBookEntry(ctx, a); err != nil {
+		return fmt.Errorf("failed to persist addresses: %w", err)
+	}
+	e.h.Peerstore().AddAddrs(info.ID, info.Addrs, ttl)
+	logger.Infow("Added peer addresses", "peer", info.ID, "addrs", info.Addrs, "ttl", ttl)
+	return nil
+}
+
+// RemovePeerAddrs removes the persisted addresses of id and clears its addresses from the
+// peerstore of the host. It returns ErrNotInAddrBook if id has no persisted addresses.
+func (e *Engine) RemovePeerAddrs(ctx context.Context, id peer.ID) error {
+	e.addrBookMutex.Lock()
+	defer e.addrBookMutex.Unlock()
+	if _, err := e.getAddrBookEntry(ctx, id); err != nil {
+		return err
+	}
+	if err := e.addrBookDs().Delete(ctx, datastore.NewKey(id.String())); err != nil {
+		return err
+	}
+	e.h.Peerstore().ClearAddrs(id)
+	logger.Infow("Removed peer addresses", "peer", id)
+	return nil
+}
+
+// loadAddrBook adds the persisted addresses to the peerstore of the host and drops the expired
+// ones.
+func (e *Engine) loadAddrBook(ctx context.Context) error {
+	e.addrBookMutex.Lock()
+	defer e.addrBookMutex.Unlock()
+	entries, err := e.addrBookEntries(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range entries {
+		a := &entries[i]
+		if a.expired(now) {
+			if err = e.addrBookDs().Delete(ctx, datastore.NewKey(a.ID.String())); err != nil {
+				logger.Warnw("Failed to drop expired addresses", "peer", a.ID, "err", err)
+			}
+			continue
+		}
+		e.h.Peerstore().AddAddrs(a.ID, a.multiaddrs(), a.ttl(now))
+	}
+	return nil
+}
+
+// learnPeerAddrs persists the addresses the peerstore knows of Pando, the relays and the mirrored
+// providers for the address book TTL. Failures are only logged.
+func (e *Engine) learnPeerAddrs(ctx context.Context) {
+	ids := make(map[peer.ID]struct{})
+	if e.pandoAddrinfo.ID != "" {
+		ids[e.pandoAddrinfo.ID] = struct{}{}
+	}
+	for _, r := range e.staticRelays {
+		ids[r.ID] = struct{}{}
+	}
+	// The relays of a host set with WithHost are only known by the relay protocol they support.
+	for _, id := range e.h.Network().Peers() {
+		if hop, err := e.h.Peerstore().SupportsProtocols(id, relayproto.ProtoIDv2Hop); err == nil && len(hop) != 0 {
+			ids[id] = struct{}{}
+		}
+	}
+	for _, m := range e.Mirrors() {
+		if id, err := peer.Decode(m.Provider); err == nil {
+			ids[id] = struct{}{}
+		}
+	}
+
+	e.addrBookMutex.Lock()
+	defer e.addrBookMutex.Unlock()
+	now := time.Now()
+	for id := range ids {
+		addrs := e.h.Peerstore().Addrs(id)
+		if len(addrs) == 0 {
+			continue
+		}
+		if old, err := e.getAddrBookEntry(ctx, id); err == nil && old.Manual && !old.expired(now) {
+			continue
+		}
+		a := &AddrBookEntry{ID: id, Expires: now.Add(e.addrBookTTL)}
+		for _, m := range addrs {
+			a.Addrs = appendAddr(a.Addrs, m.String())
+		}
+		if err := e.putAddrBookEntry(ctx, a); err != nil {
+			logger.Warnw("Failed to persist learned addresses", "peer", id, "err", err)
+		}
+	}
+}
+
+func appendAddr(addrs []string, addr string) []string {
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
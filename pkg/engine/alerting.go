@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"pandoClient/pkg/alert"
+	"sync/atomic"
+	"time"
+)
+
+// alertTimeout bounds the delivery of an alert to an alerter.
+const alertTimeout = 30 * time.Second
+
+// raiseAlert sends a to the alerters set with WithAlerter in the background. Delivery failures
+// are only logged.
+func (e *Engine) raiseAlert(a alert.Alert) {
+	if len(e.alerters) == 0 {
+		return
+	}
+	a.Time = time.Now()
+	a.Provider = e.h.ID().String()
+	for _, alerter := range e.alerters {
+		go func(alerter alert.Alerter) {
+			ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+			defer cancel()
+			if err := alerter.Alert(ctx, a); err != nil {
+				logger.Warnw("Failed to send alert", "kind", a.Kind, "err", err)
+			}
+		}(alerter)
+	}
+}
+
+func (e *Engine) alertDeadLetter(c cid.Cid, attempts int) {
+	e.raiseAlert(alert.Alert{
+		Kind:    alert.DeadLetter,
+		Message: fmt.Sprintf("metadata %s is not included in Pando after %d checks, it is moved to the dead-letter list", c, attempts),
+		Cid:     c,
+	})
+}
+
+// checkBacklog raises a Backlog alert once the pending checks of all the chains rise above the
+// threshold set with WithBacklogAlertThreshold, and not again until they fall back to it.
+func (e *Engine) checkBacklog(count int) {
+	if e.backlogAlertThreshold <= 0 {
+		return
+	}
+	if count <= e.backlogAlertThreshold {
+		atomic.StoreInt32(&e.backlogAlerted, 0)
+		return
+	}
+	if atomic.CompareAndSwapInt32(&e.backlogAlerted, 0, 1) {
+		e.raiseAlert(alert.Alert{
+			Kind:    alert.Backlog,
+			Message: fmt.Sprintf("%d inclusion checks are pending, above the threshold of %d", count, e.backlogAlertThreshold),
+			Backlog: count,
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"time"
+)
+
+var dsAnnotationsKey = datastore.NewKey("sync/meta/annotations")
+
+type (
+	// AnnotationValue is a single local-only annotation value with the time it was set. An empty
+	// value is the tombstone of a removed annotation, kept for the imports to remove it too.
+	AnnotationValue struct {
+		Value     string    `json:"Value"`
+		UpdatedAt time.Time `json:"UpdatedAt"`
+	}
+
+	// Annotations are local-only notes attached to a published cid, such as ticket IDs or
+	// verification status, keyed by name. They are never published to the network.
+	Annotations map[string]AnnotationValue
+)
+
+// merge merges other into a, keeping the most recently updated value of each key, tombstones
+// included. It reports whether a changed.
+func (a Annotations) merge(other Annotations) bool {
+	changed := false
+	for k, v := range other {
+		cur, exist := a[k]
+		if !exist || v.UpdatedAt.After(cur.UpdatedAt) {
+			a[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// live returns the annotations of a that are not removed.
+func (a Annotations) live() Annotations {
+	res := make(Annotations, len(a))
+	for k, v := range a {
+		if v.Value != "" {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func (e *Engine) annotationsDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsAnnotationsKey)
+}
+
+// Annotate sets the annotation key of the published cid c to value. An empty value removes the
+// annotation: a tombstone is kept in its place, so that importing annotations exported before
+// does not restore it.
+func (e *Engine) Annotate(ctx context.Context, c cid.Cid, key string, value string) error {
+	if !c.Defined() {
+		return fmt.Errorf("cid can not be nil")
+	}
+	if key == "" {
+		return fmt.Errorf("annotation key can not be empty")
+	}
+	e.annotationMutex.Lock()
+	defer e.annotationMutex.Unlock()
+
+	a, err := e.getAnnotations(ctx, c)
+	if err != nil {
+		return err
+	}
+	if _, exist := a[key]; !exist && value == "" {
+		return nil
+	}
+	a[key] = AnnotationValue{Value: value, UpdatedAt: e.clock.Now()}
+	return e.putAnnotations(ctx, c, a)
+}
+
+// GetAnnotations returns the annotations of cid c, or empty annotations if there is none.
+// Removed annotations are not returned.
+func (e *Engine) GetAnnotations(ctx context.Context, c cid.Cid) (Annotations, error) {
+	e.annotationMutex.Lock()
+	defer e.annotationMutex.Unlock()
+	a, err := e.getAnnotations(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return a.live(), nil
+}
+
+// ExportAnnotations returns all the annotations stored locally keyed by cid string, with the
+// tombstones of the removed ones.
+func (e *Engine) ExportAnnotations(ctx context.Context) (map[string]Annotations, error) {
+	e.annotationMutex.Lock()
+	defer e.annotationMutex.Unlock()
+
+	results, err := e.annotationsDs().Query(ctx, query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	res := make(map[string]Annotations)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var a Annotations
+		if err = json.Unmarshal(r.Value, &a); err != nil {
+			return nil, fmt.Errorf("failed to decode annotations of %s: %w", r.Key, err)
+		}
+		res[datastore.NewKey(r.Key).BaseNamespace()] = a
+	}
+	return res, nil
+}
+
+// ImportAnnotations merges exported annotations into the local ones. For every key present on
+// both sides the most recently updated value wins, removals included, so importing is idempotent
+// and two instances can exchange their annotations in any order.
+func (e *Engine) ImportAnnotations(ctx context.Context, annotations map[string]Annotations) error {
+	e.annotationMutex.Lock()
+	defer e.annotationMutex.Unlock()
+
+	for cidStr, imported := range annotations {
+		c, err := cid.Decode(cidStr)
+		if err != nil {
+			return fmt.Errorf("invalid cid in annotations: %s, err: %v", cidStr, err)
+		}
+		a, err := e.getAnnotations(ctx, c)
+		if err != nil {
+			return err
+		}
+		if !a.merge(imported) {
+			continue
+		}
+		if err = e.putAnnotations(ctx, c, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) getAnnotations(ctx context.Context, c cid.Cid) (Annotations, error) {
+	b, err := e.annotationsDs().Get(ctx, datastore.NewKey(c.String()))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return make(Annotations), nil
+		}
+		return nil, err
+	}
+	a := make(Annotations)
+	err = json.Unmarshal(b, &a)
+	return a, err
+}
+
+func (e *Engine) putAnnotations(ctx context.Context, c cid.Cid, a Annotations) error {
+	key := datastore.NewKey(c.String())
+	if len(a) == 0 {
+		return e.annotationsDs().Delete(ctx, key)
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return e.annotationsDs().Put(ctx, key, b)
+}
@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/filecoin-project/go-legs/p2p/protocol/head"
+	"github.com/hashicorp/go-multierror"
+	"github.com/ipfs/go-cid"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pubsubpb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"net/http"
+)
+
+// directConnectTicks makes pubsub check it's connected to direct peers every N seconds.
+const directConnectTicks uint64 = 30
+
+// gossipTopic is an announcement topic joined by the engine itself, together with the head
+// publisher answering root queries on it.
+type gossipTopic struct {
+	name  string
+	topic *pubsub.Topic
+	head  *head.Publisher
+	// ps is the router the announcement validator of the topic is registered on, nil if the
+	// announcements are not validated.
+	ps *pubsub.PubSub
+}
+
+// newPubSub instantiates the gossipsub router owned by the engine. It mirrors the router
+// configuration go-legs uses when no topic is supplied, with the peer scoring of
+// WithGossipScoring.
+func (e *Engine) newPubSub() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	psOpts := []pubsub.Option{
+		pubsub.WithPeerExchange(true),
+		pubsub.WithMessageIdFn(func(pmsg *pubsubpb.Message) string {
+			h := sha256.Sum256(pmsg.Data)
+			return string(h[:])
+		}),
+		pubsub.WithFloodPublish(true),
+		pubsub.WithDirectConnectTicks(directConnectTicks),
+	}
+	if e.gossipScoring != nil {
+		psOpts = append(psOpts, pubsub.WithPeerScore(e.gossipScoring.peerScore()))
+	}
+	ps, err := pubsub.NewGossipSub(ctx, e.h, psOpts...)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to create pubsub: %w", err)
+	}
+	e.ps = ps
+	e.psCancel = cancel
+	return nil
+}
+
+// joinGossipTopic joins the given topic on the engine-owned pubsub router and starts serving
+// head queries for it.
+func (e *Engine) joinGossipTopic(name string) (*gossipTopic, error) {
+	if e.ps == nil {
+		return nil, fmt.Errorf("pubsub router is not owned by the engine, can not join topic: %s", name)
+	}
+	t, err := e.joinTopic(name)
+	if err != nil {
+		return nil, err
+	}
+	gt := &gossipTopic{
+		name:  name,
+		topic: t,
+		head:  head.NewPublisher(),
+	}
+	if e.validatesAnnouncements() {
+		gt.ps = e.ps
+	}
+	go func() {
+		err := gt.head.Serve(e.h, name)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorw("Head publisher stopped serving on topic", "topic", name, "err", err)
+		}
+	}()
+	return gt, nil
+}
+
+func (gt *gossipTopic) close() error {
+	err := gt.head.Close()
+	if cerr := gt.topic.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if gt.ps != nil {
+		// the topic may be joined again, e.g. by a later migration.
+		if cerr := gt.ps.UnregisterTopicValidator(gt.name); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// setRoot sets c as the root of the publisher without announcing it.
+func (e *Engine) setRoot(ctx context.Context, c cid.Cid) error {
+	if err := e.publisher.SetRoot(ctx, c); err != nil {
+		return err
+	}
+	if e.migratedTopic != nil {
+		return e.migratedTopic.head.UpdateRoot(ctx, c)
+	}
+	return nil
+}
+
+// SetExtraGossipData replaces the extra data included in all subsequent pubsub announcements.
+// An empty extraData removes it.
+//
+// Note that this only takes effect if the PublisherKind is set to DataTransferPublisher.
+func (e *Engine) SetExtraGossipData(extraData []byte) {
+	var data []byte
+	if len(extraData) != 0 {
+		// Make copy for safety.
+		data = make([]byte, len(extraData))
+		copy(data, extraData)
+	}
+	e.extraMutex.Lock()
+	defer e.extraMutex.Unlock()
+	e.pubExtraGossipData = data
+}
+
+// extraGossipData returns the extra data to announce with, honouring a per-publish override.
+func (e *Engine) extraGossipData(opts *publishOptions) []byte {
+	if opts != nil && opts.hasExtraGossipData {
+		return opts.extraGossipData
+	}
+	e.extraMutex.RLock()
+	defer e.extraMutex.RUnlock()
+	return e.pubExtraGossipData
+}
+
+// announce sets c as the root of the publisher and announces it to the network.
+// With the dtsync and dual publishers the gossip message is built by the engine, so that it is sent on
+// the current announcement topic even after a topic migration. If an HTTP announce URL is set, c
+// is also announced to it. Failures are retried according to the RetryAnnounce policy.
+func (e *Engine) announce(ctx context.Context, c cid.Cid, extraData []byte) error {
+	return e.announceOn(ctx, c, extraData, "")
+}
+
+// announceOn is announce on the gossipsub topic named topic, the current announcement topic if
+// empty.
+func (e *Engine) announceOn(ctx context.Context, c cid.Cid, extraData []byte, topic string) error {
+	if e.publisher == nil {
+		return ErrPublisherDisabled
+	}
+	err := e.announceRetry.Do(ctx, func(ctx context.Context) error {
+		return e.publishAnnouncement(ctx, c, extraData, topic)
+	})
+	if err != nil {
+		return err
+	}
+	e.recordAnnounced(c)
+	if e.auditLog {
+		op, chain := AuditAnnounce, ""
+		if entry := e.historyEntry(ctx, c); entry != nil {
+			chain = entry.Chain
+			if !entry.AnnouncedAt.IsZero() {
+				op = AuditRepublish
+			}
+		}
+		e.appendAuditLog(ctx, op, c, chain)
+	}
+	e.historyAnnounced(ctx, c)
+	if err := e.markAnnounced(ctx, c); err != nil {
+		logger.Warnw("Failed to record announced metadata", "cid", c, "err", err)
+	}
+	return nil
+}
+
+func (e *Engine) publishAnnouncement(ctx context.Context, c cid.Cid, extraData []byte, topic string) error {
+	if err := e.publishGossipAnnouncement(ctx, c, extraData, topic); err != nil {
+		// the http announcement reaches Pando without the gossip mesh.
+		if !errors.Is(err, ErrNoAnnouncePeers) || e.httpAnnounceURL == "" {
+			return err
+		}
+	}
+	if e.httpAnnounceURL != "" {
+		return e.httpAnnounce(ctx, c, extraData)
+	}
+	return nil
+}
+
+func (e *Engine) publishGossipAnnouncement(ctx context.Context, c cid.Cid, extraData []byte, topic string) error {
+	if !e.pubKind.gossips() {
+		return e.publisher.UpdateRoot(ctx, c)
+	}
+
+	if err := e.setRoot(ctx, c); err != nil {
+		return err
+	}
+	t, err := e.announceTopic(ctx, c, topic)
+	if err != nil {
+		return err
+	}
+
+	// pubsub publishes to an empty mesh without error, the announcement would be lost.
+	if !e.gossipReachable(t) {
+		return fmt.Errorf("%w on topic %s", ErrNoAnnouncePeers, t.String())
+	}
+
+	msg, err := e.newAnnounceMessage(t.String(), c, extraData)
+	if err != nil {
+		return err
+	}
+	if err = t.Publish(ctx, msg.Encoded); err != nil {
+		return err
+	}
+	e.recordAnnounceMessage(msg)
+	return nil
+}
+
+// gossipReachable tells whether an announcement on t reaches a peer: some peer is subscribed to
+// t, or the host is connected to Pando, whose subscription may not be known yet.
+func (e *Engine) gossipReachable(t *pubsub.Topic) bool {
+	if len(t.ListPeers()) != 0 {
+		return true
+	}
+	return e.pandoConn != nil && e.pandoConn.connected()
+}
+
+// announceTopic returns the topic named name to announce c on, joining it on first use. The
+// current announcement topic is returned if name is empty or its name.
+func (e *Engine) announceTopic(ctx context.Context, c cid.Cid, name string) (*pubsub.Topic, error) {
+	current, currentName := e.pubTopic, e.pubTopicName
+	if e.migratedTopic != nil {
+		current, currentName = e.migratedTopic.topic, e.migratedTopic.name
+	}
+	if name == "" || name == currentName {
+		return current, nil
+	}
+	if e.pubTopic != nil && name == e.pubTopic.String() {
+		// the original topic, still joined after a migration.
+		return e.pubTopic, nil
+	}
+
+	e.topicsMutex.Lock()
+	defer e.topicsMutex.Unlock()
+	gt, ok := e.extraTopics[name]
+	if !ok {
+		var err error
+		if gt, err = e.joinGossipTopic(name); err != nil {
+			return nil, err
+		}
+		e.extraTopics[name] = gt
+	}
+	// serve head queries on the topic too.
+	if err := gt.head.UpdateRoot(ctx, c); err != nil {
+		return nil, err
+	}
+	return gt.topic, nil
+}
+
+// closeExtraTopics leaves the topics joined by announceTopic.
+func (e *Engine) closeExtraTopics() error {
+	var errs error
+	e.topicsMutex.Lock()
+	defer e.topicsMutex.Unlock()
+	for name, gt := range e.extraTopics {
+		if err := gt.close(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error closing topic %s: %s", name, err))
+		}
+		delete(e.extraTopics, name)
+	}
+	return errs
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"github.com/filecoin-project/go-legs/dtsync"
+	"github.com/ipfs/go-cid"
+	"time"
+)
+
+// AnnounceMessage is the decoded gossip message announcing a metadata, as received by the
+// consumers syncing the chain.
+type AnnounceMessage struct {
+	// Topic is the gossipsub topic the message is sent on.
+	Topic string
+	// Cid is the announced head.
+	Cid cid.Cid
+	// Addrs are the addresses the consumers sync the head from.
+	Addrs []string
+	// ExtraData is the extra gossip data of the announcement, if any.
+	ExtraData []byte
+	// Encoded is the message exactly as gossiped, CBOR encoded.
+	Encoded []byte
+	// Sent is when the message was gossiped, zero if it was not sent yet.
+	Sent time.Time
+}
+
+// newAnnounceMessage builds the gossip message announcing c on topic.
+func (e *Engine) newAnnounceMessage(topic string, c cid.Cid, extraData []byte) (*AnnounceMessage, error) {
+	msg := dtsync.Message{
+		Cid:       c,
+		ExtraData: extraData,
+	}
+	msg.SetAddrs(e.h.Addrs())
+	buf := bytes.NewBuffer(nil)
+	if err := msg.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	am := &AnnounceMessage{
+		Topic:     topic,
+		Cid:       c,
+		ExtraData: extraData,
+		Encoded:   buf.Bytes(),
+	}
+	for _, addr := range e.h.Addrs() {
+		am.Addrs = append(am.Addrs, addr.String())
+	}
+	return am, nil
+}
+
+// recordAnnounceMessage keeps m as the last message gossiped.
+func (e *Engine) recordAnnounceMessage(m *AnnounceMessage) {
+	m.Sent = time.Now()
+	e.statusMutex.Lock()
+	defer e.statusMutex.Unlock()
+	e.lastAnnounceMessage = m
+}
+
+// LastAnnounceMessage returns the last announcement gossiped since Start, or ErrNoAnnounceMessage
+// if none was gossiped yet.
+func (e *Engine) LastAnnounceMessage() (*AnnounceMessage, error) {
+	e.statusMutex.Lock()
+	defer e.statusMutex.Unlock()
+	if e.lastAnnounceMessage == nil {
+		return nil, ErrNoAnnounceMessage
+	}
+	m := *e.lastAnnounceMessage
+	return &m, nil
+}
+
+// NextAnnounceMessage returns the announcement that would be gossiped by RePublishLatest: the
+// latest metadata on the current announcement topic, with the current addresses of the host and
+// extra gossip data. It returns ErrNoPublishedMetadata if nothing is published yet, and
+// ErrNotGossiping if the publisher does not gossip announcements.
+func (e *Engine) NextAnnounceMessage(ctx context.Context) (*AnnounceMessage, error) {
+	if e.publisher == nil {
+		return nil, ErrPublisherDisabled
+	}
+	if !e.pubKind.gossips() {
+		return nil, ErrNotGossiping
+	}
+	c, err := e.getLatestMetaFromDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c == cid.Undef {
+		return nil, ErrNoPublishedMetadata
+	}
+	topic := e.pubTopicName
+	if e.migratedTopic != nil {
+		topic = e.migratedTopic.name
+	}
+	return e.newAnnounceMessage(topic, c, e.extraGossipData(nil))
+}
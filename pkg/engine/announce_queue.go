@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/network"
+	"time"
+)
+
+const defaultAnnounceFlushInterval = 30 * time.Second
+
+var dsAnnounceQueueKey = datastore.NewKey("sync/meta/announceQueue")
+
+// queuedAnnounce is an announcement that failed and is retried once connectivity returns.
+type queuedAnnounce struct {
+	Cid       cid.Cid
+	ExtraData []byte
+	// Topic is the announcement topic set by WithAnnounceTopic, empty for the engine topic.
+	Topic string
+	// SkipCheck is set by WithSkipCheck.
+	SkipCheck bool
+	// Chain is the named chain the metadata is published on, empty for the default chain.
+	Chain string `json:",omitempty"`
+}
+
+func (e *Engine) loadAnnounceQueue(ctx context.Context) ([]queuedAnnounce, error) {
+	b, err := e.ds.Get(ctx, dsAnnounceQueueKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var q []queuedAnnounce
+	err = json.Unmarshal(b, &q)
+	return q, err
+}
+
+func (e *Engine) persistAnnounceQueue(ctx context.Context) error {
+	if len(e.announceQueue) == 0 {
+		return e.ds.Delete(ctx, dsAnnounceQueueKey)
+	}
+	b, err := json.Marshal(e.announceQueue)
+	if err != nil {
+		return err
+	}
+	return e.ds.Put(ctx, dsAnnounceQueueKey, b)
+}
+
+// QueuedAnnounces returns the cids of the metadatas waiting to be announced, oldest first.
+func (e *Engine) QueuedAnnounces() []cid.Cid {
+	e.queueMutex.Lock()
+	defer e.queueMutex.Unlock()
+	res := make([]cid.Cid, 0, len(e.announceQueue))
+	for _, qa := range e.announceQueue {
+		res = append(res, qa.Cid)
+	}
+	return res
+}
+
+func (e *Engine) hasQueuedAnnounces() bool {
+	e.queueMutex.Lock()
+	defer e.queueMutex.Unlock()
+	return len(e.announceQueue) != 0
+}
+
+func (e *Engine) isQueuedAnnounce(c cid.Cid) bool {
+	e.queueMutex.Lock()
+	defer e.queueMutex.Unlock()
+	for _, qa := range e.announceQueue {
+		if qa.Cid.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropQueuedAnnounces removes the announcements of cids from the queue.
+func (e *Engine) dropQueuedAnnounces(ctx context.Context, cids map[cid.Cid]struct{}) error {
+	e.queueMutex.Lock()
+	defer e.queueMutex.Unlock()
+	kept := make([]queuedAnnounce, 0, len(e.announceQueue))
+	for _, qa := range e.announceQueue {
+		if _, ok := cids[qa.Cid]; !ok {
+			kept = append(kept, qa)
+		}
+	}
+	if len(kept) == len(e.announceQueue) {
+		return nil
+	}
+	e.announceQueue = kept
+	return e.persistAnnounceQueue(ctx)
+}
+
+// enqueueAnnounce durably queues the announcement qa and wakes up the flush loop.
+func (e *Engine) enqueueAnnounce(ctx context.Context, qa queuedAnnounce) error {
+	e.queueMutex.Lock()
+	e.announceQueue = append(e.announceQueue, qa)
+	err := e.persistAnnounceQueue(ctx)
+	e.queueMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	e.triggerFlush()
+	return nil
+}
+
+// announceOrEnqueue announces qa, or queues it if the announcement fails, for the operations that
+// already committed the metadata it announces. The check of qa is added once it is announced.
+func (e *Engine) announceOrEnqueue(ctx context.Context, qa queuedAnnounce) error {
+	err := e.announceOn(ctx, qa.Cid, qa.ExtraData, qa.Topic)
+	if err == nil {
+		if !qa.SkipCheck {
+			e.addQueuedCheck(ctx, qa)
+		}
+		return nil
+	}
+	logger.Warnw("Failed to announce metadata, queue it to announce once connectivity returns", "cid", qa.Cid, "err", err)
+	return e.enqueueAnnounce(ctx, qa)
+}
+
+func (e *Engine) triggerFlush() {
+	select {
+	case e.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+// FlushAnnounceQueue announces the queued metadatas in order. It stops at the first failure,
+// leaving the rest queued.
+func (e *Engine) FlushAnnounceQueue(ctx context.Context) error {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	return e.flushAnnounceQueue(ctx)
+}
+
+func (e *Engine) flushAnnounceQueue(ctx context.Context) error {
+	if e.publisher == nil {
+		return nil
+	}
+	for {
+		e.queueMutex.Lock()
+		if len(e.announceQueue) == 0 {
+			e.queueMutex.Unlock()
+			return nil
+		}
+		qa := e.announceQueue[0]
+		e.queueMutex.Unlock()
+
+		if err := e.announceOn(ctx, qa.Cid, qa.ExtraData, qa.Topic); err != nil {
+			logger.Warnw("Failed to flush queued announcement, retry later", "cid", qa.Cid, "err", err)
+			e.historyAnnounceFailed(ctx, qa.Cid, err)
+			return err
+		}
+		logger.Infow("Announced queued metadata", "cid", qa.Cid, "chain", qa.Chain)
+		if qa.Chain != DefaultChain {
+			// recover the root cid, others may sync by cid.Undef.
+			if err := e.setRoot(ctx, e.getLatestMeta(ctx)); err != nil {
+				logger.Warnw("Failed to set root back to latest metadata", "err", err)
+			}
+		}
+		if !qa.SkipCheck {
+			e.addQueuedCheck(ctx, qa)
+		}
+
+		e.queueMutex.Lock()
+		e.announceQueue = e.announceQueue[1:]
+		err := e.persistAnnounceQueue(ctx)
+		e.queueMutex.Unlock()
+		if err != nil {
+			logger.Errorw("Failed to persist announce queue", "err", err)
+			return err
+		}
+	}
+}
+
+// addQueuedCheck adds the announced metadata of qa to the check list of its chain.
+func (e *Engine) addQueuedCheck(ctx context.Context, qa queuedAnnounce) {
+	cr := e.cr
+	if qa.Chain != DefaultChain {
+		ch, err := e.Chain(ctx, qa.Chain)
+		if err != nil {
+			logger.Errorw("Failed to open chain of queued announcement", "chain", qa.Chain, "err", err)
+			return
+		}
+		cr = ch.cr
+	}
+	if err := cr.addCheck(qa.Cid); err != nil {
+		logger.Errorf("failed to add cid: %s to check list, err: %v", qa.Cid.String(), err)
+	}
+}
+
+// runAnnounceQueue flushes the queue periodically and whenever a new connection is established,
+// until the engine is shut down.
+func (e *Engine) runAnnounceQueue() {
+	defer close(e.queueDone)
+
+	notifee := &network.NotifyBundle{
+		ConnectedF: func(_ network.Network, _ network.Conn) {
+			e.triggerFlush()
+		},
+	}
+	e.h.Network().Notify(notifee)
+	defer e.h.Network().StopNotify(notifee)
+
+	ticker := e.clock.NewTicker(e.announceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.closing:
+			return
+		case <-ticker.Chan():
+		case <-e.flushCh:
+		}
+		if !e.hasQueuedAnnounces() {
+			continue
+		}
+		_ = e.FlushAnnounceQueue(context.Background())
+	}
+}
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"io"
+	"time"
+)
+
+var (
+	dsAuditLogKey     = datastore.NewKey("sync/auditLog")
+	dsAuditLogHeadKey = datastore.NewKey("sync/meta/auditLogHead")
+)
+
+// AuditOp is the kind of operation recorded in the audit log.
+type AuditOp string
+
+const (
+	// AuditPublish records a metadata stored as the head of a chain.
+	AuditPublish AuditOp = "publish"
+	// AuditAnnounce records the first announcement of a metadata.
+	AuditAnnounce AuditOp = "announce"
+	// AuditRepublish records the announcements of a metadata already announced, e.g. by the
+	// check list or the periodic republish.
+	AuditRepublish AuditOp = "republish"
+	// AuditRollback records the head of a chain reset to an earlier metadata by Rollback.
+	AuditRollback AuditOp = "rollback"
+	// AuditImport records a metadata of another instance adopted by ImportChain, oldest first.
+	AuditImport AuditOp = "import"
+	// AuditFreeze records the freeze of the publishes by Freeze, with the head of the default
+	// chain at that time.
+	AuditFreeze AuditOp = "freeze"
+	// AuditUnfreeze records the end of a freeze by Unfreeze, with the head of the default chain.
+	AuditUnfreeze AuditOp = "unfreeze"
+)
+
+// AuditLogEntry is an entry of the audit log. Every entry includes the hash of the previous one,
+// so that the log can not be altered without breaking the chain of hashes.
+type AuditLogEntry struct {
+	// Seq is the position of the entry in the log, from 0.
+	Seq  uint64
+	Time time.Time
+	Op   AuditOp
+	Cid  cid.Cid
+	// Chain is the named chain of the metadata, empty for the default chain.
+	Chain string `json:",omitempty"`
+	// Prev is the hash of the previous entry, empty for the first one.
+	Prev string
+	// Hash is the hex-encoded sha256 of the entry, see auditHash.
+	Hash string
+}
+
+// auditHash returns the hash of the fields of entry other than Hash.
+func auditHash(entry *AuditLogEntry) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n%s\n%s\n%s", entry.Seq, entry.Time.UTC().Format(time.RFC3339Nano),
+		entry.Op, entry.Cid, entry.Chain, entry.Prev)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditLogHead is the last entry of the audit log, kept apart from the entries to detect a
+// truncated log.
+type auditLogHead struct {
+	Seq  uint64
+	Hash string
+}
+
+// AuditLogVerification is the result of a successful VerifyAuditLog.
+type AuditLogVerification struct {
+	// Entries is the number of entries verified.
+	Entries int
+	// Head is the hash of the last entry, empty if the log is empty.
+	Head string
+}
+
+func (e *Engine) auditLogDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsAuditLogKey)
+}
+
+func auditLogKey(seq uint64) datastore.Key {
+	// keys sort by sequence.
+	return datastore.NewKey(fmt.Sprintf("%020d", seq))
+}
+
+// appendAuditLog appends the op on c to the audit log, if it is enabled with WithAuditLog.
+// Failures are only logged, so that they do not fail the operations.
+func (e *Engine) appendAuditLog(ctx context.Context, op AuditOp, c cid.Cid, chain string) {
+	if !e.auditLog {
+		return
+	}
+	e.auditMutex.Lock()
+	defer e.auditMutex.Unlock()
+	head, err := e.getAuditLogHead(ctx)
+	if err != nil {
+		logger.Warnw("Failed to read audit log head", "err", err)
+		return
+	}
+	entry := AuditLogEntry{Time: time.Now().UTC(), Op: op, Cid: c, Chain: chain}
+	if head != nil {
+		entry.Seq = head.Seq + 1
+		entry.Prev = head.Hash
+	}
+	entry.Hash = auditHash(&entry)
+	b, err := json.Marshal(&entry)
+	if err != nil {
+		logger.Warnw("Failed to encode audit log entry", "op", op, "cid", c, "err", err)
+		return
+	}
+	if err = e.auditLogDs().Put(ctx, auditLogKey(entry.Seq), b); err != nil {
+		logger.Warnw("Failed to append to audit log", "op", op, "cid", c, "err", err)
+		return
+	}
+	if b, err = json.Marshal(&auditLogHead{Seq: entry.Seq, Hash: entry.Hash}); err == nil {
+		err = e.ds.Put(ctx, dsAuditLogHeadKey, b)
+	}
+	if err != nil {
+		logger.Warnw("Failed to update audit log head", "op", op, "cid", c, "err", err)
+	}
+}
+
+// getAuditLogHead returns the last entry of the audit log, nil if it is empty.
+func (e *Engine) getAuditLogHead(ctx context.Context) (*auditLogHead, error) {
+	b, err := e.ds.Get(ctx, dsAuditLogHeadKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var head auditLogHead
+	if err = json.Unmarshal(b, &head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// forEachAuditEntry calls f with the entries of the audit log, oldest first, until it fails.
+func (e *Engine) forEachAuditEntry(ctx context.Context, f func(entry *AuditLogEntry) error) error {
+	res, err := e.auditLogDs().Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var entry AuditLogEntry
+		if err = json.Unmarshal(r.Value, &entry); err != nil {
+			return fmt.Errorf("%w: invalid entry %s: %v", ErrAuditLogTampered, r.Key, err)
+		}
+		if err = f(&entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyAuditLog checks that every entry of the audit log hashes to its hash and includes the
+// hash of the previous entry, and that the log ends with the last entry appended. It fails with
+// ErrAuditLogTampered at the first entry that does not, e.g. if entries were altered, removed or
+// reordered.
+func (e *Engine) VerifyAuditLog(ctx context.Context) (*AuditLogVerification, error) {
+	if !e.auditLog {
+		return nil, ErrAuditLogDisabled
+	}
+	e.auditMutex.Lock()
+	defer e.auditMutex.Unlock()
+	var v AuditLogVerification
+	var prev string
+	err := e.forEachAuditEntry(ctx, func(entry *AuditLogEntry) error {
+		if entry.Seq != uint64(v.Entries) {
+			return fmt.Errorf("%w: entry %d found at position %d", ErrAuditLogTampered, entry.Seq, v.Entries)
+		}
+		if entry.Prev != prev {
+			return fmt.Errorf("%w: entry %d does not follow the previous entry", ErrAuditLogTampered, entry.Seq)
+		}
+		if auditHash(entry) != entry.Hash {
+			return fmt.Errorf("%w: entry %d does not match its hash", ErrAuditLogTampered, entry.Seq)
+		}
+		prev = entry.Hash
+		v.Entries++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	head, err := e.getAuditLogHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil && v.Entries != 0 || head != nil && (head.Seq+1 != uint64(v.Entries) || head.Hash != prev) {
+		return nil, fmt.Errorf("%w: log does not end with the last entry appended", ErrAuditLogTampered)
+	}
+	v.Head = prev
+	return &v, nil
+}
+
+// ExportAuditLog writes the entries of the audit log to w as json lines, oldest first, so that
+// they can be archived and verified out of the engine.
+// See: VerifyAuditLog.
+func (e *Engine) ExportAuditLog(ctx context.Context, w io.Writer) error {
+	if !e.auditLog {
+		return ErrAuditLogDisabled
+	}
+	enc := json.NewEncoder(w)
+	return e.forEachAuditEntry(ctx, func(entry *AuditLogEntry) error {
+		return enc.Encode(entry)
+	})
+}
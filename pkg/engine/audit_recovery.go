@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"time"
+)
+
+// AuditLogRecovery is the local chain state rebuilt from the audit log.
+type AuditLogRecovery struct {
+	// Head is the recovered latest metadata, undefined if the log has no publish.
+	Head cid.Cid
+	// Pushed is the length of the recovered pushed cid list.
+	Pushed int
+	// Checks is the number of cids put back on the check list.
+	Checks int
+	// Missing are the published cids whose metadata does not resolve to a block, left out of the
+	// recovered state.
+	Missing []cid.Cid `json:",omitempty"`
+}
+
+// RecoverFromAuditLog rebuilds the latest metadata, the pushed cid list and the check list of
+// the default chain by replaying the publishes of the audit log, e.g. when their datastore keys
+// are lost or corrupted. The log must verify, otherwise nothing is changed.
+//
+// The recovered metadatas must resolve to a block if they are persisted after being sent, the
+// ones that do not are reported as missing and left out. Otherwise the metadatas whose block is
+// deleted are included in Pando already, only the others are checked again. The publishes made
+// before the audit log was enabled can not be recovered.
+// See: WithAuditLogRecovery, WithPersistAfterSend.
+func (e *Engine) RecoverFromAuditLog(ctx context.Context) (*AuditLogRecovery, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	rec, err := e.recoverFromAuditLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if e.publisher != nil && rec.Head.Defined() {
+		if err = e.setRoot(ctx, rec.Head); err != nil {
+			return nil, fmt.Errorf("failed to set recovered head as root: %w", err)
+		}
+	}
+	return rec, nil
+}
+
+func (e *Engine) recoverFromAuditLog(ctx context.Context) (*AuditLogRecovery, error) {
+	if _, err := e.VerifyAuditLog(ctx); err != nil {
+		return nil, fmt.Errorf("failed to verify audit log: %w", err)
+	}
+	var published []cid.Cid
+	seen := make(map[cid.Cid]struct{})
+	err := e.forEachAuditEntry(ctx, func(entry *AuditLogEntry) error {
+		if entry.Chain != "" {
+			return nil
+		}
+		if entry.Op == AuditRollback {
+			// drop the publishes rolled back.
+			for i := len(published) - 1; i >= 0 && !published[i].Equals(entry.Cid); i-- {
+				delete(seen, published[i])
+				published = published[:i]
+			}
+			return nil
+		}
+		if entry.Op != AuditPublish && entry.Op != AuditImport {
+			return nil
+		}
+		if _, ok := seen[entry.Cid]; !ok {
+			seen[entry.Cid] = struct{}{}
+			published = append(published, entry.Cid)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &AuditLogRecovery{}
+	list := make([]cid.Cid, 0, len(published))
+	var checks []cid.Cid
+	for _, c := range published {
+		if _, err := e.loadMetadata(ctx, c); err != nil {
+			if e.PersistAfterSend {
+				logger.Warnw("Recovered metadata does not resolve to a block", "cid", c, "err", err)
+				rec.Missing = append(rec.Missing, c)
+				continue
+			}
+			// included in Pando and deleted.
+			list = append(list, c)
+			continue
+		}
+		list = append(list, c)
+		if entry := e.historyEntry(ctx, c); entry == nil || entry.IncludedAt.IsZero() {
+			checks = append(checks, c)
+		}
+	}
+
+	if len(list) != 0 {
+		rec.Head = list[len(list)-1]
+		if err = e.updateLatestMeta(ctx, rec.Head); err != nil {
+			return nil, err
+		}
+		if err = e.updatePushedList(ctx, list); err != nil {
+			return nil, err
+		}
+	}
+	rec.Pushed = len(list)
+
+	e.cr.checkMutex.Lock()
+	now := time.Now()
+	for _, c := range checks {
+		if _, ok := e.cr.checkMap[c.String()]; ok {
+			continue
+		}
+		e.cr.checkMap[c.String()] = &syncStatus{PublishedAt: now, publishTime: now}
+		rec.Checks++
+	}
+	e.cr.checkMutex.Unlock()
+	if err = e.cr.persistCheckList(ctx); err != nil {
+		return nil, err
+	}
+	e.cr.updatePendingMetrics()
+	logger.Infow("Recovered local chain state from audit log", "head", rec.Head, "pushed", rec.Pushed,
+		"checks", rec.Checks, "missing", len(rec.Missing))
+	return rec, nil
+}
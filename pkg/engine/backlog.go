@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BacklogError is returned by the publishes applied backpressure to once the pending inclusion
+// checks of all the chains reach the backlog limit.
+type BacklogError struct {
+	Pending int
+	Limit   int
+	// Waited is how long the publish waited for the backlog to drain.
+	Waited time.Duration
+}
+
+func (e *BacklogError) Error() string {
+	return fmt.Sprintf("%s: %d inclusion checks are pending, at most %d", ErrBacklog, e.Pending, e.Limit)
+}
+
+// Is makes BacklogError match ErrBacklog.
+func (e *BacklogError) Is(target error) bool {
+	return target == ErrBacklog
+}
+
+// pendingChecks returns the number of pending inclusion checks of all the chains.
+func (e *Engine) pendingChecks() int {
+	count := 0
+	for _, cr := range e.checkRegistries() {
+		n, _ := cr.pending()
+		count += n
+	}
+	return count
+}
+
+// backlogChange returns a channel closed on the next change of the pending checks.
+func (e *Engine) backlogChange() <-chan struct{} {
+	e.backlogMutex.Lock()
+	defer e.backlogMutex.Unlock()
+	if e.backlogChanged == nil {
+		e.backlogChanged = make(chan struct{})
+	}
+	return e.backlogChanged
+}
+
+// signalBacklog wakes up the publishes waiting for the backlog to drain.
+func (e *Engine) signalBacklog() {
+	e.backlogMutex.Lock()
+	defer e.backlogMutex.Unlock()
+	if e.backlogChanged != nil {
+		close(e.backlogChanged)
+		e.backlogChanged = nil
+	}
+}
+
+// awaitBacklog applies backpressure to a publish adding an inclusion check: while the pending
+// checks are at the backlog limit, it waits up to the backlog wait for them to fall below it and
+// then fails with a *BacklogError.
+func (e *Engine) awaitBacklog(ctx context.Context, opts *publishOptions) error {
+	if e.backlogLimit <= 0 || e.publisher == nil || opts.skipCheck {
+		return nil
+	}
+	var timer <-chan time.Time
+	start := e.clock.Now()
+	for {
+		// subscribe before counting not to miss a change in between.
+		changed := e.backlogChange()
+		pending := e.pendingChecks()
+		if pending < e.backlogLimit {
+			return nil
+		}
+		if e.backlogWait <= 0 {
+			return &BacklogError{Pending: pending, Limit: e.backlogLimit}
+		}
+		if timer == nil {
+			t := e.clock.NewTimer(e.backlogWait)
+			defer t.Stop()
+			timer = t.Chan()
+			logger.Infow("Wait for the inclusion check backlog to drain", "pending", pending, "limit", e.backlogLimit)
+		}
+		select {
+		case <-changed:
+		case <-timer:
+			return &BacklogError{Pending: e.pendingChecks(), Limit: e.backlogLimit, Waited: e.clock.Now().Sub(start)}
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", &BacklogError{Pending: pending, Limit: e.backlogLimit, Waited: e.clock.Now().Sub(start)}, ctx.Err())
+		case <-e.closing:
+			return &BacklogError{Pending: pending, Limit: e.backlogLimit, Waited: e.clock.Now().Sub(start)}
+		}
+	}
+}
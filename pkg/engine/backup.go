@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+)
+
+// BackupStatus is the Filecoin backup status of a published metadata. Pando backs up its
+// snapshots rather than single metadatas, so a metadata is backed up with the snapshot it
+// landed in.
+type BackupStatus struct {
+	Cid cid.Cid
+	// InSnapshot tells whether the metadata is in a snapshot yet, SnapshotCid and SnapshotHeight
+	// are the snapshot if so.
+	InSnapshot     bool
+	SnapshotCid    cid.Cid
+	SnapshotHeight uint64
+	// BackedUp tells whether the snapshot is sent to Filecoin.
+	BackedUp bool
+	// Sealed tells whether a deal of the snapshot is sealed, DealID and Miner are the first
+	// sealed one if so.
+	Sealed bool
+	DealID uint64 `json:",omitempty"`
+	Miner  string `json:",omitempty"`
+	// Deals are all the deals of the snapshot.
+	Deals []BackupDeal `json:",omitempty"`
+}
+
+// BackupStatus queries Pando for whether the published metadata c is backed up to Filecoin,
+// and in which deal it is sealed. The snapshot of c is taken from the synced snapshots if known,
+// it is queried from Pando otherwise.
+func (e *Engine) BackupStatus(ctx context.Context, c cid.Cid) (*BackupStatus, error) {
+	status := &BackupStatus{Cid: c}
+	si, err := e.syncedSnapshotOf(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if si != nil {
+		status.SnapshotCid, status.SnapshotHeight = si.SnapshotCid, si.Height
+	} else {
+		inclusion, err := e.GetInclusion(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !inclusion.InPando {
+			return nil, fmt.Errorf("%w: %s", ErrNotIncluded, c)
+		}
+		if !inclusion.InSnapShot {
+			return status, nil
+		}
+		status.SnapshotCid, status.SnapshotHeight = inclusion.SnapShotID, inclusion.SnapShotHeight
+	}
+	status.InSnapshot = true
+
+	backup, err := e.pandoAPI.SnapshotBackup(ctx, status.SnapshotCid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup of snapshot %s: %w", status.SnapshotCid, err)
+	}
+	status.BackedUp = backup.IsBackup
+	status.Deals = backup.Deals
+	for _, deal := range backup.Deals {
+		if deal.Sealed {
+			status.Sealed, status.DealID, status.Miner = true, deal.DealID, deal.Miner
+			break
+		}
+	}
+	return status, nil
+}
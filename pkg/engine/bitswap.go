@@ -0,0 +1,397 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"time"
+)
+
+const (
+	// BitswapProtocolID is the latest Bitswap protocol served, the older ones are served too.
+	BitswapProtocolID = protocol.ID("/ipfs/bitswap/1.2.0")
+
+	bitswapProtocol110 = protocol.ID("/ipfs/bitswap/1.1.0")
+	bitswapProtocol100 = protocol.ID("/ipfs/bitswap/1.0.0")
+	bitswapProtocol    = protocol.ID("/ipfs/bitswap")
+
+	// maxBitswapMessageSize is the largest message read, like go-bitswap.
+	maxBitswapMessageSize = 4 << 20
+	// bitswapResponseSize is the size after which the blocks answered are split into several
+	// messages.
+	bitswapResponseSize = 1 << 20
+	// maxBitswapWants is the number of wants answered per message, the others are ignored.
+	maxBitswapWants     = 1024
+	bitswapWriteTimeout = time.Minute
+)
+
+// bitswapProtocols are the protocols the server is registered on, preferred first when it
+// sends responses.
+var bitswapProtocols = []protocol.ID{BitswapProtocolID, bitswapProtocol110, bitswapProtocol100, bitswapProtocol}
+
+type (
+	bitswapEntry struct {
+		Cid          cid.Cid
+		Priority     int32
+		Cancel       bool
+		WantHave     bool
+		SendDontHave bool
+	}
+
+	bitswapBlock struct {
+		Cid  cid.Cid
+		Data []byte
+	}
+
+	bitswapPresence struct {
+		Cid  cid.Cid
+		Have bool
+	}
+
+	// bitswapMessage is the subset of the Bitswap message used by the server: wants are
+	// answered with blocks and presences, the pending bytes are not sent.
+	bitswapMessage struct {
+		Wantlist  []bitswapEntry
+		Full      bool
+		Blocks    []bitswapBlock
+		Presences []bitswapPresence
+	}
+)
+
+// startBitswap serves the blocks of the link system to Bitswap peers.
+func (e *Engine) startBitswap() {
+	for _, p := range bitswapProtocols {
+		e.h.SetStreamHandler(p, e.handleBitswapStream)
+	}
+	logger.Infow("Serving blocks over bitswap", "protocol", BitswapProtocolID)
+}
+
+func (e *Engine) stopBitswap() {
+	for _, p := range bitswapProtocols {
+		e.h.RemoveStreamHandler(p)
+	}
+}
+
+// handleBitswapStream reads the messages of a peer until it closes the stream. As in Bitswap,
+// the answers are sent on a stream opened by the server.
+func (e *Engine) handleBitswapStream(s network.Stream) {
+	defer s.Close()
+	p := s.Conn().RemotePeer()
+	r := bufio.NewReader(s)
+	for {
+		msg, err := readBitswapMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				logger.Debugw("Failed to read bitswap message", "peer", p, "err", err)
+				_ = s.Reset()
+			}
+			return
+		}
+		if err = e.answerWants(context.Background(), p, msg.Wantlist); err != nil {
+			logger.Warnw("Failed to answer bitswap wants", "peer", p, "err", err)
+		}
+	}
+}
+
+// answerWants sends the blocks wanted by p and, for the want-have entries, whether they are
+// stored. Missing blocks are only reported to peers asking for it with send-dont-have.
+func (e *Engine) answerWants(ctx context.Context, p peer.ID, wants []bitswapEntry) error {
+	if len(wants) > maxBitswapWants {
+		wants = wants[:maxBitswapWants]
+	}
+	var msgs []*bitswapMessage
+	msg, size := &bitswapMessage{}, 0
+	for _, w := range wants {
+		if w.Cancel {
+			continue
+		}
+		data, err := e.loadBlock(ctx, w.Cid)
+		if err != nil {
+			if w.SendDontHave {
+				msg.Presences = append(msg.Presences, bitswapPresence{Cid: w.Cid})
+			}
+			continue
+		}
+		if w.WantHave {
+			msg.Presences = append(msg.Presences, bitswapPresence{Cid: w.Cid, Have: true})
+			continue
+		}
+		if size > 0 && size+len(data) > bitswapResponseSize {
+			msgs = append(msgs, msg)
+			msg, size = &bitswapMessage{}, 0
+		}
+		msg.Blocks = append(msg.Blocks, bitswapBlock{Cid: w.Cid, Data: data})
+		size += len(data)
+	}
+	if len(msg.Blocks) > 0 || len(msg.Presences) > 0 {
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	s, err := e.h.NewStream(ctx, p, bitswapProtocols...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	_ = s.SetWriteDeadline(time.Now().Add(bitswapWriteTimeout))
+	w := bufio.NewWriter(s)
+	for _, m := range msgs {
+		if err = writeBitswapMessage(w, s.Protocol(), m); err != nil {
+			_ = s.Reset()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		_ = s.Reset()
+		return err
+	}
+	logger.Debugw("Answered bitswap wants", "peer", p, "wants", len(wants))
+	return nil
+}
+
+// loadBlock returns the block c from the link system, checking that it matches c.
+func (e *Engine) loadBlock(ctx context.Context, c cid.Cid) ([]byte, error) {
+	r, err := e.lsys.StorageReadOpener(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c})
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("stored block does not match %s", c)
+	}
+	return data, nil
+}
+
+func readBitswapMessage(r *bufio.Reader) (*bitswapMessage, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBitswapMessageSize {
+		return nil, fmt.Errorf("bitswap message of %d bytes is too large", size)
+	}
+	b := make([]byte, size)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return unmarshalBitswapMessage(b)
+}
+
+func writeBitswapMessage(w io.Writer, proto protocol.ID, msg *bitswapMessage) error {
+	b := msg.marshal(proto)
+	if _, err := w.Write(protowire.AppendVarint(nil, uint64(len(b)))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// marshal encodes msg for proto: blocks are sent with their cid prefix since 1.1.0, and the
+// presences are only sent with 1.2.0.
+func (msg *bitswapMessage) marshal(proto protocol.ID) []byte {
+	var b []byte
+	if len(msg.Wantlist) > 0 || msg.Full {
+		var wl []byte
+		for _, w := range msg.Wantlist {
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, w.Cid.Bytes())
+			entry = appendVarintField(entry, 2, uint64(w.Priority))
+			entry = appendVarintField(entry, 3, protowire.EncodeBool(w.Cancel))
+			entry = appendVarintField(entry, 4, protowire.EncodeBool(w.WantHave))
+			entry = appendVarintField(entry, 5, protowire.EncodeBool(w.SendDontHave))
+			wl = protowire.AppendTag(wl, 1, protowire.BytesType)
+			wl = protowire.AppendBytes(wl, entry)
+		}
+		wl = appendVarintField(wl, 2, protowire.EncodeBool(msg.Full))
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, wl)
+	}
+	legacy := proto == bitswapProtocol100 || proto == bitswapProtocol
+	for _, blk := range msg.Blocks {
+		if legacy {
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			b = protowire.AppendBytes(b, blk.Data)
+			continue
+		}
+		var block []byte
+		block = protowire.AppendTag(block, 1, protowire.BytesType)
+		block = protowire.AppendBytes(block, blk.Cid.Prefix().Bytes())
+		block = protowire.AppendTag(block, 2, protowire.BytesType)
+		block = protowire.AppendBytes(block, blk.Data)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, block)
+	}
+	if proto == BitswapProtocolID {
+		for _, p := range msg.Presences {
+			var presence []byte
+			presence = protowire.AppendTag(presence, 1, protowire.BytesType)
+			presence = protowire.AppendBytes(presence, p.Cid.Bytes())
+			presence = appendVarintField(presence, 2, protowire.EncodeBool(!p.Have))
+			b = protowire.AppendTag(b, 4, protowire.BytesType)
+			b = protowire.AppendBytes(b, presence)
+		}
+	}
+	return b
+}
+
+// appendVarintField appends the field num, unless v is the default value it is omitted for.
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func unmarshalBitswapMessage(b []byte) (*bitswapMessage, error) {
+	msg := &bitswapMessage{}
+	err := walkProtoFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			return walkProtoFields(v, func(num protowire.Number, v []byte, x uint64) error {
+				switch num {
+				case 1:
+					entry, err := unmarshalBitswapEntry(v)
+					if err != nil {
+						return err
+					}
+					msg.Wantlist = append(msg.Wantlist, entry)
+				case 2:
+					msg.Full = protowire.DecodeBool(x)
+				}
+				return nil
+			})
+		case 2:
+			// blocks of 1.0.0 are sha2-256 CIDv0 ones.
+			mh, err := multihash.Sum(v, multihash.SHA2_256, -1)
+			if err != nil {
+				return err
+			}
+			msg.Blocks = append(msg.Blocks, bitswapBlock{Cid: cid.NewCidV0(mh), Data: v})
+		case 3:
+			var prefix, data []byte
+			err := walkProtoFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+				switch num {
+				case 1:
+					prefix = v
+				case 2:
+					data = v
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p, err := cid.PrefixFromBytes(prefix)
+			if err != nil {
+				return err
+			}
+			c, err := p.Sum(data)
+			if err != nil {
+				return err
+			}
+			msg.Blocks = append(msg.Blocks, bitswapBlock{Cid: c, Data: data})
+		case 4:
+			presence := bitswapPresence{Have: true}
+			err := walkProtoFields(v, func(num protowire.Number, v []byte, x uint64) error {
+				switch num {
+				case 1:
+					c, err := cid.Cast(v)
+					if err != nil {
+						return err
+					}
+					presence.Cid = c
+				case 2:
+					presence.Have = x == 0
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			msg.Presences = append(msg.Presences, presence)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid bitswap message: %w", err)
+	}
+	return msg, nil
+}
+
+func unmarshalBitswapEntry(b []byte) (bitswapEntry, error) {
+	var entry bitswapEntry
+	err := walkProtoFields(b, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			c, err := cid.Cast(v)
+			if err != nil {
+				return err
+			}
+			entry.Cid = c
+		case 2:
+			entry.Priority = int32(x)
+		case 3:
+			entry.Cancel = protowire.DecodeBool(x)
+		case 4:
+			entry.WantHave = x == 1
+		case 5:
+			entry.SendDontHave = protowire.DecodeBool(x)
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// walkProtoFields calls fn with every field of the protobuf message b: v is the value of the
+// length-delimited fields and x the one of the varint fields. Other fields are skipped.
+func walkProtoFields(b []byte, fn func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType && typ != protowire.VarintType {
+			continue
+		}
+		if err := fn(num, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
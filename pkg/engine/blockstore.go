@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"pandoClient/pkg/metrics"
+)
+
+// defaultBlockCacheSize is the number of blocks kept in memory by the block cache.
+const defaultBlockCacheSize = 1024
+
+// Blockstore stores the blocks of the link system of the engine, apart from its other state:
+// the latest metadata, the check list, the address book and so on stay in the datastore of the
+// engine.
+// Get returns datastore.ErrNotFound if the block is not stored. The data returned by Get must
+// not be modified, nor the data passed to Put once it returns.
+// See: WithBlockstore, NewDsBlockstore.
+type Blockstore interface {
+	Get(ctx context.Context, c cid.Cid) ([]byte, error)
+	Has(ctx context.Context, c cid.Cid) (bool, error)
+	Put(ctx context.Context, c cid.Cid, data []byte) error
+	Delete(ctx context.Context, c cid.Cid) error
+}
+
+// dsBlockstore stores the blocks in a datastore, keyed by their cid.
+type dsBlockstore struct {
+	ds datastore.Datastore
+}
+
+// NewDsBlockstore returns a Blockstore storing the blocks in ds under their cid, which is the
+// layout of the blocks in the engine datastore.
+func NewDsBlockstore(ds datastore.Datastore) Blockstore {
+	return &dsBlockstore{ds: ds}
+}
+
+func (b *dsBlockstore) Get(ctx context.Context, c cid.Cid) ([]byte, error) {
+	return b.ds.Get(ctx, datastore.NewKey(c.String()))
+}
+
+func (b *dsBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	return b.ds.Has(ctx, datastore.NewKey(c.String()))
+}
+
+func (b *dsBlockstore) Put(ctx context.Context, c cid.Cid, data []byte) error {
+	return b.ds.Put(ctx, datastore.NewKey(c.String()), data)
+}
+
+func (b *dsBlockstore) Delete(ctx context.Context, c cid.Cid) error {
+	return b.ds.Delete(ctx, datastore.NewKey(c.String()))
+}
+
+// cachedBlockstore keeps the recently stored and loaded blocks of a Blockstore in memory, so
+// that the chain head and the other hot blocks are not read from disk on every load. Blocks are
+// content addressed, a cached block never goes stale.
+type cachedBlockstore struct {
+	Blockstore
+	cache *lru.ARCCache
+}
+
+// NewCachedBlockstore wraps bs with an ARC cache of size blocks.
+func NewCachedBlockstore(bs Blockstore, size int) (Blockstore, error) {
+	cache, err := lru.NewARC(size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block cache: %w", err)
+	}
+	return &cachedBlockstore{Blockstore: bs, cache: cache}, nil
+}
+
+func (b *cachedBlockstore) Get(ctx context.Context, c cid.Cid) ([]byte, error) {
+	if v, ok := b.cache.Get(c); ok {
+		metrics.BlockCacheHits.Inc()
+		return v.([]byte), nil
+	}
+	metrics.BlockCacheMisses.Inc()
+	data, err := b.Blockstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	b.cache.Add(c, data)
+	return data, nil
+}
+
+func (b *cachedBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if b.cache.Contains(c) {
+		return true, nil
+	}
+	return b.Blockstore.Has(ctx, c)
+}
+
+func (b *cachedBlockstore) Put(ctx context.Context, c cid.Cid, data []byte) error {
+	if err := b.Blockstore.Put(ctx, c, data); err != nil {
+		return err
+	}
+	b.cache.Add(c, data)
+	return nil
+}
+
+func (b *cachedBlockstore) Delete(ctx context.Context, c cid.Cid) error {
+	b.cache.Remove(c)
+	return b.Blockstore.Delete(ctx, c)
+}
+
+// newBlockstore returns the blockstore of the engine: the one set by WithBlockstore or the
+// engine datastore, behind the block cache unless it is disabled.
+func (o *options) newBlockstore() (Blockstore, error) {
+	bs := o.blockstore
+	if bs == nil {
+		bs = NewDsBlockstore(o.ds)
+	}
+	if o.blockCacheSize <= 0 {
+		return bs, nil
+	}
+	return NewCachedBlockstore(bs, o.blockCacheSize)
+}
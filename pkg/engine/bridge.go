@@ -0,0 +1,389 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/filecoin-project/go-legs"
+	"github.com/filecoin-project/go-legs/p2p/protocol/head"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/multiformats/go-multiaddr"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBridgeSyncInterval = time.Minute
+	// DefaultIndexProviderTopic is the topic index-provider publishes its advertisements on.
+	DefaultIndexProviderTopic = "/indexer/ingest/mainnet"
+	// BridgePayloadType is the Type of the payloads of the metadatas notarizing advertisements.
+	BridgePayloadType = "index-provider-advertisement"
+	// BridgeLabelKey is the key of the label of the metadatas notarizing advertisements, its
+	// value is the peer ID of the index-provider.
+	BridgeLabelKey = "bridge"
+)
+
+var dsBridgesKey = datastore.NewKey("sync/bridges")
+
+// advertisementFields are the fields of the index-provider advertisements notarized, besides
+// their cid. The links are notarized as cid strings, so that Pando does not sync the advertisement
+// chain and its entries along with the metadatas.
+var advertisementFields = []string{"Provider", "Addresses", "Entries", "ContextID", "Metadata", "IsRm", "Signature"}
+
+// BridgeSpec describes the advertisement chain of an index-provider notarized in Pando.
+type BridgeSpec struct {
+	// Provider is the peer ID the index-provider publishes its advertisements with.
+	Provider string
+	// Addr is the multiaddr of the publisher of the advertisements, an http one for httpsync or a
+	// libp2p one, empty if the address is already known by the host.
+	Addr string
+	// Topic is the topic of the libp2p publisher, DefaultIndexProviderTopic if empty. It is
+	// not used with httpsync.
+	Topic string
+}
+
+// BridgeStatus is the state of a bridge.
+type BridgeStatus struct {
+	BridgeSpec
+	// Head is the latest advertisement notarized, cid.Undef if none is notarized yet, and Meta
+	// the metadata notarizing it.
+	Head cid.Cid
+	Meta cid.Cid
+	// Bridged is the number of advertisements notarized.
+	Bridged int
+}
+
+// Bridge keeps the advertisement chain of an index-provider notarized in Pando: every new
+// advertisement is published, oldest first, as a metadata whose payload holds the cid and the
+// fields of the advertisement, so that storage providers running index-provider notarize the
+// same data with one component.
+type Bridge struct {
+	e        *Engine
+	provider peer.ID
+	addr     multiaddr.Multiaddr
+	topic    string
+	status   BridgeStatus
+	mutex    sync.RWMutex
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+func (e *Engine) bridgesDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsBridgesKey)
+}
+
+// StartBridge starts notarizing the advertisement chain of spec.Provider: the chain is synced
+// right away, then every bridge sync interval. Only the advertisements are synced, not their
+// entries. The bridge is persisted with its state and resumed by Start until StopBridge is
+// called.
+// See: WithBridgeSyncInterval.
+func (e *Engine) StartBridge(ctx context.Context, spec BridgeSpec) (*Bridge, error) {
+	if e.follower == nil {
+		return nil, ErrNotStarted
+	}
+	b, err := e.startBridge(BridgeStatus{BridgeSpec: spec})
+	if err != nil {
+		return nil, err
+	}
+	if err = b.persist(ctx); err != nil {
+		e.removeBridge(b.provider)
+		b.close()
+		return nil, fmt.Errorf("failed to persist bridge: %w", err)
+	}
+	return b, nil
+}
+
+func (e *Engine) startBridge(status BridgeStatus) (*Bridge, error) {
+	provider, err := peer.Decode(status.Provider)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bridged provider: %w", err)
+	}
+	b := &Bridge{
+		e:        e,
+		provider: provider,
+		topic:    status.Topic,
+		status:   status,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if b.topic == "" {
+		b.topic = DefaultIndexProviderTopic
+	}
+	if status.Addr != "" {
+		if b.addr, err = multiaddr.NewMultiaddr(status.Addr); err != nil {
+			return nil, fmt.Errorf("invalid address of bridged provider: %w", err)
+		}
+	}
+
+	e.bridgeMutex.Lock()
+	defer e.bridgeMutex.Unlock()
+	if _, ok := e.bridges[provider]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyBridged, provider)
+	}
+	e.bridges[provider] = b
+	go b.run()
+	logger.Infow("Bridging index-provider", "provider", provider, "head", status.Head)
+	return b, nil
+}
+
+// StopBridge stops notarizing the advertisements of provider and no longer resumes it. The
+// metadatas published are kept.
+func (e *Engine) StopBridge(ctx context.Context, provider peer.ID) error {
+	b := e.removeBridge(provider)
+	if b == nil {
+		return fmt.Errorf("%w: %s", ErrNotBridged, provider)
+	}
+	b.close()
+	return e.bridgesDs().Delete(ctx, datastore.NewKey(provider.String()))
+}
+
+// Bridges returns the status of the running bridges.
+func (e *Engine) Bridges() []BridgeStatus {
+	e.bridgeMutex.Lock()
+	defer e.bridgeMutex.Unlock()
+	statuses := make([]BridgeStatus, 0, len(e.bridges))
+	for _, b := range e.bridges {
+		statuses = append(statuses, b.Status())
+	}
+	return statuses
+}
+
+func (e *Engine) removeBridge(provider peer.ID) *Bridge {
+	e.bridgeMutex.Lock()
+	defer e.bridgeMutex.Unlock()
+	b, ok := e.bridges[provider]
+	if !ok {
+		return nil
+	}
+	delete(e.bridges, provider)
+	return b
+}
+
+// resumeBridges restarts the bridges persisted by StartBridge from their latest notarized
+// advertisement.
+func (e *Engine) resumeBridges(ctx context.Context) error {
+	res, err := e.bridgesDs().Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var status BridgeStatus
+		if err = json.Unmarshal(r.Value, &status); err != nil {
+			return err
+		}
+		if _, err = e.startBridge(status); err != nil {
+			logger.Errorw("Failed to resume bridge", "provider", status.Provider, "err", err)
+		}
+	}
+	return nil
+}
+
+// closeBridges stops the running bridges on shutdown, they are resumed on the next Start.
+func (e *Engine) closeBridges() {
+	e.bridgeMutex.Lock()
+	bridges := e.bridges
+	e.bridges = make(map[peer.ID]*Bridge)
+	e.bridgeMutex.Unlock()
+	for _, b := range bridges {
+		b.close()
+	}
+}
+
+// Status returns the state of the bridge.
+func (b *Bridge) Status() BridgeStatus {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.status
+}
+
+func (b *Bridge) persist(ctx context.Context) error {
+	data, err := json.Marshal(b.Status())
+	if err != nil {
+		return err
+	}
+	return b.e.bridgesDs().Put(ctx, datastore.NewKey(b.provider.String()), data)
+}
+
+func (b *Bridge) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.e.bridgeInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-b.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err := b.sync(ctx)
+		cancel()
+		if err != nil {
+			logger.Warnw("Failed to bridge advertisements", "provider", b.provider, "err", err)
+		}
+		select {
+		case <-b.closing:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync syncs the advertisements published since the latest notarized one and notarizes them,
+// oldest first. The state is persisted after each of them, so that a failed sync resumes from
+// the last one notarized.
+func (b *Bridge) sync(ctx context.Context) error {
+	adHead, err := b.fetchHead(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get head of advertisements: %w", err)
+	}
+	last := b.Status().Head
+	if !adHead.Defined() || adHead.Equals(last) {
+		return nil
+	}
+
+	var stop ipld.Link
+	if last.Defined() {
+		stop = cidlink.Link{Cid: last}
+	}
+	ssb := selectorbuilder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	sel := legs.ExploreRecursiveWithStop(selector.RecursionLimitNone(), ssb.ExploreFields(func(efsb selectorbuilder.ExploreFieldsSpecBuilder) {
+		efsb.Insert("PreviousID", ssb.ExploreRecursiveEdge())
+	}), stop)
+	err = b.e.syncRetry.Do(ctx, func(ctx context.Context) error {
+		_, err := b.e.follower.sub.Sync(ctx, b.provider, adHead, sel, b.addr)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync advertisements: %w", err)
+	}
+
+	// walk back to the latest notarized advertisement, the whole chain if it is not on it.
+	var ads []cid.Cid
+	nodes := make(map[cid.Cid]datamodel.Node)
+	for c := adHead; c.Defined() && !c.Equals(last); {
+		n, err := b.e.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, basicnode.Prototype.Any)
+		if err != nil {
+			return fmt.Errorf("failed to load advertisement %s: %w", c, err)
+		}
+		ads = append(ads, c)
+		nodes[c] = n
+		prev, err := n.LookupByString("PreviousID")
+		if err != nil || prev.IsNull() {
+			break
+		}
+		lnk, err := prev.AsLink()
+		if err != nil {
+			return fmt.Errorf("invalid previous advertisement of %s: %w", c, err)
+		}
+		c = lnk.(cidlink.Link).Cid
+	}
+	for i := len(ads) - 1; i >= 0; i-- {
+		if err = b.notarize(ctx, ads[i], nodes[ads[i]]); err != nil {
+			return err
+		}
+	}
+	logger.Infow("Bridged advertisements", "provider", b.provider, "head", adHead, "bridged", len(ads))
+	return nil
+}
+
+// fetchHead returns the head of the advertisement chain, from the signed head of httpsync
+// publishers or the head protocol of the topic of libp2p ones.
+func (b *Bridge) fetchHead(ctx context.Context) (cid.Cid, error) {
+	if b.addr != nil && isHTTPAddr(b.addr) {
+		signed, err := b.e.FetchSignedHead(ctx, b.addr, b.provider)
+		if err != nil {
+			return cid.Undef, err
+		}
+		return signed.Head, nil
+	}
+	if b.addr != nil {
+		b.e.h.Peerstore().AddAddr(b.provider, b.addr, peerstore.TempAddrTTL)
+	}
+	return head.QueryRootCid(ctx, b.e.h, b.topic, b.provider)
+}
+
+// notarize publishes the metadata of the advertisement ad of cid c.
+func (b *Bridge) notarize(ctx context.Context, c cid.Cid, ad datamodel.Node) error {
+	payload, err := advertisementPayload(c, ad)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err = dagcbor.Encode(payload, &buf); err != nil {
+		return fmt.Errorf("failed to encode payload of advertisement %s: %w", c, err)
+	}
+	meta, err := b.e.PublishCborData(ctx, buf.Bytes(), WithLabels(BridgeLabelKey+"="+b.provider.String()))
+	if err != nil {
+		return fmt.Errorf("failed to publish advertisement %s: %w", c, err)
+	}
+	b.mutex.Lock()
+	b.status.Head = c
+	b.status.Meta = meta
+	b.status.Bridged++
+	b.mutex.Unlock()
+	if err = b.persist(ctx); err != nil {
+		logger.Warnw("Failed to persist bridge state", "provider", b.provider, "err", err)
+	}
+	return nil
+}
+
+// advertisementPayload returns the payload notarizing the advertisement ad of cid c:
+// {Type: BridgePayloadType, Advertisement: cid, ...advertisementFields}.
+func advertisementPayload(c cid.Cid, ad datamodel.Node) (datamodel.Node, error) {
+	if ad.Kind() != datamodel.Kind_Map {
+		return nil, fmt.Errorf("advertisement %s is not a map", c)
+	}
+	if _, err := ad.LookupByString("Provider"); err != nil {
+		return nil, fmt.Errorf("advertisement %s has no provider: %w", c, err)
+	}
+	return qp.BuildMap(basicnode.Prototype.Map, int64(len(advertisementFields)+2), func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Type", qp.String(BridgePayloadType))
+		qp.MapEntry(ma, "Advertisement", qp.String(c.String()))
+		for _, field := range advertisementFields {
+			v, err := ad.LookupByString(field)
+			if err != nil || v.IsNull() {
+				continue
+			}
+			if lnk, err := v.AsLink(); err == nil {
+				qp.MapEntry(ma, field, qp.String(lnk.(cidlink.Link).Cid.String()))
+				continue
+			}
+			qp.MapEntry(ma, field, qp.Node(v))
+		}
+	})
+}
+
+// isHTTPAddr tells whether addr is the address of an httpsync publisher.
+func isHTTPAddr(addr multiaddr.Multiaddr) bool {
+	for _, p := range addr.Protocols() {
+		if p.Code == multiaddr.P_HTTP || p.Code == multiaddr.P_HTTPS {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bridge) close() {
+	close(b.closing)
+	<-b.done
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"io"
+	"sync"
+)
+
+// SyncToCAR syncs the chain of provider from its latest metadata known by Pando, up to depth
+// metadatas, and streams the synced blocks into w as a CARv1 archive rooted at the head. The
+// blocks are written as they are fetched, nothing is stored by the engine.
+//
+// If the sync is stopped by its limits, the blocks written until then still make a valid archive
+// and the *SyncLimitError is returned. On other errors the content of w is undefined.
+// See: SyncInto.
+func (e *Engine) SyncToCAR(ctx context.Context, provider string, depth int, w io.Writer, o ...SyncOption) error {
+	head, err := e.pandoAPI.ProviderHead(ctx, provider)
+	if err != nil {
+		return fmt.Errorf("failed to get the head of provider %s: %w", provider, err)
+	}
+	cw, err := newCarWriter(w, head)
+	if err != nil {
+		return err
+	}
+	synced, err := e.SyncInto(ctx, cw.linkSystem(), head.String(), depth, "", o...)
+	if err != nil {
+		return err
+	}
+	logger.Infow("Synced provider to CAR", "provider", provider, "head", head, "blocks", len(synced))
+	return nil
+}
+
+// carWriter writes blocks to a CARv1 stream, each block once.
+type carWriter struct {
+	w       io.Writer
+	mutex   sync.Mutex
+	written map[cid.Cid]struct{}
+}
+
+// newCarWriter writes the CARv1 header with roots to w.
+func newCarWriter(w io.Writer, roots ...cid.Cid) (*carWriter, error) {
+	header, err := qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "roots", qp.List(int64(len(roots)), func(la datamodel.ListAssembler) {
+			for _, c := range roots {
+				qp.ListEntry(la, qp.Link(cidlink.Link{Cid: c}))
+			}
+		}))
+		qp.MapEntry(ma, "version", qp.Int(1))
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = dagcbor.Encode(header, buf); err != nil {
+		return nil, fmt.Errorf("failed to encode CAR header: %w", err)
+	}
+	cw := &carWriter{w: w, written: make(map[cid.Cid]struct{})}
+	if err = cw.writeSection(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// writeSection writes data prefixed with its length.
+func (cw *carWriter) writeSection(data ...[]byte) error {
+	size := 0
+	for _, d := range data {
+		size += len(d)
+	}
+	prefix := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(prefix, uint64(size))
+	if _, err := cw.w.Write(prefix[:n]); err != nil {
+		return err
+	}
+	for _, d := range data {
+		if _, err := cw.w.Write(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *carWriter) writeBlock(c cid.Cid, data []byte) error {
+	cw.mutex.Lock()
+	defer cw.mutex.Unlock()
+	if _, ok := cw.written[c]; ok {
+		return nil
+	}
+	if err := cw.writeSection(c.Bytes(), data); err != nil {
+		return fmt.Errorf("failed to write block %s to CAR: %w", c, err)
+	}
+	cw.written[c] = struct{}{}
+	return nil
+}
+
+// linkSystem returns a link system writing the stored blocks to the CAR stream. Nothing can be
+// loaded back from it.
+func (cw *carWriter) linkSystem() ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(ipld.LinkContext, ipld.Link) (io.Reader, error) {
+		return nil, datastore.ErrNotFound
+	}
+	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			return cw.writeBlock(lnk.(cidlink.Link).Cid, buf.Bytes())
+		}, nil
+	}
+	return lsys
+}
+
+// maxCarSectionSize bounds the size of the sections read from CAR streams, well above the size
+// of the blocks produced by the engine.
+const maxCarSectionSize = 8 << 20
+
+// readCar reads the CARv1 stream r and returns its roots and its blocks, each verified against
+// the hash of its cid.
+func readCar(r io.Reader) ([]cid.Cid, map[cid.Cid][]byte, error) {
+	br := bufio.NewReader(r)
+	header, err := readCarSection(br)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CAR header: %w", err)
+	}
+	nb := basicnode.Prototype.Map.NewBuilder()
+	if err = dagcbor.Decode(nb, bytes.NewReader(header)); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode CAR header: %w", err)
+	}
+	n := nb.Build()
+	if v, err := n.LookupByString("version"); err != nil {
+		return nil, nil, fmt.Errorf("invalid CAR header: %w", err)
+	} else if version, err := v.AsInt(); err != nil || version != 1 {
+		return nil, nil, fmt.Errorf("unsupported CAR version, only CARv1 is supported")
+	}
+	rootsNode, err := n.LookupByString("roots")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CAR header: %w", err)
+	}
+	var roots []cid.Cid
+	for it := rootsNode.ListIterator(); it != nil && !it.Done(); {
+		_, v, err := it.Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CAR roots: %w", err)
+		}
+		lnk, err := v.AsLink()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CAR roots: %w", err)
+		}
+		roots = append(roots, lnk.(cidlink.Link).Cid)
+	}
+
+	blocks := make(map[cid.Cid][]byte)
+	for {
+		section, err := readCarSection(br)
+		if err == io.EOF {
+			return roots, blocks, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CAR block: %w", err)
+		}
+		size, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cid of CAR block: %w", err)
+		}
+		data := section[size:]
+		sum, err := c.Prefix().Sum(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to hash CAR block %s: %w", c, err)
+		}
+		if !sum.Equals(c) {
+			return nil, nil, fmt.Errorf("CAR block does not match its cid %s", c)
+		}
+		blocks[c] = data
+	}
+}
+
+// readCarSection reads a section prefixed with its length, io.EOF is returned at the end of r.
+func readCarSection(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || size > maxCarSectionSize {
+		return nil, fmt.Errorf("invalid section size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"io"
+	sc "pandoClient/pkg/schema"
+)
+
+// CatFormat is the output format of the payload returned by Cat.
+type CatFormat string
+
+const (
+	// CatRaw returns the bytes of the payload, which must be a bytes node.
+	CatRaw CatFormat = "raw"
+	// CatHex returns the hex encoding of the bytes of the payload.
+	CatHex CatFormat = "hex"
+	// CatBase64 returns the standard base64 encoding of the bytes of the payload.
+	CatBase64 CatFormat = "base64"
+	// CatDagJson returns the dag-json encoding of the payload, whatever its kind.
+	CatDagJson CatFormat = "dag-json"
+	// CatJson returns the payload as indented JSON: the bytes of the payload if they are JSON,
+	// its dag-json encoding otherwise.
+	CatJson CatFormat = "json"
+)
+
+// Cat returns the payload of the metadata c in format, synced from Pando if it is not stored
+// locally. The raw, hex and base64 formats fail with ErrNotBytesPayload if the payload is not a
+// bytes node.
+func (e *Engine) Cat(ctx context.Context, c cid.Cid, format CatFormat) ([]byte, error) {
+	switch format {
+	case CatRaw, CatHex, CatBase64, CatDagJson, CatJson:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCatFormat, format)
+	}
+	meta, err := e.catMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return catPayload(c, meta, format)
+}
+
+// Content is a payload with its content type, see CatContent.
+type Content struct {
+	// ContentType is the MIME type of Data.
+	ContentType string
+	Data        []byte
+}
+
+const (
+	contentTypeBytes = "application/octet-stream"
+	contentTypeJson  = "application/json"
+)
+
+// CatContent returns the payload of the metadata c with its content type, synced from Pando if it
+// is not stored locally. The content type recorded in the v2 envelope of the payload picks the
+// decoding: the bytes of a bytes payload are returned as is with the recorded type, any other
+// payload is returned as its dag-json encoding, with the recorded type if any. Without recorded
+// content type, bytes are application/octet-stream and the other payloads application/json.
+// See: WithContentType.
+func (e *Engine) CatContent(ctx context.Context, c cid.Cid) (*Content, error) {
+	meta, err := e.catMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return catContent(meta)
+}
+
+// CatContentLocal is CatContent for the metadatas stored locally, see CatLocal.
+func (e *Engine) CatContentLocal(ctx context.Context, c cid.Cid) (*Content, error) {
+	meta, err := e.localMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return catContent(meta)
+}
+
+func catContent(meta *schema.Metadata) (*Content, error) {
+	p, err := sc.DecodeMetaPayload(meta)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := p.Data.AsBytes(); err == nil {
+		return &Content{ContentType: contentTypeOr(p.ContentType, contentTypeBytes), Data: b}, nil
+	}
+	buf := bytes.Buffer{}
+	if err = dagjson.Encode(p.Data, &buf); err != nil {
+		return nil, err
+	}
+	return &Content{ContentType: contentTypeOr(p.ContentType, contentTypeJson), Data: buf.Bytes()}, nil
+}
+
+func contentTypeOr(contentType, defaultType string) string {
+	if contentType == "" {
+		return defaultType
+	}
+	return contentType
+}
+
+// CatStream streams the payload of the metadata c, synced from Pando if it is not stored
+// locally. Like CatCid, a bytes payload is streamed as is and any other one as its dag-json
+// encoding, except a link to a file stored by PublishDirectory: its content is streamed instead,
+// loading its chunks one at a time as they are read, so that large files are not held in memory.
+// The reader must be closed once done.
+func (e *Engine) CatStream(ctx context.Context, c cid.Cid) (io.ReadCloser, error) {
+	meta, err := e.catMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	data, err := payloadData(meta)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := data.AsBytes(); err == nil {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	if lnk, err := data.AsLink(); err == nil {
+		r, err := e.openFile(ctx, lnk)
+		if err == nil {
+			return r, nil
+		}
+		if !errors.Is(err, errNotFileNode) {
+			return nil, err
+		}
+	}
+	buf := bytes.Buffer{}
+	if err = dagjson.Encode(data, &buf); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+// CatLocal is Cat for the metadatas stored locally: nothing is synced from Pando, and the
+// metadatas not stored fail with ResourceNotFound.
+func (e *Engine) CatLocal(ctx context.Context, c cid.Cid, format CatFormat) ([]byte, error) {
+	switch format {
+	case CatRaw, CatHex, CatBase64, CatDagJson, CatJson:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCatFormat, format)
+	}
+	meta, err := e.localMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return catPayload(c, meta, format)
+}
+
+// MetadataDagJson returns the dag-json encoding of the metadata c stored locally, whatever the
+// codec it is stored with. The metadatas not stored fail with ResourceNotFound.
+func (e *Engine) MetadataDagJson(ctx context.Context, c cid.Cid) ([]byte, error) {
+	meta, err := e.localMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	n, err := meta.ToNode()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	if err = dagjson.Encode(n, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LocalMetadata returns the metadata c stored locally, without syncing it from Pando. The
+// metadatas not stored fail with ResourceNotFound.
+func (e *Engine) LocalMetadata(ctx context.Context, c cid.Cid) (*schema.Metadata, error) {
+	return e.localMetadata(ctx, c)
+}
+
+func (e *Engine) localMetadata(ctx context.Context, c cid.Cid) (*schema.Metadata, error) {
+	meta, err := e.loadMetadata(ctx, c)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, fmt.Errorf("%w: metadata %s is not stored locally", ResourceNotFound, c)
+	}
+	return meta, err
+}
+
+// payloadData returns the data of the payload of meta, unwrapped from its envelope if it has the
+// v2 schema.
+func payloadData(meta *schema.Metadata) (datamodel.Node, error) {
+	p, err := sc.DecodeMetaPayload(meta)
+	if err != nil {
+		return nil, err
+	}
+	return p.Data, nil
+}
+
+func catPayload(c cid.Cid, meta *schema.Metadata, format CatFormat) ([]byte, error) {
+	data, err := payloadData(meta)
+	if err != nil {
+		return nil, err
+	}
+	b, bytesErr := data.AsBytes()
+	switch format {
+	case CatRaw, CatHex, CatBase64:
+		if bytesErr != nil {
+			return nil, fmt.Errorf("%w: payload of %s is a %s", ErrNotBytesPayload, c, data.Kind())
+		}
+		switch format {
+		case CatHex:
+			return []byte(hex.EncodeToString(b)), nil
+		case CatBase64:
+			return []byte(base64.StdEncoding.EncodeToString(b)), nil
+		}
+		return b, nil
+	}
+
+	if format == CatJson && bytesErr == nil && json.Valid(b) {
+		return indentJson(b)
+	}
+	buf := bytes.Buffer{}
+	if err := dagjson.Encode(data, &buf); err != nil {
+		return nil, err
+	}
+	if format == CatJson {
+		return indentJson(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+func indentJson(b []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
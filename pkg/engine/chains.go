@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	sc "pandoClient/pkg/schema"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// DefaultChain is the name of the chain published by Publish and its variants.
+const DefaultChain = ""
+
+var (
+	dsChainsKey       = datastore.NewKey("sync/chains")
+	dsChainLatestKey  = datastore.NewKey("latest")
+	dsChainPushedKey  = datastore.NewKey("pushed")
+	validChainNameExp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Chain is a named metadata chain maintained by the engine besides its default chain, with its
+// own head, pushed cid list and check list, e.g. to separate deal metadatas from reputation
+// metadatas.
+//
+// Metadatas of named chains are announced with the publisher of the engine, whose root is then
+// set back to the head of the default chain: Pando syncs them from the announced cid.
+type Chain struct {
+	e    *Engine
+	name string
+	ds   datastore.Batching
+	cr   *checkRegistry
+
+	mutex    sync.Mutex
+	head     cid.Cid
+	pushList []cid.Cid
+}
+
+// Chain opens the chain called name, creating it if it was never published to.
+// Names are made of letters, digits, '.', '_' and '-'.
+func (e *Engine) Chain(ctx context.Context, name string) (*Chain, error) {
+	if !validChainNameExp.MatchString(name) {
+		return nil, fmt.Errorf("invalid chain name: %q", name)
+	}
+	e.chainsMutex.Lock()
+	ch, ok := e.chains[name]
+	e.chainsMutex.Unlock()
+	if ok {
+		return ch, nil
+	}
+
+	ch = &Chain{
+		e:    e,
+		name: name,
+		ds:   namespace.Wrap(e.ds, dsChainsKey.ChildString(name)),
+	}
+	if err := ch.load(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load chain %s: %w", name, err)
+	}
+	cr, err := newCheckRegistry(e, ch.ds, e.CheckInterval())
+	if err != nil {
+		return nil, err
+	}
+	cr.chain = name
+	ch.cr = cr
+
+	e.chainsMutex.Lock()
+	if opened, ok := e.chains[name]; ok {
+		e.chainsMutex.Unlock()
+		return opened, nil
+	}
+	e.chains[name] = ch
+	// the interval may have been changed by SetCheckInterval meanwhile.
+	cr.checkInterval = e.checkInterval
+	e.chainsMutex.Unlock()
+	go cr.run()
+	cr.updatePendingMetrics()
+	return ch, nil
+}
+
+// ListChains returns the names of the named chains published to, sorted.
+func (e *Engine) ListChains(ctx context.Context) ([]string, error) {
+	res, err := e.ds.Query(ctx, query.Query{Prefix: dsChainsKey.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	names := make(map[string]struct{})
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		ns := datastore.RawKey(r.Key).Namespaces()
+		if len(ns) > len(dsChainsKey.Namespaces()) {
+			names[ns[len(dsChainsKey.Namespaces())]] = struct{}{}
+		}
+	}
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// PublishToChain publishes data on the chain called chain, the default one if DefaultChain.
+func (e *Engine) PublishToChain(ctx context.Context, chain string, data []byte, o ...PublishOption) (cid.Cid, error) {
+	if chain == DefaultChain {
+		return e.PublishBytesData(ctx, data, o...)
+	}
+	ch, err := e.Chain(ctx, chain)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return ch.PublishBytesData(ctx, data, o...)
+}
+
+// Name returns the name of the chain.
+func (ch *Chain) Name() string {
+	return ch.name
+}
+
+// Head returns the latest metadata of the chain, cid.Undef if nothing is published yet.
+func (ch *Chain) Head() cid.Cid {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	return ch.head
+}
+
+// PushedList returns the metadatas published on the chain, oldest first.
+func (ch *Chain) PushedList() []cid.Cid {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	return append([]cid.Cid(nil), ch.pushList...)
+}
+
+// PublishBytesData publishes data on the chain, linked to its head. The metadata is then
+// announced and added to the check list of the chain. A failed announcement is not queued, the
+// metadata is republished by the check list until Pando includes it.
+//
+// With WithAsyncAnnounce, the announcement is queued with the ones of the default chain instead
+// and the metadata added to the check list once announced.
+func (ch *Chain) PublishBytesData(ctx context.Context, data []byte, o ...PublishOption) (cid.Cid, error) {
+	e := ch.e
+	opts := newPublishOptions(o...)
+	if err := e.validateBytes(data, opts); err != nil {
+		return cid.Undef, err
+	}
+
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	// checked under the mutex of the chain for Freeze to wait for the publishes in progress.
+	if err := e.checkFrozen(); err != nil {
+		return cid.Undef, err
+	}
+	prev := ch.head
+	if opts.hasPrevious {
+		prev = opts.previous
+	}
+	var prevLink datamodel.Link
+	if prev.Defined() {
+		prevLink = cidlink.Link{Cid: prev}
+	}
+	payload, err := e.bytesPayload(ctx, *e.lsys, data, opts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if payload, err = opts.versionedPayload(payload); err != nil {
+		return cid.Undef, err
+	}
+	meta, err := sc.NewMetaWithPayloadNode(payload, e.h.ID(), e.key, prevLink)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return e.wrapPublish(ch.publish)(ctx, *meta, o...)
+}
+
+// publish stores meta as the head of the chain and announces it, ch.mutex must be held.
+func (ch *Chain) publish(ctx context.Context, meta schema.Metadata, o ...PublishOption) (cid.Cid, error) {
+	e := ch.e
+	opts := newPublishOptions(o...)
+	if err := validateLabels(opts); err != nil {
+		return cid.Undef, err
+	}
+	idx := ch.payloadIndex()
+	key, dup := e.duplicate(ctx, idx, meta.Payload, opts)
+	if dup.Defined() {
+		logger.Infow("Payload is already published, skip publishing it again", "chain", ch.name, "metaCid", dup)
+		e.indexLabels(ctx, dup, opts)
+		return dup, nil
+	}
+	if err := e.awaitBacklog(ctx, opts); err != nil {
+		return cid.Undef, err
+	}
+	n, err := meta.ToNode()
+	if err != nil {
+		return cid.Undef, err
+	}
+	lp := opts.linkPrototype(e.linkProto)
+	size, err := e.encodedSize(n, lp)
+	if err != nil {
+		return cid.Undef, err
+	}
+	releaseQuota, err := e.reserveQuota(ctx, size)
+	if err != nil {
+		return cid.Undef, err
+	}
+	lnk, err := e.lsys.Store(ipld.LinkContext{Ctx: ctx}, lp, n)
+	if err != nil {
+		releaseQuota()
+		return cid.Undef, fmt.Errorf("cannot generate metadata link: %s", err)
+	}
+	c := lnk.(cidlink.Link).Cid
+	log := logger.With("chain", ch.name, "metaCid", c)
+	if err := e.persistBlockStats(ctx); err != nil {
+		log.Warnw("Failed to persist block stats", "err", err)
+	}
+	if err := ch.setHead(ctx, c); err != nil {
+		log.Errorw("Failed to update head of chain", "err", err)
+		return cid.Undef, err
+	}
+	e.appendAuditLog(ctx, AuditPublish, c, ch.name)
+	idx.index(ctx, key, c)
+	e.indexLabels(ctx, c, opts)
+	entry := newHistoryEntry(c, ch.name, meta.Payload, opts)
+
+	if e.publisher == nil {
+		e.recordPublish(ctx, entry, NotAnnounced, nil)
+		return c, nil
+	}
+	if opts.async {
+		qa := queuedAnnounce{
+			Cid:       c,
+			ExtraData: e.extraGossipData(opts),
+			Topic:     opts.topic,
+			SkipCheck: opts.skipCheck,
+			Chain:     ch.name,
+		}
+		log.Info("Queue metadata to announce in the background")
+		if err := e.enqueueAnnounce(ctx, qa); err != nil {
+			log.Errorw("Failed to queue metadata announcement", "err", err)
+			e.recordPublish(ctx, entry, AnnounceFailed, err)
+			return cid.Undef, err
+		}
+		e.recordPublish(ctx, entry, AnnounceQueued, nil)
+		return c, nil
+	}
+	if err := e.announceDetached(ctx, c, e.extraGossipData(opts), opts.topic); err != nil {
+		log.Warnw("Failed to announce metadata, it is republished by the check list", "err", err)
+		e.recordPublish(ctx, entry, AnnounceFailed, err)
+	} else {
+		e.recordPublish(ctx, entry, Announced, nil)
+	}
+	if !opts.skipCheck {
+		if err := ch.cr.addCheck(c); err != nil {
+			log.Errorf("failed to add cid: %s to check list, err: %v", c.String(), err)
+			return cid.Undef, err
+		}
+	}
+	return c, nil
+}
+
+func (ch *Chain) setHead(ctx context.Context, c cid.Cid) error {
+	pushList := append(ch.pushList, c)
+	b, err := json.Marshal(pushList)
+	if err != nil {
+		return err
+	}
+	if err = ch.ds.Put(ctx, dsChainPushedKey, b); err != nil {
+		return err
+	}
+	if err = ch.ds.Put(ctx, dsChainLatestKey, c.Bytes()); err != nil {
+		return err
+	}
+	ch.head = c
+	ch.pushList = pushList
+	return nil
+}
+
+func (ch *Chain) load(ctx context.Context) error {
+	b, err := ch.ds.Get(ctx, dsChainLatestKey)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ch.head, err = cid.CidFromBytes(b); err != nil {
+		return err
+	}
+	if b, err = ch.ds.Get(ctx, dsChainPushedKey); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &ch.pushList)
+}
+
+func (e *Engine) checkRegistries() []*checkRegistry {
+	e.chainsMutex.Lock()
+	defer e.chainsMutex.Unlock()
+	registries := make([]*checkRegistry, 0, len(e.chains)+1)
+	if e.cr != nil {
+		registries = append(registries, e.cr)
+	}
+	for _, ch := range e.chains {
+		registries = append(registries, ch.cr)
+	}
+	return registries
+}
+
+// closeChains stops the check lists of the opened chains.
+func (e *Engine) closeChains() {
+	e.chainsMutex.Lock()
+	chains := e.chains
+	e.chains = make(map[string]*Chain)
+	e.chainsMutex.Unlock()
+	for _, ch := range chains {
+		ch.cr.close()
+	}
+}
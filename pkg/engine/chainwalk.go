@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+)
+
+const defaultPrefetchDepth = 8
+
+// WalkFunc is called for every metadata of the chain visited by WalkChain. Returning an error
+// stops the walk and WalkChain returns it. meta is passed as stored, v1 and v2 payloads are
+// decoded alike by schema.DecodeMetaPayload.
+type WalkFunc func(c cid.Cid, meta *schema.Metadata) error
+
+type loadResult struct {
+	meta *schema.Metadata
+	err  error
+}
+
+// prefetcher loads the metadatas the walk is going to visit next concurrently.
+type prefetcher struct {
+	e       *Engine
+	ctx     context.Context
+	pending map[cid.Cid]chan loadResult
+}
+
+func (p *prefetcher) prefetch(c cid.Cid) {
+	if _, ok := p.pending[c]; ok {
+		return
+	}
+	ch := make(chan loadResult, 1)
+	p.pending[c] = ch
+	go func() {
+		meta, err := p.e.loadMetadata(p.ctx, c)
+		ch <- loadResult{meta: meta, err: err}
+	}()
+}
+
+func (p *prefetcher) get(c cid.Cid) (*schema.Metadata, error) {
+	ch, ok := p.pending[c]
+	if !ok {
+		return p.e.loadMetadata(p.ctx, c)
+	}
+	delete(p.pending, c)
+	res := <-ch
+	return res.meta, res.err
+}
+
+func (e *Engine) loadMetadata(ctx context.Context, c cid.Cid) (*schema.Metadata, error) {
+	n, err := e.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, schema.MetadataPrototype)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata %s: %w", c, err)
+	}
+	return schema.UnwrapMetadata(n)
+}
+
+// WalkChain walks the local chain from the metadata from, or from the latest one if from is
+// cid.Undef, to the first one following PreviousID, calling fn for each of them.
+//
+// The locally pushed cid list tells which metadatas come next, so up to the prefetch depth of
+// them are loaded concurrently ahead of the walk. The walk itself always follows PreviousID,
+// a stale list only costs wasted loads.
+// See: WithPrefetchDepth.
+func (e *Engine) WalkChain(ctx context.Context, from cid.Cid, fn WalkFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if !from.Defined() {
+		from = e.getLatestMeta(ctx)
+	}
+	hints := make([]cid.Cid, len(e.pushList))
+	copy(hints, e.pushList)
+	index := make(map[cid.Cid]int, len(hints))
+	for i, c := range hints {
+		index[c] = i
+	}
+	p := &prefetcher{e: e, ctx: ctx, pending: make(map[cid.Cid]chan loadResult)}
+
+	for cur := from; cur.Defined(); {
+		if i, ok := index[cur]; ok {
+			for j := i - 1; j >= 0 && j >= i-e.prefetchDepth; j-- {
+				p.prefetch(hints[j])
+			}
+		}
+		meta, err := p.get(cur)
+		if err != nil {
+			return err
+		}
+		if err = fn(cur, meta); err != nil {
+			return err
+		}
+		if meta.PreviousID == nil {
+			return nil
+		}
+		prev, ok := (*meta.PreviousID).(cidlink.Link)
+		if !ok {
+			return fmt.Errorf("unexpected previous link of metadata %s", cur)
+		}
+		cur = prev.Cid
+	}
+	return nil
+}
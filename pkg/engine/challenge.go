@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"io"
+	"time"
+)
+
+const (
+	// ChallengeProtocolID is the libp2p protocol answering proof-of-possession challenges.
+	ChallengeProtocolID = protocol.ID("/pando-client/challenge/0.0.1")
+
+	challengeStreamTimeout = 10 * time.Second
+	maxChallengeMsgSize    = 4 << 10
+	minChallengeNonceSize  = 16
+	maxChallengeNonceSize  = 256
+
+	challengeSignDomain = "pando-client-challenge:"
+)
+
+type (
+	// ChallengeRequest is a nonce chosen by the challenger.
+	ChallengeRequest struct {
+		Nonce []byte
+	}
+
+	// ChallengeResponse proves that the responder controls the key of PeerID: the nonce,
+	// the head of its chain and the response time are signed with it.
+	ChallengeResponse struct {
+		PeerID    peer.ID
+		PublicKey []byte
+		Nonce     []byte
+		Head      cid.Cid
+		Timestamp int64
+		Signature []byte
+		Error     string `json:",omitempty"`
+	}
+)
+
+// signedBytes returns the payload covered by the signature of the response.
+func (r *ChallengeResponse) signedBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(challengeSignDomain)
+	buf.WriteString(r.PeerID.String())
+	buf.Write(r.Nonce)
+	if r.Head.Defined() {
+		buf.Write(r.Head.Bytes())
+	}
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(r.Timestamp))
+	buf.Write(ts)
+	return buf.Bytes()
+}
+
+// Verify checks that the response answers nonce and is signed by the key of PeerID.
+func (r *ChallengeResponse) Verify(nonce []byte) error {
+	if r.Error != "" {
+		return fmt.Errorf("%w: refused: %s", ErrChallengeFailed, r.Error)
+	}
+	if !bytes.Equal(r.Nonce, nonce) {
+		return fmt.Errorf("%w: response does not answer the nonce", ErrChallengeFailed)
+	}
+	pub, err := peerPublicKey(r.PeerID, r.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrChallengeFailed, err)
+	}
+	ok, err := pub.Verify(r.signedBytes(), r.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: invalid signature of %s", ErrChallengeFailed, r.PeerID)
+	}
+	return nil
+}
+
+// peerPublicKey returns the public key of id, extracted from id or, for the keys such as RSA ones
+// that are not embedded in peer ids, unmarshalled from the key sent along and matched with id.
+func peerPublicKey(id peer.ID, marshalled []byte) (crypto.PubKey, error) {
+	pub, err := id.ExtractPublicKey()
+	if err == nil {
+		return pub, nil
+	}
+	pub, err = crypto.UnmarshalPublicKey(marshalled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key of %s: %w", id, err)
+	}
+	if !id.MatchesPublicKey(pub) {
+		return nil, fmt.Errorf("public key does not match %s", id)
+	}
+	return pub, nil
+}
+
+// answerChallenge signs nonce with the engine key together with the current head.
+func (e *Engine) answerChallenge(ctx context.Context, nonce []byte) (*ChallengeResponse, error) {
+	if len(nonce) < minChallengeNonceSize || len(nonce) > maxChallengeNonceSize {
+		return nil, fmt.Errorf("nonce size must be between %d and %d bytes", minChallengeNonceSize, maxChallengeNonceSize)
+	}
+	res := &ChallengeResponse{
+		PeerID:    e.h.ID(),
+		Nonce:     nonce,
+		Head:      e.getLatestMeta(ctx),
+		Timestamp: time.Now().Unix(),
+	}
+	pub, err := crypto.MarshalPublicKey(e.key.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	res.PublicKey = pub
+	sig, err := e.key.Sign(res.signedBytes())
+	if err != nil {
+		return nil, err
+	}
+	res.Signature = sig
+	return res, nil
+}
+
+func (e *Engine) handleChallengeStream(s network.Stream) {
+	defer s.Close()
+	_ = s.SetDeadline(time.Now().Add(challengeStreamTimeout))
+	log := logger.With("peer", s.Conn().RemotePeer())
+
+	var req ChallengeRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxChallengeMsgSize)).Decode(&req); err != nil {
+		log.Warnw("Failed to read challenge request", "err", err)
+		_ = s.Reset()
+		return
+	}
+	res, err := e.answerChallenge(context.Background(), req.Nonce)
+	if err != nil {
+		log.Warnw("Refused challenge", "err", err)
+		res = &ChallengeResponse{PeerID: e.h.ID(), Error: err.Error()}
+	}
+	if err = json.NewEncoder(s).Encode(res); err != nil {
+		log.Warnw("Failed to write challenge response", "err", err)
+		_ = s.Reset()
+		return
+	}
+	log.Debug("Answered challenge")
+}
+
+// Challenge asks peer p to sign nonce and verifies its response.
+func Challenge(ctx context.Context, h host.Host, p peer.ID, nonce []byte) (*ChallengeResponse, error) {
+	s, err := h.NewStream(ctx, p, ChallengeProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	} else {
+		_ = s.SetDeadline(time.Now().Add(challengeStreamTimeout))
+	}
+
+	if err = json.NewEncoder(s).Encode(ChallengeRequest{Nonce: nonce}); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	if err = s.CloseWrite(); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	var res ChallengeResponse
+	if err = json.NewDecoder(io.LimitReader(s, maxChallengeMsgSize)).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to read challenge response: %w", err)
+	}
+	if res.PeerID != p {
+		return nil, fmt.Errorf("%w: answered by %s, expected %s", ErrChallengeFailed, res.PeerID, p)
+	}
+	if err = res.Verify(nonce); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -3,22 +3,39 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
+	"pandoClient/pkg/metrics"
+	"pandoClient/pkg/pandoapi"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	defaultInclusionCheckWorkers = 8
+	defaultInclusionCheckTimeout = 30 * time.Second
+)
+
 var (
 	dsCheckRegistryKey = datastore.NewKey("sync/meta/checkRegistry")
 	dsCheckCidListKey  = datastore.NewKey("/checkMap")
 )
 
 type syncStatus struct {
-	InPando     bool
-	CheckTimes  int
+	InPando    bool
+	CheckTimes int
+	// PublishedAt is the time of the first publication, kept across republishes and restarts
+	// to measure the inclusion latency. It is zero for checks persisted by older versions.
+	PublishedAt time.Time
+	// LastChecked is the time of the last inclusion query answered by Pando, and Attempts the
+	// number of consecutive ones that found the metadata not included, which back off the next
+	// checks.
+	LastChecked time.Time
+	Attempts    int
 	publishTime time.Time
 }
 
@@ -31,6 +48,15 @@ type checkRegistry struct {
 	maxTimeToRepublish int
 	closing            chan struct{}
 	closeDone          chan struct{}
+	// passMutex serializes the check passes of the run loop and of CheckNow.
+	passMutex sync.Mutex
+	// checkInterval is guarded by checkMutex, its changes are sent to the run loop on intervalCh
+	// to rebuild its ticker.
+	intervalCh chan time.Duration
+	// lastRun is the time of the last periodic check, guarded by checkMutex.
+	lastRun time.Time
+	// chain is the name of the chain checked, empty for the default chain.
+	chain string
 }
 
 func newCheckRegistry(e *Engine, ds datastore.Batching, checkInterval time.Duration) (*checkRegistry, error) {
@@ -40,6 +66,7 @@ func newCheckRegistry(e *Engine, ds datastore.Batching, checkInterval time.Durat
 		e:             e,
 		ds:            childrenDs,
 		checkInterval: checkInterval,
+		intervalCh:    make(chan time.Duration, 1),
 		closing:       make(chan struct{}),
 		closeDone:     make(chan struct{}),
 	}
@@ -53,57 +80,179 @@ func newCheckRegistry(e *Engine, ds datastore.Batching, checkInterval time.Durat
 }
 
 func (cr *checkRegistry) run() {
-	tickerCh := time.NewTicker(cr.checkInterval).C
+	cr.checkMutex.Lock()
+	ticker := cr.e.clock.NewTicker(cr.checkInterval)
+	cr.checkMutex.Unlock()
 	for {
 		select {
 		case _ = <-cr.closing:
 			logger.Infow("quit gracefully...")
+			ticker.Stop()
 			close(cr.closeDone)
 			return
-		case _ = <-tickerCh:
-			// copy check map
-			_checkMap := make(map[string]*syncStatus)
-			cr.checkMutex.Lock()
-			if len(cr.checkMap) == 0 {
-				cr.checkMutex.Unlock()
+		case d := <-cr.intervalCh:
+			ticker.Stop()
+			ticker = cr.e.clock.NewTicker(d)
+		case _ = <-ticker.Chan():
+			if cr.e.CheckerPaused() {
 				continue
 			}
-			for c, s := range cr.checkMap {
-				// copy the ptr
-				_checkMap[c] = s
-			}
-			cr.checkMutex.Unlock()
-			_ = cr.checkSyncStatuses(_checkMap)
-			// todo: checkMap will lose if process is shutdown before first check
-			err := cr.persistCheckList(context.Background())
-			if err != nil {
-				logger.Errorf("failed to persist check list, err: %v", err)
-			}
+			cr.checkPass(false)
 		}
 	}
 }
 
+// checkPass checks the inclusion of the metadatas of the check list that are due, or of all of
+// them if force is set, and returns the number checked. Passes are run one at a time.
+func (cr *checkRegistry) checkPass(force bool) int {
+	cr.passMutex.Lock()
+	defer cr.passMutex.Unlock()
+	// copy check map
+	_checkMap := make(map[string]*syncStatus)
+	cr.checkMutex.Lock()
+	cr.lastRun = cr.e.clock.Now()
+	if len(cr.checkMap) == 0 {
+		cr.checkMutex.Unlock()
+		return 0
+	}
+	now := cr.e.clock.Now()
+	for c, s := range cr.checkMap {
+		if !force && !cr.due(s, now) {
+			continue
+		}
+		// copy the ptr
+		_checkMap[c] = s
+	}
+	cr.checkMutex.Unlock()
+	_ = cr.checkSyncStatuses(_checkMap)
+	// todo: checkMap will lose if process is shutdown before first check
+	err := cr.persistCheckList(context.Background())
+	if err != nil {
+		logger.Errorf("failed to persist check list, err: %v", err)
+	}
+	cr.updatePendingMetrics()
+	return len(_checkMap)
+}
+
+// due reports whether status is checked at now. The checks of a metadata found not included
+// back off exponentially from the check interval, up to maxCheckBackoff.
+func (cr *checkRegistry) due(status *syncStatus, now time.Time) bool {
+	if status.Attempts == 0 || cr.e.maxCheckBackoff <= 0 {
+		return true
+	}
+	backoff := cr.checkInterval
+	for i := 1; i < status.Attempts && backoff < cr.e.maxCheckBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > cr.e.maxCheckBackoff {
+		backoff = cr.e.maxCheckBackoff
+	}
+	// the ticks are not exactly checkInterval apart, tolerate a tenth of it.
+	return !now.Before(status.LastChecked.Add(backoff - cr.checkInterval/10))
+}
+
+// setInterval changes the interval between the periodic checks, taking effect from the next
+// tick of the rebuilt ticker.
+func (cr *checkRegistry) setInterval(d time.Duration) {
+	cr.checkMutex.Lock()
+	cr.checkInterval = d
+	cr.checkMutex.Unlock()
+	// only the last change matters if the run loop has not picked up the previous one.
+	select {
+	case <-cr.intervalCh:
+	default:
+	}
+	cr.intervalCh <- d
+}
+
 func (cr *checkRegistry) addCheck(c cid.Cid) error {
 	cr.checkMutex.Lock()
-	defer cr.checkMutex.Unlock()
 	if _, exist := cr.checkMap[c.String()]; exist {
+		cr.checkMutex.Unlock()
 		return fmt.Errorf("has existed in check map")
 	}
+	now := cr.e.clock.Now()
 	cr.checkMap[c.String()] = &syncStatus{
-		publishTime: time.Now(),
+		PublishedAt: now,
+		publishTime: now,
 	}
+	cr.checkMutex.Unlock()
+	cr.updatePendingMetrics()
 	return nil
 }
 
-func (cr *checkRegistry) checkSyncStatuses(m map[string]*syncStatus) error {
-	for cidStr, status := range m {
-		select {
-		case _ = <-cr.closing:
-			close(cr.closeDone)
-			return nil
-		default:
+// pending returns the number of pending checks and the first publication time of the oldest
+// one, zero if unknown.
+func (cr *checkRegistry) pending() (int, time.Time) {
+	cr.checkMutex.Lock()
+	defer cr.checkMutex.Unlock()
+	var oldest time.Time
+	for _, status := range cr.checkMap {
+		if !status.PublishedAt.IsZero() && (oldest.IsZero() || status.PublishedAt.Before(oldest)) {
+			oldest = status.PublishedAt
 		}
+	}
+	return len(cr.checkMap), oldest
+}
+
+// removeChecks removes cids from the check list and persists it.
+func (cr *checkRegistry) removeChecks(ctx context.Context, cids []cid.Cid) error {
+	cr.checkMutex.Lock()
+	for _, c := range cids {
+		delete(cr.checkMap, c.String())
+	}
+	empty := len(cr.checkMap) == 0
+	cr.checkMutex.Unlock()
+	defer cr.updatePendingMetrics()
+	// persistCheckList keeps the persisted list if the check list is empty.
+	if empty {
+		return cr.ds.Delete(ctx, dsCheckCidListKey)
+	}
+	return cr.persistCheckList(ctx)
+}
+
+// has reports whether c is pending in the check list.
+func (cr *checkRegistry) has(c cid.Cid) bool {
+	cr.checkMutex.Lock()
+	defer cr.checkMutex.Unlock()
+	_, ok := cr.checkMap[c.String()]
+	return ok
+}
 
+func (cr *checkRegistry) lastRunTime() time.Time {
+	cr.checkMutex.Lock()
+	defer cr.checkMutex.Unlock()
+	return cr.lastRun
+}
+
+// updatePendingMetrics exports the number of pending checks of all the chains of the engine and
+// the age of the oldest one.
+func (cr *checkRegistry) updatePendingMetrics() {
+	count, oldest := cr.pending()
+	for _, other := range cr.e.checkRegistries() {
+		if other == cr {
+			continue
+		}
+		n, o := other.pending()
+		count += n
+		if !o.IsZero() && (oldest.IsZero() || o.Before(oldest)) {
+			oldest = o
+		}
+	}
+	metrics.PendingInclusions.Set(float64(count))
+	cr.e.checkBacklog(count)
+	cr.e.signalBacklog()
+	if oldest.IsZero() {
+		metrics.OldestPendingAge.Set(0)
+	} else {
+		metrics.OldestPendingAge.Set(cr.e.clock.Now().Sub(oldest).Seconds())
+	}
+}
+
+func (cr *checkRegistry) checkSyncStatuses(m map[string]*syncStatus) error {
+	cids := make([]cid.Cid, 0, len(m))
+	statuses := make(map[cid.Cid]*syncStatus, len(m))
+	for cidStr, status := range m {
 		c, err := cid.Decode(cidStr)
 		if err != nil {
 			logger.Errorf("invalid cid in checkmap, delete it. err: %v", err)
@@ -112,57 +261,174 @@ func (cr *checkRegistry) checkSyncStatuses(m map[string]*syncStatus) error {
 			cr.checkMutex.Unlock()
 			continue
 		}
-		err = cr.checkSyncStatus(c, status)
-		if err != nil {
-			logger.Errorf("failed to check sync status for cid: %s, err: %v", cidStr, err)
+		cids = append(cids, c)
+		statuses[c] = status
+	}
+	if cr.e.inclusionBatchSize > 0 {
+		cids = cr.checkBatches(cids, statuses)
+	}
+
+	// check the cids left through a pool of workers, so that a slow query does not hold the
+	// others back.
+	workers := cr.e.inclusionCheckWorkers
+	if workers > len(cids) {
+		workers = len(cids)
+	}
+	work := make(chan cid.Cid)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				if err := cr.checkSyncStatus(c, statuses[c]); err != nil {
+					logger.Errorf("failed to check sync status for cid: %s, err: %v", c.String(), err)
+				}
+			}
+		}()
+	}
+feed:
+	for _, c := range cids {
+		// the run loop handles closing.
+		select {
+		case work <- c:
+		case <-cr.closing:
+			break feed
 		}
 	}
+	close(work)
+	wg.Wait()
 
 	return nil
 }
 
-func (cr *checkRegistry) checkSyncStatus(c cid.Cid, status *syncStatus) error {
+// requestContext returns the context of an inclusion query, which times out after
+// inclusionCheckTimeout.
+func (cr *checkRegistry) requestContext() (context.Context, context.CancelFunc) {
+	if cr.e.inclusionCheckTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), cr.e.inclusionCheckTimeout)
+}
+
+// checkBatches checks cids with batched inclusion queries of up to inclusionBatchSize cids. It
+// returns the cids left to check one by one: the ones of the failed batches and the ones missing
+// from the results, or all of them if Pando does not serve batched queries.
+func (cr *checkRegistry) checkBatches(cids []cid.Cid, statuses map[cid.Cid]*syncStatus) []cid.Cid {
+	var fallback []cid.Cid
+	for start := 0; start < len(cids); start += cr.e.inclusionBatchSize {
+		if cr.isClosing() {
+			return nil
+		}
+		end := start + cr.e.inclusionBatchSize
+		if end > len(cids) {
+			end = len(cids)
+		}
+		batch := cids[start:end]
+		ctx, cancel := cr.requestContext()
+		inclusions, err := cr.e.pandoAPI.MetaInclusions(ctx, batch)
+		cancel()
+		if errors.Is(err, pandoapi.ErrBatchUnsupported) {
+			logger.Debugw("batched inclusion queries are not supported by Pando, check cids one by one")
+			return append(fallback, cids[start:]...)
+		}
+		if err != nil {
+			logger.Warnw("failed to check a batch of cids in Pando, check them one by one", "count", len(batch), "err", err)
+			fallback = append(fallback, batch...)
+			continue
+		}
 
-	res, err := handleResError(cr.e.pandoAPIClient.R().Get("/metadata/inclusion?cid=" + c.String()))
+		byCid := make(map[cid.Cid]*MetaInclusion, len(inclusions))
+		for _, inclusion := range inclusions {
+			if inclusion != nil {
+				byCid[inclusion.ID] = inclusion
+			}
+		}
+		for _, c := range batch {
+			inclusion, ok := byCid[c]
+			if !ok {
+				fallback = append(fallback, c)
+				continue
+			}
+			if err = cr.handleInclusion(c, statuses[c], inclusion); err != nil {
+				logger.Errorf("failed to check sync status for cid: %s, err: %v", c.String(), err)
+			}
+		}
+	}
+	return fallback
+}
+
+func (cr *checkRegistry) isClosing() bool {
+	select {
+	case <-cr.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cr *checkRegistry) checkSyncStatus(c cid.Cid, status *syncStatus) error {
+	ctx, cancel := cr.requestContext()
+	defer cancel()
+	inclusion, err := cr.e.pandoAPI.MetaInclusion(ctx, c)
 	if err != nil {
 		logger.Errorf("failed to check status in Pando for cid: %s, err: %v", c, err)
 		return fmt.Errorf("failed to check status in Pando for cid: %s, err: %v", c, err)
 	}
-	resJson := inclusionResJson{}
-	err = json.Unmarshal(res.Body(), &resJson)
-	if err != nil {
-		logger.Errorf("failed to unmarshal the metaInclusion from PandoAPI result: %v", err)
-		return fmt.Errorf("failed to unmarshal the metaInclusion from PandoAPI result: %v", err)
-	}
-	inclusion := resJson.Data
-	if inclusion == nil {
-		logger.Errorf("got http response but unexpected inclusion data: %v", resJson.Data)
-		return fmt.Errorf("got http response but unexpected inclusion data: %v", resJson.Data)
-	}
+	return cr.handleInclusion(c, status, inclusion)
+}
+
+// handleInclusion removes c from the check list if it is included in Pando, or republishes it if
+// it is not included after too many checks.
+func (cr *checkRegistry) handleInclusion(c cid.Cid, status *syncStatus, inclusion *MetaInclusion) error {
 	// if data is stored in Pando, delete it from checkList
 	// todo: if a cid is not stored in Pando after some times check, republish it
 	if inclusion.InPando {
+		if !status.PublishedAt.IsZero() {
+			latency := cr.e.clock.Now().Sub(status.PublishedAt)
+			metrics.InclusionLatency.Observe(latency.Seconds())
+			logger.Debugw("metadata included in Pando", "cid", c.String(), "latency", latency)
+		}
 		cr.checkMutex.Lock()
 		delete(cr.checkMap, c.String())
 		if !cr.e.options.PersistAfterSend {
-			err := cr.e.ds.Delete(context.Background(), datastore.NewKey(c.String()))
+			err := cr.e.bs.Delete(context.Background(), c)
 			if err != nil {
+				cr.checkMutex.Unlock()
 				return err
 			}
 		}
 		cr.checkMutex.Unlock()
+		cr.e.historyIncluded(context.Background(), c)
+		cr.e.cacheInclusion(context.Background(), c, inclusion)
+		cr.e.notifyInclusion(c, inclusion)
 	} else {
-		// option in the copied ptr
-		status.CheckTimes++
-		// republish if arrived max check times or max interval
-		if status.CheckTimes >= cr.maxTimeToRepublish || time.Now().Sub(status.publishTime) > cr.e.options.maxIntervalToRepublish {
+		// the statuses are updated by the check workers while the check list is persisted.
+		cr.checkMutex.Lock()
+		now := cr.e.clock.Now()
+		status.LastChecked = now
+		status.Attempts++
+		dead := cr.e.maxCheckAttempts > 0 && status.Attempts >= cr.e.maxCheckAttempts
+		republish := false
+		if !dead {
+			status.CheckTimes++
+			// republish if arrived max check times or max interval
+			republish = status.CheckTimes >= cr.maxTimeToRepublish || now.Sub(status.publishTime) > cr.e.options.maxIntervalToRepublish
+			if republish {
+				status.CheckTimes = 0
+				status.publishTime = now
+			}
+		}
+		cr.checkMutex.Unlock()
+		if dead {
+			return cr.deadLetter(c, status)
+		}
+		if republish {
 			logger.Infow("updated cid not stored in Pando, republish it....", "cid: ", c.String())
-			err = cr.e.RePublishCid(context.Background(), c)
+			err := cr.e.RePublishCid(context.Background(), c)
 			if err != nil {
 				logger.Errorf("failed to re-publish cid: %s, err: %v", c.String(), err)
 			}
-			status.CheckTimes = 0
-			status.publishTime = time.Now()
 		}
 	}
 
@@ -204,3 +470,80 @@ func (cr *checkRegistry) close() {
 	close(cr.closing)
 	<-cr.closeDone
 }
+
+// SetCheckInterval changes the interval between the inclusion checks of all the chains at
+// runtime, e.g. to check less often while Pando is loaded, rebuilding the tickers of the running
+// check lists. The backoff of the metadatas found not included is computed from the new interval.
+// The interval is not persisted, the configured one applies again after a restart.
+func (e *Engine) SetCheckInterval(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("check interval must be positive, got %s", d)
+	}
+	e.chainsMutex.Lock()
+	e.checkInterval = d
+	e.chainsMutex.Unlock()
+	for _, cr := range e.checkRegistries() {
+		cr.setInterval(d)
+	}
+	logger.Infow("Changed check interval", "interval", d)
+	return nil
+}
+
+// CheckInterval returns the interval between the inclusion checks.
+func (e *Engine) CheckInterval() time.Duration {
+	e.chainsMutex.Lock()
+	defer e.chainsMutex.Unlock()
+	return e.checkInterval
+}
+
+// CheckResult is the outcome of a check pass run by CheckNow.
+type CheckResult struct {
+	// Checked is the number of metadatas whose inclusion was queried, Pending the number of them
+	// still not included afterwards, across all the chains.
+	Checked int
+	Pending int
+}
+
+// PauseChecker stops the periodic inclusion checks of all the chains, e.g. during a maintenance
+// of Pando, until ResumeChecker is called. The metadatas published meanwhile are still added to
+// the check lists, and CheckNow still checks them. The pause is not persisted.
+func (e *Engine) PauseChecker() error {
+	if !atomic.CompareAndSwapInt32(&e.checkerPaused, 0, 1) {
+		return ErrCheckerPaused
+	}
+	logger.Warnw("Inclusion checker is paused")
+	return nil
+}
+
+// ResumeChecker resumes the periodic inclusion checks after PauseChecker, from the next tick.
+// See: CheckNow.
+func (e *Engine) ResumeChecker() error {
+	if !atomic.CompareAndSwapInt32(&e.checkerPaused, 1, 0) {
+		return ErrCheckerNotPaused
+	}
+	logger.Infow("Inclusion checker is resumed")
+	return nil
+}
+
+// CheckerPaused tells whether the periodic inclusion checks are paused.
+func (e *Engine) CheckerPaused() bool {
+	return atomic.LoadInt32(&e.checkerPaused) != 0
+}
+
+// CheckNow checks the inclusion of all the pending metadatas of all the chains right away,
+// ignoring their backoff, e.g. to confirm the backlog once Pando recovers. It runs even while
+// the checker is paused and waits for the periodic passes in progress. It fails only if ctx is
+// done, before the chains left are checked.
+func (e *Engine) CheckNow(ctx context.Context) (*CheckResult, error) {
+	res := &CheckResult{}
+	for _, cr := range e.checkRegistries() {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		res.Checked += cr.checkPass(true)
+		n, _ := cr.pending()
+		res.Pending += n
+	}
+	logger.Infow("Checked inclusions", "checked", res.Checked, "pending", res.Pending)
+	return res, nil
+}
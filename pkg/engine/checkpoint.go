@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const checkpointSignDomain = "pando-client-checkpoint:"
+
+// Checkpoint is a statement of the provider on the state of its default chain at Timestamp,
+// signed with its key so that third parties holding it can verify it offline, e.g. to prove
+// later that a metadata was published before the checkpoint or that the chain was rewritten.
+type Checkpoint struct {
+	PeerID peer.ID
+	// PublicKey is set for the keys such as RSA ones that are not embedded in the peer id.
+	PublicKey []byte `json:",omitempty"`
+	Head      cid.Cid
+	// Length is the number of metadatas pushed on the chain up to Head.
+	Length    int
+	Timestamp int64
+	Signature []byte
+}
+
+// signedBytes returns the payload covered by the signature of the checkpoint.
+func (cp *Checkpoint) signedBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(checkpointSignDomain)
+	buf.WriteString(cp.PeerID.String())
+	if cp.Head.Defined() {
+		buf.Write(cp.Head.Bytes())
+	}
+	n := make([]byte, 16)
+	binary.BigEndian.PutUint64(n, uint64(cp.Length))
+	binary.BigEndian.PutUint64(n[8:], uint64(cp.Timestamp))
+	buf.Write(n)
+	return buf.Bytes()
+}
+
+// ExportCheckpoint returns a checkpoint of the default chain signed with the engine key.
+// See: VerifyCheckpoint.
+func (e *Engine) ExportCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	e.publishMutex.Lock()
+	cp := &Checkpoint{
+		PeerID:    e.h.ID(),
+		Head:      e.getLatestMeta(ctx),
+		Length:    len(e.pushList),
+		Timestamp: e.clock.Now().Unix(),
+	}
+	e.publishMutex.Unlock()
+	if !cp.Head.Defined() {
+		return nil, ErrNoPublishedMetadata
+	}
+	if _, err := cp.PeerID.ExtractPublicKey(); err != nil {
+		pub, err := crypto.MarshalPublicKey(e.key.GetPublic())
+		if err != nil {
+			return nil, err
+		}
+		cp.PublicKey = pub
+	}
+	sig, err := e.key.Sign(cp.signedBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	cp.Signature = sig
+	return cp, nil
+}
+
+// VerifyCheckpoint checks that cp is signed by the key of its peer, which must be provider unless
+// empty, without any access to the provider. Checkpoints that do not verify fail with
+// ErrInvalidCheckpoint.
+func VerifyCheckpoint(cp *Checkpoint, provider peer.ID) error {
+	if provider != "" && cp.PeerID != provider {
+		return fmt.Errorf("%w: signed by %s, expected %s", ErrInvalidCheckpoint, cp.PeerID, provider)
+	}
+	pub, err := peerPublicKey(cp.PeerID, cp.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCheckpoint, err)
+	}
+	ok, err := pub.Verify(cp.signedBytes(), cp.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCheckpoint, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: invalid signature of %s", ErrInvalidCheckpoint, cp.PeerID)
+	}
+	return nil
+}
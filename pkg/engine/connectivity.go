@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/multiformats/go-multiaddr"
+	"pandoClient/pkg/retry"
+	"sync"
+	"time"
+)
+
+const (
+	// pandoProtectTag protects the connections to Pando from the trimming of the connection
+	// manager.
+	pandoProtectTag = "pando"
+
+	defaultPandoRedialBackoff    = time.Second
+	defaultMaxPandoRedialBackoff = 5 * time.Minute
+	// pandoConnectivityCheckInterval is the interval between checks of the connection to Pando,
+	// in case a disconnection notification is missed.
+	pandoConnectivityCheckInterval = time.Minute
+	pandoDialTimeout               = 30 * time.Second
+)
+
+// pandoConnectivity keeps the host connected to Pando: it protects the Pando peer in the
+// connection manager and re-dials it with backoff whenever the connection drops.
+// See: WithPandoConnectivity.
+type pandoConnectivity struct {
+	e       *Engine
+	id      peer.ID
+	backoff retry.Policy
+	// dropped is signaled by the network notifications when the connection drops.
+	dropped chan struct{}
+	done    chan struct{}
+
+	mutex          sync.Mutex
+	redials        int
+	lastConnected  time.Time
+	lastDisconnect time.Time
+	lastDialErr    error
+}
+
+func (e *Engine) newPandoConnectivity() *pandoConnectivity {
+	return &pandoConnectivity{
+		e:  e,
+		id: e.pandoAddrinfo.ID,
+		backoff: retry.Policy{
+			InitialBackoff: e.pandoRedialBackoff,
+			MaxBackoff:     e.maxPandoRedialBackoff,
+			Multiplier:     2,
+		},
+		dropped: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+func (pc *pandoConnectivity) start() {
+	h := pc.e.h
+	h.Peerstore().AddAddrs(pc.id, pc.e.pandoAddrinfo.Addrs, peerstore.PermanentAddrTTL)
+	h.ConnManager().Protect(pc.id, pandoProtectTag)
+	h.Network().Notify(pc)
+	go pc.run()
+}
+
+// close stops re-dialing Pando once the engine is closing.
+func (pc *pandoConnectivity) close() {
+	h := pc.e.h
+	h.Network().StopNotify(pc)
+	h.ConnManager().Unprotect(pc.id, pandoProtectTag)
+	<-pc.done
+}
+
+func (pc *pandoConnectivity) run() {
+	defer close(pc.done)
+	ticker := pc.e.clock.NewTicker(pandoConnectivityCheckInterval)
+	defer ticker.Stop()
+	for {
+		if !pc.connected() && !pc.redial() {
+			return
+		}
+		select {
+		case <-pc.e.closing:
+			return
+		case <-pc.dropped:
+			logger.Warnw("Connection to Pando dropped, re-dialing", "pando", pc.id)
+		case <-ticker.Chan():
+		}
+	}
+}
+
+func (pc *pandoConnectivity) connected() bool {
+	return pc.e.h.Network().Connectedness(pc.id) == network.Connected
+}
+
+// redial dials Pando until connected, waiting longer after every failure up to the max backoff.
+// It returns false if the engine is closing.
+func (pc *pandoConnectivity) redial() bool {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), pandoDialTimeout)
+		err := pc.e.h.Connect(ctx, peer.AddrInfo{ID: pc.id})
+		cancel()
+
+		pc.mutex.Lock()
+		pc.redials++
+		pc.lastDialErr = err
+		pc.mutex.Unlock()
+		if err == nil {
+			logger.Infow("Connected to Pando", "pando", pc.id, "attempts", attempt)
+			return true
+		}
+
+		backoff := pc.backoff.Backoff(attempt)
+		logger.Warnw("Failed to dial Pando", "pando", pc.id, "attempt", attempt, "backoff", backoff, "err", err)
+		timer := pc.e.clock.NewTimer(backoff)
+		select {
+		case <-pc.e.closing:
+			timer.Stop()
+			return false
+		case <-timer.Chan():
+		}
+		if pc.connected() {
+			// Pando dialed back in the meantime.
+			return true
+		}
+	}
+}
+
+// status fills the connectivity details of s.
+func (pc *pandoConnectivity) status(s *PandoStatus) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	s.Protected = pc.e.h.ConnManager().IsProtected(pc.id, pandoProtectTag)
+	s.Redials = pc.redials
+	s.LastConnected = pc.lastConnected
+	s.LastDisconnect = pc.lastDisconnect
+	if pc.lastDialErr != nil {
+		s.LastDialError = pc.lastDialErr.Error()
+	}
+}
+
+// Connected implements network.Notifiee.
+func (pc *pandoConnectivity) Connected(_ network.Network, conn network.Conn) {
+	if conn.RemotePeer() != pc.id {
+		return
+	}
+	pc.mutex.Lock()
+	pc.lastConnected = pc.e.clock.Now()
+	pc.mutex.Unlock()
+}
+
+// Disconnected implements network.Notifiee, it signals the drop of the last connection to Pando.
+func (pc *pandoConnectivity) Disconnected(n network.Network, conn network.Conn) {
+	if conn.RemotePeer() != pc.id || n.Connectedness(pc.id) == network.Connected {
+		return
+	}
+	pc.mutex.Lock()
+	pc.lastDisconnect = pc.e.clock.Now()
+	pc.mutex.Unlock()
+	select {
+	case pc.dropped <- struct{}{}:
+	default:
+	}
+}
+
+// Listen implements network.Notifiee.
+func (pc *pandoConnectivity) Listen(network.Network, multiaddr.Multiaddr) {}
+
+// ListenClose implements network.Notifiee.
+func (pc *pandoConnectivity) ListenClose(network.Network, multiaddr.Multiaddr) {}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channelmonitor"
+	dtimpl "github.com/filecoin-project/go-data-transfer/impl"
+	dtnetwork "github.com/filecoin-project/go-data-transfer/network"
+	gstransport "github.com/filecoin-project/go-data-transfer/transport/graphsync"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-graphsync"
+	gsimpl "github.com/ipfs/go-graphsync/impl"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	"time"
+)
+
+// dataTransferTuning tunes the graphsync and data-transfer instances serving the dtsync
+// publisher and the subscriber. The zero value keeps the instances created by dtsync itself.
+type dataTransferTuning struct {
+	// maxInProgressRequests bounds the graphsync requests in flight, both incoming and
+	// outgoing, zero keeps the graphsync default.
+	maxInProgressRequests uint64
+	restart               channelmonitor.Config
+	tuned                 bool
+}
+
+// defaultRestartConfig is the restart policy dtsync uses for its own data-transfer instances.
+func defaultRestartConfig() channelmonitor.Config {
+	return channelmonitor.Config{
+		AcceptTimeout:          time.Minute,
+		CompleteTimeout:        time.Minute,
+		RestartDebounce:        10 * time.Second,
+		RestartBackoff:         time.Minute,
+		MaxConsecutiveRestarts: 3,
+	}
+}
+
+// newDataTransfer instantiates and starts a data-transfer manager over a new graphsync
+// instance, tuned by e.dtTuning, like dtsync does for its publishers and syncs. The returned
+// function stops them.
+func (e *Engine) newDataTransfer(ds datastore.Batching) (datatransfer.Manager, graphsync.GraphExchange, func() error, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var gsOpts []gsimpl.Option
+	if n := e.dtTuning.maxInProgressRequests; n != 0 {
+		gsOpts = append(gsOpts,
+			gsimpl.MaxInProgressIncomingRequests(n),
+			gsimpl.MaxInProgressOutgoingRequests(n))
+	}
+	gs := gsimpl.New(ctx, gsnet.NewFromLibp2pHost(e.h), *e.lsys, gsOpts...)
+	tp := gstransport.NewTransport(e.h.ID(), gs)
+	dt, err := dtimpl.NewDataTransfer(ds, dtnetwork.NewFromLibp2pHost(e.h), tp,
+		dtimpl.ChannelRestartConfig(e.dtTuning.restart))
+	if err != nil {
+		cancel()
+		return nil, nil, nil, fmt.Errorf("failed to instantiate datatransfer: %w", err)
+	}
+
+	ready := make(chan error, 1)
+	dt.OnReady(func(err error) {
+		ready <- err
+	})
+	if err = dt.Start(ctx); err != nil {
+		cancel()
+		return nil, nil, nil, fmt.Errorf("failed to start datatransfer: %w", err)
+	}
+	if err = <-ready; err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+
+	return dt, gs, func() error {
+		defer cancel()
+		return dt.Stop(context.Background())
+	}, nil
+}
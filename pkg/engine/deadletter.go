@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"sort"
+	"time"
+)
+
+var dsDeadLettersKey = datastore.NewKey("sync/meta/deadLetters")
+
+// DeadLetter is a pushed metadata that Pando did not include after the maximum number of
+// inclusion checks. It is no longer checked nor republished until RetryDeadLetter is called.
+// See: WithMaxCheckAttempts.
+type DeadLetter struct {
+	Cid cid.Cid
+	// Chain is the named chain of the metadata, empty for the default chain.
+	Chain       string `json:",omitempty"`
+	Attempts    int
+	PublishedAt time.Time
+	DeadAt      time.Time
+}
+
+func (e *Engine) deadLettersDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsDeadLettersKey)
+}
+
+// ListDeadLetters returns the metadatas moved to the dead-letter list, oldest first.
+func (e *Engine) ListDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	res, err := e.deadLettersDs().Query(ctx, query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	list := make([]DeadLetter, 0)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var dl DeadLetter
+		if err = json.Unmarshal(r.Value, &dl); err != nil {
+			return nil, err
+		}
+		list = append(list, dl)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DeadAt.Before(list[j].DeadAt)
+	})
+	return list, nil
+}
+
+// RetryDeadLetter republishes the dead-lettered metadata c and checks its inclusion again from
+// scratch.
+func (e *Engine) RetryDeadLetter(ctx context.Context, c cid.Cid) error {
+	dl, err := e.getDeadLetter(ctx, c)
+	if err != nil {
+		return err
+	}
+	cr := e.cr
+	if dl.Chain != "" {
+		ch, err := e.Chain(ctx, dl.Chain)
+		if err != nil {
+			return err
+		}
+		cr = ch.cr
+	}
+	if err = e.RePublishCid(ctx, c); err != nil {
+		return fmt.Errorf("failed to republish %s: %w", c, err)
+	}
+	if err = cr.addCheck(c); err != nil {
+		logger.Warnw("Failed to add retried dead letter to check list", "cid", c, "err", err)
+	}
+	logger.Infow("Retried dead letter", "cid", c)
+	return e.deadLettersDs().Delete(ctx, datastore.NewKey(c.String()))
+}
+
+// DropDeadLetter removes the metadata c from the dead-letter list without retrying it.
+func (e *Engine) DropDeadLetter(ctx context.Context, c cid.Cid) error {
+	if _, err := e.getDeadLetter(ctx, c); err != nil {
+		return err
+	}
+	logger.Infow("Dropped dead letter", "cid", c)
+	return e.deadLettersDs().Delete(ctx, datastore.NewKey(c.String()))
+}
+
+func (e *Engine) getDeadLetter(ctx context.Context, c cid.Cid) (*DeadLetter, error) {
+	b, err := e.deadLettersDs().Get(ctx, datastore.NewKey(c.String()))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNotDeadLettered, c)
+		}
+		return nil, err
+	}
+	var dl DeadLetter
+	err = json.Unmarshal(b, &dl)
+	return &dl, err
+}
+
+// deadLetter moves c from the check list to the dead-letter list.
+func (cr *checkRegistry) deadLetter(c cid.Cid, status *syncStatus) error {
+	dl := DeadLetter{
+		Cid:         c,
+		Chain:       cr.chain,
+		Attempts:    status.Attempts,
+		PublishedAt: status.PublishedAt,
+		DeadAt:      cr.e.clock.Now(),
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	if err = cr.e.deadLettersDs().Put(context.Background(), datastore.NewKey(c.String()), b); err != nil {
+		return err
+	}
+	cr.checkMutex.Lock()
+	delete(cr.checkMap, c.String())
+	empty := len(cr.checkMap) == 0
+	cr.checkMutex.Unlock()
+	// persistCheckList keeps the persisted list if the check list is empty.
+	if empty {
+		if err = cr.ds.Delete(context.Background(), dsCheckCidListKey); err != nil {
+			return err
+		}
+	}
+	logger.Warnw("metadata is not included in Pando after the maximum check attempts, moved to the dead-letter list", "cid", c.String(), "attempts", status.Attempts)
+	cr.e.alertDeadLetter(c, status.Attempts)
+	return nil
+}
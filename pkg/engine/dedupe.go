@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+var (
+	dsPayloadIndexKey      = datastore.NewKey("sync/meta/payloads")
+	dsChainPayloadIndexKey = datastore.NewKey("payloads")
+)
+
+// payloadIndex maps the hashes of the published payloads to the latest metadata publishing them.
+// Payloads are indexed whether dedupe is enabled or not, so that enabling it covers the
+// payloads published before.
+type payloadIndex struct {
+	ds datastore.Batching
+}
+
+func (e *Engine) payloadIndex() payloadIndex {
+	return payloadIndex{ds: namespace.Wrap(e.ds, dsPayloadIndexKey)}
+}
+
+func (ch *Chain) payloadIndex() payloadIndex {
+	return payloadIndex{ds: namespace.Wrap(ch.ds, dsChainPayloadIndexKey)}
+}
+
+// payloadKey returns the index key of payload, the sha2-256 of its dag-json encoding, so that
+// the same payload is matched whatever the codec of its metadata.
+func payloadKey(payload datamodel.Node) (datastore.Key, error) {
+	h := sha256.New()
+	if err := dagjson.Encode(payload, h); err != nil {
+		return datastore.Key{}, err
+	}
+	return datastore.NewKey(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// duplicate returns the metadata already publishing payload if dedupe is enabled and the
+// publish is not forced, cid.Undef otherwise. It also returns the index key of payload, empty if
+// it is not indexed. Index failures are only logged, so that they do not fail publishes.
+func (e *Engine) duplicate(ctx context.Context, idx payloadIndex, payload datamodel.Node, opts *publishOptions) (datastore.Key, cid.Cid) {
+	if payload == nil {
+		return datastore.Key{}, cid.Undef
+	}
+	key, err := payloadKey(payload)
+	if err != nil {
+		logger.Warnw("Failed to hash payload, it is not deduplicated", "err", err)
+		return datastore.Key{}, cid.Undef
+	}
+	if !e.dedupe || opts.force {
+		return key, cid.Undef
+	}
+	c, err := idx.get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrPayloadNotPublished) {
+			logger.Warnw("Failed to look up payload index", "key", key, "err", err)
+		}
+		return key, cid.Undef
+	}
+	return key, c
+}
+
+// get returns the latest metadata publishing the payload of key.
+func (idx payloadIndex) get(ctx context.Context, key datastore.Key) (cid.Cid, error) {
+	b, err := idx.ds.Get(ctx, key)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return cid.Undef, ErrPayloadNotPublished
+		}
+		return cid.Undef, err
+	}
+	_, c, err := cid.CidFromBytes(b)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid payload index entry: %w", err)
+	}
+	return c, nil
+}
+
+// lookup returns the latest metadata publishing payload.
+func (idx payloadIndex) lookup(ctx context.Context, payload datamodel.Node) (cid.Cid, error) {
+	key, err := payloadKey(payload)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return idx.get(ctx, key)
+}
+
+// LookupByPayload returns the latest metadata of the default chain publishing the bytes payload,
+// e.g. to check whether some content is already notarized. It returns ErrPayloadNotPublished if
+// no metadata publishes it.
+func (e *Engine) LookupByPayload(ctx context.Context, payload []byte) (cid.Cid, error) {
+	return e.payloadIndex().lookup(ctx, basicnode.NewBytes(payload))
+}
+
+// LookupByPayload returns the latest metadata of the chain publishing the bytes payload.
+// See: Engine.LookupByPayload.
+func (ch *Chain) LookupByPayload(ctx context.Context, payload []byte) (cid.Cid, error) {
+	return ch.payloadIndex().lookup(ctx, basicnode.NewBytes(payload))
+}
+
+// index records c as the latest metadata publishing the payload of key.
+func (idx payloadIndex) index(ctx context.Context, key datastore.Key, c cid.Cid) {
+	if key == (datastore.Key{}) {
+		return
+	}
+	if err := idx.ds.Put(ctx, key, c.Bytes()); err != nil {
+		logger.Warnw("Failed to index payload", "cid", c, "err", err)
+	}
+}
+
+// unindex removes payload from the index if c is still the latest metadata publishing it.
+func (idx payloadIndex) unindex(ctx context.Context, payload datamodel.Node, c cid.Cid) error {
+	key, err := payloadKey(payload)
+	if err != nil {
+		return err
+	}
+	indexed, err := idx.get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrPayloadNotPublished) {
+			return nil
+		}
+		return err
+	}
+	if !indexed.Equals(c) {
+		return nil
+	}
+	return idx.ds.Delete(ctx, key)
+}
@@ -0,0 +1,271 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	// registers the raw codec of the file chunks.
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"io"
+	"os"
+	sc "pandoClient/pkg/schema"
+	"path/filepath"
+)
+
+// dirChunkSize is the maximum size of the raw blocks files are split into by PublishDirectory.
+const dirChunkSize = 256 << 10
+
+const (
+	dirNodeDirectory = "directory"
+	dirNodeFile      = "file"
+)
+
+// PublishDirectory stores the tree of the directory at path as an IPLD dag and publishes a
+// metadata whose payload links to its root, so that a whole file tree is notarized at once.
+// It returns the cid of the metadata.
+//
+// Every node of the dag is a map with a Type field:
+//   - a directory is {Type: "directory", Entries: {name: link}}, entries sorted by name;
+//   - a file is {Type: "file", Size: size, Chunks: [link]}, its content split into raw blocks
+//     of up to 256KiB.
+//
+// Nodes are encoded like the metadatas and chunks with the raw codec, all hashed with the link
+// hash of the engine. Only directories and regular files are stored, other entries such as
+// symlinks are skipped. The blocks are content addressed, so unchanged files and directories
+// are stored once across publishes.
+func (e *Engine) PublishDirectory(ctx context.Context, path string, o ...PublishOption) (cid.Cid, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if !info.IsDir() {
+		return cid.Undef, fmt.Errorf("%s is not a directory", path)
+	}
+
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	if err = e.checkFrozen(); err != nil {
+		return cid.Undef, err
+	}
+	opts := newPublishOptions(o...)
+	root, err := e.storeDirectory(ctx, path, opts.linkPrototype(e.linkProto))
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to store directory %s: %w", path, err)
+	}
+	meta, err := e.newMetadata(ctx, basicnode.NewLink(root), opts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	c, err := e.publishFn(ctx, *meta, o...)
+	if err != nil {
+		return cid.Undef, err
+	}
+	logger.Infow("Published directory", "path", path, "root", root, "cid", c)
+	return c, nil
+}
+
+func (e *Engine) storeDirectory(ctx context.Context, path string, lp cidlink.LinkPrototype) (ipld.Link, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	type dirEntry struct {
+		name string
+		lnk  ipld.Link
+	}
+	// os.ReadDir sorts the entries by name.
+	stored := make([]dirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		entryPath := filepath.Join(path, entry.Name())
+		var lnk ipld.Link
+		switch {
+		case entry.IsDir():
+			lnk, err = e.storeDirectory(ctx, entryPath, lp)
+		case entry.Type().IsRegular():
+			lnk, err = e.storeFile(ctx, entryPath, lp)
+		default:
+			logger.Warnw("Skipping directory entry that is neither a directory nor a regular file", "path", entryPath)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, dirEntry{name: entry.Name(), lnk: lnk})
+	}
+
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Type", qp.String(dirNodeDirectory))
+		qp.MapEntry(ma, "Entries", qp.Map(int64(len(stored)), func(ma datamodel.MapAssembler) {
+			for _, entry := range stored {
+				qp.MapEntry(ma, entry.name, qp.Link(entry.lnk))
+			}
+		}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.lsys.Store(ipld.LinkContext{Ctx: ctx}, lp, n)
+}
+
+func (e *Engine) storeFile(ctx context.Context, path string, lp cidlink.LinkPrototype) (ipld.Link, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lnk, _, err := storeFileNode(ctx, *e.lsys, f, dirChunkSize, lp)
+	return lnk, err
+}
+
+// storeFileNode splits the content of r into raw blocks of up to chunkSize bytes and stores them
+// in lsys along with the file node linking to them, see PublishDirectory. It returns the link of
+// the file node and the chunking of the content.
+func storeFileNode(ctx context.Context, lsys ipld.LinkSystem, r io.Reader, chunkSize int, lp cidlink.LinkPrototype) (ipld.Link, *sc.Chunking, error) {
+	rawProto := lp
+	rawProto.Codec = cid.Raw
+	var chunks []ipld.Link
+	var size int64
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			lnk, err := lsys.Store(ipld.LinkContext{Ctx: ctx}, rawProto, basicnode.NewBytes(buf[:n]))
+			if err != nil {
+				return nil, nil, err
+			}
+			chunks = append(chunks, lnk)
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 3, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Type", qp.String(dirNodeFile))
+		qp.MapEntry(ma, "Size", qp.Int(size))
+		qp.MapEntry(ma, "Chunks", qp.List(int64(len(chunks)), func(la datamodel.ListAssembler) {
+			for _, lnk := range chunks {
+				qp.ListEntry(la, qp.Link(lnk))
+			}
+		}))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	lnk, err := lsys.Store(ipld.LinkContext{Ctx: ctx}, lp, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lnk, &sc.Chunking{ChunkSize: int64(chunkSize), Chunks: int64(len(chunks)), Size: size}, nil
+}
+
+// errNotFileNode is returned by openFile when the linked node is not a file node.
+var errNotFileNode = errors.New("not a file node")
+
+// fileReader reads the content of a file node, loading its chunks lazily.
+type fileReader struct {
+	ctx    context.Context
+	e      *Engine
+	chunks []ipld.Link
+	size   int64
+	read   int64
+	cur    *bytes.Reader
+	closed bool
+}
+
+// openFile returns a reader of the content of the file node lnk, or errNotFileNode if lnk does
+// not link to a file node.
+func (e *Engine) openFile(ctx context.Context, lnk ipld.Link) (io.ReadCloser, error) {
+	n, err := e.lsys.Load(ipld.LinkContext{Ctx: ctx}, lnk, basicnode.Prototype.Any)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", lnk, err)
+	}
+	if n.Kind() != datamodel.Kind_Map {
+		return nil, errNotFileNode
+	}
+	typ, err := n.LookupByString("Type")
+	if err != nil {
+		return nil, errNotFileNode
+	}
+	if s, err := typ.AsString(); err != nil || s != dirNodeFile {
+		return nil, errNotFileNode
+	}
+	sizeNode, err := n.LookupByString("Size")
+	if err != nil {
+		return nil, fmt.Errorf("invalid file node %s: %w", lnk, err)
+	}
+	size, err := sizeNode.AsInt()
+	if err != nil {
+		return nil, fmt.Errorf("invalid size of file node %s: %w", lnk, err)
+	}
+	chunksNode, err := n.LookupByString("Chunks")
+	if err != nil {
+		return nil, fmt.Errorf("invalid file node %s: %w", lnk, err)
+	}
+	r := &fileReader{ctx: ctx, e: e, size: size}
+	it := chunksNode.ListIterator()
+	if it == nil {
+		return nil, fmt.Errorf("invalid chunks of file node %s", lnk)
+	}
+	for !it.Done() {
+		_, v, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := v.AsLink()
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk of file node %s: %w", lnk, err)
+		}
+		r.chunks = append(r.chunks, chunk)
+	}
+	return r, nil
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	for r.cur == nil || r.cur.Len() == 0 {
+		if len(r.chunks) == 0 {
+			if r.read != r.size {
+				return 0, fmt.Errorf("%w: read %d bytes of a %d bytes file", io.ErrUnexpectedEOF, r.read, r.size)
+			}
+			return 0, io.EOF
+		}
+		n, err := r.e.lsys.Load(ipld.LinkContext{Ctx: r.ctx}, r.chunks[0], basicnode.Prototype.Bytes)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load chunk %s: %w", r.chunks[0], err)
+		}
+		b, err := n.AsBytes()
+		if err != nil {
+			return 0, fmt.Errorf("invalid chunk %s: %w", r.chunks[0], err)
+		}
+		r.chunks = r.chunks[1:]
+		r.cur = bytes.NewReader(b)
+	}
+	n, err := r.cur.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// Close releases the loaded chunk, further reads fail.
+func (r *fileReader) Close() error {
+	r.closed = true
+	r.cur = nil
+	r.chunks = nil
+	return nil
+}
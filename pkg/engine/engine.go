@@ -4,11 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/filecoin-project/go-legs"
 	"github.com/filecoin-project/go-legs/dtsync"
 	"github.com/filecoin-project/go-legs/httpsync"
-	"github.com/go-resty/resty/v2"
 	"github.com/hashicorp/go-multierror"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
@@ -17,10 +17,13 @@ import (
 	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/kenlabs/pando/pkg/types/schema"
 	"github.com/libp2p/go-libp2p-core/peer"
-	"net/http"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"pandoClient/pkg/retry"
 	sc "pandoClient/pkg/schema"
 	"sync"
 	"time"
@@ -38,16 +41,118 @@ var (
 // Engine is an implementation of the core reference provider interface.
 type Engine struct {
 	*options
-	lsys         *ipld.LinkSystem
-	publisher    legs.Publisher
-	subscriber   *legs.Subscriber
-	latestMeta   cid.Cid
-	latestMutex  sync.Mutex
-	pushList     []cid.Cid
-	publishMutex sync.Mutex
-	cr           *checkRegistry
-	closing      chan struct{}
-	closeDone    chan struct{}
+	lsys        *ipld.LinkSystem
+	bs          Blockstore
+	publisher   legs.Publisher
+	subscriber  *legs.Subscriber
+	latestMeta  cid.Cid
+	latestMutex sync.Mutex
+	extraMutex  sync.RWMutex
+	// annotationMutex serializes read-modify-write of local annotations.
+	annotationMutex sync.Mutex
+	pushList        []cid.Cid
+	publishMutex    sync.Mutex
+	cr              *checkRegistry
+	// checkerPaused is set by PauseChecker, accessed atomically.
+	checkerPaused int32
+	// ps is the pubsub router created by the engine when no topic is supplied.
+	ps            *pubsub.PubSub
+	psCancel      context.CancelFunc
+	migratedTopic *gossipTopic
+	// chains are the opened named chains.
+	chains      map[string]*Chain
+	chainsMutex sync.Mutex
+	// extraTopics are the topics joined to announce on with WithAnnounceTopic.
+	extraTopics map[string]*gossipTopic
+	topicsMutex sync.Mutex
+
+	// announceQueue holds the announcements that failed, flushed once connectivity returns.
+	announceQueue []queuedAnnounce
+	queueMutex    sync.Mutex
+	flushCh       chan struct{}
+	queueDone     chan struct{}
+	republishDone chan struct{}
+	forkDone      chan struct{}
+
+	// lastAnnounced is the last metadata announced successfully, at lastAnnounceTime.
+	lastAnnounced    cid.Cid
+	lastAnnounceTime time.Time
+	statusMutex      sync.Mutex
+	// lastAnnounceMessage is the last gossiped announcement, guarded by statusMutex.
+	lastAnnounceMessage *AnnounceMessage
+	// lastForkCheck is the result of the last CheckFork, guarded by statusMutex.
+	lastForkCheck *ForkCheck
+	// forkAlerted is set once a fork is alerted, until the chains are back in sync.
+	forkAlerted int32
+
+	// snapshotMutex serializes syncs of the snapshot chain of Pando.
+	snapshotMutex sync.Mutex
+	snapshotDone  chan struct{}
+	// ipnsCh triggers the publishing of the head to IPNS, see WithIPNSPublishing.
+	ipnsCh    chan struct{}
+	ipnsDone  chan struct{}
+	ipnsMutex sync.Mutex
+	// headExportCh triggers the export of the head, see WithHeadExporter.
+	headExportCh   chan struct{}
+	headExportDone chan struct{}
+
+	follower *Subscriber
+	// mirrors are the running mirrors of provider chains.
+	mirrors     map[peer.ID]*Mirror
+	mirrorMutex sync.Mutex
+	// bridges are the running bridges of index-provider advertisement chains.
+	bridges     map[peer.ID]*Bridge
+	bridgeMutex sync.Mutex
+	// watchers are the running watchers of directories, by path.
+	watchers   map[string]*Watcher
+	watchMutex sync.Mutex
+	// jobs are the scheduled publish jobs, by name.
+	jobs     map[string]*Job
+	jobMutex sync.Mutex
+	// inclusionWaiters are the calls of WaitForInclusion notified by the check registries, by
+	// cid.
+	inclusionWaiters map[cid.Cid][]chan *MetaInclusion
+	waiterMutex      sync.Mutex
+	// historyMutex serializes the updates of the publish history.
+	historyMutex sync.Mutex
+	// auditMutex serializes the appends to the audit log, see WithAuditLog.
+	auditMutex sync.Mutex
+	// backlogAlerted is set once the backlog alert is raised, until the backlog falls back.
+	backlogAlerted int32
+	// backlogChanged is closed on the next change of the pending checks, for the publishes
+	// waiting for the backlog to drain, see WithBacklogLimit.
+	backlogChanged chan struct{}
+	backlogMutex   sync.Mutex
+	// publishFn is publish wrapped with the middlewares set by WithPublishMiddleware.
+	publishFn PublishFunc
+	// schemaMutex guards payloadSchemas, registered by WithPayloadSchema and
+	// RegisterPayloadSchema.
+	schemaMutex sync.RWMutex
+	// blockStats counts the blocks written through the link system.
+	blockStats blockStats
+	// quota counts the metadatas published in the window of the publish quota.
+	quota *publishQuota
+	// dtClosers stop the data-transfer instances created for WithGraphsyncMaxInProgressRequests
+	// and the other tunings.
+	dtClosers []func() error
+	// pandoConn keeps the host connected to Pando, nil unless WithPandoConnectivity is set.
+	pandoConn *pandoConnectivity
+	// addrBookMutex serializes the updates of the persisted address book.
+	addrBookMutex sync.Mutex
+	// exceededSyncs counts the syncs stopped for exceeding the sync limits, see syncBudget.
+	exceededSyncs int32
+
+	// retriers of the components calling remote peers.
+	apiRetry      *retry.Retrier
+	announceRetry *retry.Retrier
+	syncRetry     *retry.Retrier
+
+	// frozen is the administrative freeze of the chain, nil if publishes are allowed.
+	frozen      *FreezeState
+	freezeMutex sync.RWMutex
+
+	closing   chan struct{}
+	closeDone chan struct{}
 }
 
 func New(o ...Option) (*Engine, error) {
@@ -57,20 +162,40 @@ func New(o ...Option) (*Engine, error) {
 	}
 
 	e := &Engine{
-		options:   opts,
-		closing:   make(chan struct{}),
-		closeDone: make(chan struct{}),
+		options:          opts,
+		flushCh:          make(chan struct{}, 1),
+		ipnsCh:           make(chan struct{}, 1),
+		headExportCh:     make(chan struct{}, 1),
+		mirrors:          make(map[peer.ID]*Mirror),
+		bridges:          make(map[peer.ID]*Bridge),
+		watchers:         make(map[string]*Watcher),
+		jobs:             make(map[string]*Job),
+		inclusionWaiters: make(map[cid.Cid][]chan *MetaInclusion),
+		extraTopics:      make(map[string]*gossipTopic),
+		chains:           make(map[string]*Chain),
+		closing:          make(chan struct{}),
+		closeDone:        make(chan struct{}),
+	}
+	e.publishFn = e.wrapPublish(e.publish)
+	if err = e.initRetriers(); err != nil {
+		return nil, err
 	}
 	e.cr, err = newCheckRegistry(e, opts.ds, e.checkInterval)
+	if err != nil && e.recoverAuditLog {
+		// the check list is rebuilt from the audit log by initInfo.
+		logger.Warnw("Dropping unreadable check list to recover it from the audit log", "err", err)
+		if err = dsn.Wrap(opts.ds, dsCheckRegistryKey).Delete(context.Background(), dsCheckCidListKey); err == nil {
+			e.cr, err = newCheckRegistry(e, opts.ds, e.checkInterval)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	e.cr.updatePendingMetrics()
 
-	err = e.initInfo(context.Background())
-	if err != nil {
+	if e.bs, err = opts.newBlockstore(); err != nil {
 		return nil, err
 	}
-
 	// custom linksystem
 	if opts.lsys != nil {
 		e.lsys = opts.lsys
@@ -78,21 +203,68 @@ func New(o ...Option) (*Engine, error) {
 		e.lsys = e.mkLinkSystem()
 	}
 
+	err = e.initInfo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
 	return e, nil
 }
 
 func (e *Engine) initInfo(ctx context.Context) error {
 	metaCid, err := e.getLatestMetaFromDs(ctx)
-	if err != nil {
+	if err != nil && !e.recoverAuditLog {
 		return err
 	}
 	e.setLatestMeta(ctx, metaCid)
 
 	pushedList, err := e.GetPushedList(ctx)
-	if err != nil {
+	if err != nil && !e.recoverAuditLog {
 		return err
 	}
 	e.pushList = pushedList
+	if e.recoverAuditLog {
+		if _, err = e.recoverFromAuditLog(ctx); err != nil {
+			return fmt.Errorf("failed to recover local chain state from audit log: %w", err)
+		}
+	}
+
+	e.announceQueue, err = e.loadAnnounceQueue(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = e.loadBlockStats(ctx); err != nil {
+		return err
+	}
+	if err = e.loadQuotaUsage(ctx); err != nil {
+		return err
+	}
+
+	e.frozen, err = e.loadFreeze(ctx)
+	if err != nil {
+		return err
+	}
+	if e.frozen != nil {
+		logger.Warnw("Chain is frozen, new publishes are rejected", "reason", e.frozen.Reason, "since", e.frozen.Since)
+	}
+
+	topic, err := e.loadMigratedTopic(ctx)
+	if err != nil {
+		return err
+	}
+	if topic != "" && topic != e.pubTopicName {
+		if e.pubTopic != nil {
+			logger.Warnw("Topic was migrated but a pubsub topic is supplied, ignoring the migrated topic", "migratedTopic", topic)
+		} else {
+			logger.Infow("Using migrated topic", "configuredTopic", e.pubTopicName, "topic", topic)
+			e.pubTopicName = topic
+		}
+	}
+
+	if _, err = e.checkIntegrity(ctx, e.repairIntegrity); err != nil {
+		return fmt.Errorf("failed to repair local chain state: %w", err)
+	}
 
 	return nil
 }
@@ -105,11 +277,13 @@ func (e *Engine) Start(ctx context.Context) error {
 		logger.Errorw("Failed to instantiate legs publisher", "err", err, "kind", e.pubKind)
 		return err
 	}
-	e.subscriber, err = e.newSubscriber()
+	latest := e.latestSyncHandler()
+	e.subscriber, err = e.newSubscriber(latest)
 	if err != nil {
 		logger.Errorf("Failed to instantiate legs subscriber, err: %v", err)
 		return err
 	}
+	e.follower = e.newFollowSubscriber(e.subscriber, latest)
 
 	// Initialize publisher with latest Meta CID.
 	metaCid, err := e.getLatestMetaFromDs(ctx)
@@ -122,7 +296,78 @@ func (e *Engine) Start(ctx context.Context) error {
 		}
 	}
 
+	if err = e.initLastAnnounced(ctx, metaCid); err != nil {
+		return fmt.Errorf("could not record latest announced metadata: %w", err)
+	}
+	if err = e.replayUnannounced(ctx); err != nil {
+		return err
+	}
+	if err = e.recoverInterruptedPublish(ctx); err != nil {
+		return err
+	}
+
+	if err = e.loadAddrBook(ctx); err != nil {
+		return fmt.Errorf("could not load address book: %w", err)
+	}
+	if err = e.resumeMirrors(ctx); err != nil {
+		return fmt.Errorf("could not resume mirrors: %w", err)
+	}
+	if err = e.resumeBridges(ctx); err != nil {
+		return fmt.Errorf("could not resume bridges: %w", err)
+	}
+	if err = e.resumeWatches(ctx); err != nil {
+		return fmt.Errorf("could not resume watches: %w", err)
+	}
+	if err = e.resumeJobs(ctx); err != nil {
+		return fmt.Errorf("could not resume jobs: %w", err)
+	}
+
+	if e.challengeHandler {
+		e.h.SetStreamHandler(ChallengeProtocolID, e.handleChallengeStream)
+	}
+	if e.bitswapServer {
+		e.startBitswap()
+	}
+
 	go e.cr.run()
+	if e.pandoConnectivity && e.pandoAddrinfo.ID != "" {
+		e.pandoConn = e.newPandoConnectivity()
+		e.pandoConn.start()
+	}
+	if e.snapshotInterval > 0 {
+		e.snapshotDone = make(chan struct{})
+		go e.followSnapshots()
+	}
+	if e.ipnsRouting != nil {
+		e.ipnsDone = make(chan struct{})
+		go e.followIPNS()
+		if metaCid != cid.Undef {
+			e.triggerIPNS()
+		}
+	}
+	if len(e.headExporters) != 0 {
+		e.headExportDone = make(chan struct{})
+		go e.exportHeads()
+		if metaCid != cid.Undef {
+			e.triggerHeadExport()
+		}
+	}
+	if e.publisher != nil {
+		e.queueDone = make(chan struct{})
+		go e.runAnnounceQueue()
+		if e.hasQueuedAnnounces() {
+			e.triggerFlush()
+		}
+		if e.republishInterval > 0 {
+			e.republishDone = make(chan struct{})
+			go e.republishLatestPeriodically()
+		}
+	}
+	if e.forkCheckInterval > 0 {
+		e.forkDone = make(chan struct{})
+		go e.detectForks()
+	}
+	e.learnPeerAddrs(ctx)
 
 	return nil
 }
@@ -133,35 +378,116 @@ func (e *Engine) newPublisher() (legs.Publisher, error) {
 		logger.Info("Remote announcements is disabled; all metadatas will only be store locally.")
 		return nil, nil
 	case DataTransferPublisher:
-		dtOpts := []dtsync.Option{
-			dtsync.Topic(e.pubTopic),
-			dtsync.WithExtraData(e.pubExtraGossipData),
-		}
-
-		if e.pubDT != nil {
-			return dtsync.NewPublisherFromExisting(e.pubDT, e.h, e.pubTopicName, *e.lsys, dtOpts...)
-		}
-		ds := dsn.Wrap(e.ds, datastore.NewKey("/legs/dtsync/pub"))
-		return dtsync.NewPublisher(e.h, ds, *e.lsys, e.pubTopicName, dtOpts...)
+		return e.newDataTransferPublisher()
 	case HttpPublisher:
 		return httpsync.NewPublisher(e.pubHttpListenAddr, *e.lsys, e.h.ID(), e.key)
+	case DualPublisher:
+		dtPub, err := e.newDataTransferPublisher()
+		if err != nil {
+			return nil, err
+		}
+		httpPub, err := httpsync.NewPublisher(e.pubHttpListenAddr, *e.lsys, e.h.ID(), e.key)
+		if err != nil {
+			_ = dtPub.Close()
+			return nil, err
+		}
+		logger.Infow("Serving metadatas over both dtsync and http", "topic", e.pubTopicName, "httpAddr", httpPub.Address())
+		return multiPublisher{dtPub, httpPub}, nil
 	default:
 		return nil, fmt.Errorf("unknown publisher kind: %s", e.pubKind)
 	}
 }
 
-func (e *Engine) newSubscriber() (*legs.Subscriber, error) {
-	subOptions := []legs.Option{
-		legs.Topic(e.subTopic),
+// newDataTransferPublisher instantiates the dtsync publisher announcing on the engine topic.
+func (e *Engine) newDataTransferPublisher() (legs.Publisher, error) {
+	if e.pubTopic == nil {
+		// own the topic so that announcements can be made on it directly.
+		if err := e.newPubSub(); err != nil {
+			return nil, err
+		}
+		t, err := e.joinTopic(e.pubTopicName)
+		if err != nil {
+			return nil, err
+		}
+		e.pubTopic = t
+	}
+	dtOpts := []dtsync.Option{
+		dtsync.Topic(e.pubTopic),
+		dtsync.WithExtraData(e.extraGossipData(nil)),
+	}
+
+	if e.pubDT != nil {
+		return dtsync.NewPublisherFromExisting(e.pubDT, e.h, e.pubTopicName, *e.lsys, dtOpts...)
+	}
+	ds := dsn.Wrap(e.ds, datastore.NewKey("/legs/dtsync/pub"))
+	if e.dtTuning.tuned {
+		dt, _, closeDT, err := e.newDataTransfer(ds)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := dtsync.NewPublisherFromExisting(dt, e.h, e.pubTopicName, *e.lsys, dtOpts...)
+		if err != nil {
+			_ = closeDT()
+			return nil, err
+		}
+		e.dtClosers = append(e.dtClosers, closeDT)
+		return pub, nil
 	}
-	ds := dsn.Wrap(e.ds, datastore.NewKey("/legs/dtsync/sub"))
+	return dtsync.NewPublisher(e.h, ds, *e.lsys, e.pubTopicName, dtOpts...)
+}
+
+func (e *Engine) newSubscriber(latest legs.LatestSyncHandler) (*legs.Subscriber, error) {
 	if e.subTopicName == "" {
 		e.subTopicName = "pandoClientSubscriberTmp"
 	}
-	sub, err := legs.NewSubscriber(e.h, ds, *e.lsys, e.subTopicName, nil, subOptions...)
+	if e.subTopic == nil && (e.ps != nil || e.gossipScoring != nil || e.validatesAnnouncements()) {
+		// share the router owned by the engine: a second router on the host would take over the
+		// incoming gossipsub streams, and the announcements would not be validated.
+		if e.ps == nil {
+			if err := e.newPubSub(); err != nil {
+				return nil, err
+			}
+		}
+		if e.subTopicName == e.pubTopicName && e.pubTopic != nil {
+			e.subTopic = e.pubTopic
+		} else {
+			t, err := e.joinTopic(e.subTopicName)
+			if err != nil {
+				return nil, err
+			}
+			e.subTopic = t
+		}
+	}
+	subOptions := []legs.Option{
+		legs.Topic(e.subTopic),
+		legs.UseLatestSyncHandler(latest),
+	}
+	var ds datastore.Batching = dsn.Wrap(e.ds, datastore.NewKey("/legs/dtsync/sub"))
+	var closeDT func() error
+	if e.dtTuning.tuned {
+		dt, gs, closeTuned, err := e.newDataTransfer(ds)
+		if err != nil {
+			return nil, err
+		}
+		closeDT = closeTuned
+		subOptions = append(subOptions, legs.DtManager(dt, gs))
+		// the datastore of the subscriber is the one of its data-transfer with DtManager.
+		ds = nil
+	}
+	// the default selector sequence syncs announced chains of followed providers, legs wraps
+	// it to stop at the latest synced metadata.
+	ssb := selectorbuilder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	dss := ssb.ExploreAll(ssb.ExploreRecursiveEdge()).Node()
+	sub, err := legs.NewSubscriber(e.h, ds, *e.lsys, e.subTopicName, dss, subOptions...)
 	if err != nil {
+		if closeDT != nil {
+			_ = closeDT()
+		}
 		return nil, err
 	}
+	if closeDT != nil {
+		e.dtClosers = append(e.dtClosers, closeDT)
+	}
 	return sub, nil
 }
 
@@ -200,12 +526,12 @@ func (e *Engine) RePublishLatest(ctx context.Context) (cid.Cid, error) {
 		return cid.Undef, err
 	}
 	if metaCid.Equals(cid.Undef) {
-		return cid.Undef, fmt.Errorf("no pushed metadata to announce, skip announce")
+		return cid.Undef, fmt.Errorf("%w, skip announce", ErrNoPublishedMetadata)
 	}
 	logger.Infow("Publishing latest metadata", "cid", metaCid)
 
 	// update but not add to the checklist
-	err = e.publisher.UpdateRoot(ctx, metaCid)
+	err = e.announce(ctx, metaCid, e.extraGossipData(nil))
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -213,14 +539,95 @@ func (e *Engine) RePublishLatest(ctx context.Context) (cid.Cid, error) {
 	return metaCid, nil
 }
 
+// republishLatestPeriodically re-announces the latest metadata every republish interval until
+// the engine is shut down, so that peers that missed the previous announcements learn the head.
+func (e *Engine) republishLatestPeriodically() {
+	defer close(e.republishDone)
+	ticker := e.clock.NewTicker(e.republishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.closing:
+			return
+		case <-ticker.Chan():
+		}
+		c, err := e.RePublishLatest(context.Background())
+		if err != nil {
+			if !errors.Is(err, ErrNoPublishedMetadata) {
+				logger.Warnw("Failed to re-announce latest metadata", "err", err)
+			}
+			continue
+		}
+		logger.Infow("Re-announced latest metadata", "cid", c)
+	}
+}
+
 func (e *Engine) RePublishCid(ctx context.Context, c cid.Cid) error {
+	return e.announceDetached(ctx, c, e.extraGossipData(nil), "")
+}
+
+// Republish re-announces c, any metadata previously pushed on any chain and not only the head,
+// and adds it back to the check list of its chain, e.g. when Pando lost it or missed its
+// announcement. It is taken out of the dead-letter list if it was moved there. ErrNotPushed is
+// returned if c was not pushed by the engine.
+func (e *Engine) Republish(ctx context.Context, c cid.Cid) error {
+	if e.publisher == nil {
+		return ErrPublisherDisabled
+	}
+	cr, err := e.pushedCheckRegistry(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err = e.RePublishCid(ctx, c); err != nil {
+		return fmt.Errorf("failed to republish %s: %w", c, err)
+	}
+	if !cr.has(c) {
+		if err = cr.addCheck(c); err != nil {
+			return err
+		}
+	}
+	if err = e.deadLettersDs().Delete(ctx, datastore.NewKey(c.String())); err != nil {
+		logger.Warnw("Failed to remove republished metadata from the dead-letter list", "cid", c, "err", err)
+	}
+	logger.Infow("Republished metadata", "cid", c, "chain", cr.chain)
+	return nil
+}
+
+// pushedCheckRegistry returns the check registry of the chain c was pushed on.
+func (e *Engine) pushedCheckRegistry(ctx context.Context, c cid.Cid) (*checkRegistry, error) {
+	for _, pushed := range e.pushList {
+		if pushed.Equals(c) {
+			return e.cr, nil
+		}
+	}
+	names, err := e.ListChains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		ch, err := e.Chain(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, pushed := range ch.PushedList() {
+			if pushed.Equals(c) {
+				return ch.cr, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotPushed, c)
+}
+
+// announceDetached announces c, which may not be the head of the chain, then sets the root of
+// the publisher back to the head.
+func (e *Engine) announceDetached(ctx context.Context, c cid.Cid, extraData []byte, topic string) error {
 	// don't publish concurrently, it's not safe
 	e.publishMutex.Lock()
 	defer e.publishMutex.Unlock()
 	// recover the root cid, others may sync by cid.Undef.
-	defer e.publisher.SetRoot(ctx, e.getLatestMeta(ctx))
+	defer e.setRoot(ctx, e.getLatestMeta(ctx))
 
-	err := e.publisher.UpdateRoot(ctx, c)
+	err := e.announceOn(ctx, c, extraData, topic)
 	if err != nil {
 		return err
 	}
@@ -228,47 +635,139 @@ func (e *Engine) RePublishCid(ctx context.Context, c cid.Cid) error {
 }
 
 // Publish todo: be sure that the previous cid is correct if you call this function. With concurrent calling, previous cid may be wrong
-func (e *Engine) Publish(ctx context.Context, metadata schema.Metadata) (cid.Cid, error) {
-	c, err := e.PublishLocal(ctx, metadata)
+// The checklist, announcement topic, synchronicity and link prototype can be set per call, see PublishOption.
+// Publishes are serialized with the changes of the pushed cid list, such as Rollback.
+// See: WithPublishMiddleware.
+func (e *Engine) Publish(ctx context.Context, metadata schema.Metadata, o ...PublishOption) (cid.Cid, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	return e.publishFn(ctx, metadata, o...)
+}
+
+func (e *Engine) publish(ctx context.Context, metadata schema.Metadata, o ...PublishOption) (cid.Cid, error) {
+	opts := newPublishOptions(o...)
+	if err := validateLabels(opts); err != nil {
+		return cid.Undef, err
+	}
+	idx := e.payloadIndex()
+	key, dup := e.duplicate(ctx, idx, metadata.Payload, opts)
+	if dup.Defined() {
+		logger.Infow("Payload is already published, skip publishing it again", "metaCid", dup)
+		e.indexLabels(ctx, dup, opts)
+		return dup, nil
+	}
+	if err := e.awaitBacklog(ctx, opts); err != nil {
+		return cid.Undef, err
+	}
+	prevHead := e.getLatestMeta(ctx)
+	if e.publisher != nil {
+		if err := e.beginPublish(ctx); err != nil {
+			return cid.Undef, fmt.Errorf("failed to record publish: %w", err)
+		}
+	}
+	c, err := e.publishLocal(ctx, metadata, opts)
 	if err != nil {
 		logger.Errorw("Failed to store advertisement locally", "err", err)
+		if e.publisher != nil && e.getLatestMeta(ctx).Equals(prevHead) {
+			// nothing to recover, the head did not change.
+			e.endPublish(ctx)
+		}
 		return cid.Undef, fmt.Errorf("failed to publish advertisement locally: %w", err)
 	}
+	idx.index(ctx, key, c)
+	e.indexLabels(ctx, c, opts)
+	entry := newHistoryEntry(c, DefaultChain, metadata.Payload, opts)
 
 	// Only announce the meta CID if publisher is configured.
 	if e.publisher != nil {
 		log := logger.With("metaCid", c)
+		qa := queuedAnnounce{
+			Cid:       c,
+			ExtraData: e.extraGossipData(opts),
+			Topic:     opts.topic,
+			SkipCheck: opts.skipCheck,
+		}
+		if opts.async || e.hasQueuedAnnounces() {
+			// keep the announcements in order behind the queued ones.
+			log.Info("Queue metadata to announce in the background")
+			if err = e.enqueueAnnounce(ctx, qa); err != nil {
+				log.Errorw("Failed to queue metadata announcement", "err", err)
+				e.recordPublish(ctx, entry, AnnounceFailed, err)
+				return cid.Undef, err
+			}
+			e.endPublish(ctx)
+			e.recordPublish(ctx, entry, AnnounceQueued, nil)
+			return c, nil
+		}
 		log.Info("Publishing metadata in pubsub channel")
-		err = e.publisher.UpdateRoot(ctx, c)
+		err = e.announceOn(ctx, c, qa.ExtraData, qa.Topic)
 		if err != nil {
-			log.Errorw("Failed to announce metadata on pubsub channel ", "err", err)
-			return cid.Undef, err
+			log.Warnw("Failed to announce metadata, queue it to announce once connectivity returns", "err", err)
+			announceErr := err
+			if err = e.enqueueAnnounce(ctx, qa); err != nil {
+				log.Errorw("Failed to queue metadata announcement", "err", err)
+				e.recordPublish(ctx, entry, AnnounceFailed, err)
+				return cid.Undef, err
+			}
+			e.endPublish(ctx)
+			e.recordPublish(ctx, entry, AnnounceQueued, announceErr)
+			return c, nil
 		}
-		err = e.cr.addCheck(c)
-		if err != nil {
-			log.Errorf("failed to add cid: %s to check list, err: %v", c.String(), err)
-			return cid.Undef, err
+		e.endPublish(ctx)
+		e.recordPublish(ctx, entry, Announced, nil)
+		if !opts.skipCheck {
+			err = e.cr.addCheck(c)
+			if err != nil {
+				log.Errorf("failed to add cid: %s to check list, err: %v", c.String(), err)
+				return cid.Undef, err
+			}
 		}
 	} else {
 		logger.Errorw("nil publisher!")
+		e.recordPublish(ctx, entry, NotAnnounced, nil)
 	}
 	return c, nil
 }
 
-func (e *Engine) PublishLocal(ctx context.Context, adv schema.Metadata) (cid.Cid, error) {
+// PublishLocal stores adv as the latest metadata without announcing it. Only WithLinkPrototype
+// takes effect among the publish options.
+func (e *Engine) PublishLocal(ctx context.Context, adv schema.Metadata, o ...PublishOption) (cid.Cid, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	return e.publishLocal(ctx, adv, newPublishOptions(o...))
+}
+
+// publishLocal stores adv as the latest metadata, e.publishMutex must be held.
+func (e *Engine) publishLocal(ctx context.Context, adv schema.Metadata, opts *publishOptions) (cid.Cid, error) {
+	if err := e.checkFrozen(); err != nil {
+		return cid.Undef, err
+	}
 
 	adNode, err := adv.ToNode()
 	if err != nil {
 		return cid.Undef, err
 	}
+	lp := opts.linkPrototype(e.linkProto)
+	size, err := e.encodedSize(adNode, lp)
+	if err != nil {
+		return cid.Undef, err
+	}
+	releaseQuota, err := e.reserveQuota(ctx, size)
+	if err != nil {
+		return cid.Undef, err
+	}
 
-	lnk, err := e.lsys.Store(ipld.LinkContext{Ctx: ctx}, schema.LinkProto, adNode)
+	lnk, err := e.lsys.Store(ipld.LinkContext{Ctx: ctx}, lp, adNode)
 	if err != nil {
+		releaseQuota()
 		return cid.Undef, fmt.Errorf("cannot generate advertisement link: %s", err)
 	}
 	c := lnk.(cidlink.Link).Cid
 	log := logger.With("adCid", c)
 	log.Info("Stored ad in local link system")
+	if err := e.persistBlockStats(ctx); err != nil {
+		log.Warnw("Failed to persist block stats", "err", err)
+	}
 
 	if err := e.updateLatestMeta(ctx, c); err != nil {
 		log.Errorw("Failed to update reference to the latest metadata", "err", err)
@@ -278,6 +777,7 @@ func (e *Engine) PublishLocal(ctx context.Context, adv schema.Metadata) (cid.Cid
 		log.Errorw("Failed to update pushed cid list", "err", err)
 		return cid.Undef, fmt.Errorf("failed to update pushed cid list: %w", err)
 	}
+	e.appendAuditLog(ctx, AuditPublish, c, "")
 
 	log.Info("Updated latest meta cid and cid list successfully")
 	return c, nil
@@ -300,7 +800,12 @@ func (e *Engine) updateLatestMeta(ctx context.Context, c cid.Cid) error {
 		return fmt.Errorf("meta cid can not be nil")
 	}
 	e.setLatestMeta(ctx, c)
-	return e.ds.Put(ctx, dsLatestMetaKey, c.Bytes())
+	if err := e.ds.Put(ctx, dsLatestMetaKey, c.Bytes()); err != nil {
+		return err
+	}
+	e.triggerIPNS()
+	e.triggerHeadExport()
+	return nil
 }
 
 func (e *Engine) updatePushedList(ctx context.Context, list []cid.Cid) error {
@@ -315,56 +820,138 @@ func (e *Engine) updatePushedList(ctx context.Context, list []cid.Cid) error {
 	return e.ds.Put(ctx, dsPushedCidListKey, b)
 }
 
-func (e *Engine) PublishBytesData(ctx context.Context, data []byte) (cid.Cid, error) {
+// PublishBytesData publishes data as the bytes payload of a metadata. With WithPayloadType, data
+// must be a dag-json document matching the schema of the payload type. Data larger than the max
+// payload size is rejected or chunked, see WithMaxPayloadSize.
+func (e *Engine) PublishBytesData(ctx context.Context, data []byte, o ...PublishOption) (cid.Cid, error) {
+	opts := newPublishOptions(o...)
+	if err := e.validateBytes(data, opts); err != nil {
+		return cid.Undef, err
+	}
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	if err := e.checkFrozen(); err != nil {
+		return cid.Undef, err
+	}
+	meta, err := e.newBytesMetadata(ctx, data, opts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	c, err := e.publishFn(ctx, *meta, o...)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, nil
+
+}
+
+// PreviewCid returns the cid PublishBytesData would give data with the same options, without
+// storing nor announcing anything. The cid only holds if nothing else is published in between,
+// since the metadata links to the latest one unless WithPreviousLink is set.
+func (e *Engine) PreviewCid(ctx context.Context, data []byte, o ...PublishOption) (cid.Cid, error) {
 	e.publishMutex.Lock()
 	defer e.publishMutex.Unlock()
+	opts := newPublishOptions(o...)
+	payload, err := e.bytesPayload(ctx, e.previewLinkSystem(), data, opts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	meta, err := e.newMetadata(ctx, payload, opts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	n, err := meta.ToNode()
+	if err != nil {
+		return cid.Undef, err
+	}
+	lnk, err := e.lsys.ComputeLink(opts.linkPrototype(e.linkProto), n)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("cannot compute metadata link: %w", err)
+	}
+	return lnk.(cidlink.Link).Cid, nil
+}
+
+// newBytesMetadata builds the signed metadata of data, linked to the latest metadata unless
+// overridden by WithPreviousLink.
+func (e *Engine) newBytesMetadata(ctx context.Context, data []byte, opts *publishOptions) (*schema.Metadata, error) {
+	payload, err := e.bytesPayload(ctx, *e.lsys, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return e.newMetadata(ctx, payload, opts)
+}
+
+// newMetadata builds the signed metadata of payload, linked like newBytesMetadata.
+func (e *Engine) newMetadata(ctx context.Context, payload datamodel.Node, opts *publishOptions) (*schema.Metadata, error) {
 	var prevLink datamodel.Link
-	var link datamodel.Link
 	preCid := e.getLatestMeta(ctx)
+	if opts.hasPrevious {
+		preCid = opts.previous
+	}
 	if preCid.Defined() {
-		link = ipld.Link(cidlink.Link{Cid: preCid})
-		prevLink = link
-	} else {
-		prevLink = nil
+		prevLink = ipld.Link(cidlink.Link{Cid: preCid})
 	}
 
-	meta, err := sc.NewMetaWithBytesPayload(data, e.h.ID(), e.key, prevLink)
+	payload, err := opts.versionedPayload(payload)
 	if err != nil {
-		logger.Errorf("failed to generate Metadata, err: %v", err)
-		return cid.Undef, err
+		return nil, err
 	}
-	c, err := e.Publish(ctx, *meta)
+	meta, err := sc.NewMetaWithPayloadNode(payload, e.h.ID(), e.key, prevLink)
 	if err != nil {
-		return cid.Undef, err
+		logger.Errorf("failed to generate Metadata, err: %v", err)
+		return nil, err
 	}
-	return c, nil
+	return meta, nil
+}
 
+// Sync syncs the chain of metadatas from c from Pando, up to depth metadatas or to endCidStr if
+// set, and returns the cids of the synced blocks. A zero depth follows the chain as deep as it
+// goes, SyncDepthAll without any recursion limit. The sync is stopped with a *SyncLimitError if
+// it fetches more blocks than the sync limits, and the blocks synced until then are returned
+// with the error.
+// See: WithSyncLimits, WithMaxSyncBlocks.
+func (e *Engine) Sync(ctx context.Context, c string, depth int, endCidStr string, o ...SyncOption) ([]cid.Cid, error) {
+	syncCid, sel, err := syncSelector(c, depth, endCidStr)
+	if err != nil {
+		return nil, err
+	}
+	budget := e.newSyncBudget(newSyncOptions(o...))
+	return e.syncBlocks(ctx, budget, func(ctx context.Context, hook func(cid.Cid)) error {
+		blockHook := func(_ peer.ID, rcid cid.Cid, _ legs.SegmentSyncActions) {
+			hook(rcid)
+		}
+		_, err := e.subscriber.Sync(ctx, e.pandoAddrinfo.ID, syncCid, sel, nil, legs.ScopedBlockHook(blockHook))
+		return err
+	})
 }
 
-func (e *Engine) Sync(ctx context.Context, c string, depth int, endCidStr string) ([]cid.Cid, error) {
+// syncSelector returns the cid to sync c and the selector of a sync up to depth metadatas or to
+// endCidStr, see Sync.
+func syncSelector(c string, depth int, endCidStr string) (cid.Cid, ipld.Node, error) {
 	syncCid, err := cid.Decode(c)
 	if err != nil {
-		return nil, err
+		return cid.Undef, nil, err
 	}
 	var endCid cid.Cid
 	if endCidStr != "" {
 		endCid, err = cid.Decode(endCidStr)
 		if err != nil {
-			return nil, err
+			return cid.Undef, nil, err
 		}
 	}
 
-	var syncRes []cid.Cid
-	blockHook := func(_ peer.ID, rcid cid.Cid, _ legs.SegmentSyncActions) {
-		syncRes = append(syncRes, rcid)
-	}
-
 	// if sel is nil, sync will raise error
 	var sel ipld.Node
+	if depth < 0 && depth != SyncDepthAll {
+		return cid.Undef, nil, fmt.Errorf("invalid sync depth %d", depth)
+	}
 	if depth != 0 || endCid.Defined() {
 		var limiter selector.RecursionLimit
 		var endLink ipld.Link
-		if depth != 0 {
+		switch {
+		case depth == SyncDepthAll:
+			limiter = selector.RecursionLimitNone()
+		case depth != 0:
 			limiter = selector.RecursionLimitDepth(int64(depth))
 		}
 		if endCid.Defined() {
@@ -374,66 +961,49 @@ func (e *Engine) Sync(ctx context.Context, c string, depth int, endCidStr string
 	} else {
 		sel = legs.LegSelector(selector.RecursionLimitDepth(999999), nil)
 	}
-
-	_, err = e.subscriber.Sync(ctx, e.pandoAddrinfo.ID, syncCid, sel, nil, legs.ScopedBlockHook(blockHook))
-
-	return syncRes, nil
-}
-
-type latestSyncResJson struct {
-	Code    int                  `json:"code"`
-	Message string               `json:"message"`
-	Data    struct{ Cid string } `json:"Data"`
-}
-
-type inclusionResJson struct {
-	Code    int            `json:"code"`
-	Message string         `json:"message"`
-	Data    *MetaInclusion `json:"Data"`
+	return syncCid, sel, nil
 }
 
-func (e *Engine) SyncWithProvider(ctx context.Context, provider string, depth int, endCid string) error {
-	res, err := handleResError(e.pandoAPIClient.R().Get("/provider/head?peerid=" + provider))
-	if err != nil {
-		return err
-	}
-	resJson := latestSyncResJson{}
-	err = json.Unmarshal(res.Body(), &resJson)
-	if err != nil {
-		logger.Errorf("failed to unmarshal the latestes cid from PandoAPI result: %v", err)
+// syncBlocks runs sync with the sync retries within budget and returns the cids of the synced
+// blocks, reported by sync to hook. The blocks synced until the budget was exceeded are returned
+// with the limit error.
+func (e *Engine) syncBlocks(ctx context.Context, budget *syncBudget, sync func(ctx context.Context, hook func(cid.Cid)) error) ([]cid.Cid, error) {
+	var syncRes []cid.Cid
+	err := e.syncRetry.Do(ctx, func(ctx context.Context) error {
+		// blocks synced by a failed attempt are synced again.
+		syncRes = nil
+		budget.reset()
+		err := sync(ctx, func(rcid cid.Cid) {
+			syncRes = append(syncRes, rcid)
+			budget.add(ctx, rcid)
+		})
+		if limitErr := budget.done(syncRes); limitErr != nil {
+			return retry.Permanent(limitErr)
+		}
 		return err
+	})
+	if errors.Is(err, ErrSyncLimitExceeded) {
+		return syncRes, err
 	}
-
-	_, err = e.Sync(ctx, resJson.Data.Cid, depth, endCid)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return syncRes, nil
 }
 
+// CatCid returns the payload of the metadata c, synced from Pando if it is not stored locally:
+// the bytes of a bytes payload, the dag-json encoding of any other one.
+// See: Cat.
 func (e *Engine) CatCid(ctx context.Context, c cid.Cid) ([]byte, error) {
-	n, err := e.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, schema.MetadataPrototype)
+	meta, err := e.catMetadata(ctx, c)
 	if err != nil {
-		if err == datastore.ErrNotFound {
-			logger.Infof("not found cid: %s locally, try sync from Pando", c.String())
-			// todo: the context can not break the sync while timeout, we need a method to break
-			cctx, cncl := context.WithTimeout(ctx, time.Second*15)
-			defer cncl()
-			n, err = e.catRemote(cctx, c)
-			if err != nil {
-				logger.Errorf("failed to sync cid: %s from Pando, err: %v", c.String(), err)
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
-	meta, err := schema.UnwrapMetadata(n)
+	dataNode, err := payloadData(meta)
 	if err != nil {
 		return nil, err
 	}
-	dataNode := meta.Payload
 	bytesRes, err := dataNode.AsBytes()
 	// bytes node
 	if err == nil {
@@ -449,6 +1019,27 @@ func (e *Engine) CatCid(ctx context.Context, c cid.Cid) ([]byte, error) {
 	}
 }
 
+// catMetadata loads the metadata c, synced from Pando if it is not stored locally.
+func (e *Engine) catMetadata(ctx context.Context, c cid.Cid) (*schema.Metadata, error) {
+	n, err := e.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, schema.MetadataPrototype)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			logger.Infof("not found cid: %s locally, try sync from Pando", c.String())
+			// todo: the context can not break the sync while timeout, we need a method to break
+			cctx, cncl := context.WithTimeout(ctx, time.Second*15)
+			defer cncl()
+			n, err = e.catRemote(cctx, c)
+			if err != nil {
+				logger.Errorf("failed to sync cid: %s from Pando, err: %v", c.String(), err)
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	}
+	return schema.UnwrapMetadata(n)
+}
+
 func (e *Engine) catRemote(ctx context.Context, c cid.Cid) (datamodel.Node, error) {
 	syncCids, err := e.Sync(ctx, c.String(), 1, "")
 	if err != nil {
@@ -456,11 +1047,11 @@ func (e *Engine) catRemote(ctx context.Context, c cid.Cid) (datamodel.Node, erro
 	}
 	if len(syncCids) != 1 {
 		logger.Errorf("sync successfully but got wrong node number: %d, expected: 1", len(syncCids))
-		return nil, fmt.Errorf("wrong nodes number")
+		return nil, fmt.Errorf("%w: got %d nodes, expected 1", ErrSyncMismatch, len(syncCids))
 	}
 	if !syncCids[0].Equals(c) {
 		logger.Errorf("sync node dismatched the cid, expected: %s, got: %s", c.String(), syncCids[0].String())
-		return nil, fmt.Errorf("sync node dismatched cid")
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrSyncMismatch, c, syncCids[0])
 	}
 	n, err := e.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, schema.MetadataPrototype)
 	if err != nil {
@@ -471,13 +1062,69 @@ func (e *Engine) catRemote(ctx context.Context, c cid.Cid) (datamodel.Node, erro
 
 func (e *Engine) Shutdown() error {
 	var errs error
+	// watchers and jobs publish, stop them before the publisher.
+	e.closeWatchers()
+	e.closeJobs()
+	if e.challengeHandler {
+		e.h.RemoveStreamHandler(ChallengeProtocolID)
+	}
+	if e.bitswapServer {
+		e.stopBitswap()
+	}
 	if e.publisher != nil {
 		if err := e.publisher.Close(); err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("error closing leg publisher: %s", err))
 		}
 	}
+	// Persist the addresses learned since Start while the mirrors are still known.
+	e.learnPeerAddrs(context.Background())
+	if err := e.closeMirrors(); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("error closing mirrors: %s", err))
+	}
+	e.closeBridges()
+	if e.follower != nil {
+		e.follower.close()
+	}
+	for _, closeDT := range e.dtClosers {
+		if err := closeDT(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error closing datatransfer: %s", err))
+		}
+	}
+	if e.migratedTopic != nil {
+		if err := e.migratedTopic.close(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error closing migrated topic: %s", err))
+		}
+	}
+	if err := e.closeExtraTopics(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if e.psCancel != nil {
+		e.psCancel()
+	}
 	close(e.closing)
+	if e.queueDone != nil {
+		<-e.queueDone
+	}
+	if e.snapshotDone != nil {
+		<-e.snapshotDone
+	}
+	if e.ipnsDone != nil {
+		<-e.ipnsDone
+	}
+	if e.headExportDone != nil {
+		<-e.headExportDone
+	}
+	if e.republishDone != nil {
+		<-e.republishDone
+	}
+	if e.forkDone != nil {
+		<-e.forkDone
+	}
+	if e.pandoConn != nil {
+		e.pandoConn.close()
+	}
 	go func() {
+		e.closeChains()
 		e.cr.close()
 		close(e.closeDone)
 	}()
@@ -485,18 +1132,3 @@ func (e *Engine) Shutdown() error {
 
 	return errs
 }
-
-func handleResError(res *resty.Response, err error) (*resty.Response, error) {
-	errTmpl := "failed to get latest head, error: %v"
-	if err != nil {
-		return res, err
-	}
-	if res.IsError() {
-		return res, fmt.Errorf(errTmpl, res.Error())
-	}
-	if res.StatusCode() != http.StatusOK {
-		return res, fmt.Errorf(errTmpl, fmt.Sprintf("expect 200, got %d", res.StatusCode()))
-	}
-
-	return res, nil
-}
@@ -1,26 +1,61 @@
 package engine
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filecoin-project/go-legs"
 	"github.com/filecoin-project/go-legs/dtsync"
+	"github.com/filecoin-project/go-legs/httpsync"
+	maurl "github.com/filecoin-project/go-legs/httpsync/multiaddr"
 	"github.com/filecoin-project/go-legs/p2p/protocol/head"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/storage/memstore"
 	"github.com/ipld/go-ipld-prime/traversal/selector"
 	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/kenlabs/pando/pkg/types/schema"
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/libp2p/go-libp2p-core/test"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pubsubpb "github.com/libp2p/go-libp2p-pubsub/pb"
 	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"pandoClient/cmd/server/command/config"
+	"pandoClient/pkg/alert"
+	"pandoClient/pkg/headexport"
+	"pandoClient/pkg/metrics"
+	"pandoClient/pkg/pandoapi"
+	"pandoClient/pkg/retry"
+	sc "pandoClient/pkg/schema"
+	"pandoClient/pkg/testutil"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -57,6 +92,40 @@ func requireTrueEventually(t *testing.T, attempt func() bool, interval time.Dura
 	}
 }
 
+// gossipPeer connects a new host subscribed to the topics to the started engine e, for its
+// gossip announcements to reach a peer.
+func gossipPeer(ctx context.Context, t *testing.T, e *Engine, topics ...string) {
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = h.Close() })
+	g, err := pubsub.NewGossipSub(ctx, h)
+	require.NoError(t, err)
+	for _, topic := range topics {
+		gt, err := g.Join(topic)
+		require.NoError(t, err)
+		_, err = gt.Subscribe()
+		require.NoError(t, err)
+	}
+	ai := peer.AddrInfo{ID: e.h.ID(), Addrs: e.h.Addrs()}
+	require.NoError(t, h.Connect(ctx, ai))
+	waitUntil := time.Now().Add(2 * time.Second)
+	requireTrueEventually(t, func() bool {
+		if len(e.pubTopic.ListPeers()) != 0 {
+			return true
+		}
+		// pubsub may lose its stream when both sides dial each other, start over with a new
+		// connection.
+		if time.Now().After(waitUntil) {
+			_ = h.Network().ClosePeer(ai.ID)
+			waitUntil = time.Now().Add(2 * time.Second)
+		}
+		if h.Network().Connectedness(ai.ID) != network.Connected {
+			_ = h.Connect(ctx, ai)
+		}
+		return false
+	}, 10*time.Millisecond, 15*time.Second, "timed out waiting for the gossip peer to subscribe")
+}
+
 func requireEqualLegsMessage(t *testing.T, got, want dtsync.Message) {
 	require.Equal(t, want.Cid, got.Cid)
 	require.Equal(t, want.ExtraData, got.ExtraData)
@@ -236,3 +305,4377 @@ func TestMetaInclusion(t *testing.T) {
 	assert.NoError(t, err)
 	t.Log(string(res.Body()))
 }
+
+func TestEngine_PublishOptions(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName, "/pando/custom")
+
+	unchecked, err := e.PublishBytesData(ctx, []byte("unchecked"), WithSkipCheck())
+	require.NoError(t, err)
+	require.NotContains(t, e.cr.checkMap, unchecked.String())
+
+	root, err := e.PublishBytesData(ctx, []byte("new chain"), WithPreviousLink(cid.Undef), WithAnnounceTopic("/pando/custom"))
+	require.NoError(t, err)
+	require.Contains(t, e.cr.checkMap, root.String())
+	require.Contains(t, e.extraTopics, "/pando/custom")
+	meta, err := e.loadMetadata(ctx, root)
+	require.NoError(t, err)
+	require.Nil(t, meta.PreviousID)
+
+	lp := schema.LinkProto
+	lp.MhType = multihash.SHA2_512
+	c, err := e.PublishBytesData(ctx, []byte("sha512"), WithLinkPrototype(lp))
+	require.NoError(t, err)
+	require.Equal(t, uint64(multihash.SHA2_512), c.Prefix().MhType)
+	meta, err = e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, root, (*meta.PreviousID).(cidlink.Link).Cid)
+
+	async, err := e.PublishBytesData(ctx, []byte("async"), WithAsyncAnnounce())
+	require.NoError(t, err)
+	requireTrueEventually(t, func() bool { return len(e.QueuedAnnounces()) == 0 }, 10*time.Millisecond, 5*time.Second)
+	e.cr.checkMutex.Lock()
+	require.Contains(t, e.cr.checkMap, async.String())
+	e.cr.checkMutex.Unlock()
+}
+
+func TestEngine_PreviewCid(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+
+	preview, err := e.PreviewCid(ctx, []byte("second"))
+	require.NoError(t, err)
+	has, err := e.ds.Has(ctx, datastore.NewKey(preview.String()))
+	require.NoError(t, err)
+	require.False(t, has)
+	stats := e.ChainStats(ctx)
+
+	c, err := e.PublishBytesData(ctx, []byte("second"))
+	require.NoError(t, err)
+	require.Equal(t, preview, c)
+	require.Equal(t, stats.Metadatas+1, e.ChainStats(ctx).Metadatas)
+
+	lp := schema.LinkProto
+	lp.MhType = multihash.SHA2_512
+	preview, err = e.PreviewCid(ctx, []byte("root"), WithPreviousLink(cid.Undef), WithLinkPrototype(lp))
+	require.NoError(t, err)
+	c, err = e.PublishBytesData(ctx, []byte("root"), WithPreviousLink(cid.Undef), WithLinkPrototype(lp))
+	require.NoError(t, err)
+	require.Equal(t, preview, c)
+}
+
+func TestEngine_LinkPrototype(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	for _, tc := range []struct {
+		hash   LinkHash
+		codec  LinkCodec
+		mhType uint64
+		codecs uint64
+	}{
+		{"", "", multihash.SHA2_256, cid.DagJSON},
+		{LinkHashSha2_512, LinkCodecDagCbor, multihash.SHA2_512, cid.DagCBOR},
+		{LinkHashBlake3, LinkCodecDagJson, multihash.BLAKE3, cid.DagJSON},
+	} {
+		e, err := New(WithLinkHash(tc.hash), WithLinkCodec(tc.codec))
+		require.NoError(t, err)
+		first, err := e.PublishBytesData(ctx, []byte("first"))
+		require.NoError(t, err)
+		c, err := e.PublishBytesData(ctx, []byte("second"))
+		require.NoError(t, err)
+		require.Equal(t, tc.mhType, c.Prefix().MhType)
+		require.Equal(t, tc.codecs, c.Prefix().Codec)
+
+		meta, err := e.loadMetadata(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, first, (*meta.PreviousID).(cidlink.Link).Cid)
+
+		// the codec is overridden per publish, the hash is kept.
+		lp, err := e.LinkPrototypeWithCodec(LinkCodecDagCbor)
+		require.NoError(t, err)
+		c, err = e.PublishBytesData(ctx, []byte("cbor"), WithLinkPrototype(lp))
+		require.NoError(t, err)
+		require.Equal(t, tc.mhType, c.Prefix().MhType)
+		require.Equal(t, uint64(cid.DagCBOR), c.Prefix().Codec)
+	}
+
+	_, err := New(WithLinkHash("md5"))
+	require.Error(t, err)
+	_, err = New(WithLinkCodec("raw"))
+	require.Error(t, err)
+}
+
+func TestEngine_DatastoreNamespace(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	a, err := New(WithDatastore(ds), WithDatastoreNamespace("/engines/a"))
+	require.NoError(t, err)
+	b, err := New(WithDatastore(ds), WithDatastoreNamespace("/engines/b"))
+	require.NoError(t, err)
+
+	cidA, err := a.PublishBytesData(ctx, []byte("a"))
+	require.NoError(t, err)
+	cidB, err := b.PublishBytesData(ctx, []byte("b"))
+	require.NoError(t, err)
+	has, err := ds.Has(ctx, datastore.NewKey("/engines/a").Child(dsLatestMetaKey))
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = ds.Has(ctx, dsLatestMetaKey)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	restarted, err := New(WithDatastore(ds), WithDatastoreNamespace("/engines/a"))
+	require.NoError(t, err)
+	require.Equal(t, cidA, restarted.getLatestMeta(ctx))
+	list, err := restarted.GetPushedList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cidA}, list)
+	_, err = restarted.loadMetadata(ctx, cidB)
+	require.Error(t, err)
+
+	unscoped, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	require.Equal(t, cid.Undef, unscoped.getLatestMeta(ctx))
+}
+
+func TestEngine_Chains(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	defer e.closeChains()
+	pub := &countingPublisher{}
+	e.publisher = pub
+
+	head, err := e.PublishToChain(ctx, DefaultChain, []byte("default"))
+	require.NoError(t, err)
+	deal1, err := e.PublishToChain(ctx, "deals", []byte("deal 1"))
+	require.NoError(t, err)
+	deal2, err := e.PublishToChain(ctx, "deals", []byte("deal 2"))
+	require.NoError(t, err)
+	rep, err := e.PublishToChain(ctx, "reputation", []byte("reputation"))
+	require.NoError(t, err)
+
+	require.Equal(t, head, e.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{head}, e.pushList)
+	require.Equal(t, []cid.Cid{head, deal1, deal2, rep}, pub.announced())
+	// the root is set back to the head of the default chain.
+	require.Equal(t, head, pub.root)
+	deals, err := e.Chain(ctx, "deals")
+	require.NoError(t, err)
+	require.Equal(t, deal2, deals.Head())
+	require.Equal(t, []cid.Cid{deal1, deal2}, deals.PushedList())
+	require.Contains(t, deals.cr.checkMap, deal2.String())
+	require.NotContains(t, e.cr.checkMap, deal2.String())
+
+	meta, err := e.loadMetadata(ctx, deal2)
+	require.NoError(t, err)
+	require.Equal(t, deal1, (*meta.PreviousID).(cidlink.Link).Cid)
+	meta, err = e.loadMetadata(ctx, deal1)
+	require.NoError(t, err)
+	require.Nil(t, meta.PreviousID)
+
+	restarted, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	defer restarted.closeChains()
+	names, err := restarted.ListChains(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"deals", "reputation"}, names)
+	deals, err = restarted.Chain(ctx, "deals")
+	require.NoError(t, err)
+	require.Equal(t, deal2, deals.Head())
+	require.Equal(t, []cid.Cid{deal1, deal2}, deals.PushedList())
+
+	deals, err = e.Chain(ctx, "deals")
+	require.NoError(t, err)
+	async, err := e.PublishToChain(ctx, "deals", []byte("deal 3"), WithAsyncAnnounce())
+	require.NoError(t, err)
+	require.Equal(t, async, deals.Head())
+	require.Equal(t, []cid.Cid{async}, e.QueuedAnnounces())
+	require.NotContains(t, deals.cr.checkMap, async.String())
+	require.NoError(t, e.FlushAnnounceQueue(ctx))
+	require.Empty(t, e.QueuedAnnounces())
+	require.Equal(t, []cid.Cid{head, deal1, deal2, rep, async}, pub.announced())
+	require.Equal(t, head, pub.root)
+	require.Contains(t, deals.cr.checkMap, async.String())
+	require.NotContains(t, e.cr.checkMap, async.String())
+
+	// the payloads of the named chains are versioned like the ones of the default chain.
+	typed, err := e.PublishToChain(ctx, "typed", []byte(`{"deal":4}`), WithContentType("application/json"), WithLabels("kind=deal"))
+	require.NoError(t, err)
+	meta, err = e.loadMetadata(ctx, typed)
+	require.NoError(t, err)
+	p, err := sc.DecodeMetaPayload(meta)
+	require.NoError(t, err)
+	require.Equal(t, sc.V2, p.Version)
+	require.Equal(t, "application/json", p.ContentType)
+	require.Equal(t, map[string]string{"kind": "deal"}, p.Labels)
+	content, err := e.CatContentLocal(ctx, typed)
+	require.NoError(t, err)
+	require.Equal(t, &Content{ContentType: "application/json", Data: []byte(`{"deal":4}`)}, content)
+	_, err = e.PublishToChain(ctx, "typed", []byte("v3"), WithSchemaVersion(3))
+	require.ErrorIs(t, err, sc.ErrUnsupportedVersion)
+
+	// the queued announcements keep their chain across restarts.
+	queued, err := e.PublishToChain(ctx, "deals", []byte("deal 4"), WithAsyncAnnounce())
+	require.NoError(t, err)
+	e.closeChains()
+	restarted.closeChains()
+	restarted, err = New(WithDatastore(ds))
+	require.NoError(t, err)
+	defer restarted.closeChains()
+	restarted.publisher = pub
+	require.Equal(t, []cid.Cid{queued}, restarted.QueuedAnnounces())
+	require.NoError(t, restarted.FlushAnnounceQueue(ctx))
+	require.Equal(t, queued, pub.announced()[len(pub.announced())-1])
+	require.Equal(t, head, pub.root)
+	deals, err = restarted.Chain(ctx, "deals")
+	require.NoError(t, err)
+	require.Equal(t, queued, deals.Head())
+	require.Contains(t, deals.cr.checkMap, queued.String())
+	require.NotContains(t, restarted.cr.checkMap, queued.String())
+
+	_, err = e.Chain(ctx, "no/slash")
+	require.Error(t, err)
+}
+
+func TestEngine_Republish(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	defer e.closeChains()
+	first, err := e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	require.ErrorIs(t, e.Republish(ctx, first), ErrPublisherDisabled)
+	pub := &countingPublisher{}
+	e.publisher = pub
+	head, err := e.PublishBytesData(ctx, []byte("head"))
+	require.NoError(t, err)
+	deal, err := e.PublishToChain(ctx, "deals", []byte("deal"))
+	require.NoError(t, err)
+
+	require.False(t, e.cr.has(first))
+	require.NoError(t, e.Republish(ctx, first))
+	require.Equal(t, []cid.Cid{head, deal, first}, pub.announced())
+	require.Equal(t, head, pub.root)
+	require.True(t, e.cr.has(first))
+
+	// pending in the check list of its chain, then dead-lettered.
+	deals, err := e.Chain(ctx, "deals")
+	require.NoError(t, err)
+	deals.cr.checkMutex.Lock()
+	status := deals.cr.checkMap[deal.String()]
+	deals.cr.checkMutex.Unlock()
+	require.NoError(t, deals.cr.deadLetter(deal, status))
+	require.NoError(t, e.Republish(ctx, deal))
+	require.True(t, deals.cr.has(deal))
+	require.False(t, e.cr.has(deal))
+	dls, err := e.ListDeadLetters(ctx)
+	require.NoError(t, err)
+	require.Empty(t, dls)
+	require.NoError(t, e.Republish(ctx, deal))
+	require.Equal(t, []cid.Cid{head, deal, first, deal, deal}, pub.announced())
+
+	require.ErrorIs(t, e.Republish(ctx, cid.NewCidV1(cid.Raw, head.Hash())), ErrNotPushed)
+}
+
+func TestEngine_MigrateTopic(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithTopicName("/pando/old"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName, "/pando/new")
+
+	cid1, err := e.PublishBytesData(ctx, []byte("before migration"))
+	require.NoError(t, err)
+
+	pointer, err := e.MigrateTopic(ctx, "/pando/new")
+	require.NoError(t, err)
+	require.Equal(t, pointer, e.getLatestMeta(ctx))
+	require.Equal(t, "/pando/new", e.pubTopicName)
+	require.Contains(t, e.pushList, cid1)
+	require.Contains(t, e.pushList, pointer)
+
+	topic, err := e.loadMigratedTopic(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "/pando/new", topic)
+
+	_, err = e.MigrateTopic(ctx, "/pando/new")
+	require.Error(t, err)
+
+	cid2, err := e.PublishBytesData(ctx, []byte("after migration"))
+	require.NoError(t, err)
+	require.Equal(t, cid2, e.getLatestMeta(ctx))
+}
+
+func TestEngine_MigrateTopicWithoutGossipPeers(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithTopicName("/pando/old"),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	// the pointer is the head already, its announcement is queued and the topic migrated.
+	pointer, err := e.MigrateTopic(ctx, "/pando/new")
+	require.NoError(t, err)
+	require.Equal(t, "/pando/new", e.pubTopicName)
+	require.Equal(t, []cid.Cid{pointer}, e.QueuedAnnounces())
+	require.Equal(t, []cid.Cid{pointer}, e.pushList)
+
+	// flushed on the old topic.
+	gossipPeer(ctx, t, e, "/pando/old")
+	require.NoError(t, e.FlushAnnounceQueue(ctx))
+	require.Empty(t, e.QueuedAnnounces())
+	require.Contains(t, e.cr.checkMap, pointer.String())
+
+	// nobody follows the new topic yet, the rolled back head is queued too.
+	c, err := e.PublishBytesData(ctx, []byte("after migration"))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{c}, e.QueuedAnnounces())
+	rolledBack, err := e.Rollback(ctx, pointer)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{c}, rolledBack)
+	require.Equal(t, pointer, e.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{pointer}, e.QueuedAnnounces())
+}
+
+func TestEngine_SetExtraGossipData(t *testing.T) {
+	e, err := New(WithExtraGossipData([]byte("initial")))
+	require.NoError(t, err)
+	require.Equal(t, []byte("initial"), e.extraGossipData(nil))
+
+	e.SetExtraGossipData([]byte("updated"))
+	require.Equal(t, []byte("updated"), e.extraGossipData(nil))
+
+	opts := newPublishOptions(WithAnnounceExtraData([]byte("override")))
+	require.Equal(t, []byte("override"), e.extraGossipData(opts))
+	require.Equal(t, []byte("updated"), e.extraGossipData(newPublishOptions()))
+
+	e.SetExtraGossipData(nil)
+	require.Empty(t, e.extraGossipData(nil))
+}
+
+func TestEngine_Annotations(t *testing.T) {
+	ctx := context.Background()
+	e, err := New()
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+
+	c, err := e.PublishBytesData(ctx, []byte("annotated"))
+	require.NoError(t, err)
+
+	require.NoError(t, e.Annotate(ctx, c, "ticket", "OPS-1"))
+	require.NoError(t, e.Annotate(ctx, c, "note", "first"))
+	a, err := e.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, "OPS-1", a["ticket"].Value)
+
+	exported, err := e.ExportAnnotations(ctx)
+	require.NoError(t, err)
+	require.Len(t, exported, 1)
+
+	// a newer value from another instance wins, an older one is ignored.
+	imported := map[string]Annotations{c.String(): {
+		"note":     {Value: "newer", UpdatedAt: time.Now().Add(time.Hour)},
+		"ticket":   {Value: "stale", UpdatedAt: time.Unix(0, 0)},
+		"verified": {Value: "yes", UpdatedAt: time.Now()},
+	}}
+	require.NoError(t, e.ImportAnnotations(ctx, imported))
+	a, err = e.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, "newer", a["note"].Value)
+	require.Equal(t, "OPS-1", a["ticket"].Value)
+	require.Equal(t, "yes", a["verified"].Value)
+	exported, err = e.ExportAnnotations(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, e.Annotate(ctx, c, "verified", ""))
+	a, err = e.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.NotContains(t, a, "verified")
+	// the removal wins over the values exported before, and is exported to other instances.
+	require.NoError(t, e.ImportAnnotations(ctx, exported))
+	a, err = e.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.NotContains(t, a, "verified")
+	other, err := New()
+	require.NoError(t, err)
+	require.NoError(t, other.ImportAnnotations(ctx, exported))
+	removed, err := e.ExportAnnotations(ctx)
+	require.NoError(t, err)
+	require.NoError(t, other.ImportAnnotations(ctx, removed))
+	a, err = other.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, []string{"note", "ticket"}, annotationKeys(a))
+
+	// read along with the history.
+	receipt, err := e.GetReceipt(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, []string{"note", "ticket"}, annotationKeys(receipt.Annotations))
+	history, err := e.History(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, "newer", history[0].Annotations["note"].Value)
+}
+
+func annotationKeys(a Annotations) []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestEngine_PublishWithDualPublisher(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DualPublisher),
+		WithHttpPublisherListenAddr("127.0.0.1:0"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	pubs, ok := e.publisher.(multiPublisher)
+	require.True(t, ok)
+	require.Len(t, pubs, 2)
+
+	c, err := e.PublishBytesData(ctx, []byte("dual"))
+	require.NoError(t, err)
+	require.Equal(t, c, e.getLatestMeta(ctx))
+}
+
+func TestEngine_ReplayUnannounced(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	local, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	require.NoError(t, local.Start(ctx))
+	cid1, err := local.PublishBytesData(ctx, []byte("local 1"))
+	require.NoError(t, err)
+	cid2, err := local.PublishBytesData(ctx, []byte("local 2"))
+	require.NoError(t, err)
+	require.NoError(t, local.Shutdown())
+
+	e, err := New(
+		WithDatastore(ds),
+		WithPublisherKind(HttpPublisher),
+		WithHttpPublisherListenAddr("127.0.0.1:0"),
+		WithReplayUnannounced(ReplayAll),
+	)
+	require.NoError(t, err)
+	cids, err := e.unannounced(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cid1, cid2}, cids)
+
+	require.NoError(t, e.Start(ctx))
+	last, err := e.getLastAnnounced(ctx)
+	require.NoError(t, err)
+	require.Equal(t, cid2, last)
+	cids, err = e.unannounced(ctx)
+	require.NoError(t, err)
+	require.Empty(t, cids)
+	require.Contains(t, e.cr.checkMap, cid1.String())
+
+	// the last announced metadata is no longer pushed, nothing is known to be unannounced.
+	require.NoError(t, e.ds.Put(ctx, dsLastAnnouncedKey, cid.NewCidV1(cid.Raw, cid2.Hash()).Bytes()))
+	cids, err = e.unannounced(ctx)
+	require.NoError(t, err)
+	require.Empty(t, cids)
+
+	// without record, the metadatas published until the start are taken as announced.
+	require.NoError(t, e.ds.Delete(ctx, dsLastAnnouncedKey))
+	cids, err = e.unannounced(ctx)
+	require.NoError(t, err)
+	require.Empty(t, cids)
+	require.NoError(t, e.Shutdown())
+	e, err = New(
+		WithDatastore(ds),
+		WithPublisherKind(HttpPublisher),
+		WithHttpPublisherListenAddr("127.0.0.1:0"),
+		WithReplayUnannounced(ReplayAll),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	last, err = e.getLastAnnounced(ctx)
+	require.NoError(t, err)
+	require.Equal(t, cid2, last)
+
+	_, err = New(WithReplayUnannounced("sometimes"))
+	require.Error(t, err)
+}
+
+func TestEngine_ReplayWithoutGossipPeers(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	local, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	require.NoError(t, local.Start(ctx))
+	cid1, err := local.PublishBytesData(ctx, []byte("local 1"))
+	require.NoError(t, err)
+	cid2, err := local.PublishBytesData(ctx, []byte("local 2"))
+	require.NoError(t, err)
+	require.NoError(t, local.Shutdown())
+
+	// the replayed announcements reach no peer, they are queued instead of failing the start.
+	e, err := New(
+		WithDatastore(ds),
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+		WithReplayUnannounced(ReplayAll),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	require.Equal(t, []cid.Cid{cid1, cid2}, e.QueuedAnnounces())
+
+	gossipPeer(ctx, t, e, e.pubTopicName)
+	require.NoError(t, e.FlushAnnounceQueue(ctx))
+	require.Empty(t, e.QueuedAnnounces())
+	last, err := e.getLastAnnounced(ctx)
+	require.NoError(t, err)
+	require.Equal(t, cid2, last)
+	require.Contains(t, e.cr.checkMap, cid1.String())
+}
+
+func TestEngine_FetchSignedHead(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pub, err := New(WithPublisherKind(HttpPublisher), WithHttpPublisherListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	require.NoError(t, pub.Start(ctx))
+	defer pub.Shutdown()
+	c, err := pub.PublishBytesData(ctx, []byte("head"))
+	require.NoError(t, err)
+	addr := pub.publisher.(interface{ Address() multiaddr.Multiaddr }).Address()
+
+	e, err := New()
+	require.NoError(t, err)
+	head, err := e.FetchSignedHead(ctx, addr, "")
+	require.NoError(t, err)
+	require.Equal(t, &SignedHead{Head: c, Signer: pub.h.ID()}, head)
+	head, err = e.FetchSignedHead(ctx, addr, pub.h.ID())
+	require.NoError(t, err)
+	require.Equal(t, c, head.Head)
+	_, err = e.FetchSignedHead(ctx, addr, e.h.ID())
+	require.ErrorIs(t, err, ErrUnexpectedSigner)
+
+	// heads that are not validly signed are rejected.
+	c2, err := pub.PublishBytesData(ctx, []byte("other head"))
+	require.NoError(t, err)
+	u, err := maurl.ToURL(addr)
+	require.NoError(t, err)
+	res, err := http.Get(u.String() + "/head")
+	require.NoError(t, err)
+	signed, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	for _, body := range [][]byte{[]byte("not a head"), bytes.Replace(signed, []byte(c2.String()), []byte(c.String()), 1)} {
+		body := body
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(body)
+		}))
+		srvURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		srvAddr, err := maurl.ToMA(srvURL)
+		require.NoError(t, err)
+		_, err = e.FetchSignedHead(ctx, *srvAddr, "")
+		srv.Close()
+		require.ErrorIs(t, err, ErrInvalidSignedHead)
+	}
+}
+
+func TestEngine_RecoverInterruptedPublish(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	e, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	e.publisher = &countingPublisher{}
+	announced, err := e.PublishBytesData(ctx, []byte("announced"))
+	require.NoError(t, err)
+	interrupted, err := ds.Has(ctx, dsPublishingKey)
+	require.NoError(t, err)
+	require.False(t, interrupted)
+
+	// a crash after storing the metadata leaves the publish marker behind.
+	require.NoError(t, e.beginPublish(ctx))
+	meta, err := e.newBytesMetadata(ctx, []byte("interrupted"), newPublishOptions())
+	require.NoError(t, err)
+	_, err = e.PublishLocal(ctx, *meta)
+	require.NoError(t, err)
+	head := e.getLatestMeta(ctx)
+	last, err := e.getLastAnnounced(ctx)
+	require.NoError(t, err)
+	require.Equal(t, announced, last)
+
+	// recovered whatever the replay mode.
+	restarted, err := New(WithDatastore(ds), WithPublisherKind(HttpPublisher), WithHttpPublisherListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	require.NoError(t, restarted.Start(ctx))
+	defer restarted.Shutdown()
+	last, err = restarted.getLastAnnounced(ctx)
+	require.NoError(t, err)
+	require.Equal(t, head, last)
+	require.Contains(t, restarted.cr.checkMap, head.String())
+	interrupted, err = ds.Has(ctx, dsPublishingKey)
+	require.NoError(t, err)
+	require.False(t, interrupted)
+}
+
+type flakyPublisher struct {
+	legs.Publisher
+	fail bool
+	root cid.Cid
+}
+
+func (p *flakyPublisher) UpdateRoot(_ context.Context, c cid.Cid) error {
+	if p.fail {
+		return errors.New("network unreachable")
+	}
+	p.root = c
+	return nil
+}
+
+func TestEngine_AnnounceQueue(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	pub := &flakyPublisher{fail: true}
+	e.publisher = pub
+
+	cid1, err := e.PublishBytesData(ctx, []byte("offline 1"))
+	require.NoError(t, err)
+	pub.fail = false
+	// queued behind the failed one to keep the order.
+	cid2, err := e.PublishBytesData(ctx, []byte("offline 2"))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cid1, cid2}, e.QueuedAnnounces())
+
+	restarted, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cid1, cid2}, restarted.QueuedAnnounces())
+
+	require.NoError(t, e.FlushAnnounceQueue(ctx))
+	require.Empty(t, e.QueuedAnnounces())
+	require.Equal(t, cid2, pub.root)
+	q, err := e.loadAnnounceQueue(ctx)
+	require.NoError(t, err)
+	require.Empty(t, q)
+
+	// the queue is flushed periodically on the engine clock.
+	fc := testutil.NewFakeClock(time.Now())
+	e, err = New(WithClock(fc), WithAnnounceFlushInterval(config.Duration(time.Minute)))
+	require.NoError(t, err)
+	pub = &flakyPublisher{fail: true}
+	e.publisher = pub
+	cid3, err := e.PublishBytesData(ctx, []byte("offline 3"))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cid3}, e.QueuedAnnounces())
+	pub.fail = false
+	// only the ticker flushes the queue.
+	<-e.flushCh
+	e.queueDone = make(chan struct{})
+	go e.runAnnounceQueue()
+	defer func() {
+		close(e.closing)
+		<-e.queueDone
+	}()
+	require.NoError(t, fc.BlockUntil(ctx, 1))
+	fc.Add(59 * time.Second)
+	require.Equal(t, []cid.Cid{cid3}, e.QueuedAnnounces())
+	fc.Add(time.Second)
+	requireTrueEventually(t, func() bool { return len(e.QueuedAnnounces()) == 0 }, 10*time.Millisecond, 5*time.Second,
+		"timed out waiting for the queue to be flushed")
+	require.Equal(t, cid3, pub.root)
+}
+
+func TestEngine_AnnounceWithoutGossipPeers(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	// pubsub publishes to the empty mesh without error, the announcement must be queued.
+	c, err := e.PublishBytesData(ctx, []byte("unreachable"))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{c}, e.QueuedAnnounces())
+	r, err := e.GetReceipt(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, AnnounceQueued, r.Announce)
+	require.Contains(t, r.AnnounceError, ErrNoAnnouncePeers.Error())
+	require.ErrorIs(t, e.FlushAnnounceQueue(ctx), ErrNoAnnouncePeers)
+	require.Equal(t, []cid.Cid{c}, e.QueuedAnnounces())
+
+	gossipPeer(ctx, t, e, e.pubTopicName)
+	require.NoError(t, e.FlushAnnounceQueue(ctx))
+	require.Empty(t, e.QueuedAnnounces())
+	r, err = e.GetReceipt(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, Announced, r.Announce)
+}
+
+type countingPublisher struct {
+	legs.Publisher
+	mutex sync.Mutex
+	roots []cid.Cid
+	root  cid.Cid
+}
+
+func (p *countingPublisher) UpdateRoot(_ context.Context, c cid.Cid) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.roots = append(p.roots, c)
+	return nil
+}
+
+func (p *countingPublisher) SetRoot(_ context.Context, c cid.Cid) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.root = c
+	return nil
+}
+
+func (p *countingPublisher) announced() []cid.Cid {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]cid.Cid(nil), p.roots...)
+}
+
+func TestEngine_RepublishLatestInterval(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	fc := testutil.NewFakeClock(time.Now())
+	e, err := New(WithRepublishLatestInterval(config.Duration(time.Hour)), WithClock(fc))
+	require.NoError(t, err)
+	pub := &countingPublisher{}
+	e.publisher = pub
+	c, err := e.PublishBytesData(ctx, []byte("head"))
+	require.NoError(t, err)
+	require.Len(t, pub.announced(), 1)
+
+	e.republishDone = make(chan struct{})
+	go e.republishLatestPeriodically()
+	require.NoError(t, fc.BlockUntil(ctx, 1))
+	for i := 2; i <= 4; i++ {
+		fc.Add(time.Hour)
+		requireTrueEventually(t, func() bool { return len(pub.announced()) == i }, time.Millisecond, 5*time.Second)
+	}
+	for _, root := range pub.announced() {
+		require.Equal(t, c, root)
+	}
+	close(e.closing)
+	<-e.republishDone
+
+	_, err = New(WithRepublishLatestInterval(-1))
+	require.Error(t, err)
+}
+
+func TestEngine_HttpAnnounce(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var mutex sync.Mutex
+	var received []dtsync.Message
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var msg dtsync.Message
+		require.NoError(t, msg.UnmarshalCBOR(r.Body))
+		received = append(received, msg)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	e, err := New(
+		WithHttpAnnounceURL(srv.URL+"/ingest/announce", time.Second),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+	)
+	require.NoError(t, err)
+	e.publisher = &countingPublisher{}
+
+	c, err := e.PublishBytesData(ctx, []byte("announced over http"))
+	require.NoError(t, err)
+	mutex.Lock()
+	require.Len(t, received, 1)
+	require.Equal(t, c, received[0].Cid)
+	require.Equal(t, e.h.ID().String(), received[0].OrigPeer)
+	addrs, err := received[0].GetAddrs()
+	require.NoError(t, err)
+	require.NotEmpty(t, addrs)
+	for _, a := range addrs {
+		info, err := peer.AddrInfoFromP2pAddr(a)
+		require.NoError(t, err)
+		require.Equal(t, e.h.ID(), info.ID)
+	}
+	fail = true
+	mutex.Unlock()
+
+	// failed http announcements are queued.
+	c, err = e.PublishBytesData(ctx, []byte("queued"))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{c}, e.QueuedAnnounces())
+
+	_, err = New(WithHttpAnnounceURL("ftp://pando", 0))
+	require.Error(t, err)
+}
+
+func TestEngine_Challenge(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithChallengeHandler(true))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	head, err := e.PublishBytesData(ctx, []byte("head"))
+	require.NoError(t, err)
+
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: e.h.ID(), Addrs: e.h.Addrs()}))
+
+	nonce := []byte("0123456789abcdef")
+	res, err := Challenge(ctx, h, e.h.ID(), nonce)
+	require.NoError(t, err)
+	require.Equal(t, head, res.Head)
+
+	// a tampered response does not verify.
+	res.Head = cid.Undef
+	require.Error(t, res.Verify(nonce))
+
+	_, err = Challenge(ctx, h, e.h.ID(), []byte("short"))
+	require.Error(t, err)
+}
+
+func TestEngine_Checkpoint(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	e.publisher = &countingPublisher{}
+	_, err = e.ExportCheckpoint(ctx)
+	require.ErrorIs(t, err, ErrNoPublishedMetadata)
+	_, err = e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	head, err := e.PublishBytesData(ctx, []byte("head"))
+	require.NoError(t, err)
+
+	cp, err := e.ExportCheckpoint(ctx)
+	require.NoError(t, err)
+	require.Equal(t, e.h.ID(), cp.PeerID)
+	require.Equal(t, head, cp.Head)
+	require.Equal(t, 2, cp.Length)
+
+	// verified offline from its exported form.
+	b, err := json.Marshal(cp)
+	require.NoError(t, err)
+	var exported Checkpoint
+	require.NoError(t, json.Unmarshal(b, &exported))
+	require.NoError(t, VerifyCheckpoint(&exported, ""))
+	require.NoError(t, VerifyCheckpoint(&exported, e.h.ID()))
+
+	other, err := New()
+	require.NoError(t, err)
+	require.ErrorIs(t, VerifyCheckpoint(&exported, other.h.ID()), ErrInvalidCheckpoint)
+	exported.Length = 1
+	require.ErrorIs(t, VerifyCheckpoint(&exported, ""), ErrInvalidCheckpoint)
+	exported.Length = cp.Length
+	exported.PeerID = other.h.ID()
+	require.ErrorIs(t, VerifyCheckpoint(&exported, ""), ErrInvalidCheckpoint)
+}
+
+func TestEngine_VerifyInclusion(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pando, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName("/pando/verify"),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	require.NoError(t, pando.Start(ctx))
+	defer pando.Shutdown()
+	e, err := New(WithTopicName("/pando/verify"), WithPandoAddrinfo(peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}))
+	require.NoError(t, err)
+	c, err := e.PublishBytesData(ctx, []byte("included"))
+	require.NoError(t, err)
+	other, err := e.PublishBytesData(ctx, []byte("not in snapshot"))
+	require.NoError(t, err)
+
+	// the snapshot blocks are served by the data transfer of Pando.
+	storeSnapshot := func(height int64, metas ...cid.Cid) cid.Cid {
+		n, err := qp.BuildMap(basicnode.Prototype.Map, 4, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Update", qp.Map(1, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, e.h.ID().String(), qp.Map(1, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "MetaList", qp.List(int64(len(metas)), func(la datamodel.ListAssembler) {
+						for _, mc := range metas {
+							qp.ListEntry(la, qp.Link(cidlink.Link{Cid: mc}))
+						}
+					}))
+				}))
+			}))
+			qp.MapEntry(ma, "Height", qp.Int(height))
+			qp.MapEntry(ma, "CreateTime", qp.Int(7))
+			qp.MapEntry(ma, "PrevSnapShot", qp.String(""))
+		})
+		require.NoError(t, err)
+		lp := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: multihash.SHA2_256, MhLength: -1}}
+		lnk, err := pando.lsys.Store(ipld.LinkContext{Ctx: ctx}, lp, n)
+		require.NoError(t, err)
+		return lnk.(cidlink.Link).Cid
+	}
+	snapshotCid := storeSnapshot(3, c)
+	reported := snapshotCid
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{} = pandoapi.Snapshot{
+			// the snapshot listed by the json answer is not trusted.
+			Update:     map[string]*pandoapi.Metalist{e.h.ID().String(): {MetaList: []cid.Cid{c, other}}},
+			Height:     3,
+			CreateTime: 7,
+		}
+		if r.URL.Path == "/metadata/inclusion" {
+			metaCid, err := cid.Decode(r.URL.Query().Get("cid"))
+			require.NoError(t, err)
+			data = MetaInclusion{
+				ID:             metaCid,
+				Provider:       e.h.ID().String(),
+				InPando:        true,
+				InSnapShot:     true,
+				SnapShotID:     reported,
+				SnapShotHeight: 3,
+			}
+		}
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	inclusion, err := e.VerifyInclusion(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), inclusion.SnapShotHeight)
+
+	_, err = e.VerifyInclusion(ctx, other)
+	require.True(t, errors.Is(err, ErrNotIncluded))
+
+	reported = storeSnapshot(4, c, other)
+	_, err = e.VerifyInclusion(ctx, other)
+	require.True(t, errors.Is(err, ErrInclusionMismatch))
+	reported = snapshotCid
+
+	// once included, the metadata is deleted locally and its signature is checked on the one of
+	// Pando.
+	b, err := e.bs.Get(ctx, c)
+	require.NoError(t, err)
+	require.NoError(t, e.bs.Delete(ctx, c))
+	require.NoError(t, pando.bs.Put(ctx, c, b))
+	inclusion, err = e.VerifyInclusion(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, snapshotCid, inclusion.SnapShotID)
+	has, err := e.bs.Has(ctx, c)
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func TestEngine_WaitForInclusion(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+		WithCheckInterval(config.Duration(20*time.Millisecond)),
+	)
+	require.NoError(t, err)
+	var included int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c, InPando: atomic.LoadInt32(&included) == 1})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+
+	c, err := e.PublishBytesData(ctx, []byte("wait"))
+	require.NoError(t, err)
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = e.WaitForInclusion(waitCtx, c)
+	cancel()
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+
+	done := make(chan *MetaInclusion)
+	go func() {
+		inclusion, err := e.WaitForInclusion(ctx, c)
+		require.NoError(t, err)
+		done <- inclusion
+	}()
+	atomic.StoreInt32(&included, 1)
+	require.True(t, (<-done).ID.Equals(c))
+
+	// c is no longer pending, Pando is queried directly.
+	inclusion, err := e.WaitForInclusion(ctx, c)
+	require.NoError(t, err)
+	require.True(t, inclusion.InPando)
+	atomic.StoreInt32(&included, 0)
+	_, err = e.WaitForInclusion(ctx, c)
+	require.True(t, errors.Is(err, ErrNotIncluded), err)
+}
+
+func TestEngine_BackupStatus(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	sealed, err := e.PublishBytesData(ctx, []byte("sealed"))
+	require.NoError(t, err)
+	pending, err := e.PublishBytesData(ctx, []byte("not in snapshot"))
+	require.NoError(t, err)
+
+	snapshotCid, err := cid.Decode("bafy2bzacebxvzutul3nqhdalyxqphxyrpw2xfxa4dfuiew5uhyg2phln444us")
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		var data interface{}
+		switch r.URL.Path {
+		case "/metadata/inclusion":
+			data = MetaInclusion{ID: c, InPando: true, InSnapShot: c.Equals(sealed), SnapShotID: snapshotCid, SnapShotHeight: 5}
+		case "/metadata/backup":
+			require.Equal(t, snapshotCid, c)
+			data = pandoapi.SnapshotBackup{SnapShotID: c, IsBackup: true, Deals: []BackupDeal{
+				{DealID: 1, Miner: "f01000", State: "StorageDealSealing"},
+				{DealID: 2, Miner: "f02000", State: "StorageDealActive", Sealed: true},
+			}}
+		}
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	status, err := e.BackupStatus(ctx, sealed)
+	require.NoError(t, err)
+	require.True(t, status.InSnapshot)
+	require.Equal(t, uint64(5), status.SnapshotHeight)
+	require.True(t, status.BackedUp)
+	require.True(t, status.Sealed)
+	require.Equal(t, uint64(2), status.DealID)
+	require.Equal(t, "f02000", status.Miner)
+	require.Len(t, status.Deals, 2)
+
+	status, err = e.BackupStatus(ctx, pending)
+	require.NoError(t, err)
+	require.False(t, status.InSnapshot)
+	require.False(t, status.BackedUp)
+}
+
+func TestEngine_WalkChain(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	for _, depth := range []int{0, 4} {
+		e, err := New(WithPrefetchDepth(depth))
+		require.NoError(t, err)
+		var published []cid.Cid
+		for i := 0; i < 20; i++ {
+			c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("meta %d", i)))
+			require.NoError(t, err)
+			published = append([]cid.Cid{c}, published...)
+		}
+
+		var walked []cid.Cid
+		err = e.WalkChain(ctx, cid.Undef, func(c cid.Cid, meta *schema.Metadata) error {
+			walked = append(walked, c)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, published, walked)
+
+		stop := errors.New("stop")
+		walked = nil
+		err = e.WalkChain(ctx, published[5], func(c cid.Cid, meta *schema.Metadata) error {
+			walked = append(walked, c)
+			if len(walked) == 3 {
+				return stop
+			}
+			return nil
+		})
+		require.Equal(t, stop, err)
+		require.Equal(t, published[5:8], walked)
+	}
+}
+
+func TestEngine_VerifyAncestor(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	_, err = e.VerifyAncestor(ctx, cid.Undef, cid.Undef, 0)
+	require.Equal(t, ErrNoPublishedMetadata, err)
+	_, err = e.RePublishLatest(ctx)
+	require.True(t, errors.Is(err, ErrNoPublishedMetadata))
+
+	var published []cid.Cid
+	for i := 0; i < 5; i++ {
+		c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("meta %d", i)))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	require.Equal(t, published[4], e.Head())
+
+	check, err := e.VerifyAncestor(ctx, cid.Undef, published[1], 0)
+	require.NoError(t, err)
+	require.True(t, check.IsAncestor)
+	require.Equal(t, 3, check.Distance)
+	require.Equal(t, published[4], check.Head)
+
+	check, err = e.VerifyAncestor(ctx, published[2], published[2], 0)
+	require.NoError(t, err)
+	require.True(t, check.IsAncestor)
+	require.Equal(t, 0, check.Distance)
+
+	// later metadatas are not ancestors.
+	check, err = e.VerifyAncestor(ctx, published[2], published[3], 0)
+	require.NoError(t, err)
+	require.False(t, check.IsAncestor)
+	require.False(t, check.Truncated)
+	require.Equal(t, -1, check.Distance)
+
+	check, err = e.VerifyAncestor(ctx, cid.Undef, published[0], 2)
+	require.NoError(t, err)
+	require.False(t, check.IsAncestor)
+	require.True(t, check.Truncated)
+}
+
+func TestEngine_SyncSnapshots(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	c1, err := e.PublishBytesData(ctx, []byte("in snapshot 1"))
+	require.NoError(t, err)
+	c2, err := e.PublishBytesData(ctx, []byte("not in snapshot"))
+	require.NoError(t, err)
+
+	snapshotCid, err := cid.Decode("bafy2bzacebxvzutul3nqhdalyxqphxyrpw2xfxa4dfuiew5uhyg2phln444us")
+	require.NoError(t, err)
+	var listed int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{} = []cid.Cid{snapshotCid}
+		switch r.URL.Path {
+		case "/metadata/list":
+			atomic.AddInt32(&listed, 1)
+		case "/metadata/snapshot":
+			data = pandoapi.Snapshot{
+				Update: map[string]*pandoapi.Metalist{e.h.ID().String(): {MetaList: []cid.Cid{c1}}},
+				Height: 1,
+			}
+		case "/metadata/inclusion":
+			data = MetaInclusion{ID: c2, InPando: true}
+		}
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	n, err := e.SyncSnapshots(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	n, err = e.SyncSnapshots(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	si, err := e.SnapshotOf(ctx, c1)
+	require.NoError(t, err)
+	require.Equal(t, &SnapshotInclusion{SnapshotCid: snapshotCid, Height: 1}, si)
+	si, err = e.SnapshotOf(ctx, c2)
+	require.NoError(t, err)
+	require.Nil(t, si)
+	height, ok, err := e.LatestSnapshotHeight(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), height)
+	_, err = e.GetSnapshot(ctx, snapshotCid)
+	require.NoError(t, err)
+
+	// followed on the clock of the engine.
+	fc := testutil.NewFakeClock(time.Now())
+	e, err = New(WithPandoAPIClient(srv.URL, time.Second), WithSnapshotFollowInterval(config.Duration(time.Hour)), WithClock(fc))
+	require.NoError(t, err)
+	atomic.StoreInt32(&listed, 0)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	requireTrueEventually(t, func() bool { return atomic.LoadInt32(&listed) != 0 }, 10*time.Millisecond, 5*time.Second)
+	synced := atomic.LoadInt32(&listed)
+	fc.Add(time.Hour)
+	requireTrueEventually(t, func() bool { return atomic.LoadInt32(&listed) > synced }, 10*time.Millisecond, 5*time.Second)
+}
+
+func TestEngine_Freeze(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	fc := testutil.NewFakeClock(time.Now())
+	e, err := New(WithDatastore(ds), WithAuditLog(true), WithClock(fc))
+	require.NoError(t, err)
+	require.Nil(t, e.Frozen())
+	require.Nil(t, e.Status(ctx).Freeze)
+	ch, err := e.Chain(ctx, "frozen")
+	require.NoError(t, err)
+
+	// a publish in progress on a named chain completes first.
+	ch.mutex.Lock()
+	frozen := make(chan error, 1)
+	go func() { frozen <- e.Freeze(ctx, "legal hold") }()
+	select {
+	case err = <-frozen:
+		t.Fatalf("freeze returned during a publish: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	ch.mutex.Unlock()
+	require.NoError(t, <-frozen)
+	require.True(t, errors.Is(e.Freeze(ctx, "again"), ErrAlreadyFrozen))
+	status := e.Status(ctx)
+	require.True(t, status.Frozen)
+	require.Equal(t, &FreezeState{Reason: "legal hold", Since: fc.Now()}, status.Freeze)
+	_, err = ch.PublishBytesData(ctx, []byte("rejected"))
+	require.True(t, errors.Is(err, ErrFrozen))
+	_, err = e.PublishBytesData(ctx, []byte("rejected"))
+	require.True(t, errors.Is(err, ErrFrozen))
+	var frozenErr *FrozenError
+	require.True(t, errors.As(err, &frozenErr))
+	require.Equal(t, "legal hold", frozenErr.Reason)
+	require.Empty(t, e.pushList)
+
+	restarted, err := New(WithDatastore(ds), WithAuditLog(true))
+	require.NoError(t, err)
+	require.NotNil(t, restarted.Frozen())
+	require.NoError(t, restarted.Unfreeze(ctx))
+	require.Equal(t, ErrNotFrozen, restarted.Unfreeze(ctx))
+	_, err = restarted.PublishBytesData(ctx, []byte("accepted"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, restarted.ExportAuditLog(ctx, &buf))
+	var ops []AuditOp
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry AuditLogEntry
+		require.NoError(t, dec.Decode(&entry))
+		ops = append(ops, entry.Op)
+	}
+	require.Equal(t, []AuditOp{AuditFreeze, AuditUnfreeze, AuditPublish}, ops)
+}
+
+func TestSubscriber_Follow(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	topic := "/pando/follow"
+
+	pub, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName(topic))
+	require.NoError(t, err)
+	require.NoError(t, pub.Start(ctx))
+	defer pub.Shutdown()
+
+	e, err := New(WithSubTopicName(topic))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	require.NoError(t, e.h.Connect(ctx, peer.AddrInfo{ID: pub.h.ID(), Addrs: pub.h.Addrs()}))
+
+	var mutex sync.Mutex
+	var got []cid.Cid
+	e.Subscriber().Follow(pub.h.ID(), func(provider peer.ID, c cid.Cid, meta *schema.Metadata) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		require.Equal(t, pub.h.ID().String(), meta.Provider)
+		got = append(got, c)
+	})
+	gotEventually := func(want []cid.Cid) {
+		requireTrueEventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(got) == len(want)
+		}, 100*time.Millisecond, 10*time.Second, "timed out waiting for followed metadatas")
+		mutex.Lock()
+		defer mutex.Unlock()
+		require.Equal(t, want, got)
+	}
+
+	cid1, err := pub.PublishBytesData(ctx, []byte("followed 1"))
+	require.NoError(t, err)
+	cid2, err := pub.PublishBytesData(ctx, []byte("followed 2"))
+	require.NoError(t, err)
+	_, err = e.Subscriber().SyncProvider(ctx, pub.h.ID(), nil)
+	require.NoError(t, err)
+	gotEventually([]cid.Cid{cid1, cid2})
+	latest, ok := e.Subscriber().LatestSync(pub.h.ID())
+	require.True(t, ok)
+	require.Equal(t, cid2, latest)
+
+	// only the metadatas after the latest sync are handled.
+	cid3, err := pub.PublishBytesData(ctx, []byte("followed 3"))
+	require.NoError(t, err)
+	_, err = e.Subscriber().SyncProvider(ctx, pub.h.ID(), nil)
+	require.NoError(t, err)
+	gotEventually([]cid.Cid{cid1, cid2, cid3})
+}
+
+func TestEngine_ListenAddrs(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	_, err := New(WithListenAddrs(TransportQUIC, "/ip4/127.0.0.1/tcp/0"))
+	require.Error(t, err)
+	_, err = New(WithListenAddrs(TransportWebTransport, "/ip4/127.0.0.1/udp/0/quic"))
+	require.Error(t, err)
+
+	e, err := New(
+		WithListenAddrs(TransportQUIC, "/ip4/127.0.0.1/udp/0/quic"),
+		WithListenAddrs(TransportWebSocket, "/ip4/127.0.0.1/tcp/0/ws"),
+	)
+	require.NoError(t, err)
+	byTransport := make(map[Transport][]multiaddr.Multiaddr)
+	for _, addr := range e.h.Addrs() {
+		for _, tr := range []Transport{TransportTCP, TransportQUIC, TransportWebSocket} {
+			if ok, _ := isTransportAddr(tr, addr); ok {
+				byTransport[tr] = append(byTransport[tr], addr)
+			}
+		}
+	}
+	require.Empty(t, byTransport[TransportTCP])
+	require.Len(t, byTransport[TransportQUIC], 1)
+	require.Len(t, byTransport[TransportWebSocket], 1)
+
+	other, err := New()
+	require.NoError(t, err)
+	require.NoError(t, other.h.Connect(ctx, peer.AddrInfo{ID: e.h.ID(), Addrs: byTransport[TransportWebSocket]}))
+}
+
+func TestEngine_NATTraversal(t *testing.T) {
+	_, err := New(WithStaticRelays("/ip4/127.0.0.1/tcp/9020"))
+	require.Error(t, err)
+	_, err = New(WithReachability("unknown"))
+	require.Error(t, err)
+
+	relay, err := New(
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"),
+		WithReachability(ReachabilityPublic),
+		WithRelayService(true),
+		WithAutoNATService(true),
+	)
+	require.NoError(t, err)
+	requireTrueEventually(t, func() bool {
+		for _, p := range relay.h.Mux().Protocols() {
+			if p == "/libp2p/circuit/relay/0.2.0/hop" {
+				return true
+			}
+		}
+		return false
+	}, 50*time.Millisecond, 5*time.Second, "timed out waiting for the relay service")
+
+	relayAddr := fmt.Sprintf("%s/p2p/%s", relay.h.Addrs()[0], relay.h.ID())
+	e, err := New(
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"),
+		WithReachability(ReachabilityPrivate),
+		WithStaticRelays(relayAddr),
+		WithHolePunching(true),
+	)
+	require.NoError(t, err)
+	// the relayed addresses of loopback relays are not advertised, only the reservation is.
+	requireTrueEventually(t, func() bool {
+		return len(relay.h.Network().ConnsToPeer(e.h.ID())) != 0
+	}, 100*time.Millisecond, 10*time.Second, "timed out waiting for the relay reservation")
+}
+
+func TestEngine_AnnounceMessage(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	topic := "/pando/inspected"
+	e, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName(topic),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"), WithExtraGossipData([]byte("extra")))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	_, err = e.LastAnnounceMessage()
+	require.ErrorIs(t, err, ErrNoAnnounceMessage)
+	_, err = e.NextAnnounceMessage(ctx)
+	require.ErrorIs(t, err, ErrNoPublishedMetadata)
+
+	consumer, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer consumer.Close()
+	ps, err := pubsub.NewGossipSub(ctx, consumer)
+	require.NoError(t, err)
+	consumerTopic, err := ps.Join(topic)
+	require.NoError(t, err)
+	subscription, err := consumerTopic.Subscribe()
+	require.NoError(t, err)
+	require.NoError(t, consumer.Connect(ctx, peer.AddrInfo{ID: e.h.ID(), Addrs: e.h.Addrs()}))
+	requireTrueEventually(t, func() bool {
+		return len(e.ps.ListPeers(topic)) != 0
+	}, 10*time.Millisecond, 5*time.Second, "timed out waiting for the consumer to subscribe")
+
+	c, err := e.PublishBytesData(ctx, []byte("inspected"))
+	require.NoError(t, err)
+	next, err := e.NextAnnounceMessage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, c, next.Cid)
+	require.Equal(t, topic, next.Topic)
+	require.Equal(t, []byte("extra"), next.ExtraData)
+	require.NotEmpty(t, next.Addrs)
+	require.True(t, next.Sent.IsZero())
+
+	last, err := e.LastAnnounceMessage()
+	require.NoError(t, err)
+	require.Equal(t, next.Cid, last.Cid)
+	require.ElementsMatch(t, next.Addrs, last.Addrs)
+	require.False(t, last.Sent.IsZero())
+	// the message is the one received by the consumers.
+	received, err := subscription.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, last.Encoded, received.GetData())
+
+	httpOnly, err := New(WithPublisherKind(HttpPublisher), WithHttpPublisherListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	require.NoError(t, httpOnly.Start(ctx))
+	defer httpOnly.Shutdown()
+	_, err = httpOnly.NextAnnounceMessage(ctx)
+	require.ErrorIs(t, err, ErrNotGossiping)
+}
+
+func TestEngine_AnnounceValidation(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	topic := "/pando/validated"
+	scoring := DefaultGossipScoring()
+	scoring.PublishThreshold = 0
+	_, err := New(WithGossipScoring(scoring))
+	require.Error(t, err)
+	_, err = New(WithAllowedAnnouncers("not-a-peer"))
+	require.Error(t, err)
+
+	var mutex sync.Mutex
+	var validated []cid.Cid
+	e, err := New(WithPublisherKind(DataTransferPublisher), WithSubTopicName(topic),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"), WithGossipScoring(DefaultGossipScoring()),
+		WithAnnounceValidator(func(_ context.Context, _ peer.ID, msg *dtsync.Message) pubsub.ValidationResult {
+			mutex.Lock()
+			defer mutex.Unlock()
+			validated = append(validated, msg.Cid)
+			return pubsub.ValidationAccept
+		}))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	// the own announcements are not validated.
+	_, err = e.PublishBytesData(ctx, []byte("own"))
+	require.NoError(t, err)
+
+	spammer, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer spammer.Close()
+	ps, err := pubsub.NewGossipSub(ctx, spammer)
+	require.NoError(t, err)
+	spamTopic, err := ps.Join(topic)
+	require.NoError(t, err)
+	require.NoError(t, spammer.Connect(ctx, peer.AddrInfo{ID: e.h.ID(), Addrs: e.h.Addrs()}))
+	requireTrueEventually(t, func() bool {
+		return len(spamTopic.ListPeers()) != 0
+	}, 10*time.Millisecond, 5*time.Second, "timed out waiting for the engine to subscribe to the topic")
+
+	// the invalid announcements are rejected before the validators run.
+	require.NoError(t, spamTopic.Publish(ctx, []byte("spam")))
+	c, err := cid.Decode("bafkreie4qjuxuhmsipld5ajyl3ll2qugmaavcudywq2a7pdmnrpcm3mqwe")
+	require.NoError(t, err)
+	msg := dtsync.Message{Cid: c}
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, msg.MarshalCBOR(buf))
+	require.NoError(t, spamTopic.Publish(ctx, buf.Bytes()))
+	requireTrueEventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(validated) != 0
+	}, 10*time.Millisecond, 5*time.Second, "timed out waiting for the announcement validation")
+	mutex.Lock()
+	require.Equal(t, []cid.Cid{c}, validated)
+	mutex.Unlock()
+
+	// only the allowed announcers are accepted.
+	allowed, err := New(WithSubTopicName(topic), WithAllowedAnnouncers(e.h.ID().String()))
+	require.NoError(t, err)
+	require.NoError(t, allowed.Start(ctx))
+	defer allowed.Shutdown()
+	m := &pubsub.Message{Message: &pubsubpb.Message{From: []byte(spammer.ID()), Data: buf.Bytes()}}
+	require.Equal(t, pubsub.ValidationReject, allowed.validateAnnouncement(ctx, spammer.ID(), m))
+	m.From = []byte(e.h.ID())
+	require.Equal(t, pubsub.ValidationAccept, allowed.validateAnnouncement(ctx, e.h.ID(), m))
+}
+
+func TestEngine_SyncAll(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	topic := "/pando/syncall"
+	pando, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName(topic),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	require.NoError(t, pando.Start(ctx))
+	defer pando.Shutdown()
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := pando.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	head := published[2].String()
+
+	newSyncer := func(o ...Option) *Engine {
+		o = append(o, WithTopicName(topic), WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"),
+			WithPandoAddrinfo(peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}))
+		e, err := New(o...)
+		require.NoError(t, err)
+		require.NoError(t, e.Start(ctx))
+		t.Cleanup(func() { _ = e.Shutdown() })
+		require.NoError(t, e.h.Connect(ctx, peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}))
+		return e
+	}
+	e := newSyncer()
+	_, err = e.Sync(ctx, head, -2, "")
+	require.Error(t, err)
+	synced, err := e.Sync(ctx, head, SyncDepthAll, "")
+	require.NoError(t, err)
+	require.ElementsMatch(t, published, synced)
+
+	limited := newSyncer(WithSyncLimits(2, 0))
+	_, err = limited.Sync(ctx, head, SyncDepthAll, "")
+	require.ErrorIs(t, err, ErrSyncLimitExceeded)
+	// the sync stops once the limit is exceeded.
+	limited = newSyncer(WithSyncLimits(-1, 10))
+	_, err = limited.Sync(ctx, head, SyncDepthAll, "")
+	require.ErrorIs(t, err, ErrSyncLimitExceeded)
+	has, err := limited.bs.Has(ctx, published[0])
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// the limits of a sync override the ones of the engine, the partial results are returned.
+	partial, err := newSyncer().Sync(ctx, head, SyncDepthAll, "", WithMaxSyncBlocks(1))
+	var limitErr *SyncLimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, "blocks", limitErr.Limit)
+	require.Equal(t, int64(1), limitErr.Max)
+	require.Equal(t, []cid.Cid{published[2], published[1]}, partial)
+	require.Equal(t, partial, limitErr.Synced)
+	require.Equal(t, 2, limitErr.Blocks)
+	require.NotZero(t, limitErr.Bytes)
+	synced, err = limited.Sync(ctx, head, SyncDepthAll, "", WithMaxSyncBytes(-1))
+	require.NoError(t, err)
+	require.ElementsMatch(t, published, synced)
+}
+
+func TestEngine_SyncInto(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pando, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName("/pando/syncinto"),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	require.NoError(t, pando.Start(ctx))
+	defer pando.Shutdown()
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := pando.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	e, err := New(WithTopicName("/pando/syncinto"), WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"),
+		WithPandoAddrinfo(peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	newLinkSystem := func() (ipld.LinkSystem, *memstore.Store) {
+		store := &memstore.Store{}
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.SetReadStorage(store)
+		lsys.SetWriteStorage(store)
+		return lsys, store
+	}
+	lsys, store := newLinkSystem()
+	synced, err := e.SyncInto(ctx, lsys, published[2].String(), SyncDepthAll, "")
+	require.NoError(t, err)
+	require.ElementsMatch(t, published, synced)
+	for _, c := range published {
+		has, err := store.Has(ctx, cidlink.Link{Cid: c}.Binary())
+		require.NoError(t, err)
+		require.True(t, has)
+		// the engine stores nothing.
+		has, err = e.bs.Has(ctx, c)
+		require.NoError(t, err)
+		require.False(t, has)
+	}
+
+	lsys, store = newLinkSystem()
+	synced, err = e.SyncInto(ctx, lsys, published[2].String(), SyncDepthAll, "", WithMaxSyncBlocks(1))
+	require.ErrorIs(t, err, ErrSyncLimitExceeded)
+	require.Equal(t, []cid.Cid{published[2], published[1]}, synced)
+	has, err := store.Has(ctx, cidlink.Link{Cid: published[0]}.Binary())
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func TestEngine_SyncToCAR(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pando, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName("/pando/synccar"),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	require.NoError(t, pando.Start(ctx))
+	defer pando.Shutdown()
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := pando.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":{"Cid":"%s"}}`, published[2])
+	}))
+	defer srv.Close()
+	e, err := New(WithTopicName("/pando/synccar"), WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"),
+		WithPandoAddrinfo(peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}),
+		WithPandoAPIClient(srv.URL, time.Second))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, e.SyncToCAR(ctx, pando.h.ID().String(), SyncDepthAll, buf))
+
+	r := bufio.NewReader(buf)
+	readSection := func() []byte {
+		size, err := binary.ReadUvarint(r)
+		require.NoError(t, err)
+		b := make([]byte, size)
+		_, err = io.ReadFull(r, b)
+		require.NoError(t, err)
+		return b
+	}
+	nb := basicnode.Prototype.Map.NewBuilder()
+	require.NoError(t, dagcbor.Decode(nb, bytes.NewReader(readSection())))
+	header := nb.Build()
+	roots, err := header.LookupByString("roots")
+	require.NoError(t, err)
+	root, err := roots.LookupByIndex(0)
+	require.NoError(t, err)
+	rootLink, err := root.AsLink()
+	require.NoError(t, err)
+	require.Equal(t, published[2], rootLink.(cidlink.Link).Cid)
+	var blocks []cid.Cid
+	for {
+		if _, err := r.Peek(1); err == io.EOF {
+			break
+		}
+		section := readSection()
+		n, c, err := cid.CidFromBytes(section)
+		require.NoError(t, err)
+		// the blocks are written as fetched, verified by their cid.
+		sum, err := c.Prefix().Sum(section[n:])
+		require.NoError(t, err)
+		require.Equal(t, c, sum)
+		blocks = append(blocks, c)
+	}
+	require.ElementsMatch(t, published, blocks)
+}
+
+func TestEngine_SyncWithProvider(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pando, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName("/pando/syncprovider"),
+		WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	require.NoError(t, pando.Start(ctx))
+	defer pando.Shutdown()
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := pando.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/provider/head", r.URL.Path)
+		require.Equal(t, pando.h.ID().String(), r.URL.Query().Get("peerid"))
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":{"Cid":"%s"}}`, published[2])
+	}))
+	defer srv.Close()
+
+	newSyncer := func() *Engine {
+		e, err := New(WithTopicName("/pando/syncprovider"), WithListenAddrs(TransportTCP, "/ip4/127.0.0.1/tcp/0"),
+			WithPandoAddrinfo(peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}),
+			WithPandoAPIClient(srv.URL, time.Second))
+		require.NoError(t, err)
+		require.NoError(t, e.Start(ctx))
+		t.Cleanup(func() { _ = e.Shutdown() })
+		require.NoError(t, e.h.Connect(ctx, peer.AddrInfo{ID: pando.h.ID(), Addrs: pando.h.Addrs()}))
+		return e
+	}
+
+	res, err := newSyncer().SyncWithProvider(ctx, pando.h.ID().String(), SyncDepthAll, "")
+	require.NoError(t, err)
+	require.Equal(t, pando.h.ID().String(), res.Provider)
+	require.Equal(t, published[2], res.Head)
+	require.Equal(t, 3, res.Height)
+	require.ElementsMatch(t, published, res.Synced)
+
+	// the partial result is returned with the limit error.
+	res, err = newSyncer().SyncWithProvider(ctx, pando.h.ID().String(), SyncDepthAll, "", WithMaxSyncBlocks(1))
+	require.ErrorIs(t, err, ErrSyncLimitExceeded)
+	require.Equal(t, published[2], res.Head)
+	require.Equal(t, 2, res.Height)
+	require.Equal(t, []cid.Cid{published[2], published[1]}, res.Synced)
+}
+
+func TestEngine_AddrBook(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	pando, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer pando.Close()
+	manual, err := test.RandPeerID()
+	require.NoError(t, err)
+	manualAddr := multiaddr.StringCast("/ip4/10.0.0.1/tcp/9020")
+	expiring, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	_, err = New(WithAddrBookTTL(config.Duration(-time.Second)))
+	require.Error(t, err)
+	e, err := New(WithDatastore(ds), WithPandoAddrinfo(peer.AddrInfo{ID: pando.ID(), Addrs: pando.Addrs()}),
+		WithPandoConnectivity(true))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	require.NoError(t, e.AddPeerAddrs(ctx, peer.AddrInfo{ID: manual, Addrs: []multiaddr.Multiaddr{manualAddr}}, 0))
+	require.NoError(t, e.AddPeerAddrs(ctx, peer.AddrInfo{ID: expiring, Addrs: []multiaddr.Multiaddr{manualAddr}}, time.Millisecond))
+	require.Error(t, e.AddPeerAddrs(ctx, peer.AddrInfo{ID: manual}, 0))
+	require.NoError(t, e.Shutdown())
+
+	// the addresses are known again after a restart, the expired ones are dropped.
+	restarted, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	require.NoError(t, restarted.Start(ctx))
+	defer restarted.Shutdown()
+	require.ElementsMatch(t, pando.Addrs(), restarted.h.Peerstore().Addrs(pando.ID()))
+	require.Equal(t, []multiaddr.Multiaddr{manualAddr}, restarted.h.Peerstore().Addrs(manual))
+	require.Empty(t, restarted.h.Peerstore().Addrs(expiring))
+	entries, err := restarted.AddrBook(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, a := range entries {
+		if a.ID == manual {
+			require.True(t, a.Manual)
+			require.True(t, a.Expires.IsZero())
+		} else {
+			require.Equal(t, pando.ID(), a.ID)
+			require.False(t, a.Manual)
+			require.False(t, a.Expires.IsZero())
+		}
+	}
+
+	require.NoError(t, restarted.RemovePeerAddrs(ctx, manual))
+	require.Empty(t, restarted.h.Peerstore().Addrs(manual))
+	require.ErrorIs(t, restarted.RemovePeerAddrs(ctx, manual), ErrNotInAddrBook)
+}
+
+func TestEngine_PandoConnectivity(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pando, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer pando.Close()
+
+	e, err := New(
+		WithPandoAddrinfo(peer.AddrInfo{ID: pando.ID(), Addrs: pando.Addrs()}),
+		WithPandoConnectivity(true),
+		WithPandoRedialBackoff(config.Duration(10*time.Millisecond), config.Duration(50*time.Millisecond)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	connected := func() bool {
+		return e.h.Network().Connectedness(pando.ID()) == network.Connected
+	}
+	requireTrueEventually(t, connected, 10*time.Millisecond, 5*time.Second, "timed out waiting for the connection to Pando")
+	status := e.Status(ctx).Pando
+	require.True(t, status.Connected)
+	require.True(t, status.Protected)
+	redials := status.Redials
+
+	// the connection is re-dialed once dropped.
+	require.NoError(t, pando.Network().ClosePeer(e.h.ID()))
+	requireTrueEventually(t, func() bool {
+		return connected() && e.Status(ctx).Pando.Redials > redials
+	}, 10*time.Millisecond, 5*time.Second, "timed out waiting for the re-dial of Pando")
+	require.False(t, e.Status(ctx).Pando.LastDisconnect.IsZero())
+}
+
+func TestEngine_DataTransferTuning(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	topic := "/pando/tuned"
+	_, err := New(WithDataTransferTimeouts(config.Duration(-time.Second), 0))
+	require.Error(t, err)
+
+	tuning := []Option{
+		WithGraphsyncMaxInProgressRequests(2),
+		WithDataTransferRestartPolicy(1, config.Duration(time.Second)),
+		WithDataTransferTimeouts(config.Duration(10*time.Second), config.Duration(10*time.Second)),
+	}
+	pub, err := New(append(tuning, WithPublisherKind(DataTransferPublisher), WithTopicName(topic))...)
+	require.NoError(t, err)
+	require.NoError(t, pub.Start(ctx))
+	defer pub.Shutdown()
+	// the publisher and the subscriber get their own tuned instances.
+	require.Len(t, pub.dtClosers, 2)
+
+	e, err := New(append(tuning, WithSubTopicName(topic))...)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	require.Len(t, e.dtClosers, 1)
+	require.NoError(t, e.h.Connect(ctx, peer.AddrInfo{ID: pub.h.ID(), Addrs: pub.h.Addrs()}))
+
+	c, err := pub.PublishBytesData(ctx, []byte("tuned"))
+	require.NoError(t, err)
+	synced, err := e.Subscriber().SyncProvider(ctx, pub.h.ID(), nil)
+	require.NoError(t, err)
+	require.Equal(t, c, synced)
+}
+
+func TestEngine_Mirror(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	topic := "/pando/mirror"
+
+	pub, err := New(WithPublisherKind(DataTransferPublisher), WithTopicName(topic))
+	require.NoError(t, err)
+	require.NoError(t, pub.Start(ctx))
+	defer pub.Shutdown()
+	cid1, err := pub.PublishBytesData(ctx, []byte("mirrored 1"))
+	require.NoError(t, err)
+	cid2, err := pub.PublishBytesData(ctx, []byte("mirrored 2"))
+	require.NoError(t, err)
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds), WithSubTopicName(topic))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	require.NoError(t, e.h.Connect(ctx, peer.AddrInfo{ID: pub.h.ID(), Addrs: pub.h.Addrs()}))
+
+	spec := MirrorSpec{Provider: pub.h.ID().String(), ServeAddr: "127.0.0.1:0"}
+	m, err := e.StartMirror(ctx, spec)
+	require.NoError(t, err)
+	_, err = e.StartMirror(ctx, spec)
+	require.True(t, errors.Is(err, ErrAlreadyMirrored))
+	requireTrueEventually(t, func() bool {
+		return m.Head() == cid2
+	}, 100*time.Millisecond, 10*time.Second, "timed out waiting for mirrored head")
+	for _, c := range []cid.Cid{cid1, cid2} {
+		meta, err := e.loadMetadata(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, pub.h.ID().String(), meta.Provider)
+	}
+
+	// the mirrored chain is re-served with the head signed by the mirror.
+	syncer, err := httpsync.NewSync(cidlink.DefaultLinkSystem(), http.DefaultClient, nil).NewSyncer(e.h.ID(), m.Address(), nil)
+	require.NoError(t, err)
+	head, err := syncer.GetHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, cid2, head)
+
+	// mirrors are resumed after a restart.
+	require.NoError(t, e.Shutdown())
+	e, err = New(WithDatastore(ds), WithSubTopicName(topic))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	mirrors := e.Mirrors()
+	require.Len(t, mirrors, 1)
+	require.Equal(t, spec, mirrors[0].MirrorSpec)
+	require.Equal(t, cid2, mirrors[0].Head)
+
+	require.NoError(t, e.StopMirror(ctx, pub.h.ID()))
+	require.Empty(t, e.Mirrors())
+	require.True(t, errors.Is(e.StopMirror(ctx, pub.h.ID()), ErrNotMirrored))
+}
+
+func TestEngine_Bridge(t *testing.T) {
+	ctx := contextWithTimeout(t)
+
+	// an index-provider publishing its advertisements over httpsync.
+	ipHost, err := libp2p.New()
+	require.NoError(t, err)
+	defer ipHost.Close()
+	store := &memstore.Store{}
+	adLsys := cidlink.DefaultLinkSystem()
+	adLsys.SetReadStorage(store)
+	adLsys.SetWriteStorage(store)
+	adPub, err := httpsync.NewPublisher("127.0.0.1:0", adLsys, ipHost.ID(), ipHost.Peerstore().PrivKey(ipHost.ID()))
+	require.NoError(t, err)
+	defer adPub.Close()
+	adProto := cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: cid.DagJSON, MhType: multihash.SHA2_256, MhLength: -1}}
+	entries := cid.NewCidV1(cid.Raw, multihash.Multihash(test.RandPeerIDFatal(t)))
+	var adHead cid.Cid
+	publishAd := func(contextID string) cid.Cid {
+		ad, err := qp.BuildMap(basicnode.Prototype.Map, 7, func(ma datamodel.MapAssembler) {
+			if adHead.Defined() {
+				qp.MapEntry(ma, "PreviousID", qp.Link(cidlink.Link{Cid: adHead}))
+			}
+			qp.MapEntry(ma, "Provider", qp.String(ipHost.ID().String()))
+			qp.MapEntry(ma, "Addresses", qp.List(1, func(la datamodel.ListAssembler) {
+				qp.ListEntry(la, qp.String("/ip4/127.0.0.1/tcp/3104"))
+			}))
+			qp.MapEntry(ma, "Signature", qp.Bytes([]byte("signature")))
+			qp.MapEntry(ma, "Entries", qp.Link(cidlink.Link{Cid: entries}))
+			qp.MapEntry(ma, "ContextID", qp.Bytes([]byte(contextID)))
+			qp.MapEntry(ma, "IsRm", qp.Bool(false))
+		})
+		require.NoError(t, err)
+		lnk, err := adLsys.Store(ipld.LinkContext{Ctx: ctx}, adProto, ad)
+		require.NoError(t, err)
+		adHead = lnk.(cidlink.Link).Cid
+		require.NoError(t, adPub.SetRoot(ctx, adHead))
+		return adHead
+	}
+	ad1 := publishAd("deal 1")
+	ad2 := publishAd("deal 2")
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithPublisherKind(DataTransferPublisher), WithDatastore(ds), WithBridgeSyncInterval(config.Duration(100*time.Millisecond)))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	addr := adPub.Address()
+	spec := BridgeSpec{Provider: ipHost.ID().String(), Addr: addr.String()}
+	b, err := e.StartBridge(ctx, spec)
+	require.NoError(t, err)
+	_, err = e.StartBridge(ctx, spec)
+	require.ErrorIs(t, err, ErrAlreadyBridged)
+	requireTrueEventually(t, func() bool {
+		return b.Status().Head == ad2
+	}, 50*time.Millisecond, 10*time.Second, "timed out waiting for bridged advertisements")
+	require.Equal(t, 2, b.Status().Bridged)
+	require.Equal(t, e.getLatestMeta(ctx), b.Status().Meta)
+
+	// the advertisements are notarized oldest first, their links as cids.
+	require.Len(t, e.pushList, 2)
+	for i, ad := range []cid.Cid{ad1, ad2} {
+		meta, err := e.loadMetadata(ctx, e.pushList[i])
+		require.NoError(t, err)
+		v, err := meta.Payload.LookupByString("Advertisement")
+		require.NoError(t, err)
+		s, err := v.AsString()
+		require.NoError(t, err)
+		require.Equal(t, ad.String(), s)
+	}
+	meta, err := e.loadMetadata(ctx, b.Status().Meta)
+	require.NoError(t, err)
+	v, err := meta.Payload.LookupByString("Entries")
+	require.NoError(t, err)
+	s, err := v.AsString()
+	require.NoError(t, err)
+	require.Equal(t, entries.String(), s)
+	v, err = meta.Payload.LookupByString("Type")
+	require.NoError(t, err)
+	s, err = v.AsString()
+	require.NoError(t, err)
+	require.Equal(t, BridgePayloadType, s)
+	_, err = meta.Payload.LookupByString("PreviousID")
+	require.Error(t, err)
+
+	ad3 := publishAd("deal 3")
+	requireTrueEventually(t, func() bool {
+		return b.Status().Head == ad3
+	}, 50*time.Millisecond, 10*time.Second, "timed out waiting for new advertisement")
+	require.Equal(t, 3, b.Status().Bridged)
+	require.Len(t, e.pushList, 3)
+
+	// bridges are resumed after a restart from the latest notarized advertisement.
+	require.NoError(t, e.Shutdown())
+	e, err = New(WithPublisherKind(DataTransferPublisher), WithDatastore(ds), WithBridgeSyncInterval(config.Duration(100*time.Millisecond)))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	bridges := e.Bridges()
+	require.Len(t, bridges, 1)
+	require.Equal(t, spec, bridges[0].BridgeSpec)
+	require.Equal(t, ad3, bridges[0].Head)
+	require.Equal(t, 3, bridges[0].Bridged)
+	time.Sleep(300 * time.Millisecond)
+	require.Len(t, e.pushList, 3)
+
+	require.NoError(t, e.StopBridge(ctx, ipHost.ID()))
+	require.Empty(t, e.Bridges())
+	require.ErrorIs(t, e.StopBridge(ctx, ipHost.ID()), ErrNotBridged)
+	_, err = New(WithBridgeSyncInterval(0))
+	require.Error(t, err)
+}
+
+func TestEngine_BlockHook(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var mutex sync.Mutex
+	seen := make(map[cid.Cid][]byte)
+	e, err := New(WithBlockHook(func(c cid.Cid, data []byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		seen[c] = append([]byte(nil), data...)
+	}))
+	require.NoError(t, err)
+
+	c, err := e.PublishBytesData(ctx, []byte("hooked"))
+	require.NoError(t, err)
+	mutex.Lock()
+	stored, ok := seen[c]
+	mutex.Unlock()
+	require.True(t, ok)
+	b, err := e.ds.Get(ctx, datastore.NewKey(c.String()))
+	require.NoError(t, err)
+	require.Equal(t, b, stored)
+
+	mutex.Lock()
+	seen = make(map[cid.Cid][]byte)
+	mutex.Unlock()
+	_, err = e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Contains(t, seen, c)
+
+	_, err = New(WithBlockHook(nil))
+	require.Error(t, err)
+}
+
+func TestEngine_ChainStats(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+
+	shared := basicnode.NewBytes([]byte("shared payload block"))
+	lnk, err := e.lsys.Store(ipld.LinkContext{Ctx: ctx}, schema.LinkProto, shared)
+	require.NoError(t, err)
+	_, err = e.lsys.Store(ipld.LinkContext{Ctx: ctx}, schema.LinkProto, shared)
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("meta"))
+	require.NoError(t, err)
+
+	stats := e.ChainStats(ctx)
+	require.Equal(t, 1, stats.Metadatas)
+	require.Equal(t, uint64(2), stats.Blocks)
+	require.Equal(t, uint64(1), stats.DedupHits)
+	require.NotZero(t, stats.DedupBytesSaved)
+	require.Greater(t, stats.DedupRatio, 0.0)
+
+	restarted, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+	require.Equal(t, stats, restarted.ChainStats(ctx))
+	has, err := ds.Has(ctx, datastore.NewKey(lnk.(cidlink.Link).Cid.String()))
+	require.NoError(t, err)
+	require.True(t, has)
+}
+
+func TestEngine_Blockstore(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	blocks := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds), WithBlockstore(NewDsBlockstore(blocks)))
+	require.NoError(t, err)
+
+	c, err := e.PublishBytesData(ctx, []byte("cached metadata"))
+	require.NoError(t, err)
+	key := datastore.NewKey(c.String())
+	has, err := blocks.Has(ctx, key)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = ds.Has(ctx, key)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// the head is served from the block cache once it is off the blockstore.
+	require.NoError(t, blocks.Delete(ctx, key))
+	data, err := e.CatCid(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, []byte("cached metadata"), data)
+
+	uncached, err := New(WithBlockstore(NewDsBlockstore(blocks)), WithBlockCacheSize(-1))
+	require.NoError(t, err)
+	c, err = uncached.PublishBytesData(ctx, []byte("uncached metadata"))
+	require.NoError(t, err)
+	require.NoError(t, blocks.Delete(ctx, datastore.NewKey(c.String())))
+	_, err = uncached.loadMetadata(ctx, c)
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+
+	_, err = New(WithBlockstore(nil))
+	require.Error(t, err)
+}
+
+func TestEngine_InclusionLatency(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metaCid, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: metaCid, InPando: true})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	c, err := e.PublishBytesData(ctx, []byte("pending meta"))
+	require.NoError(t, err)
+	require.NoError(t, e.cr.addCheck(c))
+	status := e.cr.checkMap[c.String()]
+	status.PublishedAt = status.PublishedAt.Add(-time.Minute)
+	e.cr.updatePendingMetrics()
+	require.Equal(t, 1.0, gaugeValue(t, "pando_client_inclusion_pending"))
+	require.GreaterOrEqual(t, gaugeValue(t, "pando_client_inclusion_oldest_pending_age_seconds"), 60.0)
+
+	count, sum := histogramSamples(t, "pando_client_inclusion_latency_seconds")
+	require.NoError(t, e.cr.checkSyncStatuses(map[string]*syncStatus{c.String(): status}))
+	e.cr.updatePendingMetrics()
+	newCount, newSum := histogramSamples(t, "pando_client_inclusion_latency_seconds")
+	require.Equal(t, count+1, newCount)
+	require.GreaterOrEqual(t, newSum-sum, 60.0)
+	require.Equal(t, 0.0, gaugeValue(t, "pando_client_inclusion_pending"))
+	require.Equal(t, 0.0, gaugeValue(t, "pando_client_inclusion_oldest_pending_age_seconds"))
+}
+
+func TestEngine_InclusionBatches(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithInclusionBatchSize(2))
+	require.NoError(t, err)
+	var batches, singles int32
+	var batchSupported int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		switch r.URL.Path {
+		case "/metadata/inclusions":
+			if atomic.LoadInt32(&batchSupported) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			atomic.AddInt32(&batches, 1)
+			var req struct{ Cids []string }
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			var inclusions []MetaInclusion
+			// the last cid of each batch is unknown to Pando.
+			for _, s := range req.Cids[:len(req.Cids)-1] {
+				c, err := cid.Decode(s)
+				require.NoError(t, err)
+				inclusions = append(inclusions, MetaInclusion{ID: c, InPando: true})
+			}
+			data = inclusions
+		case "/metadata/inclusion":
+			atomic.AddInt32(&singles, 1)
+			c, err := cid.Decode(r.URL.Query().Get("cid"))
+			require.NoError(t, err)
+			data = MetaInclusion{ID: c, InPando: true}
+		}
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	check := func(n int) {
+		m := make(map[string]*syncStatus)
+		for i := 0; i < n; i++ {
+			c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("batched %d %d", n, i)))
+			require.NoError(t, err)
+			require.NoError(t, e.cr.addCheck(c))
+			m[c.String()] = e.cr.checkMap[c.String()]
+		}
+		require.NoError(t, e.cr.checkSyncStatuses(m))
+		require.Empty(t, e.cr.checkMap)
+	}
+
+	check(5)
+	require.Equal(t, int32(3), atomic.LoadInt32(&batches))
+	require.Equal(t, int32(3), atomic.LoadInt32(&singles))
+
+	atomic.StoreInt32(&batchSupported, 0)
+	atomic.StoreInt32(&singles, 0)
+	check(3)
+	require.Equal(t, int32(3), atomic.LoadInt32(&singles))
+}
+
+func TestEngine_InclusionCheckWorkers(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithInclusionCheckWorkers(4),
+		WithInclusionCheckTimeout(config.Duration(100*time.Millisecond)),
+	)
+	require.NoError(t, err)
+	slow, err := e.PublishBytesData(ctx, []byte("slow"))
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		if c.Equals(slow) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		b, err := json.Marshal(MetaInclusion{ID: c, InPando: true})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Minute)(e.options))
+
+	m := make(map[string]*syncStatus)
+	for i := 0; i < 10; i++ {
+		c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("fast %d", i)))
+		require.NoError(t, err)
+		require.NoError(t, e.cr.addCheck(c))
+		m[c.String()] = e.cr.checkMap[c.String()]
+	}
+	require.NoError(t, e.cr.addCheck(slow))
+	m[slow.String()] = e.cr.checkMap[slow.String()]
+
+	start := time.Now()
+	require.NoError(t, e.cr.checkSyncStatuses(m))
+	require.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	require.Len(t, e.cr.checkMap, 1)
+	require.Contains(t, e.cr.checkMap, slow.String())
+
+	_, err = New(WithInclusionCheckWorkers(0))
+	require.Error(t, err)
+}
+
+func TestEngine_InclusionCheckWorkersPersist(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithInclusionCheckWorkers(4))
+	require.NoError(t, err)
+	e.publisher = &countingPublisher{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Minute)(e.options))
+
+	m := make(map[string]*syncStatus)
+	for i := 0; i < 10; i++ {
+		c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("pending %d", i)))
+		require.NoError(t, err)
+		m[c.String()] = e.cr.checkMap[c.String()]
+	}
+
+	// the check list is persisted while the workers update the statuses of the checks.
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.NoError(t, e.cr.persistCheckList(ctx))
+		}
+	}()
+	require.NoError(t, e.cr.checkSyncStatuses(m))
+	close(stop)
+	<-done
+	e.cr.checkMutex.Lock()
+	defer e.cr.checkMutex.Unlock()
+	for _, status := range e.cr.checkMap {
+		require.Equal(t, 1, status.Attempts)
+	}
+}
+
+func TestEngine_CheckBackoff(t *testing.T) {
+	e, err := New(
+		WithCheckInterval(config.Duration(time.Minute)),
+		WithMaxCheckBackoff(config.Duration(5*time.Minute)),
+	)
+	require.NoError(t, err)
+	now := time.Now()
+	status := &syncStatus{}
+	require.True(t, e.cr.due(status, now))
+
+	for attempts, backoff := range map[int]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: 5 * time.Minute,
+		9: 5 * time.Minute,
+	} {
+		status = &syncStatus{Attempts: attempts, LastChecked: now}
+		require.False(t, e.cr.due(status, now.Add(backoff-time.Minute/5)), attempts)
+		require.True(t, e.cr.due(status, now.Add(backoff)), attempts)
+	}
+
+	require.NoError(t, WithMaxCheckBackoff(0)(e.options))
+	require.True(t, e.cr.due(&syncStatus{Attempts: 5, LastChecked: now}, now))
+}
+
+func TestEngine_CheckerClock(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var queries int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := testutil.NewFakeClock(start)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+		WithCheckInterval(config.Duration(time.Minute)),
+		WithMaxCheckBackoff(config.Duration(4*time.Minute)),
+		WithMaxCheckAttempts(4),
+		WithPandoAPIClient(srv.URL, time.Second),
+		WithClock(fc),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+	c, err := e.PublishBytesData(ctx, []byte("clocked"))
+	require.NoError(t, err)
+	require.NoError(t, fc.BlockUntil(ctx, 1))
+
+	// advance moves the clock and waits for the check pass it triggers.
+	advance := func(d time.Duration) {
+		fc.Add(d)
+		requireTrueEventually(t, func() bool { return e.cr.lastRunTime().Equal(fc.Now()) }, time.Millisecond, 5*time.Second)
+		e.cr.passMutex.Lock()
+		e.cr.passMutex.Unlock()
+	}
+	for _, step := range []struct {
+		advance time.Duration
+		queries int32
+	}{
+		{time.Minute, 1},
+		{time.Minute, 2},
+		// backing off for 2 minutes.
+		{time.Minute, 2},
+		{time.Minute, 3},
+		// backing off for 4 minutes, the last attempt.
+		{2 * time.Minute, 3},
+		{2 * time.Minute, 4},
+	} {
+		advance(step.advance)
+		require.Equal(t, step.queries, atomic.LoadInt32(&queries), fc.Now())
+	}
+	require.False(t, e.cr.has(c))
+	dls, err := e.ListDeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dls, 1)
+	require.Equal(t, start, dls[0].PublishedAt)
+	require.Equal(t, start.Add(8*time.Minute), dls[0].DeadAt)
+
+	_, err = New(WithClock(nil))
+	require.Error(t, err)
+}
+
+// memValueStore is a routing.ValueStore keeping the values in memory.
+type memValueStore struct {
+	mutex  sync.Mutex
+	values map[string][]byte
+}
+
+func (vs *memValueStore) PutValue(_ context.Context, key string, value []byte, _ ...routing.Option) error {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	vs.values[key] = value
+	return nil
+}
+
+func (vs *memValueStore) GetValue(_ context.Context, key string, _ ...routing.Option) ([]byte, error) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	v, ok := vs.values[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return v, nil
+}
+
+func (vs *memValueStore) SearchValue(ctx context.Context, key string, o ...routing.Option) (<-chan []byte, error) {
+	ch := make(chan []byte, 1)
+	if v, err := vs.GetValue(ctx, key, o...); err == nil {
+		ch <- v
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestEngine_PublishIPNS(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	vs := &memValueStore{values: make(map[string][]byte)}
+	e, err := New(WithIPNSPublishing(vs, 0))
+	require.NoError(t, err)
+	require.ErrorIs(t, e.PublishIPNS(ctx), ErrNoPublishedMetadata)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	for _, data := range []string{"ipns 1", "ipns 2"} {
+		c, err := e.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			head, err := e.ResolveIPNS(ctx, e.h.ID())
+			return err == nil && head.Equals(c)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	seq, err := e.nextIPNSSequence(ctx)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, seq, uint64(2))
+	require.Equal(t, "/ipns/"+e.h.ID().String(), e.IPNSName())
+
+	record, err := vs.GetValue(ctx, ipnsRoutingKey(e.h.ID()))
+	require.NoError(t, err)
+	_, err = openIPNSRecord(record, e.h.ID(), time.Now().Add(25*time.Hour))
+	require.Error(t, err)
+	other, err := New()
+	require.NoError(t, err)
+	require.NoError(t, vs.PutValue(ctx, ipnsRoutingKey(other.h.ID()), record))
+	_, err = e.ResolveIPNS(ctx, other.h.ID())
+	require.ErrorIs(t, err, ErrInvalidIPNSRecord)
+
+	_, err = other.ResolveIPNS(ctx, e.h.ID())
+	require.ErrorIs(t, err, ErrIPNSDisabled)
+}
+
+// blockingValueStore blocks the puts until their context is done.
+type blockingValueStore struct {
+	memValueStore
+	puts chan struct{}
+}
+
+func (vs *blockingValueStore) PutValue(ctx context.Context, _ string, _ []byte, _ ...routing.Option) error {
+	vs.puts <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestEngine_ShutdownDuringIPNSPublish(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	vs := &blockingValueStore{memValueStore: memValueStore{values: make(map[string][]byte)}, puts: make(chan struct{}, 1)}
+	e, err := New(WithIPNSPublishing(vs, 0))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	_, err = e.PublishBytesData(ctx, []byte("ipns"))
+	require.NoError(t, err)
+	select {
+	case <-vs.puts:
+	case <-ctx.Done():
+		t.Fatal("IPNS record was not published")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- e.Shutdown() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown blocked by the IPNS publish")
+	}
+}
+
+func TestEngine_HeadExporter(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var mutex sync.Mutex
+	var exported, failing []cid.Cid
+	e, err := New(
+		WithHeadExporter(headexport.Func(func(ctx context.Context, head cid.Cid) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			exported = append(exported, head)
+			return nil
+		})),
+		WithHeadExporter(headexport.Func(func(ctx context.Context, head cid.Cid) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failing = append(failing, head)
+			if len(failing) == 1 {
+				return fmt.Errorf("unavailable")
+			}
+			return nil
+		})))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+
+	var heads []cid.Cid
+	for _, data := range []string{"export 1", "export 2"} {
+		c, err := e.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		heads = append(heads, c)
+		require.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(exported) == len(heads) && len(failing) == len(heads)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, heads, exported)
+	require.Equal(t, heads, failing)
+}
+
+func TestEngine_SetCheckInterval(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithCheckInterval(config.Duration(time.Hour)))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	deals, err := e.Chain(ctx, "deals")
+	require.NoError(t, err)
+	require.Zero(t, e.cr.lastRunTime())
+
+	require.Error(t, e.SetCheckInterval(0))
+	require.NoError(t, e.SetCheckInterval(10*time.Millisecond))
+	require.Equal(t, 10*time.Millisecond, e.CheckInterval())
+	for _, cr := range []*checkRegistry{e.cr, deals.cr} {
+		require.Eventually(t, func() bool { return !cr.lastRunTime().IsZero() }, time.Second, 10*time.Millisecond)
+	}
+	logs, err := e.Chain(ctx, "logs")
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Millisecond, logs.cr.checkInterval)
+}
+
+func TestEngine_PauseChecker(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var queries, included int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c, InPando: atomic.LoadInt32(&included) != 0})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+		WithCheckInterval(config.Duration(10*time.Millisecond)),
+		WithPandoAPIClient(srv.URL, time.Second),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.PauseChecker())
+	require.ErrorIs(t, e.PauseChecker(), ErrCheckerPaused)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+	c, err := e.PublishBytesData(ctx, []byte("paused"))
+	require.NoError(t, err)
+	require.True(t, e.cr.has(c))
+	require.True(t, e.Status(ctx).CheckerPaused)
+	time.Sleep(100 * time.Millisecond)
+	require.Zero(t, atomic.LoadInt32(&queries))
+
+	res, err := e.CheckNow(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &CheckResult{Checked: 1, Pending: 1}, res)
+	require.Equal(t, int32(1), atomic.LoadInt32(&queries))
+
+	atomic.StoreInt32(&included, 1)
+	require.NoError(t, e.ResumeChecker())
+	require.ErrorIs(t, e.ResumeChecker(), ErrCheckerNotPaused)
+	require.Eventually(t, func() bool { return !e.cr.has(c) }, time.Second, 10*time.Millisecond)
+	require.False(t, e.Status(ctx).CheckerPaused)
+}
+
+func TestEngine_DeadLetters(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+		WithMaxCheckAttempts(2),
+	)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+
+	c, err := e.PublishBytesData(ctx, []byte("never included"))
+	require.NoError(t, err)
+	deadLetter := func() {
+		for i := 0; i < 2; i++ {
+			e.cr.checkMutex.Lock()
+			m := map[string]*syncStatus{c.String(): e.cr.checkMap[c.String()]}
+			e.cr.checkMutex.Unlock()
+			require.NoError(t, e.cr.checkSyncStatuses(m))
+		}
+		require.False(t, e.cr.has(c))
+	}
+
+	deadLetter()
+	list, err := e.ListDeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, c, list[0].Cid)
+	require.Equal(t, 2, list[0].Attempts)
+
+	require.NoError(t, e.RetryDeadLetter(ctx, c))
+	require.True(t, e.cr.has(c))
+	list, err = e.ListDeadLetters(ctx)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	deadLetter()
+	require.NoError(t, e.DropDeadLetter(ctx, c))
+	list, err = e.ListDeadLetters(ctx)
+	require.NoError(t, err)
+	require.Empty(t, list)
+	require.True(t, errors.Is(e.DropDeadLetter(ctx, c), ErrNotDeadLettered))
+	require.True(t, errors.Is(e.RetryDeadLetter(ctx, c), ErrNotDeadLettered))
+}
+
+func TestEngine_CheckFork(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var pandoHead atomic.Value
+	pandoHead.Store(cid.Undef)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		head := pandoHead.Load().(cid.Cid)
+		if !head.Defined() {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"code":404,"message":"provider not found"}`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":{"Cid":"%s"}}`, head)
+	}))
+	defer srv.Close()
+	alerts := make(chan alert.Alert, 10)
+	e, err := New(
+		WithPandoAPIClient(srv.URL, time.Second),
+		WithForkDetection(0, true),
+		WithAlerter(alert.Func(func(ctx context.Context, a alert.Alert) error {
+			alerts <- a
+			return nil
+		})),
+	)
+	require.NoError(t, err)
+	pub := &countingPublisher{}
+	e.publisher = pub
+	require.Nil(t, e.LastForkCheck())
+
+	check, err := e.CheckFork(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ForkUnknown, check.State)
+	first, err := e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	head, err := e.PublishBytesData(ctx, []byte("head"))
+	require.NoError(t, err)
+
+	pandoHead.Store(first)
+	check, err = e.CheckFork(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ForkBehind, check.State)
+	require.Equal(t, 1, check.Behind)
+	require.Equal(t, head, check.LocalHead)
+	require.Equal(t, first, check.PandoHead)
+
+	// metadatas of the chain known by Pando only, stored locally not to sync them.
+	storeUnpushed := func(data string, previous cid.Cid) cid.Cid {
+		meta, err := e.newBytesMetadata(ctx, []byte(data), newPublishOptions(WithPreviousLink(previous)))
+		require.NoError(t, err)
+		n, err := meta.ToNode()
+		require.NoError(t, err)
+		lnk, err := e.lsys.Store(ipld.LinkContext{Ctx: ctx}, schema.LinkProto, n)
+		require.NoError(t, err)
+		return lnk.(cidlink.Link).Cid
+	}
+
+	// e.g. a rollback, the chains share first only.
+	forked := storeUnpushed("forked 2", storeUnpushed("forked 1", first))
+	pandoHead.Store(forked)
+	for i := 0; i < 2; i++ {
+		check, err = e.CheckFork(ctx)
+		require.NoError(t, err)
+		require.Equal(t, ForkDiverged, check.State)
+		require.Equal(t, first, check.Common)
+		require.Equal(t, 2, check.Ahead)
+		require.Equal(t, 1, check.Behind)
+		require.True(t, check.Healed)
+	}
+	announced := pub.announced()
+	require.Equal(t, []cid.Cid{first, head, head, head}, announced)
+	a := <-alerts
+	require.Equal(t, alert.Fork, a.Kind)
+	require.Equal(t, forked, a.Cid)
+
+	pandoHead.Store(head)
+	check, err = e.CheckFork(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ForkInSync, check.State)
+	require.Equal(t, check, e.Status(ctx).Fork)
+	pandoHead.Store(forked)
+	_, err = e.CheckFork(ctx)
+	require.NoError(t, err)
+	// alerted again once back in sync.
+	a = <-alerts
+	require.Equal(t, alert.Fork, a.Kind)
+	require.Empty(t, alerts)
+
+	// e.g. the datastore was restored from an old backup: the stale head is not re-announced.
+	pandoHead.Store(head)
+	_, err = e.CheckFork(ctx)
+	require.NoError(t, err)
+	later := storeUnpushed("later", head)
+	pandoHead.Store(later)
+	check, err = e.CheckFork(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ForkAhead, check.State)
+	require.Equal(t, head, check.Common)
+	require.Equal(t, 1, check.Ahead)
+	require.False(t, check.Healed)
+	require.Len(t, pub.announced(), 5)
+	a = <-alerts
+	require.Equal(t, later, a.Cid)
+
+	// the chain known by Pando can not be walked, nothing is re-announced.
+	foreign := cid.NewCidV1(cid.Raw, head.Hash())
+	pandoHead.Store(foreign)
+	check, err = e.CheckFork(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ForkDiverged, check.State)
+	require.False(t, check.Healed)
+	require.Len(t, pub.announced(), 5)
+
+	// checked periodically.
+	fc := testutil.NewFakeClock(time.Now())
+	e, err = New(
+		WithPublisherKind(DataTransferPublisher),
+		WithPandoAPIClient(srv.URL, time.Second),
+		WithForkDetection(config.Duration(time.Hour), false),
+		WithClock(fc),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	require.NoError(t, fc.BlockUntil(ctx, 2))
+	fc.Add(time.Hour)
+	requireTrueEventually(t, func() bool { return e.LastForkCheck() != nil }, 10*time.Millisecond, 5*time.Second)
+	require.Equal(t, ForkDiverged, e.LastForkCheck().State)
+	require.False(t, e.LastForkCheck().Healed)
+
+	_, err = New(WithForkDetection(-1, false))
+	require.Error(t, err)
+}
+
+func TestEngine_Alerts(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	alerts := make(chan alert.Alert, 10)
+	e, err := New(
+		WithMaxCheckAttempts(1),
+		WithBacklogAlertThreshold(2),
+		WithAlerter(alert.Func(func(ctx context.Context, a alert.Alert) error {
+			alerts <- a
+			return nil
+		})),
+	)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	m := make(map[string]*syncStatus)
+	for i := 0; i < 4; i++ {
+		c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("backlog %d", i)))
+		require.NoError(t, err)
+		require.NoError(t, e.cr.addCheck(c))
+		m[c.String()] = e.cr.checkMap[c.String()]
+	}
+	// the backlog is alerted once when it rises above 2.
+	a := <-alerts
+	require.Equal(t, alert.Backlog, a.Kind)
+	require.Equal(t, 3, a.Backlog)
+	require.Equal(t, e.h.ID().String(), a.Provider)
+
+	require.NoError(t, e.cr.checkSyncStatuses(m))
+	for i := 0; i < 4; i++ {
+		a = <-alerts
+		require.Equal(t, alert.DeadLetter, a.Kind)
+		require.Contains(t, m, a.Cid.String())
+	}
+	select {
+	case a = <-alerts:
+		require.FailNow(t, "unexpected alert", a.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func gaugeValue(t *testing.T, name string) float64 {
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	require.FailNow(t, "metric not found", name)
+	return 0
+}
+
+func histogramSamples(t *testing.T, name string) (uint64, float64) {
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == name {
+			h := f.GetMetric()[0].GetHistogram()
+			return h.GetSampleCount(), h.GetSampleSum()
+		}
+	}
+	require.FailNow(t, "metric not found", name)
+	return 0, 0
+}
+
+func TestEngine_CheckIntegrity(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds), WithPersistAfterSend(true))
+	require.NoError(t, err)
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := e.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	report, err := e.CheckIntegrity(ctx, false)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+
+	// truncate the pushed cid list and add a check that was never pushed.
+	require.NoError(t, e.updatePushedList(ctx, published[:1]))
+	stray, err := e.PreviewCid(ctx, []byte("stray"))
+	require.NoError(t, err)
+	require.NoError(t, e.cr.addCheck(stray))
+	require.NoError(t, e.cr.persistCheckList(ctx))
+
+	e, err = New(WithDatastore(ds), WithPersistAfterSend(true))
+	require.NoError(t, err)
+	report, err = e.CheckIntegrity(ctx, false)
+	require.NoError(t, err)
+	require.False(t, report.MissingHead)
+	require.True(t, report.PushListMismatch)
+	require.Equal(t, []cid.Cid{stray}, report.StrayChecks)
+	require.False(t, report.Repaired)
+	require.Equal(t, published[:1], e.pushList)
+
+	e, err = New(WithDatastore(ds), WithPersistAfterSend(true), WithIntegrityRepair(true))
+	require.NoError(t, err)
+	require.Equal(t, published, e.pushList)
+	require.NotContains(t, e.cr.checkMap, stray.String())
+	list, err := e.GetPushedList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, published, list)
+
+	// a head that does not resolve falls back to the latest pushed cid that does.
+	require.NoError(t, ds.Delete(ctx, datastore.NewKey(published[2].String())))
+	e, err = New(WithDatastore(ds), WithPersistAfterSend(true), WithIntegrityRepair(true))
+	require.NoError(t, err)
+	require.Equal(t, published[1], e.getLatestMeta(ctx))
+	require.Equal(t, published[:2], e.pushList)
+	report, err = e.CheckIntegrity(ctx, false)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+}
+
+func TestEngine_ReindexFromChain(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithPersistAfterSend(true))
+	require.NoError(t, err)
+	list, err := e.ReindexFromChain(ctx)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := e.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	require.NoError(t, e.updatePushedList(ctx, []cid.Cid{published[2], published[0]}))
+
+	list, err = e.ReindexFromChain(ctx)
+	require.NoError(t, err)
+	require.Equal(t, published, list)
+	list, err = e.GetPushedList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, published, list)
+
+	// a broken chain leaves the list unchanged.
+	require.NoError(t, e.bs.Delete(ctx, published[1]))
+	_, err = e.ReindexFromChain(ctx)
+	require.Error(t, err)
+	require.Equal(t, published, e.pushList)
+}
+
+func TestEngine_Audit(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	var published []cid.Cid
+	for i := 0; i < auditBatchSize+4; i++ {
+		c, err := e.PublishBytesData(ctx, []byte(fmt.Sprintf("meta %d", i)))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	missing, pending, failing := published[1], published[auditBatchSize+2], published[auditBatchSize]
+	require.NoError(t, e.cr.addCheck(pending))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metaCid, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		if metaCid.Equals(failing) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		inPando := !metaCid.Equals(missing) && !metaCid.Equals(pending)
+		b, err := json.Marshal(MetaInclusion{ID: metaCid, InPando: inPando})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	report, err := e.Audit(ctx)
+	require.NoError(t, err)
+	require.Equal(t, len(published), report.Total)
+	require.Equal(t, len(published)-3, report.Included)
+	require.Equal(t, []AuditEntry{{Cid: missing}, {Cid: pending, InCheckList: true}}, report.Missing)
+	require.Len(t, report.Unconfirmed, 1)
+	require.Equal(t, failing, report.Unconfirmed[0].Cid)
+	require.NotEmpty(t, report.Unconfirmed[0].Err)
+}
+
+func TestEngine_SnapshotOf(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	c, err := e.PublishBytesData(ctx, []byte("anchored"))
+	require.NoError(t, err)
+	snapshotCid, err := cid.Decode("bafy2bzacebxvzutul3nqhdalyxqphxyrpw2xfxa4dfuiew5uhyg2phln444us")
+	require.NoError(t, err)
+
+	var queries int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		b, err := json.Marshal(MetaInclusion{ID: c, InPando: true, InSnapShot: true, SnapShotID: snapshotCid, SnapShotHeight: 12})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	for i := 0; i < 2; i++ {
+		si, err := e.SnapshotOf(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, &SnapshotInclusion{SnapshotCid: snapshotCid, Height: 12}, si)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&queries))
+}
+
+func TestEngine_InclusionCache(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithInclusionCacheTTL(config.Duration(time.Hour)))
+	require.NoError(t, err)
+	snapshotted, err := e.PublishBytesData(ctx, []byte("in snapshot"))
+	require.NoError(t, err)
+	unsnapshotted, err := e.PublishBytesData(ctx, []byte("not in snapshot"))
+	require.NoError(t, err)
+	snapshotCid, err := e.PublishBytesData(ctx, []byte("snapshot"))
+	require.NoError(t, err)
+
+	queries := make(map[cid.Cid]int)
+	var mutex sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		mutex.Lock()
+		queries[c]++
+		mutex.Unlock()
+		inclusion := MetaInclusion{ID: c, Provider: e.h.ID().String(), InPando: true}
+		if c.Equals(snapshotted) {
+			inclusion.InSnapShot, inclusion.SnapShotID, inclusion.SnapShotHeight = true, snapshotCid, 7
+			inclusion.Context, inclusion.TranscationID = []byte("tx context"), 42
+		}
+		b, err := json.Marshal(inclusion)
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	require.NoError(t, WithPandoAPIClient(srv.URL, time.Second)(e.options))
+
+	var first *MetaInclusion
+	for i := 0; i < 2; i++ {
+		inclusion, err := e.GetInclusion(ctx, snapshotted)
+		require.NoError(t, err)
+		require.Equal(t, uint64(7), inclusion.SnapShotHeight)
+		require.Equal(t, snapshotCid, inclusion.SnapShotID)
+		require.Equal(t, 42, inclusion.TranscationID)
+		if first == nil {
+			first = inclusion
+		}
+		require.Equal(t, first, inclusion)
+		_, err = e.GetInclusion(ctx, unsnapshotted)
+		require.NoError(t, err)
+	}
+	report, err := e.Audit(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Included)
+	require.Equal(t, 1, queries[snapshotted])
+	require.Equal(t, 3, queries[unsnapshotted])
+
+	require.NoError(t, e.InvalidateInclusion(ctx, snapshotted))
+	_, err = e.GetInclusion(ctx, snapshotted)
+	require.NoError(t, err)
+	require.Equal(t, 2, queries[snapshotted])
+	n, err := e.ClearInclusionCache(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// expired inclusions are queried again.
+	_, err = e.GetInclusion(ctx, snapshotted)
+	require.NoError(t, err)
+	e.inclusionCacheTTL = time.Nanosecond
+	_, err = e.GetInclusion(ctx, snapshotted)
+	require.NoError(t, err)
+	require.Equal(t, 4, queries[snapshotted])
+
+	_, err = New(WithInclusionCacheTTL(-1))
+	require.Error(t, err)
+}
+
+func TestEngine_Status(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	pando, err := libp2p.New()
+	require.NoError(t, err)
+	defer pando.Close()
+	e, err := New(WithPandoAddrinfo(peer.AddrInfo{ID: pando.ID(), Addrs: pando.Addrs()}), WithPublisherKind(HttpPublisher))
+	require.NoError(t, err)
+
+	status := e.Status(ctx)
+	require.Equal(t, cid.Undef, status.LatestMeta)
+	require.Equal(t, HttpPublisher, status.PublisherKind)
+	require.False(t, status.Started)
+	require.NotNil(t, status.Pando)
+	require.Equal(t, pando.ID(), status.Pando.ID)
+	require.False(t, status.Pando.Connected)
+	require.True(t, status.LastAnnounceTime.IsZero())
+
+	c, err := e.PublishBytesData(ctx, []byte("status"))
+	require.NoError(t, err)
+	require.NoError(t, e.cr.addCheck(c))
+	e.publisher = &countingPublisher{}
+	require.NoError(t, e.announce(ctx, c, nil))
+	require.NoError(t, e.h.Connect(ctx, peer.AddrInfo{ID: pando.ID(), Addrs: pando.Addrs()}))
+
+	status = e.Status(ctx)
+	require.Equal(t, c, status.LatestMeta)
+	require.Equal(t, 1, status.ChainLength)
+	require.Equal(t, 1, status.PendingChecks)
+	require.Equal(t, c, status.LastAnnounced)
+	require.False(t, status.LastAnnounceTime.IsZero())
+	require.True(t, status.Pando.Connected)
+}
+
+func TestEngine_Cat(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	text, err := e.PublishBytesData(ctx, []byte("hi"))
+	require.NoError(t, err)
+	doc, err := e.PublishBytesData(ctx, []byte(`{"a":1}`))
+	require.NoError(t, err)
+
+	for format, expected := range map[CatFormat]string{
+		CatRaw:     "hi",
+		CatHex:     "6869",
+		CatBase64:  "aGk=",
+		CatDagJson: `{"/":{"bytes":"aGk"}}`,
+		CatJson:    "{\n  \"/\": {\n    \"bytes\": \"aGk\"\n  }\n}",
+	} {
+		res, err := e.Cat(ctx, text, format)
+		require.NoError(t, err, format)
+		require.Equal(t, expected, string(res), format)
+	}
+	res, err := e.Cat(ctx, doc, CatJson)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"a\": 1\n}", string(res))
+
+	_, err = e.Cat(ctx, doc, "yaml")
+	require.True(t, errors.Is(err, ErrInvalidCatFormat))
+}
+
+func TestEngine_PublishSchemaV2(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	v1, err := e.PublishBytesData(ctx, []byte("v1"))
+	require.NoError(t, err)
+	v2, err := e.PublishBytesData(ctx, []byte("v2"), WithSchemaVersion(sc.V2), WithContentType("text/plain"),
+		WithLabels("env=test"), WithChunking(sc.Chunking{ChunkSize: 2, Chunks: 1, Size: 2}))
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("v3"), WithSchemaVersion(3))
+	require.ErrorIs(t, err, sc.ErrUnsupportedVersion)
+
+	// both versions are decoded alike.
+	for c, expected := range map[cid.Cid]string{v1: "v1", v2: "v2"} {
+		res, err := e.CatCid(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(res))
+		res, err = e.Cat(ctx, c, CatRaw)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(res))
+	}
+
+	meta, err := e.loadMetadata(ctx, v1)
+	require.NoError(t, err)
+	p, err := sc.DecodeMetaPayload(meta)
+	require.NoError(t, err)
+	require.Equal(t, sc.V1, p.Version)
+	meta, err = e.loadMetadata(ctx, v2)
+	require.NoError(t, err)
+	p, err = sc.DecodeMetaPayload(meta)
+	require.NoError(t, err)
+	require.Equal(t, sc.V2, p.Version)
+	require.Equal(t, "text/plain", p.ContentType)
+	require.Equal(t, map[string]string{"env": "test"}, p.Labels)
+	require.Equal(t, &sc.Chunking{ChunkSize: 2, Chunks: 1, Size: 2}, p.Chunking)
+	b, err := p.Data.AsBytes()
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(b))
+}
+
+func TestEngine_CatContent(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	typed, err := e.PublishBytesData(ctx, []byte("<p>hi</p>"), WithContentType("text/html"))
+	require.NoError(t, err)
+	untyped, err := e.PublishBytesData(ctx, []byte("hi"))
+	require.NoError(t, err)
+	// {"a": 1} and "a" in dag-cbor.
+	doc, err := e.PublishCborData(ctx, []byte{0xa1, 0x61, 0x61, 0x01})
+	require.NoError(t, err)
+	typedDoc, err := e.PublishCborData(ctx, []byte{0x61, 0x61}, WithContentType("application/vnd.ipld.dag-json"))
+	require.NoError(t, err)
+
+	for c, expected := range map[cid.Cid]Content{
+		typed:    {ContentType: "text/html", Data: []byte("<p>hi</p>")},
+		untyped:  {ContentType: "application/octet-stream", Data: []byte("hi")},
+		doc:      {ContentType: "application/json", Data: []byte(`{"a":1}`)},
+		typedDoc: {ContentType: "application/vnd.ipld.dag-json", Data: []byte(`"a"`)},
+	} {
+		content, err := e.CatContent(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, &expected, content)
+		content, err = e.CatContentLocal(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, &expected, content)
+	}
+}
+
+func TestEngine_CatLocal(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	c, err := e.PublishBytesData(ctx, []byte("hi"))
+	require.NoError(t, err)
+
+	res, err := e.CatLocal(ctx, c, CatRaw)
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(res))
+	meta, err := e.MetadataDagJson(ctx, c)
+	require.NoError(t, err)
+	require.Contains(t, string(meta), `"Payload":{"/":{"bytes":"aGk"}}`)
+
+	missing, err := cid.Decode("bafy2bzacecvdhmenbmzp5dtawl5gcsfo6ewbnziexwdf3nbfqdbebngxlhzye")
+	require.NoError(t, err)
+	_, err = e.CatLocal(ctx, missing, CatRaw)
+	require.True(t, errors.Is(err, ResourceNotFound), err)
+	_, err = e.MetadataDagJson(ctx, missing)
+	require.True(t, errors.Is(err, ResourceNotFound), err)
+}
+
+func TestEngine_AuditLog(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(
+		WithAuditLog(true),
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+
+	v, err := e.VerifyAuditLog(ctx)
+	require.NoError(t, err)
+	require.Zero(t, v.Entries)
+	c, err := e.PublishBytesData(ctx, []byte("audited"))
+	require.NoError(t, err)
+	_, err = e.RePublishLatest(ctx)
+	require.NoError(t, err)
+	ch, err := e.Chain(ctx, "audited")
+	require.NoError(t, err)
+	onChain, err := ch.PublishBytesData(ctx, []byte("audited chain"))
+	require.NoError(t, err)
+
+	v, err = e.VerifyAuditLog(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 5, v.Entries)
+	var buf bytes.Buffer
+	require.NoError(t, e.ExportAuditLog(ctx, &buf))
+	var entries []AuditLogEntry
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry AuditLogEntry
+		require.NoError(t, dec.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 5)
+	for i, want := range []struct {
+		op    AuditOp
+		c     cid.Cid
+		chain string
+	}{{AuditPublish, c, ""}, {AuditAnnounce, c, ""}, {AuditRepublish, c, ""}, {AuditPublish, onChain, "audited"}, {AuditAnnounce, onChain, ""}} {
+		require.Equal(t, want.op, entries[i].Op, i)
+		require.Equal(t, want.c, entries[i].Cid, i)
+		require.Equal(t, want.chain, entries[i].Chain, i)
+	}
+	require.Equal(t, entries[4].Hash, v.Head)
+	require.Equal(t, entries[0].Hash, entries[1].Prev)
+
+	// altered entry.
+	altered := entries[2]
+	altered.Op = AuditAnnounce
+	b, err := json.Marshal(&altered)
+	require.NoError(t, err)
+	require.NoError(t, e.auditLogDs().Put(ctx, auditLogKey(2), b))
+	_, err = e.VerifyAuditLog(ctx)
+	require.ErrorIs(t, err, ErrAuditLogTampered)
+	b, err = json.Marshal(&entries[2])
+	require.NoError(t, err)
+	require.NoError(t, e.auditLogDs().Put(ctx, auditLogKey(2), b))
+	_, err = e.VerifyAuditLog(ctx)
+	require.NoError(t, err)
+	// truncated log.
+	require.NoError(t, e.auditLogDs().Delete(ctx, auditLogKey(4)))
+	_, err = e.VerifyAuditLog(ctx)
+	require.ErrorIs(t, err, ErrAuditLogTampered)
+
+	other, err := New()
+	require.NoError(t, err)
+	_, err = other.VerifyAuditLog(ctx)
+	require.ErrorIs(t, err, ErrAuditLogDisabled)
+	require.ErrorIs(t, other.ExportAuditLog(ctx, &buf), ErrAuditLogDisabled)
+}
+
+func TestEngine_RecoverFromAuditLog(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true))
+	require.NoError(t, err)
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := e.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	ch, err := e.Chain(ctx, "recovered")
+	require.NoError(t, err)
+	_, err = ch.PublishBytesData(ctx, []byte("chain"))
+	require.NoError(t, err)
+	require.NoError(t, e.bs.Delete(ctx, published[1]))
+
+	// corrupt the keys of the local chain state.
+	require.NoError(t, ds.Put(ctx, dsLatestMetaKey, []byte("garbage")))
+	require.NoError(t, ds.Delete(ctx, dsPushedCidListKey))
+	require.NoError(t, ds.Put(ctx, dsCheckRegistryKey.Child(dsCheckCidListKey), []byte("garbage")))
+	_, err = New(WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true))
+	require.Error(t, err)
+
+	e, err = New(WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true), WithAuditLogRecovery(true))
+	require.NoError(t, err)
+	require.Equal(t, published[2], e.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{published[0], published[2]}, e.pushList)
+	require.Len(t, e.cr.checkMap, 2)
+	require.Contains(t, e.cr.checkMap, published[0].String())
+	require.Contains(t, e.cr.checkMap, published[2].String())
+
+	rec, err := e.RecoverFromAuditLog(ctx)
+	require.NoError(t, err)
+	require.Equal(t, published[2], rec.Head)
+	require.Equal(t, 2, rec.Pushed)
+	require.Zero(t, rec.Checks)
+	require.Equal(t, []cid.Cid{published[1]}, rec.Missing)
+
+	require.NoError(t, ds.Delete(ctx, dsAuditLogKey.Child(auditLogKey(0))))
+	_, err = New(WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true), WithAuditLogRecovery(true))
+	require.ErrorIs(t, err, ErrAuditLogTampered)
+}
+
+func TestEngine_Rollback(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true), WithDedupe(true))
+	require.NoError(t, err)
+	pub := &countingPublisher{}
+	e.publisher = pub
+	good, err := e.PublishBytesData(ctx, []byte("good"), WithLabels("batch=1"))
+	require.NoError(t, err)
+	bad1, err := e.PublishBytesData(ctx, []byte("bad 1"), WithLabels("batch=1", "bad=yes"))
+	require.NoError(t, err)
+	bad2, err := e.PublishBytesData(ctx, []byte("bad 2"), WithAsyncAnnounce(), WithLabels("batch=2"))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{bad2}, e.QueuedAnnounces())
+
+	_, err = e.Rollback(ctx, cid.NewCidV1(cid.Raw, good.Hash()))
+	require.ErrorIs(t, err, ErrNotPushed)
+	rolledBack, err := e.Rollback(ctx, good)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{bad1, bad2}, rolledBack)
+	require.Equal(t, good, e.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{good}, e.pushList)
+	require.Empty(t, e.QueuedAnnounces())
+	require.True(t, e.cr.has(good))
+	require.False(t, e.cr.has(bad1))
+	announced := pub.announced()
+	require.Equal(t, good, announced[len(announced)-1])
+	_, err = e.LookupByPayload(ctx, []byte("bad 1"))
+	require.ErrorIs(t, err, ErrPayloadNotPublished)
+	labeled, err := e.FindByLabel(ctx, "batch", "")
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{good}, labeled)
+	labeled, err = e.FindByLabel(ctx, "bad", "yes")
+	require.NoError(t, err)
+	require.Empty(t, labeled)
+	rolledBack, err = e.Rollback(ctx, good)
+	require.NoError(t, err)
+	require.Empty(t, rolledBack)
+
+	next, err := e.PublishBytesData(ctx, []byte("next"))
+	require.NoError(t, err)
+	meta, err := e.loadMetadata(ctx, next)
+	require.NoError(t, err)
+	require.Equal(t, good, (*meta.PreviousID).(cidlink.Link).Cid)
+
+	restarted, err := New(WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true))
+	require.NoError(t, err)
+	require.Equal(t, next, restarted.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{good, next}, restarted.pushList)
+	rec, err := restarted.RecoverFromAuditLog(ctx)
+	require.NoError(t, err)
+	require.Equal(t, next, rec.Head)
+	require.Equal(t, 2, rec.Pushed)
+}
+
+func TestEngine_RollbackConcurrentPublish(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithPersistAfterSend(true))
+	require.NoError(t, err)
+	e.publisher = &countingPublisher{}
+	base, err := e.PublishBytesData(ctx, []byte("base"))
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	var published, rolledBack []cid.Cid
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				data := []byte(fmt.Sprintf("data %d-%d", i, j))
+				var c cid.Cid
+				var err error
+				if i == 0 {
+					meta, merr := sc.NewMetaWithBytesPayload(data, e.h.ID(), e.key, nil)
+					require.NoError(t, merr)
+					c, err = e.Publish(ctx, *meta)
+				} else {
+					c, err = e.PublishBytesData(ctx, data)
+				}
+				require.NoError(t, err)
+				mutex.Lock()
+				published = append(published, c)
+				mutex.Unlock()
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 10; j++ {
+			res, err := e.Rollback(ctx, base)
+			require.NoError(t, err)
+			mutex.Lock()
+			rolledBack = append(rolledBack, res...)
+			mutex.Unlock()
+		}
+	}()
+	wg.Wait()
+
+	pushed, err := e.GetPushedList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, pushed, e.pushList)
+	require.Equal(t, pushed[len(pushed)-1], e.getLatestMeta(ctx))
+	require.Equal(t, base, pushed[0])
+	inList := make(map[cid.Cid]bool, len(pushed))
+	for _, c := range pushed {
+		require.False(t, inList[c], "%s is pushed twice", c)
+		inList[c] = true
+	}
+	dropped := make(map[cid.Cid]bool, len(rolledBack))
+	for _, c := range rolledBack {
+		require.False(t, inList[c], "rolled back %s is pushed again", c)
+		dropped[c] = true
+	}
+	for _, c := range published {
+		require.True(t, inList[c] != dropped[c], "%s must be either pushed or rolled back", c)
+	}
+}
+
+func TestEngine_ImportChain(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	src, err := New(WithPersistAfterSend(true))
+	require.NoError(t, err)
+	src.publisher = &countingPublisher{}
+	first, err := src.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	second, err := src.PublishBytesData(ctx, []byte("second"))
+	require.NoError(t, err)
+	exportCar := func(e *Engine, cids ...cid.Cid) *bytes.Buffer {
+		var buf bytes.Buffer
+		cw, err := newCarWriter(&buf, cids[len(cids)-1])
+		require.NoError(t, err)
+		for _, c := range cids {
+			data, err := e.bs.Get(ctx, c)
+			require.NoError(t, err)
+			require.NoError(t, cw.writeBlock(c, data))
+		}
+		return &buf
+	}
+
+	// another instance using the same key.
+	h, err := libp2p.New(libp2p.Identity(src.key))
+	require.NoError(t, err)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithHost(h), WithDatastore(ds), WithAuditLog(true), WithPersistAfterSend(true), WithDedupe(true))
+	require.NoError(t, err)
+	pub := &countingPublisher{}
+	e.publisher = pub
+
+	_, err = e.ImportChain(ctx, exportCar(src, second), false)
+	require.ErrorIs(t, err, ErrInvalidImport)
+	tampered := exportCar(src, first, second).Bytes()
+	tampered[len(tampered)-1] ^= 1
+	_, err = e.ImportChain(ctx, bytes.NewReader(tampered), false)
+	require.ErrorIs(t, err, ErrInvalidImport)
+	other, err := New()
+	require.NoError(t, err)
+	_, err = other.ImportChain(ctx, exportCar(src, first, second), false)
+	require.ErrorIs(t, err, ErrInvalidImport)
+	require.Equal(t, cid.Undef, e.getLatestMeta(ctx))
+
+	res, err := e.ImportChain(ctx, exportCar(src, first, second), false)
+	require.NoError(t, err)
+	require.Equal(t, second, res.Head)
+	require.Equal(t, cid.Undef, res.Base)
+	require.Equal(t, []cid.Cid{first, second}, res.Imported)
+	require.Equal(t, second, e.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{first, second}, e.pushList)
+	require.Equal(t, []cid.Cid{second}, pub.announced())
+	c, err := e.LookupByPayload(ctx, []byte("first"))
+	require.NoError(t, err)
+	require.Equal(t, first, c)
+	res, err = e.ImportChain(ctx, exportCar(src, first, second), false)
+	require.NoError(t, err)
+	require.Empty(t, res.Imported)
+
+	// both instances published after the import.
+	third, err := src.PublishBytesData(ctx, []byte("third"))
+	require.NoError(t, err)
+	local, err := e.PublishBytesData(ctx, []byte("local"))
+	require.NoError(t, err)
+	_, err = e.ImportChain(ctx, exportCar(src, third), false)
+	require.ErrorIs(t, err, ErrImportDiverges)
+	require.Equal(t, local, e.getLatestMeta(ctx))
+	res, err = e.ImportChain(ctx, exportCar(src, third), true)
+	require.NoError(t, err)
+	require.Equal(t, second, res.Base)
+	require.Equal(t, []cid.Cid{third}, res.Imported)
+	require.Equal(t, []cid.Cid{local}, res.Replaced)
+	require.Equal(t, third, e.getLatestMeta(ctx))
+	require.Equal(t, []cid.Cid{first, second, third}, e.pushList)
+	require.False(t, e.cr.has(local))
+	_, err = e.LookupByPayload(ctx, []byte("local"))
+	require.ErrorIs(t, err, ErrPayloadNotPublished)
+
+	rec, err := e.RecoverFromAuditLog(ctx)
+	require.NoError(t, err)
+	require.Equal(t, third, rec.Head)
+	require.Equal(t, 3, rec.Pushed)
+}
+
+func TestEngine_History(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	start := time.Now()
+	first, err := e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	middle := time.Now()
+	second, err := e.PublishBytesData(ctx, []byte("second!"))
+	require.NoError(t, err)
+	ch, err := e.Chain(ctx, "history")
+	require.NoError(t, err)
+	onChain, err := ch.PublishBytesData(ctx, []byte("chain"))
+	require.NoError(t, err)
+
+	entries, err := e.History(ctx, start, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, first, entries[0].Cid)
+	require.Equal(t, 5, entries[0].PayloadSize)
+	require.Equal(t, NotAnnounced, entries[0].Announce)
+	require.Equal(t, second, entries[1].Cid)
+	require.Equal(t, 7, entries[1].PayloadSize)
+	require.Equal(t, onChain, entries[2].Cid)
+	require.Equal(t, "history", entries[2].Chain)
+
+	entries, err = e.History(ctx, start, middle)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, first, entries[0].Cid)
+
+	e.historyAnnounced(ctx, second)
+	e.historyIncluded(ctx, second)
+	entries, err = e.History(ctx, middle, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, second, entries[0].Cid)
+	require.Equal(t, Announced, entries[0].Announce)
+	require.False(t, entries[0].AnnouncedAt.IsZero())
+	require.False(t, entries[0].IncludedAt.IsZero())
+}
+
+func TestEngine_Receipt(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	local, err := e.PublishBytesData(ctx, []byte("local"))
+	require.NoError(t, err)
+	receipt, err := e.GetReceipt(ctx, local)
+	require.NoError(t, err)
+	require.Equal(t, local, receipt.Cid)
+	require.Equal(t, NotAnnounced, receipt.Announce)
+	require.False(t, receipt.StoredAt.IsZero())
+	require.False(t, receipt.PublishedAt.Before(receipt.StoredAt))
+	require.False(t, receipt.Pending)
+
+	pub := &flakyPublisher{fail: true}
+	e.publisher = pub
+	meta, err := e.newBytesMetadata(ctx, []byte("offline"), newPublishOptions())
+	require.NoError(t, err)
+	receipt, err = e.PublishWithReceipt(ctx, *meta, WithAnnounceTopic("/pando/custom"))
+	require.NoError(t, err)
+	offline := receipt.Cid
+	require.Equal(t, AnnounceQueued, receipt.Announce)
+	require.Equal(t, "network unreachable", receipt.AnnounceError)
+	require.Equal(t, "/pando/custom", receipt.Topic)
+	require.True(t, receipt.AnnouncedAt.IsZero())
+	require.True(t, receipt.Queued)
+	require.False(t, receipt.Pending)
+
+	require.Error(t, e.FlushAnnounceQueue(ctx))
+	pub.fail = false
+	require.NoError(t, e.FlushAnnounceQueue(ctx))
+	receipt, err = e.GetReceipt(ctx, offline)
+	require.NoError(t, err)
+	require.Equal(t, Announced, receipt.Announce)
+	require.False(t, receipt.AnnouncedAt.IsZero())
+	// the failure is kept to tell what happened.
+	require.Equal(t, "network unreachable", receipt.AnnounceError)
+	require.False(t, receipt.Queued)
+	require.True(t, receipt.Pending)
+
+	e.cr.checkMutex.Lock()
+	status := e.cr.checkMap[offline.String()]
+	e.cr.checkMutex.Unlock()
+	require.NoError(t, e.cr.deadLetter(offline, status))
+	receipt, err = e.GetReceipt(ctx, offline)
+	require.NoError(t, err)
+	require.False(t, receipt.Pending)
+	require.NotNil(t, receipt.DeadLetter)
+	require.Equal(t, offline, receipt.DeadLetter.Cid)
+
+	_, err = e.GetReceipt(ctx, cid.NewCidV1(cid.Raw, local.Hash()))
+	require.ErrorIs(t, err, ErrNoReceipt)
+}
+
+func TestEngine_Labels(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("invalid"), WithLabels("dataset"))
+	require.ErrorIs(t, err, ErrInvalidLabel)
+
+	deals, err := e.PublishBytesData(ctx, []byte("deals"), WithLabels("dataset=deals", "v=1"))
+	require.NoError(t, err)
+	ch, err := e.Chain(ctx, "labels")
+	require.NoError(t, err)
+	onChain, err := ch.PublishBytesData(ctx, []byte("chain"), WithLabels("dataset=deals/chain"))
+	require.NoError(t, err)
+	v2, err := e.PublishBytesData(ctx, []byte("deals v2"), WithLabels("dataset=deals", "v=2"))
+	require.NoError(t, err)
+
+	cids, err := e.FindByLabel(ctx, "dataset", "deals")
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{deals, v2}, cids)
+	cids, err = e.FindByLabel(ctx, "dataset", "deals/chain")
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{onChain}, cids)
+	cids, err = e.FindByLabel(ctx, "v", "")
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{deals, v2}, cids)
+	cids, err = e.FindByLabel(ctx, "missing", "")
+	require.NoError(t, err)
+	require.Empty(t, cids)
+	_, err = e.FindByLabel(ctx, "", "deals")
+	require.ErrorIs(t, err, ErrInvalidLabel)
+}
+
+func TestEngine_CatStream(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+
+	c, err := e.PublishBytesData(ctx, []byte("bytes payload"))
+	require.NoError(t, err)
+	r, err := e.CatStream(ctx, c)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, []byte("bytes payload"), b)
+
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789"), dirChunkSize/4)
+	path := filepath.Join(dir, "big")
+	require.NoError(t, os.WriteFile(path, big, 0644))
+	file, err := e.storeFile(ctx, path, e.linkProto)
+	require.NoError(t, err)
+	meta, err := e.newMetadata(ctx, basicnode.NewLink(file), newPublishOptions())
+	require.NoError(t, err)
+	c, err = e.Publish(ctx, *meta)
+	require.NoError(t, err)
+	r, err = e.CatStream(ctx, c)
+	require.NoError(t, err)
+	b, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, big, b)
+	require.NoError(t, r.Close())
+	_, err = r.Read(make([]byte, 1))
+	require.Error(t, err)
+
+	// chunks are loaded as they are read.
+	r, err = e.CatStream(ctx, c)
+	require.NoError(t, err)
+	first := make([]byte, 10)
+	_, err = io.ReadFull(r, first)
+	require.NoError(t, err)
+	require.Equal(t, big[:10], first)
+	chunks := r.(*fileReader).chunks
+	require.Len(t, chunks, 2)
+	require.NoError(t, e.bs.Delete(ctx, chunks[1].(cidlink.Link).Cid))
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+
+	// other payloads are streamed as dag-json, like CatCid.
+	root, err := e.PublishDirectory(ctx, dir)
+	require.NoError(t, err)
+	expected, err := e.CatCid(ctx, root)
+	require.NoError(t, err)
+	r, err = e.CatStream(ctx, root)
+	require.NoError(t, err)
+	b, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, expected, b)
+}
+
+func TestEngine_MaxPayloadSize(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithMaxPayloadSize(8, ""))
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("8 bytes!"))
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("9 bytes!!"))
+	var tooLarge *PayloadTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	require.Equal(t, &PayloadTooLargeError{Size: 9, Max: 8}, tooLarge)
+	require.ErrorIs(t, err, ErrPayloadTooLarge)
+	_, err = e.PublishToChain(ctx, "deals", []byte("9 bytes!!"))
+	require.ErrorIs(t, err, ErrPayloadTooLarge)
+
+	e, err = New(WithMaxPayloadSize(4, ChunkOversizedPayloads))
+	require.NoError(t, err)
+	data := []byte("chunked payload")
+	preview, err := e.PreviewCid(ctx, data, WithSchemaVersion(sc.V2))
+	require.NoError(t, err)
+	_, err = e.bs.Get(ctx, preview)
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+	c, err := e.PublishBytesData(ctx, data, WithSchemaVersion(sc.V2))
+	require.NoError(t, err)
+	require.Equal(t, preview, c)
+	r, err := e.CatStream(ctx, c)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, data, b)
+	meta, err := e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	p, err := sc.DecodeMetaPayload(meta)
+	require.NoError(t, err)
+	require.Equal(t, &sc.Chunking{ChunkSize: 4, Chunks: 4, Size: int64(len(data))}, p.Chunking)
+
+	// structured payloads can not be chunked.
+	doc, err := ipld.Encode(basicnode.NewString("too large"), dagcbor.Encode)
+	require.NoError(t, err)
+	_, err = e.PublishCborData(ctx, doc)
+	require.ErrorIs(t, err, ErrPayloadTooLarge)
+
+	_, err = New(WithMaxPayloadSize(-1, ""))
+	require.Error(t, err)
+	_, err = New(WithMaxPayloadSize(1, "split"))
+	require.Error(t, err)
+}
+
+func TestEngine_BacklogLimit(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var included int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		require.NoError(t, err)
+		b, err := json.Marshal(MetaInclusion{ID: c, InPando: atomic.LoadInt32(&included) == 1})
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer srv.Close()
+	fc := testutil.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	e, err := New(
+		WithPublisherKind(DataTransferPublisher),
+		WithRetryPolicy(RetryAnnounce, retry.NoRetry),
+		WithPandoAPIClient(srv.URL, time.Second),
+		WithBacklogLimit(2, config.Duration(time.Minute)),
+		WithClock(fc),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+	_, err = e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	_, err = e.PublishToChain(ctx, "deals", []byte("second"))
+	require.NoError(t, err)
+	// the publishes skipping the check list are not held back.
+	_, err = e.PublishBytesData(ctx, []byte("unchecked"), WithSkipCheck())
+	require.NoError(t, err)
+	// the tickers of the check lists and of the announce queue.
+	require.NoError(t, fc.BlockUntil(ctx, 3))
+
+	// the publish waits for the backlog to drain.
+	published := make(chan error, 1)
+	go func() {
+		_, err := e.PublishBytesData(ctx, []byte("third"))
+		published <- err
+	}()
+	require.NoError(t, fc.BlockUntil(ctx, 4))
+	select {
+	case err := <-published:
+		t.Fatalf("publish did not wait for the backlog to drain: %v", err)
+	default:
+	}
+	atomic.StoreInt32(&included, 1)
+	_, err = e.CheckNow(ctx)
+	require.NoError(t, err)
+	require.NoError(t, <-published)
+
+	// and fails once the wait is over.
+	atomic.StoreInt32(&included, 0)
+	_, err = e.PublishBytesData(ctx, []byte("fourth"))
+	require.NoError(t, err)
+	go func() {
+		_, err := e.PublishToChain(ctx, "deals", []byte("fifth"))
+		published <- err
+	}()
+	require.NoError(t, fc.BlockUntil(ctx, 4))
+	fc.Add(time.Minute)
+	err = <-published
+	var backlog *BacklogError
+	require.ErrorAs(t, err, &backlog)
+	require.ErrorIs(t, err, ErrBacklog)
+	require.Equal(t, 2, backlog.Pending)
+	require.Equal(t, 2, backlog.Limit)
+	require.Equal(t, time.Minute, backlog.Waited)
+
+	e, err = New(WithPublisherKind(DataTransferPublisher), WithRetryPolicy(RetryAnnounce, retry.NoRetry), WithBacklogLimit(1, 0))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	gossipPeer(ctx, t, e, e.pubTopicName)
+	_, err = e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("second"))
+	require.ErrorIs(t, err, ErrBacklog)
+
+	_, err = New(WithBacklogLimit(-1, 0))
+	require.Error(t, err)
+}
+
+// slowDatastore delays the writes to its datastore.
+type slowDatastore struct {
+	datastore.Batching
+	delay time.Duration
+}
+
+func (ds *slowDatastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	time.Sleep(ds.delay)
+	return ds.Batching.Put(ctx, key, value)
+}
+
+func TestEngine_PublishQuota(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	fc := testutil.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	e, err := New(WithDatastore(ds), WithPublishQuota(config.Duration(time.Hour), 2, 0), WithClock(fc))
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("first"))
+	require.NoError(t, err)
+	fc.Add(30 * time.Minute)
+	_, err = e.PublishToChain(ctx, "deals", []byte("second"))
+	require.NoError(t, err)
+	_, err = e.PublishBytesData(ctx, []byte("third"))
+	var exceeded *QuotaExceededError
+	require.ErrorAs(t, err, &exceeded)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Equal(t, "entries", exceeded.Limit)
+	require.Equal(t, int64(2), exceeded.Used)
+	usage := e.Status(ctx).Quota
+	require.Equal(t, 2, usage.Entries)
+	require.Equal(t, 2, usage.MaxEntries)
+	require.Equal(t, time.Hour, usage.Window)
+	require.Positive(t, usage.Bytes)
+
+	// the first publish leaves the window.
+	fc.Add(31 * time.Minute)
+	require.Equal(t, 1, e.PublishQuota().Entries)
+	_, err = e.PublishBytesData(ctx, []byte("third"))
+	require.NoError(t, err)
+	require.Equal(t, 2, e.PublishQuota().Entries)
+
+	// the usage is persisted.
+	restarted, err := New(WithDatastore(ds), WithPublishQuota(config.Duration(time.Hour), 0, 0), WithClock(fc))
+	require.NoError(t, err)
+	require.Equal(t, 2, restarted.PublishQuota().Entries)
+	_, err = restarted.PublishBytesData(ctx, []byte("unlimited"))
+	require.NoError(t, err)
+
+	e, err = New(WithPublishQuota(0, 0, 10))
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, e.PublishQuota().Window)
+	_, err = e.PublishBytesData(ctx, []byte("too many bytes"))
+	require.ErrorAs(t, err, &exceeded)
+	require.Equal(t, "bytes", exceeded.Limit)
+	require.Zero(t, e.PublishQuota().Entries)
+
+	// the concurrent publishes on different chains do not exceed the quota together, even while
+	// their blocks are stored.
+	slow := &slowDatastore{Batching: dssync.MutexWrap(datastore.NewMapDatastore()), delay: 5 * time.Millisecond}
+	e, err = New(WithDatastore(slow), WithPublishQuota(config.Duration(time.Hour), 5, 0))
+	require.NoError(t, err)
+	defer e.closeChains()
+	var published int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := e.PublishToChain(ctx, fmt.Sprintf("chain-%d", i), []byte(fmt.Sprintf("concurrent %d", i)))
+			if err == nil {
+				atomic.AddInt32(&published, 1)
+			} else {
+				assert.ErrorIs(t, err, ErrQuotaExceeded)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int32(5), published)
+	require.Equal(t, 5, e.PublishQuota().Entries)
+
+	_, err = New(WithPublishQuota(0, -1, 0))
+	require.Error(t, err)
+}
+
+func TestEngine_PublishDirectory(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789"), dirChunkSize/5)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "big"), big, 0644))
+	require.NoError(t, os.Symlink("b.txt", filepath.Join(dir, "link")))
+
+	c, err := e.PublishDirectory(ctx, dir)
+	require.NoError(t, err)
+	require.Equal(t, c, e.getLatestMeta(ctx))
+	meta, err := e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	root, err := meta.Payload.AsLink()
+	require.NoError(t, err)
+
+	load := func(lnk ipld.Link) ipld.Node {
+		n, err := e.lsys.Load(ipld.LinkContext{Ctx: ctx}, lnk, basicnode.Prototype.Any)
+		require.NoError(t, err)
+		return n
+	}
+	lookup := func(n ipld.Node, path ...string) ipld.Node {
+		for _, seg := range path {
+			var err error
+			n, err = n.LookupByString(seg)
+			require.NoError(t, err, seg)
+		}
+		return n
+	}
+	rootNode := load(root)
+	require.Equal(t, int64(2), lookup(rootNode, "Entries").Length())
+
+	subLink, err := lookup(rootNode, "Entries", "sub").AsLink()
+	require.NoError(t, err)
+	bigLink, err := lookup(load(subLink), "Entries", "big").AsLink()
+	require.NoError(t, err)
+	bigNode := load(bigLink)
+	size, err := lookup(bigNode, "Size").AsInt()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(big)), size)
+	chunks := lookup(bigNode, "Chunks")
+	require.Equal(t, int64(2), chunks.Length())
+	var content []byte
+	for it := chunks.ListIterator(); !it.Done(); {
+		_, chunk, err := it.Next()
+		require.NoError(t, err)
+		lnk, err := chunk.AsLink()
+		require.NoError(t, err)
+		require.Equal(t, uint64(cid.Raw), lnk.(cidlink.Link).Cid.Prefix().Codec)
+		b, err := load(lnk).AsBytes()
+		require.NoError(t, err)
+		content = append(content, b...)
+	}
+	require.Equal(t, big, content)
+
+	_, err = e.PublishDirectory(ctx, filepath.Join(dir, "b.txt"))
+	require.Error(t, err)
+}
+
+func TestEngine_Watch(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithWatchScanInterval(config.Duration(10 * time.Millisecond)))
+	require.NoError(t, err)
+	defer e.closeWatchers()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old"), []byte("old"), 0644))
+
+	_, err = e.StartWatch(ctx, WatchSpec{Dir: dir, Ignore: []string{"*.tmp", "ignored"}, Debounce: 30 * time.Millisecond})
+	require.NoError(t, err)
+	_, err = e.StartWatch(ctx, WatchSpec{Dir: dir})
+	require.True(t, errors.Is(err, ErrAlreadyWatched))
+	_, err = e.StartWatch(ctx, WatchSpec{Dir: t.TempDir(), Ignore: []string{"["}})
+	require.Error(t, err)
+
+	published := func(n int) func() bool {
+		return func() bool {
+			watches := e.Watches()
+			return len(watches) == 1 && watches[0].Published == n && watches[0].Pending == 0
+		}
+	}
+	latestPayload := func() string {
+		meta, err := e.loadMetadata(ctx, e.getLatestMeta(ctx))
+		require.NoError(t, err)
+		b, err := meta.Payload.AsBytes()
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "skip.tmp"), []byte("skip"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "ignored"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored", "file"), []byte("skip"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new"), []byte("new"), 0644))
+	requireTrueEventually(t, published(1), 10*time.Millisecond, 5*time.Second)
+	require.Len(t, e.pushList, 1)
+	require.Equal(t, "new", latestPayload())
+	a, err := e.GetAnnotations(ctx, e.getLatestMeta(ctx))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "new"), a[WatchPathAnnotation].Value)
+
+	// changes made while the watch is stopped are published once it is resumed.
+	e.closeWatchers()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old"), []byte("changed"), 0644))
+	require.NoError(t, e.resumeWatches(ctx))
+	requireTrueEventually(t, published(2), 10*time.Millisecond, 5*time.Second)
+	require.Len(t, e.pushList, 2)
+	require.Equal(t, "changed", latestPayload())
+
+	require.NoError(t, e.StopWatch(ctx, dir))
+	require.Empty(t, e.Watches())
+	require.True(t, errors.Is(e.StopWatch(ctx, dir), ErrNotWatched))
+	require.NoError(t, e.resumeWatches(ctx))
+	require.Empty(t, e.Watches())
+}
+
+func TestEngine_Jobs(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	file := filepath.Join(t.TempDir(), "status")
+	require.NoError(t, os.WriteFile(file, []byte("status"), 0644))
+	e, err := New(WithPublishJob(JobSpec{Name: "status", Schedule: "@yearly", File: file}))
+	require.NoError(t, err)
+	defer e.closeJobs()
+	_, err = New(WithPublishJob(JobSpec{Name: "invalid", Schedule: "@hourly"}))
+	require.Error(t, err)
+
+	require.NoError(t, e.resumeJobs(ctx))
+	_, err = e.AddJob(ctx, JobSpec{Name: "status", Schedule: "@hourly", Command: "echo"})
+	require.True(t, errors.Is(err, ErrAlreadyScheduled))
+	_, err = e.AddJob(ctx, JobSpec{Name: "bad", Schedule: "61 * * * *", Command: "echo"})
+	require.Error(t, err)
+
+	latestPayload := func() string {
+		meta, err := e.loadMetadata(ctx, e.getLatestMeta(ctx))
+		require.NoError(t, err)
+		b, err := meta.Payload.AsBytes()
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	c, err := e.RunJob(ctx, "status")
+	require.NoError(t, err)
+	require.Equal(t, c, e.getLatestMeta(ctx))
+	require.Equal(t, "status", latestPayload())
+	a, err := e.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, "status", a[JobAnnotation].Value)
+
+	_, err = e.AddJob(ctx, JobSpec{Name: "echo", Schedule: "@every 1s", Command: "echo hello"})
+	require.NoError(t, err)
+	_, err = e.AddJob(ctx, JobSpec{Name: "fail", Schedule: "@yearly", Command: "echo oops >&2; exit 1"})
+	require.NoError(t, err)
+	_, err = e.RunJob(ctx, "fail")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "oops")
+
+	jobRuns := func(name string) JobStatus {
+		for _, s := range e.Jobs() {
+			if s.Name == name {
+				return s
+			}
+		}
+		t.Fatalf("job %s not found", name)
+		return JobStatus{}
+	}
+	requireTrueEventually(t, func() bool { return jobRuns("echo").Runs > 0 }, 50*time.Millisecond, 5*time.Second)
+	echo := jobRuns("echo")
+	require.Empty(t, echo.LastErr)
+	require.True(t, echo.Next.After(echo.LastRun))
+	fail := jobRuns("fail")
+	require.Equal(t, 1, fail.Runs)
+	require.NotEmpty(t, fail.LastErr)
+	require.True(t, jobRuns("status").Configured)
+
+	// added jobs are resumed, configured ones are not persisted.
+	require.NoError(t, e.RemoveJob(ctx, "echo"))
+	require.True(t, errors.Is(e.RemoveJob(ctx, "echo"), ErrNotScheduled))
+	e.closeJobs()
+	require.NoError(t, e.resumeJobs(ctx))
+	require.Len(t, e.Jobs(), 2)
+	require.False(t, jobRuns("fail").Configured)
+	require.True(t, jobRuns("status").Configured)
+}
+
+func TestEngine_PayloadSchema(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	_, err := New(WithPayloadSchema("reading", []byte("type Reading struct {"), ""))
+	require.Error(t, err)
+	_, err = New(WithPayloadSchema("reading", []byte("type Reading struct { sensor String }"), ""))
+	require.Error(t, err)
+
+	e, err := New(WithPayloadSchema("reading", []byte(`
+type Reading struct {
+	sensor String
+	value Float
+	unit optional String
+}`), "Reading"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"reading"}, e.PayloadTypes())
+
+	_, err = e.PublishBytesData(ctx, []byte(`{"sensor":"s1","value":21.5}`), WithPayloadType("reading"))
+	require.NoError(t, err)
+	require.Len(t, e.pushList, 1)
+	_, err = e.PublishBytesData(ctx, []byte(`{"sensor":"s1"}`), WithPayloadType("reading"))
+	require.True(t, errors.Is(err, ErrInvalidPayload))
+	_, err = e.PublishBytesData(ctx, []byte(`{"sensor":"s1","value":"warm"}`), WithPayloadType("reading"))
+	require.True(t, errors.Is(err, ErrInvalidPayload))
+	_, err = e.PublishBytesData(ctx, []byte("not json"), WithPayloadType("reading"))
+	require.True(t, errors.Is(err, ErrInvalidPayload))
+	_, err = e.PublishBytesData(ctx, []byte(`{}`), WithPayloadType("unknown"))
+	require.True(t, errors.Is(err, ErrUnknownPayloadType))
+	// payloads without a payload type are not validated.
+	_, err = e.PublishBytesData(ctx, []byte("not json"))
+	require.NoError(t, err)
+	require.Len(t, e.pushList, 2)
+
+	require.NoError(t, e.RegisterPayloadSchema("id", []byte("type Id int"), "Id"))
+	c, err := e.PublishCborData(ctx, []byte{0x18, 0x2a}, WithPayloadType("id"))
+	require.NoError(t, err)
+	meta, err := e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	n, err := meta.Payload.AsInt()
+	require.NoError(t, err)
+	require.Equal(t, int64(42), n)
+	_, err = e.PublishCborData(ctx, []byte{0x61, 0x61}, WithPayloadType("id"))
+	require.True(t, errors.Is(err, ErrInvalidPayload))
+	_, err = e.PublishCborData(ctx, []byte{0xff})
+	require.True(t, errors.Is(err, ErrInvalidPayload))
+	require.Len(t, e.pushList, 3)
+}
+
+func TestEngine_PublishMiddleware(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	var calls []string
+	var e *Engine
+	e, err := New(
+		WithPublishMiddleware(func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, meta schema.Metadata, o ...PublishOption) (cid.Cid, error) {
+				calls = append(calls, "audit")
+				c, err := next(ctx, meta, o...)
+				calls = append(calls, fmt.Sprintf("audit %v", err == nil))
+				return c, err
+			}
+		}),
+		WithPublishMiddleware(func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, meta schema.Metadata, o ...PublishOption) (cid.Cid, error) {
+				calls = append(calls, "enrich")
+				b, err := meta.Payload.AsBytes()
+				if err != nil {
+					return cid.Undef, err
+				}
+				if string(b) == "reject" {
+					return cid.Undef, fmt.Errorf("rejected")
+				}
+				meta.Payload = basicnode.NewBytes(append([]byte("enriched "), b...))
+				if err = e.SignMetadata(&meta); err != nil {
+					return cid.Undef, err
+				}
+				return next(ctx, meta, o...)
+			}
+		}),
+	)
+	require.NoError(t, err)
+	_, err = New(WithPublishMiddleware(nil))
+	require.Error(t, err)
+
+	c, err := e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit", "enrich", "audit true"}, calls)
+	meta, err := e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	b, err := meta.Payload.AsBytes()
+	require.NoError(t, err)
+	require.Equal(t, "enriched data", string(b))
+	signer, err := schema.VerifyMetadata(meta)
+	require.NoError(t, err)
+	require.Equal(t, e.h.ID(), signer)
+
+	calls = nil
+	_, err = e.PublishBytesData(ctx, []byte("reject"))
+	require.EqualError(t, err, "rejected")
+	require.Equal(t, []string{"audit", "enrich", "audit false"}, calls)
+	require.Len(t, e.pushList, 1)
+
+	// named chains are published through the middlewares too.
+	calls = nil
+	c, err = e.PublishToChain(ctx, "other", []byte("other"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit", "enrich", "audit true"}, calls)
+	meta, err = e.loadMetadata(ctx, c)
+	require.NoError(t, err)
+	b, err = meta.Payload.AsBytes()
+	require.NoError(t, err)
+	require.Equal(t, "enriched other", string(b))
+}
+
+func TestEngine_Dedupe(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	e, err := New(WithDatastore(ds))
+	require.NoError(t, err)
+
+	// payloads are indexed before dedupe is enabled.
+	c1, err := e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	c2, err := e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	require.NotEqual(t, c1, c2)
+
+	e, err = New(WithDatastore(ds), WithDedupe(true))
+	require.NoError(t, err)
+	c, err := e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, c2, c)
+	require.Len(t, e.pushList, 2)
+
+	// the payload is matched whatever the codec of its metadata.
+	lp, err := e.LinkPrototypeWithCodec(LinkCodecDagCbor)
+	require.NoError(t, err)
+	c, err = e.PublishBytesData(ctx, []byte("data"), WithLinkPrototype(lp))
+	require.NoError(t, err)
+	require.Equal(t, c2, c)
+
+	c3, err := e.PublishBytesData(ctx, []byte("data"), WithForce())
+	require.NoError(t, err)
+	require.NotEqual(t, c2, c3)
+	require.Len(t, e.pushList, 3)
+	c, err = e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, c3, c)
+
+	c4, err := e.PublishBytesData(ctx, []byte("other"))
+	require.NoError(t, err)
+	require.Len(t, e.pushList, 4)
+	require.Equal(t, c4, e.getLatestMeta(ctx))
+
+	// named chains are deduplicated separately.
+	c5, err := e.PublishToChain(ctx, "other", []byte("data"))
+	require.NoError(t, err)
+	require.NotEqual(t, c3, c5)
+	c, err = e.PublishToChain(ctx, "other", []byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, c5, c)
+}
+
+func TestEngine_LookupByPayload(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New()
+	require.NoError(t, err)
+	_, err = e.LookupByPayload(ctx, []byte("data"))
+	require.ErrorIs(t, err, ErrPayloadNotPublished)
+
+	c1, err := e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	c, err := e.LookupByPayload(ctx, []byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, c1, c)
+
+	// the latest metadata publishing the payload is returned.
+	c2, err := e.PublishBytesData(ctx, []byte("data"))
+	require.NoError(t, err)
+	c, err = e.LookupByPayload(ctx, []byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, c2, c)
+
+	ch, err := e.Chain(ctx, "lookup")
+	require.NoError(t, err)
+	onChain, err := ch.PublishBytesData(ctx, []byte("chain"))
+	require.NoError(t, err)
+	_, err = e.LookupByPayload(ctx, []byte("chain"))
+	require.ErrorIs(t, err, ErrPayloadNotPublished)
+	c, err = ch.LookupByPayload(ctx, []byte("chain"))
+	require.NoError(t, err)
+	require.Equal(t, onChain, c)
+}
+
+func TestEngine_BitswapServer(t *testing.T) {
+	ctx := contextWithTimeout(t)
+	e, err := New(WithBitswapServer(true))
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	c, err := e.PublishBytesData(ctx, []byte("served"))
+	require.NoError(t, err)
+	missing, err := e.PreviewCid(ctx, []byte("missing"))
+	require.NoError(t, err)
+
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	defer h.Close()
+	received := make(chan *bitswapMessage, 4)
+	h.SetStreamHandler(BitswapProtocolID, func(s network.Stream) {
+		defer s.Close()
+		msg, err := readBitswapMessage(bufio.NewReader(s))
+		if err == nil {
+			received <- msg
+		}
+	})
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: e.h.ID(), Addrs: e.h.Addrs()}))
+
+	s, err := h.NewStream(ctx, e.h.ID(), BitswapProtocolID)
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, writeBitswapMessage(s, BitswapProtocolID, &bitswapMessage{Wantlist: []bitswapEntry{
+		{Cid: c, Priority: 1},
+		{Cid: c, WantHave: true},
+		{Cid: missing, SendDontHave: true},
+		{Cid: missing},
+	}}))
+
+	var msg *bitswapMessage
+	select {
+	case msg = <-received:
+	case <-ctx.Done():
+		t.Fatal("no bitswap response")
+	}
+	data, err := e.loadBlock(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, []bitswapBlock{{Cid: c, Data: data}}, msg.Blocks)
+	require.Equal(t, []bitswapPresence{{Cid: c, Have: true}, {Cid: missing, Have: false}}, msg.Presences)
+}
@@ -2,6 +2,113 @@ package engine
 
 import "errors"
 
+// Errors returned by the engine, possibly wrapped with more context, so that callers can branch
+// on them with errors.Is.
 var (
 	ResourceNotFound = errors.New("not found")
+
+	// ErrNoPublishedMetadata is returned by operations that need a published metadata when none
+	// is published yet.
+	ErrNoPublishedMetadata = errors.New("no metadata is published yet")
+	// ErrPublisherDisabled is returned by announcing operations with the NoPublisher kind.
+	ErrPublisherDisabled = errors.New("publisher is disabled")
+	// ErrNotStarted is returned by operations that need the engine to be started.
+	ErrNotStarted = errors.New("engine is not started")
+
+	// ErrFrozen matches the FrozenError returned by publishes while the chain is frozen.
+	ErrFrozen        = errors.New("chain is frozen")
+	ErrAlreadyFrozen = errors.New("chain is already frozen")
+	ErrNotFrozen     = errors.New("chain is not frozen")
+
+	ErrCheckerPaused    = errors.New("inclusion checker is already paused")
+	ErrCheckerNotPaused = errors.New("inclusion checker is not paused")
+
+	// ErrInvalidSignature is returned when a metadata is not validly signed by its provider.
+	ErrInvalidSignature = errors.New("invalid metadata signature")
+	// ErrNotIncluded is returned when Pando does not include a metadata.
+	ErrNotIncluded = errors.New("metadata is not included in Pando")
+	// ErrInclusionMismatch is returned when the inclusion reported by Pando is inconsistent with
+	// the metadata or with its snapshots.
+	ErrInclusionMismatch = errors.New("inclusion does not match")
+	// ErrSyncMismatch is returned when the synced blocks do not match the requested ones.
+	ErrSyncMismatch = errors.New("synced blocks do not match")
+	// ErrSyncLimitExceeded is returned by Sync when the synced blocks exceed the sync limits.
+	ErrSyncLimitExceeded = errors.New("sync limit exceeded")
+	// ErrInvalidSignedHead is returned for the heads of httpsync publishers that are not validly
+	// signed.
+	ErrInvalidSignedHead = errors.New("invalid signed head")
+	// ErrUnexpectedSigner is returned for the heads signed by another signer than the expected one.
+	ErrUnexpectedSigner = errors.New("head signed by an unexpected peer")
+	// ErrIPNSDisabled is returned by the IPNS operations when WithIPNSPublishing is not set.
+	ErrIPNSDisabled = errors.New("IPNS publishing is disabled")
+	// ErrInvalidIPNSRecord is returned for the IPNS records that are not validly signed or expired.
+	ErrInvalidIPNSRecord = errors.New("invalid IPNS record")
+	// ErrAuditLogDisabled is returned by the audit log operations when WithAuditLog is not set.
+	ErrAuditLogDisabled = errors.New("audit log is disabled")
+	// ErrAuditLogTampered is returned when the audit log does not verify.
+	ErrAuditLogTampered = errors.New("audit log is tampered")
+	// ErrChallengeFailed is returned when a challenge response does not prove possession.
+	ErrChallengeFailed = errors.New("challenge failed")
+	// ErrInvalidCheckpoint is returned when a checkpoint is not validly signed by its provider.
+	ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+
+	// ErrInvalidCatFormat is returned by Cat for unknown output formats.
+	ErrInvalidCatFormat = errors.New("invalid cat format")
+	// ErrNotBytesPayload is returned by Cat for byte formats when the payload is not bytes.
+	ErrNotBytesPayload = errors.New("payload is not bytes")
+
+	// ErrInvalidPayload is returned when a payload does not match the schema of its payload type.
+	ErrInvalidPayload = errors.New("invalid payload")
+	// ErrPayloadTooLarge matches the PayloadTooLargeError returned by the publishes of payloads
+	// larger than the max payload size.
+	ErrPayloadTooLarge = errors.New("payload is too large")
+	// ErrQuotaExceeded matches the QuotaExceededError returned by the publishes exceeding the
+	// publish quota.
+	ErrQuotaExceeded = errors.New("publish quota exceeded")
+	// ErrBacklog matches the BacklogError returned by the publishes once the pending inclusion
+	// checks reach the backlog limit.
+	ErrBacklog = errors.New("inclusion check backlog is full")
+	// ErrUnknownPayloadType is returned for payload types without a registered schema.
+	ErrUnknownPayloadType = errors.New("unknown payload type")
+
+	ErrAlreadyMirrored = errors.New("provider is already mirrored")
+	ErrNotMirrored     = errors.New("provider is not mirrored")
+	ErrAlreadyBridged  = errors.New("index-provider is already bridged")
+	ErrNotBridged      = errors.New("index-provider is not bridged")
+
+	ErrAlreadyWatched = errors.New("directory is already watched")
+	ErrNotWatched     = errors.New("directory is not watched")
+
+	ErrAlreadyScheduled = errors.New("job is already scheduled")
+	ErrNotScheduled     = errors.New("job is not scheduled")
+
+	// ErrNotDeadLettered is returned for the cids that are not in the dead-letter list.
+	ErrNotDeadLettered = errors.New("cid is not in the dead-letter list")
+
+	// ErrPayloadNotPublished is returned by the payload lookups when no metadata publishes the
+	// payload.
+	ErrPayloadNotPublished = errors.New("payload is not published")
+	// ErrNotPushed is returned by Republish for the cids not pushed on any chain.
+	ErrNotPushed = errors.New("cid is not pushed")
+	// ErrNoReceipt is returned by GetReceipt for the metadatas without a publish history entry.
+	ErrNoReceipt = errors.New("no receipt of metadata")
+	// ErrInvalidImport is returned by ImportChain for the chains whose blocks, signatures or
+	// continuity do not verify.
+	ErrInvalidImport = errors.New("invalid chain import")
+	// ErrImportDiverges is returned by ImportChain for the chains not extending the local one.
+	ErrImportDiverges = errors.New("imported chain does not extend the local chain")
+
+	// ErrInvalidLabel is returned for labels not in the key=value form.
+	ErrInvalidLabel = errors.New("invalid label")
+
+	// ErrNotInAddrBook is returned for the peers that have no persisted addresses.
+	ErrNotInAddrBook = errors.New("peer is not in the address book")
+
+	// ErrNoAnnounceMessage is returned when no announcement was gossiped since Start.
+	ErrNoAnnounceMessage = errors.New("no announce message was sent")
+	// ErrNotGossiping is returned for the gossip announcements of publishers that do not gossip.
+	ErrNotGossiping = errors.New("publisher does not gossip announcements")
+	// ErrNoAnnouncePeers is returned for the gossip announcements that would reach nobody: no
+	// peer is subscribed to the topic and the host is not connected to Pando.
+	ErrNoAnnouncePeers = errors.New("no peer to gossip announcement to")
 )
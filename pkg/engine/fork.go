@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"net/http"
+	"pandoClient/pkg/alert"
+	"pandoClient/pkg/pandoapi"
+	"sync/atomic"
+	"time"
+)
+
+// ForkState tells how the head of the default chain known by Pando relates to the local one.
+type ForkState string
+
+const (
+	// ForkInSync is reported when Pando knows the local head.
+	ForkInSync ForkState = "in_sync"
+	// ForkBehind is reported when the head known by Pando is an earlier local metadata, e.g.
+	// while Pando syncs the latest publishes.
+	ForkBehind ForkState = "behind"
+	// ForkAhead is reported when the local head is an earlier metadata of the chain known by
+	// Pando, e.g. after restoring an old backup of the datastore: the next publishes would fork
+	// the chain of Pando.
+	ForkAhead ForkState = "ahead"
+	// ForkDiverged is reported when the head known by Pando is not on the local chain and the
+	// local head is not on its chain, e.g. after a rollback.
+	ForkDiverged ForkState = "diverged"
+	// ForkUnknown is reported when Pando knows no head of the provider.
+	ForkUnknown ForkState = "unknown"
+)
+
+// ForkCheck is the result of a comparison of the local chain with the view of Pando.
+type ForkCheck struct {
+	Time      time.Time
+	LocalHead cid.Cid
+	PandoHead cid.Cid
+	State     ForkState
+	// Behind is the number of local metadatas pushed after the latest one known by Pando, when
+	// ForkBehind or ForkDiverged.
+	Behind int `json:",omitempty"`
+	// Ahead is the number of metadatas known by Pando after the latest local one on its chain,
+	// when ForkAhead or ForkDiverged.
+	Ahead int `json:",omitempty"`
+	// Common is the latest metadata of the local chain on the chain known by Pando, cid.Undef if
+	// none is found within the fork walk depth, when ForkAhead or ForkDiverged.
+	Common cid.Cid
+	// Healed tells whether the local head was re-announced for Pando to sync it, when
+	// ForkDiverged and healing is enabled.
+	Healed bool `json:",omitempty"`
+}
+
+// forkWalkDepth is the number of metadatas of the chain known by Pando walked back from its
+// head to find the latest local one.
+const forkWalkDepth = DefaultAncestorDepth
+
+// CheckFork compares the head of the default chain with the head of the provider known by Pando
+// and reports whether they diverged. If the head known by Pando is not a local metadata, its
+// chain is walked back, synced from Pando if not stored locally, to the latest local metadata:
+// the local chain is behind Pando if it is the local head. A divergence or a local chain behind
+// Pando is alerted once, until the chains are back in sync. Only a divergence is healed, by
+// re-announcing the local head if enabled with WithForkDetection, and only once the chain of
+// Pando could be walked.
+func (e *Engine) CheckFork(ctx context.Context) (*ForkCheck, error) {
+	if e.pandoAPI == nil {
+		return nil, fmt.Errorf("pando api is not configured")
+	}
+	check := &ForkCheck{Time: e.clock.Now(), LocalHead: e.getLatestMeta(ctx)}
+	head, err := e.pandoAPI.ProviderHead(ctx, e.h.ID().String())
+	var statusErr *pandoapi.StatusError
+	switch {
+	case err == nil:
+		check.PandoHead = head
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+	default:
+		return nil, fmt.Errorf("failed to get head of provider from Pando: %w", err)
+	}
+
+	e.publishMutex.Lock()
+	pushed := append([]cid.Cid(nil), e.pushList...)
+	e.publishMutex.Unlock()
+	switch {
+	case !check.PandoHead.Defined():
+		check.State = ForkUnknown
+	case check.PandoHead.Equals(check.LocalHead):
+		check.State = ForkInSync
+	default:
+		check.State = ForkDiverged
+		for i := len(pushed) - 1; i >= 0; i-- {
+			if pushed[i].Equals(check.PandoHead) {
+				check.State = ForkBehind
+				check.Behind = len(pushed) - 1 - i
+				break
+			}
+		}
+	}
+	walked := true
+	if check.State == ForkDiverged {
+		if err = e.walkForkPoint(ctx, check, pushed); err != nil {
+			logger.Warnw("Failed to walk the chain known by Pando", "pando", check.PandoHead, "err", err)
+			walked = false
+		}
+	}
+
+	switch check.State {
+	case ForkAhead:
+		logger.Warnw("Local head is behind the head known by Pando", "local", check.LocalHead, "pando", check.PandoHead, "ahead", check.Ahead)
+		if atomic.CompareAndSwapInt32(&e.forkAlerted, 0, 1) {
+			e.raiseAlert(alert.Alert{
+				Kind:    alert.Fork,
+				Message: fmt.Sprintf("local head %s is %d metadatas behind head %s known by Pando", check.LocalHead, check.Ahead, check.PandoHead),
+				Cid:     check.PandoHead,
+			})
+		}
+	case ForkDiverged:
+		logger.Warnw("Head known by Pando is not on the local chain", "local", check.LocalHead, "pando", check.PandoHead, "common", check.Common)
+		if atomic.CompareAndSwapInt32(&e.forkAlerted, 0, 1) {
+			e.raiseAlert(alert.Alert{
+				Kind:    alert.Fork,
+				Message: fmt.Sprintf("head %s known by Pando is not on the local chain of head %s", check.PandoHead, check.LocalHead),
+				Cid:     check.PandoHead,
+			})
+		}
+		if walked && e.forkHeal && e.publisher != nil && check.LocalHead.Defined() {
+			if _, err = e.RePublishLatest(ctx); err != nil {
+				logger.Warnw("Failed to re-announce latest metadata to heal fork", "err", err)
+			} else {
+				check.Healed = true
+			}
+		}
+	default:
+		atomic.StoreInt32(&e.forkAlerted, 0)
+	}
+
+	e.statusMutex.Lock()
+	e.lastForkCheck = check
+	e.statusMutex.Unlock()
+	return check, nil
+}
+
+// walkForkPoint walks the chain known by Pando back from its head to the latest metadata of
+// pushed and records it in check, with ForkAhead if it is the local head. The metadatas missing
+// locally are synced from Pando, stopping at the local head.
+func (e *Engine) walkForkPoint(ctx context.Context, check *ForkCheck, pushed []cid.Cid) error {
+	index := make(map[cid.Cid]int, len(pushed))
+	for i, c := range pushed {
+		index[c] = i
+	}
+	endCid := ""
+	if check.LocalHead.Defined() {
+		endCid = check.LocalHead.String()
+	}
+
+	synced := false
+	c := check.PandoHead
+	for walked := 0; walked < forkWalkDepth; walked++ {
+		if i, ok := index[c]; ok {
+			check.Common = c
+			check.Ahead = walked
+			check.Behind = len(pushed) - 1 - i
+			if check.Behind == 0 {
+				check.State = ForkAhead
+			}
+			return nil
+		}
+		meta, err := e.loadMetadata(ctx, c)
+		if errors.Is(err, datastore.ErrNotFound) && !synced {
+			if e.subscriber == nil {
+				return ErrNotStarted
+			}
+			synced = true
+			if _, err = e.Sync(ctx, c.String(), forkWalkDepth-walked, endCid); err != nil {
+				return fmt.Errorf("failed to sync chain known by Pando: %w", err)
+			}
+			meta, err = e.loadMetadata(ctx, c)
+		}
+		if err != nil {
+			return err
+		}
+		if meta.PreviousID == nil {
+			return nil
+		}
+		prev, ok := (*meta.PreviousID).(cidlink.Link)
+		if !ok {
+			return fmt.Errorf("unexpected previous link of metadata %s", c)
+		}
+		c = prev.Cid
+	}
+	return nil
+}
+
+// LastForkCheck returns the result of the last fork check, nil if none ran yet.
+func (e *Engine) LastForkCheck() *ForkCheck {
+	e.statusMutex.Lock()
+	defer e.statusMutex.Unlock()
+	return e.lastForkCheck
+}
+
+// detectForks checks for forks every fork check interval until the engine is shut down.
+func (e *Engine) detectForks() {
+	defer close(e.forkDone)
+	ticker := e.clock.NewTicker(e.forkCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.closing:
+			return
+		case <-ticker.Chan():
+		}
+		if _, err := e.CheckFork(context.Background()); err != nil {
+			logger.Warnw("Failed to check chain for forks", "err", err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/filecoin-project/go-legs/dtsync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"math"
+	"time"
+)
+
+// GossipScoring is the peer scoring of the gossipsub router owned by the engine, applied to the
+// announcement topics: peers forwarding invalid announcements lose score and are pruned from the
+// mesh, then ignored altogether below the graylist threshold.
+// See: WithGossipScoring, DefaultGossipScoring.
+type GossipScoring struct {
+	// GossipThreshold is the score below which no gossip is exchanged with a peer.
+	GossipThreshold float64
+	// PublishThreshold is the score below which the own announcements are not sent to a peer.
+	PublishThreshold float64
+	// GraylistThreshold is the score below which the messages of a peer are ignored.
+	GraylistThreshold float64
+	// TopicWeight is the weight of the score of the announcement topics.
+	TopicWeight float64
+	// InvalidMessageWeight is the penalty of every invalid announcement forwarded by a peer,
+	// squared. It must be negative.
+	InvalidMessageWeight float64
+}
+
+// DefaultGossipScoring returns scoring thresholds suitable for the announcement topics, where
+// few messages are gossiped: a few invalid announcements are enough to graylist a peer.
+func DefaultGossipScoring() GossipScoring {
+	return GossipScoring{
+		GossipThreshold:      -500,
+		PublishThreshold:     -1000,
+		GraylistThreshold:    -2500,
+		TopicWeight:          1,
+		InvalidMessageWeight: -100,
+	}
+}
+
+func (s GossipScoring) validate() error {
+	for _, v := range []float64{s.GossipThreshold, s.PublishThreshold, s.GraylistThreshold, s.TopicWeight, s.InvalidMessageWeight} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("gossip scoring values must be valid numbers")
+		}
+	}
+	if s.GossipThreshold > 0 || s.PublishThreshold > s.GossipThreshold || s.GraylistThreshold > s.PublishThreshold {
+		return fmt.Errorf("gossip score thresholds must be negative, with graylist <= publish <= gossip")
+	}
+	if s.TopicWeight < 0 {
+		return fmt.Errorf("gossip topic weight can not be negative")
+	}
+	if s.InvalidMessageWeight >= 0 {
+		return fmt.Errorf("gossip invalid message weight must be negative")
+	}
+	return nil
+}
+
+func (s GossipScoring) peerScore() (*pubsub.PeerScoreParams, *pubsub.PeerScoreThresholds) {
+	params := &pubsub.PeerScoreParams{
+		Topics:           make(map[string]*pubsub.TopicScoreParams),
+		AppSpecificScore: func(peer.ID) float64 { return 0 },
+		DecayInterval:    pubsub.DefaultDecayInterval,
+		DecayToZero:      pubsub.DefaultDecayToZero,
+		RetainScore:      time.Hour,
+	}
+	thresholds := &pubsub.PeerScoreThresholds{
+		GossipThreshold:   s.GossipThreshold,
+		PublishThreshold:  s.PublishThreshold,
+		GraylistThreshold: s.GraylistThreshold,
+	}
+	return params, thresholds
+}
+
+// topicScore only scores the invalid announcements, the others are too rare for the mesh
+// delivery scores to be meaningful.
+func (s GossipScoring) topicScore() *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight:                    s.TopicWeight,
+		TimeInMeshQuantum:              time.Second,
+		InvalidMessageDeliveriesWeight: s.InvalidMessageWeight,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+// AnnounceValidator validates an announcement received on the announcement topics of the engine.
+// from is the original announcer, which may not be the peer that forwarded it. Rejected
+// announcements are not forwarded and penalize the forwarding peer when scoring is enabled, the
+// ignored ones are only dropped.
+// See: WithAnnounceValidator.
+type AnnounceValidator func(ctx context.Context, from peer.ID, msg *dtsync.Message) pubsub.ValidationResult
+
+// validatesAnnouncements tells whether the announcements gossiped on the engine topics are
+// validated.
+func (e *Engine) validatesAnnouncements() bool {
+	return e.announceValidation || len(e.allowedAnnouncers) != 0 || len(e.announceValidators) != 0
+}
+
+// validateAnnouncement rejects the messages that are not announcements of a cid and the ones of
+// the announcers not allowed, then runs the announcement validators.
+func (e *Engine) validateAnnouncement(ctx context.Context, _ peer.ID, m *pubsub.Message) pubsub.ValidationResult {
+	from := m.GetFrom()
+	if from == e.h.ID() {
+		return pubsub.ValidationAccept
+	}
+	var msg dtsync.Message
+	if err := msg.UnmarshalCBOR(bytes.NewReader(m.GetData())); err != nil || !msg.Cid.Defined() {
+		logger.Warnw("Rejected invalid announcement", "topic", m.GetTopic(), "from", from, "err", err)
+		return pubsub.ValidationReject
+	}
+	if len(e.allowedAnnouncers) != 0 {
+		if _, ok := e.allowedAnnouncers[from]; !ok {
+			logger.Warnw("Rejected announcement of peer not allowed", "topic", m.GetTopic(), "from", from, "cid", msg.Cid)
+			return pubsub.ValidationReject
+		}
+	}
+	for _, validate := range e.announceValidators {
+		if res := validate(ctx, from, &msg); res != pubsub.ValidationAccept {
+			return res
+		}
+	}
+	return pubsub.ValidationAccept
+}
+
+// joinTopic joins the topic name on the engine-owned router, with the announcement validator
+// and the topic scoring when configured.
+func (e *Engine) joinTopic(name string) (*pubsub.Topic, error) {
+	validated := e.validatesAnnouncements()
+	if validated {
+		if err := e.ps.RegisterTopicValidator(name, e.validateAnnouncement); err != nil {
+			return nil, fmt.Errorf("failed to register announcement validator on topic %s: %w", name, err)
+		}
+	}
+	t, err := e.ps.Join(name)
+	if err != nil {
+		if validated {
+			_ = e.ps.UnregisterTopicValidator(name)
+		}
+		return nil, fmt.Errorf("failed to join topic %s: %w", name, err)
+	}
+	if e.gossipScoring != nil {
+		if err = t.SetScoreParams(e.gossipScoring.topicScore()); err != nil {
+			_ = t.Close()
+			if validated {
+				_ = e.ps.UnregisterTopicValidator(name)
+			}
+			return nil, fmt.Errorf("failed to set score of topic %s: %w", name, err)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultAncestorDepth is the number of metadatas walked by ancestor verifications if not set.
+const DefaultAncestorDepth = 1000
+
+var errStopWalk = errors.New("stop walk")
+
+// AncestorCheck is the result of an ancestor verification.
+type AncestorCheck struct {
+	Head     cid.Cid
+	Ancestor cid.Cid
+	// IsAncestor tells whether Ancestor is Head or one of its previous metadatas.
+	IsAncestor bool
+	// Distance is the number of metadatas from Head to Ancestor, -1 if it is not an ancestor.
+	Distance int
+	// Truncated tells that the walk stopped at the depth limit before the first metadata of the
+	// chain, so Ancestor may still be a farther ancestor.
+	Truncated bool
+}
+
+// Head returns the latest published metadata, cid.Undef if nothing is published yet.
+func (e *Engine) Head() cid.Cid {
+	return e.getLatestMeta(context.Background())
+}
+
+// ProviderHead returns the latest metadata of provider known by Pando.
+func (e *Engine) ProviderHead(ctx context.Context, provider peer.ID) (cid.Cid, error) {
+	return e.pandoAPI.ProviderHead(ctx, provider.String())
+}
+
+// VerifyAncestor walks the local chain back from head, or from the latest metadata if head is
+// cid.Undef, for up to maxDepth metadatas and tells whether ancestor is on it.
+func (e *Engine) VerifyAncestor(ctx context.Context, head, ancestor cid.Cid, maxDepth int) (*AncestorCheck, error) {
+	if !head.Defined() {
+		head = e.getLatestMeta(ctx)
+		if !head.Defined() {
+			return nil, ErrNoPublishedMetadata
+		}
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultAncestorDepth
+	}
+
+	check := &AncestorCheck{Head: head, Ancestor: ancestor, Distance: -1}
+	walked := 0
+	err := e.WalkChain(ctx, head, func(c cid.Cid, _ *schema.Metadata) error {
+		if c == ancestor {
+			check.IsAncestor = true
+			check.Distance = walked
+			return errStopWalk
+		}
+		walked++
+		if walked >= maxDepth {
+			check.Truncated = true
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return nil, err
+	}
+	return check, nil
+}
+
+// VerifyProviderAncestor tells whether ancestor is on the chain of provider, walking back up to
+// maxDepth metadatas from the latest one known by Pando. The metadatas missing locally are synced
+// from Pando first, stopping at ancestor.
+func (e *Engine) VerifyProviderAncestor(ctx context.Context, provider peer.ID, ancestor cid.Cid, maxDepth int) (*AncestorCheck, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultAncestorDepth
+	}
+	head, err := e.ProviderHead(ctx, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head of provider %s: %w", provider, err)
+	}
+	if _, err = e.Sync(ctx, head.String(), maxDepth, ancestor.String()); err != nil {
+		return nil, fmt.Errorf("failed to sync chain of provider %s: %w", provider, err)
+	}
+	return e.VerifyAncestor(ctx, head, ancestor, maxDepth)
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"github.com/ipfs/go-cid"
+	"time"
+)
+
+// headExportRetryInterval is the interval the head is exported again at to the exporters that
+// failed to export it.
+const headExportRetryInterval = time.Minute
+
+// exportHeads exports the latest metadata to the exporters set with WithHeadExporter on every
+// head update, until the engine is shut down. The exporters failing are retried every
+// headExportRetryInterval until they export the latest head.
+func (e *Engine) exportHeads() {
+	defer close(e.headExportDone)
+	exported := make([]cid.Cid, len(e.headExporters))
+	ticker := time.NewTicker(headExportRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.closing:
+			return
+		case <-ticker.C:
+		case <-e.headExportCh:
+		}
+		head := e.getLatestMeta(context.Background())
+		if head == cid.Undef {
+			continue
+		}
+		for i, x := range e.headExporters {
+			if exported[i] == head {
+				continue
+			}
+			if err := x.ExportHead(context.Background(), head); err != nil {
+				logger.Warnw("Failed to export head", "head", head, "err", err)
+				continue
+			}
+			exported[i] = head
+			logger.Infow("Exported head", "head", head)
+		}
+	}
+}
+
+func (e *Engine) triggerHeadExport() {
+	select {
+	case e.headExportCh <- struct{}{}:
+	default:
+	}
+}
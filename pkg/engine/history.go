@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"time"
+)
+
+var (
+	dsHistoryKey      = datastore.NewKey("sync/history")
+	dsHistoryIndexKey = datastore.NewKey("sync/meta/historyIndex")
+)
+
+// AnnounceStatus tells how a published metadata was announced.
+type AnnounceStatus string
+
+const (
+	// NotAnnounced metadatas are published without a publisher.
+	NotAnnounced AnnounceStatus = "none"
+	// Announced metadatas are announced successfully.
+	Announced AnnounceStatus = "announced"
+	// AnnounceQueued metadatas wait in the announce queue.
+	AnnounceQueued AnnounceStatus = "queued"
+	// AnnounceFailed metadatas failed to be announced and queued, they are only republished by
+	// the check list.
+	AnnounceFailed AnnounceStatus = "failed"
+)
+
+// HistoryEntry is the record of a publish.
+type HistoryEntry struct {
+	Cid cid.Cid
+	// Chain is the named chain published to, empty for the default chain.
+	Chain string `json:",omitempty"`
+	// PayloadSize is the size of a bytes payload, or of the dag-json encoding of other payloads.
+	PayloadSize int
+	// StoredAt is the time the metadata was stored locally, before it was announced, zero for
+	// the publishes recorded by older versions.
+	StoredAt    time.Time
+	PublishedAt time.Time
+	// Topic is the announcement topic set by WithAnnounceTopic, empty for the engine topic.
+	Topic    string `json:",omitempty"`
+	Announce AnnounceStatus
+	// AnnouncedAt is the time of the announcement, zero if it is not announced yet.
+	AnnouncedAt time.Time
+	// AnnounceError is the error of the last failed announcement, kept once it succeeds.
+	AnnounceError string `json:",omitempty"`
+	// IncludedAt is the time the inclusion in Pando was confirmed by the check list, zero if it
+	// is not confirmed yet.
+	IncludedAt time.Time
+	// Annotations are the local annotations of the metadata, see Engine.Annotate. They are not
+	// recorded in the history but read along with it.
+	Annotations Annotations `json:",omitempty"`
+}
+
+// History returns the publishes of all the chains from from, included, to to, excluded, oldest
+// first, with their annotations. A zero to returns the publishes up to now.
+func (e *Engine) History(ctx context.Context, from time.Time, to time.Time) ([]HistoryEntry, error) {
+	res, err := e.historyDs().Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	entries := make([]HistoryEntry, 0)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var entry HistoryEntry
+		if err = json.Unmarshal(r.Value, &entry); err != nil {
+			return nil, err
+		}
+		if entry.PublishedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !entry.PublishedAt.Before(to) {
+			break
+		}
+		if err = e.annotateEntry(ctx, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// annotateEntry sets the annotations of entry, if any.
+func (e *Engine) annotateEntry(ctx context.Context, entry *HistoryEntry) error {
+	a, err := e.GetAnnotations(ctx, entry.Cid)
+	if err != nil {
+		return fmt.Errorf("failed to get annotations of %s: %w", entry.Cid, err)
+	}
+	if len(a) != 0 {
+		entry.Annotations = a
+	}
+	return nil
+}
+
+func (e *Engine) historyDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsHistoryKey)
+}
+
+func (e *Engine) historyIndexDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsHistoryIndexKey)
+}
+
+// newHistoryEntry returns the history entry of c, stored now on chain with the options opts.
+func newHistoryEntry(c cid.Cid, chain string, payload datamodel.Node, opts *publishOptions) HistoryEntry {
+	return HistoryEntry{
+		Cid:         c,
+		Chain:       chain,
+		PayloadSize: payloadSize(payload),
+		StoredAt:    time.Now(),
+		Topic:       opts.topic,
+	}
+}
+
+// recordPublish records the publish of entry once its announcement ended with status, failing
+// with announceErr if not nil. Failures are only logged, so that they do not fail publishes.
+func (e *Engine) recordPublish(ctx context.Context, entry HistoryEntry, status AnnounceStatus, announceErr error) {
+	now := time.Now()
+	c := entry.Cid
+	entry.PublishedAt = now
+	entry.Announce = status
+	if status == Announced {
+		entry.AnnouncedAt = now
+	}
+	if announceErr != nil {
+		entry.AnnounceError = announceErr.Error()
+	}
+	// keys sort by publish time.
+	key := datastore.NewKey(fmt.Sprintf("%020d-%s", now.UnixNano(), c))
+
+	e.historyMutex.Lock()
+	defer e.historyMutex.Unlock()
+	if err := e.putHistoryEntry(ctx, key, &entry); err != nil {
+		logger.Warnw("Failed to record publish history", "cid", c, "err", err)
+		return
+	}
+	if err := e.historyIndexDs().Put(ctx, datastore.NewKey(c.String()), []byte(key.String())); err != nil {
+		logger.Warnw("Failed to index publish history", "cid", c, "err", err)
+	}
+}
+
+// historyAnnounced records the first announcement of c, e.g. once it is flushed from the
+// announce queue.
+func (e *Engine) historyAnnounced(ctx context.Context, c cid.Cid) {
+	e.updateHistory(ctx, c, func(entry *HistoryEntry) {
+		entry.Announce = Announced
+		if entry.AnnouncedAt.IsZero() {
+			entry.AnnouncedAt = time.Now()
+		}
+	})
+}
+
+// historyAnnounceFailed records the failure of a retried announcement of c, e.g. of a flush of
+// the announce queue.
+func (e *Engine) historyAnnounceFailed(ctx context.Context, c cid.Cid, err error) {
+	e.updateHistory(ctx, c, func(entry *HistoryEntry) {
+		entry.AnnounceError = err.Error()
+	})
+}
+
+// historyIncluded records the confirmed inclusion of c in Pando.
+func (e *Engine) historyIncluded(ctx context.Context, c cid.Cid) {
+	e.updateHistory(ctx, c, func(entry *HistoryEntry) {
+		if entry.IncludedAt.IsZero() {
+			entry.IncludedAt = time.Now()
+		}
+	})
+}
+
+// historyEntry returns the history entry of c, nil if it has none.
+func (e *Engine) historyEntry(ctx context.Context, c cid.Cid) *HistoryEntry {
+	e.historyMutex.Lock()
+	defer e.historyMutex.Unlock()
+	b, err := e.historyIndexDs().Get(ctx, datastore.NewKey(c.String()))
+	if err != nil {
+		return nil
+	}
+	if b, err = e.historyDs().Get(ctx, datastore.NewKey(string(b))); err != nil {
+		return nil
+	}
+	var entry HistoryEntry
+	if err = json.Unmarshal(b, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// updateHistory applies update to the history entry of c, if it has one.
+func (e *Engine) updateHistory(ctx context.Context, c cid.Cid, update func(entry *HistoryEntry)) {
+	e.historyMutex.Lock()
+	defer e.historyMutex.Unlock()
+	b, err := e.historyIndexDs().Get(ctx, datastore.NewKey(c.String()))
+	if err != nil {
+		if err != datastore.ErrNotFound {
+			logger.Warnw("Failed to look up publish history", "cid", c, "err", err)
+		}
+		return
+	}
+	key := datastore.NewKey(string(b))
+	if b, err = e.historyDs().Get(ctx, key); err != nil {
+		logger.Warnw("Failed to get publish history", "cid", c, "err", err)
+		return
+	}
+	var entry HistoryEntry
+	if err = json.Unmarshal(b, &entry); err != nil {
+		logger.Warnw("Invalid publish history entry", "cid", c, "err", err)
+		return
+	}
+	update(&entry)
+	if err = e.putHistoryEntry(ctx, key, &entry); err != nil {
+		logger.Warnw("Failed to update publish history", "cid", c, "err", err)
+	}
+}
+
+func (e *Engine) putHistoryEntry(ctx context.Context, key datastore.Key, entry *HistoryEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return e.historyDs().Put(ctx, key, b)
+}
+
+func payloadSize(payload datamodel.Node) int {
+	if payload == nil {
+		return 0
+	}
+	if b, err := payload.AsBytes(); err == nil {
+		return len(b)
+	}
+	var w countingWriter
+	if err := dagjson.Encode(payload, &w); err != nil {
+		return 0
+	}
+	return int(w)
+}
+
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
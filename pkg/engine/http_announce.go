@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/filecoin-project/go-legs/dtsync"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multiaddr"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const defaultHttpAnnounceTimeout = 10 * time.Second
+
+// httpAnnounce POSTs the announcement of c to the HTTP announce endpoint of Pando. The body is
+// the CBOR encoded dtsync message also sent over gossipsub, with the addresses of the publisher
+// including the peer ID of the engine.
+func (e *Engine) httpAnnounce(ctx context.Context, c cid.Cid, extraData []byte) error {
+	addrs, err := e.announceAddrs()
+	if err != nil {
+		return err
+	}
+	msg := dtsync.Message{
+		Cid:       c,
+		ExtraData: extraData,
+		OrigPeer:  e.h.ID().String(),
+	}
+	msg.SetAddrs(addrs)
+	buf := bytes.NewBuffer(nil)
+	if err = msg.MarshalCBOR(buf); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.httpAnnounceTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.httpAnnounceURL, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cbor")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to announce over http: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("failed to announce over http, got status: %d, body: %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+// announceAddrs returns the addresses the chain is synced from, encapsulated with the peer ID
+// of the engine so that Pando knows which provider announced.
+func (e *Engine) announceAddrs() ([]multiaddr.Multiaddr, error) {
+	addrs := e.h.Addrs()
+	if pub, ok := e.publisher.(interface{ Address() multiaddr.Multiaddr }); ok && e.pubKind == HttpPublisher {
+		addrs = []multiaddr.Multiaddr{pub.Address()}
+	}
+	p2pAddr, err := multiaddr.NewComponent("p2p", e.h.ID().String())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		res = append(res, a.Encapsulate(p2pAddr))
+	}
+	return res, nil
+}
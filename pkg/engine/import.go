@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"io"
+)
+
+// ChainImport is the result of ImportChain.
+type ChainImport struct {
+	Head cid.Cid
+	// Base is the local metadata the imported chain extends, undefined if it is imported from its
+	// first metadata.
+	Base cid.Cid
+	// Imported are the metadatas adopted as local history, oldest first.
+	Imported []cid.Cid
+	// Replaced are the local metadatas pushed after Base and dropped, oldest first.
+	Replaced []cid.Cid `json:",omitempty"`
+}
+
+// ImportChain adopts the chain of another instance using the same key as the history of the
+// default chain, e.g. to move a provider to a new host or to recover from the loss of the local
+// datastore. r is a CARv1 stream rooted at the head of the chain, such as the ones written by
+// SyncToCAR.
+//
+// Before the head is switched, every block must match its cid and the chain is walked from the
+// head following PreviousID: every metadata must be in the archive and signed by the engine
+// identity, until the first one of the chain or a metadata pushed locally, the base. Otherwise
+// ErrInvalidImport is returned and nothing is changed. If local metadatas were pushed after the
+// base, ErrImportDiverges is returned unless replace is set, in which case they are dropped like
+// rolled back. The new head is then announced, or queued to be if the announcement fails.
+func (e *Engine) ImportChain(ctx context.Context, r io.Reader, replace bool) (*ChainImport, error) {
+	roots, blocks, err := readCar(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("%w: archive must have the head as single root, has %d roots", ErrInvalidImport, len(roots))
+	}
+	head := roots[0]
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(_ ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		data, ok := blocks[lnk.(cidlink.Link).Cid]
+		if !ok {
+			return nil, datastore.ErrNotFound
+		}
+		return bytes.NewReader(data), nil
+	}
+
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	if err = e.checkFrozen(); err != nil {
+		return nil, err
+	}
+	pushed := make(map[cid.Cid]int, len(e.pushList))
+	for i, c := range e.pushList {
+		pushed[c] = i
+	}
+	res := &ChainImport{Head: head}
+	base := -1
+	for c := head; ; {
+		if i, ok := pushed[c]; ok {
+			res.Base = c
+			base = i
+			break
+		}
+		if _, ok := blocks[c]; !ok {
+			return nil, fmt.Errorf("%w: metadata %s is missing from the archive", ErrInvalidImport, c)
+		}
+		n, err := lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, schema.MetadataPrototype)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to load metadata %s: %v", ErrInvalidImport, c, err)
+		}
+		meta, err := schema.UnwrapMetadata(n)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode metadata %s: %v", ErrInvalidImport, c, err)
+		}
+		signer, err := schema.VerifyMetadata(meta)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid signature of metadata %s: %v", ErrInvalidImport, c, err)
+		}
+		if signer != e.h.ID() {
+			return nil, fmt.Errorf("%w: metadata %s is signed by %s, not by this provider", ErrInvalidImport, c, signer)
+		}
+		res.Imported = append([]cid.Cid{c}, res.Imported...)
+		if meta.PreviousID == nil {
+			break
+		}
+		c = (*meta.PreviousID).(cidlink.Link).Cid
+	}
+	res.Replaced = append([]cid.Cid(nil), e.pushList[base+1:]...)
+	if len(res.Imported) == 0 && len(res.Replaced) == 0 {
+		// the head is the local one already.
+		return res, nil
+	}
+	if len(res.Replaced) != 0 && !replace {
+		return nil, fmt.Errorf("%w: %d local metadatas are pushed after %s", ErrImportDiverges, len(res.Replaced), res.Base)
+	}
+
+	for c, data := range blocks {
+		if err = e.bs.Put(ctx, c, data); err != nil {
+			return nil, fmt.Errorf("failed to store imported block %s: %w", c, err)
+		}
+	}
+	list := append(append([]cid.Cid(nil), e.pushList[:base+1]...), res.Imported...)
+	if err = e.updateLatestMeta(ctx, head); err != nil {
+		return nil, fmt.Errorf("failed to update reference to latest metadata: %w", err)
+	}
+	if err = e.updatePushedList(ctx, list); err != nil {
+		return nil, fmt.Errorf("failed to update pushed cid list: %w", err)
+	}
+	if len(res.Replaced) != 0 {
+		e.appendAuditLog(ctx, AuditRollback, res.Base, "")
+	}
+	for _, c := range res.Imported {
+		e.appendAuditLog(ctx, AuditImport, c, "")
+	}
+	logger.Infow("Imported chain", "head", head, "base", res.Base, "imported", len(res.Imported), "replaced", len(res.Replaced))
+
+	if len(res.Replaced) != 0 {
+		dropped := make(map[cid.Cid]struct{}, len(res.Replaced))
+		for _, c := range res.Replaced {
+			dropped[c] = struct{}{}
+		}
+		if err = e.cr.removeChecks(ctx, res.Replaced); err != nil {
+			return nil, fmt.Errorf("failed to remove replaced metadatas from check list: %w", err)
+		}
+		if err = e.dropQueuedAnnounces(ctx, dropped); err != nil {
+			return nil, fmt.Errorf("failed to remove replaced metadatas from announce queue: %w", err)
+		}
+		if err = e.unindexLabels(ctx, dropped); err != nil {
+			logger.Warnw("Failed to unindex labels of replaced metadatas", "err", err)
+		}
+	}
+	idx := e.payloadIndex()
+	for _, c := range res.Replaced {
+		if meta, err := e.loadMetadata(ctx, c); err == nil {
+			if err = idx.unindex(ctx, meta.Payload, c); err != nil {
+				logger.Warnw("Failed to unindex payload of replaced metadata", "cid", c, "err", err)
+			}
+		}
+	}
+	for _, c := range res.Imported {
+		meta, err := e.loadMetadata(ctx, c)
+		if err != nil {
+			continue
+		}
+		if key, err := payloadKey(meta.Payload); err == nil {
+			idx.index(ctx, key, c)
+		}
+	}
+
+	if e.publisher != nil {
+		qa := queuedAnnounce{Cid: head, ExtraData: e.extraGossipData(nil), SkipCheck: true}
+		if err = e.announceOrEnqueue(ctx, qa); err != nil {
+			return res, fmt.Errorf("imported but failed to queue announcement of new head: %w", err)
+		}
+	}
+	return res, nil
+}
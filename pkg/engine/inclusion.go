@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"pandoClient/pkg/pandoapi"
+	"sync"
+)
+
+// auditBatchSize is the number of inclusion queries sent to Pando concurrently by Audit.
+const auditBatchSize = 16
+
+// AuditEntry is a pushed metadata whose inclusion in Pando is not confirmed.
+type AuditEntry struct {
+	Cid cid.Cid
+	// InCheckList tells whether the metadata is still checked and republished by the engine.
+	InCheckList bool
+	// Err is the error of the inclusion query, empty if Pando reported the metadata as missing.
+	Err string `json:",omitempty"`
+}
+
+// AuditReport is the inclusion status in Pando of all the pushed metadatas.
+type AuditReport struct {
+	Total    int
+	Included int
+	// Missing are the metadatas that Pando reported as not included.
+	Missing []AuditEntry
+	// Unconfirmed are the metadatas whose inclusion could not be queried.
+	Unconfirmed []AuditEntry
+}
+
+// VerifyInclusion checks that the metadata c published by the engine is included in Pando
+// instead of trusting the inclusion status returned by it:
+//   - the metadata must be signed by the engine identity, it is fetched from Pando if it is no
+//     longer stored locally, see WithPersistAfterSend;
+//   - the inclusion must be reported for c and the engine provider;
+//   - if it is reported in a snapshot, the snapshot block is fetched from Pando and must hash to
+//     the reported snapshot cid, be at the reported height, match the snapshot Pando returns at
+//     that height and list c among the metadatas of the provider.
+//
+// Pando does not expose merkle paths nor signatures of the snapshots yet, so a snapshot is
+// trusted once its block hashes to the cid Pando reported.
+func (e *Engine) VerifyInclusion(ctx context.Context, c cid.Cid) (*MetaInclusion, error) {
+	meta, err := e.loadMetadata(ctx, c)
+	if errors.Is(err, datastore.ErrNotFound) {
+		meta, err = e.fetchMetadata(ctx, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, err := schema.VerifyMetadata(meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w of metadata %s: %v", ErrInvalidSignature, c, err)
+	}
+	if signer != e.h.ID() {
+		return nil, fmt.Errorf("%w: metadata %s is signed by %s, not by this provider", ErrInvalidSignature, c, signer)
+	}
+
+	inclusion, err := e.pandoAPI.MetaInclusion(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if !inclusion.ID.Equals(c) {
+		return nil, fmt.Errorf("%w: inclusion returned for %s, expected %s", ErrInclusionMismatch, inclusion.ID, c)
+	}
+	if !inclusion.InPando {
+		return nil, fmt.Errorf("%w: %s", ErrNotIncluded, c)
+	}
+	if inclusion.Provider != meta.Provider {
+		return nil, fmt.Errorf("%w: metadata %s is included for provider %s, expected %s", ErrInclusionMismatch, c, inclusion.Provider, meta.Provider)
+	}
+	if !inclusion.InSnapShot {
+		return inclusion, nil
+	}
+
+	n, err := e.fetchBlock(ctx, inclusion.SnapShotID, basicnode.Prototype.Any)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch snapshot %s: %w", inclusion.SnapShotID, err)
+	}
+	snapshot, err := decodeSnapshot(n)
+	if err != nil {
+		return nil, fmt.Errorf("%w: snapshot %s: %v", ErrInclusionMismatch, inclusion.SnapShotID, err)
+	}
+	if snapshot.Height != inclusion.SnapShotHeight {
+		return nil, fmt.Errorf("%w: snapshot %s is at height %d, inclusion reports %d", ErrInclusionMismatch, inclusion.SnapShotID, snapshot.Height, inclusion.SnapShotHeight)
+	}
+	byHeight, err := e.pandoAPI.SnapshotByHeight(ctx, inclusion.SnapShotHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot at height %d: %w", inclusion.SnapShotHeight, err)
+	}
+	if byHeight.PrevSnapShot != snapshot.PrevSnapShot || byHeight.CreateTime != snapshot.CreateTime {
+		return nil, fmt.Errorf("%w: snapshot %s does not match the snapshot at height %d", ErrInclusionMismatch, inclusion.SnapShotID, inclusion.SnapShotHeight)
+	}
+	list, ok := snapshot.Update[meta.Provider]
+	if !ok || list == nil {
+		return nil, fmt.Errorf("%w: snapshot %s has no metadata of provider %s", ErrNotIncluded, inclusion.SnapShotID, meta.Provider)
+	}
+	for _, mc := range list.MetaList {
+		if mc.Equals(c) {
+			e.cacheInclusion(ctx, c, inclusion)
+			return inclusion, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: snapshot %s does not list metadata %s", ErrNotIncluded, inclusion.SnapShotID, c)
+}
+
+// fetchMetadata fetches the metadata c from Pando without storing it locally.
+func (e *Engine) fetchMetadata(ctx context.Context, c cid.Cid) (*schema.Metadata, error) {
+	n, err := e.fetchBlock(ctx, c, schema.MetadataPrototype)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata %s: %w", c, err)
+	}
+	return schema.UnwrapMetadata(n)
+}
+
+// fetchBlock syncs the block c alone from Pando into memory, checks that its data hashes to c
+// and decodes it with np.
+func (e *Engine) fetchBlock(ctx context.Context, c cid.Cid, np datamodel.NodePrototype) (datamodel.Node, error) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+	if _, err := e.SyncInto(ctx, lsys, c.String(), 1, ""); err != nil {
+		return nil, err
+	}
+	lnk := cidlink.Link{Cid: c}
+	b, err := store.Get(ctx, lnk.Binary())
+	if err != nil {
+		return nil, err
+	}
+	sum, err := c.Prefix().Sum(b)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("%w: block hashes to %s, expected %s", ErrInclusionMismatch, sum, c)
+	}
+	return lsys.Load(ipld.LinkContext{Ctx: ctx}, lnk, np)
+}
+
+// decodeSnapshot reads the fields of the snapshot block n of Pando, a map encoded the same as
+// the json snapshots Pando returns.
+func decodeSnapshot(n datamodel.Node) (*pandoapi.Snapshot, error) {
+	snapshot := &pandoapi.Snapshot{Update: make(map[string]*pandoapi.Metalist)}
+	if n.Kind() != datamodel.Kind_Map {
+		return nil, fmt.Errorf("snapshot is a %s, expected a map", n.Kind())
+	}
+	height, err := nodeUint(n, "Height")
+	if err != nil {
+		return nil, err
+	}
+	createTime, err := nodeUint(n, "CreateTime")
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Height, snapshot.CreateTime = height, createTime
+	if prev, err := n.LookupByString("PrevSnapShot"); err == nil && !prev.IsNull() {
+		if snapshot.PrevSnapShot, err = prev.AsString(); err != nil {
+			return nil, fmt.Errorf("invalid PrevSnapShot: %w", err)
+		}
+	}
+
+	update, err := n.LookupByString("Update")
+	if err != nil {
+		return nil, fmt.Errorf("missing Update: %w", err)
+	}
+	if update.IsNull() {
+		return snapshot, nil
+	}
+	it := update.MapIterator()
+	if it == nil {
+		return nil, fmt.Errorf("invalid Update: %s is not a map", update.Kind())
+	}
+	for !it.Done() {
+		k, v, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		provider, err := k.AsString()
+		if err != nil {
+			return nil, err
+		}
+		l, err := v.LookupByString("MetaList")
+		if err != nil {
+			return nil, fmt.Errorf("invalid Update of %s: %w", provider, err)
+		}
+		list := &pandoapi.Metalist{}
+		li := l.ListIterator()
+		for li != nil && !li.Done() {
+			_, lv, err := li.Next()
+			if err != nil {
+				return nil, err
+			}
+			lnk, err := lv.AsLink()
+			if err != nil {
+				return nil, fmt.Errorf("invalid MetaList of %s: %w", provider, err)
+			}
+			list.MetaList = append(list.MetaList, lnk.(cidlink.Link).Cid)
+		}
+		snapshot.Update[provider] = list
+	}
+	return snapshot, nil
+}
+
+func nodeUint(n datamodel.Node, field string) (uint64, error) {
+	v, err := n.LookupByString(field)
+	if err != nil {
+		return 0, fmt.Errorf("missing %s: %w", field, err)
+	}
+	i, err := v.AsInt()
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %s", field)
+	}
+	return uint64(i), nil
+}
+
+// Audit queries the inclusion in Pando of every pushed metadata, by batches of concurrent
+// queries, and reports the ones that are missing or could not be confirmed. Unlike the check
+// list, which only follows the metadatas until they are included once, it covers the whole
+// pushed cid list of the default chain. The inclusions cached by the engine are not queried
+// again. It fails only if ctx is done.
+func (e *Engine) Audit(ctx context.Context) (*AuditReport, error) {
+	list, err := e.GetPushedList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.cr.checkMutex.Lock()
+	checks := make(map[string]struct{}, len(e.cr.checkMap))
+	for c := range e.cr.checkMap {
+		checks[c] = struct{}{}
+	}
+	e.cr.checkMutex.Unlock()
+
+	report := &AuditReport{Total: len(list)}
+	statuses := make([]AuditEntry, len(list))
+	included := make([]bool, len(list))
+	for start := 0; start < len(list); start += auditBatchSize {
+		end := start + auditBatchSize
+		if end > len(list) {
+			end = len(list)
+		}
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				statuses[i].Cid = list[i]
+				inclusion, err := e.GetInclusion(ctx, list[i])
+				if err != nil {
+					statuses[i].Err = err.Error()
+					return
+				}
+				included[i] = inclusion.InPando
+			}(i)
+		}
+		wg.Wait()
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, status := range statuses {
+		_, status.InCheckList = checks[status.Cid.String()]
+		switch {
+		case status.Err != "":
+			report.Unconfirmed = append(report.Unconfirmed, status)
+		case included[i]:
+			report.Included++
+		default:
+			report.Missing = append(report.Missing, status)
+		}
+	}
+	logger.Infow("Audited pushed metadatas", "total", report.Total, "included", report.Included,
+		"missing", len(report.Missing), "unconfirmed", len(report.Unconfirmed))
+	return report, nil
+}
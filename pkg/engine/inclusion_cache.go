@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"time"
+)
+
+var dsInclusionCacheKey = datastore.NewKey("sync/meta/inclusionCache")
+
+// ConfirmedInclusion is an inclusion confirmed by Pando, cached by the engine.
+type ConfirmedInclusion struct {
+	Cid            cid.Cid
+	Provider       string
+	SnapshotCid    cid.Cid
+	SnapshotHeight uint64
+	Context        []byte
+	TransactionID  int
+	ConfirmedAt    time.Time
+}
+
+func (ci *ConfirmedInclusion) inclusion() *MetaInclusion {
+	return &MetaInclusion{
+		ID:             ci.Cid,
+		Provider:       ci.Provider,
+		InPando:        true,
+		InSnapShot:     true,
+		SnapShotID:     ci.SnapshotCid,
+		SnapShotHeight: ci.SnapshotHeight,
+		Context:        ci.Context,
+		TranscationID:  ci.TransactionID,
+	}
+}
+
+func (e *Engine) inclusionCacheDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsInclusionCacheKey)
+}
+
+// GetInclusion returns the full inclusion record of c in Pando: whether it is included, the
+// snapshot it landed in and the transaction that stored it. A metadata not included is not an
+// error, its record has InPando unset. Unlike VerifyInclusion, the record is not checked against
+// the local metadata nor the snapshot, so the inclusion of any cid can be looked up.
+//
+// If the inclusion cache is enabled with WithInclusionCacheTTL, the inclusions already confirmed
+// are served from it until they expire, instead of querying Pando again.
+//
+// Only the inclusions in a snapshot are cached: the ones not in a snapshot yet change once the
+// snapshot is taken. See: InvalidateInclusion.
+func (e *Engine) GetInclusion(ctx context.Context, c cid.Cid) (*MetaInclusion, error) {
+	if ci := e.cachedInclusion(ctx, c); ci != nil {
+		return ci.inclusion(), nil
+	}
+	inclusion, err := e.pandoAPI.MetaInclusion(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	e.cacheInclusion(ctx, c, inclusion)
+	return inclusion, nil
+}
+
+// cachedInclusion returns the confirmed inclusion of c, nil if it is not cached or expired.
+func (e *Engine) cachedInclusion(ctx context.Context, c cid.Cid) *ConfirmedInclusion {
+	if e.inclusionCacheTTL <= 0 {
+		return nil
+	}
+	key := datastore.NewKey(c.String())
+	b, err := e.inclusionCacheDs().Get(ctx, key)
+	if err != nil {
+		if err != datastore.ErrNotFound {
+			logger.Warnw("Failed to read cached inclusion", "cid", c, "err", err)
+		}
+		return nil
+	}
+	var ci ConfirmedInclusion
+	if err = json.Unmarshal(b, &ci); err != nil {
+		logger.Warnw("Dropping invalid cached inclusion", "cid", c, "err", err)
+		_ = e.inclusionCacheDs().Delete(ctx, key)
+		return nil
+	}
+	if time.Since(ci.ConfirmedAt) > e.inclusionCacheTTL {
+		_ = e.inclusionCacheDs().Delete(ctx, key)
+		return nil
+	}
+	return &ci
+}
+
+// cacheInclusion records the inclusion of c if it is confirmed in a snapshot and the cache is
+// enabled. Failures are only logged, the inclusion is queried again next time.
+func (e *Engine) cacheInclusion(ctx context.Context, c cid.Cid, inclusion *MetaInclusion) {
+	if e.inclusionCacheTTL <= 0 || inclusion == nil || !inclusion.InPando || !inclusion.InSnapShot {
+		return
+	}
+	b, err := json.Marshal(&ConfirmedInclusion{
+		Cid:            c,
+		Provider:       inclusion.Provider,
+		SnapshotCid:    inclusion.SnapShotID,
+		SnapshotHeight: inclusion.SnapShotHeight,
+		Context:        inclusion.Context,
+		TransactionID:  inclusion.TranscationID,
+		ConfirmedAt:    time.Now(),
+	})
+	if err != nil {
+		logger.Warnw("Failed to encode inclusion", "cid", c, "err", err)
+		return
+	}
+	if err = e.inclusionCacheDs().Put(ctx, datastore.NewKey(c.String()), b); err != nil {
+		logger.Warnw("Failed to cache inclusion", "cid", c, "err", err)
+	}
+}
+
+// InvalidateInclusion drops the cached inclusion of c, so that the next GetInclusion queries
+// Pando, e.g. if Pando was restored from an older state.
+func (e *Engine) InvalidateInclusion(ctx context.Context, c cid.Cid) error {
+	return e.inclusionCacheDs().Delete(ctx, datastore.NewKey(c.String()))
+}
+
+// ClearInclusionCache drops all the cached inclusions and returns their number.
+func (e *Engine) ClearInclusionCache(ctx context.Context) (int, error) {
+	res, err := e.inclusionCacheDs().Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err = e.inclusionCacheDs().Delete(ctx, datastore.NewKey(entry.Key)); err != nil {
+			return 0, err
+		}
+	}
+	logger.Infow("Cleared inclusion cache", "count", len(entries))
+	return len(entries), nil
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+)
+
+// IntegrityReport lists the inconsistencies found in the local state of the chain.
+type IntegrityReport struct {
+	// MissingHead is set if the latest metadata does not resolve to a block.
+	MissingHead bool
+	// PushListMismatch is set if the last pushed cid is not the latest metadata.
+	PushListMismatch bool
+	// StrayChecks are the cids of the check list that were never pushed.
+	StrayChecks []cid.Cid
+	// Repaired is set if the inconsistencies were repaired.
+	Repaired bool
+}
+
+// OK tells whether no inconsistency was found.
+func (r *IntegrityReport) OK() bool {
+	return !r.MissingHead && !r.PushListMismatch && len(r.StrayChecks) == 0
+}
+
+// CheckIntegrity verifies that the latest metadata resolves to a block, that it is the last
+// pushed cid and that the check list only holds pushed cids. If repair is set, the
+// inconsistencies are fixed: the head falls back to the latest pushed cid that resolves, the
+// pushed cid list is rebuilt by walking the chain from the head and stray checks are dropped.
+//
+// Blocks are only checked if metadatas are persisted after being sent, since they are deleted
+// from the datastore once included in Pando otherwise.
+// See: WithPersistAfterSend, WithIntegrityRepair.
+func (e *Engine) CheckIntegrity(ctx context.Context, repair bool) (*IntegrityReport, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	return e.checkIntegrity(ctx, repair)
+}
+
+func (e *Engine) checkIntegrity(ctx context.Context, repair bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{}
+	head := e.getLatestMeta(ctx)
+
+	if head.Defined() && e.PersistAfterSend {
+		if _, err := e.loadMetadata(ctx, head); err != nil {
+			report.MissingHead = true
+			logger.Warnw("Latest metadata does not resolve to a block", "head", head, "err", err)
+		}
+	}
+	if n := len(e.pushList); (n == 0 && head.Defined()) || (n != 0 && !e.pushList[n-1].Equals(head)) {
+		report.PushListMismatch = true
+		logger.Warnw("Last pushed cid is not the latest metadata", "head", head, "pushed", n)
+	}
+	pushed := make(map[string]struct{}, len(e.pushList))
+	for _, c := range e.pushList {
+		pushed[c.String()] = struct{}{}
+	}
+	e.cr.checkMutex.Lock()
+	for cidStr := range e.cr.checkMap {
+		if _, ok := pushed[cidStr]; ok {
+			continue
+		}
+		if c, err := cid.Decode(cidStr); err == nil {
+			report.StrayChecks = append(report.StrayChecks, c)
+		}
+	}
+	e.cr.checkMutex.Unlock()
+	if len(report.StrayChecks) != 0 {
+		logger.Warnw("Check list holds cids that were never pushed", "count", len(report.StrayChecks))
+	}
+
+	if !repair || report.OK() {
+		return report, nil
+	}
+	if err := e.repair(ctx, report); err != nil {
+		return report, err
+	}
+	report.Repaired = true
+	logger.Infow("Repaired local chain state", "head", e.getLatestMeta(ctx), "pushed", len(e.pushList))
+	return report, nil
+}
+
+func (e *Engine) repair(ctx context.Context, report *IntegrityReport) error {
+	if len(report.StrayChecks) != 0 {
+		e.cr.checkMutex.Lock()
+		for _, c := range report.StrayChecks {
+			delete(e.cr.checkMap, c.String())
+		}
+		empty := len(e.cr.checkMap) == 0
+		e.cr.checkMutex.Unlock()
+		// persistCheckList keeps the persisted list if the check list is empty.
+		if empty {
+			if err := e.cr.ds.Delete(ctx, dsCheckCidListKey); err != nil {
+				return err
+			}
+		} else if err := e.cr.persistCheckList(ctx); err != nil {
+			return err
+		}
+		e.cr.updatePendingMetrics()
+	}
+
+	if report.MissingHead {
+		head := cid.Undef
+		for i := len(e.pushList) - 1; i >= 0; i-- {
+			if _, err := e.loadMetadata(ctx, e.pushList[i]); err == nil {
+				head = e.pushList[i]
+				break
+			}
+		}
+		if head.Defined() {
+			if err := e.updateLatestMeta(ctx, head); err != nil {
+				return err
+			}
+		} else {
+			e.setLatestMeta(ctx, cid.Undef)
+			if err := e.ds.Delete(ctx, dsLatestMetaKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	if report.MissingHead || report.PushListMismatch {
+		if !e.PersistAfterSend {
+			logger.Warnw("Pushed cid list can not be rebuilt, included metadatas are not persisted")
+			return nil
+		}
+		return e.rebuildPushList(ctx)
+	}
+	return nil
+}
+
+// ReindexFromChain regenerates the pushed cid list by walking the local chain from the latest
+// metadata to the first one following PreviousID, e.g. to recover from a corrupted datastore or
+// after importing metadatas manually. It fails if a metadata of the chain does not resolve, in
+// which case the pushed cid list is left unchanged.
+func (e *Engine) ReindexFromChain(ctx context.Context) ([]cid.Cid, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	if err := e.rebuildPushList(ctx); err != nil {
+		return nil, fmt.Errorf("failed to reindex chain: %w", err)
+	}
+	logger.Infow("Reindexed pushed cid list from chain", "head", e.getLatestMeta(ctx), "pushed", len(e.pushList))
+	list := make([]cid.Cid, len(e.pushList))
+	copy(list, e.pushList)
+	return list, nil
+}
+
+// rebuildPushList regenerates the pushed cid list by walking the chain from the head.
+func (e *Engine) rebuildPushList(ctx context.Context) error {
+	var list []cid.Cid
+	err := e.WalkChain(ctx, e.getLatestMeta(ctx), func(c cid.Cid, _ *schema.Metadata) error {
+		list = append(list, c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if len(list) == 0 {
+		e.pushList = list
+		return e.ds.Delete(ctx, dsPushedCidListKey)
+	}
+	return e.updatePushedList(ctx, list)
+}
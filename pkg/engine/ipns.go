@@ -0,0 +1,311 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"google.golang.org/protobuf/encoding/protowire"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultIPNSLifetime is the validity of the IPNS records published, they are published
+	// again every half of it.
+	defaultIPNSLifetime = 24 * time.Hour
+	// ipnsTTL is the time resolvers may cache the IPNS records for.
+	ipnsTTL = time.Minute
+	// ipnsPublishTimeout bounds the publishes of the IPNS records by the engine.
+	ipnsPublishTimeout = time.Minute
+)
+
+var dsIPNSSequenceKey = datastore.NewKey("sync/meta/ipnsSequence")
+
+// The fields of the IPNS record protobuf, see the IPNS record specification.
+const (
+	ipnsFieldValue        protowire.Number = 1
+	ipnsFieldSignatureV1  protowire.Number = 2
+	ipnsFieldValidityType protowire.Number = 3
+	ipnsFieldValidity     protowire.Number = 4
+	ipnsFieldSequence     protowire.Number = 5
+	ipnsFieldTTL          protowire.Number = 6
+	ipnsFieldPubKey       protowire.Number = 7
+	ipnsFieldSignatureV2  protowire.Number = 8
+	ipnsFieldData         protowire.Number = 9
+
+	// ipnsValidityEOL is the only validity type, the record is valid until its validity time.
+	ipnsValidityEOL = 0
+)
+
+// ipnsSignatureV2Prefix prefixes the data signed by the v2 signatures of the IPNS records.
+var ipnsSignatureV2Prefix = []byte("ipns-signature:")
+
+// ipnsRoutingKey returns the routing key of the IPNS name of id.
+func ipnsRoutingKey(id peer.ID) string {
+	return "/ipns/" + string(id)
+}
+
+// IPNSName returns the IPNS name the latest metadata is published under with
+// WithIPNSPublishing, i.e. /ipns/<peer id>.
+func (e *Engine) IPNSName() string {
+	return "/ipns/" + e.h.ID().String()
+}
+
+// PublishIPNS publishes the latest metadata under the IPNS name of the engine, signed with the
+// key of the host, to the value store set with WithIPNSPublishing, e.g. the DHT. The engine
+// publishes it after every head update and before the previous record expires, so it only needs
+// to be called to publish it right away.
+func (e *Engine) PublishIPNS(ctx context.Context) error {
+	if e.ipnsRouting == nil {
+		return ErrIPNSDisabled
+	}
+	head := e.getLatestMeta(ctx)
+	if head == cid.Undef {
+		return ErrNoPublishedMetadata
+	}
+	e.ipnsMutex.Lock()
+	defer e.ipnsMutex.Unlock()
+
+	seq, err := e.nextIPNSSequence(ctx)
+	if err != nil {
+		return err
+	}
+	record, err := newIPNSRecord(e.key, []byte("/ipfs/"+head.String()), seq, time.Now().Add(e.ipnsLifetime), ipnsTTL)
+	if err != nil {
+		return fmt.Errorf("failed to create IPNS record: %w", err)
+	}
+	if err = e.ipnsRouting.PutValue(ctx, ipnsRoutingKey(e.h.ID()), record); err != nil {
+		return fmt.Errorf("failed to publish IPNS record: %w", err)
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+	if err = e.ds.Put(ctx, dsIPNSSequenceKey, b); err != nil {
+		return err
+	}
+	logger.Infow("Published latest metadata to IPNS", "name", e.IPNSName(), "head", head, "sequence", seq)
+	return nil
+}
+
+// nextIPNSSequence returns the sequence of the next IPNS record, which must be higher than the
+// one of the records published before for resolvers to prefer it.
+func (e *Engine) nextIPNSSequence(ctx context.Context) (uint64, error) {
+	b, err := e.ds.Get(ctx, dsIPNSSequenceKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid IPNS sequence")
+	}
+	return binary.BigEndian.Uint64(b) + 1, nil
+}
+
+// ResolveIPNS resolves the IPNS name of the provider id from the value store set with
+// WithIPNSPublishing and returns the head of its chain, without going through Pando. The record
+// must be validly signed by id and not expired, otherwise ErrInvalidIPNSRecord is returned.
+func (e *Engine) ResolveIPNS(ctx context.Context, id peer.ID) (cid.Cid, error) {
+	if e.ipnsRouting == nil {
+		return cid.Undef, ErrIPNSDisabled
+	}
+	record, err := e.ipnsRouting.GetValue(ctx, ipnsRoutingKey(id))
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to resolve IPNS name of %s: %w", id, err)
+	}
+	value, err := openIPNSRecord(record, id, time.Now())
+	if err != nil {
+		return cid.Undef, fmt.Errorf("%w: %v", ErrInvalidIPNSRecord, err)
+	}
+	head, err := cid.Decode(strings.TrimPrefix(string(value), "/ipfs/"))
+	if err != nil {
+		return cid.Undef, fmt.Errorf("%w: invalid value %q: %v", ErrInvalidIPNSRecord, value, err)
+	}
+	return head, nil
+}
+
+// followIPNS publishes the latest metadata to IPNS on every head update and every half of the
+// record lifetime, until the engine is shut down. The publish in progress is cancelled by the
+// shutdown.
+func (e *Engine) followIPNS() {
+	defer close(e.ipnsDone)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-e.closing
+		cancel()
+	}()
+	ticker := time.NewTicker(e.ipnsLifetime / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.closing:
+			return
+		case <-ticker.C:
+		case <-e.ipnsCh:
+		}
+		pctx, pcancel := context.WithTimeout(ctx, ipnsPublishTimeout)
+		err := e.PublishIPNS(pctx)
+		pcancel()
+		if err != nil && !errors.Is(err, ErrNoPublishedMetadata) {
+			logger.Warnw("Failed to publish latest metadata to IPNS", "err", err)
+		}
+	}
+}
+
+func (e *Engine) triggerIPNS() {
+	select {
+	case e.ipnsCh <- struct{}{}:
+	default:
+	}
+}
+
+// newIPNSRecord returns the protobuf of an IPNS record of value signed with key, with both the
+// v1 and the v2 signatures.
+func newIPNSRecord(key crypto.PrivKey, value []byte, seq uint64, eol time.Time, ttl time.Duration) ([]byte, error) {
+	validity := []byte(eol.UTC().Format(time.RFC3339Nano))
+	// the entries are in the canonical dag-cbor order, by length then bytes.
+	data, err := qp.BuildMap(basicnode.Prototype.Map, 5, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "TTL", qp.Int(int64(ttl)))
+		qp.MapEntry(ma, "Value", qp.Bytes(value))
+		qp.MapEntry(ma, "Sequence", qp.Int(int64(seq)))
+		qp.MapEntry(ma, "Validity", qp.Bytes(validity))
+		qp.MapEntry(ma, "ValidityType", qp.Int(ipnsValidityEOL))
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = dagcbor.Encode(data, buf); err != nil {
+		return nil, err
+	}
+	cborData := buf.Bytes()
+	sigV1, err := key.Sign(bytes.Join([][]byte{value, validity, []byte("EOL")}, nil))
+	if err != nil {
+		return nil, err
+	}
+	sigV2, err := key.Sign(append(append([]byte{}, ipnsSignatureV2Prefix...), cborData...))
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = appendIPNSBytes(b, ipnsFieldValue, value)
+	b = appendIPNSBytes(b, ipnsFieldSignatureV1, sigV1)
+	b = protowire.AppendTag(b, ipnsFieldValidityType, protowire.VarintType)
+	b = protowire.AppendVarint(b, ipnsValidityEOL)
+	b = appendIPNSBytes(b, ipnsFieldValidity, validity)
+	b = protowire.AppendTag(b, ipnsFieldSequence, protowire.VarintType)
+	b = protowire.AppendVarint(b, seq)
+	b = protowire.AppendTag(b, ipnsFieldTTL, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(ttl))
+	// keys that can not be extracted from the peer id, e.g. RSA ones, are embedded.
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = id.ExtractPublicKey(); err != nil {
+		pubKey, err := crypto.MarshalPublicKey(key.GetPublic())
+		if err != nil {
+			return nil, err
+		}
+		b = appendIPNSBytes(b, ipnsFieldPubKey, pubKey)
+	}
+	b = appendIPNSBytes(b, ipnsFieldSignatureV2, sigV2)
+	b = appendIPNSBytes(b, ipnsFieldData, cborData)
+	return b, nil
+}
+
+func appendIPNSBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// openIPNSRecord verifies the v2 signature of the IPNS record b of id and its validity at now,
+// and returns its value.
+func openIPNSRecord(b []byte, id peer.ID, now time.Time) ([]byte, error) {
+	fields := make(map[protowire.Number][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			fields[num] = v
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	pubKey, err := id.ExtractPublicKey()
+	if err != nil {
+		if pubKey, err = crypto.UnmarshalPublicKey(fields[ipnsFieldPubKey]); err != nil {
+			return nil, fmt.Errorf("missing public key: %v", err)
+		}
+		if !id.MatchesPublicKey(pubKey) {
+			return nil, fmt.Errorf("public key does not match %s", id)
+		}
+	}
+	data := fields[ipnsFieldData]
+	ok, err := pubKey.Verify(append(append([]byte{}, ipnsSignatureV2Prefix...), data...), fields[ipnsFieldSignatureV2])
+	if err != nil || !ok {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	nb := basicnode.Prototype.Map.NewBuilder()
+	if err = dagcbor.Decode(nb, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+	n := nb.Build()
+	value, err := lookupIPNSBytes(n, "Value")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(value, fields[ipnsFieldValue]) {
+		return nil, fmt.Errorf("value does not match the signed one")
+	}
+	validity, err := lookupIPNSBytes(n, "Validity")
+	if err != nil {
+		return nil, err
+	}
+	eol, err := time.Parse(time.RFC3339Nano, string(validity))
+	if err != nil {
+		return nil, fmt.Errorf("invalid validity: %v", err)
+	}
+	if now.After(eol) {
+		return nil, fmt.Errorf("record expired at %s", eol)
+	}
+	return value, nil
+}
+
+func lookupIPNSBytes(n datamodel.Node, key string) ([]byte, error) {
+	v, err := n.LookupByString(key)
+	if err != nil {
+		return nil, fmt.Errorf("missing %s: %v", key, err)
+	}
+	b, err := v.AsBytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return b, nil
+}
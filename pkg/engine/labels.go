@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var dsLabelIndexKey = datastore.NewKey("sync/meta/labels")
+
+// labelTimeLayout has a fixed width, so that the publish times of the index sort as strings.
+const labelTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// parseLabel splits label into its key and value.
+func parseLabel(label string) (string, string, error) {
+	i := strings.Index(label, "=")
+	if i <= 0 || i == len(label)-1 {
+		return "", "", fmt.Errorf("%w: %q is not in the key=value form", ErrInvalidLabel, label)
+	}
+	return label[:i], label[i+1:], nil
+}
+
+// validateLabels checks that the labels of opts are in the key=value form.
+func validateLabels(opts *publishOptions) error {
+	for _, l := range opts.labels {
+		if _, _, err := parseLabel(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func labelPrefix(key, value string) datastore.Key {
+	k := datastore.NewKey(url.PathEscape(key))
+	if value != "" {
+		k = k.ChildString(url.PathEscape(value))
+	}
+	return k
+}
+
+// indexLabels indexes c under the labels of opts, with the time of the publish so that the
+// lookups return the publishes in order. Index failures are only logged, so that they do not
+// fail publishes.
+func (e *Engine) indexLabels(ctx context.Context, c cid.Cid, opts *publishOptions) {
+	if len(opts.labels) == 0 {
+		return
+	}
+	ds := namespace.Wrap(e.ds, dsLabelIndexKey)
+	at := []byte(time.Now().UTC().Format(labelTimeLayout))
+	for _, l := range opts.labels {
+		key, value, err := parseLabel(l)
+		if err != nil {
+			continue
+		}
+		if err = ds.Put(ctx, labelPrefix(key, value).ChildString(c.String()), at); err != nil {
+			logger.Warnw("Failed to index label", "cid", c, "label", l, "err", err)
+		}
+	}
+}
+
+// unindexLabels removes the metadatas cids from the label index, e.g. rolled back. The labels they
+// were published with are not known, the whole index is scanned.
+func (e *Engine) unindexLabels(ctx context.Context, cids map[cid.Cid]struct{}) error {
+	ds := namespace.Wrap(e.ds, dsLabelIndexKey)
+	results, err := ds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	var keys []datastore.Key
+	for r := range results.Next() {
+		if r.Error != nil {
+			_ = results.Close()
+			return r.Error
+		}
+		k := datastore.RawKey(r.Key)
+		c, err := cid.Decode(k.BaseNamespace())
+		if err != nil {
+			continue
+		}
+		if _, ok := cids[c]; ok {
+			keys = append(keys, k)
+		}
+	}
+	if err = results.Close(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = ds.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindByLabel returns the metadatas published with the label key=value, or with any value of
+// key if value is empty, in the order they were published. Metadatas published to named chains
+// are included.
+// See: WithLabels.
+func (e *Engine) FindByLabel(ctx context.Context, key, value string) ([]cid.Cid, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: key can not be empty", ErrInvalidLabel)
+	}
+	ds := namespace.Wrap(e.ds, dsLabelIndexKey)
+	results, err := ds.Query(ctx, query.Query{Prefix: labelPrefix(key, value).String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	type match struct {
+		c  cid.Cid
+		at string
+	}
+	var matches []match
+	seen := make(map[cid.Cid]int)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := cid.Decode(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			logger.Warnw("Invalid label index entry", "key", r.Key, "err", err)
+			continue
+		}
+		at := string(r.Value)
+		// a metadata may match several values of key, keep its latest publish.
+		if i, ok := seen[c]; ok {
+			if at > matches[i].at {
+				matches[i].at = at
+			}
+			continue
+		}
+		seen[c] = len(matches)
+		matches = append(matches, match{c: c, at: at})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].at < matches[j].at })
+
+	cids := make([]cid.Cid, len(matches))
+	for i, m := range matches {
+		cids[i] = m.c
+	}
+	return cids, nil
+}
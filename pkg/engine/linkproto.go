@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/ipfs/go-cid"
+	// registers the dag-cbor codec of LinkCodecDagCbor.
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// LinkHashSha2_256 hashes blocks with sha2-256, truncated to 16 bytes like schema.LinkProto.
+	LinkHashSha2_256 LinkHash = "sha2-256"
+	// LinkHashSha2_512 hashes blocks with full-length sha2-512.
+	LinkHashSha2_512 LinkHash = "sha2-512"
+	// LinkHashBlake3 hashes blocks with full-length blake3.
+	LinkHashBlake3 LinkHash = "blake3"
+
+	// LinkCodecDagJson encodes blocks as dag-json, like schema.LinkProto.
+	LinkCodecDagJson LinkCodec = "dag-json"
+	// LinkCodecDagCbor encodes blocks as dag-cbor.
+	LinkCodecDagCbor LinkCodec = "dag-cbor"
+)
+
+type (
+	// LinkHash is the multihash function of the links of the metadatas stored by the engine.
+	LinkHash string
+
+	// LinkCodec is the codec of the metadatas stored by the engine.
+	LinkCodec string
+)
+
+// newLinkPrototype returns the link prototype of hash and codec, schema.LinkProto if both are
+// empty or the defaults.
+func newLinkPrototype(hash LinkHash, codec LinkCodec) (cidlink.LinkPrototype, error) {
+	lp := schema.LinkProto
+	switch hash {
+	case "", LinkHashSha2_256:
+	case LinkHashSha2_512:
+		lp.MhType, lp.MhLength = multihash.SHA2_512, -1
+	case LinkHashBlake3:
+		lp.MhType, lp.MhLength = multihash.BLAKE3, -1
+	default:
+		return lp, fmt.Errorf("unsupported link hash: %s", hash)
+	}
+	switch codec {
+	case "", LinkCodecDagJson:
+	case LinkCodecDagCbor:
+		lp.Codec = cid.DagCBOR
+	default:
+		return lp, fmt.Errorf("unsupported link codec: %s", codec)
+	}
+	return lp, nil
+}
+
+// LinkPrototypeWithCodec returns the link prototype of the engine with codec instead of the
+// configured one, to publish a metadata with another codec through WithLinkPrototype.
+func (e *Engine) LinkPrototypeWithCodec(codec LinkCodec) (cidlink.LinkPrototype, error) {
+	return newLinkPrototype(e.linkHash, codec)
+}
@@ -6,13 +6,25 @@ import (
 
 	//provider "github.com/filecoin-project/index-provider"
 	//"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipld/go-ipld-prime"
-	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 )
 
+// BlockHook is called with every block stored or loaded through the engine link system. data must
+// not be modified nor retained after the hook returns.
+// See: WithBlockHook.
+type BlockHook func(c cid.Cid, data []byte)
+
+func (e *Engine) callBlockHooks(c cid.Cid, data []byte) {
+	for _, hook := range e.blockHooks {
+		hook(c, data)
+	}
+}
+
 // Creates the main engine linksystem.
 func (e *Engine) mkLinkSystem() *ipld.LinkSystem {
 	lsys := cidlink.DefaultLinkSystem()
@@ -22,46 +34,62 @@ func (e *Engine) mkLinkSystem() *ipld.LinkSystem {
 		c := lnk.(cidlink.Link).Cid
 		logger.Debugf("Triggered ReadOpener from engine's linksystem with cid (%s)", c)
 
-		// Get the node from main datastore. If it is in the
-		// main datastore it means it is an advertisement.
-		val, err := e.ds.Get(ctx, datastore.NewKey(c.String()))
+		// Get the node from the blockstore. If it is in the
+		// blockstore it means it is an advertisement.
+		val, err := e.bs.Get(ctx, c)
 		if err != nil {
 			if err == datastore.ErrNotFound {
 				return nil, err
 			}
-			logger.Errorf("Error getting object from datastore in linksystem: %s", err)
+			logger.Errorf("Error getting object from blockstore in linksystem: %s", err)
 			return nil, err
 		}
 
 		// If data was retrieved from the datastore, this may be a metadata.
 		if len(val) != 0 {
 			// Decode the node to check its type to see if it is a metadata.
-			n, err := decodeIPLDNode(bytes.NewBuffer(val))
+			n, err := decodeIPLDNode(c.Prefix().Codec, bytes.NewBuffer(val))
 			if err != nil {
 				logger.Errorf("Could not decode IPLD node for potential advertisement: %s", err)
 				return nil, err
 			}
 			// If this was an advertisement, then return it.
 			if isMetadata(n) {
-				logger.Debugw("Retrieved metadata from datastore", "cid", c, "size", len(val))
+				logger.Debugw("Retrieved metadata from blockstore", "cid", c, "size", len(val))
+				e.callBlockHooks(c, val)
 				return bytes.NewBuffer(val), nil
 			}
-			logger.Debugw("Retrieved non-metadata object from datastore", "cid", c, "size", len(val))
+			logger.Debugw("Retrieved non-metadata object from blockstore", "cid", c, "size", len(val))
 		}
 
+		e.callBlockHooks(c, val)
 		return bytes.NewBuffer(val), nil
 	}
 	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
 		buf := bytes.NewBuffer(nil)
 		return buf, func(lnk ipld.Link) error {
+			if err := e.checkSyncWrite(lctx); err != nil {
+				return err
+			}
 			c := lnk.(cidlink.Link).Cid
-			return e.ds.Put(lctx.Ctx, datastore.NewKey(c.String()), buf.Bytes())
+			// blocks are content addressed, an existing one is the same block.
+			if exist, err := e.bs.Has(lctx.Ctx, c); err == nil && exist {
+				e.recordDedupHit(buf.Len())
+				e.callBlockHooks(c, buf.Bytes())
+				return nil
+			}
+			e.recordBlockStored(buf.Len())
+			if err := e.bs.Put(lctx.Ctx, c, buf.Bytes()); err != nil {
+				return err
+			}
+			e.callBlockHooks(c, buf.Bytes())
+			return nil
 		}, nil
 	}
 	return &lsys
 }
 
-// vanillaLinkSystem plainly loads and stores from engine datastore.
+// vanillaLinkSystem plainly loads and stores from engine blockstore.
 //
 // This is used to plainly load and store links without the complex
 // logic of the main linksystem. This is mainly used to retrieve
@@ -70,7 +98,7 @@ func (e *Engine) vanillaLinkSystem() ipld.LinkSystem {
 	lsys := cidlink.DefaultLinkSystem()
 	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
 		c := lnk.(cidlink.Link).Cid
-		val, err := e.ds.Get(lctx.Ctx, datastore.NewKey(c.String()))
+		val, err := e.bs.Get(lctx.Ctx, c)
 		if err != nil {
 			return nil, err
 		}
@@ -80,16 +108,20 @@ func (e *Engine) vanillaLinkSystem() ipld.LinkSystem {
 		buf := bytes.NewBuffer(nil)
 		return buf, func(lnk ipld.Link) error {
 			c := lnk.(cidlink.Link).Cid
-			return e.ds.Put(lctx.Ctx, datastore.NewKey(c.String()), buf.Bytes())
+			return e.bs.Put(lctx.Ctx, c, buf.Bytes())
 		}, nil
 	}
 	return lsys
 }
 
-// decodeIPLDNode reads the content of the given reader fully as an IPLD node.
-func decodeIPLDNode(r io.Reader) (ipld.Node, error) {
+// decodeIPLDNode reads the content of the given reader fully as an IPLD node encoded with codec.
+func decodeIPLDNode(codec uint64, r io.Reader) (ipld.Node, error) {
+	decode, err := multicodec.LookupDecoder(codec)
+	if err != nil {
+		return nil, err
+	}
 	nb := basicnode.Prototype.Any.NewBuilder()
-	err := dagjson.Decode(nb, r)
+	err = decode(nb, r)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"context"
+	"github.com/ipfs/go-cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+)
+
+type (
+	// PublishFunc publishes metadata with the per-call options o, like Engine.Publish.
+	PublishFunc func(ctx context.Context, metadata schema.Metadata, o ...PublishOption) (cid.Cid, error)
+
+	// PublishMiddleware wraps every publish of the engine: the returned PublishFunc is called
+	// instead of next, and may change the metadata or the options before calling next, inspect
+	// the result after, or return an error instead of calling next to reject the publish.
+	// See: WithPublishMiddleware.
+	PublishMiddleware func(next PublishFunc) PublishFunc
+)
+
+// wrapPublish wraps publish with the middlewares, the first one set being the outermost.
+func (e *Engine) wrapPublish(publish PublishFunc) PublishFunc {
+	for i := len(e.publishMiddlewares) - 1; i >= 0; i-- {
+		publish = e.publishMiddlewares[i](publish)
+	}
+	return publish
+}
+
+// SignMetadata signs meta with the key of the engine and sets it as its provider, e.g. for
+// middlewares that change the metadata after it is built and signed by the publish variants.
+func (e *Engine) SignMetadata(meta *schema.Metadata) error {
+	meta.Provider = e.h.ID().String()
+	sig, err := schema.SignWithPrivky(e.key, meta)
+	if err != nil {
+		return err
+	}
+	meta.Signature = sig
+	return nil
+}
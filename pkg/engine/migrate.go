@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	sc "pandoClient/pkg/schema"
+)
+
+var dsTopicKey = datastore.NewKey("sync/meta/topic")
+
+// MigrateTopic moves the announcements of the chain to newTopic.
+//
+// A final pointer metadata referencing newTopic and the current head is published and announced
+// on the old topic, queued if it fails, so that consumers still following it learn where the
+// chain went. Afterwards all announcements are made on newTopic, also after a restart. The
+// published chain itself is unchanged: the httpsync publisher keeps serving all existing cids,
+// and the old topic keeps answering head queries until the engine is restarted, only newTopic
+// is joined from then on.
+func (e *Engine) MigrateTopic(ctx context.Context, newTopic string) (cid.Cid, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+
+	if e.publisher == nil {
+		return cid.Undef, fmt.Errorf("%w, no topic to migrate", ErrPublisherDisabled)
+	}
+	if newTopic == "" || newTopic == e.pubTopicName {
+		return cid.Undef, fmt.Errorf("invalid topic to migrate to: %q", newTopic)
+	}
+
+	headCid := e.getLatestMeta(ctx)
+	var prevLink datamodel.Link
+	if headCid.Defined() {
+		prevLink = cidlink.Link{Cid: headCid}
+	}
+	pointer, err := topicPointerNode(newTopic, prevLink)
+	if err != nil {
+		return cid.Undef, err
+	}
+	meta, err := sc.NewMetaWithPayloadNode(pointer, e.h.ID(), e.key, prevLink)
+	if err != nil {
+		return cid.Undef, err
+	}
+	c, err := e.publishLocal(ctx, *meta, newPublishOptions())
+	if err != nil {
+		return cid.Undef, err
+	}
+	log := logger.With("metaCid", c, "oldTopic", e.pubTopicName, "newTopic", newTopic)
+
+	// the pointer is the last announcement made on the old topic, queued if it fails as the
+	// pointer is the head already.
+	qa := queuedAnnounce{Cid: c, ExtraData: e.extraGossipData(nil), Topic: e.pubTopicName}
+	if err = e.announceOrEnqueue(ctx, qa); err != nil {
+		log.Errorw("Failed to queue topic pointer announcement on old topic", "err", err)
+		return cid.Undef, err
+	}
+
+	if e.pubKind.gossips() {
+		gt, err := e.joinGossipTopic(newTopic)
+		if err != nil {
+			log.Errorw("Failed to join new topic", "err", err)
+			return cid.Undef, err
+		}
+		if e.migratedTopic != nil {
+			// only the original topic is kept answering, intermediate ones are dropped.
+			if err := e.migratedTopic.close(); err != nil {
+				log.Warnw("Failed to close previously migrated topic", "topic", e.migratedTopic.name, "err", err)
+			}
+		}
+		e.migratedTopic = gt
+		if err = e.setRoot(ctx, c); err != nil {
+			return cid.Undef, err
+		}
+	}
+
+	e.pubTopicName = newTopic
+	if err = e.ds.Put(ctx, dsTopicKey, []byte(newTopic)); err != nil {
+		log.Errorw("Failed to persist migrated topic", "err", err)
+		return cid.Undef, err
+	}
+	log.Info("Migrated announcement topic")
+
+	return c, nil
+}
+
+// loadMigratedTopic returns the topic persisted by a previous MigrateTopic, if any.
+func (e *Engine) loadMigratedTopic(ctx context.Context) (string, error) {
+	b, err := e.ds.Get(ctx, dsTopicKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(b), nil
+}
+
+// topicPointerNode builds the payload of the metadata pointing consumers to the new topic.
+func topicPointerNode(newTopic string, headLink ipld.Link) (datamodel.Node, error) {
+	return qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "MigrateTopic", qp.String(newTopic))
+		if headLink != nil {
+			qp.MapEntry(ma, "Head", qp.Link(headLink))
+		}
+	})
+}
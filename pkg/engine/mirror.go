@@ -0,0 +1,271 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/filecoin-project/go-legs"
+	"github.com/filecoin-project/go-legs/httpsync"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"sync"
+	"time"
+)
+
+const defaultMirrorSyncInterval = time.Minute
+
+var dsMirrorsKey = datastore.NewKey("sync/mirrors")
+
+// MirrorSpec describes the chain of a provider mirrored locally.
+type MirrorSpec struct {
+	// Provider is the peer ID of the mirrored provider.
+	Provider string
+	// Addr is the multiaddr the chain of the provider is synced from, empty if it is already
+	// known by the host.
+	Addr string
+	// ServeAddr is the listen address the mirrored chain is re-served on over httpsync, empty
+	// to only replicate it.
+	ServeAddr string
+}
+
+// MirrorStatus is the state of a running mirror.
+type MirrorStatus struct {
+	MirrorSpec
+	// Head is the latest mirrored metadata, cid.Undef if nothing is mirrored yet.
+	Head cid.Cid
+}
+
+// Mirror continuously replicates the full metadata chain of a provider, payloads included, into
+// the local datastore.
+type Mirror struct {
+	e        *Engine
+	spec     MirrorSpec
+	provider peer.ID
+	addr     multiaddr.Multiaddr
+	// pub re-serves the mirrored chain, nil if it is not re-served.
+	pub     legs.Publisher
+	head    cid.Cid
+	mutex   sync.RWMutex
+	closing chan struct{}
+	done    chan struct{}
+}
+
+func (e *Engine) mirrorsDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsMirrorsKey)
+}
+
+// StartMirror starts mirroring the chain of spec.Provider: the chain is synced right away, then on
+// every announcement of the provider on the subscriber topic and every mirror sync interval.
+// The mirror is persisted and resumed by Start until StopMirror is called.
+//
+// If spec.ServeAddr is set, the mirrored chain is re-served over httpsync. The head served is
+// signed by the host of the engine, so consumers must sync it with the peer ID of the mirror;
+// the mirrored metadatas keep the signatures of the provider.
+func (e *Engine) StartMirror(ctx context.Context, spec MirrorSpec) (*Mirror, error) {
+	if e.follower == nil {
+		return nil, ErrNotStarted
+	}
+	m, err := e.startMirror(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(spec)
+	if err == nil {
+		err = e.mirrorsDs().Put(ctx, datastore.NewKey(m.provider.String()), b)
+	}
+	if err != nil {
+		e.removeMirror(m.provider)
+		m.close()
+		return nil, fmt.Errorf("failed to persist mirror: %w", err)
+	}
+	return m, nil
+}
+
+func (e *Engine) startMirror(ctx context.Context, spec MirrorSpec) (*Mirror, error) {
+	provider, err := peer.Decode(spec.Provider)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirrored provider: %w", err)
+	}
+	if provider == e.h.ID() {
+		return nil, fmt.Errorf("can not mirror the chain of the engine itself")
+	}
+	m := &Mirror{
+		e:        e,
+		spec:     spec,
+		provider: provider,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if spec.Addr != "" {
+		if m.addr, err = multiaddr.NewMultiaddr(spec.Addr); err != nil {
+			return nil, fmt.Errorf("invalid address of mirrored provider: %w", err)
+		}
+	}
+
+	e.mirrorMutex.Lock()
+	defer e.mirrorMutex.Unlock()
+	if _, ok := e.mirrors[provider]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyMirrored, provider)
+	}
+
+	if spec.ServeAddr != "" {
+		m.pub, err = httpsync.NewPublisher(spec.ServeAddr, *e.lsys, e.h.ID(), e.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-serve mirrored chain: %w", err)
+		}
+	}
+	if head, ok := e.follower.LatestSync(provider); ok {
+		m.setHead(ctx, head)
+	}
+
+	e.follower.Follow(provider, m.handle)
+	e.mirrors[provider] = m
+	go m.run()
+	logger.Infow("Mirroring provider", "provider", provider, "serveAddr", spec.ServeAddr)
+	return m, nil
+}
+
+// StopMirror stops mirroring the chain of provider and no longer resumes it. The mirrored
+// metadatas are kept in the datastore.
+func (e *Engine) StopMirror(ctx context.Context, provider peer.ID) error {
+	m := e.removeMirror(provider)
+	if m == nil {
+		return fmt.Errorf("%w: %s", ErrNotMirrored, provider)
+	}
+	err := m.close()
+	if dsErr := e.mirrorsDs().Delete(ctx, datastore.NewKey(provider.String())); dsErr != nil {
+		return dsErr
+	}
+	return err
+}
+
+// Mirrors returns the status of the running mirrors.
+func (e *Engine) Mirrors() []MirrorStatus {
+	e.mirrorMutex.Lock()
+	defer e.mirrorMutex.Unlock()
+	statuses := make([]MirrorStatus, 0, len(e.mirrors))
+	for _, m := range e.mirrors {
+		statuses = append(statuses, MirrorStatus{MirrorSpec: m.spec, Head: m.Head()})
+	}
+	return statuses
+}
+
+func (e *Engine) removeMirror(provider peer.ID) *Mirror {
+	e.mirrorMutex.Lock()
+	defer e.mirrorMutex.Unlock()
+	m, ok := e.mirrors[provider]
+	if !ok {
+		return nil
+	}
+	delete(e.mirrors, provider)
+	e.follower.Unfollow(provider)
+	return m
+}
+
+// resumeMirrors restarts the mirrors persisted by StartMirror.
+func (e *Engine) resumeMirrors(ctx context.Context) error {
+	res, err := e.mirrorsDs().Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var spec MirrorSpec
+		if err = json.Unmarshal(r.Value, &spec); err != nil {
+			return err
+		}
+		if _, err = e.startMirror(ctx, spec); err != nil {
+			logger.Errorw("Failed to resume mirror", "provider", spec.Provider, "err", err)
+		}
+	}
+	return nil
+}
+
+// closeMirrors stops the running mirrors on shutdown, they are resumed on the next Start.
+func (e *Engine) closeMirrors() error {
+	var errs error
+	e.mirrorMutex.Lock()
+	mirrors := e.mirrors
+	e.mirrors = make(map[peer.ID]*Mirror)
+	e.mirrorMutex.Unlock()
+	for _, m := range mirrors {
+		if err := m.close(); err != nil {
+			errs = err
+		}
+	}
+	return errs
+}
+
+// Head returns the latest mirrored metadata, cid.Undef if nothing is mirrored yet.
+func (m *Mirror) Head() cid.Cid {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.head
+}
+
+// Address returns the multiaddr the mirrored chain is re-served on, nil if it is not re-served.
+func (m *Mirror) Address() multiaddr.Multiaddr {
+	if pub, ok := m.pub.(interface{ Address() multiaddr.Multiaddr }); ok {
+		return pub.Address()
+	}
+	return nil
+}
+
+// handle is called oldest first, so that the head ends up at the latest synced metadata.
+func (m *Mirror) handle(_ peer.ID, c cid.Cid, _ *schema.Metadata) {
+	m.setHead(context.Background(), c)
+}
+
+func (m *Mirror) setHead(ctx context.Context, c cid.Cid) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.head = c
+	if m.pub != nil {
+		if err := m.pub.SetRoot(ctx, c); err != nil {
+			logger.Errorw("Failed to update root of mirrored chain", "provider", m.provider, "err", err)
+		}
+	}
+}
+
+func (m *Mirror) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.e.mirrorInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-m.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		_, err := m.e.follower.SyncProvider(ctx, m.provider, m.addr)
+		cancel()
+		if err != nil {
+			logger.Warnw("Failed to sync mirrored provider", "provider", m.provider, "err", err)
+		}
+		select {
+		case <-m.closing:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Mirror) close() error {
+	close(m.closing)
+	<-m.done
+	if m.pub != nil {
+		return m.pub.Close()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"context"
+	"github.com/filecoin-project/go-legs"
+	"github.com/hashicorp/go-multierror"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// multiPublisher fans the root updates out to several legs publishers, so that the same chain
+// is served over each of their transports.
+type multiPublisher []legs.Publisher
+
+var _ legs.Publisher = (multiPublisher)(nil)
+
+func (mp multiPublisher) SetRoot(ctx context.Context, c cid.Cid) error {
+	for _, p := range mp {
+		if err := p.SetRoot(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mp multiPublisher) UpdateRoot(ctx context.Context, c cid.Cid) error {
+	for _, p := range mp {
+		if err := p.UpdateRoot(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mp multiPublisher) UpdateRootWithAddrs(ctx context.Context, c cid.Cid, addrs []multiaddr.Multiaddr) error {
+	for _, p := range mp {
+		if err := p.UpdateRootWithAddrs(ctx, c, addrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mp multiPublisher) Close() error {
+	var errs error
+	for _, p := range mp {
+		if err := p.Close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Reachability overrides the reachability of the host detected by AutoNAT.
+// See: WithReachability.
+type Reachability string
+
+const (
+	// ReachabilityAuto lets AutoNAT detect whether the host is reachable.
+	ReachabilityAuto Reachability = ""
+	// ReachabilityPublic assumes the host is reachable, e.g. to run the relay service without
+	// waiting for AutoNAT.
+	ReachabilityPublic Reachability = "public"
+	// ReachabilityPrivate assumes the host is behind a NAT, so that it reserves slots on its
+	// static relays right away.
+	ReachabilityPrivate Reachability = "private"
+)
+
+// ParseRelayAddrs parses the addresses of circuit relays, each with their /p2p/ peer ID
+// component, e.g. to use them as static relays of a host not managed by the engine. The
+// addresses of the same relay are merged.
+func ParseRelayAddrs(addrs ...string) ([]peer.AddrInfo, error) {
+	maddrs := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		m, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relay address %s: %w", addr, err)
+		}
+		maddrs = append(maddrs, m)
+	}
+	relays, err := peer.AddrInfosFromP2pAddrs(maddrs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay address: %w", err)
+	}
+	return relays, nil
+}
+
+// HostOptions returns the libp2p options of the host the engine creates with the listen and NAT
+// traversal options o, e.g. to create the host with more options and set it with WithHost.
+func HostOptions(o ...Option) ([]libp2p.Option, error) {
+	opts := &options{}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts.hostOptions(), nil
+}
+
+// hostOptions returns the libp2p options of the host created by the engine.
+func (o *options) hostOptions() []libp2p.Option {
+	var opts []libp2p.Option
+	if len(o.listenAddrs) != 0 {
+		opts = append(opts, libp2p.ListenAddrs(o.listenAddrs...))
+	}
+	if o.natPortMap {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+	if o.autoNATService {
+		opts = append(opts, libp2p.EnableNATService())
+	}
+	switch o.reachability {
+	case ReachabilityPublic:
+		opts = append(opts, libp2p.ForceReachabilityPublic())
+	case ReachabilityPrivate:
+		opts = append(opts, libp2p.ForceReachabilityPrivate())
+	}
+	if o.holePunching {
+		opts = append(opts, libp2p.EnableHolePunching())
+	}
+	if o.relayService {
+		opts = append(opts, libp2p.EnableRelayService())
+	}
+	if len(o.staticRelays) != 0 {
+		opts = append(opts, libp2p.EnableAutoRelay(autorelay.WithStaticRelays(o.staticRelays)))
+	}
+	return opts
+}
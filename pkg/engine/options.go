@@ -4,10 +4,19 @@ import (
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/schema"
 	"github.com/libp2p/go-libp2p"
+	"net/url"
 	"pandoClient/cmd/server/command/config"
+	"pandoClient/pkg/alert"
+	"pandoClient/pkg/clock"
+	"pandoClient/pkg/headexport"
+	"pandoClient/pkg/pandoapi"
+	"pandoClient/pkg/retry"
 	"time"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -16,6 +25,8 @@ import (
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/multiformats/go-multiaddr"
 )
 
 const (
@@ -30,12 +41,17 @@ const (
 	// HttpPublisher exposes a HTTP server that announces published metadatas and allows peers
 	// in the network to sync them over raw HTTP transport.
 	HttpPublisher PublisherKind = "http"
+
+	// DualPublisher combines DataTransferPublisher and HttpPublisher: metadatas are announced
+	// over gossipsub and served over both datatransfer/graphsync and raw HTTP at the same time,
+	// so that consumers can sync over their preferred transport.
+	DualPublisher PublisherKind = "dtsync+http"
 )
 
 type (
 	// PublisherKind represents the kind of publisher to use in order to announce a new
 	// metadata to the network.
-	// See: WithPublisherKind, NoPublisher, DataTransferPublisher, HttpPublisher.
+	// See: WithPublisherKind, NoPublisher, DataTransferPublisher, HttpPublisher, DualPublisher.
 	PublisherKind string
 
 	// Option sets a configuration parameter for the provider engine.
@@ -53,10 +69,22 @@ type (
 		provider               peer.AddrInfo
 		pandoAddrinfo          peer.AddrInfo
 		pandoAPIClient         *resty.Client
+		pandoAPI               *pandoapi.Client
 		checkInterval          time.Duration
+		announceFlushInterval  time.Duration
+		snapshotInterval       time.Duration
+		mirrorInterval         time.Duration
+		bridgeInterval         time.Duration
+		watchInterval          time.Duration
+		republishInterval      time.Duration
+		httpAnnounceURL        string
+		httpAnnounceTimeout    time.Duration
+		retryPolicies          map[RetryComponent]retry.Policy
 		maxIntervalToRepublish time.Duration
 
 		PersistAfterSend bool
+		repairIntegrity  bool
+		dedupe           bool
 
 		lsys               *linking.LinkSystem
 		pubKind            PublisherKind
@@ -67,15 +95,137 @@ type (
 		subTopicName       string
 		subTopic           *pubsub.Topic
 		pubExtraGossipData []byte
+		replayMode         ReplayMode
+		challengeHandler   bool
+		bitswapServer      bool
+		prefetchDepth      int
+		inclusionBatchSize int
+		blockHooks         []BlockHook
+		publishJobs        []JobSpec
+		publishMiddlewares []PublishMiddleware
+		payloadSchemas     map[string]schema.TypedPrototype
+		linkHash           LinkHash
+		linkCodec          LinkCodec
+		linkProto          cidlink.LinkPrototype
+		dsNamespace        string
+
+		// inclusionCheckWorkers and inclusionCheckTimeout bound the inclusion queries of a
+		// check, see WithInclusionCheckWorkers.
+		inclusionCheckWorkers int
+		inclusionCheckTimeout time.Duration
+		maxCheckBackoff       time.Duration
+		maxCheckAttempts      int
+		inclusionCacheTTL     time.Duration
+		alerters              []alert.Alerter
+		backlogAlertThreshold int
+
+		// dtTuning tunes the data-transfer instances of the dtsync publisher and the subscriber,
+		// see WithGraphsyncMaxInProgressRequests.
+		dtTuning dataTransferTuning
+
+		// ipnsRouting publishes the latest metadata to IPNS with a record lifetime of
+		// ipnsLifetime, see WithIPNSPublishing.
+		ipnsRouting  routing.ValueStore
+		ipnsLifetime time.Duration
+
+		// auditLog records the publishes and announcements in the audit log, see WithAuditLog.
+		auditLog bool
+		// recoverAuditLog rebuilds the local chain state from the audit log on initialization,
+		// see WithAuditLogRecovery.
+		recoverAuditLog bool
+
+		// headExporters export the latest metadata on every head update, see WithHeadExporter.
+		headExporters []headexport.Exporter
+
+		// listenAddrs are the addresses the host created by the engine listens on, see
+		// WithListenAddrs.
+		listenAddrs []multiaddr.Multiaddr
+		// natPortMap and the next ones configure the NAT traversal of the host created by the
+		// engine, see WithNATPortMap.
+		natPortMap     bool
+		autoNATService bool
+		reachability   Reachability
+		holePunching   bool
+		relayService   bool
+		staticRelays   []peer.AddrInfo
+
+		// pandoConnectivity keeps the host connected to Pando, re-dialing it with a backoff
+		// from pandoRedialBackoff to maxPandoRedialBackoff, see WithPandoConnectivity.
+		pandoConnectivity     bool
+		pandoRedialBackoff    time.Duration
+		maxPandoRedialBackoff time.Duration
+
+		// addrBookTTL is how long the learned addresses of peers are persisted, see
+		// WithAddrBookTTL.
+		addrBookTTL time.Duration
+
+		// gossip scoring and announcement validation of the router owned by the engine, see
+		// WithGossipScoring and WithAnnounceValidation.
+		gossipScoring      *GossipScoring
+		announceValidation bool
+		allowedAnnouncers  map[peer.ID]struct{}
+		announceValidators []AnnounceValidator
+
+		// blockstore stores the blocks apart from the engine datastore, behind a cache of
+		// blockCacheSize blocks, see WithBlockstore.
+		blockstore     Blockstore
+		blockCacheSize int
+
+		// syncMaxBlocks and syncMaxBytes bound the blocks fetched by a sync, see
+		// WithSyncLimits.
+		syncMaxBlocks int
+		syncMaxBytes  int64
+
+		// maxPayloadSize bounds the size of the published payloads, enforced as set by
+		// payloadSizeEnforcement, see WithMaxPayloadSize.
+		maxPayloadSize         int64
+		payloadSizeEnforcement PayloadSizeEnforcement
+
+		// quotaWindow is the rolling window the publishes are counted in, quotaMaxEntries and
+		// quotaMaxBytes the quotas enforced over it, see WithPublishQuota.
+		quotaWindow     time.Duration
+		quotaMaxEntries int
+		quotaMaxBytes   int64
+
+		// backlogLimit is the number of pending inclusion checks the publishes wait up to
+		// backlogWait to fall below, see WithBacklogLimit.
+		backlogLimit int
+		backlogWait  time.Duration
+
+		// forkCheckInterval is the interval between the comparisons of the local chain with the
+		// view of Pando, forkHeal whether divergences are healed, see WithForkDetection.
+		forkCheckInterval time.Duration
+		forkHeal          bool
+
+		// clock is the time source of the checks, the republishing and the backoffs, see
+		// WithClock.
+		clock clock.Clock
 	}
 )
 
 func newOptions(o ...Option) (*options, error) {
 	opts := &options{
-		pubKind:           NoPublisher,
-		pubHttpListenAddr: "0.0.0.0:9022",
-		pubTopicName:      "/pando/v0.0.1",
-		checkInterval:     time.Minute,
+		pubKind:               NoPublisher,
+		pubHttpListenAddr:     "0.0.0.0:9022",
+		pubTopicName:          "/pando/v0.0.1",
+		checkInterval:         time.Minute,
+		announceFlushInterval: defaultAnnounceFlushInterval,
+		prefetchDepth:         defaultPrefetchDepth,
+		inclusionCheckWorkers: defaultInclusionCheckWorkers,
+		inclusionCheckTimeout: defaultInclusionCheckTimeout,
+		mirrorInterval:        defaultMirrorSyncInterval,
+		bridgeInterval:        defaultBridgeSyncInterval,
+		watchInterval:         defaultWatchScanInterval,
+		payloadSchemas:        make(map[string]schema.TypedPrototype),
+		dtTuning:              dataTransferTuning{restart: defaultRestartConfig()},
+		pandoRedialBackoff:    defaultPandoRedialBackoff,
+		maxPandoRedialBackoff: defaultMaxPandoRedialBackoff,
+		addrBookTTL:           defaultAddrBookTTL,
+		blockCacheSize:        defaultBlockCacheSize,
+		syncMaxBlocks:         defaultSyncMaxBlocks,
+		syncMaxBytes:          defaultSyncMaxBytes,
+		quotaWindow:           defaultQuotaWindow,
+		clock:                 clock.Real,
 	}
 
 	for _, apply := range o {
@@ -84,17 +234,31 @@ func newOptions(o ...Option) (*options, error) {
 		}
 	}
 
+	var err error
+	if opts.linkProto, err = newLinkPrototype(opts.linkHash, opts.linkCodec); err != nil {
+		return nil, err
+	}
+
 	if opts.ds == nil {
 		opts.ds = dssync.MutexWrap(datastore.NewMapDatastore())
 	}
+	if opts.dsNamespace != "" {
+		opts.ds = namespace.Wrap(opts.ds, datastore.NewKey(opts.dsNamespace))
+	}
 
 	if opts.h == nil {
-		h, err := libp2p.New()
+		h, err := libp2p.New(opts.hostOptions()...)
 		if err != nil {
 			return nil, err
 		}
-		logger.Infow("Libp2p host is not configured, but required; created a new host.", "id", h.ID())
+		logger.Infow("Libp2p host is not configured, but required; created a new host.", "id", h.ID(), "addrs", h.Addrs())
 		opts.h = h
+	} else if len(opts.hostOptions()) != 0 {
+		logger.Warn("Listen addresses and NAT traversal options are ignored with a configured host")
+	}
+	if (opts.pubTopic != nil || opts.subTopic != nil) && (opts.gossipScoring != nil || opts.announceValidation ||
+		len(opts.allowedAnnouncers) != 0 || len(opts.announceValidators) != 0) {
+		logger.Warn("Gossip scoring and announcement validation options are ignored on the configured topics")
 	}
 
 	// Initialize private key from libp2p host
@@ -116,6 +280,11 @@ func newOptions(o ...Option) (*options, error) {
 	return opts, nil
 }
 
+// gossips reports whether the publisher kind announces over gossipsub.
+func (k PublisherKind) gossips() bool {
+	return k == DataTransferPublisher || k == DualPublisher
+}
+
 func (o *options) retrievalAddrsAsString() []string {
 	var ras []string
 	for _, ra := range o.provider.Addrs {
@@ -135,9 +304,10 @@ func WithPublisherKind(k PublisherKind) Option {
 }
 
 // WithHttpPublisherListenAddr sets the net listen address for the HTTP publisher.
-// If unset, the default net listen address of '0.0.0.0:3104' is used.
+// If unset, the default net listen address of '0.0.0.0:9022' is used.
 //
-// Note that this option only takes effect if the PublisherKind is set to HttpPublisher.
+// Note that this option only takes effect if the PublisherKind is set to HttpPublisher or
+// DualPublisher.
 // See: WithPublisherKind.
 func WithHttpPublisherListenAddr(addr string) Option {
 	return func(o *options) error {
@@ -149,7 +319,8 @@ func WithHttpPublisherListenAddr(addr string) Option {
 // WithTopicName sets toe topic name on which pubsub announcements are published.
 // To override the default pubsub configuration, use WithTopic.
 //
-// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher.
+// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher
+// or DualPublisher.
 // See: WithPublisherKind.
 func WithTopicName(t string) Option {
 	return func(o *options) error {
@@ -162,7 +333,8 @@ func WithTopicName(t string) Option {
 // To use the default pubsub configuration with a specific topic name, use WithTopicName. If both
 // options are specified, WithTopic takes presence.
 //
-// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher.
+// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher
+// or DualPublisher.
 // See: WithPublisherKind.
 func WithTopic(t *pubsub.Topic) Option {
 	return func(o *options) error {
@@ -178,10 +350,71 @@ func WithSubTopic(t *pubsub.Topic) Option {
 	}
 }
 
+// WithGossipScoring enables the peer scoring of the gossipsub router owned by the engine on the
+// announcement topics, i.e. the subscriber topic and the topics announced on, so that the peers
+// forwarding spam announcements are pruned from the mesh then graylisted. Combine it with
+// WithAnnounceValidation for the invalid announcements to be detected.
+//
+// Note that this option, like the announcement validation ones, does not apply to the topics set
+// with WithTopic and WithSubTopic.
+// See: DefaultGossipScoring.
+func WithGossipScoring(s GossipScoring) Option {
+	return func(o *options) error {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		o.gossipScoring = &s
+		return nil
+	}
+}
+
+// WithAnnounceValidation rejects the messages gossiped on the announcement topics that are not
+// announcements of a cid, instead of forwarding them to the mesh.
+// See: WithGossipScoring, WithAllowedAnnouncers, WithAnnounceValidator.
+func WithAnnounceValidation(enabled bool) Option {
+	return func(o *options) error {
+		o.announceValidation = enabled
+		return nil
+	}
+}
+
+// WithAllowedAnnouncers only accepts on the announcement topics the announcements of the peers
+// ids, besides the ones of the engine itself, e.g. the mirrored providers. It can be set several
+// times to allow more peers, and implies WithAnnounceValidation.
+func WithAllowedAnnouncers(ids ...string) Option {
+	return func(o *options) error {
+		if o.allowedAnnouncers == nil {
+			o.allowedAnnouncers = make(map[peer.ID]struct{})
+		}
+		for _, id := range ids {
+			p, err := peer.Decode(id)
+			if err != nil {
+				return fmt.Errorf("invalid allowed announcer %s: %w", id, err)
+			}
+			o.allowedAnnouncers[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithAnnounceValidator validates the announcements received on the announcement topics with v
+// once they are known to be well-formed. It can be set several times, the validators run in
+// order until one does not accept the announcement. It implies WithAnnounceValidation.
+func WithAnnounceValidator(v AnnounceValidator) Option {
+	return func(o *options) error {
+		if v == nil {
+			return fmt.Errorf("announce validator can not be nil")
+		}
+		o.announceValidators = append(o.announceValidators, v)
+		return nil
+	}
+}
+
 // WithDataTransfer sets the instance of datatransfer.Manager to use.
 // If unspecified a new instance is created automatically.
 //
-// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher.
+// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher
+// or DualPublisher.
 // See: WithPublisherKind.
 func WithDataTransfer(dt datatransfer.Manager) Option {
 	return func(o *options) error {
@@ -200,6 +433,100 @@ func WithHost(h host.Host) Option {
 	}
 }
 
+// WithListenAddrs listens on the addresses addrs of the transport t, e.g.
+//
+//	WithListenAddrs(TransportQUIC, "/ip4/0.0.0.0/udp/9020/quic")
+//
+// so that peers that can not reach the host over TCP can still sync its chains. It can be set
+// several times, the host listens on all the addresses. If unset, the host listens on the
+// default TCP addresses of libp2p.
+//
+// Note that this option only takes effect on the host created by the engine, not on the one set
+// with WithHost.
+// See: ParseListenAddrs.
+func WithListenAddrs(t Transport, addrs ...string) Option {
+	return func(o *options) error {
+		maddrs, err := ParseListenAddrs(t, addrs...)
+		if err != nil {
+			return err
+		}
+		o.listenAddrs = append(o.listenAddrs, maddrs...)
+		return nil
+	}
+}
+
+// WithNATPortMap maps the listen ports of the host on the NAT router of its network with UPnP
+// or NAT-PMP, so that peers can dial it from outside the network.
+//
+// Note that this option, like the other NAT traversal options, only takes effect on the host
+// created by the engine, not on the one set with WithHost.
+func WithNATPortMap(enabled bool) Option {
+	return func(o *options) error {
+		o.natPortMap = enabled
+		return nil
+	}
+}
+
+// WithAutoNATService helps the peers determine their reachability with AutoNAT by dialing them
+// back. The host detects its own reachability whether it is enabled or not.
+// See: WithNATPortMap.
+func WithAutoNATService(enabled bool) Option {
+	return func(o *options) error {
+		o.autoNATService = enabled
+		return nil
+	}
+}
+
+// WithReachability overrides the reachability of the host detected by AutoNAT. If unset, AutoNAT
+// detects it.
+// See: WithNATPortMap.
+func WithReachability(r Reachability) Option {
+	return func(o *options) error {
+		switch r {
+		case ReachabilityAuto, ReachabilityPublic, ReachabilityPrivate:
+			o.reachability = r
+			return nil
+		default:
+			return fmt.Errorf("unknown reachability: %s", r)
+		}
+	}
+}
+
+// WithHolePunching upgrades the relayed connections of the host to direct ones by hole punching
+// with DCUtR, so that relays only carry the connection setup.
+// See: WithStaticRelays.
+func WithHolePunching(enabled bool) Option {
+	return func(o *options) error {
+		o.holePunching = enabled
+		return nil
+	}
+}
+
+// WithRelayService runs a circuit-relay-v2 service on the host once it is publicly reachable,
+// so that the peers behind NAT can be reached through it.
+// See: WithNATPortMap.
+func WithRelayService(enabled bool) Option {
+	return func(o *options) error {
+		o.relayService = enabled
+		return nil
+	}
+}
+
+// WithStaticRelays reserves slots on the circuit-relay-v2 relays of addrs, each with its /p2p/
+// component, once the host is found behind NAT, and advertises the relayed addresses so that
+// the chains of the engine can still be synced. It can be set several times to add relays.
+// See: WithHolePunching, WithReachability, ParseRelayAddrs.
+func WithStaticRelays(addrs ...string) Option {
+	return func(o *options) error {
+		relays, err := ParseRelayAddrs(addrs...)
+		if err != nil {
+			return err
+		}
+		o.staticRelays = append(o.staticRelays, relays...)
+		return nil
+	}
+}
+
 // WithDatastore sets the datastore that is used by the engine to store metadatas.
 // If unspecified, an ephemeral in-memory datastore is used.
 // See: datastore.NewMapDatastore.
@@ -210,6 +537,119 @@ func WithDatastore(ds datastore.Batching) Option {
 	}
 }
 
+// WithDatastoreNamespace scopes all the keys of the engine under prefix, including the stored
+// blocks and the state of the legs publisher and subscriber, so that several engines can share
+// a datastore. If unset, keys are not prefixed.
+//
+// Note that a link system set by WithLinkSystem is used as is.
+func WithDatastoreNamespace(prefix string) Option {
+	return func(o *options) error {
+		if datastore.NewKey(prefix).String() == "/" {
+			prefix = ""
+		}
+		o.dsNamespace = prefix
+		return nil
+	}
+}
+
+// WithBlockstore stores the blocks of the metadatas and their payloads in bs instead of the engine
+// datastore, e.g. to keep them on a separate disk. If unset, they are stored in the engine
+// datastore under their cid.
+// Note that a link system set by WithLinkSystem is used as is.
+// See: WithBlockCacheSize.
+func WithBlockstore(bs Blockstore) Option {
+	return func(o *options) error {
+		if bs == nil {
+			return fmt.Errorf("blockstore can not be nil")
+		}
+		o.blockstore = bs
+		return nil
+	}
+}
+
+// WithBlockCacheSize keeps up to size of the recently stored and loaded blocks in memory, so
+// that loading the chain head and walking the chain does not read the blockstore every time.
+// Zero keeps the default of 1024 blocks, a negative size disables the cache.
+func WithBlockCacheSize(size int) Option {
+	return func(o *options) error {
+		switch {
+		case size < 0:
+			o.blockCacheSize = 0
+		case size > 0:
+			o.blockCacheSize = size
+		}
+		return nil
+	}
+}
+
+// WithSyncLimits stops the syncs from Pando fetching more than maxBlocks blocks or maxBytes
+// bytes, so that syncing a whole chain with SyncDepthAll can not fetch without bounds. Zero keeps
+// the default of 1000000 blocks and 1GiB, a negative value disables the limit.
+// Note that the bytes are not counted with a link system set by WithLinkSystem.
+func WithSyncLimits(maxBlocks int, maxBytes int64) Option {
+	return func(o *options) error {
+		switch {
+		case maxBlocks < 0:
+			o.syncMaxBlocks = 0
+		case maxBlocks > 0:
+			o.syncMaxBlocks = maxBlocks
+		}
+		switch {
+		case maxBytes < 0:
+			o.syncMaxBytes = 0
+		case maxBytes > 0:
+			o.syncMaxBytes = maxBytes
+		}
+		return nil
+	}
+}
+
+// WithMaxPayloadSize bounds the size of the payloads published by PublishBytesData and
+// PublishCborData to size bytes, so that no block too large to be transferred over graphsync is
+// created. The larger payloads are rejected with a *PayloadTooLargeError, or with
+// ChunkOversizedPayloads the bytes ones are split into raw blocks of up to size bytes, and 256KiB,
+// stored like the files of PublishDirectory with the payload linking to the file node. Note that
+// the metadata block is a little larger than its payload, with the signature and the links.
+// It is disabled by default, with a zero size.
+// See: Engine.CatStream.
+func WithMaxPayloadSize(size int64, enforcement PayloadSizeEnforcement) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return fmt.Errorf("max payload size can not be negative")
+		}
+		switch enforcement {
+		case "":
+			enforcement = RejectOversizedPayloads
+		case RejectOversizedPayloads, ChunkOversizedPayloads:
+		default:
+			return fmt.Errorf("unknown payload size enforcement: %s", enforcement)
+		}
+		o.maxPayloadSize = size
+		o.payloadSizeEnforcement = enforcement
+		return nil
+	}
+}
+
+// WithPublishQuota counts the metadatas published on all the chains and the size of their blocks
+// over a rolling window, 24 hours if zero, and rejects the publishes over maxEntries metadatas or
+// maxBytes bytes in the window with a *QuotaExceededError. The window rolls by a sixtieth of it at
+// a time. A zero quota is not enforced, the publishes are counted regardless.
+// See: Engine.PublishQuota.
+func WithPublishQuota(window config.Duration, maxEntries int, maxBytes int64) Option {
+	return func(o *options) error {
+		if window < 0 || maxEntries < 0 || maxBytes < 0 {
+			return fmt.Errorf("publish quota can not be negative")
+		}
+		o.quotaWindow = time.Duration(window)
+		if o.quotaWindow == 0 {
+			o.quotaWindow = defaultQuotaWindow
+		}
+		o.quotaMaxEntries = maxEntries
+		o.quotaMaxBytes = maxBytes
+		return nil
+	}
+}
+
 func WithLinkSystem(lsys *linking.LinkSystem) Option {
 	return func(o *options) error {
 		o.lsys = lsys
@@ -225,7 +665,9 @@ func WithSubTopicName(tname string) Option {
 }
 
 // WithExtraGossipData supplies extra data to include in the pubsub announcement.
-// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher.
+// It can be replaced at runtime with Engine.SetExtraGossipData.
+// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher
+// or DualPublisher.
 // See: WithPublisherKind.
 func WithExtraGossipData(extraData []byte) Option {
 	return func(o *options) error {
@@ -245,10 +687,58 @@ func WithPandoAddrinfo(addrinfo peer.AddrInfo) Option {
 	}
 }
 
+// WithPandoConnectivity keeps the host connected to the Pando peer set with WithPandoAddrinfo
+// once started: the peer is protected from the trimming of the connection manager, and re-dialed
+// with backoff whenever the connection drops, instead of only being dialed on syncs.
+// See: WithPandoRedialBackoff.
+func WithPandoConnectivity(enabled bool) Option {
+	return func(o *options) error {
+		o.pandoConnectivity = enabled
+		return nil
+	}
+}
+
+// WithPandoRedialBackoff waits initial after the first failed dial of Pando, then twice longer
+// after every failure up to max, raised to initial if below. Zero keeps the defaults of a second
+// and 5 minutes.
+// See: WithPandoConnectivity.
+func WithPandoRedialBackoff(initial, max config.Duration) Option {
+	return func(o *options) error {
+		if initial < 0 || max < 0 {
+			return fmt.Errorf("pando redial backoff can not be negative")
+		}
+		if initial != 0 {
+			o.pandoRedialBackoff = time.Duration(initial)
+		}
+		if max != 0 {
+			o.maxPandoRedialBackoff = time.Duration(max)
+		}
+		if o.maxPandoRedialBackoff < o.pandoRedialBackoff {
+			o.maxPandoRedialBackoff = o.pandoRedialBackoff
+		}
+		return nil
+	}
+}
+
+// WithAddrBookTTL persists the addresses learned of Pando, the relays and the mirrored providers
+// for duration, so that they are known again after a restart. Zero keeps the default of 24 hours. The addresses added with Engine.AddPeerAddrs have their own TTL.
+func WithAddrBookTTL(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration < 0 {
+			return fmt.Errorf("address book ttl can not be negative")
+		}
+		if duration != 0 {
+			o.addrBookTTL = time.Duration(duration)
+		}
+		return nil
+	}
+}
+
 func WithPandoAPIClient(url string, connectTimeout time.Duration) Option {
 	return func(o *options) error {
 		httpClient := resty.New().SetBaseURL(url).SetTimeout(connectTimeout).SetDebug(false)
 		o.pandoAPIClient = httpClient
+		o.pandoAPI = pandoapi.NewWithResty(httpClient)
 		return nil
 	}
 }
@@ -260,6 +750,270 @@ func WithCheckInterval(duration config.Duration) Option {
 	}
 }
 
+// WithAnnounceFlushInterval sets the interval at which announcements that failed, e.g. while the
+// network was unreachable, are retried. They are also retried whenever a new connection is made.
+// If unset, they are retried every 30 seconds.
+func WithAnnounceFlushInterval(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration <= 0 {
+			return fmt.Errorf("announce flush interval must be positive")
+		}
+		o.announceFlushInterval = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithSnapshotFollowInterval enables following the snapshot chain of Pando: new snapshots are
+// synced locally every interval and cross-referenced with the pushed metadatas.
+// It is disabled by default.
+// See: Engine.SnapshotOf.
+func WithSnapshotFollowInterval(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration < 0 {
+			return fmt.Errorf("snapshot follow interval can not be negative")
+		}
+		o.snapshotInterval = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithIPNSPublishing publishes the latest metadata under the IPNS name of the provider, signed
+// with the key of the host, to vs after every head update, e.g. to a DHT, so that consumers can
+// resolve the head of the chain without going through Pando. The records are valid for lifetime
+// and published again every half of it, if zero they are valid for 24 hours.
+// It is disabled by default.
+// See: Engine.PublishIPNS, Engine.ResolveIPNS.
+func WithIPNSPublishing(vs routing.ValueStore, lifetime config.Duration) Option {
+	return func(o *options) error {
+		if vs == nil {
+			return fmt.Errorf("IPNS value store can not be nil")
+		}
+		if lifetime < 0 {
+			return fmt.Errorf("IPNS record lifetime can not be negative")
+		}
+		o.ipnsRouting = vs
+		o.ipnsLifetime = time.Duration(lifetime)
+		if o.ipnsLifetime == 0 {
+			o.ipnsLifetime = defaultIPNSLifetime
+		}
+		return nil
+	}
+}
+
+// WithAuditLog records every publish, announcement and republish in an append-only local audit
+// log, each entry chained to the previous one by its hash so that alterations are detected.
+// It is disabled by default.
+// See: Engine.VerifyAuditLog, Engine.ExportAuditLog.
+func WithAuditLog(enabled bool) Option {
+	return func(o *options) error {
+		o.auditLog = enabled
+		return nil
+	}
+}
+
+// WithAuditLogRecovery rebuilds the latest metadata, the pushed cid list and the check list from
+// the audit log on initialization, instead of loading them, e.g. after their datastore keys were
+// lost or corrupted. Initialization fails if the audit log does not verify. It needs
+// WithAuditLog and is meant for a single start, the log is replayed on every start otherwise.
+// See: Engine.RecoverFromAuditLog.
+func WithAuditLogRecovery(enabled bool) Option {
+	return func(o *options) error {
+		o.recoverAuditLog = enabled
+		return nil
+	}
+}
+
+// WithHeadExporter exports the latest metadata with x whenever it changes, e.g. to update the
+// DNSLink TXT record of the provider. Failed exports are retried until the head is exported or
+// changes again. It can be set several times, every exporter gets every head.
+// See: headexport.NewHTTPPut, headexport.NewCommand.
+func WithHeadExporter(x headexport.Exporter) Option {
+	return func(o *options) error {
+		if x == nil {
+			return fmt.Errorf("head exporter can not be nil")
+		}
+		o.headExporters = append(o.headExporters, x)
+		return nil
+	}
+}
+
+// WithWatchScanInterval sets how often watched directories are scanned for new and changed
+// files. If unset, they are scanned every second.
+// See: Engine.StartWatch.
+func WithWatchScanInterval(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration <= 0 {
+			return fmt.Errorf("watch scan interval must be positive")
+		}
+		o.watchInterval = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithRepublishLatestInterval re-announces the latest metadata every interval, so that Pando
+// nodes that joined or recovered since the last announcement learn the head of the chain.
+// It is disabled by default.
+// See: Engine.RePublishLatest.
+func WithRepublishLatestInterval(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration < 0 {
+			return fmt.Errorf("republish latest interval can not be negative")
+		}
+		o.republishInterval = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithClock sets the time source of the inclusion checks and their backoff, the republishing of
+// the metadatas not included, the periodic republishing of the latest metadata and the redial
+// backoff of Pando, e.g. a fake clock to test them deterministically.
+// It is clock.Real by default.
+// See: testutil.FakeClock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("clock can not be nil")
+		}
+		o.clock = c
+		return nil
+	}
+}
+
+// WithHttpAnnounceURL additionally announces new metadatas by POSTing the announce message to
+// url, the HTTP announce endpoint of Pando, for networks where gossipsub is unreliable.
+// A failed HTTP announcement fails the announcement, so that it is retried and queued.
+// It is disabled by default.
+func WithHttpAnnounceURL(announceURL string, timeout time.Duration) Option {
+	return func(o *options) error {
+		if announceURL == "" {
+			o.httpAnnounceURL = ""
+			return nil
+		}
+		u, err := url.Parse(announceURL)
+		if err != nil {
+			return fmt.Errorf("invalid http announce url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("http announce url must be http or https, got: %s", announceURL)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("http announce timeout can not be negative")
+		}
+		if timeout == 0 {
+			timeout = defaultHttpAnnounceTimeout
+		}
+		o.httpAnnounceURL = announceURL
+		o.httpAnnounceTimeout = timeout
+		return nil
+	}
+}
+
+// WithMirrorSyncInterval sets how often mirrored chains are synced in addition to the
+// announcements of their providers. If unset, they are synced every minute.
+// See: Engine.StartMirror.
+func WithMirrorSyncInterval(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration <= 0 {
+			return fmt.Errorf("mirror sync interval must be positive")
+		}
+		o.mirrorInterval = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithBridgeSyncInterval sets how often the advertisement chains of the bridged index-providers
+// are synced. If unset, they are synced every minute.
+// See: Engine.StartBridge.
+func WithBridgeSyncInterval(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration <= 0 {
+			return fmt.Errorf("bridge sync interval must be positive")
+		}
+		o.bridgeInterval = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the retry policy of component instead of its default.
+// See: DefaultRetryPolicy.
+func WithRetryPolicy(component RetryComponent, policy retry.Policy) Option {
+	return func(o *options) error {
+		switch component {
+		case RetryPandoAPI, RetryAnnounce, RetrySync:
+		default:
+			return fmt.Errorf("unknown retry component: %s", component)
+		}
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("invalid retry policy of %s: %w", component, err)
+		}
+		if o.retryPolicies == nil {
+			o.retryPolicies = make(map[RetryComponent]retry.Policy)
+		}
+		o.retryPolicies[component] = policy
+		return nil
+	}
+}
+
+// WithBlockHook calls hook with every block stored or loaded through the link system of the
+// engine, e.g. for external indexing, mirroring or metrics. It can be set several times, hooks are
+// called in order. Hooks are not called with a link system set by WithLinkSystem.
+func WithBlockHook(hook BlockHook) Option {
+	return func(o *options) error {
+		if hook == nil {
+			return fmt.Errorf("block hook can not be nil")
+		}
+		o.blockHooks = append(o.blockHooks, hook)
+		return nil
+	}
+}
+
+// WithPublishMiddleware wraps every publish of the engine, including the named chains, with mw,
+// e.g. to transform, validate, enrich or audit the published metadatas. It can be set several
+// times, the first middleware set being the outermost. Middlewares changing the metadata must
+// re-sign it with Engine.SignMetadata. They run while the publish lock is held, so they must not
+// publish through the engine themselves.
+func WithPublishMiddleware(mw PublishMiddleware) Option {
+	return func(o *options) error {
+		if mw == nil {
+			return fmt.Errorf("publish middleware can not be nil")
+		}
+		o.publishMiddlewares = append(o.publishMiddlewares, mw)
+		return nil
+	}
+}
+
+// WithPublishJob schedules spec on Start, in addition to the jobs added with Engine.AddJob. It
+// can be set several times, once per job.
+// See: Engine.AddJob.
+func WithPublishJob(spec JobSpec) Option {
+	return func(o *options) error {
+		if _, err := spec.validate(); err != nil {
+			return err
+		}
+		for _, j := range o.publishJobs {
+			if j.Name == spec.Name {
+				return fmt.Errorf("publish job %s is set twice", spec.Name)
+			}
+		}
+		o.publishJobs = append(o.publishJobs, spec)
+		return nil
+	}
+}
+
+// WithPayloadSchema registers the type typeName of the IPLD schema dsl as the schema of
+// payloadType. It can be set several times, once per payload type.
+// See: Engine.RegisterPayloadSchema.
+func WithPayloadSchema(payloadType string, dsl []byte, typeName string) Option {
+	return func(o *options) error {
+		proto, err := compilePayloadSchema(payloadType, dsl, typeName)
+		if err != nil {
+			return err
+		}
+		o.payloadSchemas[payloadType] = proto
+		return nil
+	}
+}
+
 func WithMaxIntervalToRepublish(duration config.Duration) Option {
 	return func(o *options) error {
 		o.maxIntervalToRepublish = time.Duration(duration)
@@ -273,3 +1027,287 @@ func WithPersistAfterSend(persistAfterSend bool) Option {
 		return nil
 	}
 }
+
+// WithIntegrityRepair repairs the inconsistencies of the local chain state found on
+// initialization instead of only logging them.
+// See: Engine.CheckIntegrity.
+func WithIntegrityRepair(repair bool) Option {
+	return func(o *options) error {
+		o.repairIntegrity = repair
+		return nil
+	}
+}
+
+// WithDedupe makes the publishes of a payload already published on the same chain return the
+// metadata publishing it instead of appending a new one, unless WithForce is set. Payloads are
+// matched by the hash of their content, whatever the codec of their metadata. It is disabled by
+// default.
+func WithDedupe(dedupe bool) Option {
+	return func(o *options) error {
+		o.dedupe = dedupe
+		return nil
+	}
+}
+
+// WithLinkHash sets the multihash function of the links of the stored metadatas, which embed
+// their payloads. If unset, LinkHashSha2_256 is used.
+// Note that consumers and Pando must support the hash function to load the metadatas.
+func WithLinkHash(hash LinkHash) Option {
+	return func(o *options) error {
+		o.linkHash = hash
+		return nil
+	}
+}
+
+// WithLinkCodec sets the codec of the stored metadatas. If unset, LinkCodecDagJson is used.
+// Note that consumers and Pando must support the codec to load the metadatas.
+func WithLinkCodec(codec LinkCodec) Option {
+	return func(o *options) error {
+		o.linkCodec = codec
+		return nil
+	}
+}
+
+// WithReplayUnannounced sets how metadatas stored locally but never announced are handled when
+// the engine starts with a publisher, e.g. after running with NoPublisher. The metadatas
+// published before the first start recording the announced ones are taken as announced.
+// If unset, ReplayNone is used and they are only reported in the logs. The replayed
+// announcements that fail, e.g. without gossip peer yet, are queued for the announce queue.
+//
+// Whatever the mode, the latest metadata is re-announced if the process stopped while it was
+// published, after it was stored but before it was announced or queued.
+// See: ReplayMode.
+func WithReplayUnannounced(mode ReplayMode) Option {
+	return func(o *options) error {
+		switch mode {
+		case ReplayNone, ReplayHead, ReplayAll:
+			o.replayMode = mode
+			return nil
+		default:
+			return fmt.Errorf("unknown replay mode: %s", mode)
+		}
+	}
+}
+
+// WithChallengeHandler enables answering proof-of-possession challenges over ChallengeProtocolID,
+// letting Pando or consumers verify that the engine controls the identity behind the chain.
+// It is disabled by default.
+// See: Challenge.
+func WithChallengeHandler(enabled bool) Option {
+	return func(o *options) error {
+		o.challengeHandler = enabled
+		return nil
+	}
+}
+
+// WithBitswapServer serves the blocks of the engine, metadatas and payloads, over Bitswap on
+// Start, so that consumers such as IPFS nodes connected to the host can fetch them directly.
+// Only blocks are served, nothing is fetched from the peers nor provided to routing systems.
+// It is disabled by default.
+func WithBitswapServer(enabled bool) Option {
+	return func(o *options) error {
+		o.bitswapServer = enabled
+		return nil
+	}
+}
+
+// WithPrefetchDepth sets the number of metadatas loaded concurrently ahead of chain walks.
+// If unset, 8 metadatas are prefetched. Zero disables prefetching.
+// See: Engine.WalkChain.
+func WithPrefetchDepth(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("prefetch depth can not be negative")
+		}
+		o.prefetchDepth = n
+		return nil
+	}
+}
+
+// WithInclusionBatchSize checks the pending metadatas with batched inclusion queries of up to n
+// cids each instead of one query per cid. The cids missing from the results, and all of them if
+// Pando does not serve batched queries, are checked one by one. If unset or zero, every cid is
+// queried on its own.
+func WithInclusionBatchSize(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("inclusion batch size can not be negative")
+		}
+		o.inclusionBatchSize = n
+		return nil
+	}
+}
+
+// WithInclusionCheckWorkers sets the number of inclusion queries of the pending metadatas sent
+// to Pando concurrently on every check, the ones not covered by batched queries. If unset, 8
+// workers query them.
+func WithInclusionCheckWorkers(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("inclusion check workers must be at least 1")
+		}
+		o.inclusionCheckWorkers = n
+		return nil
+	}
+}
+
+// WithInclusionCheckTimeout aborts the inclusion queries of the checks taking longer than
+// duration, the metadatas are checked again on the next check. If unset, queries time out after
+// 30 seconds. Zero only bounds them by the timeout of the Pando API client.
+func WithInclusionCheckTimeout(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration < 0 {
+			return fmt.Errorf("inclusion check timeout can not be negative")
+		}
+		o.inclusionCheckTimeout = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithMaxCheckBackoff backs off the inclusion checks of the metadatas repeatedly found not
+// included in Pando: the interval between their checks doubles from the check interval on every
+// miss, up to duration. If unset or zero, every pending metadata is checked on every check.
+func WithMaxCheckBackoff(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration < 0 {
+			return fmt.Errorf("max check backoff can not be negative")
+		}
+		o.maxCheckBackoff = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithMaxCheckAttempts moves the metadatas found not included in Pando on n consecutive checks
+// to the dead-letter list, where they are no longer checked nor republished.
+// If unset or zero, metadatas are checked until they are included.
+// See: Engine.ListDeadLetters.
+func WithMaxCheckAttempts(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("max check attempts can not be negative")
+		}
+		o.maxCheckAttempts = n
+		return nil
+	}
+}
+
+// WithInclusionCacheTTL caches the inclusions confirmed in a snapshot of Pando for duration, so
+// that GetInclusion, Audit and the other inclusion lookups do not query Pando again for them.
+// If unset or zero, the inclusions are not cached.
+// See: Engine.GetInclusion.
+func WithInclusionCacheTTL(duration config.Duration) Option {
+	return func(o *options) error {
+		if duration < 0 {
+			return fmt.Errorf("inclusion cache ttl can not be negative")
+		}
+		o.inclusionCacheTTL = time.Duration(duration)
+		return nil
+	}
+}
+
+// WithAlerter sends alerts to a when a metadata is moved to the dead-letter list or the pending
+// inclusion checks rise above the threshold set with WithBacklogAlertThreshold. It can be set
+// several times, every alerter gets every alert.
+func WithAlerter(a alert.Alerter) Option {
+	return func(o *options) error {
+		if a == nil {
+			return fmt.Errorf("alerter can not be nil")
+		}
+		o.alerters = append(o.alerters, a)
+		return nil
+	}
+}
+
+// WithBacklogAlertThreshold alerts once more than n inclusion checks are pending over all the
+// chains, and again only after the backlog fell back to n. If unset or zero, the backlog is not
+// alerted on.
+// See: WithAlerter.
+func WithBacklogAlertThreshold(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("backlog alert threshold can not be negative")
+		}
+		o.backlogAlertThreshold = n
+		return nil
+	}
+}
+
+// WithForkDetection compares the head of the default chain with the head of the provider known
+// by Pando every interval and alerts once they diverged or the local chain is behind Pando, e.g.
+// after restoring an old backup of the datastore. With heal, the local head of a diverged chain is
+// re-announced for Pando to sync it, a local chain behind Pando is never re-announced. If unset or
+// zero, forks are only detected by calling Engine.CheckFork.
+// See: WithAlerter.
+func WithForkDetection(interval config.Duration, heal bool) Option {
+	return func(o *options) error {
+		if interval < 0 {
+			return fmt.Errorf("fork check interval can not be negative")
+		}
+		o.forkCheckInterval = time.Duration(interval)
+		o.forkHeal = heal
+		return nil
+	}
+}
+
+// WithBacklogLimit applies backpressure to the publishes once n inclusion checks are pending over
+// all the chains: they wait up to wait for the backlog to fall below n, bounded by their context,
+// and then fail with a *BacklogError, right away if wait is zero. The publishes skipping the check
+// list are not held back. If unset or zero, the backlog is unbounded.
+// See: WithBacklogAlertThreshold.
+func WithBacklogLimit(n int, wait config.Duration) Option {
+	return func(o *options) error {
+		if n < 0 || wait < 0 {
+			return fmt.Errorf("backlog limit can not be negative")
+		}
+		o.backlogLimit = n
+		o.backlogWait = time.Duration(wait)
+		return nil
+	}
+}
+
+// WithGraphsyncMaxInProgressRequests bounds the graphsync requests in flight of the dtsync
+// publisher and the subscriber to n, both the requests served and the ones made, so that heavy
+// sync workloads are not throttled by the graphsync defaults. If unset or zero, the graphsync
+// defaults are kept.
+//
+// Note that this option, like the other data-transfer tunings, does not take effect on the
+// instance set with WithDataTransfer.
+func WithGraphsyncMaxInProgressRequests(n uint64) Option {
+	return func(o *options) error {
+		o.dtTuning.maxInProgressRequests = n
+		o.dtTuning.tuned = true
+		return nil
+	}
+}
+
+// WithDataTransferRestartPolicy restarts the failed data transfers up to maxRestarts times in a
+// row, waiting at least backoff between two restarts. If unset, transfers are restarted up to 3
+// times with a backoff of a minute.
+// See: WithGraphsyncMaxInProgressRequests.
+func WithDataTransferRestartPolicy(maxRestarts uint32, backoff config.Duration) Option {
+	return func(o *options) error {
+		if backoff < 0 {
+			return fmt.Errorf("data-transfer restart backoff can not be negative")
+		}
+		o.dtTuning.restart.MaxConsecutiveRestarts = maxRestarts
+		o.dtTuning.restart.RestartBackoff = time.Duration(backoff)
+		o.dtTuning.tuned = true
+		return nil
+	}
+}
+
+// WithDataTransferTimeouts restarts the data transfers not accepted by the other side within
+// accept, and the ones not completed within complete once all their data is sent. Zero disables
+// the timeout. If unset, both time out after a minute.
+// See: WithDataTransferRestartPolicy.
+func WithDataTransferTimeouts(accept, complete config.Duration) Option {
+	return func(o *options) error {
+		if accept < 0 || complete < 0 {
+			return fmt.Errorf("data-transfer timeouts can not be negative")
+		}
+		o.dtTuning.restart.AcceptTimeout = time.Duration(accept)
+		o.dtTuning.restart.CompleteTimeout = time.Duration(complete)
+		o.dtTuning.tuned = true
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"io"
+)
+
+// PayloadSizeEnforcement is how the payloads larger than the max payload size are published.
+// See: WithMaxPayloadSize.
+type PayloadSizeEnforcement string
+
+const (
+	// RejectOversizedPayloads fails their publishes with a *PayloadTooLargeError.
+	RejectOversizedPayloads PayloadSizeEnforcement = "reject"
+	// ChunkOversizedPayloads stores the bytes payloads as a file of raw chunks of up to the max
+	// payload size, which the payload of the metadata links to. The other payloads are rejected.
+	ChunkOversizedPayloads PayloadSizeEnforcement = "chunk"
+)
+
+// PayloadTooLargeError is returned by the publishes of payloads larger than the max payload size.
+type PayloadTooLargeError struct {
+	Size int64
+	Max  int64
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d bytes, more than %d", ErrPayloadTooLarge, e.Size, e.Max)
+}
+
+// Is makes PayloadTooLargeError match ErrPayloadTooLarge.
+func (e *PayloadTooLargeError) Is(target error) bool {
+	return target == ErrPayloadTooLarge
+}
+
+// checkPayloadSize fails with a *PayloadTooLargeError if the payload of size bytes is larger than
+// the max payload size.
+func (e *Engine) checkPayloadSize(size int) error {
+	if e.maxPayloadSize <= 0 || int64(size) <= e.maxPayloadSize {
+		return nil
+	}
+	return &PayloadTooLargeError{Size: int64(size), Max: e.maxPayloadSize}
+}
+
+// bytesPayload returns the payload of the bytes data. Data larger than the max payload size is
+// rejected, or with ChunkOversizedPayloads stored in lsys as a file whose node is linked by the
+// payload, its chunking recorded in opts unless set.
+func (e *Engine) bytesPayload(ctx context.Context, lsys ipld.LinkSystem, data []byte, opts *publishOptions) (datamodel.Node, error) {
+	err := e.checkPayloadSize(len(data))
+	if err == nil {
+		return basicnode.NewBytes(data), nil
+	}
+	if e.payloadSizeEnforcement != ChunkOversizedPayloads {
+		return nil, err
+	}
+	chunkSize := dirChunkSize
+	if e.maxPayloadSize < int64(chunkSize) {
+		chunkSize = int(e.maxPayloadSize)
+	}
+	lnk, chunking, err := storeFileNode(ctx, lsys, bytes.NewReader(data), chunkSize, opts.linkPrototype(e.linkProto))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payload chunks: %w", err)
+	}
+	if opts.chunking == nil {
+		opts.chunking = chunking
+	}
+	logger.Infow("Chunked oversized payload", "size", len(data), "chunks", chunking.Chunks, "file", lnk)
+	return basicnode.NewLink(lnk), nil
+}
+
+// previewLinkSystem is the link system of the engine computing the links without storing
+// anything.
+func (e *Engine) previewLinkSystem() ipld.LinkSystem {
+	lsys := *e.lsys
+	lsys.StorageWriteOpener = func(ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		return io.Discard, func(ipld.Link) error { return nil }, nil
+	}
+	return lsys
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ProviderSyncResult is the result of SyncWithProvider.
+type ProviderSyncResult struct {
+	// Provider is the peer ID of the synced provider.
+	Provider string
+	// Head is the latest metadata of the provider known by Pando, where the sync started.
+	Head cid.Cid
+	// Height is the number of the metadatas synced from Head, following their previous links.
+	Height int
+	// Synced are the cids of the synced blocks, in sync order.
+	Synced []cid.Cid
+}
+
+// ListProviders returns the providers registered in Pando, e.g. to pick one to sync with
+// SyncWithProvider.
+func (e *Engine) ListProviders(ctx context.Context) ([]ProviderInfo, error) {
+	return e.pandoAPI.ListProviders(ctx)
+}
+
+// GetProviderInfo returns the provider peerID registered in Pando, ResourceNotFound if it is not
+// registered.
+func (e *Engine) GetProviderInfo(ctx context.Context, peerID peer.ID) (*ProviderInfo, error) {
+	info, err := e.pandoAPI.ProviderInfo(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ResourceNotFound
+	}
+	return info, nil
+}
+
+// SyncWithProvider syncs the chain of provider from its latest metadata known by Pando, see
+// Sync. The result is returned with a *SyncLimitError too, with the blocks synced until the sync
+// was stopped.
+func (e *Engine) SyncWithProvider(ctx context.Context, provider string, depth int, endCid string, o ...SyncOption) (*ProviderSyncResult, error) {
+	headCid, err := e.pandoAPI.ProviderHead(ctx, provider)
+	if err != nil {
+		logger.Errorf("failed to get the latest cid of provider from PandoAPI: %v", err)
+		return nil, err
+	}
+
+	synced, err := e.Sync(ctx, headCid.String(), depth, endCid, o...)
+	if err != nil && !errors.Is(err, ErrSyncLimitExceeded) {
+		return nil, err
+	}
+	res := &ProviderSyncResult{
+		Provider: provider,
+		Head:     headCid,
+		Height:   e.syncedHeight(ctx, headCid, synced),
+		Synced:   synced,
+	}
+	return res, err
+}
+
+// syncedHeight returns the number of metadatas of synced linked from head.
+func (e *Engine) syncedHeight(ctx context.Context, head cid.Cid, synced []cid.Cid) int {
+	in := make(map[cid.Cid]struct{}, len(synced))
+	for _, c := range synced {
+		in[c] = struct{}{}
+	}
+	height := 0
+	for c := head; ; {
+		if _, ok := in[c]; !ok {
+			return height
+		}
+		// a metadata linking back to one already counted ends the count.
+		delete(in, c)
+		meta, err := e.loadMetadata(ctx, c)
+		if err != nil {
+			return height
+		}
+		height++
+		if meta.PreviousID == nil {
+			return height
+		}
+		prev, ok := (*meta.PreviousID).(cidlink.Link)
+		if !ok {
+			return height
+		}
+		c = prev.Cid
+	}
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	sc "pandoClient/pkg/schema"
+)
+
+type (
+	// PublishOption sets a per-call parameter of Publish and its variants.
+	PublishOption func(*publishOptions)
+
+	publishOptions struct {
+		extraGossipData    []byte
+		hasExtraGossipData bool
+		skipCheck          bool
+		previous           cid.Cid
+		hasPrevious        bool
+		topic              string
+		async              bool
+		linkProto          *cidlink.LinkPrototype
+		payloadType        string
+		force              bool
+		labels             []string
+		schemaVersion      sc.Version
+		contentType        string
+		chunking           *sc.Chunking
+	}
+)
+
+func newPublishOptions(o ...PublishOption) *publishOptions {
+	opts := &publishOptions{}
+	for _, apply := range o {
+		apply(opts)
+	}
+	return opts
+}
+
+// linkPrototype returns the link prototype metadatas are stored with, defaultProto unless set
+// by WithLinkPrototype.
+func (o *publishOptions) linkPrototype(defaultProto cidlink.LinkPrototype) cidlink.LinkPrototype {
+	if o.linkProto != nil {
+		return *o.linkProto
+	}
+	return defaultProto
+}
+
+// versionedPayload returns payload with the schema version of the publish.
+func (o *publishOptions) versionedPayload(payload datamodel.Node) (datamodel.Node, error) {
+	version := o.schemaVersion
+	if version == 0 && o.contentType != "" {
+		version = sc.V2
+	}
+	switch version {
+	case 0, sc.V1:
+		return payload, nil
+	case sc.V2:
+	default:
+		return nil, fmt.Errorf("%w: %d", sc.ErrUnsupportedVersion, version)
+	}
+	p := &sc.Payload{Version: sc.V2, ContentType: o.contentType, Chunking: o.chunking, Data: payload}
+	if len(o.labels) != 0 {
+		p.Labels = make(map[string]string, len(o.labels))
+		for _, l := range o.labels {
+			key, value, err := parseLabel(l)
+			if err != nil {
+				return nil, err
+			}
+			p.Labels[key] = value
+		}
+	}
+	return sc.EncodePayloadV2(p)
+}
+
+// WithAnnounceExtraData overrides the extra data included in the pubsub announcement of this
+// publish only. The engine-wide extra data set by WithExtraGossipData or
+// Engine.SetExtraGossipData is left untouched.
+//
+// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher.
+func WithAnnounceExtraData(extraData []byte) PublishOption {
+	return func(o *publishOptions) {
+		o.extraGossipData = make([]byte, len(extraData))
+		copy(o.extraGossipData, extraData)
+		o.hasExtraGossipData = true
+	}
+}
+
+// WithSkipCheck does not add the published metadata to the check registry, so that its
+// inclusion in Pando is neither checked nor republished.
+func WithSkipCheck() PublishOption {
+	return func(o *publishOptions) {
+		o.skipCheck = true
+	}
+}
+
+// WithPreviousLink links the built metadata to previous instead of the latest published one,
+// cid.Undef to start a new chain.
+//
+// Note that this option only takes effect with the variants building the metadata, such as
+// PublishBytesData. Publish uses the previous link of the given metadata.
+func WithPreviousLink(previous cid.Cid) PublishOption {
+	return func(o *publishOptions) {
+		o.previous = previous
+		o.hasPrevious = true
+	}
+}
+
+// WithAnnounceTopic announces this publish on the gossipsub topic name instead of the engine
+// topic. The topic is joined on first use and left on Shutdown.
+//
+// Note that this option only takes effect if the PublisherKind is set to DataTransferPublisher
+// or DualPublisher, and the pubsub router is owned by the engine, i.e. WithTopic is not used.
+func WithAnnounceTopic(name string) PublishOption {
+	return func(o *publishOptions) {
+		o.topic = name
+	}
+}
+
+// WithAsyncAnnounce returns as soon as the metadata is stored: the announcement is queued and
+// made in the background by the announce queue, in publish order, on the default chain and the
+// named ones alike. It is retried with the RetryAnnounce policy, then on every flush of the
+// queue until it succeeds, and the metadata is added to the check list once announced.
+// See: Engine.QueuedAnnounces.
+func WithAsyncAnnounce() PublishOption {
+	return func(o *publishOptions) {
+		o.async = true
+	}
+}
+
+// WithLinkPrototype stores the metadata with lp instead of the link prototype of the engine set
+// by WithLinkHash and WithLinkCodec.
+func WithLinkPrototype(lp cidlink.LinkPrototype) PublishOption {
+	return func(o *publishOptions) {
+		o.linkProto = &lp
+	}
+}
+
+// WithPayloadType validates the payload against the schema registered for payloadType before
+// publishing it, the publish fails with ErrInvalidPayload if it does not match.
+//
+// Note that this option only takes effect with the variants building the metadata from data,
+// such as PublishBytesData and PublishCborData.
+// See: Engine.RegisterPayloadSchema.
+func WithPayloadType(payloadType string) PublishOption {
+	return func(o *publishOptions) {
+		o.payloadType = payloadType
+	}
+}
+
+// WithForce publishes the payload even if it is already published and dedupe is enabled.
+// See: WithDedupe.
+func WithForce() PublishOption {
+	return func(o *publishOptions) {
+		o.force = true
+	}
+}
+
+// WithLabels attaches the labels, each in the key=value form, to the published metadata. The
+// labels are indexed locally, they are only part of the metadata with the v2 schema.
+// See: Engine.FindByLabel, WithSchemaVersion.
+func WithLabels(labels ...string) PublishOption {
+	return func(o *publishOptions) {
+		o.labels = append(o.labels, labels...)
+	}
+}
+
+// WithSchemaVersion publishes the payload with the schema version v: schema.V2 wraps it in an
+// envelope with the content type, the labels and the chunking of the publish, schema.V1 keeps
+// it as is.
+//
+// Note that this option only takes effect with the variants building the metadata from data,
+// such as PublishBytesData and PublishCborData.
+// See: schema.DecodePayload.
+func WithSchemaVersion(v sc.Version) PublishOption {
+	return func(o *publishOptions) {
+		o.schemaVersion = v
+	}
+}
+
+// WithContentType records the MIME type of the payload in its v2 envelope, so that
+// Engine.CatContent serves it with its type. The payload is published with the v2 schema unless
+// an other version is set by WithSchemaVersion, with which the content type is dropped.
+// See: WithSchemaVersion.
+func WithContentType(contentType string) PublishOption {
+	return func(o *publishOptions) {
+		o.contentType = contentType
+	}
+}
+
+// WithChunking sets how the data of the payload is chunked in its v2 envelope.
+// See: WithSchemaVersion.
+func WithChunking(chunking sc.Chunking) PublishOption {
+	return func(o *publishOptions) {
+		o.chunking = &chunking
+	}
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQuotaWindow = 24 * time.Hour
+	// quotaBuckets is the number of buckets the usage of the quota window is counted in, the
+	// window rolls by one bucket at a time.
+	quotaBuckets = 60
+)
+
+var dsQuotaUsageKey = datastore.NewKey("sync/meta/quotaUsage")
+
+// QuotaUsage is the usage of the publish quota over its rolling window.
+type QuotaUsage struct {
+	Window time.Duration
+	// Entries is the number of metadatas published in the window, on all the chains, and Bytes the
+	// size of their blocks, without the blocks they link to.
+	Entries int
+	Bytes   int64
+	// MaxEntries and MaxBytes are the quotas enforced, zero if not.
+	MaxEntries int   `json:",omitempty"`
+	MaxBytes   int64 `json:",omitempty"`
+}
+
+// QuotaExceededError is returned by the publishes that would exceed the publish quota.
+type QuotaExceededError struct {
+	// Limit is the exceeded quota, "entries" or "bytes", Max its value and Used the usage of the
+	// window before the publish.
+	Limit  string
+	Max    int64
+	Used   int64
+	Window time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %d %s published in the last %s, at most %d", ErrQuotaExceeded, e.Used, e.Limit, e.Window, e.Max)
+}
+
+// Is makes QuotaExceededError match ErrQuotaExceeded.
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+type quotaBucket struct {
+	Start   time.Time
+	Entries int
+	Bytes   int64
+}
+
+// publishQuota counts the metadatas published in the buckets of the rolling window, oldest
+// first.
+type publishQuota struct {
+	mutex   sync.Mutex
+	buckets []quotaBucket
+}
+
+// pruneQuota drops the buckets out of the window at now, e.quota.mutex must be held.
+func (e *Engine) pruneQuota(now time.Time) {
+	bucket := e.quotaWindow / quotaBuckets
+	q := e.quota
+	i := 0
+	for i < len(q.buckets) && !q.buckets[i].Start.Add(bucket).After(now.Add(-e.quotaWindow)) {
+		i++
+	}
+	q.buckets = q.buckets[i:]
+}
+
+// PublishQuota returns the usage of the publish quota.
+// See: WithPublishQuota.
+func (e *Engine) PublishQuota() *QuotaUsage {
+	e.quota.mutex.Lock()
+	defer e.quota.mutex.Unlock()
+	e.pruneQuota(e.clock.Now())
+	return e.quotaUsage()
+}
+
+// quotaUsage returns the usage of the buckets, e.quota.mutex must be held.
+func (e *Engine) quotaUsage() *QuotaUsage {
+	u := &QuotaUsage{Window: e.quotaWindow, MaxEntries: e.quotaMaxEntries, MaxBytes: e.quotaMaxBytes}
+	for _, b := range e.quota.buckets {
+		u.Entries += b.Entries
+		u.Bytes += b.Bytes
+	}
+	return u
+}
+
+// reserveQuota counts a metadata block of size bytes in the window and persists the usage, or
+// fails with a *QuotaExceededError if it would exceed the publish quota. The usage is checked and
+// counted at once, so that concurrent publishes on different chains do not exceed the quota
+// together. The returned func releases the reservation, if the block fails to be stored.
+// Persistence failures are only logged, the usage is persisted again on the next publish.
+func (e *Engine) reserveQuota(ctx context.Context, size int64) (func(), error) {
+	q := e.quota
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := e.clock.Now()
+	e.pruneQuota(now)
+	u := e.quotaUsage()
+	if e.quotaMaxEntries > 0 && u.Entries+1 > e.quotaMaxEntries {
+		return nil, &QuotaExceededError{Limit: "entries", Max: int64(e.quotaMaxEntries), Used: int64(u.Entries), Window: e.quotaWindow}
+	}
+	if e.quotaMaxBytes > 0 && u.Bytes+size > e.quotaMaxBytes {
+		return nil, &QuotaExceededError{Limit: "bytes", Max: e.quotaMaxBytes, Used: u.Bytes, Window: e.quotaWindow}
+	}
+
+	start := now.Truncate(e.quotaWindow / quotaBuckets)
+	if n := len(q.buckets); n == 0 || !q.buckets[n-1].Start.Equal(start) {
+		q.buckets = append(q.buckets, quotaBucket{Start: start})
+	}
+	last := &q.buckets[len(q.buckets)-1]
+	last.Entries++
+	last.Bytes += size
+	e.persistQuotaUsage(ctx)
+	return func() { e.releaseQuota(ctx, start, size) }, nil
+}
+
+// releaseQuota uncounts a metadata block of size bytes reserved in the bucket started at start,
+// unless the bucket is out of the window already.
+func (e *Engine) releaseQuota(ctx context.Context, start time.Time, size int64) {
+	q := e.quota
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i := range q.buckets {
+		if q.buckets[i].Start.Equal(start) {
+			q.buckets[i].Entries--
+			q.buckets[i].Bytes -= size
+			e.persistQuotaUsage(ctx)
+			return
+		}
+	}
+}
+
+// persistQuotaUsage persists the buckets, e.quota.mutex must be held.
+func (e *Engine) persistQuotaUsage(ctx context.Context) {
+	b, err := json.Marshal(e.quota.buckets)
+	if err != nil {
+		logger.Warnw("Failed to encode publish quota usage", "err", err)
+		return
+	}
+	if err = e.ds.Put(ctx, dsQuotaUsageKey, b); err != nil {
+		logger.Warnw("Failed to persist publish quota usage", "err", err)
+	}
+}
+
+func (e *Engine) loadQuotaUsage(ctx context.Context) error {
+	e.quota = &publishQuota{}
+	b, err := e.ds.Get(ctx, dsQuotaUsageKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &e.quota.buckets)
+}
+
+// encodedSize returns the size of the block of n encoded with lp.
+func (e *Engine) encodedSize(n datamodel.Node, lp cidlink.LinkPrototype) (int64, error) {
+	encode, err := e.lsys.EncoderChooser(lp)
+	if err != nil {
+		return 0, err
+	}
+	var w countingWriter
+	if err = encode(n, &w); err != nil {
+		return 0, err
+	}
+	return int64(w), nil
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+)
+
+// Receipt tells what happened to a publish: its history entry, with the times it was stored,
+// announced and included and the announcement topic and failure, completed with where it is in
+// its lifecycle now.
+type Receipt struct {
+	HistoryEntry
+	// Queued tells whether the announcement waits in the announce queue.
+	Queued bool
+	// Pending tells whether the inclusion is checked by the check list of the chain.
+	Pending bool
+	// DeadLetter is set once the metadata is moved to the dead-letter list.
+	DeadLetter *DeadLetter `json:",omitempty"`
+}
+
+// PublishWithReceipt publishes metadata like Publish and returns the receipt of the publish, the
+// one of the metadata already publishing the payload if it is skipped as a duplicate.
+// See: Engine.GetReceipt.
+func (e *Engine) PublishWithReceipt(ctx context.Context, metadata schema.Metadata, o ...PublishOption) (*Receipt, error) {
+	c, err := e.Publish(ctx, metadata, o...)
+	if err != nil {
+		return nil, err
+	}
+	return e.GetReceipt(ctx, c)
+}
+
+// GetReceipt returns the receipt of the publish of c, on any chain, from the persisted publish
+// history. ErrNoReceipt is returned if c was not published by the engine, or by a version not
+// recording the history.
+func (e *Engine) GetReceipt(ctx context.Context, c cid.Cid) (*Receipt, error) {
+	entry := e.historyEntry(ctx, c)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoReceipt, c)
+	}
+	if err := e.annotateEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	r := &Receipt{
+		HistoryEntry: *entry,
+		Queued:       e.isQueuedAnnounce(c),
+	}
+	for _, cr := range e.checkRegistries() {
+		if cr.has(c) {
+			r.Pending = true
+			break
+		}
+	}
+	dl, err := e.getDeadLetter(ctx, c)
+	if err != nil && !errors.Is(err, ErrNotDeadLettered) {
+		return nil, err
+	}
+	r.DeadLetter = dl
+	return r, nil
+}
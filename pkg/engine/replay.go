@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+)
+
+const (
+	// ReplayNone does not announce metadatas that were published while announcements were
+	// disabled. They are only reported in the logs.
+	ReplayNone ReplayMode = ""
+
+	// ReplayHead announces the latest metadata only, consumers sync the rest of the chain
+	// from it.
+	ReplayHead ReplayMode = "head"
+
+	// ReplayAll announces every never-announced metadata in the order they were published.
+	ReplayAll ReplayMode = "all"
+)
+
+var (
+	dsLastAnnouncedKey = datastore.NewKey("sync/meta/announced")
+	// dsPublishingKey is set while a metadata is published with a publisher, until it is
+	// announced or queued. It is left over by publishes interrupted by a crash.
+	dsPublishingKey = datastore.NewKey("sync/meta/publishing")
+)
+
+// ReplayMode represents how metadatas stored locally but never announced, e.g. published while
+// running with NoPublisher, are handled when the engine starts with a publisher.
+// See: WithReplayUnannounced.
+type ReplayMode string
+
+// markAnnounced records c as the latest announced metadata if it is the head of the chain.
+func (e *Engine) markAnnounced(ctx context.Context, c cid.Cid) error {
+	if !c.Equals(e.getLatestMeta(ctx)) {
+		return nil
+	}
+	return e.ds.Put(ctx, dsLastAnnouncedKey, c.Bytes())
+}
+
+func (e *Engine) getLastAnnounced(ctx context.Context) (cid.Cid, error) {
+	c, _, err := e.recordedLastAnnounced(ctx)
+	return c, err
+}
+
+// recordedLastAnnounced returns the latest announced metadata, cid.Undef if none was announced, and
+// whether it is recorded at all.
+func (e *Engine) recordedLastAnnounced(ctx context.Context) (cid.Cid, bool, error) {
+	b, err := e.ds.Get(ctx, dsLastAnnouncedKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return cid.Undef, false, nil
+		}
+		return cid.Undef, false, err
+	}
+	if len(b) == 0 {
+		return cid.Undef, true, nil
+	}
+	_, c, err := cid.CidFromBytes(b)
+	return c, true, err
+}
+
+// initLastAnnounced records head as the latest announced metadata if none is recorded, e.g. on
+// the first start or for the datastores written before the announced metadatas were recorded:
+// whether the metadatas published until then were announced is unknown, they are not replayed.
+func (e *Engine) initLastAnnounced(ctx context.Context, head cid.Cid) error {
+	exist, err := e.ds.Has(ctx, dsLastAnnouncedKey)
+	if err != nil || exist {
+		return err
+	}
+	b := []byte{}
+	if head.Defined() {
+		b = head.Bytes()
+	}
+	return e.ds.Put(ctx, dsLastAnnouncedKey, b)
+}
+
+// unannounced returns the locally published metadatas after the last announced one, oldest
+// first. Nothing is returned if the last announced metadata is not recorded or is no longer in
+// the pushed cid list, e.g. rolled back.
+func (e *Engine) unannounced(ctx context.Context) ([]cid.Cid, error) {
+	last, recorded, err := e.recordedLastAnnounced(ctx)
+	if err != nil || !recorded {
+		return nil, err
+	}
+	if !last.Defined() {
+		return e.pushList, nil
+	}
+	for i := len(e.pushList) - 1; i >= 0; i-- {
+		if e.pushList[i].Equals(last) {
+			return e.pushList[i+1:], nil
+		}
+	}
+	return nil, nil
+}
+
+// replayUnannounced announces the metadatas that were never announced according to the replay
+// mode. It must be called once the publisher is instantiated.
+func (e *Engine) replayUnannounced(ctx context.Context) error {
+	if e.publisher == nil || e.hasQueuedAnnounces() {
+		// queued announcements are flushed by the announce queue.
+		return nil
+	}
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+
+	cids, err := e.unannounced(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get never announced metadatas: %w", err)
+	}
+	if len(cids) == 0 {
+		return nil
+	}
+
+	switch e.replayMode {
+	case ReplayNone:
+		logger.Warnw("Metadatas were never announced, they are only stored locally", "count", len(cids), "head", e.getLatestMeta(ctx))
+		return nil
+	case ReplayHead:
+		cids = cids[len(cids)-1:]
+	case ReplayAll:
+	default:
+		return fmt.Errorf("unknown replay mode: %s", e.replayMode)
+	}
+
+	logger.Infow("Replaying never announced metadatas", "mode", e.replayMode, "count", len(cids))
+	extraData := e.extraGossipData(nil)
+	for i, c := range cids {
+		if err = e.announce(ctx, c, extraData); err != nil {
+			logger.Warnw("Failed to replay metadata, queue it with the rest", "cid", c, "err", err)
+			return e.enqueueReplay(ctx, cids[i:], extraData)
+		}
+		if err = e.cr.addCheck(c); err != nil {
+			logger.Errorf("failed to add cid: %s to check list, err: %v", c.String(), err)
+		}
+	}
+	return nil
+}
+
+// enqueueReplay queues the announcements of the never announced metadatas cids, announced by
+// the announce queue once a peer is reachable.
+func (e *Engine) enqueueReplay(ctx context.Context, cids []cid.Cid, extraData []byte) error {
+	for _, c := range cids {
+		if err := e.enqueueAnnounce(ctx, queuedAnnounce{Cid: c, ExtraData: extraData}); err != nil {
+			return fmt.Errorf("failed to queue replayed metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// beginPublish records that a metadata is about to be stored and announced, so that the
+// announcement is recovered at the next Start if the process stops in between.
+func (e *Engine) beginPublish(ctx context.Context) error {
+	return e.ds.Put(ctx, dsPublishingKey, []byte{})
+}
+
+// endPublish records that the published metadata was announced or queued to be.
+func (e *Engine) endPublish(ctx context.Context) {
+	if err := e.ds.Delete(ctx, dsPublishingKey); err != nil {
+		logger.Warnw("Failed to clear interrupted publish marker", "err", err)
+	}
+}
+
+// recoverInterruptedPublish re-announces the latest metadata if a publish was interrupted after
+// the metadata was stored but before it was announced or queued, e.g. by a crash, whatever the
+// replay mode: the metadatas published while the publisher was disabled are left to
+// replayUnannounced. It must be called once the publisher is instantiated.
+func (e *Engine) recoverInterruptedPublish(ctx context.Context) error {
+	if e.publisher == nil {
+		// the marker is kept for the next start with a publisher.
+		return nil
+	}
+	interrupted, err := e.ds.Has(ctx, dsPublishingKey)
+	if err != nil {
+		return fmt.Errorf("failed to check interrupted publishes: %w", err)
+	}
+	if !interrupted {
+		return nil
+	}
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+
+	head := e.getLatestMeta(ctx)
+	last, err := e.getLastAnnounced(ctx)
+	if err != nil {
+		return err
+	}
+	if !head.Defined() || head.Equals(last) || e.isQueuedAnnounce(head) {
+		e.endPublish(ctx)
+		return nil
+	}
+
+	log := logger.With("metaCid", head, "lastAnnounced", last)
+	log.Warn("Publish was interrupted before the metadata was announced, re-announcing it")
+	qa := queuedAnnounce{Cid: head, ExtraData: e.extraGossipData(nil)}
+	// queued announcements go first to keep the order.
+	if !e.hasQueuedAnnounces() {
+		if err = e.announce(ctx, head, qa.ExtraData); err == nil {
+			if err = e.cr.addCheck(head); err != nil {
+				log.Errorf("failed to add cid: %s to check list, err: %v", head.String(), err)
+			}
+			e.endPublish(ctx)
+			return nil
+		}
+		log.Warnw("Failed to re-announce interrupted publish, queue it", "err", err)
+	}
+	if err = e.enqueueAnnounce(ctx, qa); err != nil {
+		return fmt.Errorf("failed to queue interrupted publish: %w", err)
+	}
+	e.endPublish(ctx)
+	return nil
+}
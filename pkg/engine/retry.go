@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"pandoClient/pkg/retry"
+	"time"
+)
+
+// RetryComponent names a component of the engine calling remote peers, retried according to its
+// own policy.
+// See: WithRetryPolicy.
+type RetryComponent string
+
+const (
+	// RetryPandoAPI retries the requests to the Pando API.
+	RetryPandoAPI RetryComponent = "pandoapi"
+	// RetryAnnounce retries the announcements of published metadatas, including the flushes of
+	// the announce queue. While its circuit breaker is open publishes are queued right away.
+	RetryAnnounce RetryComponent = "announce"
+	// RetrySync retries the syncs with Pando and the followed providers.
+	RetrySync RetryComponent = "sync"
+)
+
+// DefaultRetryPolicy returns the retry policy of component used unless set by WithRetryPolicy.
+func DefaultRetryPolicy(component RetryComponent) retry.Policy {
+	switch component {
+	case RetryAnnounce:
+		// failed announcements are queued anyway, keep publishes responsive.
+		return retry.Policy{
+			MaxAttempts:      3,
+			InitialBackoff:   200 * time.Millisecond,
+			MaxBackoff:       2 * time.Second,
+			Multiplier:       2,
+			Jitter:           0.2,
+			BreakerThreshold: 5,
+			BreakerCooldown:  defaultAnnounceFlushInterval,
+		}
+	default:
+		// the sync retrier is shared by all the providers, so it has no circuit breaker.
+		return retry.DefaultPolicy
+	}
+}
+
+func (e *Engine) initRetriers() error {
+	var err error
+	if e.apiRetry, err = retry.New(string(RetryPandoAPI), e.retryPolicy(RetryPandoAPI)); err != nil {
+		return err
+	}
+	if e.announceRetry, err = retry.New(string(RetryAnnounce), e.retryPolicy(RetryAnnounce)); err != nil {
+		return err
+	}
+	if e.syncRetry, err = retry.New(string(RetrySync), e.retryPolicy(RetrySync)); err != nil {
+		return err
+	}
+	if e.pandoAPI != nil {
+		e.pandoAPI.SetRetrier(e.apiRetry)
+	}
+	return nil
+}
+
+func (e *Engine) retryPolicy(component RetryComponent) retry.Policy {
+	if p, ok := e.retryPolicies[component]; ok {
+		return p
+	}
+	return DefaultRetryPolicy(component)
+}
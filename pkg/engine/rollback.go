@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+)
+
+// Rollback resets the head of the default chain to to, a metadata pushed earlier, e.g. to
+// recover from bad publishes: the metadatas pushed after it are dropped from the pushed cid list,
+// the check list, the announce queue, the payload and label indexes, and the latest metadata is
+// set to to and announced, or queued to be if the announcement fails. It returns the cids rolled
+// back, oldest first. ErrNotPushed is returned if to is not pushed on the default chain.
+//
+// Pando may have synced the rolled back metadatas already, the next publishes link to to and
+// fork the chain from there.
+func (e *Engine) Rollback(ctx context.Context, to cid.Cid) ([]cid.Cid, error) {
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	if err := e.checkFrozen(); err != nil {
+		return nil, err
+	}
+
+	i := len(e.pushList) - 1
+	for i >= 0 && !e.pushList[i].Equals(to) {
+		i--
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotPushed, to)
+	}
+	rolledBack := append([]cid.Cid(nil), e.pushList[i+1:]...)
+	if len(rolledBack) == 0 {
+		return rolledBack, nil
+	}
+	if err := e.updateLatestMeta(ctx, to); err != nil {
+		return nil, fmt.Errorf("failed to update reference to latest metadata: %w", err)
+	}
+	if err := e.updatePushedList(ctx, append([]cid.Cid(nil), e.pushList[:i+1]...)); err != nil {
+		return nil, fmt.Errorf("failed to update pushed cid list: %w", err)
+	}
+	e.appendAuditLog(ctx, AuditRollback, to, "")
+	logger.Infow("Rolled back latest metadata", "head", to, "rolledBack", len(rolledBack))
+
+	dropped := make(map[cid.Cid]struct{}, len(rolledBack))
+	for _, c := range rolledBack {
+		dropped[c] = struct{}{}
+	}
+	if err := e.cr.removeChecks(ctx, rolledBack); err != nil {
+		return nil, fmt.Errorf("failed to remove rolled back metadatas from check list: %w", err)
+	}
+	if err := e.dropQueuedAnnounces(ctx, dropped); err != nil {
+		return nil, fmt.Errorf("failed to remove rolled back metadatas from announce queue: %w", err)
+	}
+	idx := e.payloadIndex()
+	for _, c := range rolledBack {
+		meta, err := e.loadMetadata(ctx, c)
+		if err != nil {
+			// included in Pando and deleted, its payload is still published.
+			continue
+		}
+		if err = idx.unindex(ctx, meta.Payload, c); err != nil {
+			logger.Warnw("Failed to unindex payload of rolled back metadata", "cid", c, "err", err)
+		}
+	}
+	if err := e.unindexLabels(ctx, dropped); err != nil {
+		logger.Warnw("Failed to unindex labels of rolled back metadatas", "err", err)
+	}
+
+	if e.publisher != nil {
+		qa := queuedAnnounce{Cid: to, ExtraData: e.extraGossipData(nil), SkipCheck: true}
+		if err := e.announceOrEnqueue(ctx, qa); err != nil {
+			return rolledBack, fmt.Errorf("rolled back but failed to queue announcement of new head: %w", err)
+		}
+	}
+	return rolledBack, nil
+}
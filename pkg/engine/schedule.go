@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"os"
+	"os/exec"
+	"pandoClient/pkg/cron"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobTimeout = time.Minute
+
+	// JobAnnotation is the local annotation holding the name of the job that published a
+	// metadata.
+	JobAnnotation = "job"
+)
+
+var dsJobsKey = datastore.NewKey("sync/jobs")
+
+// JobSpec describes a publish job run on a cron schedule. Exactly one of Command and File is
+// set.
+type JobSpec struct {
+	// Name identifies the job, it can not contain slashes.
+	Name string
+	// Schedule is a cron expression such as "0 * * * *", or a descriptor such as "@hourly" or
+	// "@every 30m". See the cron package for the syntax.
+	Schedule string
+	// Command is run with sh -c, its standard output is published.
+	Command string
+	// File is the absolute path of the file whose contents are published.
+	File string
+	// Timeout aborts the runs of Command taking longer. The default is 1m.
+	Timeout time.Duration
+}
+
+// JobStatus is the state of a scheduled job.
+type JobStatus struct {
+	JobSpec
+	// Configured tells whether the job is set with WithPublishJob rather than added with AddJob.
+	Configured bool
+	// Next is the next time the job runs, the zero time if it never does.
+	Next time.Time
+	// LastRun is the time of the last run, LastCid the metadata it published and LastErr its
+	// error if it failed.
+	LastRun time.Time
+	LastCid cid.Cid
+	LastErr string `json:",omitempty"`
+	Runs    int
+}
+
+// Job publishes the output of a command or the contents of a file on a cron schedule.
+type Job struct {
+	e          *Engine
+	spec       JobSpec
+	schedule   *cron.Schedule
+	configured bool
+	// runMutex serializes the runs of the job.
+	runMutex sync.Mutex
+	mutex    sync.Mutex
+	next     time.Time
+	lastRun  time.Time
+	lastCid  cid.Cid
+	lastErr  error
+	runs     int
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+func (e *Engine) jobsDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsJobsKey)
+}
+
+// validate checks the spec and sets its defaults, it returns its parsed schedule.
+func (spec *JobSpec) validate() (*cron.Schedule, error) {
+	if spec.Name == "" || strings.Contains(spec.Name, "/") {
+		return nil, fmt.Errorf("invalid job name %q", spec.Name)
+	}
+	schedule, err := cron.Parse(spec.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule of job %s: %w", spec.Name, err)
+	}
+	if (spec.Command == "") == (spec.File == "") {
+		return nil, fmt.Errorf("job %s must have exactly one of a command and a file", spec.Name)
+	}
+	if spec.File != "" {
+		if spec.File, err = filepath.Abs(spec.File); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Timeout < 0 {
+		return nil, fmt.Errorf("timeout of job %s can not be negative", spec.Name)
+	}
+	if spec.Timeout == 0 {
+		spec.Timeout = defaultJobTimeout
+	}
+	return schedule, nil
+}
+
+// AddJob schedules a publish job: on every time spec.Schedule fires, the output of spec.Command
+// or the contents of spec.File are published as the bytes payload of a metadata annotated with
+// the name of the job. Runs are not retried, a failed run is reported by Jobs until the next
+// one. The job is persisted and resumed by Start until RemoveJob is called.
+func (e *Engine) AddJob(ctx context.Context, spec JobSpec) (*Job, error) {
+	j, err := e.startJob(spec, false)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(j.spec)
+	if err == nil {
+		err = e.jobsDs().Put(ctx, datastore.NewKey(j.spec.Name), b)
+	}
+	if err != nil {
+		e.removeJob(j.spec.Name)
+		j.close()
+		return nil, fmt.Errorf("failed to persist job: %w", err)
+	}
+	return j, nil
+}
+
+func (e *Engine) startJob(spec JobSpec, configured bool) (*Job, error) {
+	schedule, err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{
+		e:          e,
+		spec:       spec,
+		schedule:   schedule,
+		configured: configured,
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	e.jobMutex.Lock()
+	defer e.jobMutex.Unlock()
+	if _, ok := e.jobs[spec.Name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyScheduled, spec.Name)
+	}
+	e.jobs[spec.Name] = j
+	go j.run()
+	logger.Infow("Scheduled publish job", "name", spec.Name, "schedule", spec.Schedule)
+	return j, nil
+}
+
+// RemoveJob stops the job name and no longer resumes it. A job set with WithPublishJob comes
+// back on the next Start unless it is removed from the options too.
+func (e *Engine) RemoveJob(ctx context.Context, name string) error {
+	j := e.removeJob(name)
+	if j == nil {
+		return fmt.Errorf("%w: %s", ErrNotScheduled, name)
+	}
+	j.close()
+	if j.configured {
+		return nil
+	}
+	return e.jobsDs().Delete(ctx, datastore.NewKey(name))
+}
+
+// RunJob runs the job name right away, out of its schedule, and returns the published metadata.
+func (e *Engine) RunJob(ctx context.Context, name string) (cid.Cid, error) {
+	e.jobMutex.Lock()
+	j, ok := e.jobs[name]
+	e.jobMutex.Unlock()
+	if !ok {
+		return cid.Undef, fmt.Errorf("%w: %s", ErrNotScheduled, name)
+	}
+	return j.Run(ctx)
+}
+
+// Jobs returns the status of the scheduled jobs.
+func (e *Engine) Jobs() []JobStatus {
+	e.jobMutex.Lock()
+	defer e.jobMutex.Unlock()
+	statuses := make([]JobStatus, 0, len(e.jobs))
+	for _, j := range e.jobs {
+		statuses = append(statuses, j.Status())
+	}
+	return statuses
+}
+
+func (e *Engine) removeJob(name string) *Job {
+	e.jobMutex.Lock()
+	defer e.jobMutex.Unlock()
+	j, ok := e.jobs[name]
+	if !ok {
+		return nil
+	}
+	delete(e.jobs, name)
+	return j
+}
+
+// resumeJobs starts the jobs set with WithPublishJob, then the ones persisted by AddJob.
+func (e *Engine) resumeJobs(ctx context.Context) error {
+	for _, spec := range e.publishJobs {
+		if _, err := e.startJob(spec, true); err != nil {
+			return err
+		}
+	}
+
+	res, err := e.jobsDs().Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var spec JobSpec
+		if err = json.Unmarshal(r.Value, &spec); err != nil {
+			return err
+		}
+		if _, err = e.startJob(spec, false); err != nil {
+			logger.Errorw("Failed to resume job", "name", spec.Name, "err", err)
+		}
+	}
+	return nil
+}
+
+// closeJobs stops the scheduled jobs on shutdown, they are resumed on the next Start.
+func (e *Engine) closeJobs() {
+	e.jobMutex.Lock()
+	jobs := e.jobs
+	e.jobs = make(map[string]*Job)
+	e.jobMutex.Unlock()
+	for _, j := range jobs {
+		j.close()
+	}
+}
+
+// Status returns the state of the job.
+func (j *Job) Status() JobStatus {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	s := JobStatus{
+		JobSpec:    j.spec,
+		Configured: j.configured,
+		Next:       j.next,
+		LastRun:    j.lastRun,
+		LastCid:    j.lastCid,
+		Runs:       j.runs,
+	}
+	if j.lastErr != nil {
+		s.LastErr = j.lastErr.Error()
+	}
+	return s
+}
+
+// Run runs the job right away and returns the published metadata.
+func (j *Job) Run(ctx context.Context) (cid.Cid, error) {
+	j.runMutex.Lock()
+	defer j.runMutex.Unlock()
+	start := time.Now()
+	c, err := j.publish(ctx)
+
+	j.mutex.Lock()
+	j.lastRun, j.lastCid, j.lastErr = start, c, err
+	j.runs++
+	j.mutex.Unlock()
+	if err != nil {
+		logger.Errorw("Failed to run publish job", "name", j.spec.Name, "err", err)
+		return cid.Undef, err
+	}
+	logger.Infow("Published job output", "name", j.spec.Name, "cid", c)
+	return c, nil
+}
+
+func (j *Job) publish(ctx context.Context) (cid.Cid, error) {
+	data, err := j.output(ctx)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if len(data) == 0 {
+		return cid.Undef, fmt.Errorf("job produced no data")
+	}
+	c, err := j.e.PublishBytesData(ctx, data)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err = j.e.Annotate(ctx, c, JobAnnotation, j.spec.Name); err != nil {
+		logger.Warnw("Failed to annotate job output", "name", j.spec.Name, "cid", c, "err", err)
+	}
+	return c, nil
+}
+
+func (j *Job) output(ctx context.Context) ([]byte, error) {
+	if j.spec.File != "" {
+		return os.ReadFile(j.spec.File)
+	}
+	ctx, cancel := context.WithTimeout(ctx, j.spec.Timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "sh", "-c", j.spec.Command).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("command failed: %w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("command failed: %w", err)
+	}
+	return out, nil
+}
+
+func (j *Job) run() {
+	defer close(j.done)
+	for {
+		next := j.schedule.Next(time.Now())
+		j.mutex.Lock()
+		j.next = next
+		j.mutex.Unlock()
+		if next.IsZero() {
+			logger.Warnw("Publish job never runs", "name", j.spec.Name, "schedule", j.spec.Schedule)
+			<-j.closing
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-j.closing:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-j.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		_, _ = j.Run(ctx)
+		cancel()
+	}
+}
+
+func (j *Job) close() {
+	close(j.closing)
+	<-j.done
+}
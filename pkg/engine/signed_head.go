@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/filecoin-project/go-legs/httpsync"
+	maurl "github.com/filecoin-project/go-legs/httpsync/multiaddr"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"io"
+	"net/http"
+	"path"
+	"time"
+)
+
+// signedHeadTimeout bounds the fetch of a signed head.
+const signedHeadTimeout = 10 * time.Second
+
+// maxSignedHeadSize bounds the size of the signed heads read, a few hundred bytes in practice.
+const maxSignedHeadSize = 64 << 10
+
+// SignedHead is the head of an httpsync publisher, verified against the signature of its signer.
+type SignedHead struct {
+	Head   cid.Cid
+	Signer peer.ID
+}
+
+// signedHeadEnvelope is the signed head served by httpsync publishers on /head.
+// See: httpsync.SignedHeadSchema.
+type signedHeadEnvelope struct {
+	Head   cidlink.Link
+	Sig    []byte
+	Pubkey []byte
+}
+
+// FetchSignedHead fetches the signed head of the httpsync publisher at addr, e.g. another
+// provider or Pando, and verifies its signature, so that the head is a trusted root to sync
+// from. If signer is not empty the head must be signed by it, otherwise any valid signature is
+// accepted and the signer is returned for the caller to check. Heads that are not validly
+// signed fail with ErrInvalidSignedHead, the ones of another signer with ErrUnexpectedSigner.
+func (e *Engine) FetchSignedHead(ctx context.Context, addr multiaddr.Multiaddr, signer peer.ID) (*SignedHead, error) {
+	u, err := maurl.ToURL(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid httpsync address %s: %w", addr, err)
+	}
+	u.Path = path.Join(u.Path, "head")
+	ctx, cancel := context.WithTimeout(ctx, signedHeadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch head from %s: %w", addr, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		// publishers without head fail to sign it.
+		return nil, fmt.Errorf("failed to fetch head from %s: unexpected status %s", addr, res.Status)
+	}
+
+	head, err := openSignedHead(io.LimitReader(res.Body, maxSignedHeadSize))
+	if err != nil {
+		return nil, err
+	}
+	if signer != "" && head.Signer != signer {
+		return nil, fmt.Errorf("%w: head of %s is signed by %s, not %s", ErrUnexpectedSigner, addr, head.Signer, signer)
+	}
+	logger.Infow("Fetched signed head", "addr", addr, "head", head.Head, "signer", head.Signer)
+	return head, nil
+}
+
+// openSignedHead decodes the signed head r and verifies it with the public key it includes.
+func openSignedHead(r io.Reader) (*SignedHead, error) {
+	nb := bindnode.Prototype((*signedHeadEnvelope)(nil), httpsync.SignedHeadSchema()).NewBuilder()
+	if err := dagjson.Decode(nb, r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignedHead, err)
+	}
+	env := bindnode.Unwrap(nb.Build()).(*signedHeadEnvelope)
+	pubKey, err := crypto.UnmarshalPublicKey(env.Pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid public key: %v", ErrInvalidSignedHead, err)
+	}
+	ok, err := pubKey.Verify(env.Head.Bytes(), env.Sig)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("%w: invalid signature", ErrInvalidSignedHead)
+	}
+	id, err := peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignedHead, err)
+	}
+	return &SignedHead{Head: env.Head.Cid, Signer: id}, nil
+}
@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"pandoClient/pkg/pandoapi"
+)
+
+var (
+	dsSnapshotsKey      = datastore.NewKey("sync/snapshots")
+	dsSnapshotOfKey     = datastore.NewKey("sync/meta/snapshotOf")
+	dsLatestSnapshotKey = datastore.NewKey("sync/meta/latestSnapshot")
+)
+
+// SnapshotInclusion tells which snapshot of Pando a published metadata landed in.
+type SnapshotInclusion struct {
+	SnapshotCid cid.Cid
+	Height      uint64
+}
+
+func (e *Engine) snapshotsDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsSnapshotsKey)
+}
+
+func (e *Engine) snapshotOfDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsSnapshotOfKey)
+}
+
+// SyncSnapshots fetches the snapshots of Pando not synced yet, stores them locally and records
+// the snapshot each of the pushed metadatas landed in. It returns the number of new snapshots.
+func (e *Engine) SyncSnapshots(ctx context.Context) (int, error) {
+	e.snapshotMutex.Lock()
+	defer e.snapshotMutex.Unlock()
+
+	e.publishMutex.Lock()
+	pushed := make(map[cid.Cid]struct{}, len(e.pushList))
+	for _, c := range e.pushList {
+		pushed[c] = struct{}{}
+	}
+	e.publishMutex.Unlock()
+	provider := e.h.ID().String()
+
+	synced := 0
+	it := e.pandoAPI.Snapshots()
+	for it.Next(ctx) {
+		snapshotCid := it.Snapshot()
+		key := datastore.NewKey(snapshotCid.String())
+		exist, err := e.snapshotsDs().Has(ctx, key)
+		if err != nil {
+			return synced, err
+		}
+		if exist {
+			continue
+		}
+
+		snapshot, err := e.pandoAPI.Snapshot(ctx, snapshotCid)
+		if err != nil {
+			return synced, fmt.Errorf("failed to get snapshot %s: %w", snapshotCid, err)
+		}
+		if list, ok := snapshot.Update[provider]; ok && list != nil {
+			for _, c := range list.MetaList {
+				if _, ok := pushed[c]; !ok {
+					continue
+				}
+				if err = e.putSnapshotOf(ctx, c, SnapshotInclusion{SnapshotCid: snapshotCid, Height: snapshot.Height}); err != nil {
+					return synced, err
+				}
+			}
+		}
+		b, err := json.Marshal(snapshot)
+		if err != nil {
+			return synced, err
+		}
+		if err = e.snapshotsDs().Put(ctx, key, b); err != nil {
+			return synced, err
+		}
+		if err = e.updateLatestSnapshotHeight(ctx, snapshot.Height); err != nil {
+			return synced, err
+		}
+		synced++
+	}
+	if err := it.Err(); err != nil {
+		return synced, err
+	}
+	if synced != 0 {
+		logger.Infow("Synced Pando snapshots", "count", synced)
+	}
+	return synced, nil
+}
+
+func (e *Engine) putSnapshotOf(ctx context.Context, c cid.Cid, si SnapshotInclusion) error {
+	b, err := json.Marshal(si)
+	if err != nil {
+		return err
+	}
+	return e.snapshotOfDs().Put(ctx, datastore.NewKey(c.String()), b)
+}
+
+// SnapshotOf returns the snapshot of Pando that anchored the published metadata c, so that
+// providers can reference it in their own records, or nil if c is not in any snapshot yet.
+// The snapshots synced with SyncSnapshots are looked up first, then the inclusion of c with
+// GetInclusion, which is served from the inclusion cache if enabled. The snapshots found in Pando
+// are recorded for the next lookups.
+func (e *Engine) SnapshotOf(ctx context.Context, c cid.Cid) (*SnapshotInclusion, error) {
+	si, err := e.syncedSnapshotOf(ctx, c)
+	if err != nil || si != nil {
+		return si, err
+	}
+	inclusion, err := e.GetInclusion(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inclusion of %s: %w", c, err)
+	}
+	if !inclusion.InPando || !inclusion.InSnapShot {
+		return nil, nil
+	}
+	si = &SnapshotInclusion{SnapshotCid: inclusion.SnapShotID, Height: inclusion.SnapShotHeight}
+	if err = e.putSnapshotOf(ctx, c, *si); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+// syncedSnapshotOf returns the synced snapshot the published metadata c landed in, or nil if it
+// is not in any synced snapshot yet.
+func (e *Engine) syncedSnapshotOf(ctx context.Context, c cid.Cid) (*SnapshotInclusion, error) {
+	b, err := e.snapshotOfDs().Get(ctx, datastore.NewKey(c.String()))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var si SnapshotInclusion
+	err = json.Unmarshal(b, &si)
+	return &si, err
+}
+
+// GetSnapshot returns the locally synced snapshot snapshotCid.
+func (e *Engine) GetSnapshot(ctx context.Context, snapshotCid cid.Cid) (*pandoapi.Snapshot, error) {
+	b, err := e.snapshotsDs().Get(ctx, datastore.NewKey(snapshotCid.String()))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, ResourceNotFound
+		}
+		return nil, err
+	}
+	var snapshot pandoapi.Snapshot
+	err = json.Unmarshal(b, &snapshot)
+	return &snapshot, err
+}
+
+// LatestSnapshotHeight returns the height of the latest synced snapshot, false if none is synced.
+func (e *Engine) LatestSnapshotHeight(ctx context.Context) (uint64, bool, error) {
+	b, err := e.ds.Get(ctx, dsLatestSnapshotKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(b), true, nil
+}
+
+func (e *Engine) updateLatestSnapshotHeight(ctx context.Context, height uint64) error {
+	latest, ok, err := e.LatestSnapshotHeight(ctx)
+	if err != nil {
+		return err
+	}
+	if ok && latest >= height {
+		return nil
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, height)
+	return e.ds.Put(ctx, dsLatestSnapshotKey, b)
+}
+
+// followSnapshots polls the snapshot chain of Pando until the engine is shut down.
+func (e *Engine) followSnapshots() {
+	defer close(e.snapshotDone)
+	ticker := e.clock.NewTicker(e.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.SyncSnapshots(context.Background()); err != nil {
+			logger.Warnw("Failed to sync Pando snapshots", "err", err)
+		}
+		select {
+		case <-e.closing:
+			return
+		case <-ticker.Chan():
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ipfs/go-datastore"
+	"pandoClient/pkg/metrics"
+	"sync/atomic"
+)
+
+var dsBlockStatsKey = datastore.NewKey("sync/meta/blockStats")
+
+// blockStats counts the blocks written through the engine link system. It is updated
+// atomically.
+type blockStats struct {
+	Blocks          uint64
+	StoredBytes     uint64
+	DedupHits       uint64
+	DedupBytesSaved uint64
+}
+
+// ChainStats are the statistics of the local chain and of the blocks stored for it.
+type ChainStats struct {
+	// Metadatas is the number of metadatas published locally.
+	Metadatas int
+	// Blocks is the number of distinct blocks written, StoredBytes their total size.
+	Blocks      uint64
+	StoredBytes uint64
+	// DedupHits is the number of blocks written that were already stored, e.g. payload blocks
+	// shared across metadatas, and DedupBytesSaved their total size.
+	DedupHits       uint64
+	DedupBytesSaved uint64
+	// DedupRatio is the share of the written bytes saved by deduplication.
+	DedupRatio float64
+}
+
+func (e *Engine) recordBlockStored(size int) {
+	atomic.AddUint64(&e.blockStats.Blocks, 1)
+	atomic.AddUint64(&e.blockStats.StoredBytes, uint64(size))
+	metrics.BlocksStored.Inc()
+}
+
+func (e *Engine) recordDedupHit(size int) {
+	atomic.AddUint64(&e.blockStats.DedupHits, 1)
+	atomic.AddUint64(&e.blockStats.DedupBytesSaved, uint64(size))
+	metrics.DedupHits.Inc()
+	metrics.DedupBytesSaved.Add(float64(size))
+}
+
+func (e *Engine) snapshotBlockStats() blockStats {
+	return blockStats{
+		Blocks:          atomic.LoadUint64(&e.blockStats.Blocks),
+		StoredBytes:     atomic.LoadUint64(&e.blockStats.StoredBytes),
+		DedupHits:       atomic.LoadUint64(&e.blockStats.DedupHits),
+		DedupBytesSaved: atomic.LoadUint64(&e.blockStats.DedupBytesSaved),
+	}
+}
+
+func (e *Engine) loadBlockStats(ctx context.Context) error {
+	b, err := e.ds.Get(ctx, dsBlockStatsKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &e.blockStats)
+}
+
+func (e *Engine) persistBlockStats(ctx context.Context) error {
+	b, err := json.Marshal(e.snapshotBlockStats())
+	if err != nil {
+		return err
+	}
+	return e.ds.Put(ctx, dsBlockStatsKey, b)
+}
+
+// ChainStats returns the statistics of the local chain, including the block deduplication
+// totals since the datastore was created.
+func (e *Engine) ChainStats(ctx context.Context) ChainStats {
+	bs := e.snapshotBlockStats()
+	cs := ChainStats{
+		Metadatas:       len(e.pushList),
+		Blocks:          bs.Blocks,
+		StoredBytes:     bs.StoredBytes,
+		DedupHits:       bs.DedupHits,
+		DedupBytesSaved: bs.DedupBytesSaved,
+	}
+	if written := bs.StoredBytes + bs.DedupBytesSaved; written != 0 {
+		cs.DedupRatio = float64(bs.DedupBytesSaved) / float64(written)
+	}
+	return cs
+}
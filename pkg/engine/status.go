@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"context"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"time"
+)
+
+// PandoStatus is the connectivity of the engine to Pando.
+type PandoStatus struct {
+	ID peer.ID
+	// Connected tells whether the host is connected to Pando, Connectedness details it.
+	Connected     bool
+	Connectedness string
+
+	// Protected and the next fields are only set with WithPandoConnectivity: Protected tells
+	// whether the connections to Pando are protected from trimming, Redials counts the dials
+	// of Pando since Start.
+	Protected      bool `json:",omitempty"`
+	Redials        int  `json:",omitempty"`
+	LastConnected  time.Time
+	LastDisconnect time.Time
+	LastDialError  string `json:",omitempty"`
+}
+
+// Status is the state of the engine, as reported to operators.
+type Status struct {
+	// LatestMeta is the head of the default chain, cid.Undef if nothing is published yet.
+	LatestMeta cid.Cid
+	// ChainLength is the number of metadatas pushed on the default chain.
+	ChainLength   int
+	PublisherKind PublisherKind
+	// Started tells whether Start was called.
+	Started bool
+	// Frozen tells whether new publishes are rejected, Freeze tells why and since when.
+	Frozen bool
+	Freeze *FreezeState `json:",omitempty"`
+	// Pando is nil if the address of Pando is not configured.
+	Pando *PandoStatus `json:",omitempty"`
+	// PendingChecks is the number of metadatas of all the chains not yet included in Pando.
+	PendingChecks int
+	// LastCheck is the time of the last inclusion check, zero if none ran yet.
+	LastCheck time.Time
+	// CheckerPaused tells whether the periodic inclusion checks are paused.
+	CheckerPaused bool
+	// LastAnnounced is the last metadata announced successfully since Start, at
+	// LastAnnounceTime. It is cid.Undef if none was announced yet.
+	LastAnnounced    cid.Cid
+	LastAnnounceTime time.Time
+	// Quota is the usage of the publish quota.
+	Quota *QuotaUsage
+	// Fork is the result of the last fork check, nil if none ran yet.
+	Fork *ForkCheck `json:",omitempty"`
+}
+
+// Status returns the state of the engine.
+func (e *Engine) Status(ctx context.Context) *Status {
+	s := &Status{
+		LatestMeta:    e.getLatestMeta(ctx),
+		PublisherKind: e.pubKind,
+		Started:       e.follower != nil,
+		Freeze:        e.Frozen(),
+		CheckerPaused: e.CheckerPaused(),
+		Quota:         e.PublishQuota(),
+		Fork:          e.LastForkCheck(),
+	}
+	s.Frozen = s.Freeze != nil
+	e.publishMutex.Lock()
+	s.ChainLength = len(e.pushList)
+	e.publishMutex.Unlock()
+
+	if id := e.pandoAddrinfo.ID; id != "" {
+		connectedness := e.h.Network().Connectedness(id)
+		s.Pando = &PandoStatus{
+			ID:            id,
+			Connected:     connectedness == network.Connected,
+			Connectedness: connectedness.String(),
+		}
+		if e.pandoConn != nil {
+			e.pandoConn.status(s.Pando)
+		}
+	}
+
+	for _, cr := range e.checkRegistries() {
+		n, _ := cr.pending()
+		s.PendingChecks += n
+		if last := cr.lastRunTime(); last.After(s.LastCheck) {
+			s.LastCheck = last
+		}
+	}
+
+	e.statusMutex.Lock()
+	s.LastAnnounced, s.LastAnnounceTime = e.lastAnnounced, e.lastAnnounceTime
+	e.statusMutex.Unlock()
+	return s
+}
+
+func (e *Engine) recordAnnounced(c cid.Cid) {
+	e.statusMutex.Lock()
+	defer e.statusMutex.Unlock()
+	e.lastAnnounced = c
+	e.lastAnnounceTime = time.Now()
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"github.com/filecoin-project/go-legs"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/kenlabs/pando/pkg/types/schema"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"sync"
+)
+
+var dsLatestSyncKey = datastore.NewKey("sync/sub/latest")
+
+// MetadataHandler is called for every new metadata synced from a followed provider, oldest
+// first.
+type MetadataHandler func(provider peer.ID, c cid.Cid, meta *schema.Metadata)
+
+// dsLatestSyncHandler persists the latest synced cid of each provider, so that syncs resume
+// from it after a restart instead of walking the whole chain again.
+type dsLatestSyncHandler struct {
+	ds datastore.Batching
+}
+
+func (h *dsLatestSyncHandler) SetLatestSync(p peer.ID, c cid.Cid) {
+	if err := h.ds.Put(context.Background(), datastore.NewKey(p.String()), c.Bytes()); err != nil {
+		logger.Errorw("Failed to persist latest sync", "provider", p, "cid", c, "err", err)
+	}
+}
+
+func (h *dsLatestSyncHandler) GetLatestSync(p peer.ID) (cid.Cid, bool) {
+	b, err := h.ds.Get(context.Background(), datastore.NewKey(p.String()))
+	if err != nil {
+		if err != datastore.ErrNotFound {
+			logger.Errorw("Failed to get latest sync", "provider", p, "err", err)
+		}
+		return cid.Undef, false
+	}
+	_, c, err := cid.CidFromBytes(b)
+	if err != nil {
+		return cid.Undef, false
+	}
+	return c, true
+}
+
+// Subscriber continuously follows the metadata chains of other providers: every announcement of
+// a followed provider on the subscriber topic is synced and its new metadatas are passed to the
+// handlers of the provider.
+type Subscriber struct {
+	e       *Engine
+	sub     *legs.Subscriber
+	latest  *dsLatestSyncHandler
+	mutex   sync.RWMutex
+	follows map[peer.ID][]MetadataHandler
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func (e *Engine) newFollowSubscriber(sub *legs.Subscriber, latest *dsLatestSyncHandler) *Subscriber {
+	s := &Subscriber{
+		e:       e,
+		sub:     sub,
+		latest:  latest,
+		follows: make(map[peer.ID][]MetadataHandler),
+		done:    make(chan struct{}),
+	}
+	events, cancel := sub.OnSyncFinished()
+	s.cancel = cancel
+	go s.run(events)
+	return s
+}
+
+func (e *Engine) latestSyncHandler() *dsLatestSyncHandler {
+	return &dsLatestSyncHandler{ds: namespace.Wrap(e.ds, dsLatestSyncKey)}
+}
+
+// Subscriber returns the subscriber of the engine, nil before Start.
+func (e *Engine) Subscriber() *Subscriber {
+	return e.follower
+}
+
+// Follow invokes handler for every new metadata synced from provider.
+func (s *Subscriber) Follow(provider peer.ID, handler MetadataHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.follows[provider] = append(s.follows[provider], handler)
+	logger.Infow("Following provider", "provider", provider)
+}
+
+// Unfollow removes all the handlers of provider.
+func (s *Subscriber) Unfollow(provider peer.ID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.follows, provider)
+}
+
+// LatestSync returns the latest synced metadata of provider, false if it was never synced.
+func (s *Subscriber) LatestSync(provider peer.ID) (cid.Cid, bool) {
+	return s.latest.GetLatestSync(provider)
+}
+
+// SyncProvider syncs the chain of provider from its current head up to its latest synced
+// metadata, without waiting for an announcement. The new metadatas are passed to the handlers.
+// addr may be nil if the address of provider is already known.
+func (s *Subscriber) SyncProvider(ctx context.Context, provider peer.ID, addr multiaddr.Multiaddr) (cid.Cid, error) {
+	var head cid.Cid
+	err := s.e.syncRetry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		head, err = s.sub.Sync(ctx, provider, cid.Undef, nil, addr)
+		return err
+	})
+	return head, err
+}
+
+func (s *Subscriber) run(events <-chan legs.SyncFinished) {
+	defer close(s.done)
+	for event := range events {
+		s.mutex.RLock()
+		handlers := s.follows[event.PeerID]
+		s.mutex.RUnlock()
+		if len(handlers) == 0 {
+			continue
+		}
+
+		// synced cids are ordered from latest to oldest.
+		for i := len(event.SyncedCids) - 1; i >= 0; i-- {
+			c := event.SyncedCids[i]
+			meta, err := s.e.loadMetadata(context.Background(), c)
+			if err != nil {
+				// payload blocks are synced along with the metadatas.
+				continue
+			}
+			for _, h := range handlers {
+				h(event.PeerID, c, meta)
+			}
+		}
+	}
+}
+
+func (s *Subscriber) close() {
+	s.cancel()
+	<-s.done
+}
@@ -0,0 +1,39 @@
+package engine
+
+type (
+	// SyncOption sets a per-call parameter of Sync and SyncWithProvider.
+	SyncOption func(*syncOptions)
+
+	syncOptions struct {
+		maxBlocks    int
+		hasMaxBlocks bool
+		maxBytes     int64
+		hasMaxBytes  bool
+	}
+)
+
+func newSyncOptions(o ...SyncOption) *syncOptions {
+	opts := &syncOptions{}
+	for _, apply := range o {
+		apply(opts)
+	}
+	return opts
+}
+
+// WithMaxSyncBlocks stops this sync once it fetched more than max blocks, instead of the
+// engine limit set by WithSyncLimits. Zero or a negative max removes the limit.
+func WithMaxSyncBlocks(max int) SyncOption {
+	return func(o *syncOptions) {
+		o.maxBlocks = max
+		o.hasMaxBlocks = true
+	}
+}
+
+// WithMaxSyncBytes stops this sync once it fetched more than max bytes, instead of the engine
+// limit set by WithSyncLimits. Zero or a negative max removes the limit.
+func WithMaxSyncBytes(max int64) SyncOption {
+	return func(o *syncOptions) {
+		o.maxBytes = max
+		o.hasMaxBytes = true
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/filecoin-project/go-legs/dtsync"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// SyncInto syncs like Sync, but writes the fetched blocks into lsys instead of the engine
+// blockstore, e.g. to copy the chains of other providers into a store of the caller. Nothing is
+// stored by the engine: the blocks already in lsys are not fetched again, the ones stored only by
+// the engine are.
+//
+// The sync is run from a temporary host dialing Pando, since the data transfer of the engine
+// host writes into the engine link system. The sync limits apply, the writes into lsys fail once
+// they are exceeded.
+func (e *Engine) SyncInto(ctx context.Context, lsys ipld.LinkSystem, c string, depth int, endCidStr string, o ...SyncOption) ([]cid.Cid, error) {
+	if lsys.StorageWriteOpener == nil || lsys.StorageReadOpener == nil {
+		return nil, fmt.Errorf("link system must have storage read and write openers")
+	}
+	syncCid, sel, err := syncSelector(c, depth, endCidStr)
+	if err != nil {
+		return nil, err
+	}
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sync host: %w", err)
+	}
+	defer h.Close()
+	// the addresses of Pando may have been learned by the engine host only.
+	h.Peerstore().AddAddrs(e.pandoAddrinfo.ID, e.pandoAddrinfo.Addrs, peerstore.TempAddrTTL)
+	h.Peerstore().AddAddrs(e.pandoAddrinfo.ID, e.h.Peerstore().Addrs(e.pandoAddrinfo.ID), peerstore.TempAddrTTL)
+
+	budget := e.newSyncBudget(newSyncOptions(o...))
+	budget.isolated = true
+	sink := newSyncSink(lsys, budget)
+	budget.size = sink.size
+	return e.syncBlocks(ctx, budget, func(ctx context.Context, hook func(cid.Cid)) error {
+		s, err := dtsync.NewSync(h, dssync.MutexWrap(datastore.NewMapDatastore()), sink.lsys, func(_ peer.ID, rcid cid.Cid) {
+			hook(rcid)
+		})
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		return s.NewSyncer(e.pandoAddrinfo.ID, e.subTopicName, nil).Sync(ctx, syncCid, sel)
+	})
+}
+
+// syncSink writes the blocks synced by SyncInto into the link system of the caller, recording
+// their sizes for the sync budget.
+type syncSink struct {
+	lsys   ipld.LinkSystem
+	mutex  sync.Mutex
+	sizes  map[cid.Cid]int64
+	budget *syncBudget
+}
+
+func newSyncSink(lsys ipld.LinkSystem, budget *syncBudget) *syncSink {
+	s := &syncSink{lsys: lsys, sizes: make(map[cid.Cid]int64), budget: budget}
+	write := lsys.StorageWriteOpener
+	s.lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			if atomic.LoadInt32(&s.budget.stopped) != 0 {
+				return ErrSyncLimitExceeded
+			}
+			w, commit, err := write(lctx)
+			if err != nil {
+				return err
+			}
+			size := buf.Len()
+			if _, err = buf.WriteTo(w); err != nil {
+				return err
+			}
+			if err = commit(lnk); err != nil {
+				return err
+			}
+			s.mutex.Lock()
+			s.sizes[lnk.(cidlink.Link).Cid] = int64(size)
+			s.mutex.Unlock()
+			return nil
+		}, nil
+	}
+	return s
+}
+
+// size returns the size of the block c written by the sync, zero if it was not written.
+func (s *syncSink) size(_ context.Context, c cid.Cid) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sizes[c]
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"sync/atomic"
+)
+
+// SyncDepthAll is the depth of Sync that follows the chain to its first metadata, however long
+// it is. The blocks synced are still bounded by the sync limits.
+// See: WithSyncLimits.
+const SyncDepthAll = -1
+
+const (
+	defaultSyncMaxBlocks = 1000000
+	defaultSyncMaxBytes  = 1 << 30
+)
+
+// SyncLimitError is returned by Sync when the sync is stopped for exceeding its limits. The
+// blocks synced until then are kept.
+type SyncLimitError struct {
+	// Limit is the exceeded limit, "blocks" or "bytes", and Max its value.
+	Limit string
+	Max   int64
+	// Synced are the blocks synced before the sync was stopped, Blocks their number and Bytes
+	// their total size.
+	Synced []cid.Cid
+	Blocks int
+	Bytes  int64
+}
+
+func (e *SyncLimitError) Error() string {
+	return fmt.Sprintf("%s: more than %d %s, stopped after %d blocks of %d bytes", ErrSyncLimitExceeded, e.Max, e.Limit, e.Blocks, e.Bytes)
+}
+
+// Is makes SyncLimitError match ErrSyncLimitExceeded.
+func (e *SyncLimitError) Is(target error) bool {
+	return target == ErrSyncLimitExceeded
+}
+
+// syncBudget bounds the blocks synced by a call of Sync.
+//
+// The blocks are counted by the block hook of the sync, which can not stop the data transfer:
+// once exceeded, the link system of the engine fails the writes of the traversed blocks until
+// the sync returns, failing the transfer. The other syncs running meanwhile fail as well, unless
+// the budget is isolated: the writes of its sync then go to a link system of their own, failed
+// on stopped.
+type syncBudget struct {
+	e         *Engine
+	maxBlocks int
+	maxBytes  int64
+	blocks    int
+	bytes     int64
+	exceeded  *SyncLimitError
+	// size returns the size of a synced block, the size in the engine blockstore by default.
+	size     func(ctx context.Context, c cid.Cid) int64
+	isolated bool
+	stopped  int32
+}
+
+// newSyncBudget returns the budget of a sync with opts, bounded by the engine limits unless
+// overridden.
+func (e *Engine) newSyncBudget(opts *syncOptions) *syncBudget {
+	b := &syncBudget{e: e, maxBlocks: e.syncMaxBlocks, maxBytes: e.syncMaxBytes, size: e.blockSize}
+	if opts.hasMaxBlocks {
+		b.maxBlocks = opts.maxBlocks
+	}
+	if opts.hasMaxBytes {
+		b.maxBytes = opts.maxBytes
+	}
+	return b
+}
+
+// reset starts counting the blocks of a new sync attempt.
+func (b *syncBudget) reset() {
+	b.blocks = 0
+	b.bytes = 0
+	b.exceeded = nil
+	atomic.StoreInt32(&b.stopped, 0)
+}
+
+// add counts the synced block c.
+func (b *syncBudget) add(ctx context.Context, c cid.Cid) {
+	if b.exceeded != nil || (b.maxBlocks <= 0 && b.maxBytes <= 0) {
+		return
+	}
+	b.blocks++
+	b.bytes += b.size(ctx, c)
+	switch {
+	case b.maxBlocks > 0 && b.blocks > b.maxBlocks:
+		b.exceed("blocks", int64(b.maxBlocks))
+	case b.maxBytes > 0 && b.bytes > b.maxBytes:
+		b.exceed("bytes", b.maxBytes)
+	}
+}
+
+func (b *syncBudget) exceed(limit string, max int64) {
+	b.exceeded = &SyncLimitError{Limit: limit, Max: max}
+	atomic.StoreInt32(&b.stopped, 1)
+	if !b.isolated {
+		atomic.AddInt32(&b.e.exceededSyncs, 1)
+	}
+	logger.Warnw("Stopping sync exceeding its limits", "limit", limit, "max", max)
+}
+
+// done ends the sync attempt that synced the blocks synced, and returns the limit error if the
+// budget was exceeded.
+func (b *syncBudget) done(synced []cid.Cid) error {
+	if b.exceeded == nil {
+		return nil
+	}
+	if !b.isolated {
+		atomic.AddInt32(&b.e.exceededSyncs, -1)
+	}
+	b.exceeded.Synced = synced
+	b.exceeded.Blocks = b.blocks
+	b.exceeded.Bytes = b.bytes
+	return b.exceeded
+}
+
+// blockSize returns the size of the block c in the engine blockstore, zero if it is not stored.
+// The block is stored once the hook of the sync is called.
+func (e *Engine) blockSize(ctx context.Context, c cid.Cid) int64 {
+	data, err := e.bs.Get(ctx, c)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// checkSyncWrite fails the writes of the blocks traversed by the syncs while a sync exceeded its
+// limits. The blocks stored by the engine are written without a link path.
+func (e *Engine) checkSyncWrite(lctx ipld.LinkContext) error {
+	if lctx.LinkPath.Len() != 0 && atomic.LoadInt32(&e.exceededSyncs) > 0 {
+		return ErrSyncLimitExceeded
+	}
+	return nil
+}
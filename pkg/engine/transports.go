@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Transport is a libp2p transport the host of the engine listens on.
+// See: WithListenAddrs.
+type Transport string
+
+const (
+	// TransportTCP listens on raw TCP, e.g. /ip4/0.0.0.0/tcp/9020.
+	TransportTCP Transport = "tcp"
+	// TransportQUIC listens on QUIC over UDP, e.g. /ip4/0.0.0.0/udp/9020/quic.
+	TransportQUIC Transport = "quic"
+	// TransportWebSocket listens on WebSocket, e.g. /ip4/0.0.0.0/tcp/9021/ws, so that peers
+	// behind HTTP-only proxies and browsers can reach the host.
+	TransportWebSocket Transport = "websocket"
+	// TransportWebTransport listens on WebTransport. It is not supported by the libp2p version
+	// of the engine yet, its listen addresses are rejected.
+	TransportWebTransport Transport = "webtransport"
+)
+
+// ParseListenAddrs parses the listen multiaddrs of the transport t, e.g. to listen on them with a
+// host not managed by the engine. It fails if an address is not one of t.
+func ParseListenAddrs(t Transport, addrs ...string) ([]multiaddr.Multiaddr, error) {
+	if t == TransportWebTransport {
+		return nil, fmt.Errorf("transport %s is not supported by this version of libp2p", t)
+	}
+	maddrs := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		m, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s listen address %s: %w", t, addr, err)
+		}
+		ok, err := isTransportAddr(t, m)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("listen address %s is not a %s address", addr, t)
+		}
+		maddrs = append(maddrs, m)
+	}
+	return maddrs, nil
+}
+
+func isTransportAddr(t Transport, m multiaddr.Multiaddr) (bool, error) {
+	has := func(code int) bool {
+		_, err := m.ValueForProtocol(code)
+		return err == nil
+	}
+	ws := has(multiaddr.P_WS) || has(multiaddr.P_WSS)
+	switch t {
+	case TransportTCP:
+		return has(multiaddr.P_TCP) && !ws, nil
+	case TransportQUIC:
+		return has(multiaddr.P_UDP) && has(multiaddr.P_QUIC), nil
+	case TransportWebSocket:
+		return has(multiaddr.P_TCP) && ws, nil
+	default:
+		return false, fmt.Errorf("unknown transport: %s", t)
+	}
+}
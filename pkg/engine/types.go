@@ -1,16 +1,14 @@
 package engine
 
 import (
-	"github.com/ipfs/go-cid"
+	"pandoClient/pkg/pandoapi"
 )
 
-type MetaInclusion struct {
-	ID             cid.Cid `json:"ID"`
-	Provider       string  `json:"Provider"`
-	InPando        bool    `json:"InPando"`
-	InSnapShot     bool    `json:"InSnapShot"`
-	SnapShotID     cid.Cid `json:"SnapShotID"`
-	SnapShotHeight uint64  `json:"SnapShotHeight"`
-	Context        []byte  `json:"Context"`
-	TranscationID  int     `json:"TranscationID"`
-}
+// MetaInclusion is the inclusion status of a metadata in Pando.
+type MetaInclusion = pandoapi.MetaInclusion
+
+// ProviderInfo is a provider registered in Pando.
+type ProviderInfo = pandoapi.ProviderInfo
+
+// BackupDeal is a Filecoin storage deal of a snapshot of Pando.
+type BackupDeal = pandoapi.BackupDeal
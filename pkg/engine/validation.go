@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"sort"
+)
+
+// compilePayloadSchema returns the prototype of the type typeName of the IPLD schema dsl, or of
+// the type payloadType if typeName is empty.
+func compilePayloadSchema(payloadType string, dsl []byte, typeName string) (schema.TypedPrototype, error) {
+	if payloadType == "" {
+		return nil, fmt.Errorf("payload type can not be empty")
+	}
+	if typeName == "" {
+		typeName = payloadType
+	}
+	ts, err := ipld.LoadSchemaBytes(dsl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema of payload type %s: %w", payloadType, err)
+	}
+	typ := ts.TypeByName(typeName)
+	if typ == nil {
+		return nil, fmt.Errorf("schema of payload type %s has no type %s", payloadType, typeName)
+	}
+	return bindnode.Prototype(nil, typ), nil
+}
+
+// RegisterPayloadSchema validates the payloads published with WithPayloadType(payloadType)
+// against the type typeName of the IPLD schema dsl, e.g.
+//
+//	type Reading struct { sensor String  value Float }
+//
+// typeName defaults to payloadType. Registering a payload type again replaces its schema.
+// See: WithPayloadSchema.
+func (e *Engine) RegisterPayloadSchema(payloadType string, dsl []byte, typeName string) error {
+	proto, err := compilePayloadSchema(payloadType, dsl, typeName)
+	if err != nil {
+		return err
+	}
+	e.schemaMutex.Lock()
+	defer e.schemaMutex.Unlock()
+	e.payloadSchemas[payloadType] = proto
+	logger.Infow("Registered payload schema", "type", payloadType)
+	return nil
+}
+
+// PayloadTypes returns the payload types with a registered schema, sorted.
+func (e *Engine) PayloadTypes() []string {
+	e.schemaMutex.RLock()
+	defer e.schemaMutex.RUnlock()
+	types := make([]string, 0, len(e.payloadSchemas))
+	for t := range e.payloadSchemas {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidatePayload checks payload against the schema of payloadType, e.g. before publishing it
+// through Publish, which does not validate payloads.
+func (e *Engine) ValidatePayload(payloadType string, payload datamodel.Node) error {
+	e.schemaMutex.RLock()
+	proto, ok := e.payloadSchemas[payloadType]
+	e.schemaMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPayloadType, payloadType)
+	}
+	if err := conform(payload, proto); err != nil {
+		return fmt.Errorf("%w: not a %s: %v", ErrInvalidPayload, payloadType, err)
+	}
+	return nil
+}
+
+// conform copies n into the representation of proto, which fails if n does not match it.
+func conform(n datamodel.Node, proto schema.TypedPrototype) (err error) {
+	// bindnode panics on some mismatches instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	nb := proto.Representation().NewBuilder()
+	return datamodel.Copy(n, nb)
+}
+
+// validateBytes checks the dag-json document data against the schema of opts.payloadType, if
+// set.
+func (e *Engine) validateBytes(data []byte, opts *publishOptions) error {
+	if opts.payloadType == "" {
+		return nil
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagjson.Decode(nb, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("%w: %s payload is not dag-json: %v", ErrInvalidPayload, opts.payloadType, err)
+	}
+	return e.validate(nb.Build(), opts)
+}
+
+// validate checks payload against the schema of opts.payloadType, if set.
+func (e *Engine) validate(payload datamodel.Node, opts *publishOptions) error {
+	if opts.payloadType == "" {
+		return nil
+	}
+	return e.ValidatePayload(opts.payloadType, payload)
+}
+
+// PublishCborData publishes the dag-cbor document data as the payload of a metadata, so that the
+// payload is stored as structured data instead of opaque bytes. The payload is validated against
+// the schema of WithPayloadType if set. Data larger than the max payload size is rejected, even
+// with ChunkOversizedPayloads, see WithMaxPayloadSize.
+func (e *Engine) PublishCborData(ctx context.Context, data []byte, o ...PublishOption) (cid.Cid, error) {
+	if err := e.checkPayloadSize(len(data)); err != nil {
+		return cid.Undef, err
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(data)); err != nil {
+		return cid.Undef, fmt.Errorf("%w: payload is not dag-cbor: %v", ErrInvalidPayload, err)
+	}
+	payload := nb.Build()
+	opts := newPublishOptions(o...)
+	if err := e.validate(payload, opts); err != nil {
+		return cid.Undef, err
+	}
+
+	e.publishMutex.Lock()
+	defer e.publishMutex.Unlock()
+	if err := e.checkFrozen(); err != nil {
+		return cid.Undef, err
+	}
+	meta, err := e.newMetadata(ctx, payload, opts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return e.publishFn(ctx, *meta, o...)
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+)
+
+// WaitForInclusion blocks until the inclusion checks of the engine confirm that the pushed
+// metadata c is included in Pando, and returns its inclusion, or until ctx is done. It does not
+// query Pando itself while c is pending, so the calls are only served while the engine is
+// started. If c is neither pending nor queued for announce, e.g. it is already confirmed, its
+// inclusion is looked up once instead with GetInclusion and ErrNotIncluded is returned if c is
+// not included.
+func (e *Engine) WaitForInclusion(ctx context.Context, c cid.Cid) (*MetaInclusion, error) {
+	ch := e.addInclusionWaiter(c)
+	defer e.removeInclusionWaiter(c, ch)
+
+	if !e.pendingInclusion(c) {
+		inclusion, err := e.GetInclusion(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !inclusion.InPando {
+			return nil, fmt.Errorf("%w: %s is not pending inclusion checks", ErrNotIncluded, c)
+		}
+		return inclusion, nil
+	}
+
+	select {
+	case inclusion := <-ch:
+		return inclusion, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// pendingInclusion reports whether c is queued for announce or pending in a check list. The
+// queue is looked up first since queued metadatas are added to the check list before they are
+// dequeued.
+func (e *Engine) pendingInclusion(c cid.Cid) bool {
+	e.queueMutex.Lock()
+	for _, qa := range e.announceQueue {
+		if qa.Cid.Equals(c) && !qa.SkipCheck {
+			e.queueMutex.Unlock()
+			return true
+		}
+	}
+	e.queueMutex.Unlock()
+
+	for _, cr := range e.checkRegistries() {
+		if cr.has(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) addInclusionWaiter(c cid.Cid) chan *MetaInclusion {
+	ch := make(chan *MetaInclusion, 1)
+	e.waiterMutex.Lock()
+	defer e.waiterMutex.Unlock()
+	e.inclusionWaiters[c] = append(e.inclusionWaiters[c], ch)
+	return ch
+}
+
+func (e *Engine) removeInclusionWaiter(c cid.Cid, ch chan *MetaInclusion) {
+	e.waiterMutex.Lock()
+	defer e.waiterMutex.Unlock()
+	waiters := e.inclusionWaiters[c]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(e.inclusionWaiters, c)
+	} else {
+		e.inclusionWaiters[c] = waiters
+	}
+}
+
+// notifyInclusion wakes up the calls of WaitForInclusion waiting for c.
+func (e *Engine) notifyInclusion(c cid.Cid, inclusion *MetaInclusion) {
+	e.waiterMutex.Lock()
+	defer e.waiterMutex.Unlock()
+	for _, ch := range e.inclusionWaiters[c] {
+		ch <- inclusion
+	}
+	delete(e.inclusionWaiters, c)
+}
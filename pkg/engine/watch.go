@@ -0,0 +1,400 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchScanInterval = time.Second
+	defaultWatchDebounce     = 2 * time.Second
+
+	// WatchPathAnnotation is the local annotation holding the path of the files published by
+	// the watchers.
+	WatchPathAnnotation = "path"
+)
+
+var dsWatchesKey = datastore.NewKey("sync/watches")
+
+// WatchSpec describes a directory whose files are published as they are added or changed.
+type WatchSpec struct {
+	// Dir is the absolute path of the watched directory.
+	Dir string
+	// Ignore are the glob patterns of the files and directories not to publish, matched against
+	// their name and their slash-separated path relative to Dir.
+	Ignore []string
+	// Debounce is how long a file must stay unchanged before it is published, so that files
+	// still being written are published once. The default is 2s.
+	Debounce time.Duration
+}
+
+// WatchStatus is the state of a running watcher.
+type WatchStatus struct {
+	WatchSpec
+	// Files is the number of files tracked, Published the ones published by the watcher.
+	Files     int
+	Published int
+	// Pending is the number of new or changed files waiting for the debounce.
+	Pending int
+}
+
+// watchedFile is the state of a tracked file when it was last published, or first seen for the
+// files present when the watch started, which have an undefined Cid.
+type watchedFile struct {
+	Size    int64
+	ModTime time.Time
+	Cid     cid.Cid
+}
+
+// watchState is the persisted state of a watcher.
+type watchState struct {
+	Spec  WatchSpec
+	Files map[string]watchedFile
+}
+
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	// since is the time the file was first seen with this size and modification time.
+	since time.Time
+}
+
+// Watcher publishes the new and changed files of a directory. The directory is scanned every
+// watch scan interval rather than notified by the filesystem, so that it also works on network
+// filesystems.
+type Watcher struct {
+	e       *Engine
+	spec    WatchSpec
+	mutex   sync.Mutex
+	files   map[string]watchedFile
+	pending map[string]*pendingFile
+	closing chan struct{}
+	done    chan struct{}
+}
+
+func (e *Engine) watchesDs() datastore.Batching {
+	return namespace.Wrap(e.ds, dsWatchesKey)
+}
+
+// StartWatch starts publishing the files added to or changed in spec.Dir, each of them as the
+// bytes payload of a metadata annotated with its path. The files present when the watch starts
+// are not published. The watch is persisted and resumed by Start until StopWatch is called,
+// files changed in between are published on resume.
+// See: WithWatchScanInterval.
+func (e *Engine) StartWatch(ctx context.Context, spec WatchSpec) (*Watcher, error) {
+	dir, err := filepath.Abs(spec.Dir)
+	if err != nil {
+		return nil, err
+	}
+	spec.Dir = dir
+	info, err := os.Stat(spec.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", spec.Dir)
+	}
+	for _, pattern := range spec.Ignore {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	if spec.Debounce < 0 {
+		return nil, fmt.Errorf("watch debounce can not be negative")
+	}
+	if spec.Debounce == 0 {
+		spec.Debounce = defaultWatchDebounce
+	}
+
+	w, err := e.startWatch(watchState{Spec: spec})
+	if err != nil {
+		return nil, err
+	}
+	if err = w.persist(ctx); err != nil {
+		e.removeWatcher(spec.Dir)
+		w.close()
+		return nil, fmt.Errorf("failed to persist watch: %w", err)
+	}
+	return w, nil
+}
+
+func (e *Engine) startWatch(state watchState) (*Watcher, error) {
+	w := &Watcher{
+		e:       e,
+		spec:    state.Spec,
+		files:   state.Files,
+		pending: make(map[string]*pendingFile),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	e.watchMutex.Lock()
+	defer e.watchMutex.Unlock()
+	if _, ok := e.watchers[w.spec.Dir]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyWatched, w.spec.Dir)
+	}
+	if w.files == nil {
+		// the files already in the directory are not published.
+		w.files = make(map[string]watchedFile)
+		w.scan(time.Now(), true)
+	}
+	e.watchers[w.spec.Dir] = w
+	go w.run()
+	logger.Infow("Watching directory", "dir", w.spec.Dir, "ignore", w.spec.Ignore, "debounce", w.spec.Debounce)
+	return w, nil
+}
+
+// StopWatch stops publishing the files of dir and no longer resumes it. The published
+// metadatas are kept.
+func (e *Engine) StopWatch(ctx context.Context, dir string) error {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	w := e.removeWatcher(dir)
+	if w == nil {
+		return fmt.Errorf("%w: %s", ErrNotWatched, dir)
+	}
+	w.close()
+	return e.watchesDs().Delete(ctx, datastore.NewKey(dir))
+}
+
+// Watches returns the status of the running watchers.
+func (e *Engine) Watches() []WatchStatus {
+	e.watchMutex.Lock()
+	defer e.watchMutex.Unlock()
+	statuses := make([]WatchStatus, 0, len(e.watchers))
+	for _, w := range e.watchers {
+		statuses = append(statuses, w.Status())
+	}
+	return statuses
+}
+
+func (e *Engine) removeWatcher(dir string) *Watcher {
+	e.watchMutex.Lock()
+	defer e.watchMutex.Unlock()
+	w, ok := e.watchers[dir]
+	if !ok {
+		return nil
+	}
+	delete(e.watchers, dir)
+	return w
+}
+
+// resumeWatches restarts the watches persisted by StartWatch.
+func (e *Engine) resumeWatches(ctx context.Context) error {
+	res, err := e.watchesDs().Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var state watchState
+		if err = json.Unmarshal(r.Value, &state); err != nil {
+			return err
+		}
+		if state.Files == nil {
+			state.Files = make(map[string]watchedFile)
+		}
+		if _, err = e.startWatch(state); err != nil {
+			logger.Errorw("Failed to resume watch", "dir", state.Spec.Dir, "err", err)
+		}
+	}
+	return nil
+}
+
+// closeWatchers stops the running watchers on shutdown, they are resumed on the next Start.
+func (e *Engine) closeWatchers() {
+	e.watchMutex.Lock()
+	watchers := e.watchers
+	e.watchers = make(map[string]*Watcher)
+	e.watchMutex.Unlock()
+	for _, w := range watchers {
+		w.close()
+	}
+}
+
+// Status returns the state of the watcher.
+func (w *Watcher) Status() WatchStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	s := WatchStatus{WatchSpec: w.spec, Files: len(w.files), Pending: len(w.pending)}
+	for _, f := range w.files {
+		if f.Cid.Defined() {
+			s.Published++
+		}
+	}
+	return s
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.e.watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closing:
+			return
+		case now := <-ticker.C:
+			w.mutex.Lock()
+			changed := w.scan(now, false)
+			w.mutex.Unlock()
+			if changed {
+				if err := w.persist(context.Background()); err != nil {
+					logger.Errorw("Failed to persist watch", "dir", w.spec.Dir, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// scan walks the directory, publishing the files unchanged for the debounce, or only tracking
+// them if baseline is set. It tells whether the tracked files changed. w.mutex must be held.
+func (w *Watcher) scan(now time.Time, baseline bool) bool {
+	changed := false
+	seen := make(map[string]struct{})
+	err := filepath.WalkDir(w.spec.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == w.spec.Dir {
+				return err
+			}
+			logger.Warnw("Failed to scan watched path", "path", p, "err", err)
+			return nil
+		}
+		if p == w.spec.Dir {
+			return nil
+		}
+		rel, err := filepath.Rel(w.spec.Dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if w.ignored(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// removed since listed.
+			return nil
+		}
+		seen[rel] = struct{}{}
+		if baseline {
+			w.files[rel] = watchedFile{Size: info.Size(), ModTime: info.ModTime()}
+			return nil
+		}
+		if w.observe(rel, info, now) {
+			changed = true
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warnw("Failed to scan watched directory", "dir", w.spec.Dir, "err", err)
+		return changed
+	}
+
+	for rel := range w.files {
+		if _, ok := seen[rel]; !ok {
+			delete(w.files, rel)
+			changed = true
+		}
+	}
+	for rel := range w.pending {
+		if _, ok := seen[rel]; !ok {
+			delete(w.pending, rel)
+		}
+	}
+	return changed
+}
+
+// observe publishes the file rel once it is unchanged for the debounce, it tells whether it was
+// published.
+func (w *Watcher) observe(rel string, info fs.FileInfo, now time.Time) bool {
+	size, modTime := info.Size(), info.ModTime()
+	if f, ok := w.files[rel]; ok && f.Size == size && f.ModTime.Equal(modTime) {
+		delete(w.pending, rel)
+		return false
+	}
+	p, ok := w.pending[rel]
+	if !ok || p.size != size || !p.modTime.Equal(modTime) {
+		w.pending[rel] = &pendingFile{size: size, modTime: modTime, since: now}
+		return false
+	}
+	if now.Sub(p.since) < w.spec.Debounce {
+		return false
+	}
+
+	c, err := w.publish(rel)
+	if err != nil {
+		// retried on the next scan.
+		logger.Errorw("Failed to publish watched file", "path", rel, "dir", w.spec.Dir, "err", err)
+		return false
+	}
+	delete(w.pending, rel)
+	w.files[rel] = watchedFile{Size: size, ModTime: modTime, Cid: c}
+	return true
+}
+
+func (w *Watcher) publish(rel string) (cid.Cid, error) {
+	p := filepath.Join(w.spec.Dir, filepath.FromSlash(rel))
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return cid.Undef, err
+	}
+	ctx := context.Background()
+	c, err := w.e.PublishBytesData(ctx, data)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err = w.e.Annotate(ctx, c, WatchPathAnnotation, p); err != nil {
+		logger.Warnw("Failed to annotate watched file", "path", p, "cid", c, "err", err)
+	}
+	logger.Infow("Published watched file", "path", p, "cid", c)
+	return c, nil
+}
+
+func (w *Watcher) ignored(rel string) bool {
+	name := path.Base(rel)
+	for _, pattern := range w.spec.Ignore {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) persist(ctx context.Context) error {
+	w.mutex.Lock()
+	b, err := json.Marshal(watchState{Spec: w.spec, Files: w.files})
+	w.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return w.e.watchesDs().Put(ctx, datastore.NewKey(w.spec.Dir), b)
+}
+
+func (w *Watcher) close() {
+	close(w.closing)
+	<-w.done
+}
@@ -0,0 +1,481 @@
+// Package graphql executes GraphQL queries against a schema of resolvers.
+//
+// It supports the query language needed by read-only APIs: query operations, named or
+// anonymous, with variables and their defaults, aliases, arguments of any literal kind, named
+// and inline fragments, the @skip and @include directives and __typename. Mutations,
+// subscriptions, block strings and introspection are not supported, and the schema is not
+// typed beyond its objects: the resolvers check the arguments they get and the scalars they
+// return are encoded by encoding/json.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Schema is the entry point of the queries.
+type Schema struct {
+	Query *Object
+}
+
+// Object is a type whose fields are selected by the queries.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Field is a field of an Object.
+type Field struct {
+	// Type is the object returned by Resolve, nil for scalars. A field of object type returns
+	// a single object, nil for null, or a slice of them for a list.
+	Type *Object
+	// Args are the names of the accepted arguments.
+	Args    []string
+	Resolve ResolveFunc
+}
+
+// ResolveFunc returns the value of a field. A failure sets the field to null and is reported
+// in the errors of the response, together with its path.
+type ResolveFunc func(p Params) (interface{}, error)
+
+// Params are the parameters of a ResolveFunc.
+type Params struct {
+	Context context.Context
+	// Source is the value returned by the resolver of the parent object, nil for the fields
+	// of the Query object.
+	Source interface{}
+	// Args are the arguments set, strings, ints, float64s, bools, nils, []interface{} and
+	// map[string]interface{} of them as literals, or as decoded by encoding/json as variables.
+	Args map[string]interface{}
+}
+
+// String returns the string argument name, "" if it is not set or null.
+func (p Params) String(name string) (string, error) {
+	v, ok := p.Args[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %s must be a string", name)
+	}
+	return s, nil
+}
+
+// Int returns the int argument name, def if it is not set or null.
+func (p Params) Int(name string, def int) (int, error) {
+	v, ok := p.Args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch i := v.(type) {
+	case int:
+		return i, nil
+	case float64:
+		if i == math.Trunc(i) && math.Abs(i) <= math.MaxInt32 {
+			return int(i), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %s must be an int", name)
+}
+
+// Bool returns the bool argument name, def if it is not set or null.
+func (p Params) Bool(name string, def bool) (bool, error) {
+	v, ok := p.Args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("argument %s must be a bool", name)
+	}
+	return b, nil
+}
+
+// Request is a GraphQL request, as posted in JSON.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is not set if the request is invalid.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is an error of a request. Path is the path of the field whose resolution failed, of
+// the response keys of objects and indexes of lists, empty if the request is invalid.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(path, "."), e.Message)
+}
+
+// Execute runs the query of req. Invalid requests, with syntax errors, unknown fields or
+// arguments or undefined variables, are not executed at all.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return invalid(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return invalid(err)
+	}
+	ex := &executor{ctx: ctx, doc: doc, op: op}
+	if errs := ex.validate(s.Query, op.selections, map[string]bool{}); len(errs) != 0 {
+		return &Response{Errors: errs}
+	}
+	if ex.vars, err = op.variables(req.Variables); err != nil {
+		return invalid(err)
+	}
+	data := ex.executeObject(s.Query, nil, ex.collect([][]selection{op.selections}), nil)
+	return &Response{Data: data, Errors: ex.errors}
+}
+
+func invalid(err error) *Response {
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// operation returns the operation name of the document, or its single operation if name is
+// empty.
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) != 1 {
+			return nil, fmt.Errorf("operation name is required by documents of %d operations", len(d.operations))
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// variables returns the values of the variables of the operation, from values or their
+// defaults. The variables without value nor default are not set.
+func (op *operation) variables(values map[string]interface{}) (map[string]interface{}, error) {
+	vars := make(map[string]interface{}, len(op.vars))
+	for _, v := range op.vars {
+		value, ok := values[v.name]
+		if !ok && v.hasDef {
+			value, ok = v.def, true
+		}
+		if v.nonNull && (!ok || value == nil) {
+			return nil, fmt.Errorf("variable $%s of non-null type must be set", v.name)
+		}
+		if ok {
+			vars[v.name] = value
+		}
+	}
+	return vars, nil
+}
+
+type executor struct {
+	ctx    context.Context
+	doc    *document
+	op     *operation
+	vars   map[string]interface{}
+	errors []*Error
+}
+
+// validate checks the selections sels of an object of type t, visiting being the fragments
+// spread by the enclosing selections.
+func (ex *executor) validate(t *Object, sels []selection, visiting map[string]bool) []*Error {
+	var errs []*Error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, &Error{Message: fmt.Sprintf(format, args...)})
+	}
+	for _, s := range sels {
+		switch s := s.(type) {
+		case *field:
+			errs = append(errs, ex.validateDirectives(s.directives)...)
+			if s.name == "__typename" {
+				if len(s.args) != 0 || len(s.selections) != 0 {
+					errorf("field __typename takes no argument nor selection")
+				}
+				continue
+			}
+			f, ok := t.Fields[s.name]
+			if !ok {
+				errorf("cannot query field %q on type %q", s.name, t.Name)
+				continue
+			}
+			for _, a := range s.args {
+				if !contains(f.Args, a.name) {
+					errorf("unknown argument %q of field %q on type %q", a.name, s.name, t.Name)
+				}
+				errs = append(errs, ex.validateValue(a.value)...)
+			}
+			switch {
+			case f.Type == nil && len(s.selections) != 0:
+				errorf("field %q on type %q is a scalar and must not have a selection", s.name, t.Name)
+			case f.Type != nil && len(s.selections) == 0:
+				errorf("field %q on type %q must have a selection of %q fields", s.name, t.Name, f.Type.Name)
+			case f.Type != nil:
+				errs = append(errs, ex.validate(f.Type, s.selections, visiting)...)
+			}
+		case *fragmentSpread:
+			errs = append(errs, ex.validateDirectives(s.directives)...)
+			frag, ok := ex.doc.fragments[s.name]
+			switch {
+			case !ok:
+				errorf("unknown fragment %q", s.name)
+			case visiting[s.name]:
+				errorf("fragment %q spreads itself", s.name)
+			case frag.on != t.Name:
+				errorf("fragment %q on type %q cannot be spread on type %q", s.name, frag.on, t.Name)
+			default:
+				visiting[s.name] = true
+				errs = append(errs, ex.validate(t, frag.selections, visiting)...)
+				delete(visiting, s.name)
+			}
+		case *inlineFragment:
+			errs = append(errs, ex.validateDirectives(s.directives)...)
+			if s.on != "" && s.on != t.Name {
+				errorf("fragment on type %q cannot be spread on type %q", s.on, t.Name)
+				continue
+			}
+			errs = append(errs, ex.validate(t, s.selections, visiting)...)
+		}
+	}
+	return errs
+}
+
+func (ex *executor) validateDirectives(dirs []*directive) []*Error {
+	var errs []*Error
+	for _, d := range dirs {
+		if d.name != "skip" && d.name != "include" {
+			errs = append(errs, &Error{Message: fmt.Sprintf("unknown directive @%s", d.name)})
+			continue
+		}
+		if len(d.args) != 1 || d.args[0].name != "if" {
+			errs = append(errs, &Error{Message: fmt.Sprintf("directive @%s takes a single if argument", d.name)})
+			continue
+		}
+		errs = append(errs, ex.validateValue(d.args[0].value)...)
+	}
+	return errs
+}
+
+// validateValue checks that the variables used by v are defined by the operation.
+func (ex *executor) validateValue(v interface{}) []*Error {
+	switch v := v.(type) {
+	case variable:
+		for _, d := range ex.op.vars {
+			if d.name == string(v) {
+				return nil
+			}
+		}
+		return []*Error{{Message: fmt.Sprintf("variable $%s is not defined", v)}}
+	case []interface{}:
+		var errs []*Error
+		for _, e := range v {
+			errs = append(errs, ex.validateValue(e)...)
+		}
+		return errs
+	case map[string]interface{}:
+		var errs []*Error
+		for _, e := range v {
+			errs = append(errs, ex.validateValue(e)...)
+		}
+		return errs
+	}
+	return nil
+}
+
+// fieldGroup is the fields selected under the same response key, merged in a single result.
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// collect groups the fields of the selection sets sets by response key, in the order they are
+// selected, spreading the fragments and omitting the skipped selections.
+func (ex *executor) collect(sets [][]selection) []*fieldGroup {
+	var groups []*fieldGroup
+	index := make(map[string]*fieldGroup)
+	var walk func(sels []selection)
+	walk = func(sels []selection) {
+		for _, s := range sels {
+			switch s := s.(type) {
+			case *field:
+				if !ex.included(s.directives) {
+					continue
+				}
+				g, ok := index[s.key()]
+				if !ok {
+					g = &fieldGroup{key: s.key()}
+					index[g.key] = g
+					groups = append(groups, g)
+				}
+				g.fields = append(g.fields, s)
+			case *fragmentSpread:
+				if ex.included(s.directives) {
+					walk(ex.doc.fragments[s.name].selections)
+				}
+			case *inlineFragment:
+				if ex.included(s.directives) {
+					walk(s.selections)
+				}
+			}
+		}
+	}
+	for _, sels := range sets {
+		walk(sels)
+	}
+	return groups
+}
+
+// included evaluates the @skip and @include directives dirs. A directive whose argument is not
+// a bool fails the request and excludes the selection.
+func (ex *executor) included(dirs []*directive) bool {
+	for _, d := range dirs {
+		cond, ok := ex.resolveValue(d.args[0].value).(bool)
+		if !ok {
+			ex.errors = append(ex.errors, &Error{Message: fmt.Sprintf("argument if of directive @%s must be a bool", d.name)})
+			return false
+		}
+		if cond == (d.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveValue replaces the variables in v by their values.
+func (ex *executor) resolveValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case variable:
+		return ex.vars[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = ex.resolveValue(e)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			obj[k] = ex.resolveValue(e)
+		}
+		return obj
+	}
+	return v
+}
+
+func (ex *executor) arguments(args []*argument) map[string]interface{} {
+	res := make(map[string]interface{}, len(args))
+	for _, a := range args {
+		if v, ok := a.value.(variable); ok {
+			if _, set := ex.vars[string(v)]; !set {
+				continue
+			}
+		}
+		res[a.name] = ex.resolveValue(a.value)
+	}
+	return res
+}
+
+func (ex *executor) executeObject(t *Object, source interface{}, groups []*fieldGroup, path []interface{}) *result {
+	res := &result{}
+	for _, g := range groups {
+		f := g.fields[0]
+		fieldPath := append(path[:len(path):len(path)], g.key)
+		if f.name == "__typename" {
+			res.set(g.key, t.Name)
+			continue
+		}
+		def := t.Fields[f.name]
+		v, err := def.Resolve(Params{Context: ex.ctx, Source: source, Args: ex.arguments(f.args)})
+		if err != nil {
+			ex.errors = append(ex.errors, &Error{Message: err.Error(), Path: fieldPath})
+			res.set(g.key, nil)
+			continue
+		}
+		res.set(g.key, ex.complete(def.Type, v, g.fields, fieldPath))
+	}
+	return res
+}
+
+// complete returns the result of the value v of the fields of type t.
+func (ex *executor) complete(t *Object, v interface{}, fields []*field, path []interface{}) interface{} {
+	if t == nil || v == nil {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = ex.complete(t, rv.Index(i).Interface(), fields, append(path[:len(path):len(path)], i))
+		}
+		return list
+	}
+	sets := make([][]selection, len(fields))
+	for i, f := range fields {
+		sets[i] = f.selections
+	}
+	return ex.executeObject(t, v, ex.collect(sets), path)
+}
+
+// result is an object of the response, encoded with its fields in the order they are selected.
+type result struct {
+	keys   []string
+	values []interface{}
+}
+
+func (r *result) set(key string, v interface{}) {
+	r.keys = append(r.keys, key)
+	r.values = append(r.values, v)
+}
+
+func (r *result) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, k := range r.keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, key...), ':'), value...)
+	}
+	return append(buf, '}'), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type book struct {
+	title  string
+	pages  int
+	author *author
+}
+
+type author struct {
+	name  string
+	books []*book
+}
+
+func testSchema() *Schema {
+	tolkien := &author{name: "Tolkien"}
+	tolkien.books = []*book{
+		{title: "The Hobbit", pages: 310, author: tolkien},
+		{title: "The Silmarillion", pages: 365, author: tolkien},
+	}
+	authorType := &Object{Name: "Author", Fields: map[string]*Field{
+		"name": {Resolve: func(p Params) (interface{}, error) { return p.Source.(*author).name, nil }},
+	}}
+	bookType := &Object{Name: "Book", Fields: map[string]*Field{
+		"title": {Resolve: func(p Params) (interface{}, error) { return p.Source.(*book).title, nil }},
+		"pages": {Resolve: func(p Params) (interface{}, error) { return p.Source.(*book).pages, nil }},
+		"author": {Type: authorType, Resolve: func(p Params) (interface{}, error) {
+			return p.Source.(*book).author, nil
+		}},
+	}}
+	authorType.Fields["books"] = &Field{
+		Type: bookType,
+		Args: []string{"limit"},
+		Resolve: func(p Params) (interface{}, error) {
+			limit, err := p.Int("limit", 0)
+			if err != nil {
+				return nil, err
+			}
+			books := p.Source.(*author).books
+			if limit > 0 && limit < len(books) {
+				books = books[:limit]
+			}
+			return books, nil
+		},
+	}
+	return &Schema{Query: &Object{Name: "Query", Fields: map[string]*Field{
+		"book": {Type: bookType, Args: []string{"title"}, Resolve: func(p Params) (interface{}, error) {
+			title, err := p.String("title")
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range tolkien.books {
+				if b.title == title {
+					return b, nil
+				}
+			}
+			return (*book)(nil), nil
+		}},
+		"books": {Type: bookType, Resolve: func(p Params) (interface{}, error) { return tolkien.books, nil }},
+		"fail":  {Resolve: func(p Params) (interface{}, error) { return nil, fmt.Errorf("failed") }},
+	}}}
+}
+
+func execute(t *testing.T, query string, vars map[string]interface{}) string {
+	res := testSchema().Execute(context.Background(), Request{Query: query, Variables: vars})
+	b, err := json.Marshal(res)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestSchema_Execute(t *testing.T) {
+	require.Equal(t,
+		`{"data":{"books":[{"title":"The Hobbit","pages":310},{"title":"The Silmarillion","pages":365}]}}`,
+		execute(t, `{ books { title pages } }`, nil))
+
+	// aliases, arguments, nested objects and __typename.
+	require.Equal(t,
+		`{"data":{"hobbit":{"__typename":"Book","author":{"name":"Tolkien","first":[{"title":"The Hobbit"}]}},"missing":null}}`,
+		execute(t, `
+			# the first book of the author of the hobbit.
+			query Books {
+				hobbit: book(title: "The Hobbit") {
+					__typename
+					author { name, first: books(limit: 1) { title } }
+				}
+				missing: book(title: "Unfinished Tales") { title }
+			}`, nil))
+
+	// variables, with defaults, and directives.
+	query := `query($title: String!, $limit: Int = 1, $withPages: Boolean = false) {
+		book(title: $title) {
+			title
+			pages @include(if: $withPages)
+			author { books(limit: $limit) { title } }
+		}
+	}`
+	require.Equal(t,
+		`{"data":{"book":{"title":"The Silmarillion","author":{"books":[{"title":"The Hobbit"}]}}}}`,
+		execute(t, query, map[string]interface{}{"title": "The Silmarillion"}))
+	require.Equal(t,
+		`{"data":{"book":{"title":"The Silmarillion","pages":365,"author":{"books":[{"title":"The Hobbit"},{"title":"The Silmarillion"}]}}}}`,
+		execute(t, query, map[string]interface{}{"title": "The Silmarillion", "limit": float64(2), "withPages": true}))
+	require.Equal(t,
+		`{"errors":[{"message":"variable $title of non-null type must be set"}]}`,
+		execute(t, query, nil))
+
+	// fragments are merged with the fields selected under the same key.
+	require.Equal(t,
+		`{"data":{"book":{"title":"The Hobbit","pages":310,"author":{"name":"Tolkien"}}}}`,
+		execute(t, `
+			{
+				book(title: "The Hobbit") @skip(if: false) { ...Summary author { name } }
+				... on Query { book(title: "The Hobbit") { title @skip(if: true) } }
+				fail @include(if: false)
+			}
+			fragment Summary on Book { title ... @include(if: true) { pages } }`, nil))
+}
+
+func TestSchema_ExecuteErrors(t *testing.T) {
+	// failed resolutions are null, with the path of the field.
+	require.Equal(t,
+		`{"data":{"a":null,"books":[{"title":"The Hobbit"},{"title":"The Silmarillion"}]},"errors":[{"message":"failed","path":["a"]}]}`,
+		execute(t, `{ a: fail books { title } }`, nil))
+	require.Equal(t,
+		`{"data":{"books":[{"author":{"books":null}},{"author":{"books":null}}]},"errors":[{"message":"argument limit must be an int","path":["books",0,"author","books"]},{"message":"argument limit must be an int","path":["books",1,"author","books"]}]}`,
+		execute(t, `{ books { author { books(limit: "one") { title } } } }`, nil))
+
+	// invalid requests are not executed.
+	cases := []struct {
+		query string
+		err   string
+	}{
+		{`{ books { isbn } }`, `cannot query field "isbn" on type "Book"`},
+		{`{ book(name: "x") { title } }`, `unknown argument "name" of field "book" on type "Query"`},
+		{`{ books }`, `field "books" on type "Query" must have a selection of "Book" fields`},
+		{`{ books { title { x } } }`, `field "title" on type "Book" is a scalar and must not have a selection`},
+		{`{ book(title: $title) { title } }`, `variable $title is not defined`},
+		{`{ books { ...F } } fragment F on Book { author { books { ...F } } }`, `fragment "F" spreads itself`},
+		{`{ ...F } fragment F on Book { title }`, `fragment "F" on type "Book" cannot be spread on type "Query"`},
+		{`{ books { title @live } }`, `unknown directive @live`},
+		{"{ books {\n  title(\n} }", `syntax error at line 3, column 1: unexpected "}"`},
+		{`{ book(title: "x) { title } }`, `syntax error at line 1, column 15: unterminated string`},
+		{`mutation { books { title } }`, `syntax error at line 1, column 1: mutation operations are not supported`},
+		{`query A { books { title } } query B { fail }`, `operation name is required by documents of 2 operations`},
+	}
+	for _, c := range cases {
+		res := testSchema().Execute(context.Background(), Request{Query: c.query})
+		require.Nil(t, res.Data, c.query)
+		require.Len(t, res.Errors, 1, c.query)
+		require.Equal(t, c.err, res.Errors[0].Message, c.query)
+	}
+
+	res := testSchema().Execute(context.Background(), Request{
+		Query:         `query A { books { title } } query B { fail }`,
+		OperationName: "B",
+	})
+	require.Equal(t, "fail: failed", res.Errors[0].Error())
+}
@@ -0,0 +1,95 @@
+// Package headexport exports the latest head of the provider chain to external systems whenever
+// it changes, e.g. to update the DNSLink TXT record of the provider or an external registry,
+// through pluggable exporters.
+package headexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/ipfs/go-cid"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds an export when no timeout is given.
+const DefaultTimeout = 30 * time.Second
+
+// CidPlaceholder is replaced with the head in the urls of HTTPPut exporters.
+const CidPlaceholder = "{cid}"
+
+// Exporter exports the head of the provider chain.
+type Exporter interface {
+	ExportHead(ctx context.Context, head cid.Cid) error
+}
+
+// Func turns a function into an Exporter.
+type Func func(ctx context.Context, head cid.Cid) error
+
+func (f Func) ExportHead(ctx context.Context, head cid.Cid) error {
+	return f(ctx, head)
+}
+
+// HTTPPut puts the head as text to a URL.
+type HTTPPut struct {
+	c   *resty.Client
+	url string
+}
+
+// NewHTTPPut instantiates an exporter putting the head as text/plain to url, with
+// CidPlaceholder in url replaced with the head. If timeout is zero DefaultTimeout is used.
+func NewHTTPPut(url string, timeout time.Duration) *HTTPPut {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &HTTPPut{c: resty.New().SetTimeout(timeout), url: url}
+}
+
+func (h *HTTPPut) ExportHead(ctx context.Context, head cid.Cid) error {
+	res, err := h.c.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "text/plain").
+		SetBody(head.String()).
+		Put(strings.ReplaceAll(h.url, CidPlaceholder, head.String()))
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return fmt.Errorf("head export url returned %s", res.Status())
+	}
+	return nil
+}
+
+// Command runs a shell command with the head in its environment.
+type Command struct {
+	command string
+	timeout time.Duration
+}
+
+// NewCommand instantiates an exporter running command with sh, with the head in the HEAD_CID
+// environment variable. The command fails the export if it exits with a non-zero status or is
+// still running after timeout. If timeout is zero DefaultTimeout is used.
+func NewCommand(command string, timeout time.Duration) *Command {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Command{command: command, timeout: timeout}
+}
+
+func (c *Command) ExportHead(ctx context.Context, head cid.Cid) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.command)
+	cmd.Env = append(os.Environ(), "HEAD_CID="+head.String())
+	if _, err := cmd.Output(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("head export command failed: %w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("head export command failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package headexport
+
+import (
+	"context"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPPut(t *testing.T) {
+	var path, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "text/plain", r.Header.Get("Content-Type"))
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		path, body = r.URL.Path, string(b)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	c, err := cid.Decode("bafkqaaa")
+	require.NoError(t, err)
+	require.NoError(t, NewHTTPPut(srv.URL+"/heads/"+CidPlaceholder, 0).ExportHead(context.Background(), c))
+	require.Equal(t, "/heads/"+c.String(), path)
+	require.Equal(t, c.String(), body)
+
+	status = http.StatusInternalServerError
+	require.Error(t, NewHTTPPut(srv.URL, 0).ExportHead(context.Background(), c))
+}
+
+func TestCommand(t *testing.T) {
+	c, err := cid.Decode("bafkqaaa")
+	require.NoError(t, err)
+	out := filepath.Join(t.TempDir(), "head")
+	require.NoError(t, NewCommand(`printf %s "$HEAD_CID" > `+out, 0).ExportHead(context.Background(), c))
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, c.String(), string(b))
+
+	err = NewCommand("echo failed >&2; exit 1", 0).ExportHead(context.Background(), c)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "failed"), err.Error())
+
+	require.Error(t, NewCommand("exec sleep 5", 100*time.Millisecond).ExportHead(context.Background(), c))
+}
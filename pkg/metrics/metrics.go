@@ -0,0 +1,105 @@
+// Package metrics holds the prometheus metrics of the client, registered on a dedicated
+// registry served by the admin server.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "pando_client"
+
+var (
+	// Registry is the registry of all the metrics of the client.
+	Registry = prometheus.NewRegistry()
+
+	// BlocksStored counts the blocks written through the engine link system.
+	BlocksStored = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "linksystem",
+		Name:      "blocks_stored_total",
+		Help:      "Number of blocks stored through the engine link system.",
+	})
+
+	// DedupHits counts the blocks written that were already stored.
+	DedupHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "linksystem",
+		Name:      "dedup_hits_total",
+		Help:      "Number of stored blocks that were already present and deduplicated.",
+	})
+
+	// DedupBytesSaved counts the bytes not written thanks to deduplication.
+	DedupBytesSaved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "linksystem",
+		Name:      "dedup_saved_bytes_total",
+		Help:      "Number of bytes not written thanks to block deduplication.",
+	})
+
+	// BlockCacheHits counts the blocks loaded from the in-memory block cache.
+	BlockCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blockstore",
+		Name:      "cache_hits_total",
+		Help:      "Number of blocks loaded from the in-memory block cache.",
+	})
+
+	// BlockCacheMisses counts the blocks loaded from the datastore because they were not cached.
+	BlockCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blockstore",
+		Name:      "cache_misses_total",
+		Help:      "Number of blocks not found in the in-memory block cache.",
+	})
+
+	// InclusionLatency observes the time between the first publication of a metadata and the
+	// confirmation of its inclusion by Pando.
+	InclusionLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "inclusion",
+		Name:      "latency_seconds",
+		Help:      "Time between the publication of a metadata and its inclusion confirmation by Pando.",
+		// from 5s to about 11h.
+		Buckets: prometheus.ExponentialBuckets(5, 2, 14),
+	})
+
+	// PendingInclusions is the number of published metadatas not confirmed by Pando yet.
+	PendingInclusions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "inclusion",
+		Name:      "pending",
+		Help:      "Number of published metadatas whose inclusion is not confirmed by Pando yet.",
+	})
+
+	// OldestPendingAge is the age of the oldest published metadata not confirmed by Pando yet,
+	// updated on every inclusion check.
+	OldestPendingAge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "inclusion",
+		Name:      "oldest_pending_age_seconds",
+		Help:      "Age of the oldest published metadata whose inclusion is not confirmed by Pando yet.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		BlocksStored,
+		DedupHits,
+		DedupBytesSaved,
+		BlockCacheHits,
+		BlockCacheMisses,
+		InclusionLatency,
+		PendingInclusions,
+		OldestPendingAge,
+	)
+}
+
+// Handler serves the metrics of Registry in the prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
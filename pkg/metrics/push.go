@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/graphite"
+	dto "github.com/prometheus/client_model/go"
+	"math"
+	"net"
+	"pandoClient/pkg/util/log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = log.NewSubsystemLogger()
+
+const (
+	// DefaultPushInterval is the interval the metrics are pushed at when no interval is given.
+	DefaultPushInterval = 15 * time.Second
+	// maxStatsDPacketSize keeps the StatsD datagrams below the usual MTU.
+	maxStatsDPacketSize = 1432
+)
+
+// Pusher pushes the metrics of Registry to a push-oriented monitoring stack, for the ones that
+// do not scrape the admin server.
+type Pusher interface {
+	// Run pushes the metrics every push interval until ctx is done.
+	Run(ctx context.Context)
+	// Push pushes the metrics once.
+	Push() error
+}
+
+// StatsD pushes the metrics of Registry to a StatsD server over UDP. StatsD has no labels, the
+// label values are appended to the metric names. Counters are pushed as the increments since
+// the previous push, histograms and summaries as their _sum and _count counters, and all the
+// other metrics as gauges.
+type StatsD struct {
+	addr     string
+	prefix   string
+	interval time.Duration
+
+	mutex sync.Mutex
+	// counts are the values of the counters at the previous push.
+	counts map[string]float64
+}
+
+// NewStatsD instantiates a pusher to the StatsD server at the host:port addr, every interval,
+// DefaultPushInterval if zero. The metric names are prefixed with prefix, if not empty.
+func NewStatsD(addr, prefix string, interval time.Duration) (*StatsD, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid StatsD address %s: %w", addr, err)
+	}
+	if interval <= 0 {
+		interval = DefaultPushInterval
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &StatsD{addr: addr, prefix: prefix, interval: interval, counts: make(map[string]float64)}, nil
+}
+
+func (s *StatsD) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Push(); err != nil {
+				logger.Warnw("Failed to push metrics to StatsD", "addr", s.addr, "err", err)
+			}
+		}
+	}
+}
+
+func (s *StatsD) Push() error {
+	mfs, err := Registry.Gather()
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var packet bytes.Buffer
+	for _, line := range s.lines(mfs) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsDPacketSize {
+			if _, err = conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+// lines returns the StatsD lines of mfs and records the values of their counters.
+func (s *StatsD) lines(mfs []*dto.MetricFamily) []string {
+	var lines []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			name := s.prefix + statsDName(mf.GetName(), m.GetLabel())
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = s.appendCount(lines, name, m.GetCounter().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				lines = s.appendCount(lines, name+"_sum", m.GetHistogram().GetSampleSum())
+				lines = s.appendCount(lines, name+"_count", float64(m.GetHistogram().GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				lines = s.appendCount(lines, name+"_sum", m.GetSummary().GetSampleSum())
+				lines = s.appendCount(lines, name+"_count", float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_GAUGE:
+				lines = appendGauge(lines, name, m.GetGauge().GetValue())
+			default:
+				lines = appendGauge(lines, name, m.GetUntyped().GetValue())
+			}
+		}
+	}
+	return lines
+}
+
+// appendCount appends the increment of the counter name since the previous push, if any.
+func (s *StatsD) appendCount(lines []string, name string, v float64) []string {
+	delta := v - s.counts[name]
+	if delta < 0 {
+		// the counter was reset.
+		delta = v
+	}
+	s.counts[name] = v
+	if delta == 0 {
+		return lines
+	}
+	return append(lines, name+":"+formatStatsDValue(delta)+"|c")
+}
+
+func appendGauge(lines []string, name string, v float64) []string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return lines
+	}
+	if v < 0 {
+		// signed gauge values are relative, the gauge is reset first.
+		lines = append(lines, name+":0|g")
+	}
+	return append(lines, name+":"+formatStatsDValue(v)+"|g")
+}
+
+func formatStatsDValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// statsDName joins name and the label values with dots, with the characters StatsD does not
+// support replaced with underscores.
+func statsDName(name string, labels []*dto.LabelPair) string {
+	parts := []string{sanitizeStatsD(name)}
+	for _, l := range labels {
+		parts = append(parts, sanitizeStatsD(l.GetValue()))
+	}
+	return strings.Join(parts, ".")
+}
+
+func sanitizeStatsD(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// graphiteLogger logs the push failures of the Graphite bridge.
+type graphiteLogger struct{}
+
+func (graphiteLogger) Println(v ...interface{}) {
+	logger.Warn(v...)
+}
+
+// NewGraphite instantiates a pusher to the Graphite server at the host:port addr, over the
+// plaintext protocol, every interval, DefaultPushInterval if zero. The metric names are
+// prefixed with prefix, pando_client if empty.
+func NewGraphite(addr, prefix string, interval time.Duration) (Pusher, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid Graphite address %s: %w", addr, err)
+	}
+	if interval <= 0 {
+		interval = DefaultPushInterval
+	}
+	// the bridge always separates the prefix from the names with a dot.
+	prefix = strings.TrimSuffix(prefix, ".")
+	if prefix == "" {
+		prefix = namespace
+	}
+	b, err := graphite.NewBridge(&graphite.Config{
+		URL:           addr,
+		Prefix:        prefix,
+		Interval:      interval,
+		Timeout:       interval,
+		Gatherer:      Registry,
+		Logger:        graphiteLogger{},
+		ErrorHandling: graphite.ContinueOnError,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
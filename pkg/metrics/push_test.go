@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = NewStatsD("localhost", "", 0)
+	require.Error(t, err)
+	s, err := NewStatsD(conn.LocalAddr().String(), "test", 0)
+	require.NoError(t, err)
+
+	// read returns the lines of the datagrams of a push.
+	read := func() []string {
+		var lines []string
+		buf := make([]byte, maxStatsDPacketSize)
+		for {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			require.LessOrEqual(t, n, maxStatsDPacketSize)
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+
+	PendingInclusions.Set(-2)
+	require.NoError(t, s.Push())
+	lines := read()
+	require.Contains(t, lines, "test.pando_client_inclusion_pending:0|g")
+	require.Contains(t, lines, "test.pando_client_inclusion_pending:-2|g")
+
+	BlocksStored.Add(3)
+	require.NoError(t, s.Push())
+	lines = read()
+	require.Contains(t, lines, "test.pando_client_linksystem_blocks_stored_total:3|c")
+	for _, line := range lines {
+		require.False(t, strings.HasPrefix(line, "test.pando_client_linksystem_dedup_hits_total:"), line)
+	}
+}
@@ -0,0 +1,262 @@
+package pandoapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/ipfs/go-cid"
+	"net/http"
+	"net/url"
+	"pandoClient/pkg/retry"
+	"pandoClient/pkg/util/log"
+	"strconv"
+	"time"
+)
+
+var logger = log.NewSubsystemLogger()
+
+// ErrBatchUnsupported is returned by MetaInclusions when Pando does not serve batched inclusion
+// queries.
+var ErrBatchUnsupported = errors.New("batched inclusion queries are not supported")
+
+// Client is a typed client of the Pando HTTP API.
+type Client struct {
+	c       *resty.Client
+	retrier *retry.Retrier
+}
+
+type responseJson struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"Data"`
+}
+
+// MetaInclusion is the inclusion status of a metadata in Pando.
+type MetaInclusion struct {
+	ID       cid.Cid `json:"ID"`
+	Provider string  `json:"Provider"`
+	InPando  bool    `json:"InPando"`
+	// InSnapShot tells whether the metadata is in a snapshot yet, SnapShotID and SnapShotHeight
+	// are the ones of the snapshot.
+	InSnapShot     bool    `json:"InSnapShot"`
+	SnapShotID     cid.Cid `json:"SnapShotID"`
+	SnapShotHeight uint64  `json:"SnapShotHeight"`
+	// Context and TranscationID are the ones of the transaction that stored the metadata in Pando.
+	Context       []byte `json:"Context"`
+	TranscationID int    `json:"TranscationID"`
+}
+
+// New instantiates a client of the Pando API served at baseURL.
+func New(baseURL string, timeout time.Duration) *Client {
+	return NewWithResty(resty.New().SetBaseURL(baseURL).SetTimeout(timeout).SetDebug(false))
+}
+
+// NewWithResty instantiates a client of the Pando API using an already configured resty client.
+func NewWithResty(c *resty.Client) *Client {
+	return &Client{c: c}
+}
+
+// SetRetrier retries failed requests with r. Requests are sent once if r is nil, the default.
+// Responses with a 4xx status code are not retried.
+func (c *Client) SetRetrier(r *retry.Retrier) {
+	c.retrier = r
+}
+
+// Resty returns the underlying resty client.
+func (c *Client) Resty() *resty.Client {
+	return c.c
+}
+
+// ProviderHead returns the latest metadata cid of provider known by Pando.
+func (c *Client) ProviderHead(ctx context.Context, provider string) (cid.Cid, error) {
+	var res struct{ Cid string }
+	err := c.get(ctx, "/provider/head", url.Values{"peerid": []string{provider}}, &res)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.Decode(res.Cid)
+}
+
+// MetaInclusion returns the inclusion status of the metadata c in Pando.
+func (c *Client) MetaInclusion(ctx context.Context, metaCid cid.Cid) (*MetaInclusion, error) {
+	var inclusion *MetaInclusion
+	err := c.get(ctx, "/metadata/inclusion", url.Values{"cid": []string{metaCid.String()}}, &inclusion)
+	if err != nil {
+		return nil, err
+	}
+	if inclusion == nil {
+		return nil, fmt.Errorf("got http response but unexpected inclusion data")
+	}
+	return inclusion, nil
+}
+
+// MetaInclusions returns the inclusion status of the metadatas metaCids in Pando with a single
+// request, in no particular order. The metadatas unknown to Pando may be missing from the result.
+// It fails with ErrBatchUnsupported if Pando does not serve batched inclusion queries.
+func (c *Client) MetaInclusions(ctx context.Context, metaCids []cid.Cid) ([]*MetaInclusion, error) {
+	req := struct {
+		Cids []string `json:"cids"`
+	}{Cids: make([]string, 0, len(metaCids))}
+	for _, metaCid := range metaCids {
+		req.Cids = append(req.Cids, metaCid.String())
+	}
+	data, err := c.do(ctx, http.MethodPost, "/metadata/inclusions", nil, req)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusMethodNotAllowed) {
+			return nil, fmt.Errorf("%w: %v", ErrBatchUnsupported, err)
+		}
+		return nil, err
+	}
+	var inclusions []*MetaInclusion
+	if err = json.Unmarshal(data, &inclusions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the result of /metadata/inclusions from PandoAPI: %w", err)
+	}
+	return inclusions, nil
+}
+
+// get requests path and decodes the Data of the response into dst.
+func (c *Client) get(ctx context.Context, path string, query url.Values, dst interface{}) error {
+	data, err := c.getData(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, dst); err != nil {
+		logger.Errorf("failed to unmarshal the result of %s from PandoAPI: %v", path, err)
+		return fmt.Errorf("failed to unmarshal the result of %s from PandoAPI: %w", path, err)
+	}
+	return nil
+}
+
+// getData requests path and returns the raw Data of the response.
+func (c *Client) getData(ctx context.Context, path string, query url.Values) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, path, query, nil)
+}
+
+// do sends the request and returns the raw Data of the response. The body is sent as json if
+// not nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}) (json.RawMessage, error) {
+	var data json.RawMessage
+	err := c.retrier.Do(ctx, func(ctx context.Context) error {
+		req := c.c.R().SetContext(ctx)
+		if len(query) != 0 {
+			req.SetQueryParamsFromValues(query)
+		}
+		if body != nil {
+			req.SetHeader("Content-Type", "application/json").SetBody(body)
+		}
+		res, err := HandleResError(req.Execute(method, path))
+		if err != nil {
+			if res != nil && res.StatusCode() >= 400 && res.StatusCode() < 500 {
+				return retry.Permanent(&StatusError{StatusCode: res.StatusCode(), err: err})
+			}
+			return err
+		}
+		resJson := responseJson{}
+		if err = json.Unmarshal(res.Body(), &resJson); err != nil {
+			return retry.Permanent(fmt.Errorf("failed to unmarshal PandoAPI response of %s: %w", path, err))
+		}
+		data = resJson.Data
+		return nil
+	})
+	return data, err
+}
+
+// StatusError is the error of a request rejected by the Pando API with a 4xx status code.
+type StatusError struct {
+	StatusCode int
+	err        error
+}
+
+func (e *StatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.err
+}
+
+// HandleResError turns unsuccessful responses of the Pando API into errors.
+func HandleResError(res *resty.Response, err error) (*resty.Response, error) {
+	errTmpl := "failed to request PandoAPI, error: %v"
+	if err != nil {
+		return res, err
+	}
+	if res.IsError() {
+		return res, fmt.Errorf(errTmpl, res.Error())
+	}
+	if res.StatusCode() != http.StatusOK {
+		return res, fmt.Errorf(errTmpl, fmt.Sprintf("expect 200, got %d", res.StatusCode()))
+	}
+
+	return res, nil
+}
+
+// Snapshot is a snapshot of the metadatas included in Pando since the previous snapshot.
+type Snapshot struct {
+	// Update lists the metadatas included in the snapshot by provider peer id.
+	Update       map[string]*Metalist `json:"Update"`
+	Height       uint64               `json:"Height"`
+	CreateTime   uint64               `json:"CreateTime"`
+	PrevSnapShot string               `json:"PrevSnapShot"`
+	ExtraInfo    json.RawMessage      `json:"ExtraInfo,omitempty"`
+}
+
+// Metalist is the list of metadatas of a provider in a snapshot.
+type Metalist struct {
+	MetaList []cid.Cid `json:"MetaList"`
+}
+
+// Snapshot returns the snapshot snapshotCid.
+func (c *Client) Snapshot(ctx context.Context, snapshotCid cid.Cid) (*Snapshot, error) {
+	return c.snapshot(ctx, url.Values{"cid": []string{snapshotCid.String()}})
+}
+
+// SnapshotByHeight returns the snapshot at height.
+func (c *Client) SnapshotByHeight(ctx context.Context, height uint64) (*Snapshot, error) {
+	return c.snapshot(ctx, url.Values{"height": []string{strconv.FormatUint(height, 10)}})
+}
+
+func (c *Client) snapshot(ctx context.Context, query url.Values) (*Snapshot, error) {
+	var snapshot *Snapshot
+	if err := c.get(ctx, "/metadata/snapshot", query, &snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("got http response but unexpected snapshot data")
+	}
+	return snapshot, nil
+}
+
+// SnapshotBackup is the Filecoin backup status of a snapshot of Pando.
+type SnapshotBackup struct {
+	SnapShotID cid.Cid `json:"SnapShotID"`
+	// IsBackup tells whether the snapshot is sent to Filecoin, its deals may not be sealed yet.
+	IsBackup bool `json:"IsBackup"`
+	// Deals are the storage deals of the snapshot.
+	Deals []BackupDeal `json:"Deals"`
+}
+
+// BackupDeal is a Filecoin storage deal of a snapshot backup.
+type BackupDeal struct {
+	DealID uint64 `json:"DealID"`
+	Miner  string `json:"Miner"`
+	// State is the state of the deal as reported by the storage market, e.g. StorageDealActive.
+	State  string `json:"State"`
+	Sealed bool   `json:"Sealed"`
+}
+
+// SnapshotBackup returns the Filecoin backup status of the snapshot snapshotCid.
+func (c *Client) SnapshotBackup(ctx context.Context, snapshotCid cid.Cid) (*SnapshotBackup, error) {
+	var backup *SnapshotBackup
+	err := c.get(ctx, "/metadata/backup", url.Values{"cid": []string{snapshotCid.String()}}, &backup)
+	if err != nil {
+		return nil, err
+	}
+	if backup == nil {
+		return nil, fmt.Errorf("got http response but unexpected backup data")
+	}
+	return backup, nil
+}
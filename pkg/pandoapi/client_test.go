@@ -0,0 +1,76 @@
+package pandoapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"pandoClient/pkg/retry"
+	"testing"
+	"time"
+)
+
+func TestClient_Retry(t *testing.T) {
+	calls := 0
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"code":200,"message":"ok","Data":{"Cid":"bafkqaaa"}}`)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, time.Second)
+	r, err := retry.New("test", retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+	c.SetRetrier(r)
+
+	head, err := c.ProviderHead(context.Background(), "provider")
+	require.NoError(t, err)
+	require.Equal(t, "bafkqaaa", head.String())
+	require.Equal(t, 3, calls)
+
+	// client errors are not retried.
+	calls = 0
+	status = http.StatusNotFound
+	_, err = c.ProviderHead(context.Background(), "provider")
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestClient_MetaInclusions(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/metadata/inclusions", r.URL.Path)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		var req struct{ Cids []string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, []string{"bafkqaaa"}, req.Cids)
+		_, _ = fmt.Fprint(w, `{"code":200,"message":"ok","Data":[{"ID":{"/":"bafkqaaa"},"InPando":true}]}`)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, time.Second)
+	metaCid, err := cid.Decode("bafkqaaa")
+	require.NoError(t, err)
+	inclusions, err := c.MetaInclusions(context.Background(), []cid.Cid{metaCid})
+	require.NoError(t, err)
+	require.Len(t, inclusions, 1)
+	require.Equal(t, metaCid, inclusions[0].ID)
+	require.True(t, inclusions[0].InPando)
+
+	status = http.StatusNotFound
+	_, err = c.MetaInclusions(context.Background(), []cid.Cid{metaCid})
+	require.True(t, errors.Is(err, ErrBatchUnsupported), err)
+}
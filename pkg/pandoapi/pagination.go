@@ -0,0 +1,272 @@
+package pandoapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// DefaultPageSize is the number of results requested per page from paginated endpoints.
+	DefaultPageSize = 100
+
+	pageQueryKey  = "page"
+	limitQueryKey = "limit"
+)
+
+// pagedData is the envelope of paginated results. Endpoints that are not paginated return the
+// results directly instead, which Iterator detects on the first response.
+type pagedData struct {
+	Items    []json.RawMessage `json:"Items"`
+	NextPage string            `json:"NextPage"`
+}
+
+// Iterator walks all the results of a list endpoint of the Pando API, transparently requesting
+// the following pages if the endpoint is paginated.
+type Iterator struct {
+	c        *Client
+	path     string
+	query    url.Values
+	pageSize int
+	// flatten converts a non-paginated, non-list response into its items.
+	flatten func(json.RawMessage) ([]json.RawMessage, error)
+
+	items    []json.RawMessage
+	cur      json.RawMessage
+	nextPage string
+	started  bool
+	done     bool
+	err      error
+}
+
+func (c *Client) iterate(path string, query url.Values, flatten func(json.RawMessage) ([]json.RawMessage, error)) *Iterator {
+	if query == nil {
+		query = url.Values{}
+	}
+	return &Iterator{
+		c:        c,
+		path:     path,
+		query:    query,
+		pageSize: DefaultPageSize,
+		flatten:  flatten,
+	}
+}
+
+// Next advances the iterator to the next result, fetching the next page when needed.
+// It returns false when all the results are consumed or an error occurred, see Err.
+func (it *Iterator) Next(ctx context.Context) bool {
+	for len(it.items) == 0 {
+		if it.err != nil || (it.started && it.done) {
+			return false
+		}
+		it.err = it.fetch(ctx)
+	}
+	it.cur, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Decode decodes the current result into dst.
+func (it *Iterator) Decode(dst interface{}) error {
+	if it.cur == nil {
+		return fmt.Errorf("no current result, call Next first")
+	}
+	return json.Unmarshal(it.cur, dst)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) fetch(ctx context.Context) error {
+	query := url.Values{}
+	for k, v := range it.query {
+		query[k] = v
+	}
+	query.Set(limitQueryKey, strconv.Itoa(it.pageSize))
+	if it.nextPage != "" {
+		query.Set(pageQueryKey, it.nextPage)
+	}
+	it.started = true
+
+	data, err := it.c.getData(ctx, it.path, query)
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		it.done = true
+	case data[0] == '[':
+		// not paginated, all the results are there.
+		it.done = true
+		return json.Unmarshal(data, &it.items)
+	case isPaged(data):
+		var page pagedData
+		if err = json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		it.items = page.Items
+		it.nextPage = page.NextPage
+		it.done = page.NextPage == ""
+	case it.flatten != nil:
+		it.done = true
+		it.items, err = it.flatten(data)
+		return err
+	default:
+		it.done = true
+		return fmt.Errorf("unexpected list result from %s: %s", it.path, string(data))
+	}
+
+	return nil
+}
+
+func isPaged(data json.RawMessage) bool {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	_, ok := probe["Items"]
+	return ok
+}
+
+// SnapshotIterator walks the cids of all the snapshots in Pando.
+type SnapshotIterator struct {
+	it  *Iterator
+	cur cid.Cid
+	err error
+}
+
+// Snapshots returns an iterator over the cids of all the snapshots in Pando.
+func (c *Client) Snapshots() *SnapshotIterator {
+	return &SnapshotIterator{it: c.iterate("/metadata/list", nil, nil)}
+}
+
+func (si *SnapshotIterator) Next(ctx context.Context) bool {
+	if si.err != nil || !si.it.Next(ctx) {
+		return false
+	}
+	var c cid.Cid
+	if si.err = si.it.Decode(&c); si.err != nil {
+		return false
+	}
+	si.cur = c
+	return true
+}
+
+func (si *SnapshotIterator) Snapshot() cid.Cid {
+	return si.cur
+}
+
+func (si *SnapshotIterator) Err() error {
+	if si.err != nil {
+		return si.err
+	}
+	return si.it.Err()
+}
+
+// ListSnapshots returns the cids of all the snapshots in Pando.
+func (c *Client) ListSnapshots(ctx context.Context) ([]cid.Cid, error) {
+	var res []cid.Cid
+	it := c.Snapshots()
+	for it.Next(ctx) {
+		res = append(res, it.Snapshot())
+	}
+	return res, it.Err()
+}
+
+// ProviderInfo is a provider registered in Pando.
+type ProviderInfo struct {
+	PeerID    peer.ID  `json:"PeerID"`
+	MultiAddr []string `json:"MultiAddr"`
+	MinerAddr string   `json:"MinerAddr"`
+}
+
+// ProviderIterator walks the providers registered in Pando.
+type ProviderIterator struct {
+	it  *Iterator
+	cur ProviderInfo
+	err error
+}
+
+// Providers returns an iterator over the providers registered in Pando.
+func (c *Client) Providers() *ProviderIterator {
+	return &ProviderIterator{it: c.iterate("/provider/info", nil, flattenProviders)}
+}
+
+func (pi *ProviderIterator) Next(ctx context.Context) bool {
+	if pi.err != nil || !pi.it.Next(ctx) {
+		return false
+	}
+	var info ProviderInfo
+	if pi.err = pi.it.Decode(&info); pi.err != nil {
+		return false
+	}
+	pi.cur = info
+	return true
+}
+
+func (pi *ProviderIterator) Provider() ProviderInfo {
+	return pi.cur
+}
+
+func (pi *ProviderIterator) Err() error {
+	if pi.err != nil {
+		return pi.err
+	}
+	return pi.it.Err()
+}
+
+// ListProviders returns all the providers registered in Pando.
+func (c *Client) ListProviders(ctx context.Context) ([]ProviderInfo, error) {
+	var res []ProviderInfo
+	it := c.Providers()
+	for it.Next(ctx) {
+		res = append(res, it.Provider())
+	}
+	return res, it.Err()
+}
+
+// ProviderInfo returns the provider peerID registered in Pando, nil if it is not registered.
+func (c *Client) ProviderInfo(ctx context.Context, peerID peer.ID) (*ProviderInfo, error) {
+	it := &ProviderIterator{it: c.iterate("/provider/info", url.Values{"peerid": []string{peerID.String()}}, flattenProviders)}
+	for it.Next(ctx) {
+		if info := it.Provider(); info.PeerID == peerID {
+			return &info, nil
+		}
+	}
+	return nil, it.Err()
+}
+
+// flattenProviders converts the unpaginated provider info response, keyed by peer id, into
+// ProviderInfo items.
+func flattenProviders(data json.RawMessage) ([]json.RawMessage, error) {
+	var res map[string]map[string]struct {
+		MultiAddr []string
+		MinerAddr string
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	for _, providers := range res {
+		for id, p := range providers {
+			peerID, err := peer.Decode(id)
+			if err != nil {
+				return nil, fmt.Errorf("invalid provider peer id %s: %w", id, err)
+			}
+			b, err := json.Marshal(ProviderInfo{PeerID: peerID, MultiAddr: p.MultiAddr, MinerAddr: p.MinerAddr})
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, b)
+		}
+	}
+	return items, nil
+}
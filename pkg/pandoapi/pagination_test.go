@@ -0,0 +1,109 @@
+package pandoapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serveData(t *testing.T, handler func(r *http.Request) interface{}) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.Marshal(handler(r))
+		require.NoError(t, err)
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL, time.Second)
+}
+
+func TestIterator_Paged(t *testing.T) {
+	pages := map[string]pagedData{
+		"":   {Items: []json.RawMessage{json.RawMessage(`1`), json.RawMessage(`2`)}, NextPage: "p2"},
+		"p2": {Items: []json.RawMessage{json.RawMessage(`3`)}},
+	}
+	c := serveData(t, func(r *http.Request) interface{} {
+		require.Equal(t, "100", r.URL.Query().Get(limitQueryKey))
+		return pages[r.URL.Query().Get(pageQueryKey)]
+	})
+
+	var res []int
+	it := c.iterate("/test", nil, nil)
+	for it.Next(context.Background()) {
+		var v int
+		require.NoError(t, it.Decode(&v))
+		res = append(res, v)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int{1, 2, 3}, res)
+}
+
+func TestIterator_Unpaged(t *testing.T) {
+	requests := 0
+	c := serveData(t, func(r *http.Request) interface{} {
+		requests++
+		return []int{1, 2}
+	})
+
+	var res []int
+	it := c.iterate("/test", nil, nil)
+	for it.Next(context.Background()) {
+		var v int
+		require.NoError(t, it.Decode(&v))
+		res = append(res, v)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int{1, 2}, res)
+	require.Equal(t, 1, requests)
+}
+
+func TestListProviders_Unpaged(t *testing.T) {
+	c := serveData(t, func(r *http.Request) interface{} {
+		return map[string]interface{}{
+			"registeredProviders": map[string]interface{}{
+				"12D3KooWNtUworDmrdTUjpZzjDWBWPMsEBZTiiMxxx8yU5RuNyLS": map[string]interface{}{
+					"MultiAddr": []string{"/ip4/127.0.0.1/tcp/9000"},
+					"MinerAddr": "t01000",
+				},
+			},
+		}
+	})
+
+	providers, err := c.ListProviders(context.Background())
+	require.NoError(t, err)
+	require.Len(t, providers, 1)
+	require.Equal(t, "12D3KooWNtUworDmrdTUjpZzjDWBWPMsEBZTiiMxxx8yU5RuNyLS", providers[0].PeerID.String())
+	require.Equal(t, "t01000", providers[0].MinerAddr)
+}
+
+func TestProviderInfo(t *testing.T) {
+	id := "12D3KooWNtUworDmrdTUjpZzjDWBWPMsEBZTiiMxxx8yU5RuNyLS"
+	c := serveData(t, func(r *http.Request) interface{} {
+		if r.URL.Query().Get("peerid") != id {
+			return nil
+		}
+		return map[string]interface{}{
+			"registeredProviders": map[string]interface{}{
+				id: map[string]interface{}{"MinerAddr": "t01000"},
+			},
+		}
+	})
+
+	p, err := peer.Decode(id)
+	require.NoError(t, err)
+	info, err := c.ProviderInfo(context.Background(), p)
+	require.NoError(t, err)
+	require.Equal(t, p, info.PeerID)
+	require.Equal(t, "t01000", info.MinerAddr)
+
+	other, err := peer.Decode("12D3KooWSUmWkA1GnqvnuhUL7Tn3MVDwHBwaMSWHBFoxCnAbJf8e")
+	require.NoError(t, err)
+	info, err = c.ProviderInfo(context.Background(), other)
+	require.NoError(t, err)
+	require.Nil(t, info)
+}
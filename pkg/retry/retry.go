@@ -0,0 +1,240 @@
+// Package retry retries failing operations with exponential backoff and jitter, optionally
+// guarded by a circuit breaker that fails fast once a dependency keeps failing.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"pandoClient/pkg/util/log"
+	"sync"
+	"time"
+)
+
+var logger = log.NewSubsystemLogger()
+
+// ErrCircuitOpen is returned without calling the operation while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Policy configures how an operation is retried.
+type Policy struct {
+	// MaxAttempts is the number of calls of the operation, including the first one.
+	// Values below 1 are treated as 1.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts, 0 for no cap.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each attempt, values below 1 are treated as 1.
+	Multiplier float64
+	// Jitter randomizes each backoff by up to this fraction of it, in [0, 1].
+	Jitter float64
+	// BreakerThreshold is the number of consecutive failed operations that opens the circuit
+	// breaker, 0 to disable it.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit breaker stays open before operations are let
+	// through again.
+	BreakerCooldown time.Duration
+}
+
+// DefaultPolicy retries 3 times with a backoff from 500ms to 10s, without circuit breaker.
+var DefaultPolicy = Policy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// NoRetry calls operations once.
+var NoRetry = Policy{MaxAttempts: 1}
+
+// Validate checks that the policy is consistent.
+func (p Policy) Validate() error {
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 || p.BreakerCooldown < 0 {
+		return fmt.Errorf("retry durations can not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be in [0, 1], got %v", p.Jitter)
+	}
+	if p.BreakerThreshold < 0 {
+		return fmt.Errorf("circuit breaker threshold can not be negative")
+	}
+	if p.BreakerThreshold > 0 && p.BreakerCooldown == 0 {
+		return fmt.Errorf("circuit breaker cooldown must be positive")
+	}
+	return nil
+}
+
+// Backoff returns the wait after the failed attempt, starting from 1, before jitter.
+func (p Policy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+func (p Policy) jittered(backoff time.Duration) time.Duration {
+	if p.Jitter == 0 || backoff <= 0 {
+		return backoff
+	}
+	delta := p.Jitter * float64(backoff)
+	return time.Duration(float64(backoff) - delta + 2*delta*rand.Float64())
+}
+
+// permanentError marks an error that must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that it is returned right away instead of being retried, e.g. for
+// invalid requests. A nil err stays nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent tells whether err was wrapped by Permanent.
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// Retrier retries the operations of a component according to its policy. Its circuit breaker is
+// shared by all the operations, so it must be used for a single dependency.
+type Retrier struct {
+	name   string
+	policy Policy
+
+	mutex    sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// New instantiates a retrier of the component name, which is used in logs.
+func New(name string, policy Policy) (*Retrier, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid retry policy of %s: %w", name, err)
+	}
+	return &Retrier{name: name, policy: policy}, nil
+}
+
+// Policy returns the policy of the retrier.
+func (r *Retrier) Policy() Policy {
+	return r.policy
+}
+
+// Do calls op until it succeeds, returns a permanent error, the attempts are exhausted or ctx is
+// done. It returns ErrCircuitOpen without calling op while the circuit breaker is open.
+// The returned error is the last one of op, unwrapped if permanent.
+func (r *Retrier) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	if r == nil {
+		return unwrapPermanent(op(ctx))
+	}
+	if err := r.allow(); err != nil {
+		return err
+	}
+
+	attempts := r.policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = op(ctx); err == nil {
+			r.succeeded()
+			return nil
+		}
+		if IsPermanent(err) {
+			// the dependency answered, it is not failing.
+			r.succeeded()
+			return unwrapPermanent(err)
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			break
+		}
+		backoff := r.policy.jittered(r.policy.Backoff(attempt))
+		logger.Debugw("Operation failed, retrying", "component", r.name, "attempt", attempt, "backoff", backoff, "err", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.failed()
+			return err
+		case <-timer.C:
+		}
+	}
+	r.failed()
+	return err
+}
+
+// Open tells whether the circuit breaker is open.
+func (r *Retrier) Open() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.openLocked()
+}
+
+func (r *Retrier) openLocked() bool {
+	return !r.openedAt.IsZero() && time.Since(r.openedAt) < r.policy.BreakerCooldown
+}
+
+func (r *Retrier) allow() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.openLocked() {
+		return fmt.Errorf("%s: %w", r.name, ErrCircuitOpen)
+	}
+	return nil
+}
+
+func (r *Retrier) succeeded() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.openedAt.IsZero() {
+		logger.Infow("Circuit breaker closed", "component", r.name)
+	}
+	r.failures = 0
+	r.openedAt = time.Time{}
+}
+
+func (r *Retrier) failed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failures++
+	if r.policy.BreakerThreshold == 0 || r.failures < r.policy.BreakerThreshold {
+		return
+	}
+	// the first failure after the cooldown opens the breaker again.
+	r.openedAt = time.Now()
+	logger.Warnw("Circuit breaker opened", "component", r.name, "failures", r.failures, "cooldown", r.policy.BreakerCooldown)
+}
+
+func unwrapPermanent(err error) error {
+	if pe, ok := err.(*permanentError); ok {
+		return pe.err
+	}
+	return err
+}
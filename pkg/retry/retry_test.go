@@ -0,0 +1,112 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var errFailed = errors.New("failed")
+
+func TestRetrier_Do(t *testing.T) {
+	r, err := New("test", Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Jitter: 0.5})
+	require.NoError(t, err)
+
+	calls := 0
+	err = r.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFailed
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = r.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errFailed
+	})
+	require.Equal(t, errFailed, err)
+	require.Equal(t, 3, calls)
+
+	// permanent errors are not retried.
+	calls = 0
+	err = r.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return Permanent(errFailed)
+	})
+	require.Equal(t, errFailed, err)
+	require.Equal(t, 1, calls)
+
+	// nil retriers call operations once.
+	var nilRetrier *Retrier
+	calls = 0
+	err = nilRetrier.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errFailed
+	})
+	require.Equal(t, errFailed, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetrier_Do_ContextDone(t *testing.T) {
+	r, err := New("test", Policy{MaxAttempts: 10, InitialBackoff: time.Hour})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err = r.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return errFailed
+	})
+	require.Equal(t, errFailed, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetrier_Breaker(t *testing.T) {
+	r, err := New("test", Policy{MaxAttempts: 1, BreakerThreshold: 2, BreakerCooldown: 100 * time.Millisecond})
+	require.NoError(t, err)
+	fail := func(ctx context.Context) error { return errFailed }
+
+	require.Equal(t, errFailed, r.Do(context.Background(), fail))
+	require.False(t, r.Open())
+	require.Equal(t, errFailed, r.Do(context.Background(), fail))
+	require.True(t, r.Open())
+
+	called := false
+	err = r.Do(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.False(t, called)
+
+	// operations are let through after the cooldown and close the breaker on success.
+	time.Sleep(150 * time.Millisecond)
+	require.NoError(t, r.Do(context.Background(), func(ctx context.Context) error { return nil }))
+	require.False(t, r.Open())
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	require.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	require.Equal(t, 300*time.Millisecond, p.Backoff(2))
+	require.Equal(t, 900*time.Millisecond, p.Backoff(3))
+	require.Equal(t, time.Second, p.Backoff(4))
+	require.Equal(t, time.Second, p.Backoff(100))
+
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		b := p.jittered(p.Backoff(1))
+		require.True(t, b >= 80*time.Millisecond && b <= 120*time.Millisecond, b)
+	}
+
+	require.Error(t, Policy{Jitter: 2}.Validate())
+	require.Error(t, Policy{BreakerThreshold: 1}.Validate())
+	require.NoError(t, DefaultPolicy.Validate())
+}
@@ -1 +1,203 @@
 package schema
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	sc "github.com/kenlabs/pando/pkg/types/schema"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+)
+
+// Version is the version of the schema of a metadata payload.
+type Version int
+
+const (
+	// V1 payloads are the data itself, of any kind.
+	V1 Version = 1
+	// V2 payloads are an envelope map with the data along with its content type, labels and
+	// chunking:
+	//   {SchemaVersion: 2, ContentType: string, Labels: {key: value}, Chunking: {...}, Data: data}
+	// ContentType, Labels and Chunking are left out when empty.
+	V2 Version = 2
+)
+
+// ErrUnsupportedVersion is returned when decoding a payload envelope of an unknown version.
+var ErrUnsupportedVersion = errors.New("unsupported payload schema version")
+
+const (
+	keySchemaVersion = "SchemaVersion"
+	keyContentType   = "ContentType"
+	keyLabels        = "Labels"
+	keyChunking      = "Chunking"
+	keyData          = "Data"
+)
+
+// Chunking describes how the data of a payload is split into chunks.
+type Chunking struct {
+	// ChunkSize is the maximum size of the chunks, Chunks their number and Size the total size of
+	// the data.
+	ChunkSize int64
+	Chunks    int64
+	Size      int64
+}
+
+// Payload is a decoded metadata payload, whatever the version of its schema.
+type Payload struct {
+	Version     Version
+	ContentType string
+	Labels      map[string]string
+	Chunking    *Chunking
+	// Data is the payload data: the whole payload of a v1 metadata, the data of the envelope of
+	// a v2 one.
+	Data datamodel.Node
+}
+
+// EncodePayloadV2 builds the v2 envelope of p, whatever its version.
+func EncodePayloadV2(p *Payload) (datamodel.Node, error) {
+	if p.Data == nil {
+		return nil, fmt.Errorf("payload data can not be nil")
+	}
+	size := int64(2)
+	if p.ContentType != "" {
+		size++
+	}
+	if len(p.Labels) != 0 {
+		size++
+	}
+	if p.Chunking != nil {
+		size++
+	}
+	keys := make([]string, 0, len(p.Labels))
+	for k := range p.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return qp.BuildMap(basicnode.Prototype.Map, size, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, keySchemaVersion, qp.Int(int64(V2)))
+		if p.ContentType != "" {
+			qp.MapEntry(ma, keyContentType, qp.String(p.ContentType))
+		}
+		if len(keys) != 0 {
+			qp.MapEntry(ma, keyLabels, qp.Map(int64(len(keys)), func(ma datamodel.MapAssembler) {
+				for _, k := range keys {
+					qp.MapEntry(ma, k, qp.String(p.Labels[k]))
+				}
+			}))
+		}
+		if c := p.Chunking; c != nil {
+			qp.MapEntry(ma, keyChunking, qp.Map(3, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "ChunkSize", qp.Int(c.ChunkSize))
+				qp.MapEntry(ma, "Chunks", qp.Int(c.Chunks))
+				qp.MapEntry(ma, "Size", qp.Int(c.Size))
+			}))
+		}
+		qp.MapEntry(ma, keyData, qp.Node(p.Data))
+	})
+}
+
+// DecodePayload decodes the payload n of a metadata. A map with SchemaVersion and Data entries is
+// a versioned envelope, anything else a v1 payload returned as the data. It fails with
+// ErrUnsupportedVersion for the envelopes of other versions than v2.
+func DecodePayload(n datamodel.Node) (*Payload, error) {
+	if n == nil {
+		return nil, fmt.Errorf("payload can not be nil")
+	}
+	v1 := &Payload{Version: V1, Data: n}
+	if n.Kind() != datamodel.Kind_Map {
+		return v1, nil
+	}
+	versionNode, err := n.LookupByString(keySchemaVersion)
+	if err != nil {
+		return v1, nil
+	}
+	data, err := n.LookupByString(keyData)
+	if err != nil {
+		return v1, nil
+	}
+	version, err := versionNode.AsInt()
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload schema version: %w", err)
+	}
+	if Version(version) != V2 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	p := &Payload{Version: V2, Data: data}
+	if ct, err := n.LookupByString(keyContentType); err == nil {
+		if p.ContentType, err = ct.AsString(); err != nil {
+			return nil, fmt.Errorf("invalid payload content type: %w", err)
+		}
+	}
+	if labels, err := n.LookupByString(keyLabels); err == nil {
+		if p.Labels, err = decodeLabels(labels); err != nil {
+			return nil, err
+		}
+	}
+	if chunking, err := n.LookupByString(keyChunking); err == nil {
+		if p.Chunking, err = decodeChunking(chunking); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// DecodeMetaPayload decodes the payload of meta, see DecodePayload.
+func DecodeMetaPayload(meta *sc.Metadata) (*Payload, error) {
+	return DecodePayload(meta.Payload)
+}
+
+func decodeLabels(n datamodel.Node) (map[string]string, error) {
+	it := n.MapIterator()
+	if it == nil {
+		return nil, fmt.Errorf("invalid payload labels: not a map")
+	}
+	labels := make(map[string]string, n.Length())
+	for !it.Done() {
+		k, v, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		key, err := k.AsString()
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload label: %w", err)
+		}
+		if labels[key], err = v.AsString(); err != nil {
+			return nil, fmt.Errorf("invalid payload label %s: %w", key, err)
+		}
+	}
+	return labels, nil
+}
+
+func decodeChunking(n datamodel.Node) (*Chunking, error) {
+	c := &Chunking{}
+	for key, v := range map[string]*int64{"ChunkSize": &c.ChunkSize, "Chunks": &c.Chunks, "Size": &c.Size} {
+		vn, err := n.LookupByString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload chunking: %w", err)
+		}
+		if *v, err = vn.AsInt(); err != nil {
+			return nil, fmt.Errorf("invalid payload chunking %s: %w", key, err)
+		}
+	}
+	return c, nil
+}
+
+// NewMetaWithPayloadV2 is NewMetaWithPayloadNode with the v2 envelope of p as the payload.
+func NewMetaWithPayloadV2(p *Payload, provider peer.ID, signKey crypto.PrivKey, prev datamodel.Link) (*sc.Metadata, error) {
+	n, err := EncodePayloadV2(p)
+	if err != nil {
+		return nil, err
+	}
+	return NewMetaWithPayloadNode(n, provider, signKey, prev)
+}
+
+// NewMetaWithContentType is NewMetaWithBytesPayload recording the MIME type contentType of
+// payload, in its v2 envelope.
+func NewMetaWithContentType(payload []byte, contentType string, provider peer.ID, signKey crypto.PrivKey, prev datamodel.Link) (*sc.Metadata, error) {
+	p := &Payload{Version: V2, ContentType: contentType, Data: basicnode.NewBytes(payload)}
+	return NewMetaWithPayloadV2(p, provider, signKey, prev)
+}
@@ -0,0 +1,74 @@
+package adminserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"pandoClient/pkg/metrics"
+	"runtime"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var startTime = time.Now()
+
+// NewDebug instantiates the debug HTTP server, serving net/http/pprof under /debug/pprof/, the
+// runtime stats of the process on /debug/runtime and the metrics on /metrics.
+// It exposes the internals of the process, so it must only listen on a trusted address.
+func NewDebug(o ...Option) (*Server, error) {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", opts.listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := mux.NewRouter().StrictSlash(true)
+	server := &http.Server{
+		Handler:      r,
+		ReadTimeout:  opts.readTimeout,
+		WriteTimeout: opts.writeTimeout,
+	}
+	s := &Server{server: server, l: l}
+
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// the index also serves the named profiles, e.g. /debug/pprof/heap or /debug/pprof/goroutine.
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	r.HandleFunc("/debug/runtime", s.runtimeStats).
+		Methods(http.MethodGet)
+
+	r.Handle("/metrics", metrics.Handler()).
+		Methods(http.MethodGet)
+
+	return s, nil
+}
+
+func (s *Server) runtimeStats(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := &RuntimeStats{
+		Uptime:       time.Since(startTime).String(),
+		GoVersion:    runtime.Version(),
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapObjects:  m.HeapObjects,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalNs: m.PauseTotalNs,
+	}
+	if m.LastGC != 0 {
+		stats.LastGC = time.Unix(0, int64(m.LastGC))
+	}
+	respond(w, http.StatusOK, NewOKResponse("get runtime stats successfully!", stats))
+}
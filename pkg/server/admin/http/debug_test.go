@@ -0,0 +1,36 @@
+package adminserver
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebug(t *testing.T) {
+	s, err := NewDebug(WithListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.l.Close() })
+
+	var stats RuntimeStats
+	require.Equal(t, http.StatusOK, decodeData(t, do(s, http.MethodGet, "/debug/runtime", nil), &stats))
+	require.Equal(t, runtime.Version(), stats.GoVersion)
+	require.Equal(t, runtime.NumCPU(), stats.NumCPU)
+	require.NotZero(t, stats.Goroutines)
+	require.NotZero(t, stats.Sys)
+	require.NotEmpty(t, stats.Uptime)
+
+	w := do(s, http.MethodGet, "/debug/pprof/", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "goroutine")
+	// the index serves the named profiles.
+	w = do(s, http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "goroutine profile")
+	w = do(s, http.MethodGet, "/debug/pprof/cmdline", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Equal(t, http.StatusOK, do(s, http.MethodGet, "/metrics", nil).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, do(s, http.MethodPost, "/debug/runtime", nil).Code)
+}
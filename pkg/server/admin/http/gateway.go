@@ -0,0 +1,108 @@
+package adminserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"pandoClient/pkg/engine"
+
+	"github.com/gorilla/mux"
+	"github.com/ipfs/go-cid"
+)
+
+// NewGateway instantiates the read-only gateway HTTP server, serving the metadatas stored
+// locally as dag-json on /meta/{cid} and their payloads on /payload/{cid}. Nothing is synced
+// from Pando and nothing can be changed through it, so it can be exposed to dashboards and
+// scripts that must not reach the admin API.
+func NewGateway(e *engine.Engine, o ...Option) (*Server, error) {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", opts.listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := mux.NewRouter().StrictSlash(true)
+	server := &http.Server{
+		Handler:      r,
+		ReadTimeout:  opts.readTimeout,
+		WriteTimeout: opts.writeTimeout,
+	}
+	s := &Server{server: server, l: l, e: e}
+
+	r.HandleFunc("/meta/{cid}", s.gatewayMeta).
+		Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/payload/{cid}", s.gatewayPayload).
+		Methods(http.MethodGet, http.MethodHead)
+
+	return s, nil
+}
+
+func (s *Server) gatewayMeta(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeGatewayCid(w, r)
+	if !ok {
+		return
+	}
+	res, err := s.e.MetadataDagJson(context.Background(), c)
+	if err != nil {
+		gatewayError(w, c, err)
+		return
+	}
+	writeGatewayBody(w, r, c, "application/json", res)
+}
+
+func (s *Server) gatewayPayload(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeGatewayCid(w, r)
+	if !ok {
+		return
+	}
+	content, err := s.e.CatContentLocal(context.Background(), c)
+	if err != nil {
+		gatewayError(w, c, err)
+		return
+	}
+	writeGatewayBody(w, r, c, content.ContentType, content.Data)
+}
+
+func decodeGatewayCid(w http.ResponseWriter, r *http.Request) (cid.Cid, bool) {
+	c, err := cid.Decode(mux.Vars(r)["cid"])
+	if err != nil {
+		msg := fmt.Sprintf("invalid cid: %v", err)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return cid.Undef, false
+	}
+	return c, true
+}
+
+func gatewayError(w http.ResponseWriter, c cid.Cid, err error) {
+	msg := fmt.Sprintf("failed to get %s: %v", c.String(), err)
+	code := errorCode(err, http.StatusInternalServerError)
+	if code == http.StatusInternalServerError {
+		logger.Errorf(msg)
+	}
+	respond(w, code, NewErrorResponse(code, msg))
+}
+
+// writeGatewayBody writes body as the response, cacheable forever since c addresses it.
+func writeGatewayBody(w http.ResponseWriter, r *http.Request, c cid.Cid, contentType string, body []byte) {
+	etag := `"` + c.String() + `"`
+	w.Header().Set("Etag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(body); err != nil {
+		logger.Errorw("failed to write response", "err", err)
+	}
+}
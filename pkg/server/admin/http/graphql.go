@@ -0,0 +1,554 @@
+package adminserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"pandoClient/pkg/engine"
+	"pandoClient/pkg/graphql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/kenlabs/pando/pkg/types/schema"
+)
+
+const (
+	defaultChainDepth = 20
+	maxChainDepth     = 1000
+)
+
+var errStopWalk = errors.New("stop walk")
+
+// NewGraphQL instantiates the read-only GraphQL server, serving queries over the local state of
+// the engine on /graphql: its status, the publish history and receipts, the metadatas of the
+// chain and their payloads, and their inclusion in Pando. Like the gateway, nothing can be
+// changed through it, so dashboards can query it without reaching the admin API.
+//
+// Queries are posted as JSON, or as the raw query with the application/graphql content type,
+// or sent with GET in the query, operationName and variables parameters.
+func NewGraphQL(e *engine.Engine, o ...Option) (*Server, error) {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", opts.listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := mux.NewRouter().StrictSlash(true)
+	server := &http.Server{
+		Handler:      r,
+		ReadTimeout:  opts.readTimeout,
+		WriteTimeout: opts.writeTimeout,
+	}
+	s := &Server{server: server, l: l, e: e}
+
+	r.Handle("/graphql", &graphqlHandler{schema: newGraphQLSchema(e)}).
+		Methods(http.MethodGet, http.MethodPost)
+
+	return s, nil
+}
+
+type graphqlHandler struct {
+	schema *graphql.Schema
+}
+
+func (h *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: fmt.Sprintf("invalid variables: %v", err)}}})
+				return
+			}
+		}
+	} else if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: fmt.Sprintf("failed to read query: %v", err)}}})
+			return
+		}
+		req.Query = string(body)
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: fmt.Sprintf("invalid request: %v", err)}}})
+		return
+	}
+	if req.Query == "" {
+		writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: "query is required"}}})
+		return
+	}
+	writeGraphQL(w, http.StatusOK, h.schema.Execute(r.Context(), req))
+}
+
+func writeGraphQL(w http.ResponseWriter, statusCode int, res *graphql.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Errorw("failed to write response", "err", err)
+	}
+}
+
+// graphqlPublish is the source of the Publish objects, the receipt being loaded on demand.
+type graphqlPublish struct {
+	e       *engine.Engine
+	entry   engine.HistoryEntry
+	receipt *engine.Receipt
+}
+
+func (p *graphqlPublish) getReceipt(ctx context.Context) (*engine.Receipt, error) {
+	if p.receipt == nil {
+		r, err := p.e.GetReceipt(ctx, p.entry.Cid)
+		if err != nil {
+			return nil, err
+		}
+		p.receipt = r
+	}
+	return p.receipt, nil
+}
+
+// graphqlMeta is the source of the Metadata objects.
+type graphqlMeta struct {
+	c    cid.Cid
+	meta *schema.Metadata
+}
+
+// graphqlAnnotation is the source of the Annotation objects.
+type graphqlAnnotation struct {
+	key   string
+	value engine.AnnotationValue
+}
+
+// graphqlAnnotations returns the annotations a sorted by key.
+func graphqlAnnotations(a engine.Annotations) []*graphqlAnnotation {
+	res := make([]*graphqlAnnotation, 0, len(a))
+	for k, v := range a {
+		res = append(res, &graphqlAnnotation{key: k, value: v})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].key < res[j].key })
+	return res
+}
+
+// graphqlPayload is the source of the Payload objects.
+type graphqlPayload struct {
+	c       cid.Cid
+	content *engine.Content
+}
+
+func newGraphQLSchema(e *engine.Engine) *graphql.Schema {
+	annotationType := &graphql.Object{Name: "Annotation", Fields: map[string]*graphql.Field{
+		"key": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlAnnotation).key, nil
+		}},
+		"value": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlAnnotation).value.Value, nil
+		}},
+		"updatedAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*graphqlAnnotation).value.UpdatedAt), nil
+		}},
+	}}
+	deadLetterType := &graphql.Object{Name: "DeadLetter", Fields: map[string]*graphql.Field{
+		"attempts": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.DeadLetter).Attempts, nil
+		}},
+		"publishedAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*engine.DeadLetter).PublishedAt), nil
+		}},
+		"deadAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*engine.DeadLetter).DeadAt), nil
+		}},
+	}}
+
+	inclusionType := &graphql.Object{Name: "Inclusion", Fields: map[string]*graphql.Field{
+		"cid": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlCid(p.Source.(*engine.MetaInclusion).ID), nil
+		}},
+		"provider": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.MetaInclusion).Provider, nil
+		}},
+		"inPando": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.MetaInclusion).InPando, nil
+		}},
+		"inSnapshot": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.MetaInclusion).InSnapShot, nil
+		}},
+		"snapshot": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlCid(p.Source.(*engine.MetaInclusion).SnapShotID), nil
+		}},
+		"snapshotHeight": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.MetaInclusion).SnapShotHeight, nil
+		}},
+	}}
+	resolveInclusion := func(p graphql.Params, c cid.Cid) (interface{}, error) {
+		verify, err := p.Bool("verify", false)
+		if err != nil {
+			return nil, err
+		}
+		if verify {
+			return e.VerifyInclusion(p.Context, c)
+		}
+		return e.GetInclusion(p.Context, c)
+	}
+
+	payloadType := &graphql.Object{Name: "Payload", Fields: map[string]*graphql.Field{
+		"cid": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPayload).c.String(), nil
+		}},
+		"contentType": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPayload).content.ContentType, nil
+		}},
+		"size": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return len(p.Source.(*graphqlPayload).content.Data), nil
+		}},
+		"data": {Args: []string{"encoding"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			data := p.Source.(*graphqlPayload).content.Data
+			encoding, err := p.String("encoding")
+			if err != nil {
+				return nil, err
+			}
+			switch encoding {
+			case "", "base64":
+				return base64.StdEncoding.EncodeToString(data), nil
+			case "hex":
+				return hex.EncodeToString(data), nil
+			case "text":
+				return string(data), nil
+			default:
+				return nil, fmt.Errorf("unknown encoding %q, expected base64, hex or text", encoding)
+			}
+		}},
+	}}
+	resolvePayload := func(ctx context.Context, c cid.Cid) (interface{}, error) {
+		content, err := e.CatContentLocal(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return &graphqlPayload{c: c, content: content}, nil
+	}
+
+	publishType := &graphql.Object{Name: "Publish", Fields: map[string]*graphql.Field{
+		"cid": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPublish).entry.Cid.String(), nil
+		}},
+		"chain": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPublish).entry.Chain, nil
+		}},
+		"payloadSize": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPublish).entry.PayloadSize, nil
+		}},
+		"storedAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*graphqlPublish).entry.StoredAt), nil
+		}},
+		"publishedAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*graphqlPublish).entry.PublishedAt), nil
+		}},
+		"topic": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPublish).entry.Topic, nil
+		}},
+		"announce": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return string(p.Source.(*graphqlPublish).entry.Announce), nil
+		}},
+		"announcedAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*graphqlPublish).entry.AnnouncedAt), nil
+		}},
+		"announceError": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlPublish).entry.AnnounceError, nil
+		}},
+		"includedAt": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*graphqlPublish).entry.IncludedAt), nil
+		}},
+		"annotations": {Type: annotationType, Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlAnnotations(p.Source.(*graphqlPublish).entry.Annotations), nil
+		}},
+		"queued": {Resolve: func(p graphql.Params) (interface{}, error) {
+			r, err := p.Source.(*graphqlPublish).getReceipt(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			return r.Queued, nil
+		}},
+		"pending": {Resolve: func(p graphql.Params) (interface{}, error) {
+			r, err := p.Source.(*graphqlPublish).getReceipt(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			return r.Pending, nil
+		}},
+		"deadLetter": {Type: deadLetterType, Resolve: func(p graphql.Params) (interface{}, error) {
+			r, err := p.Source.(*graphqlPublish).getReceipt(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			return r.DeadLetter, nil
+		}},
+		"payload": {Type: payloadType, Resolve: func(p graphql.Params) (interface{}, error) {
+			return resolvePayload(p.Context, p.Source.(*graphqlPublish).entry.Cid)
+		}},
+		"inclusion": {Type: inclusionType, Args: []string{"verify"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			return resolveInclusion(p, p.Source.(*graphqlPublish).entry.Cid)
+		}},
+	}}
+	resolveReceipt := func(ctx context.Context, c cid.Cid) (interface{}, error) {
+		r, err := e.GetReceipt(ctx, c)
+		if errors.Is(err, engine.ErrNoReceipt) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &graphqlPublish{e: e, entry: r.HistoryEntry, receipt: r}, nil
+	}
+
+	metadataType := &graphql.Object{Name: "Metadata", Fields: map[string]*graphql.Field{
+		"cid": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlMeta).c.String(), nil
+		}},
+		"previousId": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlCid(previousCid(p.Source.(*graphqlMeta).meta)), nil
+		}},
+		"provider": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlMeta).meta.Provider, nil
+		}},
+		"cache": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlMeta).meta.Cache, nil
+		}},
+		"collection": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*graphqlMeta).meta.Collection, nil
+		}},
+		"payload": {Type: payloadType, Resolve: func(p graphql.Params) (interface{}, error) {
+			return resolvePayload(p.Context, p.Source.(*graphqlMeta).c)
+		}},
+		"publish": {Type: publishType, Resolve: func(p graphql.Params) (interface{}, error) {
+			return resolveReceipt(p.Context, p.Source.(*graphqlMeta).c)
+		}},
+		"inclusion": {Type: inclusionType, Args: []string{"verify"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			return resolveInclusion(p, p.Source.(*graphqlMeta).c)
+		}},
+	}}
+	resolveMeta := func(ctx context.Context, c cid.Cid) (interface{}, error) {
+		meta, err := e.LocalMetadata(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return &graphqlMeta{c: c, meta: meta}, nil
+	}
+	metadataType.Fields["previous"] = &graphql.Field{Type: metadataType, Resolve: func(p graphql.Params) (interface{}, error) {
+		prev := previousCid(p.Source.(*graphqlMeta).meta)
+		if !prev.Defined() {
+			return nil, nil
+		}
+		return resolveMeta(p.Context, prev)
+	}}
+
+	statusType := &graphql.Object{Name: "Status", Fields: map[string]*graphql.Field{
+		"latestMeta": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlCid(p.Source.(*engine.Status).LatestMeta), nil
+		}},
+		"chainLength": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.Status).ChainLength, nil
+		}},
+		"publisherKind": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return string(p.Source.(*engine.Status).PublisherKind), nil
+		}},
+		"started": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.Status).Started, nil
+		}},
+		"frozen": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.Status).Frozen, nil
+		}},
+		"freezeReason": {Resolve: func(p graphql.Params) (interface{}, error) {
+			if fs := p.Source.(*engine.Status).Freeze; fs != nil {
+				return fs.Reason, nil
+			}
+			return nil, nil
+		}},
+		"frozenSince": {Resolve: func(p graphql.Params) (interface{}, error) {
+			if fs := p.Source.(*engine.Status).Freeze; fs != nil {
+				return graphqlTime(fs.Since), nil
+			}
+			return nil, nil
+		}},
+		"pendingChecks": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.Status).PendingChecks, nil
+		}},
+		"lastCheck": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*engine.Status).LastCheck), nil
+		}},
+		"checkerPaused": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(*engine.Status).CheckerPaused, nil
+		}},
+		"lastAnnounced": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlCid(p.Source.(*engine.Status).LastAnnounced), nil
+		}},
+		"lastAnnounceTime": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return graphqlTime(p.Source.(*engine.Status).LastAnnounceTime), nil
+		}},
+	}}
+
+	return &graphql.Schema{Query: &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"status": {Type: statusType, Resolve: func(p graphql.Params) (interface{}, error) {
+			return e.Status(p.Context), nil
+		}},
+		// history returns the publishes of all the chains, or of chain if set, oldest first,
+		// from from to to in RFC 3339, and only the last ones if last is set.
+		"history": {Type: publishType, Args: []string{"from", "to", "chain", "last"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			from, err := graphqlTimeArg(p, "from")
+			if err != nil {
+				return nil, err
+			}
+			to, err := graphqlTimeArg(p, "to")
+			if err != nil {
+				return nil, err
+			}
+			last, err := p.Int("last", 0)
+			if err != nil {
+				return nil, err
+			}
+			chain, err := p.String("chain")
+			if err != nil {
+				return nil, err
+			}
+			_, byChain := p.Args["chain"]
+			entries, err := e.History(p.Context, from, to)
+			if err != nil {
+				return nil, err
+			}
+			res := make([]*graphqlPublish, 0, len(entries))
+			for _, entry := range entries {
+				if !byChain || entry.Chain == chain {
+					res = append(res, &graphqlPublish{e: e, entry: entry})
+				}
+			}
+			if last > 0 && last < len(res) {
+				res = res[len(res)-last:]
+			}
+			return res, nil
+		}},
+		// publish returns the receipt of the publish of cid, null if it is not published.
+		"publish": {Type: publishType, Args: []string{"cid"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			c, err := graphqlCidArg(p, "cid", true)
+			if err != nil {
+				return nil, err
+			}
+			return resolveReceipt(p.Context, c)
+		}},
+		"metadata": {Type: metadataType, Args: []string{"cid"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			c, err := graphqlCidArg(p, "cid", true)
+			if err != nil {
+				return nil, err
+			}
+			return resolveMeta(p.Context, c)
+		}},
+		// chain walks the local chain from from, or from the latest metadata, up to depth
+		// metadatas.
+		"chain": {Type: metadataType, Args: []string{"from", "depth"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			from, err := graphqlCidArg(p, "from", false)
+			if err != nil {
+				return nil, err
+			}
+			depth, err := p.Int("depth", defaultChainDepth)
+			if err != nil {
+				return nil, err
+			}
+			if depth <= 0 || depth > maxChainDepth {
+				return nil, fmt.Errorf("depth must be between 1 and %d", maxChainDepth)
+			}
+			var res []*graphqlMeta
+			err = e.WalkChain(p.Context, from, func(c cid.Cid, meta *schema.Metadata) error {
+				res = append(res, &graphqlMeta{c: c, meta: meta})
+				if len(res) == depth {
+					return errStopWalk
+				}
+				return nil
+			})
+			if err != nil && err != errStopWalk {
+				return nil, err
+			}
+			return res, nil
+		}},
+		"inclusion": {Type: inclusionType, Args: []string{"cid", "verify"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			c, err := graphqlCidArg(p, "cid", true)
+			if err != nil {
+				return nil, err
+			}
+			return resolveInclusion(p, c)
+		}},
+		"payload": {Type: payloadType, Args: []string{"cid"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			c, err := graphqlCidArg(p, "cid", true)
+			if err != nil {
+				return nil, err
+			}
+			return resolvePayload(p.Context, c)
+		}},
+	}}}
+}
+
+func previousCid(meta *schema.Metadata) cid.Cid {
+	if meta.PreviousID == nil {
+		return cid.Undef
+	}
+	if l, ok := (*meta.PreviousID).(cidlink.Link); ok {
+		return l.Cid
+	}
+	return cid.Undef
+}
+
+// graphqlCid returns c as a string, nil if it is undefined.
+func graphqlCid(c cid.Cid) interface{} {
+	if !c.Defined() {
+		return nil
+	}
+	return c.String()
+}
+
+// graphqlTime returns t in RFC 3339, nil if it is zero.
+func graphqlTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func graphqlCidArg(p graphql.Params, name string, required bool) (cid.Cid, error) {
+	s, err := p.String(name)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if s == "" {
+		if required {
+			return cid.Undef, fmt.Errorf("argument %s is required", name)
+		}
+		return cid.Undef, nil
+	}
+	c, err := cid.Decode(s)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("argument %s is not a valid cid: %v", name, err)
+	}
+	return c, nil
+}
+
+func graphqlTimeArg(p graphql.Params, name string) (time.Time, error) {
+	s, err := p.String(name)
+	if err != nil || s == "" {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("argument %s is not an RFC 3339 time: %v", name, err)
+	}
+	return t, nil
+}
@@ -1,13 +1,20 @@
 package adminserver
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"io"
 	"net/http"
 	"os"
+	"pandoClient/pkg/engine"
+	"strconv"
+	"time"
 )
 
 func (s *Server) announce(w http.ResponseWriter, r *http.Request) {
@@ -16,13 +23,85 @@ func (s *Server) announce(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		msg := fmt.Sprintf("failed to announce latest metadata: %v", err)
 		logger.Errorf(msg)
-		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
 		return
 	}
 
 	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("announce latest metadata successfully! cid: %s", c.String()), nil))
 }
 
+func (s *Server) republish(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+	logger.Infow("received republish request", "cid", c)
+	if err := s.e.Republish(context.Background(), c); err != nil {
+		msg := fmt.Sprintf("failed to republish metadata %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("republish metadata successfully! cid: %s", c.String()), nil))
+}
+
+func (s *Server) rollback(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+	logger.Infow("received rollback request", "cid", c)
+	rolledBack, err := s.e.Rollback(context.Background(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to roll back to metadata %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("roll back to metadata %s successfully!", c.String()), rolledBack))
+}
+
+func (s *Server) importChain(w http.ResponseWriter, r *http.Request) {
+	replace := r.URL.Query().Get("replace") == "true"
+	logger.Infow("received import chain request", "replace", replace)
+	imported, err := s.e.ImportChain(r.Context(), r.Body, replace)
+	if err != nil {
+		msg := fmt.Sprintf("failed to import chain: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("import chain of head %s successfully!", imported.Head.String()), imported))
+}
+
+func (s *Server) announceMessage(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received announce message request")
+	var m *engine.AnnounceMessage
+	var err error
+	if r.URL.Query().Get("last") == "true" {
+		m, err = s.e.LastAnnounceMessage()
+	} else {
+		m, err = s.e.NextAnnounceMessage(context.Background())
+	}
+	if err != nil {
+		msg := fmt.Sprintf("failed to get announce message: %v", err)
+		code := errorCode(err, http.StatusInternalServerError)
+		if code == http.StatusInternalServerError {
+			logger.Errorf(msg)
+		}
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("get announce message successfully!", m))
+}
+
 func (s *Server) addFile(w http.ResponseWriter, r *http.Request) {
 	logger.Infow("received import file request")
 
@@ -46,13 +125,103 @@ func (s *Server) addFile(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		msg := fmt.Sprintf("failed to publish data: %v", err)
 		logger.Errorf(msg)
-		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
 		return
 	}
 
 	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("successfully add file, cid: %s", c.String()), nil))
 }
 
+// catContentFormat is the cat format serving the payload as is with its content type as the
+// response, see Engine.CatContent.
+const catContentFormat engine.CatFormat = "content"
+
+func (s *Server) push(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received push request")
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("failed to read payload: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	var opts []engine.PublishOption
+	if codec := r.URL.Query().Get("codec"); codec != "" {
+		lp, err := s.e.LinkPrototypeWithCodec(engine.LinkCodec(codec))
+		if err != nil {
+			msg := fmt.Sprintf("invalid codec: %v", err)
+			logger.Errorf(msg)
+			respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+			return
+		}
+		opts = append(opts, engine.WithLinkPrototype(lp))
+	}
+	if payloadType := r.URL.Query().Get("type"); payloadType != "" {
+		opts = append(opts, engine.WithPayloadType(payloadType))
+	}
+	if r.URL.Query().Get("force") == "true" {
+		opts = append(opts, engine.WithForce())
+	}
+	if r.URL.Query().Get("async") == "true" {
+		opts = append(opts, engine.WithAsyncAnnounce())
+	}
+	if labels := r.URL.Query()["label"]; len(labels) > 0 {
+		opts = append(opts, engine.WithLabels(labels...))
+	}
+	if contentType := r.URL.Query().Get("content_type"); contentType != "" {
+		opts = append(opts, engine.WithContentType(contentType))
+	}
+
+	c, err := s.e.PublishBytesData(context.Background(), data, opts...)
+	if err != nil {
+		msg := fmt.Sprintf("failed to publish data: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("push successfully!", PushRes{Cid: c}))
+}
+
+func (s *Server) inclusion(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+
+	inclusion, err := s.e.VerifyInclusion(context.Background(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to verify inclusion of cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("verify inclusion successfully!", inclusion))
+}
+
+func (s *Server) inclusionRecord(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+
+	inclusion, err := s.e.GetInclusion(r.Context(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get inclusion of cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("get inclusion successfully!", inclusion))
+}
+
 func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
 	logger.Infow("received sync request")
 
@@ -71,11 +240,12 @@ func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := s.e.Sync(context.Background(), req.Cid, req.Depth, req.StopCid)
+	_, err := s.e.Sync(context.Background(), req.Cid, req.SyncDepth(), req.StopCid, req.SyncOptions()...)
 	if err != nil {
 		msg := fmt.Sprintf("failed to sync cid from Pando: %v", err)
 		logger.Errorf(msg)
-		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		code, res := syncErrorResponse(err, msg)
+		respond(w, code, res)
 		return
 	}
 
@@ -85,7 +255,8 @@ func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
 func (s *Server) showList(w http.ResponseWriter, r *http.Request) {
 	logger.Infow("received cid list request")
 
-	clist, err := s.e.GetPushedList(context.Background())
+	ctx := context.Background()
+	clist, err := s.e.GetPushedList(ctx)
 	if err != nil {
 		msg := fmt.Sprintf("failed to get cid list: %v", err)
 		logger.Errorf(msg)
@@ -93,57 +264,1100 @@ func (s *Server) showList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respond(w, http.StatusOK, NewOKResponse("sync successfully!", clist))
+	if r.URL.Query().Get("annotations") != "true" {
+		respond(w, http.StatusOK, NewOKResponse("sync successfully!", clist))
+		return
+	}
+	entries := make([]CidListEntry, 0, len(clist))
+	for _, c := range clist {
+		a, err := s.e.GetAnnotations(ctx, c)
+		if err != nil {
+			msg := fmt.Sprintf("failed to get annotations of cid %s: %v", c.String(), err)
+			logger.Errorf(msg)
+			respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+			return
+		}
+		entries = append(entries, CidListEntry{Cid: c, Annotations: a})
+	}
+	respond(w, http.StatusOK, NewOKResponse("sync successfully!", entries))
 }
 
-func (s *Server) cat(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cidStr := vars["cid"]
-	c, err := cid.Decode(cidStr)
+func (s *Server) reindex(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received reindex request")
+
+	clist, err := s.e.ReindexFromChain(context.Background())
 	if err != nil {
-		msg := fmt.Sprintf("invalid cid to cat: %v", err)
+		msg := fmt.Sprintf("failed to reindex chain: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("reindex chain successfully!", clist))
+}
+
+func (s *Server) annotate(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received annotate request")
+
+	var req AnnotateReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		msg := fmt.Sprintf("invalid annotate request : %v", err)
 		logger.Errorf(msg)
 		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
 		return
 	}
 
-	res, err := s.e.CatCid(context.Background(), c)
+	c, _ := cid.Decode(req.Cid)
+	if err := s.e.Annotate(context.Background(), c, req.Key, req.Value); err != nil {
+		msg := fmt.Sprintf("failed to annotate cid: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("annotate cid %s successfully", req.Cid), nil))
+}
+
+func (s *Server) exportAnnotations(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received export annotations request")
+
+	a, err := s.e.ExportAnnotations(context.Background())
 	if err != nil {
-		msg := fmt.Sprintf("failed to cat data for cid: %s: %v", c.String(), err)
+		msg := fmt.Sprintf("failed to export annotations: %v", err)
 		logger.Errorf(msg)
 		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
 		return
 	}
 
-	respond(w, http.StatusOK, NewOKResponse("cat successfully!", res))
+	respond(w, http.StatusOK, NewOKResponse("export annotations successfully!", a))
 }
 
-func (s *Server) syncWithProvider(w http.ResponseWriter, r *http.Request) {
-	logger.Infow("received provider sync request")
-	var req SyncReq
+func (s *Server) importAnnotations(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received import annotations request")
+
+	var req ImportAnnotationsReq
 	if _, err := req.ReadFrom(r.Body); err != nil {
 		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
 		logger.Errorf(msg)
 		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
 		return
 	}
-	if err := req.Validate(); err != nil {
-		msg := fmt.Sprintf("invalid sync request : %v", err)
+
+	if err := s.e.ImportAnnotations(context.Background(), req.Annotations); err != nil {
+		msg := fmt.Sprintf("failed to import annotations: %v", err)
 		logger.Errorf(msg)
-		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
 		return
 	}
 
-	err := s.e.SyncWithProvider(context.Background(), req.Provider, req.Depth, req.StopCid)
+	respond(w, http.StatusOK, NewOKResponse("import annotations successfully!", nil))
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received status request")
+	respond(w, http.StatusOK, NewOKResponse("get status successfully!", s.e.Status(context.Background())))
+}
+
+func (s *Server) chainStats(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received chain stats request")
+	respond(w, http.StatusOK, NewOKResponse("get chain stats successfully!", s.e.ChainStats(context.Background())))
+}
+
+func (s *Server) audit(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received audit request")
+
+	report, err := s.e.Audit(context.Background())
 	if err != nil {
-		msg := fmt.Sprintf("failed to sync with provider: %v", err)
+		msg := fmt.Sprintf("failed to audit pushed cids: %v", err)
 		logger.Errorf(msg)
 		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
 		return
 	}
 
-	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("sync with provider %s successfully", req.Provider), nil))
+	respond(w, http.StatusOK, NewOKResponse("audit pushed cids successfully!", report))
+}
+
+func (s *Server) freeze(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received freeze request")
+
+	var req FreezeReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	if err := s.e.Freeze(context.Background(), req.Reason); err != nil {
+		msg := fmt.Sprintf("failed to freeze chain: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("freeze chain successfully!", nil))
+}
+
+func (s *Server) unfreeze(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received unfreeze request")
+
+	if err := s.e.Unfreeze(context.Background()); err != nil {
+		msg := fmt.Sprintf("failed to unfreeze chain: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("unfreeze chain successfully!", nil))
+}
+
+func (s *Server) checkInterval(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received check interval request")
+
+	res := CheckIntervalRes{Interval: s.e.CheckInterval().String()}
+	respond(w, http.StatusOK, NewOKResponse("get check interval successfully!", res))
+}
+
+func (s *Server) setCheckInterval(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received set check interval request")
+
+	var req CheckIntervalReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		msg := fmt.Sprintf("invalid check interval: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	if err = s.e.SetCheckInterval(interval); err != nil {
+		msg := fmt.Sprintf("failed to set check interval: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	res := CheckIntervalRes{Interval: interval.String()}
+	respond(w, http.StatusOK, NewOKResponse("set check interval successfully!", res))
+}
+
+func (s *Server) pauseChecker(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received pause checker request")
+
+	if err := s.e.PauseChecker(); err != nil {
+		msg := fmt.Sprintf("failed to pause checker: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("pause checker successfully!", nil))
+}
+
+func (s *Server) resumeChecker(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received resume checker request")
+
+	if err := s.e.ResumeChecker(); err != nil {
+		msg := fmt.Sprintf("failed to resume checker: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("resume checker successfully!", nil))
+}
+
+func (s *Server) checkNow(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received check now request")
+
+	res, err := s.e.CheckNow(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to check inclusions: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("check inclusions successfully!", res))
+}
+
+func (s *Server) verifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received verify audit log request")
+
+	res, err := s.e.VerifyAuditLog(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to verify audit log: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("verify audit log successfully!", res))
+}
+
+func (s *Server) exportAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received export audit log request")
+
+	// the log is buffered so that failures are reported as such, not as a truncated log.
+	var buf bytes.Buffer
+	if err := s.e.ExportAuditLog(r.Context(), &buf); err != nil {
+		msg := fmt.Sprintf("failed to export audit log: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		logger.Errorw("failed to write audit log", "err", err)
+	}
+}
+
+func (s *Server) recoverFromAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received recover from audit log request")
+
+	res, err := s.e.RecoverFromAuditLog(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to recover from audit log: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("recover from audit log successfully!", res))
+}
+
+func (s *Server) mirror(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received mirror request")
+
+	var req MirrorReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	spec := engine.MirrorSpec{Provider: req.Provider, Addr: req.Addr, ServeAddr: req.ServeAddr}
+	if _, err := s.e.StartMirror(context.Background(), spec); err != nil {
+		msg := fmt.Sprintf("failed to mirror provider: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("mirror provider %s successfully!", req.Provider), nil))
+}
+
+func (s *Server) unmirror(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received unmirror request")
+
+	var req UnmirrorReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	provider, ok := decodePeerID(req.Provider, w)
+	if !ok {
+		return
+	}
+
+	if err := s.e.StopMirror(context.Background(), provider); err != nil {
+		msg := fmt.Sprintf("failed to stop mirror: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("stop mirroring provider %s successfully!", req.Provider), nil))
+}
+
+func (s *Server) listMirrors(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list mirrors request")
+	respond(w, http.StatusOK, NewOKResponse("list mirrors successfully!", s.e.Mirrors()))
+}
+
+func (s *Server) bridge(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received bridge request")
+
+	var req BridgeReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
 
+	spec := engine.BridgeSpec{Provider: req.Provider, Addr: req.Addr, Topic: req.Topic}
+	if _, err := s.e.StartBridge(context.Background(), spec); err != nil {
+		msg := fmt.Sprintf("failed to bridge index-provider: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("bridge index-provider %s successfully!", req.Provider), nil))
+}
+
+func (s *Server) unbridge(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received unbridge request")
+
+	var req UnbridgeReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	provider, ok := decodePeerID(req.Provider, w)
+	if !ok {
+		return
+	}
+
+	if err := s.e.StopBridge(context.Background(), provider); err != nil {
+		msg := fmt.Sprintf("failed to stop bridge: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("stop bridging index-provider %s successfully!", req.Provider), nil))
+}
+
+func (s *Server) listBridges(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list bridges request")
+	respond(w, http.StatusOK, NewOKResponse("list bridges successfully!", s.e.Bridges()))
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received watch request")
+
+	var req WatchReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	spec := engine.WatchSpec{Dir: req.Dir, Ignore: req.Ignore}
+	if req.Debounce != "" {
+		debounce, err := time.ParseDuration(req.Debounce)
+		if err != nil {
+			msg := fmt.Sprintf("invalid debounce: %v", err)
+			logger.Errorf(msg)
+			respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+			return
+		}
+		spec.Debounce = debounce
+	}
+	if _, err := s.e.StartWatch(context.Background(), spec); err != nil {
+		msg := fmt.Sprintf("failed to watch directory: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("watch directory %s successfully!", req.Dir), nil))
+}
+
+func (s *Server) unwatch(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received unwatch request")
+
+	var req UnwatchReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	if err := s.e.StopWatch(context.Background(), req.Dir); err != nil {
+		msg := fmt.Sprintf("failed to stop watch: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("stop watching directory %s successfully!", req.Dir), nil))
+}
+
+func (s *Server) listWatches(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list watches request")
+	respond(w, http.StatusOK, NewOKResponse("list watches successfully!", s.e.Watches()))
+}
+
+func (s *Server) schedule(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received schedule request")
+
+	var req ScheduleReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	spec := engine.JobSpec{Name: req.Name, Schedule: req.Schedule, Command: req.Command, File: req.File}
+	if req.Timeout != "" {
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			msg := fmt.Sprintf("invalid timeout: %v", err)
+			logger.Errorf(msg)
+			respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+			return
+		}
+		spec.Timeout = timeout
+	}
+	if _, err := s.e.AddJob(context.Background(), spec); err != nil {
+		msg := fmt.Sprintf("failed to schedule job: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("schedule job %s successfully!", req.Name), nil))
+}
+
+func (s *Server) unschedule(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received unschedule request")
+
+	var req JobReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	if err := s.e.RemoveJob(context.Background(), req.Name); err != nil {
+		msg := fmt.Sprintf("failed to remove job: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("remove job %s successfully!", req.Name), nil))
+}
+
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received run job request")
+
+	var req JobReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	c, err := s.e.RunJob(context.Background(), req.Name)
+	if err != nil {
+		msg := fmt.Sprintf("failed to run job: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("run job %s successfully!", req.Name), PushRes{Cid: c}))
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list jobs request")
+	respond(w, http.StatusOK, NewOKResponse("list jobs successfully!", s.e.Jobs()))
+}
+
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list dead letters request")
+	list, err := s.e.ListDeadLetters(context.Background())
+	if err != nil {
+		msg := fmt.Sprintf("failed to list dead letters: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("list dead letters successfully!", list))
+}
+
+func (s *Server) retryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received retry dead letter request")
+	s.handleDeadLetter(w, r, "retry", s.e.RetryDeadLetter)
+}
+
+func (s *Server) dropDeadLetter(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received drop dead letter request")
+	s.handleDeadLetter(w, r, "drop", s.e.DropDeadLetter)
+}
+
+func (s *Server) handleDeadLetter(w http.ResponseWriter, r *http.Request, action string, fn func(context.Context, cid.Cid) error) {
+	var req DeadLetterReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	c, ok := decodeCid(req.Cid, w)
+	if !ok {
+		return
+	}
+
+	if err := fn(context.Background(), c); err != nil {
+		msg := fmt.Sprintf("failed to %s dead letter: %v", action, err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("%s dead letter %s successfully!", action, c.String()), nil))
+}
+
+func (s *Server) history(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received history request")
+	query := r.URL.Query()
+	var from, to time.Time
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		var err error
+		if *t, err = time.Parse(time.RFC3339, v); err != nil {
+			msg := fmt.Sprintf("invalid %s time, expected RFC3339: %v", name, err)
+			logger.Errorf(msg)
+			respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+			return
+		}
+	}
+
+	entries, err := s.e.History(context.Background(), from, to)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get history: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("get history successfully!", entries))
+}
+
+func (s *Server) receipt(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+
+	receipt, err := s.e.GetReceipt(r.Context(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get receipt of cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("get receipt successfully!", receipt))
+}
+
+func (s *Server) lookupByPayload(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received lookup request")
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("failed to read payload: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	c, err := s.e.LookupByPayload(context.Background(), data)
+	if err != nil {
+		msg := fmt.Sprintf("failed to look up payload: %v", err)
+		code := errorCode(err, http.StatusInternalServerError)
+		if code == http.StatusInternalServerError {
+			logger.Errorf(msg)
+		}
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("look up payload successfully!", c))
+}
+
+func (s *Server) listPeerAddrs(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list peers request")
+	entries, err := s.e.AddrBook(context.Background())
+	if err != nil {
+		msg := fmt.Sprintf("failed to list peers: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("list peers successfully!", entries))
+}
+
+func (s *Server) addPeerAddrs(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received add peer request")
+
+	var req AddPeerReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	info, err := peer.AddrInfoFromString(req.Addr)
+	if err != nil {
+		msg := fmt.Sprintf("invalid peer address, expected a multiaddr with a /p2p/ component: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			msg := fmt.Sprintf("invalid ttl: %v", err)
+			logger.Errorf(msg)
+			respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+			return
+		}
+	}
+
+	if err = s.e.AddPeerAddrs(context.Background(), *info, ttl); err != nil {
+		msg := fmt.Sprintf("failed to add peer: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadRequest)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("add peer %s successfully!", info.ID), nil))
+}
+
+func (s *Server) removePeerAddrs(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received remove peer request")
+
+	var req RemovePeerReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	id, ok := decodePeerID(req.Peer, w)
+	if !ok {
+		return
+	}
+
+	if err := s.e.RemovePeerAddrs(context.Background(), id); err != nil {
+		msg := fmt.Sprintf("failed to remove peer: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("remove peer %s successfully!", id), nil))
+}
+
+func (s *Server) findByLabel(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received find by label request")
+	query := r.URL.Query()
+	cids, err := s.e.FindByLabel(context.Background(), query.Get("key"), query.Get("value"))
+	if err != nil {
+		msg := fmt.Sprintf("failed to find by label: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("find by label successfully!", cids))
+}
+
+func (s *Server) cat(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cidStr := vars["cid"]
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		msg := fmt.Sprintf("invalid cid to cat: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	format := engine.CatFormat(r.URL.Query().Get("format"))
+	if format == catContentFormat {
+		content, err := s.e.CatContent(context.Background(), c)
+		if err != nil {
+			msg := fmt.Sprintf("failed to cat data for cid: %s: %v", c.String(), err)
+			logger.Errorf(msg)
+			code := errorCode(err, http.StatusInternalServerError)
+			respond(w, code, NewErrorResponse(code, msg))
+			return
+		}
+		w.Header().Set("Content-Type", content.ContentType)
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(content.Data); err != nil {
+			logger.Errorw("failed to write response", "err", err)
+		}
+		return
+	}
+	var res []byte
+	if format == "" {
+		res, err = s.e.CatCid(context.Background(), c)
+	} else {
+		res, err = s.e.Cat(context.Background(), c, format)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("failed to cat data for cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	switch format {
+	case "":
+		respond(w, http.StatusOK, NewOKResponse("cat successfully!", res))
+	case engine.CatRaw:
+		// raw bytes are not valid JSON strings, they are the body of the response.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(res); err != nil {
+			logger.Errorw("failed to write response", "err", err)
+		}
+	default:
+		respond(w, http.StatusOK, NewOKResponse("cat successfully!", string(res)))
+	}
+}
+
+func (s *Server) catStream(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+	logger.Infow("received cat stream request", "cid", c)
+
+	// the request context stops loading the chunks if the client goes away.
+	rc, err := s.e.CatStream(r.Context(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to cat data for cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(w, rc); err != nil {
+		logger.Errorw("failed to stream payload", "cid", c, "err", err)
+	}
+}
+
+func (s *Server) snapshotOf(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+
+	si, err := s.e.SnapshotOf(r.Context(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get snapshot of cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+	if si == nil {
+		respond(w, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, fmt.Sprintf("cid %s is not in any snapshot yet", c.String())))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("get snapshot successfully!", si))
+}
+
+func (s *Server) backupStatus(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCid(mux.Vars(r)["cid"], w)
+	if !ok {
+		return
+	}
+
+	status, err := s.e.BackupStatus(context.Background(), c)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get backup status of cid: %s: %v", c.String(), err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("get backup status successfully!", status))
+}
+
+func (s *Server) head(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received head request")
+	ctx := context.Background()
+	query := r.URL.Query()
+
+	var provider peer.ID
+	if id := query.Get("peer"); id != "" {
+		var ok bool
+		if provider, ok = decodePeerID(id, w); !ok {
+			return
+		}
+	}
+	depth := 0
+	if d := query.Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil || depth < 0 {
+			msg := fmt.Sprintf("invalid depth: %s", d)
+			logger.Errorf(msg)
+			respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+			return
+		}
+	}
+
+	if query.Get("ancestor") == "" {
+		head := s.e.Head()
+		if provider != "" {
+			var err error
+			if head, err = s.e.ProviderHead(ctx, provider); err != nil {
+				msg := fmt.Sprintf("failed to get head of provider %s: %v", provider, err)
+				logger.Errorf(msg)
+				respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+				return
+			}
+		}
+		respond(w, http.StatusOK, NewOKResponse("get head successfully!", HeadRes{Head: head}))
+		return
+	}
+
+	ancestor, ok := decodeCid(query.Get("ancestor"), w)
+	if !ok {
+		return
+	}
+	var check *engine.AncestorCheck
+	var err error
+	if provider != "" {
+		check, err = s.e.VerifyProviderAncestor(ctx, provider, ancestor, depth)
+	} else {
+		check, err = s.e.VerifyAncestor(ctx, cid.Undef, ancestor, depth)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("failed to verify ancestor %s: %v", ancestor, err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+
+	msg := fmt.Sprintf("%s is an ancestor of head %s", ancestor, check.Head)
+	if !check.IsAncestor {
+		msg = fmt.Sprintf("%s is not an ancestor of head %s", ancestor, check.Head)
+		if check.Truncated {
+			msg += " within the walked depth"
+		}
+	}
+	respond(w, http.StatusOK, NewOKResponse(msg, check))
+}
+
+func (s *Server) signedHead(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received signed head request")
+	query := r.URL.Query()
+
+	addr, err := multiaddr.NewMultiaddr(query.Get("addr"))
+	if err != nil {
+		msg := fmt.Sprintf("invalid httpsync address: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	var signer peer.ID
+	if id := query.Get("peer"); id != "" {
+		var ok bool
+		if signer, ok = decodePeerID(id, w); !ok {
+			return
+		}
+	}
+
+	head, err := s.e.FetchSignedHead(r.Context(), addr, signer)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get signed head from %s: %v", addr, err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadGateway)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("get signed head successfully!", head))
+}
+
+func (s *Server) checkFork(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received fork check request")
+	check, err := s.e.CheckFork(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to check chain for forks: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusBadGateway)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("check fork successfully!", check))
+}
+
+func (s *Server) exportCheckpoint(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received export checkpoint request")
+	cp, err := s.e.ExportCheckpoint(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to export checkpoint: %v", err)
+		logger.Errorf(msg)
+		code := errorCode(err, http.StatusInternalServerError)
+		respond(w, code, NewErrorResponse(code, msg))
+		return
+	}
+	respond(w, http.StatusOK, NewOKResponse("export checkpoint successfully!", cp))
+}
+
+func (s *Server) listProviders(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received list providers request")
+
+	providers, err := s.e.ListProviders(context.Background())
+	if err != nil {
+		msg := fmt.Sprintf("failed to list providers: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("list providers successfully!", providers))
+}
+
+func (s *Server) providerInfo(w http.ResponseWriter, r *http.Request) {
+	peerID, ok := decodePeerID(mux.Vars(r)["peerid"], w)
+	if !ok {
+		return
+	}
+
+	info, err := s.e.GetProviderInfo(context.Background(), peerID)
+	if err != nil {
+		if errors.Is(err, engine.ResourceNotFound) {
+			respond(w, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, fmt.Sprintf("provider %s is not registered in Pando", peerID)))
+			return
+		}
+		msg := fmt.Sprintf("failed to get provider info: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, msg))
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse("get provider info successfully!", info))
+}
+
+func (s *Server) syncWithProvider(w http.ResponseWriter, r *http.Request) {
+	logger.Infow("received provider sync request")
+	var req SyncReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		msg := fmt.Sprintf("invalid sync request : %v", err)
+		logger.Errorf(msg)
+		respond(w, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, msg))
+		return
+	}
+
+	res, err := s.e.SyncWithProvider(context.Background(), req.Provider, req.SyncDepth(), req.StopCid, req.SyncOptions()...)
+	if err != nil {
+		msg := fmt.Sprintf("failed to sync with provider: %v", err)
+		logger.Errorf(msg)
+		code, errRes := syncErrorResponse(err, msg)
+		if res != nil {
+			errRes.Data = res
+		}
+		respond(w, code, errRes)
+		return
+	}
+
+	respond(w, http.StatusOK, NewOKResponse(fmt.Sprintf("sync with provider %s successfully", req.Provider), res))
+
+}
+
+// syncErrorResponse returns the response of a failed sync, with the partial results of a sync
+// stopped by its limits.
+func syncErrorResponse(err error, msg string) (int, *ResponseJson) {
+	code := errorCode(err, http.StatusInternalServerError)
+	res := NewErrorResponse(code, msg)
+	var limitErr *engine.SyncLimitError
+	if errors.As(err, &limitErr) {
+		res.Data = limitErr
+	}
+	return code, res
+}
+
+// errorCode returns the status code matching the kind of the engine error err, defaultCode if
+// err is not of a known kind.
+func errorCode(err error, defaultCode int) int {
+	switch {
+	case errors.Is(err, engine.ErrFrozen):
+		return http.StatusLocked
+	case errors.Is(err, engine.ResourceNotFound), errors.Is(err, engine.ErrNoPublishedMetadata),
+		errors.Is(err, engine.ErrNotMirrored), errors.Is(err, engine.ErrNotIncluded), errors.Is(err, engine.ErrNotWatched),
+		errors.Is(err, engine.ErrNotScheduled), errors.Is(err, engine.ErrNotDeadLettered),
+		errors.Is(err, engine.ErrPayloadNotPublished), errors.Is(err, engine.ErrNotInAddrBook),
+		errors.Is(err, engine.ErrNoAnnounceMessage), errors.Is(err, engine.ErrNoReceipt),
+		errors.Is(err, engine.ErrNotPushed), errors.Is(err, engine.ErrNotBridged):
+		return http.StatusNotFound
+	case errors.Is(err, engine.ErrAlreadyFrozen), errors.Is(err, engine.ErrNotFrozen),
+		errors.Is(err, engine.ErrCheckerPaused), errors.Is(err, engine.ErrCheckerNotPaused),
+		errors.Is(err, engine.ErrAlreadyMirrored), errors.Is(err, engine.ErrAlreadyWatched),
+		errors.Is(err, engine.ErrAlreadyScheduled), errors.Is(err, engine.ErrAuditLogTampered),
+		errors.Is(err, engine.ErrImportDiverges), errors.Is(err, engine.ErrAlreadyBridged):
+		return http.StatusConflict
+	case errors.Is(err, engine.ErrPublisherDisabled), errors.Is(err, engine.ErrInvalidCatFormat),
+		errors.Is(err, engine.ErrNotBytesPayload), errors.Is(err, engine.ErrInvalidPayload),
+		errors.Is(err, engine.ErrUnknownPayloadType), errors.Is(err, engine.ErrInvalidLabel),
+		errors.Is(err, engine.ErrNotGossiping), errors.Is(err, engine.ErrAuditLogDisabled),
+		errors.Is(err, engine.ErrInvalidImport):
+		return http.StatusBadRequest
+	case errors.Is(err, engine.ErrSyncLimitExceeded), errors.Is(err, engine.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, engine.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, engine.ErrBacklog), errors.Is(err, engine.ErrNoAnnouncePeers):
+		return http.StatusServiceUnavailable
+	}
+	return defaultCode
 }
 
 func decodePeerID(id string, w http.ResponseWriter) (peer.ID, bool) {
@@ -0,0 +1,303 @@
+package adminserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pandoClient/pkg/engine"
+	"pandoClient/pkg/retry"
+	sc "pandoClient/pkg/schema"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer returns an admin server over a new started engine, its handler served by do.
+func testServer(t *testing.T, o ...engine.Option) (*Server, *engine.Engine) {
+	e, err := engine.New(o...)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(context.Background()))
+	t.Cleanup(func() { _ = e.Shutdown() })
+	s, err := New(nil, e, WithListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.l.Close() })
+	return s, e
+}
+
+func do(s *Server, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(method, target, body))
+	return w
+}
+
+// decodeData decodes the data of the response w in v and returns its code.
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, v interface{}) int {
+	var res struct {
+		Code int             `json:"code"`
+		Data json.RawMessage `json:"Data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res), w.Body.String())
+	require.Equal(t, w.Code, res.Code)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(res.Data, v), string(res.Data))
+	}
+	return res.Code
+}
+
+func push(t *testing.T, s *Server, query, data string) cid.Cid {
+	w := do(s, http.MethodPost, "/admin/push"+query, strings.NewReader(data))
+	var res PushRes
+	require.Equal(t, http.StatusOK, decodeData(t, w, &res))
+	return res.Cid
+}
+
+func TestServer_PushContentType(t *testing.T) {
+	s, e := testServer(t)
+	ctx := context.Background()
+
+	// the content type is recorded in the metadata only.
+	c := push(t, s, "?content_type=application/json", `{"a":1}`)
+	meta, err := e.LocalMetadata(ctx, c)
+	require.NoError(t, err)
+	p, err := sc.DecodeMetaPayload(meta)
+	require.NoError(t, err)
+	require.Equal(t, "application/json", p.ContentType)
+	annotations, err := e.GetAnnotations(ctx, c)
+	require.NoError(t, err)
+	require.Empty(t, annotations)
+
+	w := do(s, http.MethodGet, "/admin/cat/"+c.String()+"?format=content", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.Equal(t, `{"a":1}`, w.Body.String())
+
+	c = push(t, s, "", "raw")
+	w = do(s, http.MethodGet, "/admin/cat/"+c.String()+"?format=content", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	require.Equal(t, "raw", w.Body.String())
+}
+
+func TestServer_Status(t *testing.T) {
+	s, _ := testServer(t)
+
+	// the status decodes as the engine status used by the status command.
+	var status engine.Status
+	w := do(s, http.MethodGet, "/admin/status", nil)
+	require.Equal(t, http.StatusOK, decodeData(t, w, &status))
+	require.True(t, status.Started)
+	require.False(t, status.Frozen)
+	require.Nil(t, status.Freeze)
+	require.Equal(t, cid.Undef, status.LatestMeta)
+	// Pando is left out if its address is not configured.
+	require.Nil(t, status.Pando)
+	require.NotContains(t, w.Body.String(), `"Pando"`)
+
+	c := push(t, s, "", "status")
+	w = do(s, http.MethodPost, "/admin/freeze", strings.NewReader(`{"reason":"legal hold"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, http.StatusOK, decodeData(t, do(s, http.MethodGet, "/admin/status", nil), &status))
+	require.Equal(t, c, status.LatestMeta)
+	require.Equal(t, 1, status.ChainLength)
+	require.True(t, status.Frozen)
+	require.NotNil(t, status.Freeze)
+	require.Equal(t, "legal hold", status.Freeze.Reason)
+	require.False(t, status.Freeze.Since.IsZero())
+}
+
+func TestServer_Push(t *testing.T) {
+	s, e := testServer(t, engine.WithDedupe(true))
+	ctx := context.Background()
+
+	c := push(t, s, "?label=env=prod&label=team=a", "labelled")
+	for _, label := range [][2]string{{"env", "prod"}, {"team", "a"}} {
+		found, err := e.FindByLabel(ctx, label[0], label[1])
+		require.NoError(t, err)
+		require.Equal(t, []cid.Cid{c}, found)
+	}
+
+	// a duplicate payload returns its metadata unless forced.
+	require.Equal(t, c, push(t, s, "", "labelled"))
+	forced := push(t, s, "?force=true", "labelled")
+	require.NotEqual(t, c, forced)
+
+	c = push(t, s, "?codec=dag-cbor", "cbor")
+	require.Equal(t, uint64(cid.DagCBOR), c.Prefix().Codec)
+
+	w := do(s, http.MethodPost, "/admin/push?codec=dag-pb", strings.NewReader("invalid"))
+	require.Equal(t, http.StatusBadRequest, decodeData(t, w, nil))
+	w = do(s, http.MethodPost, "/admin/push?type=unknown", strings.NewReader("{}"))
+	require.Equal(t, http.StatusBadRequest, decodeData(t, w, nil))
+	w = do(s, http.MethodPost, "/admin/push?label=nokey", strings.NewReader("invalid"))
+	require.Equal(t, http.StatusBadRequest, decodeData(t, w, nil))
+	require.Equal(t, c, e.Status(ctx).LatestMeta)
+}
+
+func TestServer_PushErrorCodes(t *testing.T) {
+	s, _ := testServer(t, engine.WithPublishQuota(0, 1, 0))
+	push(t, s, "", "first")
+	w := do(s, http.MethodPost, "/admin/push", strings.NewReader("over quota"))
+	require.Equal(t, http.StatusTooManyRequests, decodeData(t, w, nil))
+
+	w = do(s, http.MethodPost, "/admin/freeze", strings.NewReader(`{"reason":"legal hold"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = do(s, http.MethodPost, "/admin/push", strings.NewReader("frozen"))
+	require.Equal(t, http.StatusLocked, decodeData(t, w, nil))
+
+	// an announcement reaching no gossip peer is unavailable.
+	s, _ = testServer(t,
+		engine.WithPublisherKind(engine.DataTransferPublisher),
+		engine.WithRetryPolicy(engine.RetryAnnounce, retry.NoRetry),
+	)
+	push(t, s, "", "unreachable")
+	w = do(s, http.MethodPost, "/admin/announce", nil)
+	require.Equal(t, http.StatusServiceUnavailable, decodeData(t, w, nil))
+	require.Contains(t, w.Body.String(), engine.ErrNoAnnouncePeers.Error())
+}
+
+func TestServer_SyncLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	topic := "/pando/synclimits"
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = h.Close() })
+	_, pando := testServer(t, engine.WithHost(h), engine.WithTopicName(topic),
+		engine.WithPublisherKind(engine.DataTransferPublisher))
+	var published []cid.Cid
+	for _, data := range []string{"a", "b", "c"} {
+		c, err := pando.PublishBytesData(ctx, []byte(data))
+		require.NoError(t, err)
+		published = append(published, c)
+	}
+	syncer, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = syncer.Close() })
+	pandoInfo := peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	s, _ := testServer(t, engine.WithHost(syncer), engine.WithTopicName(topic), engine.WithPandoAddrinfo(pandoInfo))
+	require.NoError(t, syncer.Connect(ctx, pandoInfo))
+
+	// the sync stopped by its limits answers its partial results.
+	req := `{"cid":"` + published[2].String() + `","all":true,"max_blocks":1}`
+	var limitErr engine.SyncLimitError
+	w := do(s, http.MethodPost, "/admin/sync", strings.NewReader(req))
+	require.Equal(t, http.StatusRequestEntityTooLarge, decodeData(t, w, &limitErr))
+	require.Equal(t, "blocks", limitErr.Limit)
+	require.Equal(t, int64(1), limitErr.Max)
+	require.Equal(t, []cid.Cid{published[2], published[1]}, limitErr.Synced)
+	require.Equal(t, 2, limitErr.Blocks)
+	require.NotZero(t, limitErr.Bytes)
+
+	req = `{"cid":"` + published[2].String() + `","all":true,"max_blocks":-1}`
+	w = do(s, http.MethodPost, "/admin/sync", strings.NewReader(req))
+	require.Equal(t, http.StatusOK, decodeData(t, w, nil))
+	w = do(s, http.MethodPost, "/admin/sync", strings.NewReader(`{"cid":"`+published[2].String()+`","all":true,"depth":1}`))
+	require.Equal(t, http.StatusBadRequest, decodeData(t, w, nil))
+}
+
+func TestServer_InclusionRecord(t *testing.T) {
+	var mutex sync.Mutex
+	included := make(map[cid.Cid]bool)
+	pando := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(r.URL.Query().Get("cid"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		inclusion := engine.MetaInclusion{ID: c, Provider: "provider", InPando: included[c]}
+		mutex.Unlock()
+		if inclusion.InPando {
+			inclusion.InSnapShot, inclusion.SnapShotID, inclusion.SnapShotHeight = true, c, 7
+			inclusion.Context, inclusion.TranscationID = []byte("tx context"), 42
+		}
+		b, err := json.Marshal(inclusion)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"code":200,"message":"ok","Data":%s}`, b)
+	}))
+	defer pando.Close()
+	s, _ := testServer(t, engine.WithPandoAPIClient(pando.URL, time.Second))
+	in := push(t, s, "", "included")
+	out := push(t, s, "", "not included")
+	mutex.Lock()
+	included[in] = true
+	mutex.Unlock()
+
+	var inclusion engine.MetaInclusion
+	w := do(s, http.MethodGet, "/admin/inclusion/"+in.String()+"/record", nil)
+	require.Equal(t, http.StatusOK, decodeData(t, w, &inclusion))
+	require.True(t, inclusion.InPando)
+	require.Equal(t, uint64(7), inclusion.SnapShotHeight)
+	require.Equal(t, []byte("tx context"), inclusion.Context)
+	require.Equal(t, 42, inclusion.TranscationID)
+
+	// a metadata not included is a record, unlike its verification.
+	inclusion = engine.MetaInclusion{}
+	w = do(s, http.MethodGet, "/admin/inclusion/"+out.String()+"/record", nil)
+	require.Equal(t, http.StatusOK, decodeData(t, w, &inclusion))
+	require.Equal(t, out, inclusion.ID)
+	require.False(t, inclusion.InPando)
+	w = do(s, http.MethodGet, "/admin/inclusion/"+out.String(), nil)
+	require.Equal(t, http.StatusNotFound, decodeData(t, w, nil))
+	require.Contains(t, w.Body.String(), engine.ErrNotIncluded.Error())
+
+	w = do(s, http.MethodGet, "/admin/inclusion/invalid/record", nil)
+	require.Equal(t, http.StatusBadRequest, decodeData(t, w, nil))
+}
+
+func TestServer_PushAsync(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	announced := make(chan struct{}, 1)
+	pando := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		select {
+		case announced <- struct{}{}:
+		default:
+		}
+	}))
+	defer pando.Close()
+	var once sync.Once
+	releasePando := func() { once.Do(func() { close(release) }) }
+	defer releasePando()
+	// without gossip peers, the announcements only go through the http announce, held by pando.
+	s, e := testServer(t,
+		engine.WithPublisherKind(engine.DataTransferPublisher),
+		engine.WithHttpAnnounceURL(pando.URL, 10*time.Second),
+		engine.WithRetryPolicy(engine.RetryAnnounce, retry.NoRetry),
+	)
+
+	// the push returns while pando holds the announcement.
+	start := time.Now()
+	c := push(t, s, "?async=true", "async")
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	require.Equal(t, []cid.Cid{c}, e.QueuedAnnounces())
+	receipt, err := e.GetReceipt(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, engine.AnnounceQueued, receipt.Announce)
+	require.True(t, receipt.Queued)
+
+	releasePando()
+	select {
+	case <-announced:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the queued announcement")
+	}
+	require.Eventually(t, func() bool { return len(e.QueuedAnnounces()) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -15,6 +15,66 @@ func (req *SyncReq) ReadFrom(r io.Reader) (int64, error) {
 	return unmarshalAsJson(r, req)
 }
 
+func (req *AnnotateReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *ImportAnnotationsReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *FreezeReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *CheckIntervalReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *MirrorReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *UnmirrorReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *BridgeReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *UnbridgeReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *WatchReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *UnwatchReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *ScheduleReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *JobReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *DeadLetterReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *AddPeerReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
+func (req *RemovePeerReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, req)
+}
+
 func (req *ImportFileRes) WriteTo(w io.Writer) (int64, error) {
 	return marshalToJson(w, req)
 }
@@ -6,6 +6,8 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"net/http"
+	"pandoClient/pkg/engine"
+	"time"
 )
 
 type (
@@ -20,11 +22,129 @@ type (
 		MetaId cid.Cid `json:"meta_id"`
 	}
 
+	// PushRes is the result of a push of payload bytes.
+	PushRes struct {
+		Cid cid.Cid `json:"cid"`
+	}
+
 	SyncReq struct {
 		Cid      string `json:"cid"`
 		Provider string `json:"provider"`
 		Depth    int    `json:"depth"`
 		StopCid  string `json:"stop_cid"`
+		// All syncs the whole chain without recursion limit, bounded by the sync limits only.
+		All bool `json:"all"`
+		// MaxBlocks and MaxBytes override the sync limits of the engine, -1 for no limit.
+		MaxBlocks int   `json:"max_blocks"`
+		MaxBytes  int64 `json:"max_bytes"`
+	}
+
+	AnnotateReq struct {
+		Cid   string `json:"cid"`
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+
+	// CidListEntry is a pushed cid along with its local annotations.
+	CidListEntry struct {
+		Cid         cid.Cid            `json:"cid"`
+		Annotations engine.Annotations `json:"annotations,omitempty"`
+	}
+
+	ImportAnnotationsReq struct {
+		Annotations map[string]engine.Annotations `json:"annotations"`
+	}
+
+	HeadRes struct {
+		Head cid.Cid `json:"head"`
+	}
+
+	FreezeReq struct {
+		Reason string `json:"reason"`
+	}
+
+	CheckIntervalReq struct {
+		// Interval is a duration such as 30s.
+		Interval string `json:"interval"`
+	}
+
+	CheckIntervalRes struct {
+		Interval string `json:"interval"`
+	}
+
+	MirrorReq struct {
+		Provider  string `json:"provider"`
+		Addr      string `json:"addr"`
+		ServeAddr string `json:"serve_addr"`
+	}
+
+	UnmirrorReq struct {
+		Provider string `json:"provider"`
+	}
+
+	BridgeReq struct {
+		Provider string `json:"provider"`
+		Addr     string `json:"addr"`
+		Topic    string `json:"topic"`
+	}
+
+	UnbridgeReq struct {
+		Provider string `json:"provider"`
+	}
+
+	WatchReq struct {
+		Dir    string   `json:"dir"`
+		Ignore []string `json:"ignore"`
+		// Debounce is a duration such as 2s, empty for the default.
+		Debounce string `json:"debounce"`
+	}
+
+	UnwatchReq struct {
+		Dir string `json:"dir"`
+	}
+
+	ScheduleReq struct {
+		Name     string `json:"name"`
+		Schedule string `json:"schedule"`
+		Command  string `json:"command"`
+		File     string `json:"file"`
+		// Timeout is a duration such as 30s, empty for the default.
+		Timeout string `json:"timeout"`
+	}
+
+	JobReq struct {
+		Name string `json:"name"`
+	}
+
+	DeadLetterReq struct {
+		Cid string `json:"cid"`
+	}
+
+	AddPeerReq struct {
+		// Addr is the multiaddr of the peer, with its /p2p/ component.
+		Addr string `json:"addr"`
+		// TTL is a duration such as 24h, empty to keep the address permanently.
+		TTL string `json:"ttl"`
+	}
+
+	RemovePeerReq struct {
+		Peer string `json:"peer"`
+	}
+
+	// RuntimeStats is a snapshot of the runtime of the process, served by the debug server.
+	RuntimeStats struct {
+		Uptime       string    `json:"uptime"`
+		GoVersion    string    `json:"go_version"`
+		NumCPU       int       `json:"num_cpu"`
+		GOMAXPROCS   int       `json:"gomaxprocs"`
+		Goroutines   int       `json:"goroutines"`
+		HeapAlloc    uint64    `json:"heap_alloc"`
+		HeapInuse    uint64    `json:"heap_inuse"`
+		HeapObjects  uint64    `json:"heap_objects"`
+		Sys          uint64    `json:"sys"`
+		NumGC        uint32    `json:"num_gc"`
+		PauseTotalNs uint64    `json:"pause_total_ns"`
+		LastGC       time.Time `json:"last_gc"`
 	}
 
 	ResponseJson struct {
@@ -78,6 +198,9 @@ func (sq *SyncReq) Validate() error {
 		if sq.Depth < 0 {
 			return fmt.Errorf("depth must be positive")
 		}
+		if sq.All {
+			return fmt.Errorf("depth can not be set to sync all")
+		}
 	}
 	if sq.Provider != "" {
 		_, err := peer.Decode(sq.Provider)
@@ -93,3 +216,33 @@ func (sq *SyncReq) Validate() error {
 	}
 	return nil
 }
+
+// SyncDepth returns the depth to sync with: engine.SyncDepthAll to sync all.
+func (sq *SyncReq) SyncDepth() int {
+	if sq.All {
+		return engine.SyncDepthAll
+	}
+	return sq.Depth
+}
+
+// SyncOptions returns the options of the sync: the limits overriding the ones of the engine.
+func (sq *SyncReq) SyncOptions() []engine.SyncOption {
+	var opts []engine.SyncOption
+	if sq.MaxBlocks != 0 {
+		opts = append(opts, engine.WithMaxSyncBlocks(sq.MaxBlocks))
+	}
+	if sq.MaxBytes != 0 {
+		opts = append(opts, engine.WithMaxSyncBytes(sq.MaxBytes))
+	}
+	return opts
+}
+
+func (ar *AnnotateReq) Validate() error {
+	if _, err := cid.Decode(ar.Cid); err != nil {
+		return err
+	}
+	if ar.Key == "" {
+		return fmt.Errorf("annotation key can not be empty")
+	}
+	return nil
+}
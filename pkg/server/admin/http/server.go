@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"pandoClient/pkg/engine"
+	"pandoClient/pkg/metrics"
 	"pandoClient/pkg/util/log"
 
 	"github.com/gorilla/mux"
@@ -43,9 +44,30 @@ func New(h host.Host, e *engine.Engine, o ...Option) (*Server, error) {
 	r.HandleFunc("/admin/announce", s.announce).
 		Methods(http.MethodPost)
 
+	r.HandleFunc("/admin/announce/message", s.announceMessage).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/announce/{cid}", s.republish).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/rollback/{cid}", s.rollback).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/import", s.importChain).
+		Methods(http.MethodPost)
+
 	r.HandleFunc("/admin/addfile", s.addFile).
 		Methods(http.MethodPost)
 
+	r.HandleFunc("/admin/push", s.push).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/inclusion/{cid}/record", s.inclusionRecord).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/inclusion/{cid}", s.inclusion).
+		Methods(http.MethodGet)
+
 	r.HandleFunc("/admin/sync", s.sync).
 		Methods(http.MethodPost)
 
@@ -55,9 +77,156 @@ func New(h host.Host, e *engine.Engine, o ...Option) (*Server, error) {
 	r.HandleFunc("/admin/cat/{cid}", s.cat).
 		Methods(http.MethodGet)
 
+	r.HandleFunc("/admin/cat/{cid}/stream", s.catStream).
+		Methods(http.MethodGet)
+
 	r.HandleFunc("/admin/syncprovider", s.syncWithProvider).
 		Methods(http.MethodPost)
 
+	r.HandleFunc("/admin/head", s.head).
+		Methods(http.MethodGet)
+	r.HandleFunc("/admin/head/signed", s.signedHead).
+		Methods(http.MethodGet)
+	r.HandleFunc("/admin/head/fork", s.checkFork).
+		Methods(http.MethodGet)
+	r.HandleFunc("/admin/head/checkpoint", s.exportCheckpoint).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/providers", s.listProviders).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/providers/{peerid}", s.providerInfo).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/snapshotof/{cid}", s.snapshotOf).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/backup/{cid}", s.backupStatus).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/history", s.history).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/receipt/{cid}", s.receipt).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/labels", s.findByLabel).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/lookup", s.lookupByPayload).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/peers", s.listPeerAddrs).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/peers/add", s.addPeerAddrs).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/peers/remove", s.removePeerAddrs).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/status", s.status).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/stats", s.chainStats).
+		Methods(http.MethodGet)
+
+	r.Handle("/metrics", metrics.Handler()).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/reindex", s.reindex).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/audit", s.audit).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/freeze", s.freeze).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/unfreeze", s.unfreeze).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/checkinterval", s.checkInterval).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/checkinterval", s.setCheckInterval).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/checker/pause", s.pauseChecker).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/checker/resume", s.resumeChecker).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/checker/check", s.checkNow).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/auditlog/verify", s.verifyAuditLog).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/auditlog/export", s.exportAuditLog).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/auditlog/recover", s.recoverFromAuditLog).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/mirror", s.mirror).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/unmirror", s.unmirror).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/mirrors", s.listMirrors).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/bridge", s.bridge).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/unbridge", s.unbridge).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/bridges", s.listBridges).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/watch", s.watch).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/unwatch", s.unwatch).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/watches", s.listWatches).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/schedule", s.schedule).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/unschedule", s.unschedule).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/jobs/run", s.runJob).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/jobs", s.listJobs).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/deadletters", s.listDeadLetters).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/deadletters/retry", s.retryDeadLetter).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/deadletters/drop", s.dropDeadLetter).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/annotate", s.annotate).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/annotations", s.exportAnnotations).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/annotations", s.importAnnotations).
+		Methods(http.MethodPost)
+
 	return s, nil
 }
 
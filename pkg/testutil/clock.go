@@ -0,0 +1,158 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"pandoClient/pkg/clock"
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock.Clock whose time only moves with Add and Set, firing the tickers and
+// timers that are due, e.g. for engine.WithClock. Like the ones of the time package, its tickers
+// drop the ticks that are not received in time.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters map[*fakeWaiter]struct{}
+	// changed is closed and replaced every time a ticker or a timer is created.
+	changed chan struct{}
+}
+
+// fakeWaiter is a ticker, or a timer if period is zero, firing at at.
+type fakeWaiter struct {
+	clock  *FakeClock
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewFakeClock returns a fake clock set at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		waiters: make(map[*fakeWaiter]struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// Now returns the time of the clock.
+func (fc *FakeClock) Now() time.Time {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.now
+}
+
+// NewTicker returns a ticker firing every d from now on.
+func (fc *FakeClock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{fc.newWaiter(d, d)}
+}
+
+// NewTimer returns a timer firing d from now on, right away on the next move of the clock if d is
+// not positive.
+func (fc *FakeClock) NewTimer(d time.Duration) clock.Timer {
+	return fakeTimer{fc.newWaiter(d, 0)}
+}
+
+func (fc *FakeClock) newWaiter(d, period time.Duration) *fakeWaiter {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	w := &fakeWaiter{clock: fc, at: fc.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	fc.waiters[w] = struct{}{}
+	close(fc.changed)
+	fc.changed = make(chan struct{})
+	return w
+}
+
+// Add moves the clock forward by d and fires the tickers and timers due.
+func (fc *FakeClock) Add(d time.Duration) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.set(fc.now.Add(d))
+}
+
+// Set sets the time of the clock and fires the tickers and timers due. Moving it backward fires
+// nothing.
+func (fc *FakeClock) Set(now time.Time) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.set(now)
+}
+
+func (fc *FakeClock) set(now time.Time) {
+	fc.now = now
+	for w := range fc.waiters {
+		if w.at.After(now) {
+			continue
+		}
+		select {
+		case w.c <- w.at:
+		default:
+		}
+		if w.period == 0 {
+			delete(fc.waiters, w)
+			continue
+		}
+		for !w.at.After(now) {
+			w.at = w.at.Add(w.period)
+		}
+	}
+}
+
+// Waiters returns the number of tickers and timers not stopped nor fired.
+func (fc *FakeClock) Waiters() int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return len(fc.waiters)
+}
+
+// BlockUntil waits until at least n tickers and timers are waiting for the clock, e.g. for the
+// loops of the engine to be started before moving the clock.
+func (fc *FakeClock) BlockUntil(ctx context.Context, n int) error {
+	for {
+		fc.mutex.Lock()
+		waiting := len(fc.waiters)
+		changed := fc.changed
+		fc.mutex.Unlock()
+		if waiting >= n {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d tickers and timers are waiting, not %d: %w", waiting, n, ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+func (w *fakeWaiter) Chan() <-chan time.Time {
+	return w.c
+}
+
+// stop stops the ticker or the timer, and reports whether it was waiting.
+func (w *fakeWaiter) stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+	_, ok := w.clock.waiters[w]
+	delete(w.clock.waiters, w)
+	return ok
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.stop()
+}
+
+type fakeTimer struct {
+	*fakeWaiter
+}
+
+func (t fakeTimer) Stop() bool {
+	return t.stop()
+}
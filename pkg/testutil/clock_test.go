@@ -0,0 +1,44 @@
+package testutil
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	ticker := fc.NewTicker(time.Minute)
+	timer := fc.NewTimer(90 * time.Second)
+	require.NoError(t, fc.BlockUntil(ctx, 2))
+
+	fc.Add(59 * time.Second)
+	require.Empty(t, ticker.Chan())
+	fc.Add(time.Second)
+	require.Equal(t, start.Add(time.Minute), <-ticker.Chan())
+	require.Empty(t, timer.Chan())
+
+	// the ticks not received are dropped.
+	fc.Add(2 * time.Minute)
+	require.Equal(t, start.Add(2*time.Minute), <-ticker.Chan())
+	require.Empty(t, ticker.Chan())
+	require.Equal(t, start.Add(90*time.Second), <-timer.Chan())
+	require.False(t, timer.Stop())
+	require.Equal(t, 1, fc.Waiters())
+	fc.Add(time.Minute)
+	require.Equal(t, start.Add(4*time.Minute), <-ticker.Chan())
+
+	ticker.Stop()
+	fc.Add(time.Minute)
+	require.Empty(t, ticker.Chan())
+	require.Zero(t, fc.Waiters())
+	require.True(t, fc.NewTimer(time.Second).Stop())
+
+	blocked, cancelBlocked := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelBlocked()
+	require.Error(t, fc.BlockUntil(blocked, 1))
+}
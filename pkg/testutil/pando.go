@@ -0,0 +1,322 @@
+// Package testutil provides an in-process mock of Pando, so that integration tests can run the
+// engine against it without a Pando deployment.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/filecoin-project/go-legs/dtsync"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/multiformats/go-multiaddr"
+	"net/http"
+	"net/http/httptest"
+	"pandoClient/pkg/pandoapi"
+	"sync"
+	"time"
+)
+
+// DefaultTopic is the announcement topic of the engine, subscribed by default.
+const DefaultTopic = "/pando/v0.0.1"
+
+// subscriptionDelay is the time given to the subscription of the mock to reach the routers that
+// connected to it.
+const subscriptionDelay = 200 * time.Millisecond
+
+// Announcement is an announcement received by the mock.
+type Announcement struct {
+	Cid cid.Cid
+	// Provider is the peer that announced the metadata.
+	Provider  peer.ID
+	Addrs     []multiaddr.Multiaddr
+	ExtraData []byte
+}
+
+// MockPando is an in-process Pando: a libp2p host subscribed to the announcement topic and an
+// HTTP server serving the /provider/head, /metadata/inclusion and /metadata/inclusions
+// endpoints of the Pando API. Announced metadatas become the heads of their providers and, if
+// auto inclusion is set, are included right away. Blocks are not synced.
+type MockPando struct {
+	Host  host.Host
+	srv   *httptest.Server
+	ps    *pubsub.PubSub
+	topic *pubsub.Topic
+	sub   *pubsub.Subscription
+
+	mutex         sync.Mutex
+	announcements []Announcement
+	heads         map[peer.ID]cid.Cid
+	inclusions    map[cid.Cid]*pandoapi.MetaInclusion
+	autoInclude   bool
+	// announced is closed and replaced on every announcement.
+	announced chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMockPando starts a mock Pando listening on localhost and subscribed to topic,
+// DefaultTopic if empty. It must be closed with Close.
+func NewMockPando(topic string) (*MockPando, error) {
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		cancel()
+		h.Close()
+		return nil, err
+	}
+	t, err := ps.Join(topic)
+	if err != nil {
+		cancel()
+		h.Close()
+		return nil, err
+	}
+	sub, err := t.Subscribe()
+	if err != nil {
+		cancel()
+		h.Close()
+		return nil, err
+	}
+	p := &MockPando{
+		Host:       h,
+		ps:         ps,
+		topic:      t,
+		sub:        sub,
+		heads:      make(map[peer.ID]cid.Cid),
+		inclusions: make(map[cid.Cid]*pandoapi.MetaInclusion),
+		announced:  make(chan struct{}),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/provider/head", p.serveHead)
+	mux.HandleFunc("/metadata/inclusion", p.serveInclusion)
+	mux.HandleFunc("/metadata/inclusions", p.serveInclusions)
+	p.srv = httptest.NewServer(mux)
+	go p.receive(ctx)
+	return p, nil
+}
+
+// AddrInfo returns the address of the host of the mock, e.g. for engine.WithPandoAddrinfo.
+func (p *MockPando) AddrInfo() peer.AddrInfo {
+	return peer.AddrInfo{ID: p.Host.ID(), Addrs: p.Host.Addrs()}
+}
+
+// URL returns the base URL of the API of the mock, e.g. for engine.WithPandoAPIClient.
+func (p *MockPando) URL() string {
+	return p.srv.URL
+}
+
+// Close stops the mock.
+func (p *MockPando) Close() error {
+	p.cancel()
+	p.sub.Cancel()
+	<-p.done
+	p.srv.Close()
+	return p.Host.Close()
+}
+
+// SetAutoInclude includes the announced metadatas as soon as they are received, not in a
+// snapshot yet, instead of waiting for Include.
+func (p *MockPando) SetAutoInclude(autoInclude bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.autoInclude = autoInclude
+}
+
+// Include makes c of provider included in Pando, not in a snapshot yet.
+func (p *MockPando) Include(c cid.Cid, provider peer.ID) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.include(c, provider)
+}
+
+func (p *MockPando) include(c cid.Cid, provider peer.ID) *pandoapi.MetaInclusion {
+	inclusion, ok := p.inclusions[c]
+	if !ok {
+		inclusion = &pandoapi.MetaInclusion{ID: c, Provider: provider.String(), InPando: true}
+		p.inclusions[c] = inclusion
+	}
+	return inclusion
+}
+
+// IncludeInSnapshot makes c of provider included in Pando in the snapshot snapshotCid at height.
+func (p *MockPando) IncludeInSnapshot(c cid.Cid, provider peer.ID, snapshotCid cid.Cid, height uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	inclusion := p.include(c, provider)
+	inclusion.InSnapShot = true
+	inclusion.SnapShotID = snapshotCid
+	inclusion.SnapShotHeight = height
+}
+
+// SetHead sets the head of provider served by /provider/head, as if c was announced.
+func (p *MockPando) SetHead(provider peer.ID, c cid.Cid) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.heads[provider] = c
+}
+
+// WaitForProvider waits until the gossipsub router of the provider id is connected to the one of
+// the mock. The announcements gossiped before are lost, and the engine does not gossip the same
+// announcement twice. The engine publishes on its topic without subscribing to it, so it never
+// shows up in the peers of the topic, and it only gossips to the mock once the subscription of the
+// mock reached it.
+func (p *MockPando) WaitForProvider(ctx context.Context, id peer.ID) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		for _, connected := range p.ps.ListPeers("") {
+			if connected == id {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(subscriptionDelay):
+					return nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("provider %s did not connect to the gossipsub router: %w", id, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Announcements returns the announcements received, oldest first.
+func (p *MockPando) Announcements() []Announcement {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]Announcement(nil), p.announcements...)
+}
+
+// WaitForAnnouncement waits until c is announced, or returns at once if it was already.
+func (p *MockPando) WaitForAnnouncement(ctx context.Context, c cid.Cid) (*Announcement, error) {
+	for {
+		p.mutex.Lock()
+		for i := range p.announcements {
+			if p.announcements[i].Cid.Equals(c) {
+				a := p.announcements[i]
+				p.mutex.Unlock()
+				return &a, nil
+			}
+		}
+		announced := p.announced
+		p.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s was not announced: %w", c, ctx.Err())
+		case <-announced:
+		}
+	}
+}
+
+func (p *MockPando) receive(ctx context.Context) {
+	defer close(p.done)
+	for {
+		msg, err := p.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		var m dtsync.Message
+		if err = m.UnmarshalCBOR(bytes.NewReader(msg.GetData())); err != nil {
+			continue
+		}
+		a := Announcement{Cid: m.Cid, Provider: msg.GetFrom(), ExtraData: m.ExtraData}
+		a.Addrs, _ = m.GetAddrs()
+
+		p.mutex.Lock()
+		p.announcements = append(p.announcements, a)
+		p.heads[a.Provider] = a.Cid
+		if p.autoInclude {
+			p.include(a.Cid, a.Provider)
+		}
+		close(p.announced)
+		p.announced = make(chan struct{})
+		p.mutex.Unlock()
+	}
+}
+
+func (p *MockPando) serveHead(w http.ResponseWriter, r *http.Request) {
+	id, err := peer.Decode(r.URL.Query().Get("peerid"))
+	if err != nil {
+		respond(w, http.StatusBadRequest, nil)
+		return
+	}
+	p.mutex.Lock()
+	head, ok := p.heads[id]
+	p.mutex.Unlock()
+	if !ok {
+		respond(w, http.StatusNotFound, nil)
+		return
+	}
+	respond(w, http.StatusOK, struct{ Cid string }{Cid: head.String()})
+}
+
+func (p *MockPando) serveInclusion(w http.ResponseWriter, r *http.Request) {
+	c, err := cid.Decode(r.URL.Query().Get("cid"))
+	if err != nil {
+		respond(w, http.StatusBadRequest, nil)
+		return
+	}
+	respond(w, http.StatusOK, p.inclusion(c))
+}
+
+func (p *MockPando) serveInclusions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	var req struct {
+		Cids []string `json:"cids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, nil)
+		return
+	}
+	inclusions := make([]*pandoapi.MetaInclusion, 0, len(req.Cids))
+	for _, s := range req.Cids {
+		c, err := cid.Decode(s)
+		if err != nil {
+			respond(w, http.StatusBadRequest, nil)
+			return
+		}
+		inclusions = append(inclusions, p.inclusion(c))
+	}
+	respond(w, http.StatusOK, inclusions)
+}
+
+// inclusion returns the inclusion of c, not in Pando if it is not included.
+func (p *MockPando) inclusion(c cid.Cid) *pandoapi.MetaInclusion {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if inclusion, ok := p.inclusions[c]; ok {
+		res := *inclusion
+		return &res
+	}
+	return &pandoapi.MetaInclusion{ID: c}
+}
+
+// respond writes data in the response envelope of the Pando API.
+func respond(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Data    interface{} `json:"Data"`
+	}{Code: code, Message: http.StatusText(code), Data: data})
+}
@@ -0,0 +1,66 @@
+package testutil
+
+import (
+	"context"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/stretchr/testify/require"
+	"pandoClient/pkg/engine"
+	"pandoClient/pkg/pandoapi"
+	"testing"
+	"time"
+)
+
+func TestMockPando(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p, err := NewMockPando("")
+	require.NoError(t, err)
+	defer p.Close()
+	p.SetAutoInclude(true)
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	e, err := engine.New(
+		engine.WithHost(h),
+		engine.WithPublisherKind(engine.DataTransferPublisher),
+		engine.WithPandoAddrinfo(p.AddrInfo()),
+		engine.WithPandoAPIClient(p.URL(), time.Second),
+	)
+	require.NoError(t, err)
+	require.NoError(t, e.Start(ctx))
+	defer e.Shutdown()
+	require.NoError(t, h.Connect(ctx, p.AddrInfo()))
+	require.NoError(t, p.WaitForProvider(ctx, h.ID()))
+
+	c, err := e.PublishBytesData(ctx, []byte("mocked"))
+	require.NoError(t, err)
+	a, err := p.WaitForAnnouncement(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, h.ID(), a.Provider)
+	require.NotEmpty(t, a.Addrs)
+
+	api := pandoapi.New(p.URL(), time.Second)
+	head, err := api.ProviderHead(ctx, h.ID().String())
+	require.NoError(t, err)
+	require.Equal(t, c, head)
+	inclusion, err := e.GetInclusion(ctx, c)
+	require.NoError(t, err)
+	require.True(t, inclusion.InPando)
+	require.False(t, inclusion.InSnapShot)
+
+	snapshot, err := cid.Decode("bafkqaaa")
+	require.NoError(t, err)
+	p.IncludeInSnapshot(c, h.ID(), snapshot, 3)
+	inclusions, err := api.MetaInclusions(ctx, []cid.Cid{c})
+	require.NoError(t, err)
+	require.Len(t, inclusions, 1)
+	require.True(t, inclusions[0].InSnapShot)
+	require.Equal(t, uint64(3), inclusions[0].SnapShotHeight)
+
+	other, err := e.PreviewCid(ctx, []byte("not published"))
+	require.NoError(t, err)
+	inclusion, err = e.GetInclusion(ctx, other)
+	require.NoError(t, err)
+	require.False(t, inclusion.InPando)
+}
@@ -0,0 +1,245 @@
+package log
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rotateScheme     = "rotate"
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+)
+
+var registerRotateSink sync.Once
+
+// Rotation configures the rotation of the log file. Rotated files are renamed with their
+// rotation time, e.g. client-2006-01-02T15-04-05.000.log for client.log.
+type Rotation struct {
+	// MaxSize rotates the file before it grows over this number of bytes, 0 to disable.
+	MaxSize int64
+	// Interval rotates the file once it was written to for this long, 0 to disable.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept, 0 to keep all.
+	MaxBackups int
+	// MaxAge removes the rotated files older than this, 0 to keep all.
+	MaxAge time.Duration
+}
+
+func (r Rotation) enabled() bool {
+	return r.MaxSize > 0 || r.Interval > 0
+}
+
+func (r Rotation) validate() error {
+	if r.MaxSize < 0 || r.Interval < 0 || r.MaxBackups < 0 || r.MaxAge < 0 {
+		return fmt.Errorf("log rotation settings can not be negative")
+	}
+	return nil
+}
+
+// sinkURL encodes the rotation of file as the URL of a zap sink, the way go-log opens outputs.
+func (r Rotation) sinkURL(file string) (string, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	registerRotateSink.Do(func() {
+		if err = zap.RegisterSink(rotateScheme, newRotateSink); err != nil {
+			err = fmt.Errorf("cannot register log rotation: %w", err)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: rotateScheme, Path: filepath.ToSlash(path), RawQuery: url.Values{
+		"maxsize":    []string{strconv.FormatInt(r.MaxSize, 10)},
+		"interval":   []string{r.Interval.String()},
+		"maxbackups": []string{strconv.Itoa(r.MaxBackups)},
+		"maxage":     []string{r.MaxAge.String()},
+	}.Encode()}
+	return u.String(), nil
+}
+
+func newRotateSink(u *url.URL) (zap.Sink, error) {
+	q := u.Query()
+	var r Rotation
+	var err error
+	if r.MaxSize, err = strconv.ParseInt(q.Get("maxsize"), 10, 64); err != nil {
+		return nil, err
+	}
+	if r.Interval, err = time.ParseDuration(q.Get("interval")); err != nil {
+		return nil, err
+	}
+	if r.MaxBackups, err = strconv.Atoi(q.Get("maxbackups")); err != nil {
+		return nil, err
+	}
+	if r.MaxAge, err = time.ParseDuration(q.Get("maxage")); err != nil {
+		return nil, err
+	}
+	return newRotatingFile(filepath.FromSlash(u.Path), r)
+}
+
+// rotatingFile is a log file rotated according to its Rotation.
+type rotatingFile struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mutex    sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	// failedAt is the time of the last failed rotation, retried after rotateRetryInterval.
+	failedAt time.Time
+}
+
+// rotateRetryInterval is the delay before a failed rotation is retried, so that a file over its
+// max size does not retry it on every write.
+const rotateRetryInterval = time.Minute
+
+func newRotatingFile(path string, rotation Rotation) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, rotation: rotation, now: time.Now}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	rf.openedAt = rf.now()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	if rf.shouldRotate(len(p)) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) shouldRotate(n int) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if !rf.failedAt.IsZero() && rf.now().Sub(rf.failedAt) < rotateRetryInterval {
+		return false
+	}
+	if rf.rotation.MaxSize > 0 && rf.size+int64(n) > rf.rotation.MaxSize {
+		return true
+	}
+	return rf.rotation.Interval > 0 && rf.now().Sub(rf.openedAt) >= rf.rotation.Interval
+}
+
+// rotate renames the file to a backup and opens a new one. If the rotation fails, the file is
+// reopened in append mode so that the logs keep going to it, and the failure is reported on
+// stderr like the ones of prune.
+func (rf *rotatingFile) rotate() error {
+	err := rf.f.Close()
+	if err == nil {
+		err = os.Rename(rf.path, rf.backupPath(rf.now().UTC()))
+	}
+	if err == nil {
+		err = rf.open()
+	}
+	if err == nil {
+		rf.failedAt = time.Time{}
+		rf.prune()
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "failed to rotate log file: %v\n", err)
+	rf.failedAt = rf.now()
+	return rf.open()
+}
+
+func (rf *rotatingFile) backupPath(t time.Time) string {
+	ext := filepath.Ext(rf.path)
+	return strings.TrimSuffix(rf.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// backups returns the rotated files, oldest first.
+func (rf *rotatingFile) backups() ([]string, error) {
+	ext := filepath.Ext(rf.path)
+	prefix := filepath.Base(strings.TrimSuffix(rf.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(rf.path))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err = time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+	}
+	// the timestamps sort chronologically.
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// prune removes the rotated files beyond the retention limits. Failures are reported on stderr,
+// the log itself being the output.
+func (rf *rotatingFile) prune() {
+	if rf.rotation.MaxBackups == 0 && rf.rotation.MaxAge == 0 {
+		return
+	}
+	backups, err := rf.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list rotated log files: %v\n", err)
+		return
+	}
+	ext := filepath.Ext(rf.path)
+	prefix := filepath.Base(strings.TrimSuffix(rf.path, ext)) + "-"
+	for i, name := range backups {
+		remove := rf.rotation.MaxBackups > 0 && len(backups)-i > rf.rotation.MaxBackups
+		if !remove && rf.rotation.MaxAge > 0 {
+			t, _ := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+			remove = rf.now().Sub(t) > rf.rotation.MaxAge
+		}
+		if !remove {
+			continue
+		}
+		if err = os.Remove(filepath.Join(filepath.Dir(rf.path), name)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove rotated log file: %v\n", err)
+		}
+	}
+}
+
+func (rf *rotatingFile) Sync() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	return rf.f.Sync()
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	return rf.f.Close()
+}
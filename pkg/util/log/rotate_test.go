@@ -0,0 +1,106 @@
+package log
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	rf := &rotatingFile{
+		path:     filepath.Join(dir, "client.log"),
+		rotation: Rotation{MaxSize: 10, Interval: time.Hour, MaxBackups: 2},
+		now:      func() time.Time { return now },
+	}
+	require.NoError(t, rf.open())
+	defer rf.Close()
+
+	write := func(s string) {
+		_, err := rf.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	write("12345")
+	write("67890")
+	// over the max size.
+	now = now.Add(time.Second)
+	write("abc")
+	backups, err := rf.backups()
+	require.NoError(t, err)
+	require.Equal(t, []string{"client-2022-06-01T00-00-01.000.log"}, backups)
+	b, err := os.ReadFile(filepath.Join(dir, backups[0]))
+	require.NoError(t, err)
+	require.Equal(t, "1234567890", string(b))
+
+	// over the interval.
+	now = now.Add(time.Hour)
+	write("def")
+	now = now.Add(time.Hour)
+	write("ghi")
+	backups, err = rf.backups()
+	require.NoError(t, err)
+	require.Equal(t, []string{"client-2022-06-01T01-00-01.000.log", "client-2022-06-01T02-00-01.000.log"}, backups)
+	b, err = os.ReadFile(rf.path)
+	require.NoError(t, err)
+	require.Equal(t, "ghi", string(b))
+
+	// backups older than the max age are removed.
+	rf.rotation.MaxAge = 30 * time.Minute
+	now = now.Add(time.Hour)
+	write("jkl")
+	backups, err = rf.backups()
+	require.NoError(t, err)
+	require.Equal(t, []string{"client-2022-06-01T03-00-01.000.log"}, backups)
+}
+
+func TestRotatingFile_FailedRotation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	rf := &rotatingFile{
+		path:     filepath.Join(dir, "client.log"),
+		rotation: Rotation{MaxSize: 10},
+		now:      func() time.Time { return now },
+	}
+	require.NoError(t, rf.open())
+	defer rf.Close()
+
+	write := func(s string) {
+		_, err := rf.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	write("1234567890")
+	// a non empty directory at the backup path fails the rename.
+	now = now.Add(time.Second)
+	require.NoError(t, os.MkdirAll(filepath.Join(rf.backupPath(now), "taken"), 0755))
+	write("abc")
+	// the rotation is not retried before rotateRetryInterval.
+	write("def")
+	b, err := os.ReadFile(rf.path)
+	require.NoError(t, err)
+	require.Equal(t, "1234567890abcdef", string(b))
+
+	now = now.Add(rotateRetryInterval)
+	write("ghi")
+	backups, err := rf.backups()
+	require.NoError(t, err)
+	require.Equal(t, []string{"client-2022-06-01T00-01-01.000.log"}, backups)
+	b, err = os.ReadFile(rf.path)
+	require.NoError(t, err)
+	require.Equal(t, "ghi", string(b))
+}
+
+func TestSetup_Rotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "client.log")
+	defer Setup(Config{Level: "error"})
+
+	require.NoError(t, Setup(Config{File: file, Rotation: Rotation{MaxSize: 1 << 20}}))
+	NewSubsystemLogger().Info("rotated output")
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "rotated output")
+
+	require.Error(t, Setup(Config{File: file, Rotation: Rotation{MaxSize: -1}}))
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"fmt"
+	"github.com/ipfs/go-log/v2"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// Log output formats.
+const (
+	ConsoleFormat = "console"
+	JSONFormat    = "json"
+)
+
+// Config configures the loggers of all the subsystems.
+type Config struct {
+	// Level is the default level, info if empty.
+	Level string
+	// Format is ConsoleFormat, colorized on terminals, or JSONFormat. Defaults to ConsoleFormat.
+	Format string
+	// File is the path logs are appended to, stderr if empty.
+	File string
+	// Rotation rotates File, if set.
+	Rotation Rotation
+	// Subsystems overrides Level for the subsystems whose name starts with a key, e.g.
+	// "pandoClient/pkg/engine". Longer keys take precedence.
+	Subsystems map[string]string
+}
+
+// Setup replaces the logging setup of all the subsystems with cfg.
+func Setup(cfg Config) error {
+	lc := log.Config{Level: log.LevelInfo}
+	if cfg.Level != "" {
+		level, err := log.LevelFromString(cfg.Level)
+		if err != nil {
+			return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+		}
+		lc.Level = level
+	}
+
+	switch cfg.Format {
+	case "", ConsoleFormat:
+		lc.Format = log.PlaintextOutput
+		if cfg.File == "" && isTerminal(os.Stderr) {
+			lc.Format = log.ColorizedOutput
+		}
+	case JSONFormat:
+		lc.Format = log.JSONOutput
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", cfg.Format, ConsoleFormat, JSONFormat)
+	}
+
+	if err := cfg.Rotation.validate(); err != nil {
+		return err
+	}
+	switch {
+	case cfg.File == "":
+		lc.Stderr = true
+	case cfg.Rotation.enabled():
+		u, err := cfg.Rotation.sinkURL(cfg.File)
+		if err != nil {
+			return err
+		}
+		// make sure the file can be opened, go-log panics on failure.
+		rf, err := newRotatingFile(cfg.File, cfg.Rotation)
+		if err != nil {
+			return fmt.Errorf("cannot open log file: %w", err)
+		}
+		_ = rf.Close()
+		lc.URL = u
+	default:
+		// the file is opened by go-log, which panics on failure.
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("cannot open log file: %w", err)
+		}
+		_ = f.Close()
+		lc.File = cfg.File
+	}
+
+	prefixes := make([]string, 0, len(cfg.Subsystems))
+	for prefix, level := range cfg.Subsystems {
+		if _, err := log.LevelFromString(level); err != nil {
+			return fmt.Errorf("invalid log level %q of %s: %w", level, prefix, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	log.SetupLogging(lc)
+	// shorter prefixes first, so that longer ones override them.
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		if err := log.SetLogLevelRegex("^"+regexp.QuoteMeta(prefix), cfg.Subsystems[prefix]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,42 @@
+package log
+
+import (
+	"encoding/json"
+	"github.com/ipfs/go-log/v2"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "client.log")
+	engineLogger := log.Logger("pandoClient/pkg/engine.init")
+	adminLogger := log.Logger("pandoClient/pkg/server/admin/http.init")
+	defer log.SetupLogging(log.Config{Level: log.LevelError, Stderr: true})
+
+	err := Setup(Config{
+		Level:      "warn",
+		Format:     JSONFormat,
+		File:       file,
+		Subsystems: map[string]string{"pandoClient/pkg": "error", "pandoClient/pkg/engine": "debug"},
+	})
+	require.NoError(t, err)
+	engineLogger.Debugw("engine debug", "k", "v")
+	adminLogger.Warn("admin warn")
+	require.NoError(t, engineLogger.Sync())
+
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 1)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	require.Equal(t, "engine debug", entry["msg"])
+	require.Equal(t, "v", entry["k"])
+
+	require.Error(t, Setup(Config{Format: "xml"}))
+	require.Error(t, Setup(Config{Level: "loud"}))
+	require.Error(t, Setup(Config{Subsystems: map[string]string{"pandoClient": "loud"}}))
+}